@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/action"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
+)
+
+func TestResolveSignedAckToken(t *testing.T) {
+	signer := action.NewAckTokenSigner("secret")
+	ct := &CheckinT{signer: signer}
+	agent := &model.Agent{
+		ESDocument:  model.ESDocument{Id: "agent-1"},
+		ActionSeqNo: []int64{10},
+	}
+	ctx := context.Background()
+
+	token := ct.signAckToken(agent.Id, []model.Action{
+		{ESDocument: model.ESDocument{SeqNo: 12}},
+		{ESDocument: model.ESDocument{SeqNo: 15}},
+	}, "action-id")
+	seqno, err := ct.resolveSeqNo(ctx, CheckinRequest{AckToken: token}, agent)
+	require.NoError(t, err)
+	assert.Equal(t, sqn.SeqNo{15}, seqno)
+
+	// Older than the last checkin, as replayed after a restore
+	stale := signer.Sign(agent.Id, 5)
+	_, err = ct.resolveSeqNo(ctx, CheckinRequest{AckToken: stale}, agent)
+	assert.Equal(t, action.ErrInvalidAckToken, err)
+
+	// Issued to another agent
+	_, err = ct.resolveSeqNo(ctx, CheckinRequest{AckToken: signer.Sign("agent-2", 15)}, agent)
+	assert.Equal(t, action.ErrInvalidAckToken, err)
+
+	// Without a token the agent resumes from its record
+	seqno, err = ct.resolveSeqNo(ctx, CheckinRequest{}, agent)
+	require.NoError(t, err)
+	assert.Equal(t, sqn.SeqNo{10}, seqno)
+
+	// Signing turned off; the record is used
+	seqno, err = (&CheckinT{}).resolveSeqNo(ctx, CheckinRequest{AckToken: token}, agent)
+	require.NoError(t, err)
+	assert.Equal(t, sqn.SeqNo{10}, seqno)
+
+	// Tokens are left alone unless signing is enabled
+	assert.Equal(t, "action-id", (&CheckinT{}).signAckToken(agent.Id, []model.Action{{}}, "action-id"))
+}
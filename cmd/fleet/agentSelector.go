@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/hashicorp/go-version"
+)
+
+// selectorAgentFields are the fields read of the agents selected.
+var selectorAgentFields = []string{dl.FieldAgentVersion}
+
+// agentSelector selects the active agents matching the AgentFilter of an admin
+// request. The filter is queried as is; the version constraint is checked on
+// the agents read, as versions do not compare as strings.
+type agentSelector struct {
+	filter dl.ActiveAgentsFilter
+	verCon version.Constraints
+}
+
+func newAgentSelector(f AgentFilter) (agentSelector, error) {
+	var verCon version.Constraints
+	if f.Version != "" {
+		var err error
+		if verCon, err = version.NewConstraint(f.Version); err != nil {
+			return agentSelector{}, fmt.Errorf("invalid version constraint %q: %w", f.Version, err)
+		}
+	}
+
+	return agentSelector{
+		filter: dl.ActiveAgentsFilter{
+			AgentIds: f.AgentIds,
+			PolicyId: f.PolicyId,
+			Status:   f.Status,
+			Tags:     f.Tags,
+		},
+		verCon: verCon,
+	}, nil
+}
+
+// targets returns the IDs of the agents within the version constraint.
+func (s agentSelector) targets(hits []es.HitT) ([]string, error) {
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		if s.verCon != nil {
+			var agent model.Agent
+			if err := hit.Unmarshal(&agent); err != nil {
+				return nil, err
+			}
+			if agent.Agent == nil {
+				continue
+			}
+			ver, err := version.NewVersion(agent.Agent.Version)
+			if err != nil || !s.verCon.Check(ver) {
+				continue
+			}
+		}
+		ids = append(ids, hit.Id)
+	}
+	return ids, nil
+}
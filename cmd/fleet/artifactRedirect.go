@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
+
+	"github.com/rs/zerolog/log"
+)
+
+// artifactRedirect redirects the agents to the artifacts on a CDN or object
+// store, named by the sha256 of their encoded payload under the base URL.
+type artifactRedirect struct {
+	base   *url.URL
+	signer signedurl.Signer
+	ttl    time.Duration
+	now    func() time.Time
+
+	// Verifies the pulls of the CDN from Fleet Server; nil with the s3 signer
+	hmac *signedurl.HMAC
+}
+
+// newArtifactRedirect returns nil when disabled.
+func newArtifactRedirect(cfg *config.ArtifactRedirect) *artifactRedirect {
+	if !cfg.Enabled {
+		return nil
+	}
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid artifact redirect url; artifacts served by Fleet Server")
+		return nil
+	}
+
+	ar := &artifactRedirect{
+		base: base,
+		ttl:  cfg.TTL,
+		now:  time.Now,
+	}
+	switch cfg.Signer {
+	case config.ArtifactSignerS3:
+		ar.signer = signedurl.S3{
+			Region:          cfg.S3.Region,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+		}
+	default:
+		ar.hmac = &signedurl.HMAC{Secret: []byte(cfg.Secret)}
+		ar.signer = ar.hmac
+	}
+	return ar
+}
+
+// location returns the signed URL of the artifact for the method.
+func (ar *artifactRedirect) location(method, sha2 string) (string, error) {
+	u := *ar.base
+	u.Path = path.Join("/", u.Path, sha2)
+	u.RawPath = ""
+
+	signed, err := ar.signer.Sign(method, &u, ar.now(), ar.ttl)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+// write redirects the request to the artifact; the redirect is signed for
+// this request alone and is not cached.
+func (ar *artifactRedirect) write(w http.ResponseWriter, r *http.Request, artifact *model.Artifact) error {
+	loc, err := ar.location(r.Method, artifact.EncodedSha256)
+	if err != nil {
+		return err
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Location", loc)
+	w.WriteHeader(http.StatusTemporaryRedirect)
+	cntArtifacts.redirects.Inc()
+	return nil
+}
+
+// verify checks the signature of a pull of the artifact by the CDN.
+func (ar *artifactRedirect) verify(sha2, expires, signature string) error {
+	if ar == nil || ar.hmac == nil {
+		return signedurl.ErrInvalidSignature
+	}
+	return ar.hmac.Verify(sha2, expires, signature, ar.now())
+}
@@ -12,18 +12,38 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 const (
 	kAPIKeyTTL = 5 * time.Second
+
+	// How long the operator privileges of an API key are trusted before
+	// they are checked against elasticsearch again.
+	kOperatorTTL = 30 * time.Second
+
+	// Backoff before a rejected API key is authenticated against
+	// elasticsearch again; doubles on each consecutive failure.
+	kAuthFailBackoffInit = 5 * time.Second
+	kAuthFailBackoffMax  = time.Minute
 )
 
 var ErrApiKeyNotEnabled = errors.New("APIKey not enabled")
 var ErrAgentCorrupted = errors.New("agent record corrupted")
+var ErrOperatorUnauthorized = errors.New("API key is not authorized for operator APIs")
+
+// Privileges an API key must hold to use the operator APIs; the same access
+// Kibana has on the Fleet system indices.
+var operatorPrivileges = apikey.IndexPrivileges{
+	Names:      []string{".fleet-*"},
+	Privileges: []string{"all"},
+}
 
 // This authenticates that the provided API key exists and is enabled.
 // WARNING: This does not validate that the api key is valid for the Fleet Domain.
@@ -39,6 +59,19 @@ func authApiKey(r *http.Request, client *elasticsearch.Client, c cache.Cache) (*
 		return key, nil
 	}
 
+	defer timePhase(r.Context(), phaseAuth)()
+
+	if failure, ok := c.GetAuthFailure(*key); ok && time.Now().Before(failure.Until) {
+		cntAuthSuppressed.Inc()
+		log.Debug().
+			Err(failure.Err).
+			Str("id", key.Id).
+			Int("count", failure.Count).
+			Time("until", failure.Until).
+			Msg("ApiKey authentication suppressed")
+		return nil, failure.Err
+	}
+
 	start := time.Now()
 
 	info, err := key.Authenticate(r.Context(), client)
@@ -49,20 +82,25 @@ func authApiKey(r *http.Request, client *elasticsearch.Client, c cache.Cache) (*
 			Str("id", key.Id).
 			Dur("rtt", time.Since(start)).
 			Msg("ApiKey fail authentication")
+		if errors.Is(err, apikey.ErrUnauthorized) {
+			cacheAuthFailure(c, *key, err)
+		}
 		return nil, err
 	}
 
-	log.Trace().
-		Str("id", key.Id).
-		Dur("rtt", time.Since(start)).
-		Str("UserName", info.UserName).
-		Strs("Roles", info.Roles).
-		Bool("enabled", info.Enabled).
-		RawJSON("meta", info.Metadata).
-		Msg("ApiKey authenticated")
+	if e := log.Trace(); e.Enabled() {
+		e.Str("id", key.Id).
+			Dur("rtt", time.Since(start)).
+			Str("UserName", info.UserName).
+			Strs("Roles", info.Roles).
+			Bool("enabled", info.Enabled).
+			RawJSON("meta", redact.JSON(info.Metadata)).
+			Msg("ApiKey authenticated")
+	}
 
 	if info.Enabled {
 		c.SetApiKey(*key, kAPIKeyTTL)
+		c.DelAuthFailure(*key)
 	} else {
 		err = ErrApiKeyNotEnabled
 		log.Info().
@@ -70,11 +108,40 @@ func authApiKey(r *http.Request, client *elasticsearch.Client, c cache.Cache) (*
 			Str("id", key.Id).
 			Dur("rtt", time.Since(start)).
 			Msg("ApiKey not enabled")
+		cacheAuthFailure(c, *key, err)
 	}
 
 	return key, err
 }
 
+// cacheAuthFailure records the rejected key so it is not authenticated again
+// until its backoff elapses; an agent retrying with a revoked key would
+// otherwise cost a security API call per attempt.
+func cacheAuthFailure(c cache.Cache, key apikey.ApiKey, err error) {
+	count := 1
+	if prev, ok := c.GetAuthFailure(key); ok {
+		count = prev.Count + 1
+	}
+
+	cntAuthFail.Inc()
+	c.SetAuthFailure(key, cache.AuthFailure{
+		Err:   err,
+		Count: count,
+		Until: time.Now().Add(authFailBackoff(count)),
+	}, 2*kAuthFailBackoffMax)
+}
+
+func authFailBackoff(count int) time.Duration {
+	backoff := kAuthFailBackoffInit
+	for i := 1; i < count && backoff < kAuthFailBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > kAuthFailBackoffMax {
+		backoff = kAuthFailBackoffMax
+	}
+	return backoff
+}
+
 func authAgent(r *http.Request, id string, bulker bulk.Bulk, c cache.Cache) (*model.Agent, error) {
 	// authenticate
 	key, err := authApiKey(r, bulker.Client(), c)
@@ -91,11 +158,96 @@ func authAgent(r *http.Request, id string, bulker bulk.Bulk, c cache.Cache) (*mo
 	if agent.AccessApiKeyId != key.Id {
 		log.Info().
 			Err(ErrAgentCorrupted).
-			Interface("agent", &agent).
+			RawJSON("agent", redact.Object(&agent)).
 			Str("key.Id", key.Id).
 			Msg("agent API key id mismatch agent record")
 		return nil, ErrAgentCorrupted
 	}
 
+	setBodySizePolicy(r, agent.PolicyId)
+
 	return agent, nil
 }
+
+// withKeyLimit refuses the requests of API keys blocked by the key limiter
+// before they reach the handlers. Requests without an API key are let through
+// for the handler to reject. The limiter runs before authentication, so the
+// keys are told apart by id and secret: a flood with a forged secret only
+// blocks the forged key. With qt the agent of a key getting blocked is
+// quarantined.
+func withKeyLimit(next http.Handler, kl *limit.KeyLimiter, qt *QuarantineT) http.Handler {
+	if kl == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := apikey.ExtractAPIKey(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		blocked, err := kl.Allow(key.Id, accessApiKeyHash(*key))
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cntAuthBlocked.Inc()
+		if blocked {
+			auditLog("api-key-blocked", "failure").
+				Str("id", key.Id).
+				Str("path", r.URL.Path).
+				Str("remote", remoteIP(r)).
+				Msg("API key blocked for exceeding its rate limit")
+			if qt != nil {
+				qt.quarantineBlocked(r)
+			}
+		}
+
+		if err := WriteError(w, http.StatusTooManyRequests, "KeyBlocked", "api key is blocked for exceeding its rate limit"); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	})
+}
+
+// auditLog starts a log event recording a security relevant decision.
+func auditLog(action, outcome string) *zerolog.Event {
+	return log.Warn().
+		Str("event.kind", "event").
+		Str("event.category", "authentication").
+		Str("event.action", action).
+		Str("event.outcome", outcome)
+}
+
+// authOperator authenticates the API key of a caller of the operator APIs and
+// validates it grants full access to the Fleet indices. Agent API keys do not.
+// Keys granted the privileges are cached for kOperatorTTL; denials are not.
+func authOperator(r *http.Request, bulker bulk.Bulk, c cache.Cache) (*apikey.ApiKey, error) {
+	key, err := authApiKey(r, bulker.Client(), c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ValidOperator(*key) {
+		return key, nil
+	}
+
+	timed := timePhase(r.Context(), phaseAuth)
+	ok, err := key.HasPrivileges(r.Context(), bulker.Client(), operatorPrivileges)
+	timed()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		log.Info().
+			Err(ErrOperatorUnauthorized).
+			Str("id", key.Id).
+			Msg("ApiKey lacks operator privileges")
+		return nil, ErrOperatorUnauthorized
+	}
+
+	c.SetOperator(*key, kOperatorTTL)
+	return key, nil
+}
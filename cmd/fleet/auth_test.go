@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthFailBackoff(t *testing.T) {
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{1, kAuthFailBackoffInit},
+		{2, 2 * kAuthFailBackoffInit},
+		{3, 4 * kAuthFailBackoffInit},
+		{4, 8 * kAuthFailBackoffInit},
+		{5, kAuthFailBackoffMax},
+		{1000, kAuthFailBackoffMax},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, authFailBackoff(tc.count), "count %d", tc.count)
+	}
+}
+
+func TestWithKeyLimitForgedSecret(t *testing.T) {
+	kl := limit.NewKeyLimiter(&config.KeyLimit{Interval: time.Minute, Burst: 2, Block: time.Hour})
+	h := withKeyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), kl, nil)
+
+	serve := func(auth string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.Header.Set("Authorization", auth)
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// A flood forging the secret of key-1 gets blocked
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, serve("ApiKey a2V5LTE6Z3Vlc3M=")) // key-1:guess
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve("ApiKey a2V5LTE6Z3Vlc3M="))
+
+	// The requests with the real secret of key-1 are not
+	assert.Equal(t, http.StatusOK, serve("ApiKey a2V5LTE6c2VjcmV0")) // key-1:secret
+}
@@ -0,0 +1,216 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/lifecycle"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// UnenrolledReasonAuthFailures is recorded on the agents unenrolled for
+	// failing to authenticate repeatedly.
+	UnenrolledReasonAuthFailures = "auth_failures"
+
+	// Keys tracked at most; failures of other keys are not counted until
+	// the tracked ones expire.
+	kMaxAuthStrikes = 10000
+)
+
+type authStrikes struct {
+	count int
+	first time.Time
+}
+
+// autoUnenroller counts the consecutive authentication failures of the access
+// API keys and force unenrolls the agent of a key failing too often: its API
+// keys are invalidated and its record marked unenrolled with the cause. A
+// successful authentication forgets the failures of the key.
+//
+// The failures are counted by key, secret included, and the agent is only
+// unenrolled when the secret is the one of its access API key, so a caller
+// knowing only the id of the key cannot unenroll the agent.
+type autoUnenroller struct {
+	cfg    config.AutoUnenroll
+	bulker bulk.Bulk
+	events *lifecycle.Outbox
+	now    func() time.Time
+
+	mut     sync.Mutex
+	strikes map[string]authStrikes
+}
+
+// newAutoUnenroller returns nil when disabled.
+func newAutoUnenroller(cfg *config.AutoUnenroll, bulker bulk.Bulk, events *lifecycle.Outbox) *autoUnenroller {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &autoUnenroller{
+		cfg:     *cfg,
+		bulker:  bulker,
+		events:  events,
+		now:     time.Now,
+		strikes: make(map[string]authStrikes),
+	}
+}
+
+// observe records the outcome of the authentication of the agent request.
+// Only the rejections of the key by Elasticsearch count as failures.
+func (u *autoUnenroller) observe(r *http.Request, err error) {
+	if u == nil {
+		return
+	}
+
+	key, kerr := apikey.ExtractAPIKey(r)
+	if kerr != nil {
+		return
+	}
+
+	if err == nil {
+		u.forget(strikeId(*key))
+		return
+	}
+	if !errors.Is(err, apikey.ErrUnauthorized) && err != ErrApiKeyNotEnabled {
+		return
+	}
+
+	count := u.strike(strikeId(*key))
+	if count < u.cfg.MaxFailures {
+		return
+	}
+
+	if err := u.unenroll(r.Context(), *key, count); err != nil {
+		log.Warn().
+			Err(err).
+			Str("id", key.Id).
+			Int("failures", count).
+			Msg("Fail to unenroll agent failing authentication")
+	}
+}
+
+// strikeId identifies the key, secret included, in the failures counted.
+func strikeId(key apikey.ApiKey) string {
+	return key.Id + ":" + accessApiKeyHash(key)
+}
+
+// strike counts an authentication failure of the key and returns the number
+// of failures within the window.
+func (u *autoUnenroller) strike(id string) int {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	now := u.now()
+	s, ok := u.strikes[id]
+	if !ok || now.Sub(s.first) > u.cfg.Window {
+		if !ok && len(u.strikes) >= kMaxAuthStrikes {
+			u.prune(now)
+			if len(u.strikes) >= kMaxAuthStrikes {
+				return 0
+			}
+		}
+		s = authStrikes{first: now}
+	}
+	s.count++
+	u.strikes[id] = s
+	return s.count
+}
+
+func (u *autoUnenroller) prune(now time.Time) {
+	for id, s := range u.strikes {
+		if now.Sub(s.first) > u.cfg.Window {
+			delete(u.strikes, id)
+		}
+	}
+}
+
+func (u *autoUnenroller) forget(id string) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	delete(u.strikes, id)
+}
+
+// unenroll force unenrolls the active agent of the access API key; the
+// failures of the key are forgotten once done, or when it is not the access
+// API key of an active agent.
+func (u *autoUnenroller) unenroll(ctx context.Context, key apikey.ApiKey, count int) error {
+	id := key.Id
+	agent, err := findAgentByApiKeyId(ctx, u.bulker, id)
+	if errors.Is(err, ErrAgentNotFound) {
+		u.forget(strikeId(key))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !agent.Active {
+		u.forget(strikeId(key))
+		return nil
+	}
+	// The agents enrolled before the hash was recorded cannot be proven to
+	// hold their key, and are left alone
+	if !holdsApiKey(agent, key) {
+		u.forget(strikeId(key))
+		log.Debug().
+			Str("id", id).
+			Str("agent_id", agent.Id).
+			Msg("Key failing authentication is not the access API key of the agent")
+		return nil
+	}
+
+	// The access API key may already be invalid; keep on marking the agent
+	if apiKeys := _getAPIKeyIDs(agent); len(apiKeys) > 0 {
+		if err := invalidateAPIKeys(ctx, u.bulker, apiKeys...); err != nil {
+			log.Warn().
+				Err(err).
+				Str("agent_id", agent.Id).
+				Msg("Fail to invalidate API keys of agent failing authentication")
+		}
+	}
+
+	now := u.now().UTC().Format(time.RFC3339)
+	doc := bulk.UpdateFields{
+		dl.FieldActive:           false,
+		dl.FieldUnenrolledAt:     now,
+		dl.FieldUnenrolledReason: UnenrolledReasonAuthFailures,
+		dl.FieldUpdatedAt:        now,
+	}
+
+	body, err := doc.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := u.bulker.Update(ctx, dl.FleetAgents, agent.Id, body, bulk.WithRefresh()); err != nil {
+		return err
+	}
+	u.forget(strikeId(key))
+
+	ev := lifecycle.NewEvent(lifecycle.TypeUnenrolled, agent.Id, agent.PolicyId, agent.PolicyRevisionIdx, u.now())
+	ev.Reason = UnenrolledReasonAuthFailures
+	u.events.Emit(ev)
+
+	cntAuthUnenrolled.Inc()
+	auditLog("agent-auto-unenroll", "success").
+		Str("id", id).
+		Str("agent_id", agent.Id).
+		Int("failures", count).
+		Dur("window", u.cfg.Window).
+		Msg("Agent unenrolled for failing authentication repeatedly")
+
+	return nil
+}
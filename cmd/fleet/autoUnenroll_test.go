@@ -0,0 +1,139 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoUnenrollerDisabled(t *testing.T) {
+	u := newAutoUnenroller(&config.AutoUnenroll{MaxFailures: 1, Window: time.Hour}, ftesting.MockBulk{}, nil)
+	assert.Nil(t, u)
+
+	// A disabled unenroller observes nothing
+	u.observe(httptest.NewRequest("POST", "/", nil), apikey.ErrUnauthorized)
+}
+
+func TestAutoUnenrollerStrikes(t *testing.T) {
+	now := time.Now()
+	u := newAutoUnenroller(&config.AutoUnenroll{Enabled: true, MaxFailures: 3, Window: time.Hour}, ftesting.MockBulk{}, nil)
+	u.now = func() time.Time { return now }
+
+	assert.Equal(t, 1, u.strike("key-1"))
+	assert.Equal(t, 2, u.strike("key-1"))
+	assert.Equal(t, 1, u.strike("key-2"))
+
+	// Failures older than the window are not counted
+	now = now.Add(time.Hour + time.Second)
+	assert.Equal(t, 1, u.strike("key-1"))
+
+	u.forget("key-1")
+	assert.Equal(t, 1, u.strike("key-1"))
+}
+
+func TestAutoUnenrollerObserve(t *testing.T) {
+	u := newAutoUnenroller(&config.AutoUnenroll{Enabled: true, MaxFailures: 3, Window: time.Hour}, ftesting.MockBulk{}, nil)
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Authorization", "ApiKey a2V5LTE6c2VjcmV0") // key-1:secret
+
+	id := strikeId(apikey.ApiKey{Id: "key-1", Key: "secret"})
+	rejected := fmt.Errorf("fail Auth: %w", apikey.ErrUnauthorized)
+	u.observe(r, rejected)
+	u.observe(r, ErrApiKeyNotEnabled)
+	assert.Equal(t, 2, u.strikes[id].count)
+
+	// Other failures do not count
+	u.observe(r, errors.New("elasticsearch unavailable"))
+	assert.Equal(t, 2, u.strikes[id].count)
+
+	// The failures of another secret are counted apart
+	other := httptest.NewRequest("POST", "/", nil)
+	other.Header.Set("Authorization", "ApiKey a2V5LTE6Z3Vlc3M=") // key-1:guess
+	u.observe(other, rejected)
+	assert.Equal(t, 2, u.strikes[id].count)
+	assert.Len(t, u.strikes, 2)
+
+	// A successful authentication forgets the failures
+	u.observe(r, nil)
+	assert.NotContains(t, u.strikes, id)
+}
+
+// keyAgentBulk finds the agent of the key, and records the updates.
+type keyAgentBulk struct {
+	ftesting.MockBulk
+	agent   model.Agent
+	updates int
+}
+
+func (m *keyAgentBulk) Search(ctx context.Context, index []string, body []byte, opts ...bulk.Opt) (*es.ResultT, error) {
+	src, err := json.Marshal(m.agent)
+	if err != nil {
+		return nil, err
+	}
+	return &es.ResultT{HitsT: es.HitsT{Hits: []es.HitT{{Id: m.agent.Id, Source: src}}}}, nil
+}
+
+func (m *keyAgentBulk) Update(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) error {
+	m.updates++
+	return nil
+}
+
+func TestAutoUnenrollerRequiresSecret(t *testing.T) {
+	held := apikey.ApiKey{Id: "key-1", Key: "secret"}
+	bulker := &keyAgentBulk{agent: model.Agent{
+		ESDocument:       model.ESDocument{Id: "agent-1"},
+		Active:           true,
+		AccessApiKeyId:   held.Id,
+		AccessApiKeyHash: accessApiKeyHash(held),
+	}}
+	u := newAutoUnenroller(&config.AutoUnenroll{Enabled: true, MaxFailures: 1, Window: time.Hour}, bulker, nil)
+	ctx := context.Background()
+
+	// A caller knowing only the id of the key cannot unenroll the agent
+	guess := apikey.ApiKey{Id: held.Id, Key: "guess"}
+	u.strike(strikeId(guess))
+	assert.NoError(t, u.unenroll(ctx, guess, 1))
+	assert.Equal(t, 0, bulker.updates)
+	assert.NotContains(t, u.strikes, strikeId(guess))
+
+	// Nor one of an agent enrolled before the hash was recorded
+	bulker.agent.AccessApiKeyHash = ""
+	assert.NoError(t, u.unenroll(ctx, held, 1))
+	assert.Equal(t, 0, bulker.updates)
+}
+
+func TestAutoUnenrollerBounded(t *testing.T) {
+	now := time.Now()
+	u := newAutoUnenroller(&config.AutoUnenroll{Enabled: true, MaxFailures: 3, Window: time.Hour}, ftesting.MockBulk{}, nil)
+	u.now = func() time.Time { return now }
+
+	for i := 0; i < kMaxAuthStrikes; i++ {
+		u.strike(fmt.Sprintf("key-%d", i))
+	}
+	assert.Equal(t, 0, u.strike("key-new"))
+	assert.Equal(t, 2, u.strike("key-0"))
+
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 1, u.strike("key-new"))
+	assert.Len(t, u.strikes, 1)
+}
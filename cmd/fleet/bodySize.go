@@ -0,0 +1,210 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Past kMaxBodySizePolicies policies by endpoint, the new ones are
+	// recorded together.
+	kMaxBodySizePolicies = 100
+
+	kBodySizeOtherPolicy = "other"
+	kBodySizeNoPolicy    = "none"
+)
+
+// Upper bounds of the body size histogram buckets, in bytes
+var kBodySizeBuckets = [...]int64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+type bodySizeKey struct{}
+
+// bodySizeLabel is filled by the handler with the policy of the agent making
+// the request, once authenticated.
+type bodySizeLabel struct {
+	policyId string
+}
+
+// setBodySizePolicy labels the body sizes of the request with the policy.
+func setBodySizePolicy(r *http.Request, policyId string) {
+	if l, ok := r.Context().Value(bodySizeKey{}).(*bodySizeLabel); ok {
+		l.policyId = policyId
+	}
+}
+
+// measured records the sizes of the request body received and response body
+// sent by the handler, labeled by endpoint and by the policy the handler
+// labels the request with. The client of the request is found first, the
+// requests from the addresses the IP filter does not allow for the endpoint
+// are refused, the handlers are tracked by the watchdog and the slow requests
+// are logged.
+func (rt Router) measured(endpoint string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		r = rt.cip.track(r)
+
+		if err := rt.ipf.check(endpoint, r); err != nil {
+			if err := WriteError(w, http.StatusForbidden, "IPFiltered", "address not allowed for the endpoint"); err != nil {
+				log.Error().Err(err).Msg("fail writing error response")
+			}
+			return
+		}
+
+		if err := rt.rrt.checkDraining(endpoint); err != nil {
+			w.Header().Set("Retry-After", kDrainRetryAfter)
+			if err := WriteError(w, http.StatusServiceUnavailable, "Draining", "server is draining for a restart"); err != nil {
+				log.Error().Err(err).Msg("fail writing error response")
+			}
+			return
+		}
+
+		r, done := rt.wd.track(endpoint, r)
+		defer done()
+
+		w, r, timed := rt.srl.track(endpoint, w, r)
+		defer timed()
+
+		w, r, captured := rt.dct.track(endpoint, w, r, ps)
+		defer captured()
+
+		label := &bodySizeLabel{}
+		body := &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+		r = r.WithContext(context.WithValue(r.Context(), bodySizeKey{}, label))
+		cw := &countingResponseWriter{ResponseWriter: w}
+
+		h(cw, r, ps)
+
+		cntBodySizes.observe(endpoint, label.policyId, body.n, cw.n)
+	}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Flush lets the handlers streaming their response flush it.
+func (c *countingResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// sizeHistogram counts sizes in the kBodySizeBuckets buckets.
+type sizeHistogram struct {
+	count   uint64
+	sum     uint64
+	buckets [len(kBodySizeBuckets)]uint64
+}
+
+func (h *sizeHistogram) observe(n int64) {
+	h.count++
+	h.sum += uint64(n)
+	for i, le := range kBodySizeBuckets {
+		if n <= le {
+			h.buckets[i]++
+			break
+		}
+	}
+}
+
+// report reports the buckets cumulatively, as le_<bytes> counts; the sizes
+// past the last bucket only count in count.
+func (h *sizeHistogram) report(V monitoring.Visitor) {
+	monitoring.ReportInt(V, "count", int64(h.count))
+	monitoring.ReportInt(V, "sum", int64(h.sum))
+	var n uint64
+	for i, le := range kBodySizeBuckets {
+		n += h.buckets[i]
+		monitoring.ReportInt(V, "le_"+strconv.FormatInt(le, 10), int64(n))
+	}
+}
+
+type bodySizeStats struct {
+	in  sizeHistogram
+	out sizeHistogram
+}
+
+// bodySizes records the body sizes by endpoint and policy.
+type bodySizes struct {
+	mu        sync.Mutex
+	endpoints map[string]map[string]*bodySizeStats
+}
+
+func (b *bodySizes) observe(endpoint, policyId string, in, out int64) {
+	if policyId == "" {
+		policyId = kBodySizeNoPolicy
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.endpoints == nil {
+		b.endpoints = make(map[string]map[string]*bodySizeStats)
+	}
+	policies, ok := b.endpoints[endpoint]
+	if !ok {
+		policies = make(map[string]*bodySizeStats)
+		b.endpoints[endpoint] = policies
+	}
+	stats, ok := policies[policyId]
+	if !ok {
+		if len(policies) >= kMaxBodySizePolicies {
+			policyId = kBodySizeOtherPolicy
+			stats = policies[policyId]
+		}
+		if stats == nil {
+			stats = &bodySizeStats{}
+			policies[policyId] = stats
+		}
+	}
+	stats.in.observe(in)
+	stats.out.observe(out)
+}
+
+func (b *bodySizes) report(_ monitoring.Mode, V monitoring.Visitor) {
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for endpoint, policies := range b.endpoints {
+		monitoring.ReportNamespace(V, endpoint, func() {
+			for policyId, stats := range policies {
+				monitoring.ReportNamespace(V, policyId, func() {
+					monitoring.ReportNamespace(V, "in", func() { stats.in.report(V) })
+					monitoring.ReportNamespace(V, "out", func() { stats.out.report(V) })
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasured(t *testing.T) {
+	h := Router{}.measured("test_measured", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		_, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		setBodySizePolicy(r, ps.ByName("policy"))
+		w.Write([]byte(strings.Repeat("x", 2000)))
+	})
+
+	for _, policy := range []string{"policy-1", "policy-1", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("y", 300)))
+		h(httptest.NewRecorder(), req, httprouter.Params{{Key: "policy", Value: policy}})
+	}
+
+	cntBodySizes.mu.Lock()
+	defer cntBodySizes.mu.Unlock()
+	policies := cntBodySizes.endpoints["test_measured"]
+	require.Len(t, policies, 2)
+
+	stats := policies["policy-1"]
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(2), stats.in.count)
+	assert.Equal(t, uint64(600), stats.in.sum)
+	assert.Equal(t, uint64(2), stats.in.buckets[1], "300 bytes fall in the 1KiB bucket")
+	assert.Equal(t, uint64(4000), stats.out.sum)
+	assert.Equal(t, uint64(2), stats.out.buckets[2], "2000 bytes fall in the 4KiB bucket")
+
+	require.NotNil(t, policies[kBodySizeNoPolicy])
+	assert.Equal(t, uint64(1), policies[kBodySizeNoPolicy].in.count)
+}
+
+func TestBodySizesPolicyLimit(t *testing.T) {
+	var b bodySizes
+	for i := 0; i < kMaxBodySizePolicies+10; i++ {
+		b.observe("checkin", fmt.Sprintf("policy-%d", i), 1, 1<<30)
+	}
+
+	policies := b.endpoints["checkin"]
+	assert.Len(t, policies, kMaxBodySizePolicies+1)
+	require.NotNil(t, policies[kBodySizeOtherPolicy])
+	assert.Equal(t, uint64(10), policies[kBodySizeOtherPolicy].in.count)
+
+	var outBuckets uint64
+	for _, n := range policies[kBodySizeOtherPolicy].out.buckets {
+		outBuckets += n
+	}
+	assert.Zero(t, outBuckets, "sizes past the last bucket are only counted")
+}
@@ -7,11 +7,14 @@ package fleet
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
 
 	"github.com/rs/zerolog/log"
@@ -24,17 +27,25 @@ const kBulkCheckinFlushInterval = 10 * time.Second
 type PendingData struct {
 	fields Fields
 	seqNo  sqn.SeqNo
+	ts     time.Time
 }
 
+// BulkCheckin batches the check-in updates of the agents. Updates that fail
+// to be written because Elasticsearch is unavailable are kept and written
+// with the next flush; the number of agents with pending updates is bounded
+// by the offline queue size.
 type BulkCheckin struct {
 	bulker  bulk.Bulk
+	cfg     config.Offline
 	mut     sync.Mutex
 	pending map[string]PendingData
+	queued  int // updates kept from a failed flush
 }
 
-func NewBulkCheckin(bulker bulk.Bulk) *BulkCheckin {
+func NewBulkCheckin(bulker bulk.Bulk, cfg *config.Offline) *BulkCheckin {
 	return &BulkCheckin{
 		bulker:  bulker,
+		cfg:     *cfg,
 		pending: make(map[string]PendingData),
 	}
 }
@@ -49,11 +60,27 @@ func (bc *BulkCheckin) CheckIn(id string, fields Fields, seqno sqn.SeqNo) error
 	fields[FieldLastCheckin] = timeNow
 
 	bc.mut.Lock()
-	bc.pending[id] = PendingData{fields, seqno}
+	bc.pending[id] = mergePending(bc.pending[id], PendingData{fields, seqno, time.Now()})
 	bc.mut.Unlock()
 	return nil
 }
 
+// mergePending combines two updates of the same agent not yet written; the
+// fields and sequence number of the newer one take precedence.
+func mergePending(older, newer PendingData) PendingData {
+	if older.fields == nil {
+		return newer
+	}
+	for k, v := range newer.fields {
+		older.fields[k] = v
+	}
+	newer.fields = older.fields
+	if !newer.seqNo.IsSet() {
+		newer.seqNo = older.seqNo
+	}
+	return newer
+}
+
 func (bc *BulkCheckin) Run(ctx context.Context) error {
 
 	tick := time.NewTicker(kBulkCheckinFlushInterval)
@@ -82,7 +109,9 @@ func (bc *BulkCheckin) flush(ctx context.Context) error {
 
 	bc.mut.Lock()
 	pending := bc.pending
+	replayed := bc.queued
 	bc.pending = make(map[string]PendingData, len(pending))
+	bc.queued = 0
 	bc.mut.Unlock()
 
 	if len(pending) == 0 {
@@ -92,7 +121,10 @@ func (bc *BulkCheckin) flush(ctx context.Context) error {
 	updates := make([]bulk.BulkOp, 0, len(pending))
 
 	for id, pendingData := range pending {
-		doc := pendingData.fields
+		doc := make(Fields, len(pendingData.fields)+2)
+		for k, v := range pendingData.fields {
+			doc[k] = v
+		}
 		doc[dl.FieldUpdatedAt] = time.Now().UTC().Format(time.RFC3339)
 		if pendingData.seqNo.IsSet() {
 			doc[dl.FieldActionSeqNo] = pendingData.seqNo
@@ -120,5 +152,69 @@ func (bc *BulkCheckin) flush(ctx context.Context) error {
 		Int("cnt", len(updates)).
 		Msg("Flush updates")
 
+	switch {
+	case err == nil:
+		cntCheckinReplayed.Add(uint64(replayed))
+		cntCheckinQueued.Set(0)
+	case es.IsUnavailable(err):
+		bc.requeue(pending)
+	}
+
 	return err
 }
+
+// requeue keeps the updates of a failed flush for the next one. Updates made
+// since the flush started are newer and take precedence field by field.
+func (bc *BulkCheckin) requeue(failed map[string]PendingData) {
+	bc.mut.Lock()
+	defer bc.mut.Unlock()
+
+	for id, old := range failed {
+		cur, ok := bc.pending[id]
+		if !ok {
+			bc.pending[id] = old
+			continue
+		}
+		bc.pending[id] = mergePending(old, cur)
+	}
+
+	if dropped := bc.trim(); dropped > 0 {
+		cntCheckinDropped.Add(uint64(dropped))
+		log.Warn().
+			Int("dropped", dropped).
+			Int("queue_size", bc.cfg.QueueSize).
+			Str("drop_policy", bc.cfg.DropPolicy).
+			Msg("Check-in queue full; dropping agent updates")
+	}
+
+	bc.queued = len(bc.pending)
+	cntCheckinQueued.Set(uint64(bc.queued))
+	log.Warn().
+		Int("queued", bc.queued).
+		Msg("Elasticsearch unavailable; check-in updates queued for replay")
+}
+
+// trim drops the pending updates beyond the queue size, the least or most
+// recently checked in agents first depending on the drop policy. Must be
+// called with the lock held.
+func (bc *BulkCheckin) trim() int {
+	excess := len(bc.pending) - bc.cfg.QueueSize
+	if excess <= 0 {
+		return 0
+	}
+
+	ids := make([]string, 0, len(bc.pending))
+	for id := range bc.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bc.pending[ids[i]].ts.Before(bc.pending[ids[j]].ts)
+	})
+	if bc.cfg.DropPolicy == config.DropNewest {
+		ids = ids[len(ids)-excess:]
+	}
+	for _, id := range ids[:excess] {
+		delete(bc.pending, id)
+	}
+	return excess
+}
@@ -0,0 +1,110 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type updateBulk struct {
+	ftesting.MockBulk
+	err     error
+	updates map[string]Fields
+}
+
+func (m *updateBulk) MUpdate(ctx context.Context, ops []bulk.BulkOp, opts ...bulk.Opt) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.updates = make(map[string]Fields, len(ops))
+	for _, op := range ops {
+		var body struct {
+			Doc Fields `json:"doc"`
+		}
+		if err := json.Unmarshal(op.Body, &body); err != nil {
+			return err
+		}
+		m.updates[op.Id] = body.Doc
+	}
+	return nil
+}
+
+func TestBulkCheckinReplaysAfterOutage(t *testing.T) {
+	ctx := context.Background()
+	bulker := &updateBulk{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	bc := NewBulkCheckin(bulker, &config.Offline{QueueSize: 10, DropPolicy: config.DropOldest})
+
+	require.NoError(t, bc.CheckIn("agent1", Fields{"local_metadata": "old"}, nil))
+	require.Error(t, bc.flush(ctx))
+
+	// A newer checkin while the update is queued keeps the fields it does
+	// not set from the queued one.
+	require.NoError(t, bc.CheckIn("agent1", nil, nil))
+	require.NoError(t, bc.CheckIn("agent2", nil, nil))
+
+	bulker.err = nil
+	require.NoError(t, bc.flush(ctx))
+	require.Len(t, bulker.updates, 2)
+	assert.Equal(t, "old", bulker.updates["agent1"]["local_metadata"])
+	assert.Contains(t, bulker.updates["agent2"], FieldLastCheckin)
+
+	bulker.updates = nil
+	require.NoError(t, bc.flush(ctx))
+	assert.Nil(t, bulker.updates)
+}
+
+func TestBulkCheckinDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		kept   string
+	}{
+		{config.DropOldest, "agent3"},
+		{config.DropNewest, "agent1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			ctx := context.Background()
+			bulker := &updateBulk{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+			bc := NewBulkCheckin(bulker, &config.Offline{QueueSize: 1, DropPolicy: tc.policy})
+
+			for _, id := range []string{"agent1", "agent2", "agent3"} {
+				require.NoError(t, bc.CheckIn(id, nil, nil))
+			}
+			require.Error(t, bc.flush(ctx))
+
+			bulker.err = nil
+			require.NoError(t, bc.flush(ctx))
+			require.Len(t, bulker.updates, 1)
+			assert.Contains(t, bulker.updates, tc.kept)
+		})
+	}
+}
+
+func TestBulkCheckinDropsRejectedUpdates(t *testing.T) {
+	ctx := context.Background()
+	bulker := &updateBulk{err: errors.New("mapping failure")}
+	bc := NewBulkCheckin(bulker, &config.Offline{QueueSize: 10, DropPolicy: config.DropOldest})
+
+	require.NoError(t, bc.CheckIn("agent1", nil, nil))
+	require.Error(t, bc.flush(ctx))
+
+	bulker.err = nil
+	require.NoError(t, bc.flush(ctx))
+	assert.Nil(t, bulker.updates)
+}
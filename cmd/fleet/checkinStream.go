@@ -0,0 +1,143 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
+
+	"github.com/miolini/datacounter"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// streams tells whether the response is streamed.
+func (ct *CheckinT) streams(resp *CheckinResponse) bool {
+	cfg := &ct.cfg.CheckinStreaming
+	return cfg.Enabled && len(resp.Actions) > 0 && len(resp.Actions) >= cfg.MinActions
+}
+
+// streamResponse writes the response as it is serialized: the actions one at
+// a time, then the other fields. Only an action and the buffer are held
+// serialized at once. The response is compressed whatever its size, as it is
+// not known ahead.
+func (ct *CheckinT) streamResponse(w http.ResponseWriter, r *http.Request, resp CheckinResponse) (uint64, error) {
+	cfg := &ct.cfg.CheckinStreaming
+
+	actions := resp.Actions
+	resp.Actions = nil
+	marshaled := timePhase(r.Context(), phaseMarshal)
+	envelope, err := codec.Marshal(&resp)
+	marshaled()
+	if err != nil {
+		return 0, err
+	}
+
+	wrCounter := datacounter.NewWriterCounter(w)
+	out := io.Writer(wrCounter)
+	if cfg.WriteRate > 0 {
+		out = newRateWriter(r.Context(), out, cfg.WriteRate)
+	}
+
+	compressionLevel, _ := ct.compression.settings()
+	var zipper *gzip.Writer
+	if compressionLevel != flate.NoCompression && acceptsEncoding(r, kEncodingGzip) {
+		if zipper, err = gzip.NewWriterLevel(out, compressionLevel); err != nil {
+			return 0, err
+		}
+		w.Header().Set("Content-Encoding", kEncodingGzip)
+		out = zipper
+	}
+
+	bw := bufio.NewWriterSize(out, cfg.BufferSize)
+	var size int
+	write := func(p []byte) error {
+		size += len(p)
+		_, err := bw.Write(p)
+		return err
+	}
+
+	err = write([]byte(`{"actions":[`))
+	for i := 0; err == nil && i < len(actions); i++ {
+		if i > 0 {
+			if err = write([]byte(",")); err != nil {
+				break
+			}
+		}
+		marshaled := timePhase(r.Context(), phaseMarshal)
+		var data []byte
+		data, err = codec.Marshal(&actions[i])
+		marshaled()
+		if err == nil {
+			err = write(data)
+		}
+	}
+	if err == nil {
+		// The envelope has at least the action field
+		err = write([]byte("],"))
+	}
+	if err == nil {
+		err = write(envelope[1:])
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if zipper != nil && err == nil {
+		err = zipper.Close()
+	}
+
+	ct.compression.observe(size)
+	cntCheckin.bodyOut.Add(wrCounter.Count())
+
+	log.Trace().
+		Err(err).
+		Int("actions", len(actions)).
+		Int("srcSz", size).
+		Uint64("dstSz", wrCounter.Count()).
+		Msg("streamed checkin response")
+
+	return wrCounter.Count(), err
+}
+
+// rateWriter writes at most limit bytes per second to w.
+type rateWriter struct {
+	ctx context.Context
+	w   io.Writer
+	lim *rate.Limiter
+}
+
+func newRateWriter(ctx context.Context, w io.Writer, limit int64) *rateWriter {
+	return &rateWriter{
+		ctx: ctx,
+		w:   w,
+		lim: rate.NewLimiter(rate.Limit(limit), int(limit)),
+	}
+}
+
+func (rw *rateWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := len(p)
+		if burst := rw.lim.Burst(); chunk > burst {
+			chunk = burst
+		}
+		if err := rw.lim.WaitN(rw.ctx, chunk); err != nil {
+			return n, err
+		}
+		m, err := rw.w.Write(p[:chunk])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestStreamResponse(t *testing.T) {
+	resp := CheckinResponse{
+		AckToken:    "token",
+		Action:      "checkin",
+		MoreActions: true,
+	}
+	for i := 0; i < 150; i++ {
+		resp.Actions = append(resp.Actions, ActionResp{
+			Id:   "action-" + strconv.Itoa(i),
+			Type: "POLICY_CHANGE",
+			Data: json.RawMessage(`{"policy":{"id":"p1","outputs":{"default":{"type":"elasticsearch"}}}}`),
+		})
+	}
+	want, err := json.Marshal(&resp)
+	require.NoError(t, err)
+
+	for _, encoding := range []string{"", kEncodingGzip} {
+		t.Run("encoding "+encoding, func(t *testing.T) {
+			cfg := &config.Server{CompressionLevel: gzip.BestSpeed}
+			cfg.CheckinStreaming.InitDefaults()
+			cfg.CheckinStreaming.Enabled = true
+			cfg.CheckinStreaming.BufferSize = 512
+			ct := &CheckinT{cfg: cfg, compression: newCompressionTuner(cfg)}
+			require.True(t, ct.streams(&resp))
+
+			r := httptest.NewRequest(http.MethodPost, "/api/fleet/agents/a/checkin", nil)
+			if encoding != "" {
+				r.Header.Set("Accept-Encoding", encoding)
+			}
+			w := httptest.NewRecorder()
+			n, err := ct.writeResponse(w, r, resp)
+			require.NoError(t, err)
+
+			body := w.Body.Bytes()
+			assert.Equal(t, uint64(len(body)), n)
+			if encoding != "" {
+				assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				require.NoError(t, err)
+				body, err = ioutil.ReadAll(zr)
+				require.NoError(t, err)
+			}
+			assert.JSONEq(t, string(want), string(body))
+		})
+	}
+
+	cfg := &config.Server{}
+	cfg.CheckinStreaming.InitDefaults()
+	cfg.CheckinStreaming.Enabled = true
+	ct := &CheckinT{cfg: cfg}
+	assert.False(t, ct.streams(&CheckinResponse{Action: "checkin", Actions: resp.Actions[:99]}))
+}
+
+func TestRateWriter(t *testing.T) {
+	var buf bytes.Buffer
+	rw := newRateWriter(context.Background(), &buf, 100000)
+
+	start := time.Now()
+	n, err := rw.Write(make([]byte, 150000))
+	require.NoError(t, err)
+	assert.Equal(t, 150000, n)
+	assert.Equal(t, 150000, buf.Len())
+	// The first second worth is the burst
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(400*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rw = newRateWriter(ctx, &buf, 100000)
+	_, err = rw.Write(make([]byte, 10))
+	assert.Error(t, err)
+}
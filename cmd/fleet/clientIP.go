@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+type clientIPKey struct{}
+
+// clientIPs finds the client of the requests, looking past the trusted
+// proxies through the X-Forwarded-For header.
+type clientIPs struct {
+	proxies []*net.IPNet
+}
+
+// newClientIPs returns nil when no proxy is trusted; the client of a request
+// is then its peer.
+func newClientIPs(cfg *config.ClientIP) (*clientIPs, error) {
+	if len(cfg.TrustedProxies) == 0 {
+		return nil, nil
+	}
+	c := &clientIPs{}
+	for _, s := range cfg.TrustedProxies {
+		n, err := config.ParseNetwork(s)
+		if err != nil {
+			return nil, err
+		}
+		c.proxies = append(c.proxies, n)
+	}
+
+	log.Info().
+		Strs("trusted_proxies", cfg.TrustedProxies).
+		Msg("Client IP install")
+	return c, nil
+}
+
+// track records the client of the request in its context, where remoteIP
+// finds it.
+func (c *clientIPs) track(r *http.Request) *http.Request {
+	if c == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, c.clientIP(r)))
+}
+
+// clientIP returns the last address of the X-Forwarded-For header of a
+// request from a trusted proxy not within the trusted proxies.
+func (c *clientIPs) clientIP(r *http.Request) string {
+	ip := peerIP(r)
+	if !containsIP(c.proxies, net.ParseIP(ip)) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		parsed := net.ParseIP(hop)
+		if parsed == nil {
+			// Not to be trusted past a malformed hop
+			break
+		}
+		ip = hop
+		if !containsIP(c.proxies, parsed) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteIP returns the address of the client of the request, as tracked by
+// the router, or its peer.
+func remoteIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// peerIP returns the address of the peer of the request.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
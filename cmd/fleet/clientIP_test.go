@@ -0,0 +1,46 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestClientIPs(t *testing.T) {
+	request := func(remote string, forwarded ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = remote
+		for _, f := range forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		return r
+	}
+
+	// The client is the peer when no proxy is trusted
+	c, err := newClientIPs(&config.ClientIP{})
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	assert.Equal(t, "192.168.0.1", remoteIP(c.track(request("192.168.0.1:1000", "1.2.3.4"))))
+
+	// The client behind a trusted proxy is the last untrusted hop
+	c, err = newClientIPs(&config.ClientIP{TrustedProxies: []string{"192.168.0.1"}})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", remoteIP(c.track(request("192.168.0.1:1000", "1.2.3.4, 10.0.0.5", "192.168.0.1"))))
+	assert.Equal(t, "192.168.0.1", remoteIP(c.track(request("192.168.0.1:1000"))))
+	assert.Equal(t, "192.168.0.1", remoteIP(c.track(request("192.168.0.1:1000", "bogus"))))
+	assert.Equal(t, "10.0.0.6", remoteIP(c.track(request("10.0.0.6:1000", "1.2.3.4"))))
+
+	// Untracked requests are from their peer
+	assert.Equal(t, "10.0.0.6", remoteIP(request("10.0.0.6:1000", "1.2.3.4")))
+}
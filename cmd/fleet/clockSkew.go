@@ -0,0 +1,156 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// Upper bounds of the clock skew histogram buckets
+var kClockSkewBuckets = [...]time.Duration{time.Second, 5 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour}
+
+// clockSkewStats is the distribution of the skews of the agent clocks, by
+// absolute value.
+type clockSkewStats struct {
+	Count   uint64
+	Ahead   uint64
+	Behind  uint64
+	Over    uint64 // over the threshold
+	Max     time.Duration
+	Buckets [len(kClockSkewBuckets)]uint64
+}
+
+// clockSkew measures the skew of the clocks of the agents from the timestamps
+// they send their checkins with. The time the checkins take to reach Fleet
+// Server counts as the agent being behind.
+type clockSkew struct {
+	cfg config.ClockSkew
+
+	mut   sync.Mutex
+	stats clockSkewStats
+}
+
+func newClockSkew(cfg *config.Server) *clockSkew {
+	return &clockSkew{cfg: cfg.ClockSkew}
+}
+
+// observe returns the skew of the clock of the agent, ahead when positive,
+// from the timestamp of its checkin received at received; false when the
+// checkin has no valid timestamp. The skew is logged at info level only when
+// it crosses the threshold from previous, the seconds of skew recorded at the
+// last checkin of the agent.
+func (cs *clockSkew) observe(agentId, timestamp string, previous int64, received time.Time) (time.Duration, bool) {
+	if timestamp == "" {
+		return 0, false
+	}
+	sent, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		log.Debug().Err(err).Str("agent_id", agentId).Msg("invalid checkin timestamp")
+		return 0, false
+	}
+
+	// Saturated on overflow, as the clocks of some agents are decades off
+	skew := sent.Sub(received)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs < 0 {
+		abs = math.MaxInt64
+	}
+
+	cs.mut.Lock()
+	cs.stats.Count++
+	switch {
+	case skew > 0:
+		cs.stats.Ahead++
+	case skew < 0:
+		cs.stats.Behind++
+	}
+	if abs > cs.cfg.Threshold {
+		cs.stats.Over++
+	}
+	if abs > cs.stats.Max {
+		cs.stats.Max = abs
+	}
+	for i, le := range kClockSkewBuckets {
+		if abs <= le {
+			cs.stats.Buckets[i]++
+			break
+		}
+	}
+	cs.mut.Unlock()
+
+	over := abs > cs.cfg.Threshold
+	wasOver := absDuration(time.Duration(previous)*time.Second) > cs.cfg.Threshold
+	switch {
+	case over && !wasOver:
+		log.Info().
+			Str("agent_id", agentId).
+			Dur("skew", skew).
+			Str("timestamp", timestamp).
+			Msg("Agent clock skewed past the threshold")
+	case !over && wasOver:
+		log.Info().
+			Str("agent_id", agentId).
+			Dur("skew", skew).
+			Msg("Agent clock back within the threshold")
+	case over:
+		log.Debug().
+			Str("agent_id", agentId).
+			Dur("skew", skew).
+			Str("timestamp", timestamp).
+			Msg("Agent clock still skewed past the threshold")
+	}
+	return skew, true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// clockSkewSeconds is the skew recorded on the agent document, in seconds
+// within the range of its integer mapping.
+func clockSkewSeconds(skew time.Duration) int64 {
+	secs := int64(skew / time.Second)
+	switch {
+	case secs > math.MaxInt32:
+		return math.MaxInt32
+	case secs < math.MinInt32:
+		return math.MinInt32
+	}
+	return secs
+}
+
+func (cs *clockSkew) report(_ monitoring.Mode, V monitoring.Visitor) {
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+
+	cs.mut.Lock()
+	stats := cs.stats
+	cs.mut.Unlock()
+
+	monitoring.ReportInt(V, "count", int64(stats.Count))
+	monitoring.ReportInt(V, "ahead", int64(stats.Ahead))
+	monitoring.ReportInt(V, "behind", int64(stats.Behind))
+	monitoring.ReportInt(V, "over_threshold", int64(stats.Over))
+	monitoring.ReportFloat(V, "max", stats.Max.Seconds())
+	var n uint64
+	for i, le := range kClockSkewBuckets {
+		n += stats.Buckets[i]
+		monitoring.ReportInt(V, "le_"+strconv.FormatInt(int64(le/time.Second), 10), int64(n))
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestClockSkew(t *testing.T) {
+	var cfg config.Server
+	cfg.InitDefaults()
+	cs := newClockSkew(&cfg)
+
+	received := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok := cs.observe("agent1", "", 0, received)
+	assert.False(t, ok, "no timestamp")
+	_, ok = cs.observe("agent1", "yesterday", 0, received)
+	assert.False(t, ok, "invalid timestamp")
+
+	skew, ok := cs.observe("agent1", "2021-06-01T12:00:02.5Z", 0, received)
+	assert.True(t, ok)
+	assert.Equal(t, 2500*time.Millisecond, skew)
+
+	skew, ok = cs.observe("agent2", "2021-06-01T13:00:00+02:00", 0, received)
+	assert.True(t, ok)
+	assert.Equal(t, -time.Hour, skew, "behind, in another zone")
+
+	skew, ok = cs.observe("agent3", "0001-01-01T00:00:00Z", 0, received)
+	assert.True(t, ok)
+	assert.Equal(t, int64(math.MinInt32), clockSkewSeconds(skew), "clamped to the mapping")
+
+	stats := cs.stats
+	assert.Equal(t, uint64(3), stats.Count)
+	assert.Equal(t, uint64(1), stats.Ahead)
+	assert.Equal(t, uint64(2), stats.Behind)
+	assert.Equal(t, uint64(2), stats.Over)
+	assert.Equal(t, [len(kClockSkewBuckets)]uint64{0, 1, 0, 0, 0, 1, 0}, stats.Buckets)
+	assert.Equal(t, int64(-3600), clockSkewSeconds(-time.Hour))
+}
@@ -0,0 +1,118 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+const unitHealthy = "HEALTHY"
+
+// componentsInventory returns the inventory documents of the components
+// reported by the agent, and the hash identifying them. The hash covers the
+// identity, version and health of the components but not their messages, so
+// an agent only gets new documents when one of those changes.
+func componentsInventory(agent *model.Agent, comps []CheckinComponent, now string) (string, []model.AgentComponent) {
+	sorted := sortComponents(comps)
+
+	var agentVersion string
+	if agent.Agent != nil {
+		agentVersion = agent.Agent.Version
+	}
+
+	h := sha256.New()
+	docs := make([]model.AgentComponent, 0, len(sorted))
+	for _, comp := range sorted {
+		units := comp.Units
+
+		writeHashFields(h, comp.Id, comp.Type, comp.Version, comp.Status)
+
+		doc := model.AgentComponent{
+			Timestamp:     now,
+			AgentId:       agent.Id,
+			AgentVersion:  agentVersion,
+			PolicyId:      agent.PolicyId,
+			ComponentId:   comp.Id,
+			ComponentType: comp.Type,
+			Version:       comp.Version,
+			Status:        comp.Status,
+			Message:       comp.Message,
+		}
+
+		types := make(map[string]struct{})
+		for _, unit := range units {
+			writeHashFields(h, unit.Id, unit.Type, unit.Status)
+			if _, ok := types[unit.Type]; !ok && unit.Type != "" {
+				types[unit.Type] = struct{}{}
+				doc.UnitTypes = append(doc.UnitTypes, unit.Type)
+			}
+			if unit.Status != unitHealthy {
+				doc.UnhealthyUnits = append(doc.UnhealthyUnits, unit.Id)
+			}
+		}
+		sort.Strings(doc.UnitTypes)
+		docs = append(docs, doc)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), docs
+}
+
+// sortComponents returns a copy of the components and of their units sorted by
+// ID, so the same components are always stored and hashed alike.
+func sortComponents(comps []CheckinComponent) []CheckinComponent {
+	sorted := make([]CheckinComponent, len(comps))
+	copy(sorted, comps)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Id < sorted[j].Id
+	})
+	for i := range sorted {
+		units := make([]CheckinUnit, len(sorted[i].Units))
+		copy(units, sorted[i].Units)
+		sort.Slice(units, func(i, j int) bool {
+			return units[i].Id < units[j].Id
+		})
+		sorted[i].Units = units
+	}
+	return sorted
+}
+
+// componentsSummary returns the searchable summary of the inventory documents
+// as the fields of the agent record. Every field is set so updating the record
+// replaces the previous summary.
+func componentsSummary(docs []model.AgentComponent) Fields {
+	types := make([]string, 0, len(docs))
+	unhealthy := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, doc := range docs {
+		if _, ok := seen[doc.ComponentType]; !ok && doc.ComponentType != "" {
+			seen[doc.ComponentType] = struct{}{}
+			types = append(types, doc.ComponentType)
+		}
+		if doc.Status != unitHealthy || len(doc.UnhealthyUnits) > 0 {
+			unhealthy = append(unhealthy, doc.ComponentId)
+		}
+	}
+	sort.Strings(types)
+
+	return Fields{
+		"total":                len(docs),
+		"unhealthy":            len(unhealthy),
+		"types":                types,
+		"unhealthy_components": unhealthy,
+	}
+}
+
+func writeHashFields(h io.Writer, fields ...string) {
+	for _, f := range fields {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte{'\n'})
+}
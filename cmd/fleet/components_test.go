@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponentsInventory(t *testing.T) {
+	agent := &model.Agent{
+		ESDocument: model.ESDocument{Id: "agent-1"},
+		Agent:      &model.AgentMetadata{Id: "agent-1", Version: "8.0.0"},
+		PolicyId:   "policy-1",
+	}
+	comps := []CheckinComponent{
+		{
+			Id:      "log-default",
+			Type:    "filestream",
+			Version: "8.0.0",
+			Status:  "DEGRADED",
+			Message: "one unit failing",
+			Units: []CheckinUnit{
+				{Id: "log-default-b", Type: "input", Status: "FAILED"},
+				{Id: "log-default-a", Type: "input", Status: "HEALTHY"},
+				{Id: "log-default", Type: "output", Status: "HEALTHY"},
+			},
+		},
+		{
+			Id:      "endpoint-default",
+			Type:    "endpoint",
+			Version: "8.0.1",
+			Status:  "HEALTHY",
+		},
+	}
+
+	hash, docs := componentsInventory(agent, comps, "2021-01-01T00:00:00Z")
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(docs))
+	}
+	if docs[0].ComponentId != "endpoint-default" || docs[1].ComponentId != "log-default" {
+		t.Errorf("documents not sorted by component: %s, %s", docs[0].ComponentId, docs[1].ComponentId)
+	}
+	doc := docs[1]
+	if doc.AgentId != "agent-1" || doc.AgentVersion != "8.0.0" || doc.PolicyId != "policy-1" {
+		t.Errorf("unexpected agent fields: %+v", doc)
+	}
+	if len(doc.UnitTypes) != 2 || doc.UnitTypes[0] != "input" || doc.UnitTypes[1] != "output" {
+		t.Errorf("unexpected unit types: %v", doc.UnitTypes)
+	}
+	if len(doc.UnhealthyUnits) != 1 || doc.UnhealthyUnits[0] != "log-default-b" {
+		t.Errorf("unexpected unhealthy units: %v", doc.UnhealthyUnits)
+	}
+
+	// Order and messages do not change the hash
+	reordered := []CheckinComponent{comps[1], comps[0]}
+	reordered[1].Message = "still failing"
+	if h, _ := componentsInventory(agent, reordered, "2021-01-01T00:01:00Z"); h != hash {
+		t.Error("hash changed with order or message")
+	}
+
+	// Versions and health do
+	upgraded := []CheckinComponent{comps[0], comps[1]}
+	upgraded[1].Version = "8.0.2"
+	if h, _ := componentsInventory(agent, upgraded, "2021-01-01T00:01:00Z"); h == hash {
+		t.Error("hash did not change with version")
+	}
+}
+
+func TestComponentsSummary(t *testing.T) {
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}}
+	comps := []CheckinComponent{
+		{Id: "log-default", Type: "filestream", Status: "HEALTHY", Units: []CheckinUnit{
+			{Id: "log-default-a", Type: "input", Status: "FAILED", Payload: json.RawMessage(`{"error":{"message":"no such file"}}`)},
+		}},
+		{Id: "system-default", Type: "system/metrics", Status: "HEALTHY"},
+		{Id: "endpoint-default", Type: "endpoint", Status: "DEGRADED"},
+		{Id: "log-other", Type: "filestream", Status: "HEALTHY"},
+	}
+
+	_, docs := componentsInventory(agent, comps, "2021-01-01T00:00:00Z")
+	summary := componentsSummary(docs)
+	assert.Equal(t, Fields{
+		"total":                4,
+		"unhealthy":            2,
+		"types":                []string{"endpoint", "filestream", "system/metrics"},
+		"unhealthy_components": []string{"endpoint-default", "log-default"},
+	}, summary)
+
+	// Sorted the same whatever the reported order, payloads kept
+	sorted := sortComponents([]CheckinComponent{comps[3], comps[2], comps[1], comps[0]})
+	assert.Equal(t, sortComponents(comps), sorted)
+	assert.Equal(t, "log-default", sorted[1].Id)
+	assert.JSONEq(t, `{"error":{"message":"no such file"}}`, string(sorted[1].Units[0].Payload))
+}
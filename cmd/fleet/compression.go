@@ -0,0 +1,216 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"compress/flate"
+	"context"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// kSizeBuckets bounds the power of two buckets of the response sizes.
+const kSizeBuckets = 32
+
+// compressionTuner holds the gzip level and threshold of the checkin
+// responses; with adaptive compression they follow the CPU headroom.
+type compressionTuner struct {
+	cfg     *config.AdaptiveCompression
+	cpuTime func() (time.Duration, error)
+	now     func() time.Time
+
+	level     int32 // atomic
+	threshold int64 // atomic
+
+	// sizes counts the responses of the interval by the power of two of
+	// their size.
+	sizes [kSizeBuckets]uint64 // atomic
+
+	mut     sync.Mutex
+	lastCPU time.Duration
+	lastAt  time.Time
+	cpu     float64
+	lowered uint64
+	raised  uint64
+}
+
+type compressionStats struct {
+	Level     int
+	Threshold int
+	CPU       float64 // fraction of the CPUs the process used in the last interval
+	Lowered   uint64  // decisions lowering the compression effort
+	Raised    uint64  // decisions raising the compression effort
+}
+
+func newCompressionTuner(cfg *config.Server) *compressionTuner {
+	t := &compressionTuner{
+		cfg:       &cfg.AdaptiveCompression,
+		cpuTime:   processCPUTime,
+		now:       time.Now,
+		level:     int32(cfg.CompressionLevel),
+		threshold: int64(cfg.CompressionThresh),
+	}
+	if t.adaptive() {
+		t.level = int32(clampInt(int(t.level), t.cfg.MinLevel, t.cfg.MaxLevel))
+		t.threshold = int64(clampInt(int(t.threshold), t.cfg.MinThreshold, t.cfg.MaxThreshold))
+	}
+	return t
+}
+
+// adaptive tells whether the settings are tuned; compression disabled stays so.
+func (t *compressionTuner) adaptive() bool {
+	return t.cfg.Enabled && t.level != flate.NoCompression
+}
+
+// settings returns the gzip level and the size above which a response is
+// compressed.
+func (t *compressionTuner) settings() (int, int) {
+	return int(atomic.LoadInt32(&t.level)), int(atomic.LoadInt64(&t.threshold))
+}
+
+// observe records the size of a response.
+func (t *compressionTuner) observe(n int) {
+	b := bits.Len(uint(n))
+	if b >= kSizeBuckets {
+		b = kSizeBuckets - 1
+	}
+	atomic.AddUint64(&t.sizes[b], 1)
+}
+
+// Run tunes the settings every interval until ctx is done.
+func (t *compressionTuner) Run(ctx context.Context) error {
+	if !t.adaptive() {
+		return nil
+	}
+
+	t.mut.Lock()
+	t.lastCPU, _ = t.cpuTime()
+	t.lastAt = t.now()
+	t.mut.Unlock()
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := t.tune(); err != nil {
+				log.Warn().Err(err).Msg("Fail reading the CPU time; compression not tuned")
+			}
+		}
+	}
+}
+
+// tune measures the CPU used since the last interval and adjusts the
+// settings to it.
+func (t *compressionTuner) tune() error {
+	cpuTime, err := t.cpuTime()
+	if err != nil {
+		return err
+	}
+	now := t.now()
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	wall := now.Sub(t.lastAt)
+	if wall <= 0 {
+		return nil
+	}
+	t.cpu = float64(cpuTime-t.lastCPU) / float64(wall) / float64(runtime.GOMAXPROCS(0))
+	t.lastCPU, t.lastAt = cpuTime, now
+
+	median := t.medianSize()
+	level, threshold := t.settings()
+	newLevel, newThreshold := level, threshold
+	switch {
+	case t.cpu >= t.cfg.HighCPU:
+		newLevel = level - 1
+		if newThreshold = threshold * 2; median > newThreshold {
+			newThreshold = median
+		}
+	case t.cpu <= t.cfg.LowCPU:
+		newLevel = level + 1
+		newThreshold = threshold / 2
+	}
+	newLevel = clampInt(newLevel, t.cfg.MinLevel, t.cfg.MaxLevel)
+	newThreshold = clampInt(newThreshold, t.cfg.MinThreshold, t.cfg.MaxThreshold)
+	if newLevel == level && newThreshold == threshold {
+		return nil
+	}
+
+	if newLevel < level || newThreshold > threshold {
+		t.lowered++
+	} else {
+		t.raised++
+	}
+	atomic.StoreInt32(&t.level, int32(newLevel))
+	atomic.StoreInt64(&t.threshold, int64(newThreshold))
+	log.Debug().
+		Float64("cpu", t.cpu).
+		Int("medianSize", median).
+		Int("level", newLevel).
+		Int("threshold", newThreshold).
+		Msg("Compression of the checkin responses tuned")
+	return nil
+}
+
+// medianSize returns the upper bound of the bucket holding the median size of
+// the responses of the interval, and starts a new interval; 0 without
+// responses.
+//
+// WARNING: Assumes the mutex is held
+func (t *compressionTuner) medianSize() int {
+	var counts [kSizeBuckets]uint64
+	var total uint64
+	for i := range t.sizes {
+		counts[i] = atomic.SwapUint64(&t.sizes[i], 0)
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	var seen uint64
+	for i, n := range counts {
+		if seen += n; seen*2 >= total {
+			return 1 << uint(i)
+		}
+	}
+	return 0
+}
+
+func (t *compressionTuner) stats() compressionStats {
+	level, threshold := t.settings()
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	return compressionStats{
+		Level:     level,
+		Threshold: threshold,
+		CPU:       t.cpu,
+		Lowered:   t.lowered,
+		Raised:    t.raised,
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
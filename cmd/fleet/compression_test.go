@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionTuner(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.AdaptiveCompression.Enabled = true
+	cfg.AdaptiveCompression.MaxLevel = 3
+	cfg.AdaptiveCompression.MaxThreshold = 16 * 1024
+
+	now := time.Now()
+	var cpu time.Duration
+	tuner := newCompressionTuner(cfg)
+	tuner.now = func() time.Time { return now }
+	tuner.cpuTime = func() (time.Duration, error) { return cpu, nil }
+	tuner.lastAt = now
+
+	// busy runs the interval with the fraction of the CPUs busy
+	busy := func(fraction float64) {
+		now = now.Add(10 * time.Second)
+		cpu += time.Duration(fraction * float64(10*time.Second) * float64(runtime.GOMAXPROCS(0)))
+		require.NoError(t, tuner.tune())
+	}
+	settings := func(level, threshold int) {
+		t.Helper()
+		l, th := tuner.settings()
+		assert.Equal(t, level, l, "level")
+		assert.Equal(t, threshold, th, "threshold")
+	}
+
+	settings(1, 1024)
+
+	// Idle: more effort, up to the bounds
+	busy(0.1)
+	settings(2, 1024)
+	busy(0.1)
+	busy(0.1)
+	settings(3, 1024)
+
+	// Under pressure the threshold moves to the median size
+	for i := 0; i < 10; i++ {
+		tuner.observe(100)
+		tuner.observe(5000)
+		tuner.observe(6000)
+	}
+	busy(0.9)
+	settings(2, 8192)
+	busy(0.9)
+	settings(1, 16*1024)
+	busy(0.9)
+	settings(1, 16*1024)
+
+	// Headroom in between keeps the settings
+	busy(0.6)
+	settings(1, 16*1024)
+
+	stats := tuner.stats()
+	assert.Equal(t, uint64(2), stats.Raised)
+	assert.Equal(t, uint64(2), stats.Lowered)
+	assert.InDelta(t, 0.6, stats.CPU, 0.01)
+}
+
+func TestCompressionTunerDisabled(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.AdaptiveCompression.Enabled = true
+	cfg.CompressionLevel = 0
+
+	tuner := newCompressionTuner(cfg)
+	assert.False(t, tuner.adaptive())
+	level, _ := tuner.settings()
+	assert.Equal(t, 0, level)
+}
@@ -0,0 +1,504 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/preflight"
+	"github.com/elastic/fleet-server/v7/internal/pkg/status"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	kConnectivityPolicyId = "policy-id"
+	kConnectivityTimeout  = "timeout"
+
+	kConnectivityName = "fleet-server-connectivity-check"
+
+	// The checkin of the synthetic agent returns after this long when its
+	// policy has no change to deliver.
+	kConnectivityLongPoll = 5 * time.Second
+
+	// The enrollment API key expires by itself if the check is killed before
+	// it cleans up.
+	kConnectivityKeyTTL = "1h"
+
+	kConnectivityCleanupTimeout = 30 * time.Second
+
+	kConnectivityEnrollRolesJSON = `{"fleet-apikey-enroll":{"cluster":[],"applications":[{"application":"fleet","privileges":["no-privileges"],"resources":["*"]}]}}`
+)
+
+const (
+	kStepElasticsearch = "elasticsearch"
+	kStepPreflight     = "preflight"
+	kStepRoundTrip     = "elasticsearch round trip"
+	kStepListener      = "listener"
+	kStepEnroll        = "enroll"
+	kStepCheckin       = "checkin"
+	kStepCleanup       = "cleanup"
+)
+
+var ErrConnectivityFailed = errors.New("connectivity checks failed")
+
+func newCheckCommand(version string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check a Fleet Server configuration before rolling it out",
+	}
+
+	connectivity := &cobra.Command{
+		Use:   "connectivity",
+		Short: "Run Fleet Server on an ephemeral port, enroll and check in a synthetic agent through it, print the results and exit",
+		Args:  cobra.NoArgs,
+		RunE:  getConnectivityCommand(version),
+	}
+	connectivity.Flags().String(kConnectivityPolicyId, "", "Policy to enroll the synthetic agent into; defaults to the first policy found")
+	connectivity.Flags().Duration(kConnectivityTimeout, time.Minute, "Time allowed for the checks")
+	cmd.AddCommand(connectivity)
+
+	return cmd
+}
+
+func getConnectivityCommand(version string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadStandaloneConfig(cmd)
+		if err != nil {
+			return err
+		}
+		policyId, err := cmd.Flags().GetString(kConnectivityPolicyId)
+		if err != nil {
+			return err
+		}
+		timeout, err := cmd.Flags().GetDuration(kConnectivityTimeout)
+		if err != nil {
+			return err
+		}
+
+		l, err := logger.Init(cfg)
+		if err != nil {
+			return err
+		}
+		if err := initIndices(&cfg.Inputs[0].Server.Indices); err != nil {
+			return err
+		}
+
+		err = runConnectivityCheck(installSignalHandler(), cfg, version, policyId, timeout, os.Stdout)
+		l.Sync()
+		return err
+	}
+}
+
+// runConnectivityCheck runs the connectivity checks and prints their results
+// as a table; it fails if any check failed.
+func runConnectivityCheck(ctx context.Context, cfg *config.Config, version, policyId string, timeout time.Duration, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c := &connectivityCheck{
+		cfg:      cfg,
+		version:  version,
+		policyId: policyId,
+	}
+	c.run(ctx)
+
+	if err := preflight.Print(w, c.results); err != nil {
+		return err
+	}
+	if failed := preflight.Failed(c.results); len(failed) != 0 {
+		return fmt.Errorf("%w: %s", ErrConnectivityFailed, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// connectivityCheck runs Fleet Server with the configuration on an ephemeral
+// port and drives a synthetic agent through it with a temporary enrollment
+// key, exercising the TLS, authentication and Elasticsearch paths an agent
+// takes. Every step depends on the previous ones; once a step fails the
+// following are reported as skipped.
+type connectivityCheck struct {
+	cfg      *config.Config
+	version  string
+	policyId string
+	results  []preflight.Result
+
+	bulker  bulk.Bulk
+	client  *http.Client
+	baseURL string
+	stop    func()
+
+	enrollKey   *apikey.ApiKey
+	enrollDocId string
+	agentId     string
+	accessKey   string
+}
+
+func (c *connectivityCheck) run(ctx context.Context) {
+	// Bulker is run in its own context so the cleanup can still write once
+	// ctx expired.
+	bulkCtx, bulkCancel := context.WithCancel(context.Background())
+	defer bulkCancel()
+
+	steps := []struct {
+		name string
+		run  func(context.Context) (preflight.Status, string)
+	}{
+		{kStepRoundTrip, c.roundTrip},
+		{kStepListener, c.listen},
+		{kStepEnroll, c.enroll},
+		{kStepCheckin, c.checkin},
+	}
+
+	var failed string
+	esCli, bulker, err := bulk.InitES(bulkCtx, c.cfg)
+	if err != nil {
+		c.add(kStepElasticsearch, preflight.StatusFail, err.Error())
+		failed = kStepElasticsearch
+	} else {
+		c.bulker = bulker
+		results, err := runPreflight(ctx, c.cfg, esCli, c.version)
+		c.results = append(c.results, results...)
+		if err != nil {
+			failed = kStepPreflight
+		}
+	}
+
+	for _, step := range steps {
+		if failed != "" {
+			c.add(step.name, preflight.StatusWarn, fmt.Sprintf("skipped, %s failed", failed))
+			continue
+		}
+		status, msg := step.run(ctx)
+		c.add(step.name, status, msg)
+		if status == preflight.StatusFail {
+			failed = step.name
+		}
+	}
+
+	if c.stop != nil {
+		c.stop()
+	}
+	if c.bulker != nil {
+		status, msg := c.cleanup()
+		c.add(kStepCleanup, status, msg)
+	}
+}
+
+func (c *connectivityCheck) add(name string, status preflight.Status, msg string) {
+	c.results = append(c.results, preflight.Result{
+		Name:    name,
+		Status:  status,
+		Message: msg,
+	})
+}
+
+// roundTrip writes the temporary enrollment key record and reads it back.
+func (c *connectivityCheck) roundTrip(ctx context.Context) (preflight.Status, string) {
+	start := time.Now()
+
+	policy, err := c.findPolicy(ctx)
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+
+	meta := apikey.Metadata{
+		Managed:    true,
+		ManagedBy:  apikey.ManagedByFleetServer,
+		Type:       "enroll",
+		Namespaces: policy.Namespaces,
+	}
+	key, err := apikey.Create(ctx, c.bulker.Client(), kConnectivityName, kConnectivityKeyTTL, []byte(kConnectivityEnrollRolesJSON), meta)
+	if err != nil {
+		return preflight.StatusFail, fmt.Sprintf("fail to create the enrollment API key: %v", err)
+	}
+	c.enrollKey = key
+
+	rec := model.EnrollmentApiKey{
+		Active:     true,
+		ApiKey:     key.Key,
+		ApiKeyId:   key.Id,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		Name:       kConnectivityName,
+		Namespaces: policy.Namespaces,
+		PolicyId:   policy.PolicyId,
+	}
+	body, err := json.Marshal(&rec)
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+	id, err := c.bulker.Create(ctx, dl.FleetEnrollmentAPIKeys, "", body, bulk.WithRefresh())
+	if err != nil {
+		return preflight.StatusFail, fmt.Sprintf("fail to write %s: %v", dl.FleetEnrollmentAPIKeys, err)
+	}
+	c.enrollDocId = id
+
+	data, err := c.bulker.Read(ctx, dl.FleetEnrollmentAPIKeys, id)
+	if err != nil {
+		return preflight.StatusFail, fmt.Sprintf("fail to read back %s: %v", dl.FleetEnrollmentAPIKeys, err)
+	}
+	var got model.EnrollmentApiKey
+	if err := json.Unmarshal(data, &got); err != nil || got.ApiKeyId != key.Id {
+		return preflight.StatusFail, fmt.Sprintf("%s did not read back what was written", dl.FleetEnrollmentAPIKeys)
+	}
+
+	return preflight.StatusPass, fmt.Sprintf("wrote and read back an enrollment key for policy %s in %s", policy.PolicyId, time.Since(start).Round(time.Millisecond))
+}
+
+// findPolicy returns the policy to enroll into, the first one unless set.
+func (c *connectivityCheck) findPolicy(ctx context.Context) (model.Policy, error) {
+	policies, err := dl.QueryLatestPolicies(ctx, c.bulker)
+	if err != nil {
+		return model.Policy{}, fmt.Errorf("fail to read the policies: %w", err)
+	}
+	for _, p := range policies {
+		if c.policyId == "" || p.PolicyId == c.policyId {
+			return p, nil
+		}
+	}
+	if c.policyId != "" {
+		return model.Policy{}, fmt.Errorf("policy %s not found", c.policyId)
+	}
+	return model.Policy{}, fmt.Errorf("no policy to enroll into; create one first")
+}
+
+// listen runs the server on an ephemeral port and waits for it to answer.
+func (c *connectivityCheck) listen(ctx context.Context) (preflight.Status, string) {
+	cfg := *c.cfg
+	cfg.Inputs = append([]config.Input(nil), c.cfg.Inputs...)
+	cfg.HTTP.Enabled = false
+	srvCfg := &cfg.Inputs[0].Server
+	srvCfg.Timeouts.CheckinLongPoll = kConnectivityLongPoll
+
+	port, err := freePort(srvCfg.Host)
+	if err != nil {
+		return preflight.StatusFail, fmt.Sprintf("fail to find a free port on %s: %v", srvCfg.Host, err)
+	}
+	srvCfg.Port = port
+
+	cache, err := makeCache(&cfg)
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+	srv, err := NewFleetServer(&cfg, cache, c.version, status.NewLog())
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+
+	srvCtx, srvCancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var runErr error
+	go func() {
+		defer close(done)
+		runErr = srv.runServer(srvCtx, &cfg)
+	}()
+	c.stop = func() {
+		srvCancel()
+		<-done
+	}
+
+	scheme := "http"
+	transport := &http.Transport{}
+	if tcfg := srvCfg.TLS; tcfg != nil && tcfg.IsEnabled() {
+		scheme = "https"
+		// The loopback address is rarely one the server certificate names;
+		// the certificate itself is inspected by the preflight checks.
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.client = &http.Client{Transport: transport}
+	c.baseURL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(loopbackHost(srvCfg.Host), strconv.Itoa(int(port))))
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var resp StatusResponse
+		err := c.do(ctx, http.MethodGet, ROUTE_STATUS, "", nil, &resp)
+		if err == nil || errors.Is(err, errUnexpectedStatus) {
+			return preflight.StatusPass, fmt.Sprintf("%s answered, status %s", c.baseURL, resp.Status)
+		}
+
+		select {
+		case <-done:
+			return preflight.StatusFail, fmt.Sprintf("server exited: %v", runErr)
+		case <-ctx.Done():
+			return preflight.StatusFail, fmt.Sprintf("%s did not answer: %v", c.baseURL, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// enroll enrolls the synthetic agent with the temporary enrollment key.
+func (c *connectivityCheck) enroll(ctx context.Context) (preflight.Status, string) {
+	local, err := json.Marshal(map[string]interface{}{
+		"elastic": map[string]interface{}{
+			"agent": map[string]interface{}{
+				"version":  c.version,
+				"snapshot": false,
+			},
+		},
+		"host": map[string]interface{}{
+			"hostname": kConnectivityName,
+		},
+	})
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+	body, err := json.Marshal(&EnrollRequest{
+		Type: "EPHEMERAL",
+		Meta: EnrollMetadata{
+			Local: local,
+			User:  json.RawMessage("{}"),
+		},
+	})
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+
+	var resp EnrollResponse
+	if err := c.do(ctx, http.MethodPost, "/api/fleet/agents/enroll", c.enrollKey.Token(), body, &resp); err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+	c.agentId = resp.Item.ID
+	c.accessKey = resp.Item.AccessAPIKey
+
+	return preflight.StatusPass, fmt.Sprintf("enrolled agent %s into policy %s", resp.Item.ID, resp.Item.PolicyId)
+}
+
+// checkin checks the synthetic agent in with its access API key.
+func (c *connectivityCheck) checkin(ctx context.Context) (preflight.Status, string) {
+	start := time.Now()
+
+	body, err := json.Marshal(&CheckinRequest{Events: []Event{}})
+	if err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+
+	var resp CheckinResponse
+	if err := c.do(ctx, http.MethodPost, "/api/fleet/agents/"+c.agentId+"/checkin", c.accessKey, body, &resp); err != nil {
+		return preflight.StatusFail, err.Error()
+	}
+
+	return preflight.StatusPass, fmt.Sprintf("checked in, %d actions, in %s", len(resp.Actions), time.Since(start).Round(time.Millisecond))
+}
+
+// cleanup deletes the synthetic agent and the enrollment key record, and
+// invalidates their API keys.
+func (c *connectivityCheck) cleanup() (preflight.Status, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), kConnectivityCleanupTimeout)
+	defer cancel()
+
+	var keys, left []string
+	if c.agentId != "" {
+		agent, err := dl.FindAgent(ctx, c.bulker, dl.QueryAgentByID, dl.FieldId, c.agentId)
+		if err == nil {
+			keys = append(keys, _getAPIKeyIDs(&agent)...)
+		} else {
+			log.Warn().Err(err).Str("agentId", c.agentId).Msg("Fail to read the synthetic agent")
+			left = append(left, "API keys of agent "+c.agentId)
+		}
+		if err := dl.DeleteDocument(ctx, c.bulker, dl.FleetAgents, c.agentId); err != nil {
+			log.Warn().Err(err).Str("agentId", c.agentId).Msg("Fail to delete the synthetic agent")
+			left = append(left, "agent "+c.agentId)
+		}
+	}
+	if c.enrollDocId != "" {
+		if err := dl.DeleteDocument(ctx, c.bulker, dl.FleetEnrollmentAPIKeys, c.enrollDocId); err != nil {
+			log.Warn().Err(err).Str("id", c.enrollDocId).Msg("Fail to delete the enrollment key record")
+			left = append(left, "enrollment key record "+c.enrollDocId)
+		}
+	}
+	if c.enrollKey != nil {
+		keys = append(keys, c.enrollKey.Id)
+	}
+	if len(keys) != 0 {
+		if err := apikey.Invalidate(ctx, c.bulker.Client(), keys...); err != nil {
+			log.Warn().Err(err).Strs("ids", keys).Msg("Fail to invalidate the API keys")
+			left = append(left, "API keys "+strings.Join(keys, ", "))
+		}
+	}
+
+	if len(left) != 0 {
+		return preflight.StatusWarn, "left behind " + strings.Join(left, "; ")
+	}
+	if c.agentId == "" && c.enrollDocId == "" && len(keys) == 0 {
+		return preflight.StatusPass, "nothing to clean up"
+	}
+	return preflight.StatusPass, fmt.Sprintf("deleted the synthetic agent and invalidated %d API keys", len(keys))
+}
+
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// do sends the request to the server, authenticated with the API key token
+// unless empty, and decodes the response into out.
+func (c *connectivityCheck) do(ctx context.Context, method, path, token string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Elastic Agent v"+c.version)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set(apikey.AuthKey, "ApiKey "+token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		// The status route answers with its status on errors too
+		_ = json.Unmarshal(data, out)
+		return fmt.Errorf("%w %d from %s %s: %s", errUnexpectedStatus, res.StatusCode, method, path, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// freePort returns a port free on the host.
+func freePort(host string) (uint16, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(strings.Trim(host, "[]"), "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+// loopbackHost returns the address to reach a server bound to host from the
+// same machine.
+func loopbackHost(host string) string {
+	switch host {
+	case "", "0.0.0.0":
+		return "127.0.0.1"
+	case "::", "[::]":
+		return "::1"
+	}
+	return strings.Trim(host, "[]")
+}
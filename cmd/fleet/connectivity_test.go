@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConnectivityCommand(t *testing.T) {
+	cmd, args, err := NewCommand("8.0.0").Find([]string{"check", "connectivity"})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Equal(t, "connectivity", cmd.Name())
+	assert.NotNil(t, cmd.Flags().Lookup(kConnectivityPolicyId))
+	assert.NotNil(t, cmd.InheritedFlags().Lookup("config"))
+}
+
+func TestConnectivityCheckDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Elastic Agent v8.0.0", r.Header.Get("User-Agent"))
+		if r.Header.Get("Authorization") != "ApiKey token" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(`{"name":"fleet-server","status":"STARTING"}`))
+	}))
+	defer srv.Close()
+
+	c := &connectivityCheck{version: "8.0.0", client: srv.Client(), baseURL: srv.URL}
+
+	var resp StatusResponse
+	require.NoError(t, c.do(context.Background(), http.MethodGet, ROUTE_STATUS, "token", nil, &resp))
+	assert.Equal(t, "STARTING", resp.Status)
+
+	resp = StatusResponse{}
+	err := c.do(context.Background(), http.MethodGet, ROUTE_STATUS, "", nil, &resp)
+	assert.True(t, errors.Is(err, errUnexpectedStatus), err)
+	assert.Contains(t, err.Error(), "503")
+	assert.Equal(t, "STARTING", resp.Status, "the status route answers with its status on errors")
+}
+
+func TestLoopbackHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"", "127.0.0.1"},
+		{"0.0.0.0", "127.0.0.1"},
+		{"::", "::1"},
+		{"[::]", "::1"},
+		{"localhost", "localhost"},
+		{"[fe80::1]", "fe80::1"},
+		{"10.1.2.3", "10.1.2.3"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, loopbackHost(tc.host), tc.host)
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
+
+	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/julienschmidt/httprouter"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrCaptureTTL      = errors.New("ttl exceeds the max_ttl of the debug capture")
+	ErrCaptureTooMany  = errors.New("already capturing the max_agents of the debug capture")
+	ErrCaptureNotFound = errors.New("agent is not captured")
+)
+
+// redactedHeaders are the request headers whose values are never captured.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// debugCapture logs the requests and responses of the agents captured through
+// the admin API to a file of its own, whatever the log level. The file is
+// opened with the first capture.
+type debugCapture struct {
+	cfg  *config.DebugCapture
+	path string
+	now  func() time.Time
+	open func() (io.WriteCloser, error)
+
+	mut    sync.Mutex
+	agents map[string]time.Time // expiry by agent id
+	out    io.WriteCloser
+	log    zerolog.Logger
+}
+
+// newDebugCapture returns the capture writing to the path of the
+// configuration, else to logPath.
+func newDebugCapture(cfg *config.DebugCapture, logPath string) *debugCapture {
+	path := cfg.Path
+	if path == "" {
+		path = logPath
+	}
+	dc := &debugCapture{
+		cfg:    cfg,
+		path:   filepath.Join(path, cfg.Name),
+		now:    time.Now,
+		agents: make(map[string]time.Time),
+	}
+	dc.open = dc.openFile
+	return dc
+}
+
+func (dc *debugCapture) openFile() (io.WriteCloser, error) {
+	return file.NewFileRotator(dc.path,
+		file.MaxSizeBytes(dc.cfg.MaxSize),
+		file.MaxBackups(dc.cfg.MaxBackups),
+		file.Permissions(os.FileMode(0600)),
+	)
+}
+
+// enable captures the agent for ttl, 0 being the default; enabling it again
+// extends the capture.
+func (dc *debugCapture) enable(agentId string, ttl time.Duration) (time.Time, error) {
+	if ttl == 0 {
+		ttl = dc.cfg.DefaultTTL
+	}
+	if ttl < 0 || ttl > dc.cfg.MaxTTL {
+		return time.Time{}, ErrCaptureTTL
+	}
+
+	dc.mut.Lock()
+	defer dc.mut.Unlock()
+
+	dc.expire()
+	if _, ok := dc.agents[agentId]; !ok && dc.cfg.MaxAgents > 0 && len(dc.agents) >= dc.cfg.MaxAgents {
+		return time.Time{}, ErrCaptureTooMany
+	}
+	if dc.out == nil {
+		out, err := dc.open()
+		if err != nil {
+			return time.Time{}, err
+		}
+		dc.out = out
+		dc.log = zerolog.New(out).Level(zerolog.DebugLevel).With().Timestamp().Logger()
+	}
+
+	expiresAt := dc.now().Add(ttl)
+	dc.agents[agentId] = expiresAt
+	return expiresAt, nil
+}
+
+// disable stops capturing the agent; false when it was not captured.
+func (dc *debugCapture) disable(agentId string) bool {
+	dc.mut.Lock()
+	defer dc.mut.Unlock()
+
+	dc.expire()
+	_, ok := dc.agents[agentId]
+	delete(dc.agents, agentId)
+	return ok
+}
+
+// captured tells whether the requests of the agent are captured.
+func (dc *debugCapture) captured(agentId string) bool {
+	dc.mut.Lock()
+	defer dc.mut.Unlock()
+
+	expiresAt, ok := dc.agents[agentId]
+	if ok && !dc.now().Before(expiresAt) {
+		delete(dc.agents, agentId)
+		return false
+	}
+	return ok
+}
+
+// expire drops the captures past their expiry.
+//
+// WARNING: Assumes the mutex is held
+func (dc *debugCapture) expire() {
+	now := dc.now()
+	for id, expiresAt := range dc.agents {
+		if !now.Before(expiresAt) {
+			delete(dc.agents, id)
+		}
+	}
+}
+
+func (dc *debugCapture) close() {
+	dc.mut.Lock()
+	defer dc.mut.Unlock()
+
+	if dc.out != nil {
+		dc.out.Close()
+		dc.out = nil
+	}
+}
+
+// track captures the request to an agent endpoint when its agent is
+// captured; the returned func logs it once handled. The operator APIs and
+// the monitoring endpoints are never captured.
+func (dc *debugCapture) track(endpoint string, w http.ResponseWriter, r *http.Request, ps httprouter.Params) (http.ResponseWriter, *http.Request, func()) {
+	if dc == nil {
+		return w, r, func() {}
+	}
+	switch ipGroup(endpoint) {
+	case kIPGroupAdmin, kIPGroupMonitoring:
+		return w, r, func() {}
+	}
+	agentId := ps.ByName("id")
+	if agentId == "" || !dc.captured(agentId) {
+		return w, r, func() {}
+	}
+
+	start := dc.now()
+	reqBody := &captureBuffer{max: dc.cfg.MaxBodySize}
+	r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+	cw := &captureResponseWriter{ResponseWriter: w, body: captureBuffer{max: dc.cfg.MaxBodySize}}
+
+	return cw, r, func() {
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		dc.mut.Lock()
+		defer dc.mut.Unlock()
+
+		dc.log.Debug().
+			Str("agent.id", agentId).
+			Str("endpoint", endpoint).
+			Str("http.request.method", r.Method).
+			Str("url.path", r.URL.Path).
+			Str("url.query", r.URL.RawQuery).
+			Str("source.address", remoteIP(r)).
+			Interface("http.request.headers", redactHeaders(r.Header)).
+			RawJSON("http.request.body", captureBody(reqBody, r.Header.Get("Content-Encoding"))).
+			Int("http.response.status_code", status).
+			RawJSON("http.response.body", captureBody(&cw.body, cw.Header().Get("Content-Encoding"))).
+			Dur("event.duration", dc.now().Sub(start)).
+			Msg("Debug capture")
+	}
+}
+
+// captureBuffer keeps up to max bytes of what is written to it.
+type captureBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type captureResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   captureBuffer
+}
+
+func (c *captureResponseWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureResponseWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush lets the handlers streaming their response flush it.
+func (c *captureResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// captureBody returns the body captured as JSON, decompressed and redacted.
+// Truncated bodies, and those that are not JSON, are described rather than
+// logged as they may hold anything.
+func captureBody(b *captureBuffer, encoding string) json.RawMessage {
+	if b.Len() == 0 && !b.truncated {
+		return json.RawMessage(`null`)
+	}
+	describe := func(reason string) json.RawMessage {
+		data, _ := json.Marshal(map[string]interface{}{"omitted": reason, "size": b.Len()})
+		return data
+	}
+	if b.truncated {
+		return describe("truncated at max_body_size")
+	}
+
+	data, err := decodeCaptured(b.Bytes(), encoding)
+	if err != nil {
+		return describe("cannot be decoded")
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return describe("not JSON")
+	}
+	redacted, err := json.Marshal(redact.Default.Value(v))
+	if err != nil {
+		return describe("cannot be encoded")
+	}
+	return redacted
+}
+
+func decodeCaptured(data []byte, encoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return data, nil
+	case kEncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	case kEncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, v := range h {
+		if redactedHeaders[k] {
+			headers[k] = redact.Redacted
+			continue
+		}
+		headers[k] = strings.Join(v, ", ")
+	}
+	return headers
+}
+
+// logFilesPath returns the directory of the log files.
+func logFilesPath(cfg *config.Config) string {
+	if cfg.Logging.Files != nil && cfg.Logging.Files.Path != "" {
+		return cfg.Logging.Files.Path
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Warn().Err(err).Msg("Fail to get the working directory")
+	}
+	return cwd
+}
@@ -0,0 +1,147 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func newTestDebugCapture(t *testing.T, out io.Writer) (*debugCapture, *time.Time) {
+	t.Helper()
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.DebugCapture.MaxAgents = 2
+	cfg.DebugCapture.MaxBodySize = 1024
+
+	now := time.Now()
+	dc := newDebugCapture(&cfg.DebugCapture, t.TempDir())
+	dc.now = func() time.Time { return now }
+	dc.open = func() (io.WriteCloser, error) { return nopWriteCloser{out}, nil }
+	return dc, &now
+}
+
+func TestDebugCaptureEnable(t *testing.T) {
+	dc, now := newTestDebugCapture(t, ioutil.Discard)
+
+	expiresAt, err := dc.enable("agent-1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), expiresAt)
+	_, err = dc.enable("agent-2", time.Hour)
+	require.NoError(t, err)
+
+	_, err = dc.enable("agent-3", time.Minute)
+	assert.True(t, errors.Is(err, ErrCaptureTooMany))
+	_, err = dc.enable("agent-1", 5*time.Hour)
+	assert.True(t, errors.Is(err, ErrCaptureTTL))
+
+	// Expired captures make room
+	*now = now.Add(20 * time.Minute)
+	assert.False(t, dc.captured("agent-1"))
+	assert.True(t, dc.captured("agent-2"))
+	_, err = dc.enable("agent-3", time.Minute)
+	require.NoError(t, err)
+
+	assert.True(t, dc.disable("agent-3"))
+	assert.False(t, dc.disable("agent-3"))
+	assert.False(t, dc.captured("agent-3"))
+}
+
+func TestDebugCaptureTrack(t *testing.T) {
+	var out bytes.Buffer
+	dc, _ := newTestDebugCapture(t, &out)
+	_, err := dc.enable("agent-1", 0)
+	require.NoError(t, err)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "secret-key")
+
+		w.Header().Set("Content-Encoding", kEncodingGzip)
+		w.WriteHeader(http.StatusOK)
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(`{"action":"checkin","actions":[{"data":{"ssl":{"key":"private"},"hosts":["es:9200"]}}]}`))
+		zw.Close()
+	}
+
+	serve := func(endpoint, agentId string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/fleet/agents/"+agentId+"/checkin", strings.NewReader(`{"status":"online","access_api_key":"secret-key"}`))
+		req.Header.Set("Authorization", "ApiKey secret")
+		ps := httprouter.Params{{Key: "id", Value: agentId}}
+		w, r, done := dc.track(endpoint, httptest.NewRecorder(), req, ps)
+		handler(w, r)
+		done()
+	}
+
+	serve("checkin", "agent-2")
+	serve("quarantine_agent", "agent-1")
+	assert.Zero(t, out.Len(), "captured another agent or an operator API")
+
+	serve("checkin", "agent-1")
+	assert.NotContains(t, out.String(), "secret")
+	assert.NotContains(t, out.String(), "private")
+
+	var entry struct {
+		AgentId  string            `json:"agent.id"`
+		Status   int               `json:"http.response.status_code"`
+		Headers  map[string]string `json:"http.request.headers"`
+		Request  map[string]interface{}
+		Response map[string]interface{}
+	}
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &raw))
+	require.NoError(t, json.Unmarshal(raw["http.request.body"], &entry.Request))
+	require.NoError(t, json.Unmarshal(raw["http.response.body"], &entry.Response))
+
+	assert.Equal(t, "agent-1", entry.AgentId)
+	assert.Equal(t, http.StatusOK, entry.Status)
+	assert.Equal(t, redact.Redacted, entry.Headers["Authorization"])
+	assert.Equal(t, "online", entry.Request["status"])
+	assert.Equal(t, redact.Redacted, entry.Request["access_api_key"])
+	assert.Equal(t, "checkin", entry.Response["action"])
+	assert.Contains(t, string(raw["http.response.body"]), `"hosts":["es:9200"]`)
+}
+
+func TestCaptureBody(t *testing.T) {
+	b := &captureBuffer{max: 8}
+	b.Write([]byte(`{"a":1}`))
+	assert.JSONEq(t, `{"a":1}`, string(captureBody(b, "")))
+
+	b.Write([]byte(`{"b":2}`))
+	assert.JSONEq(t, `{"omitted":"truncated at max_body_size","size":8}`, string(captureBody(b, "")))
+
+	b = &captureBuffer{max: 8}
+	b.Write([]byte("binary"))
+	assert.JSONEq(t, `{"omitted":"not JSON","size":6}`, string(captureBody(b, "")))
+	assert.JSONEq(t, `{"omitted":"cannot be decoded","size":6}`, string(captureBody(b, kEncodingGzip)))
+
+	assert.Equal(t, "null", string(captureBody(&captureBuffer{}, "")))
+}
@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// degradedT tracks whether the Elasticsearch reads of the checkins fail. While
+// they do, checkins are answered from the last known agent records, policies
+// and actions, flagged as degraded, for as long as the last successful read is
+// no older than the max staleness; past it they fail as unavailable.
+type degradedT struct {
+	maxStaleness time.Duration
+	now          func() time.Time
+
+	mut    sync.Mutex
+	lastOK time.Time
+	since  time.Time // zero when not degraded
+}
+
+func newDegraded(maxStaleness time.Duration) *degradedT {
+	return &degradedT{
+		maxStaleness: maxStaleness,
+		now:          time.Now,
+		lastOK:       time.Now(),
+	}
+}
+
+// ok records a successful read; it ends the degraded mode.
+func (d *degradedT) ok() {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	d.lastOK = d.now()
+	if !d.since.IsZero() {
+		log.Info().
+			Dur("duration", d.lastOK.Sub(d.since)).
+			Msg("Elasticsearch available; leave degraded mode")
+		d.since = time.Time{}
+		cntDegraded.Set(0)
+	}
+}
+
+// fail records a read that failed because Elasticsearch is unavailable and
+// returns whether the checkin may be served from cached state.
+func (d *degradedT) fail(err error) bool {
+	if d.maxStaleness <= 0 {
+		return false
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	now := d.now()
+	if now.Sub(d.lastOK) > d.maxStaleness {
+		return false
+	}
+	if d.since.IsZero() {
+		d.since = now
+		cntDegraded.Set(1)
+		log.Warn().
+			Err(err).
+			Time("last_ok", d.lastOK).
+			Dur("max_staleness", d.maxStaleness).
+			Msg("Elasticsearch unavailable; enter degraded mode serving cached policies and actions")
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDegradedMaxStaleness(t *testing.T) {
+	now := time.Now()
+	d := newDegraded(time.Minute)
+	d.now = func() time.Time { return now }
+	d.ok()
+
+	errUnavailable := errors.New("connection refused")
+
+	now = now.Add(30 * time.Second)
+	assert.True(t, d.fail(errUnavailable))
+	assert.False(t, d.since.IsZero())
+
+	now = now.Add(time.Minute)
+	assert.False(t, d.fail(errUnavailable), "cached state older than max staleness")
+
+	d.ok()
+	assert.True(t, d.since.IsZero())
+	assert.True(t, d.fail(errUnavailable))
+}
+
+func TestDegradedDisabled(t *testing.T) {
+	d := newDegraded(0)
+	assert.False(t, d.fail(errors.New("connection refused")))
+}
@@ -0,0 +1,265 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// kDeletedPolicyBatchSize is the number of agents updated per request.
+	kDeletedPolicyBatchSize = 1000
+
+	// Checks a policy must be missing on before it is taken as deleted; a
+	// policy just created may not be searchable yet.
+	kDeletedPolicyChecks = 2
+
+	// The latest policies query returns up to this many policies; beyond it
+	// a policy missing from the results may still exist.
+	kDeletedPolicyMaxChecked = 10000
+)
+
+// deletedPolicyFunc handles the agents of a deleted policy.
+type deletedPolicyFunc func(ctx context.Context, policyId string) error
+
+// deletedPolicyHandler returns the handler of the agents of deleted policies
+// selected by the configuration, or nil when they are left alone. The actions
+// sent to the orphaned agents expire as configured for their type, else never.
+func deletedPolicyHandler(cfg *config.DeletedPolicy, actions *config.Actions, bulker bulk.Bulk) deletedPolicyFunc {
+	expiration := actions.Expiration(TypePolicyDeleted, 0)
+	switch cfg.Action {
+	case config.DeletedPolicyReassign:
+		defaultPolicyId := cfg.DefaultPolicyID
+		return func(ctx context.Context, policyId string) error {
+			if policyId == defaultPolicyId {
+				// Nowhere left to reassign the agents to
+				return orphanAgents(ctx, bulker, policyId, expiration)
+			}
+			return reassignAgents(ctx, bulker, policyId, defaultPolicyId)
+		}
+	case config.DeletedPolicyOrphan:
+		return func(ctx context.Context, policyId string) error {
+			return orphanAgents(ctx, bulker, policyId, expiration)
+		}
+	}
+	return nil
+}
+
+// deletedPolicies finds the deleted policies the active agents are still
+// assigned to. It is run by a single Fleet Server, the leader of the task, as
+// the agents of a policy check in with every server.
+type deletedPolicies struct {
+	bulker  bulk.Bulk
+	handle  deletedPolicyFunc
+	missing map[string]int
+
+	policyF   func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]model.Policy, error)
+	assignedF func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]string, error)
+}
+
+func newDeletedPolicies(bulker bulk.Bulk, handle deletedPolicyFunc) *deletedPolicies {
+	return &deletedPolicies{
+		bulker:    bulker,
+		handle:    handle,
+		missing:   make(map[string]int),
+		policyF:   dl.QueryLatestPolicies,
+		assignedF: dl.QueryAgentPolicyIds,
+	}
+}
+
+// runDeletedPolicyCheck checks for deleted policies every interval until ctx
+// is done.
+func runDeletedPolicyCheck(ctx context.Context, bulker bulk.Bulk, interval time.Duration, handle deletedPolicyFunc) error {
+	dp := newDeletedPolicies(bulker, handle)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if err := dp.check(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Warn().Err(err).Msg("Fail to check for deleted policies")
+		}
+	}
+}
+
+// check counts the checks each policy assigned to active agents is missing
+// on, and handles the agents of the ones deleted. A policy failed to be
+// handled is handled again on the next check.
+func (dp *deletedPolicies) check(ctx context.Context) error {
+	policies, err := dp.policyF(ctx, dp.bulker)
+	if errors.Is(err, es.ErrIndexNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// An empty index is taken as not set up yet rather than every policy
+	// deleted; a truncated result cannot tell.
+	if len(policies) == 0 || len(policies) >= kDeletedPolicyMaxChecked {
+		return nil
+	}
+
+	exists := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		exists[p.PolicyId] = true
+	}
+
+	assigned, err := dp.assignedF(ctx, dp.bulker)
+	if errors.Is(err, es.ErrIndexNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var deleted []string
+	missing := make(map[string]int)
+	for _, policyId := range assigned {
+		if exists[policyId] {
+			continue
+		}
+		missing[policyId] = dp.missing[policyId] + 1
+		if missing[policyId] >= kDeletedPolicyChecks {
+			deleted = append(deleted, policyId)
+		}
+	}
+	dp.missing = missing
+
+	for _, policyId := range deleted {
+		log.Debug().Str("policyId", policyId).Msg("Agents assigned to a deleted policy")
+		if err := dp.handle(ctx, policyId); err != nil {
+			return fmt.Errorf("failed handling deleted policy %s: %w", policyId, err)
+		}
+	}
+	return nil
+}
+
+// reassignAgents assigns the agents of the deleted policy to the default one
+// from its first revision, so they are sent the policy on their next checkin.
+func reassignAgents(ctx context.Context, bulker bulk.Bulk, policyId, defaultPolicyId string) error {
+	fields := map[string]interface{}{
+		dl.FieldPolicyId:             defaultPolicyId,
+		dl.FieldPolicyRevisionIdx:    0,
+		dl.FieldPolicyCoordinatorIdx: 0,
+		dl.FieldOrphanedAt:           nil,
+		dl.FieldUpdatedAt:            time.Now().UTC().Format(time.RFC3339),
+	}
+
+	filter := dl.ActiveAgentsFilter{PolicyId: policyId}
+	n, err := updateMatchingAgents(ctx, bulker, filter, fields, nil)
+	log.Info().
+		Err(err).
+		Str("policyId", policyId).
+		Str("defaultPolicyId", defaultPolicyId).
+		Int("agents", n).
+		Msg("Reassigned agents of deleted policy")
+	return err
+}
+
+// orphanAgents marks the agents of the deleted policy not yet orphaned, and
+// sends them an action naming the policy, expiring after expiration unless 0.
+func orphanAgents(ctx context.Context, bulker bulk.Bulk, policyId string, expiration time.Duration) error {
+	data, err := json.Marshal(map[string]interface{}{dl.FieldPolicyId: policyId})
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().UTC()
+	now := ts.Format(time.RFC3339)
+	var expiresAt string
+	if expiration > 0 {
+		expiresAt = ts.Add(expiration).Format(time.RFC3339)
+	}
+	fields := map[string]interface{}{
+		dl.FieldOrphanedAt: now,
+		dl.FieldUpdatedAt:  now,
+	}
+
+	filter := dl.ActiveAgentsFilter{PolicyId: policyId, NotOrphaned: true}
+	n, err := updateMatchingAgents(ctx, bulker, filter, fields, func(agentIds []string) error {
+		actionId := uuid.Must(uuid.NewV4()).String()
+		_, err := dl.CreateAction(ctx, bulker, model.Action{
+			ESDocument: model.ESDocument{
+				Id: actionId,
+			},
+			ActionId:   actionId,
+			Agents:     agentIds,
+			Timestamp:  now,
+			Expiration: expiresAt,
+			Type:       TypePolicyDeleted,
+			Data:       data,
+		})
+		return err
+	})
+	if n > 0 || err != nil {
+		log.Warn().
+			Err(err).
+			Str("policyId", policyId).
+			Int("agents", n).
+			Msg("Orphaned agents of deleted policy; reassign them to a policy")
+	}
+	return err
+}
+
+// updateMatchingAgents sets the fields on the active agents matching the
+// filter, paged through a batch at a time, and calls each with the ids of every
+// batch.
+func updateMatchingAgents(ctx context.Context, bulker bulk.Bulk, filter dl.ActiveAgentsFilter, fields map[string]interface{}, each func(agentIds []string) error) (int, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"doc": fields,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = dl.ForEachActiveAgents(ctx, bulker, filter, nil, kDeletedPolicyBatchSize, func(hits []es.HitT) error {
+		agentIds := make([]string, len(hits))
+		ops := make([]bulk.BulkOp, len(hits))
+		for i, hit := range hits {
+			agentIds[i] = hit.Id
+			ops[i] = bulk.BulkOp{
+				Id:    hit.Id,
+				Index: dl.FleetAgents,
+				Body:  body,
+			}
+		}
+		if err := bulker.MUpdate(ctx, ops); err != nil {
+			return err
+		}
+		n += len(agentIds)
+
+		if each != nil {
+			return each(agentIds)
+		}
+		return nil
+	})
+	if errors.Is(err, es.ErrIndexNotFound) {
+		err = nil
+	}
+	return n, err
+}
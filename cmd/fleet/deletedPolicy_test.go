@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestDeletedPoliciesCheck(t *testing.T) {
+	ctx := context.Background()
+
+	var handled []string
+	var handleErr error
+	dp := newDeletedPolicies(ftesting.MockBulk{}, func(ctx context.Context, policyId string) error {
+		handled = append(handled, policyId)
+		return handleErr
+	})
+
+	existing := []model.Policy{{PolicyId: "kept"}}
+	dp.policyF = func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]model.Policy, error) {
+		return existing, nil
+	}
+	dp.assignedF = func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]string, error) {
+		return []string{"kept", "gone"}, nil
+	}
+
+	// Missing once is not enough
+	require.NoError(t, dp.check(ctx))
+	assert.Empty(t, handled)
+
+	require.NoError(t, dp.check(ctx))
+	assert.Equal(t, []string{"gone"}, handled)
+
+	// Handled again until its agents are no longer assigned to it
+	handled = nil
+	handleErr = errors.New("unavailable")
+	assert.Error(t, dp.check(ctx))
+	assert.Equal(t, []string{"gone"}, handled)
+
+	// An empty result is not taken as every policy deleted
+	existing = nil
+	handled = nil
+	for i := 0; i < kDeletedPolicyChecks; i++ {
+		require.NoError(t, dp.check(ctx))
+	}
+	assert.Empty(t, handled)
+}
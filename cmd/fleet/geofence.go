@@ -0,0 +1,126 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/netlabel"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrGeofenced = errors.New("agent location not allowed by the policy")
+
+// geofence rejects the agents enrolling or checking in from outside the
+// countries and ASNs allowed by their policy. The policies not fenced are
+// not restricted.
+type geofence struct {
+	table    *netlabel.Table
+	policies map[string]geofenceRule
+}
+
+type geofenceRule struct {
+	countries    map[string]bool
+	asns         map[string]bool
+	allowUnknown bool
+}
+
+// newGeofence returns nil when no policy is fenced.
+func newGeofence(cfg *config.Geofence) (*geofence, error) {
+	if len(cfg.Policies) == 0 {
+		return nil, nil
+	}
+
+	table, err := newNetworkTable(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &geofence{
+		table:    table,
+		policies: make(map[string]geofenceRule, len(cfg.Policies)),
+	}
+	for _, p := range cfg.Policies {
+		g.policies[p.PolicyId] = geofenceRule{
+			countries:    stringSet(p.Countries),
+			asns:         stringSet(p.ASNs),
+			allowUnknown: p.Unknown == config.GeofenceUnknownAllow,
+		}
+	}
+
+	log.Info().
+		Int("networks", table.Len()).
+		Int("policies", len(g.policies)).
+		Msg("Geofence install")
+
+	return g, nil
+}
+
+// newNetworkTable reads the network table labelling the addresses of the
+// agents from the file, then the networks, of the configuration.
+func newNetworkTable(cfg *config.Geofence) (*netlabel.Table, error) {
+	table := netlabel.NewTable()
+	if cfg.NetworksFile != "" {
+		f, err := os.Open(cfg.NetworksFile)
+		if err != nil {
+			return nil, err
+		}
+		err = table.Load(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range cfg.Networks {
+		if err := table.Add(n.CIDR, netlabel.Labels{Country: n.Country, ASN: n.ASN, Zone: n.Zone}); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// check returns ErrGeofenced, recording an audit event, if the policy does not
+// allow the address of the request.
+func (g *geofence) check(r *http.Request, action, policyId string) error {
+	if g == nil {
+		return nil
+	}
+	rule, ok := g.policies[policyId]
+	if !ok {
+		return nil
+	}
+
+	ip := remoteIP(r)
+	labels, known := g.table.Lookup(net.ParseIP(ip))
+	switch {
+	case !known && rule.allowUnknown:
+		return nil
+	case known && (rule.countries[labels.Country] || rule.asns[labels.ASN]):
+		return nil
+	}
+
+	cntGeofenced.Inc()
+	auditLog(action, "failure").
+		Str("policy_id", policyId).
+		Str("source_ip", ip).
+		Str("country", labels.Country).
+		Str("asn", labels.ASN).
+		Bool("known", known).
+		Msg("Agent location not allowed by its policy")
+	return ErrGeofenced
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeofence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geofence")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	networks := filepath.Join(dir, "networks.csv")
+	require.NoError(t, ioutil.WriteFile(networks, []byte("10.0.0.0/8,DE,64512\n10.1.0.0/16,US,64513\n"), 0600))
+
+	g, err := newGeofence(&config.Geofence{
+		NetworksFile: networks,
+		Networks:     []config.NetworkLabels{{CIDR: "192.0.2.0/24", Country: "FR", ASN: "64514"}},
+		Policies: []config.GeofencePolicy{
+			{PolicyId: "eu", Countries: []string{"DE", "FR"}},
+			{PolicyId: "asn", ASNs: []string{"64513"}, Unknown: config.GeofenceUnknownAllow},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		policy string
+		remote string
+		err    error
+	}{
+		{"eu", "10.2.0.1:1234", nil},
+		{"eu", "192.0.2.1:1234", nil},
+		{"eu", "10.1.0.1:1234", ErrGeofenced},
+		{"eu", "198.51.100.1:1234", ErrGeofenced},
+		{"asn", "10.1.0.1:1234", nil},
+		{"asn", "10.2.0.1:1234", ErrGeofenced},
+		{"asn", "198.51.100.1:1234", nil},
+		{"other", "198.51.100.1:1234", nil},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest("POST", "/api/fleet/agents/enroll", nil)
+		r.RemoteAddr = tc.remote
+		assert.Equal(t, tc.err, g.check(r, "enroll-geofence", tc.policy), "%s from %s", tc.policy, tc.remote)
+	}
+
+	// Not fenced
+	g, err = newGeofence(&config.Geofence{})
+	require.NoError(t, err)
+	assert.Nil(t, g)
+	assert.NoError(t, g.check(httptest.NewRequest("POST", "/", nil), "enroll-geofence", "eu"))
+}
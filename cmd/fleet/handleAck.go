@@ -7,7 +7,6 @@ package fleet
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -15,36 +14,49 @@ import (
 	"strings"
 	"time"
 
-	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/lifecycle"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog/log"
 )
 
-var ErrEventAgentIdMismatch = errors.New("event agentId mismatch")
+var (
+	ErrEventAgentIdMismatch = errors.New("event agentId mismatch")
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadMismatch       = errors.New("upload does not belong to the action")
+	ErrUploadIncomplete     = errors.New("upload is not complete")
+)
 
 type AckT struct {
-	limit *limit.Limiter
-	bulk  bulk.Bulk
-	cache cache.Cache
+	limit   *limit.Limiter
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	maxBody int64
+	scanner *uploadScanner
+	events  *lifecycle.Outbox
 }
 
-func NewAckT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *AckT {
+func NewAckT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, events *lifecycle.Outbox) *AckT {
 	log.Info().
 		Interface("limits", cfg.Limits.AckLimit).
 		Msg("Ack install limits")
 
 	return &AckT{
-		bulk:  bulker,
-		cache: cache,
-		limit: limit.NewLimiter(&cfg.Limits.AckLimit),
+		bulk:    bulker,
+		cache:   cache,
+		limit:   limit.NewLimiter(&cfg.Limits.AckLimit),
+		maxBody: cfg.Limits.AckLimit.MaxBody,
+		scanner: newUploadScanner(&cfg.UploadScan),
+		events:  events,
 	}
 }
 
@@ -83,27 +95,37 @@ func (ack AckT) handleAcks(w http.ResponseWriter, r *http.Request, id string) er
 	dfunc := cntAcks.IncStart()
 	defer dfunc()
 
-	raw, err := ioutil.ReadAll(r.Body)
+	body, err := newRequestBody(r, ack.maxBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	raw, err := ioutil.ReadAll(body)
 	if err != nil {
 		return err
 	}
 
-	cntAcks.bodyIn.Add(uint64(len(raw)))
+	body.count(&cntAcks)
 
 	var req AckRequest
-	if err := json.Unmarshal(raw, &req); err != nil {
+	if err := codec.Unmarshal(raw, &req); err != nil {
 		return err
 	}
 
-	log.Trace().RawJSON("raw", raw).Msg("Ack request")
+	// Redacted only when logged
+	if e := log.Trace(); e.Enabled() {
+		e.RawJSON("raw", redact.JSON(raw)).Msg("Ack request")
+	}
 
-	if err = ack.handleAckEvents(r.Context(), agent, req.Events); err != nil {
+	failed, err := ack.handleAckEvents(r.Context(), agent, req.Events)
+	if err != nil {
 		return err
 	}
 
-	resp := AckResponse{"acks"}
+	resp := ackResponse(agent.Id, req.Events, failed)
 
-	data, err := json.Marshal(&resp)
+	data, err := codec.Marshal(&resp)
 	if err != nil {
 		return err
 	}
@@ -118,32 +140,63 @@ func (ack AckT) handleAcks(w http.ResponseWriter, r *http.Request, id string) er
 	return nil
 }
 
-func (ack *AckT) handleAckEvents(ctx context.Context, agent *model.Agent, events []Event) error {
+// ackResponse acknowledges the events, reporting those that failed.
+func ackResponse(agentId string, events []Event, failed map[int]error) AckResponse {
+	resp := AckResponse{Action: "acks"}
+	if len(failed) == 0 {
+		return resp
+	}
+
+	resp.Errors = true
+	resp.Items = make([]AckResponseItem, len(events))
+	for i := range events {
+		err, ok := failed[i]
+		if !ok {
+			resp.Items[i].Status = http.StatusOK
+			continue
+		}
+		code, str, msg, lvl := cntAcks.IncError(err)
+		log.WithLevel(lvl).
+			Err(err).
+			Str("agentId", agentId).
+			Str("actionId", events[i].ActionId).
+			Int("code", code).
+			Msg("Fail ack event")
+		resp.Items[i] = AckResponseItem{Status: int64(code), Error: str, Message: msg}
+	}
+	return resp
+}
+
+// handleAckEvents writes the results of the events, returning the errors of
+// the events that failed by their index; the others are applied.
+func (ack *AckT) handleAckEvents(ctx context.Context, agent *model.Agent, events []Event) (map[int]error, error) {
+	// Resolve the referenced uploads before writing any results so that the
+	// events of the uploads that are not accepted are not applied.
+	files, failed, err := ack.resolveUploads(ctx, agent, events)
+	if err != nil {
+		return nil, err
+	}
+
 	var policyAcks []string
 	var unenroll bool
-	for _, ev := range events {
+	for i, ev := range events {
+		if _, ok := failed[i]; ok {
+			continue
+		}
 		if ev.AgentId != "" && ev.AgentId != agent.Id {
-			return ErrEventAgentIdMismatch
+			return nil, ErrEventAgentIdMismatch
 		}
 		if strings.HasPrefix(ev.ActionId, "policy:") {
-			if ev.Error == "" {
+			if ev.Error == "" && verifyPolicyHash(agent, ev) {
 				// only added if no error on action
 				policyAcks = append(policyAcks, ev.ActionId)
 			}
 			continue
 		}
 
-		action, ok := ack.cache.GetAction(ev.ActionId)
-		if !ok {
-			actions, err := dl.FindAction(ctx, ack.bulk, ev.ActionId)
-			if err != nil {
-				return err
-			}
-			if len(actions) == 0 {
-				return errors.New("no matching action")
-			}
-			action = actions[0]
-			ack.cache.SetAction(action, time.Minute)
+		action, err := ack.findAction(ctx, ev.ActionId)
+		if err != nil {
+			return nil, err
 		}
 
 		acr := model.ActionResult{
@@ -155,8 +208,12 @@ func (ack *AckT) handleAckEvents(ctx context.Context, agent *model.Agent, events
 			Data:        ev.Data,
 			Error:       ev.Error,
 		}
+		if ev.UploadId != "" {
+			acr.UploadId = ev.UploadId
+			acr.File = files[ev.UploadId]
+		}
 		if _, err := dl.CreateActionResult(ctx, ack.bulk, acr); err != nil {
-			return err
+			return nil, err
 		}
 
 		if ev.Error == "" {
@@ -164,7 +221,7 @@ func (ack *AckT) handleAckEvents(ctx context.Context, agent *model.Agent, events
 				unenroll = true
 			} else if action.Type == TypeUpgrade {
 				if err := ack.handleUpgrade(ctx, agent); err != nil {
-					return err
+					return nil, err
 				}
 			}
 		}
@@ -172,17 +229,167 @@ func (ack *AckT) handleAckEvents(ctx context.Context, agent *model.Agent, events
 
 	if len(policyAcks) > 0 {
 		if err := ack.handlePolicyChange(ctx, agent, policyAcks...); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if unenroll {
 		if err := ack.handleUnenroll(ctx, agent); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return failed, nil
+}
+
+// resolveUploads looks up the uploads referenced by the events and returns
+// their file metadata keyed by upload id, and by their index the errors of
+// the events whose upload is missing, not theirs, incomplete or not accepted
+// by the scanner; only those events fail, not the others of the request.
+func (ack *AckT) resolveUploads(ctx context.Context, agent *model.Agent, events []Event) (map[string]*model.FileMetadata, map[int]error, error) {
+	var files map[string]*model.FileMetadata
+	var failed map[int]error
+	fail := func(i int, err error) {
+		if failed == nil {
+			failed = make(map[int]error)
+		}
+		failed[i] = err
+	}
+
+	for i, ev := range events {
+		if ev.UploadId == "" {
+			continue
+		}
+
+		upload, err := dl.FindUpload(ctx, ack.bulk, ev.UploadId)
+		if err == dl.ErrNotFound {
+			fail(i, ErrUploadNotFound)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if upload.AgentId != agent.Id || upload.ActionId != ev.ActionId {
+			fail(i, ErrUploadMismatch)
+			continue
+		}
+
+		if upload.Status != model.UploadStatusReady || upload.File == nil {
+			log.Info().
+				Str("agentId", agent.Id).
+				Str("actionId", ev.ActionId).
+				Str("uploadId", ev.UploadId).
+				Str("status", upload.Status).
+				Str("error", upload.Error).
+				Msg("Ack references incomplete upload")
+			fail(i, ErrUploadIncomplete)
+			continue
+		}
+
+		if ack.scanner != nil {
+			err := ack.scanUpload(ctx, agent, ev, upload)
+			switch err {
+			case nil:
+			case ErrUploadRejected, ErrUploadScanUnavailable:
+				fail(i, err)
+				continue
+			default:
+				return nil, nil, err
+			}
+		}
+
+		if files == nil {
+			files = make(map[string]*model.FileMetadata)
+		}
+		files[ev.UploadId] = upload.File
+	}
+
+	return files, failed, nil
+}
+
+// scanUpload holds the upload until the scanner gives its verdict on it,
+// failing the upload the scanner rejects.
+func (ack *AckT) scanUpload(ctx context.Context, agent *model.Agent, ev Event, upload model.Upload) error {
+	action, err := ack.findAction(ctx, ev.ActionId)
+	if err != nil {
+		return err
+	}
+	if !ack.scanner.scans(action.InputType) {
+		return nil
+	}
+
+	err = ack.scanner.scan(ctx, uploadScanRequest{
+		UploadId:    ev.UploadId,
+		AgentId:     agent.Id,
+		ActionId:    ev.ActionId,
+		Integration: action.InputType,
+		File:        upload.File,
+	})
+	if err == ErrUploadRejected {
+		if ferr := dl.SetUploadStatus(ctx, ack.bulk, ev.UploadId, model.UploadStatusFail); ferr != nil {
+			log.Error().Err(ferr).Str("uploadId", ev.UploadId).Msg("Fail marking rejected upload failed")
+		}
+	}
+	return err
+}
+
+// findAction returns the action from the cache, or reads it from Elasticsearch
+// and caches it.
+func (ack *AckT) findAction(ctx context.Context, id string) (model.Action, error) {
+	if action, ok := ack.cache.GetAction(id); ok {
+		return action, nil
+	}
+
+	actions, err := dl.FindAction(ctx, ack.bulk, id)
+	if err != nil {
+		return model.Action{}, err
+	}
+	if len(actions) == 0 {
+		return model.Action{}, errors.New("no matching action")
+	}
+	action := actions[0]
+	ack.cache.SetAction(action, ack.cache.ActionTTL(action.Type))
+	return action, nil
+}
+
+// kPolicyMaxDispatches caps the dispatches of a policy acked with another
+// hash, so an agent that always hashes it differently is not sent it forever.
+const kPolicyMaxDispatches = 3
+
+// verifyPolicyHash tells whether the policy the agent acks is the one
+// dispatched to it. A policy acked with another hash, mangled on its way or
+// applied wrong, is not recorded as applied so it is dispatched again on the
+// next checkin, up to kPolicyMaxDispatches times. The acks without a hash, or
+// of a policy change other than the last dispatched, are not verified.
+func verifyPolicyHash(agent *model.Agent, ev Event) bool {
+	dispatched := agent.PolicyDispatched
+	if ev.PolicyHash == "" || dispatched == nil || dispatched.ActionId != ev.ActionId {
+		return true
+	}
+	if ev.PolicyHash == dispatched.Hash {
+		cntPolicyHashVerified.Inc()
+		return true
+	}
+
+	cntPolicyHashMismatch.Inc()
+	if dispatched.Attempts >= kPolicyMaxDispatches {
+		log.Error().
+			Str("agentId", agent.Id).
+			Str("actionId", ev.ActionId).
+			Str("hash", dispatched.Hash).
+			Str("ackedHash", ev.PolicyHash).
+			Int64("attempts", dispatched.Attempts).
+			Msg("Policy acked with another hash than dispatched; recording it as applied after the last attempt")
+		return true
+	}
+	log.Warn().
+		Str("agentId", agent.Id).
+		Str("actionId", ev.ActionId).
+		Str("hash", dispatched.Hash).
+		Str("ackedHash", ev.PolicyHash).
+		Int64("attempts", dispatched.Attempts).
+		Msg("Policy acked with another hash than dispatched; dispatching it again")
+	return false
 }
 
 func (ack *AckT) handlePolicyChange(ctx context.Context, agent *model.Agent, actionIds ...string) error {
@@ -221,14 +428,18 @@ func (ack *AckT) handlePolicyChange(ctx context.Context, agent *model.Agent, act
 		bulk.WithRefresh(),
 		bulk.WithRetryOnConflict(3),
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	ack.events.Emit(lifecycle.NewEvent(lifecycle.TypePolicyApplied, agent.Id, agent.PolicyId, currRev, time.Now()))
+	return nil
 }
 
 func (ack *AckT) handleUnenroll(ctx context.Context, agent *model.Agent) error {
 	apiKeys := _getAPIKeyIDs(agent)
 	if len(apiKeys) > 0 {
-		if err := apikey.Invalidate(ctx, ack.bulk.Client(), apiKeys...); err != nil {
+		if err := invalidateAPIKeys(ctx, ack.bulk, apiKeys...); err != nil {
 			return err
 		}
 	}
@@ -245,7 +456,12 @@ func (ack *AckT) handleUnenroll(ctx context.Context, agent *model.Agent) error {
 		return err
 	}
 
-	return ack.bulk.Update(ctx, dl.FleetAgents, agent.Id, body, bulk.WithRefresh())
+	if err := ack.bulk.Update(ctx, dl.FleetAgents, agent.Id, body, bulk.WithRefresh()); err != nil {
+		return err
+	}
+
+	ack.events.Emit(lifecycle.NewEvent(lifecycle.TypeUnenrolled, agent.Id, agent.PolicyId, agent.PolicyRevisionIdx, time.Now()))
+	return nil
 }
 
 func (ack *AckT) handleUpgrade(ctx context.Context, agent *model.Agent) error {
@@ -261,7 +477,12 @@ func (ack *AckT) handleUpgrade(ctx context.Context, agent *model.Agent) error {
 		return err
 	}
 
-	return ack.bulk.Update(ctx, dl.FleetAgents, agent.Id, body, bulk.WithRefresh())
+	if err := ack.bulk.Update(ctx, dl.FleetAgents, agent.Id, body, bulk.WithRefresh()); err != nil {
+		return err
+	}
+
+	ack.events.Emit(lifecycle.NewEvent(lifecycle.TypeUpgraded, agent.Id, agent.PolicyId, agent.PolicyRevisionIdx, time.Now()))
+	return nil
 }
 
 func _getAPIKeyIDs(agent *model.Agent) []string {
@@ -5,9 +5,15 @@
 package fleet
 
 import (
+	"context"
 	"testing"
 
 	"encoding/json"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
 )
 
 func BenchmarkMakeUpdatePolicyBody(b *testing.B) {
@@ -37,3 +43,107 @@ func TestMakeUpdatePolicyBody(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type uploadBulk struct {
+	ftesting.MockBulk
+	uploads map[string]model.Upload
+}
+
+func (m uploadBulk) Read(ctx context.Context, index, id string, opts ...bulk.Opt) ([]byte, error) {
+	upload, ok := m.uploads[id]
+	if !ok {
+		return nil, es.ErrElasticNotFound
+	}
+	return json.Marshal(&upload)
+}
+
+func TestResolveUploads(t *testing.T) {
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}}
+	file := &model.FileMetadata{Name: "bundle.zip", Size: 1024}
+
+	ack := &AckT{bulk: uploadBulk{uploads: map[string]model.Upload{
+		"ready":     {AgentId: "agent-1", ActionId: "action-1", Status: model.UploadStatusReady, File: file},
+		"uploading": {AgentId: "agent-1", ActionId: "action-1", Status: model.UploadStatusUploading, File: file},
+		"other":     {AgentId: "agent-2", ActionId: "action-1", Status: model.UploadStatusReady, File: file},
+	}}}
+
+	tests := []struct {
+		name     string
+		uploadId string
+		err      error
+	}{
+		{"ready", "ready", nil},
+		{"incomplete", "uploading", ErrUploadIncomplete},
+		{"other agent", "other", ErrUploadMismatch},
+		{"missing", "missing", ErrUploadNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			events := []Event{{ActionId: "action-1", UploadId: tc.uploadId}}
+			files, failed, err := ack.resolveUploads(context.Background(), agent, events)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if failed[0] != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, failed[0])
+			}
+			if tc.err == nil && files[tc.uploadId].Name != file.Name {
+				t.Fatalf("expected file metadata for %s", tc.uploadId)
+			}
+		})
+	}
+
+	// Only the events of the uploads failing fail, not the others
+	events := []Event{
+		{ActionId: "action-1", UploadId: "missing"},
+		{ActionId: "action-1", UploadId: "ready"},
+		{ActionId: "action-1", UploadId: "uploading"},
+	}
+	files, failed, err := ack.resolveUploads(context.Background(), agent, events)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(failed) != 2 || failed[0] != ErrUploadNotFound || failed[2] != ErrUploadIncomplete {
+		t.Fatalf("expected the missing and incomplete uploads to fail, got %v", failed)
+	}
+	if files["ready"] == nil {
+		t.Fatalf("expected file metadata for ready")
+	}
+}
+
+func TestVerifyPolicyHash(t *testing.T) {
+	const actionId = "policy:p1:2:1"
+	data := []byte(`{"id":"p1","outputs":{"default":{"api_key":"id:key"}}}`)
+	hash := policyHash(data)
+
+	agent := &model.Agent{
+		ESDocument:       model.ESDocument{Id: "agent-1"},
+		PolicyDispatched: &model.PolicyDispatched{ActionId: actionId, Hash: hash, Attempts: 1},
+	}
+	lastAttempt := &model.Agent{
+		ESDocument:       model.ESDocument{Id: "agent-1"},
+		PolicyDispatched: &model.PolicyDispatched{ActionId: actionId, Hash: hash, Attempts: kPolicyMaxDispatches},
+	}
+
+	tests := []struct {
+		name  string
+		agent *model.Agent
+		ev    Event
+		ok    bool
+	}{
+		{"match", agent, Event{ActionId: actionId, PolicyHash: hash}, true},
+		{"mismatch", agent, Event{ActionId: actionId, PolicyHash: policyHash([]byte(`{"id":"p1"}`))}, false},
+		{"mismatch on the last attempt", lastAttempt, Event{ActionId: actionId, PolicyHash: policyHash([]byte(`{"id":"p1"}`))}, true},
+		{"no hash acked", agent, Event{ActionId: actionId}, true},
+		{"older action", agent, Event{ActionId: "policy:p1:1:1", PolicyHash: "other"}, true},
+		{"nothing dispatched", &model.Agent{}, Event{ActionId: actionId, PolicyHash: "other"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if ok := verifyPolicyHash(tc.agent, tc.ev); ok != tc.ok {
+				t.Errorf("expected %v, got %v", tc.ok, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	kFanOutExpiration   = 24 * time.Hour
+	kFanOutBatchSize    = 1000
+	kFanOutMaxBatchSize = 10000
+)
+
+type ActionsFanOutT struct {
+	limit   *limit.Limiter
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	actions *config.Actions
+}
+
+func NewActionsFanOutT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *ActionsFanOutT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Actions fan-out install limits")
+
+	return &ActionsFanOutT{
+		bulk:    bulker,
+		cache:   cache,
+		actions: &cfg.Actions,
+		limit:   limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleActionsFanOut(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.aft.handleActionsFanOut(w, r)
+
+	if err != nil {
+		rt.aft.writeError(w, err, "Fail actions fan-out")
+	}
+}
+
+func (aft *ActionsFanOutT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntActionsFanOut.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+// handleActionsFanOut creates the action of the request for every active
+// agent matching its filter, streaming the progress after each batch. Once
+// streaming the errors can only be reported in the progress.
+func (aft *ActionsFanOutT) handleActionsFanOut(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := aft.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, aft.bulk, aft.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntActionsFanOut.IncStart()
+	defer dfunc()
+
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	cntActionsFanOut.bodyIn.Add(uint64(len(raw)))
+
+	var req ActionFanOutRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return err
+	}
+	fo, err := newFanOut(&req, aft.actions.Expiration(req.Action.Type, kFanOutExpiration), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	progress, err := fo.run(r.Context(), aft.bulk, func(p ActionFanOutProgress) error {
+		return aft.writeProgress(w, &p)
+	})
+	outcome := "success"
+	if err != nil {
+		cntActionsFanOut.failure.Inc()
+		progress.Error = err.Error()
+		outcome = "failure"
+	} else {
+		progress.Done = true
+	}
+
+	auditLog("action-fan-out", outcome).
+		Err(err).
+		Str("operator", key.Id).
+		Str("action.id", progress.ActionId).
+		Str("action.type", req.Action.Type).
+		Int64("agents", progress.Agents).
+		Msg("Fanned out action")
+
+	return aft.writeProgress(w, &progress)
+}
+
+func (aft *ActionsFanOutT) writeProgress(w http.ResponseWriter, p *ActionFanOutProgress) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	cntActionsFanOut.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// fanOut creates the action documents of a fan-out request, one per batch of
+// matching agents, all sharing the action ID.
+type fanOut struct {
+	agentSelector
+	action    model.Action
+	batchSize int
+}
+
+// newFanOut returns the fan-out of the request; its actions expire after ttl
+// unless the request sets their expiration.
+func newFanOut(req *ActionFanOutRequest, ttl time.Duration, now time.Time) (*fanOut, error) {
+	if err := req.Action.Validate(); err != nil {
+		return nil, err
+	}
+
+	if req.Expiration != "" {
+		d, err := time.ParseDuration(req.Expiration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid expiration %q", req.Expiration)
+		}
+		ttl = d
+	}
+
+	batchSize := kFanOutBatchSize
+	if req.BatchSize != 0 {
+		if req.BatchSize < 0 || req.BatchSize > kFanOutMaxBatchSize {
+			return nil, fmt.Errorf("batch_size must be between 1 and %d", kFanOutMaxBatchSize)
+		}
+		batchSize = int(req.BatchSize)
+	}
+
+	sel, err := newAgentSelector(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fanOut{
+		agentSelector: sel,
+		action: model.Action{
+			ActionId:   uuid.Must(uuid.NewV4()).String(),
+			Type:       req.Action.Type,
+			InputType:  req.Action.InputType,
+			Data:       req.Action.Data,
+			Priority:   req.Action.Priority,
+			Timestamp:  now.Format(time.RFC3339),
+			Expiration: now.Add(ttl).Format(time.RFC3339),
+		},
+		batchSize: batchSize,
+	}, nil
+}
+
+// run pages through the matching agents and creates an action document for
+// the agents of each page within the version constraint, calling progress
+// after each. The agents are read at a point in time, so those written
+// meanwhile are neither missed nor targeted twice. It returns the progress
+// when it stopped.
+func (fo *fanOut) run(ctx context.Context, bulker bulk.Bulk, progress func(ActionFanOutProgress) error) (ActionFanOutProgress, error) {
+	p := ActionFanOutProgress{ActionId: fo.action.ActionId}
+
+	err := dl.ForEachActiveAgents(ctx, bulker, fo.filter, selectorAgentFields, fo.batchSize, func(hits []es.HitT) error {
+		ids, err := fo.targets(hits)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		action := fo.action
+		action.Id = uuid.Must(uuid.NewV4()).String()
+		action.Agents = ids
+		if _, err := dl.CreateAction(ctx, bulker, action); err != nil {
+			return err
+		}
+		p.Documents++
+		p.Agents += int64(len(ids))
+
+		return progress(p)
+	})
+	return p, err
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFanOut(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	fo, err := newFanOut(&ActionFanOutRequest{Action: ActionTemplate{Type: "UPGRADE"}}, kFanOutExpiration, now)
+	require.NoError(t, err)
+	assert.NotEmpty(t, fo.action.ActionId)
+	assert.Equal(t, "2021-06-02T12:00:00Z", fo.action.Expiration)
+	assert.Equal(t, kFanOutBatchSize, fo.batchSize)
+	assert.Nil(t, fo.verCon)
+
+	fo, err = newFanOut(&ActionFanOutRequest{
+		Action:     ActionTemplate{Type: "UPGRADE"},
+		Expiration: "2h",
+		BatchSize:  10,
+		Filter:     AgentFilter{PolicyId: "policy-1", Tags: []string{"linux"}, Version: ">= 7.14"},
+	}, kFanOutExpiration, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2021-06-01T14:00:00Z", fo.action.Expiration)
+	assert.Equal(t, 10, fo.batchSize)
+	assert.Equal(t, "policy-1", fo.filter.PolicyId)
+	assert.Equal(t, []string{"linux"}, fo.filter.Tags)
+
+	bad := []ActionFanOutRequest{
+		{},
+		{Action: ActionTemplate{Type: "UPGRADE"}, Expiration: "tomorrow"},
+		{Action: ActionTemplate{Type: "UPGRADE"}, Expiration: "-1h"},
+		{Action: ActionTemplate{Type: "UPGRADE"}, BatchSize: kFanOutMaxBatchSize + 1},
+		{Action: ActionTemplate{Type: "UPGRADE"}, Filter: AgentFilter{Version: "newest"}},
+	}
+	for _, req := range bad {
+		req := req
+		_, err := newFanOut(&req, kFanOutExpiration, now)
+		assert.Error(t, err, "%+v", req)
+	}
+}
+
+func TestFanOutTargets(t *testing.T) {
+	agent := func(id, ver string) es.HitT {
+		src := `{}`
+		if ver != "" {
+			src = `{"agent":{"version":"` + ver + `"}}`
+		}
+		return es.HitT{Id: id, Source: json.RawMessage(src)}
+	}
+	hits := []es.HitT{
+		agent("a", "7.13.4"),
+		agent("b", "7.14.0"),
+		agent("c", "8.0.0"),
+		agent("d", ""),
+		agent("e", "not-a-version"),
+	}
+
+	fo, err := newFanOut(&ActionFanOutRequest{Action: ActionTemplate{Type: "UPGRADE"}}, kFanOutExpiration, time.Now())
+	require.NoError(t, err)
+	ids, err := fo.targets(hits)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, ids)
+
+	fo, err = newFanOut(&ActionFanOutRequest{
+		Action: ActionTemplate{Type: "UPGRADE"},
+		Filter: AgentFilter{Version: ">= 7.14, < 8.0"},
+	}, kFanOutExpiration, time.Now())
+	require.NoError(t, err)
+	ids, err = fo.targets(hits)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ids)
+}
@@ -12,8 +12,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
@@ -22,6 +25,7 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/throttle"
 
 	"github.com/julienschmidt/httprouter"
@@ -33,6 +37,13 @@ const (
 	defaultMaxParallel = 8              // TODO: configurable
 	defaultCacheTTL    = time.Hour * 24 // TODO: configurable
 	defaultThrottleTTL = time.Minute    // TODO: configurable
+
+	// kArtifactBlobIdent caches the artifacts addressed by their encoded
+	// sha256 apart from those addressed by identifier, which has no slash.
+	kArtifactBlobIdent = "blob/sha256"
+
+	// The content addressed artifacts never change
+	kArtifactBlobMaxAge = 365 * 24 * time.Hour
 )
 
 var (
@@ -46,13 +57,19 @@ type ArtifactT struct {
 	bulker     bulk.Bulk
 	cache      cache.Cache
 	esThrottle *throttle.Throttle
+	bandwidth  *throttle.Bandwidth
 	limit      *limit.Limiter
+	caching    config.ArtifactCaching
+	redirect   *artifactRedirect
 }
 
 func NewArtifactT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *ArtifactT {
 	log.Info().
 		Interface("limits", cfg.Limits.ArtifactLimit).
 		Int("maxParallel", defaultMaxParallel).
+		Interface("bandwidth", cfg.Limits.ArtifactBandwidth).
+		Interface("caching", cfg.ArtifactCaching).
+		Bool("redirect", cfg.ArtifactRedirect.Enabled).
 		Msg("Artifact install limits")
 
 	return &ArtifactT{
@@ -60,6 +77,9 @@ func NewArtifactT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *Arti
 		cache:      cache,
 		limit:      limit.NewLimiter(&cfg.Limits.ArtifactLimit),
 		esThrottle: throttle.NewThrottle(defaultMaxParallel),
+		bandwidth:  throttle.NewBandwidth(&cfg.Limits.ArtifactBandwidth),
+		caching:    cfg.ArtifactCaching,
+		redirect:   newArtifactRedirect(&cfg.ArtifactRedirect),
 	}
 }
 
@@ -77,10 +97,29 @@ func (rt Router) handleArtifacts(w http.ResponseWriter, r *http.Request, ps http
 		Str("remoteAddr", r.RemoteAddr).
 		Logger()
 
-	rdr, err := rt.at.handleArtifacts(r, zlog, id, sha2)
+	rdr, err := rt.at.handleArtifacts(w, r, zlog, id, sha2)
+	writeArtifact(w, zlog, start, rdr, err)
+}
+
+func (rt Router) handleArtifactBlob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	start := time.Now()
+
+	sha2 := ps.ByName("sha2") // EncodedSha256 in the artifact record
+
+	zlog := log.With().
+		Str("sha2", sha2).
+		Str("remoteAddr", r.RemoteAddr).
+		Logger()
+
+	rdr, err := rt.at.handleArtifactBlob(w, r, zlog, sha2)
+	writeArtifact(w, zlog, start, rdr, err)
+}
 
+// writeArtifact writes the payload of the artifact, or the error.
+func writeArtifact(w http.ResponseWriter, zlog zerolog.Logger, start time.Time, rdr io.ReadCloser, err error) {
 	var nWritten int64
-	if err == nil {
+	if err == nil && rdr != nil {
+		defer rdr.Close()
 		nWritten, err = io.Copy(w, rdr)
 		zlog.Trace().
 			Err(err).
@@ -107,7 +146,9 @@ func (rt Router) handleArtifacts(w http.ResponseWriter, r *http.Request, ps http
 	}
 }
 
-func (at ArtifactT) handleArtifacts(r *http.Request, zlog zerolog.Logger, id, sha2 string) (io.Reader, error) {
+// handleArtifacts returns the payload of the artifact to write, nil when the
+// response is complete without it.
+func (at ArtifactT) handleArtifacts(w http.ResponseWriter, r *http.Request, zlog zerolog.Logger, id, sha2 string) (io.ReadCloser, error) {
 	limitF, err := at.limit.Acquire()
 	if err != nil {
 		return nil, err
@@ -131,7 +172,91 @@ func (at ArtifactT) handleArtifacts(r *http.Request, zlog zerolog.Logger, id, sh
 		Str("agentId", agent.Id).
 		Logger()
 
-	return at.handle(r.Context(), zlog, agent, id, sha2)
+	return at.handle(w, r, zlog, agent, id, sha2)
+}
+
+// handleArtifactBlob returns the payload of the artifact addressed by the
+// sha256 of its encoded payload. The agents are redirected to the CDN when
+// there is one; the CDN pulling from Fleet Server presents the signed URL
+// instead of an access API key and is served the payload.
+func (at ArtifactT) handleArtifactBlob(w http.ResponseWriter, r *http.Request, zlog zerolog.Logger, sha2 string) (io.ReadCloser, error) {
+	limitF, err := at.limit.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer limitF()
+
+	if err := validateSha2String(sha2); err != nil {
+		return nil, err
+	}
+
+	var agent *model.Agent
+	if q := r.URL.Query(); q.Get(signedurl.ParamSignature) != "" {
+		if err := at.redirect.verify(sha2, q.Get(signedurl.ParamExpires), q.Get(signedurl.ParamSignature)); err != nil {
+			return nil, err
+		}
+	} else {
+		if agent, err = authAgent(r, "", at.bulker, at.cache); err != nil {
+			return nil, err
+		}
+		zlog = zlog.With().
+			Str("APIKeyId", agent.AccessApiKeyId).
+			Str("agentId", agent.Id).
+			Logger()
+	}
+
+	dfunc := cntArtifacts.IncStart()
+	defer dfunc()
+
+	ctx := r.Context()
+	artifact, err := at.getArtifactBlob(ctx, zlog, sha2)
+	if err != nil {
+		return nil, err
+	}
+	if artifact.EncodedSha256 != sha2 {
+		zlog.Info().
+			Err(ErrorRecord).
+			Str("artifact_sha2", artifact.EncodedSha256).
+			Msg("Encoded sha256 mismatch on url")
+		return nil, ErrorRecord
+	}
+
+	if agent != nil && at.redirect != nil {
+		return nil, at.redirect.write(w, r, artifact)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("ETag", `"`+sha2+`"`)
+	scope := "public"
+	if agent != nil {
+		scope = "private"
+	}
+	h.Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, immutable", scope, int64(kArtifactBlobMaxAge/time.Second)))
+
+	if etagMatch(r.Header.Get("If-None-Match"), `"`+sha2+`"`) {
+		w.WriteHeader(http.StatusNotModified)
+		cntArtifacts.notModified.Inc()
+		return nil, nil
+	}
+	h.Set("Content-Length", strconv.Itoa(len(artifact.Body)))
+	if r.Method == http.MethodHead {
+		return nil, nil
+	}
+
+	// The pulls of the CDN share the budgets of no policy and no agent
+	var policyID, agentID string
+	if agent != nil {
+		policyID, agentID = agent.PolicyId, agent.Id
+	}
+	transfer, err := at.bandwidth.Transfer(ctx, policyID, agentID)
+	if err != nil {
+		return nil, err
+	}
+	return transferReader{
+		Reader:   transfer.Reader(ctx, bytes.NewReader(artifact.Body)),
+		transfer: transfer,
+	}, nil
 }
 
 type artHandler struct {
@@ -140,7 +265,8 @@ type artHandler struct {
 	c      cache.Cache
 }
 
-func (at ArtifactT) handle(ctx context.Context, zlog zerolog.Logger, agent *model.Agent, id, sha2 string) (io.Reader, error) {
+func (at ArtifactT) handle(w http.ResponseWriter, r *http.Request, zlog zerolog.Logger, agent *model.Agent, id, sha2 string) (io.ReadCloser, error) {
+	ctx := r.Context()
 
 	// Input validation
 	if err := validateSha2String(sha2); err != nil {
@@ -178,9 +304,79 @@ func (at ArtifactT) handle(ctx context.Context, zlog zerolog.Logger, agent *mode
 		Str("created", artifact.Created).
 		Msg("Artifact GET")
 
-	// Write the payload
-	rdr := bytes.NewReader(artifact.Body)
-	return rdr, nil
+	// Agents holding the current artifact are answered without the payload
+	if at.writeCacheHeaders(w, r, artifact) {
+		cntArtifacts.notModified.Inc()
+		zlog.Debug().Msg("Artifact not modified")
+		return nil, nil
+	}
+	// The payload is served from the CDN
+	if at.redirect != nil {
+		return nil, at.redirect.write(w, r, artifact)
+	}
+	if r.Method == http.MethodHead {
+		return nil, nil
+	}
+
+	// Write the payload within the bandwidth budgets of the agent, once the
+	// policy has room for the transfer
+	transfer, err := at.bandwidth.Transfer(ctx, agent.PolicyId, agent.Id)
+	if err != nil {
+		return nil, err
+	}
+	return transferReader{
+		Reader:   transfer.Reader(ctx, bytes.NewReader(artifact.Body)),
+		transfer: transfer,
+	}, nil
+}
+
+// transferReader releases the bandwidth budgets of its transfer on close.
+type transferReader struct {
+	io.Reader
+	transfer *throttle.Transfer
+}
+
+func (r transferReader) Close() error {
+	return r.transfer.Close()
+}
+
+// writeCacheHeaders sets the headers of the artifact response. It tells
+// whether the request holds the current artifact, in which case the 304 is
+// written.
+func (at ArtifactT) writeCacheHeaders(w http.ResponseWriter, r *http.Request, artifact *model.Artifact) bool {
+	h := w.Header()
+	if !at.caching.Enabled {
+		h.Set("Content-Length", strconv.Itoa(len(artifact.Body)))
+		return false
+	}
+
+	// The encoded sha256 is validated against the payload served
+	etag := `"` + artifact.EncodedSha256 + `"`
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int64(at.caching.MaxAge/time.Second)))
+
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(artifact.Body)))
+	return false
+}
+
+// etagMatch tells whether the If-None-Match header matches the etag, with the
+// weak comparison it calls for.
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // TODO: Pull the policy record for this agent and validate that the
@@ -199,6 +395,21 @@ func (at ArtifactT) authorizeArtifact(ctx context.Context, agent *model.Agent, i
 // Return artifact from cache by sha2 or fetch directly from Elastic.
 // Update cache on successful retrieval from Elastic.
 func (at ArtifactT) getArtifact(ctx context.Context, zlog zerolog.Logger, ident, sha2 string) (*model.Artifact, error) {
+	return at.cachedArtifact(ctx, zlog, ident, sha2, func(ctx context.Context) (*model.Artifact, error) {
+		return dl.FindArtifact(ctx, at.bulker, ident, sha2)
+	})
+}
+
+// getArtifactBlob returns the artifact by the sha256 of its encoded payload.
+func (at ArtifactT) getArtifactBlob(ctx context.Context, zlog zerolog.Logger, sha2 string) (*model.Artifact, error) {
+	return at.cachedArtifact(ctx, zlog, kArtifactBlobIdent, sha2, func(ctx context.Context) (*model.Artifact, error) {
+		return dl.FindArtifactByEncodedSha256(ctx, at.bulker, sha2)
+	})
+}
+
+// cachedArtifact returns the artifact cached under ident and sha2, or fetches
+// it with find and caches it decoded.
+func (at ArtifactT) cachedArtifact(ctx context.Context, zlog zerolog.Logger, ident, sha2 string, find func(context.Context) (*model.Artifact, error)) (*model.Artifact, error) {
 
 	// Check the cache; return immediately if found.
 	if artifact, ok := at.cache.GetArtifact(ident, sha2); ok {
@@ -206,7 +417,7 @@ func (at ArtifactT) getArtifact(ctx context.Context, zlog zerolog.Logger, ident,
 	}
 
 	// Fetch the artifact from elastic
-	art, err := at.fetchArtifact(ctx, zlog, ident, sha2)
+	art, err := at.fetchArtifact(ctx, zlog, sha2, find)
 
 	if err != nil {
 		zlog.Info().Err(err).Msg("Fail retrieve artifact")
@@ -239,7 +450,7 @@ func (at ArtifactT) getArtifact(ctx context.Context, zlog zerolog.Logger, ident,
 	art.Body = dstPayload
 
 	// Update the cache.
-	at.cache.SetArtifact(*art, defaultCacheTTL)
+	at.cache.SetArtifactAs(ident, sha2, *art, defaultCacheTTL)
 
 	return art, nil
 }
@@ -248,7 +459,7 @@ func (at ArtifactT) getArtifact(ctx context.Context, zlog zerolog.Logger, ident,
 // TODO: Design a mechanism to mitigate a DDOS attack on bogus hashes.
 // Perhaps have a cache of the most recently used hashes available, and items that aren't
 // in the cache can do a lookup but throttle as below.  We could update the cache every 10m or so.
-func (at ArtifactT) fetchArtifact(ctx context.Context, zlog zerolog.Logger, ident, sha2 string) (*model.Artifact, error) {
+func (at ArtifactT) fetchArtifact(ctx context.Context, zlog zerolog.Logger, sha2 string, find func(context.Context) (*model.Artifact, error)) (*model.Artifact, error) {
 	// Throttle prevents more than N outstanding requests to elastic globally and per sha2.
 	if token := at.esThrottle.Acquire(sha2, defaultThrottleTTL); token == nil {
 		return nil, ErrorThrottle
@@ -257,7 +468,7 @@ func (at ArtifactT) fetchArtifact(ctx context.Context, zlog zerolog.Logger, iden
 	}
 
 	start := time.Now()
-	artifact, err := dl.FindArtifact(ctx, at.bulker, ident, sha2)
+	artifact, err := find(ctx)
 
 	zlog.Info().
 		Err(err).
@@ -0,0 +1,195 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/throttle"
+)
+
+func TestArtifactCaching(t *testing.T) {
+	body := []byte("artifact payload")
+	sum := sha256.Sum256(body)
+	sha2 := hex.EncodeToString(sum[:])
+	artifact := model.Artifact{
+		Identifier:    "endpoint-exceptionlist-linux-v1",
+		DecodedSha256: sha2,
+		EncodedSha256: sha2,
+		Body:          body,
+	}
+	etag := `"` + sha2 + `"`
+
+	c, err := cache.New(cache.Config{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+	c.SetArtifact(artifact, time.Minute)
+	require.Eventually(t, func() bool {
+		_, ok := c.GetArtifact(artifact.Identifier, sha2)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}, PolicyId: "policy-1"}
+	caching := config.ArtifactCaching{Enabled: true, MaxAge: time.Hour}
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		disabled    bool
+		code        int
+		payload     bool
+	}{
+		{"get", http.MethodGet, "", false, http.StatusOK, true},
+		{"get stale", http.MethodGet, `"other"`, false, http.StatusOK, true},
+		{"get current", http.MethodGet, etag, false, http.StatusNotModified, false},
+		{"get current among others", http.MethodGet, `"other", W/` + etag, false, http.StatusNotModified, false},
+		{"get any", http.MethodGet, "*", false, http.StatusNotModified, false},
+		{"head", http.MethodHead, "", false, http.StatusOK, false},
+		{"head current", http.MethodHead, etag, false, http.StatusNotModified, false},
+		{"disabled", http.MethodGet, etag, true, http.StatusOK, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			at := ArtifactT{
+				cache:     c,
+				bandwidth: throttle.NewBandwidth(&config.Bandwidth{}),
+				caching:   caching,
+			}
+			if tc.disabled {
+				at.caching.Enabled = false
+			}
+
+			r := httptest.NewRequest(tc.method, "/api/fleet/artifacts/"+artifact.Identifier+"/"+sha2, nil)
+			if tc.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+
+			rdr, err := at.handle(w, r, log.Logger, agent, artifact.Identifier, sha2)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, w.Code)
+
+			if tc.payload {
+				require.NotNil(t, rdr)
+				data, err := ioutil.ReadAll(rdr)
+				require.NoError(t, err)
+				require.NoError(t, rdr.Close())
+				assert.Equal(t, body, data)
+			} else {
+				assert.Nil(t, rdr)
+			}
+
+			if tc.disabled {
+				assert.Empty(t, w.Header().Get("ETag"))
+				assert.Empty(t, w.Header().Get("Cache-Control"))
+			} else {
+				assert.Equal(t, etag, w.Header().Get("ETag"))
+				assert.Equal(t, "private, max-age=3600", w.Header().Get("Cache-Control"))
+			}
+			if tc.code == http.StatusOK {
+				assert.Equal(t, "16", w.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestArtifactRedirect(t *testing.T) {
+	body := []byte("artifact payload")
+	sum := sha256.Sum256(body)
+	sha2 := hex.EncodeToString(sum[:])
+	artifact := model.Artifact{
+		Identifier:    "endpoint-exceptionlist-linux-v1",
+		DecodedSha256: sha2,
+		EncodedSha256: sha2,
+		Body:          body,
+	}
+
+	c, err := cache.New(cache.Config{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+	c.SetArtifact(artifact, time.Minute)
+	c.SetArtifactAs(kArtifactBlobIdent, sha2, artifact, time.Minute)
+	require.Eventually(t, func() bool {
+		_, ok1 := c.GetArtifact(artifact.Identifier, sha2)
+		_, ok2 := c.GetArtifact(kArtifactBlobIdent, sha2)
+		return ok1 && ok2
+	}, time.Second, 10*time.Millisecond)
+
+	now := time.Unix(1600000000, 0)
+	redirect := newArtifactRedirect(&config.ArtifactRedirect{
+		Enabled: true,
+		URL:     "https://cdn.example.com/artifacts",
+		Signer:  config.ArtifactSignerHMAC,
+		Secret:  "secret",
+		TTL:     time.Minute,
+	})
+	require.NotNil(t, redirect)
+	redirect.now = func() time.Time { return now }
+
+	at := ArtifactT{
+		cache:     c,
+		limit:     limit.NewLimiter(&config.Limit{}),
+		bandwidth: throttle.NewBandwidth(&config.Bandwidth{}),
+		redirect:  redirect,
+	}
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}, PolicyId: "policy-1"}
+
+	// The agent is redirected to the signed URL of the blob on the CDN
+	r := httptest.NewRequest(http.MethodGet, "/api/fleet/artifacts/"+artifact.Identifier+"/"+sha2, nil)
+	w := httptest.NewRecorder()
+	rdr, err := at.handle(w, r, log.Logger, agent, artifact.Identifier, sha2)
+	require.NoError(t, err)
+	assert.Nil(t, rdr)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "cdn.example.com", loc.Host)
+	assert.Equal(t, "/artifacts/"+sha2, loc.Path)
+	q := loc.Query()
+	assert.Equal(t, "1600000060", q.Get(signedurl.ParamExpires))
+
+	// The CDN pulls the blob from Fleet Server on the same signature
+	r = httptest.NewRequest(http.MethodGet, "/api/fleet/blobs/sha256/"+sha2+"?"+q.Encode(), nil)
+	w = httptest.NewRecorder()
+	rdr, err = at.handleArtifactBlob(w, r, log.Logger, sha2)
+	require.NoError(t, err)
+	require.NotNil(t, rdr)
+	data, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	require.NoError(t, rdr.Close())
+	assert.Equal(t, body, data)
+	assert.Equal(t, `"`+sha2+`"`, w.Header().Get("ETag"))
+	assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	q.Set(signedurl.ParamSignature, "bad")
+	r = httptest.NewRequest(http.MethodGet, "/api/fleet/blobs/sha256/"+sha2+"?"+q.Encode(), nil)
+	_, err = at.handleArtifactBlob(httptest.NewRecorder(), r, log.Logger, sha2)
+	assert.Equal(t, signedurl.ErrInvalidSignature, err)
+
+	redirect.now = func() time.Time { return now.Add(2 * time.Minute) }
+	r = httptest.NewRequest(http.MethodGet, "/api/fleet/blobs/sha256/"+sha2+"?"+loc.RawQuery, nil)
+	_, err = at.handleArtifactBlob(httptest.NewRecorder(), r, log.Logger, sha2)
+	assert.Equal(t, signedurl.ErrExpired, err)
+}
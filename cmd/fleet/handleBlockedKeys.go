@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrKeyNotBlocked = errors.New("api key is not blocked")
+
+type BlockedKeysT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+	kl    *limit.KeyLimiter
+}
+
+func NewBlockedKeysT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, kl *limit.KeyLimiter) *BlockedKeysT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Blocked keys install limits")
+
+	return &BlockedKeysT{
+		bulk:  bulker,
+		cache: cache,
+		kl:    kl,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleBlockedKeys(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.bkt.handleBlockedKeys(w, r)
+
+	if err != nil {
+		rt.bkt.writeError(w, err, "Fail blocked keys list")
+	}
+}
+
+func (rt Router) handleUnblockKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.bkt.handleUnblockKey(w, r, id)
+
+	if err != nil {
+		rt.bkt.writeError(w, err, "Fail unblock key")
+	}
+}
+
+func (bkt *BlockedKeysT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntBlockedKeys.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (bkt *BlockedKeysT) handleBlockedKeys(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := bkt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, bkt.bulk, bkt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntBlockedKeys.IncStart()
+	defer dfunc()
+
+	blocked := bkt.kl.Blocked()
+
+	resp := BlockedKeyList{
+		Items: make([]BlockedKey, len(blocked)),
+	}
+	for i, k := range blocked {
+		resp.Items[i] = BlockedKey{
+			Id:    k.Id,
+			Until: k.Until.UTC().Format(time.RFC3339),
+		}
+	}
+
+	return bkt.writeResponse(w, &resp)
+}
+
+func (bkt *BlockedKeysT) handleUnblockKey(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := bkt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, bkt.bulk, bkt.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntBlockedKeys.IncStart()
+	defer dfunc()
+
+	if !bkt.kl.Unblock(id) {
+		return ErrKeyNotBlocked
+	}
+
+	auditLog("api-key-unblocked", "success").
+		Str("id", id).
+		Str("operator", key.Id).
+		Msg("API key unblocked")
+
+	return nil
+}
+
+func (bkt *BlockedKeysT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntBlockedKeys.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
@@ -0,0 +1,303 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/action"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+const kBulkActionsExpiration = 24 * time.Hour
+
+var (
+	ErrActionIngestDisabled = errors.New("action ingestion not enabled")
+	ErrServiceTokenRequired = errors.New("service token required")
+	ErrWriterUnauthorized   = errors.New("service token is not of a trusted writer")
+)
+
+type BulkActionsT struct {
+	cfg      *config.ActionIngest
+	limit    *limit.Limiter
+	maxBody  int64
+	bulk     bulk.Bulk
+	actions  *config.Actions
+	writers  map[string]bool
+	signed   map[string]bool
+	verifier *action.SignatureVerifier
+	now      func() time.Time
+
+	// Returns the principal of the service token
+	authenticate func(ctx context.Context, token string) (string, error)
+}
+
+func NewBulkActionsT(cfg *config.Server, bulker bulk.Bulk) (*BulkActionsT, error) {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Bool("enabled", cfg.ActionIngest.Enabled).
+		Strs("writers", cfg.ActionIngest.Writers).
+		Strs("signed_types", cfg.ActionIngest.SignedTypes).
+		Msg("Bulk actions install limits")
+
+	bat := &BulkActionsT{
+		cfg:     &cfg.ActionIngest,
+		limit:   limit.NewLimiter(&cfg.Limits.AdminLimit),
+		maxBody: cfg.Limits.AdminLimit.MaxBody,
+		bulk:    bulker,
+		actions: &cfg.Actions,
+		writers: stringSet(cfg.ActionIngest.Writers),
+		signed:  stringSet(cfg.ActionIngest.SignedTypes),
+		now:     time.Now,
+		authenticate: func(ctx context.Context, token string) (string, error) {
+			return es.AuthenticateServiceToken(ctx, bulker.Client(), token)
+		},
+	}
+	if cfg.ActionIngest.Enabled && cfg.ActionIngest.PublicKey != "" {
+		verifier, err := action.NewSignatureVerifier(cfg.ActionIngest.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("action_ingest.public_key: %w", err)
+		}
+		bat.verifier = verifier
+	}
+	return bat, nil
+}
+
+func (rt Router) handleBulkActions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.bat.handleBulkActions(w, r)
+
+	if err != nil {
+		code, str, msg, lvl := cntBulkActions.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail bulk actions")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+// handleBulkActions writes the valid actions of the request in a batch and
+// returns the outcome of each.
+func (bat *BulkActionsT) handleBulkActions(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := bat.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if !bat.cfg.Enabled {
+		return ErrActionIngestDisabled
+	}
+
+	writer, err := bat.authWriter(r)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntBulkActions.IncStart()
+	defer dfunc()
+
+	body, err := newRequestBody(r, bat.maxBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var req BulkActionsRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return err
+	}
+	body.count(&cntBulkActions)
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if len(req.Actions) > bat.cfg.MaxActions {
+		return fmt.Errorf("at most %d actions per request", bat.cfg.MaxActions)
+	}
+
+	resp := bat.write(r.Context(), req.Actions)
+
+	var failed int
+	for _, item := range resp.Items {
+		if item.Status != http.StatusCreated {
+			failed++
+		}
+	}
+	outcome := "success"
+	if failed > 0 {
+		outcome = "failure"
+	}
+	auditLog("bulk-actions", outcome).
+		Str("writer", writer).
+		Int("actions", len(resp.Items)).
+		Int("failed", failed).
+		Msg("Wrote actions")
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	n, err := w.Write(data)
+	cntBulkActions.bodyOut.Add(uint64(n))
+	return err
+}
+
+// authWriter returns the principal of the bearer service token of the
+// request, if it is one of the writers.
+func (bat *BulkActionsT) authWriter(r *http.Request) (string, error) {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) || len(header) == len(prefix) {
+		return "", ErrServiceTokenRequired
+	}
+
+	timed := timePhase(r.Context(), phaseAuth)
+	principal, err := bat.authenticate(r.Context(), header[len(prefix):])
+	timed()
+	if errors.Is(err, es.ErrServiceTokenRejected) {
+		log.Info().Err(err).Msg("Service token of writer rejected")
+		return "", es.ErrServiceTokenRejected
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !bat.writers[principal] {
+		log.Info().
+			Err(ErrWriterUnauthorized).
+			Str("principal", principal).
+			Msg("Service token not of a trusted writer")
+		return "", ErrWriterUnauthorized
+	}
+	return principal, nil
+}
+
+// write creates the documents of the valid actions, at once so the bulker
+// sends them together, and returns the outcome of every action. The document
+// of an action is created with its action ID as ID, so the actions of a batch
+// retried by the writer are not written, nor dispatched, twice; an action
+// already written counts as written.
+func (bat *BulkActionsT) write(ctx context.Context, reqs []BulkAction) BulkActionsResponse {
+	now := bat.now().UTC()
+	resp := BulkActionsResponse{Items: make([]BulkActionResult, len(reqs))}
+
+	var wg sync.WaitGroup
+	for i := range reqs {
+		item := &resp.Items[i]
+		doc, err := bat.prepare(&reqs[i], now)
+		if err != nil {
+			*item = BulkActionResult{ActionId: reqs[i].ActionId, Status: http.StatusBadRequest, Error: err.Error()}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := dl.CreateAction(ctx, bat.bulk, doc)
+			if errors.Is(err, es.ErrElasticVersionConflict) {
+				log.Debug().Str("actionId", doc.ActionId).Msg("Action already written")
+				err = nil
+			}
+			if err != nil {
+				*item = BulkActionResult{ActionId: doc.ActionId, Status: http.StatusInternalServerError, Error: err.Error()}
+				return
+			}
+			*item = BulkActionResult{ActionId: doc.ActionId, Id: doc.Id, Status: http.StatusCreated}
+		}()
+	}
+	wg.Wait()
+
+	for _, item := range resp.Items {
+		if item.Status != http.StatusCreated {
+			resp.Errors = true
+		}
+	}
+	return resp
+}
+
+// prepare validates the action and returns its document, with its signature
+// checked and its action ID and expiration assigned when not given. The ID of
+// the document is the action ID.
+func (bat *BulkActionsT) prepare(req *BulkAction, now time.Time) (model.Action, error) {
+	if err := req.Validate(); err != nil {
+		return model.Action{}, err
+	}
+	if len(req.Agents) == 0 {
+		return model.Action{}, errors.New("agents must not be empty")
+	}
+
+	isSigned := req.Signed.Data != "" || req.Signed.Signature != ""
+	if bat.signed[req.Type] && !isSigned {
+		return model.Action{}, fmt.Errorf("%s actions must be signed", req.Type)
+	}
+	var signed json.RawMessage
+	if isSigned {
+		if req.ActionId == "" {
+			return model.Action{}, errors.New("action_id is required on signed actions")
+		}
+		if bat.verifier != nil {
+			if err := bat.verifier.Verify(req.ActionId, req.Type, req.Signed.Data, req.Signed.Signature); err != nil {
+				return model.Action{}, err
+			}
+		}
+		var err error
+		if signed, err = json.Marshal(&req.Signed); err != nil {
+			return model.Action{}, err
+		}
+	}
+
+	expiration := now.Add(bat.actions.Expiration(req.Type, kBulkActionsExpiration))
+	if req.Expiration != "" {
+		t, err := time.Parse(time.RFC3339, req.Expiration)
+		if err != nil {
+			return model.Action{}, fmt.Errorf("invalid expiration %q", req.Expiration)
+		}
+		if !t.After(now) {
+			return model.Action{}, fmt.Errorf("expiration %q has passed", req.Expiration)
+		}
+		expiration = t.UTC()
+	}
+
+	actionId := req.ActionId
+	if actionId == "" {
+		actionId = uuid.Must(uuid.NewV4()).String()
+	}
+
+	return model.Action{
+		ESDocument: model.ESDocument{Id: actionId},
+		ActionId:   actionId,
+		Type:       req.Type,
+		InputType:  req.InputType,
+		Agents:     req.Agents,
+		Data:       req.Data,
+		Priority:   req.Priority,
+		Signed:     signed,
+		UserId:     req.UserId,
+		Timestamp:  now.Format(time.RFC3339),
+		Expiration: expiration.Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,172 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+// actionsBulk records the actions created.
+type actionsBulk struct {
+	ftesting.MockBulk
+	mut     sync.Mutex
+	created map[string]model.Action
+}
+
+func (m *actionsBulk) Create(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) (string, error) {
+	var action model.Action
+	if err := json.Unmarshal(body, &action); err != nil {
+		return "", err
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.created[id]; ok {
+		return "", &es.ErrVersionConflict{Index: index, Id: id}
+	}
+	m.created[id] = action
+	return id, nil
+}
+
+func TestBulkActions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	sign := func(data string) ActionSignature {
+		digest := sha256.Sum256([]byte(data))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return ActionSignature{
+			Data:      base64.StdEncoding.EncodeToString([]byte(data)),
+			Signature: base64.StdEncoding.EncodeToString(sig),
+		}
+	}
+
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.ActionIngest.Enabled = true
+	cfg.ActionIngest.SignedTypes = []string{"UPGRADE"}
+	cfg.ActionIngest.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	cfg.Actions.ExpirationByType = map[string]time.Duration{"UNENROLL": time.Hour}
+
+	bulker := &actionsBulk{created: make(map[string]model.Action)}
+	bat, err := NewBulkActionsT(cfg, bulker)
+	require.NoError(t, err)
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	bat.now = func() time.Time { return now }
+	bat.authenticate = func(_ context.Context, token string) (string, error) {
+		return map[string]string{"kibana-token": "elastic/kibana", "other-token": "elastic/fleet-server"}[token], nil
+	}
+
+	post := func(token string, req BulkActionsRequest) (*httptest.ResponseRecorder, error) {
+		body, err := json.Marshal(&req)
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, ROUTE_ACTIONS_BULK, strings.NewReader(string(body)))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		return w, bat.handleBulkActions(w, r)
+	}
+
+	req := BulkActionsRequest{Actions: []BulkAction{{Type: "UNENROLL", Agents: []string{"a1"}}}}
+	_, err = post("", req)
+	assert.Equal(t, ErrServiceTokenRequired, err)
+	_, err = post("other-token", req)
+	assert.Equal(t, ErrWriterUnauthorized, err)
+	assert.Empty(t, bulker.created)
+
+	req = BulkActionsRequest{Actions: []BulkAction{
+		{Type: "UNENROLL", Agents: []string{"a1", "a2"}},
+		{Type: "UNENROLL"},
+		{Type: "UPGRADE", ActionId: "up1", Agents: []string{"a1"}},
+		{Type: "UPGRADE", ActionId: "up2", Agents: []string{"a1"}, Signed: sign(`{"action_id":"up2","type":"UPGRADE"}`)},
+		{Type: "UPGRADE", ActionId: "up3", Agents: []string{"a1"}, Signed: sign(`{"action_id":"up2","type":"UPGRADE"}`)},
+		{Type: "SETTINGS", Agents: []string{"a1"}, Expiration: "2021-05-01T11:00:00Z"},
+		{Type: "SETTINGS", Agents: []string{"a1"}, Expiration: "2021-05-03T12:00:00Z"},
+	}}
+	w, err := post("kibana-token", req)
+	require.NoError(t, err)
+
+	var resp BulkActionsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Errors)
+	require.Len(t, resp.Items, 7)
+	var statuses []int64
+	for _, item := range resp.Items {
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []int64{201, 400, 400, 201, 400, 400, 201}, statuses)
+	assert.Equal(t, "agents must not be empty", resp.Items[1].Error)
+	assert.Equal(t, "UPGRADE actions must be signed", resp.Items[2].Error)
+	assert.Contains(t, resp.Items[4].Error, "signs another action")
+
+	require.Len(t, bulker.created, 3)
+	unenroll := bulker.created[resp.Items[0].Id]
+	assert.NotEmpty(t, unenroll.ActionId)
+	assert.Equal(t, []string{"a1", "a2"}, unenroll.Agents)
+	assert.Equal(t, "2021-05-01T13:00:00Z", unenroll.Expiration)
+
+	upgrade := bulker.created[resp.Items[3].Id]
+	assert.Equal(t, "up2", upgrade.ActionId)
+	assert.Equal(t, "2021-05-02T12:00:00Z", upgrade.Expiration)
+	assert.JSONEq(t, string(mustMarshal(t, req.Actions[3].Signed)), string(upgrade.Signed))
+
+	assert.Equal(t, "2021-05-03T12:00:00Z", bulker.created[resp.Items[6].Id].Expiration)
+
+	// A retried batch does not write the actions again
+	retry := BulkActionsRequest{Actions: []BulkAction{
+		{Type: "UNENROLL", ActionId: unenroll.ActionId, Agents: []string{"a1", "a2"}},
+		{Type: "UPGRADE", ActionId: "up2", Agents: []string{"a1"}, Signed: req.Actions[3].Signed},
+	}}
+	w, err = post("kibana-token", retry)
+	require.NoError(t, err)
+	resp = BulkActionsResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Errors)
+	assert.Equal(t, unenroll.ActionId, resp.Items[0].Id)
+	assert.Equal(t, "up2", resp.Items[1].Id)
+	assert.Len(t, bulker.created, 3)
+
+	// Too many actions
+	bat.cfg.MaxActions = 2
+	_, err = post("kibana-token", req)
+	assert.EqualError(t, err, "at most 2 actions per request")
+
+	bat.cfg.Enabled = false
+	_, err = post("kibana-token", req)
+	assert.Equal(t, ErrActionIngestDisabled, err)
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
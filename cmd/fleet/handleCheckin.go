@@ -9,25 +9,32 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/action"
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/lifecycle"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 	"github.com/elastic/fleet-server/v7/internal/pkg/monitor"
 	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
 	"github.com/elastic/fleet-server/v7/internal/pkg/smap"
 	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
 
-	"github.com/hashicorp/go-version"
 	"github.com/julienschmidt/httprouter"
 	"github.com/miolini/datacounter"
 	"github.com/rs/zerolog"
@@ -70,7 +77,7 @@ func (rt Router) handleCheckin(w http.ResponseWriter, r *http.Request, ps httpro
 }
 
 type CheckinT struct {
-	verCon version.Constraints
+	ua     *userAgentRule
 	cfg    *config.Server
 	cache  cache.Cache
 	bc     *BulkCheckin
@@ -80,10 +87,24 @@ type CheckinT struct {
 	tr     *action.TokenResolver
 	bulker bulk.Bulk
 	limit  *limit.Limiter
+
+	pollLimit   *limit.Limiter
+	degraded    *degradedT
+	polls       *longPolls
+	budget      *longPollBudget
+	caches      *peerCache
+	signer      *action.AckTokenSigner
+	unenroll    *autoUnenroller
+	fence       *geofence
+	compression *compressionTuner
+	skew        *clockSkew
+	journal     *historyRecorder
+
+	actionsQuery *dl.Template
 }
 
 func NewCheckinT(
-	verCon version.Constraints,
+	ua *userAgentPolicy,
 	cfg *config.Server,
 	c cache.Cache,
 	bc *BulkCheckin,
@@ -92,16 +113,21 @@ func NewCheckinT(
 	ad *action.Dispatcher,
 	tr *action.TokenResolver,
 	bulker bulk.Bulk,
+	fence *geofence,
+	events *lifecycle.Outbox,
+	budget *longPollBudget,
+	caches *peerCache,
 ) *CheckinT {
 
 	log.Info().
 		Interface("limits", cfg.Limits.CheckinLimit).
+		Interface("poll", cfg.Limits.CheckinPollLimit).
 		Dur("long_poll_timeout", cfg.Timeouts.CheckinLongPoll).
 		Dur("long_poll_timestamp", cfg.Timeouts.CheckinTimestamp).
 		Msg("Checkin install limits")
 
 	ct := &CheckinT{
-		verCon: verCon,
+		ua:     ua.checkin,
 		cfg:    cfg,
 		cache:  c,
 		bc:     bc,
@@ -109,14 +135,29 @@ func NewCheckinT(
 		gcp:    gcp,
 		ad:     ad,
 		tr:     tr,
-		limit:  limit.NewLimiter(&cfg.Limits.CheckinLimit),
+		limit:  limit.NewGlobalLimiter("checkin", &cfg.Limits.CheckinLimit, &cfg.Limits.Global, globalCount(bulker)),
 		bulker: bulker,
+
+		pollLimit:   limit.NewLimiter(&cfg.Limits.CheckinPollLimit),
+		degraded:    newDegraded(cfg.Offline.MaxStaleness),
+		polls:       newLongPolls(),
+		budget:      budget,
+		caches:      caches,
+		signer:      action.NewAckTokenSigner(cfg.AckTokens.Secret, cfg.AckTokens.PreviousSecrets...),
+		unenroll:    newAutoUnenroller(&cfg.AutoUnenroll, bulker, events),
+		fence:       fence,
+		compression: newCompressionTuner(cfg),
+		skew:        newClockSkew(cfg),
+		journal:     newDispatchJournal(cfg),
+
+		actionsQuery: dl.PrepareAgentPendingActions(cfg.PendingActions.MaxQueued),
 	}
 
 	return ct
 }
 
 func (ct *CheckinT) _handleCheckin(w http.ResponseWriter, r *http.Request, id string, bulker bulk.Bulk) error {
+	received := time.Now()
 
 	limitF, err := ct.limit.Acquire()
 	if err != nil {
@@ -124,40 +165,65 @@ func (ct *CheckinT) _handleCheckin(w http.ResponseWriter, r *http.Request, id st
 	}
 	defer limitF()
 
-	agent, err := authAgent(r, id, ct.bulker, ct.cache)
+	releaseF, err := ct.budget.acquire(r)
+	if err != nil {
+		return err
+	}
+	defer releaseF()
+
+	agent, degraded, err := ct.authAgent(r, id)
 
 	if err != nil {
 		return err
 	}
 
-	err = validateUserAgent(r, ct.verCon)
+	err = validateUserAgent(r, ct.ua)
 	if err != nil {
 		return err
 	}
 
+	if err := ct.fence.check(r, "checkin-geofence", agent.PolicyId); err != nil {
+		return err
+	}
+
 	// Metrics; serenity now.
 	dfunc := cntCheckin.IncStart()
 	defer dfunc()
 
 	ctx := r.Context()
 
-	// Interpret request; TODO: defend overflow, slow roll
-	readCounter := datacounter.NewReaderCounter(r.Body)
+	// Interpret request; TODO: slow roll
+	body, err := newRequestBody(r, ct.cfg.Limits.CheckinLimit.MaxBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
 
 	var req CheckinRequest
-	decoder := json.NewDecoder(readCounter)
+	decoder := codec.NewDecoder(body)
 	if err := decoder.Decode(&req); err != nil {
 		return err
 	}
 
-	cntCheckin.bodyIn.Add(readCounter.Count())
+	body.count(&cntCheckin)
 
 	// Compare local_metadata content and update if different
-	fields, err := parseMeta(agent, &req)
+	fields, err := parseMeta(agent, &req, &ct.cfg.LocalMetadata)
 	if err != nil {
 		return err
 	}
 
+	// Index the component inventory when the components changed
+	fields = ct.processComponents(ctx, agent, req.Components, fields)
+
+	// Record the skew of the agent clock
+	if skew, ok := ct.skew.observe(agent.Id, req.Timestamp, agent.ClockSkew, received); ok {
+		if fields == nil {
+			fields = make(Fields)
+		}
+		fields[dl.FieldClockSkew] = clockSkewSeconds(skew)
+	}
+
 	// Resolve AckToken from request, fallback on the agent record
 	seqno, err := ct.resolveSeqNo(ctx, req, agent)
 	if err != nil {
@@ -169,20 +235,18 @@ func (ct *CheckinT) _handleCheckin(w http.ResponseWriter, r *http.Request, id st
 	defer ct.ad.Unsubscribe(aSub)
 	actCh := aSub.Ch()
 
-	// Subscribe to policy manager for changes on PolicyId > policyRev
-	sub, err := ct.pm.Subscribe(agent.Id, agent.PolicyId, agent.PolicyRevisionIdx, agent.PolicyCoordinatorIdx)
-	if err != nil {
-		return err
+	// Subscribe to policy manager for changes on PolicyId > policyRev; the
+	// quarantined agents receive no policy, and so no output API key
+	quarantined := isQuarantined(agent)
+	var policyCh <-chan *policy.ParsedPolicy
+	if !quarantined {
+		sub, err := ct.pm.Subscribe(agent.Id, agent.PolicyId, agent.PolicyRevisionIdx, agent.PolicyCoordinatorIdx)
+		if err != nil {
+			return err
+		}
+		defer ct.pm.Unsubscribe(sub)
+		policyCh = sub.Output()
 	}
-	defer ct.pm.Unsubscribe(sub)
-
-	// Update check-in timestamp on timeout
-	tick := time.NewTicker(ct.cfg.Timeouts.CheckinTimestamp)
-	defer tick.Stop()
-
-	// Chill out for for a bit. Long poll.
-	longPoll := time.NewTicker(ct.cfg.Timeouts.CheckinLongPoll)
-	defer longPoll.Stop()
 
 	// Intial update on checkin, and any user fields that might have changed
 	ct.bc.CheckIn(agent.Id, fields, seqno)
@@ -191,60 +255,150 @@ func (ct *CheckinT) _handleCheckin(w http.ResponseWriter, r *http.Request, id st
 	var (
 		actions  []ActionResp
 		ackToken string
+		more     bool
 	)
 
 	// Check agent pending actions first
-	pendingActions, err := ct.fetchAgentPendingActions(ctx, seqno, agent.Id)
-	if err != nil {
+	pendingActions, total, err := ct.fetchAgentPendingActions(ctx, seqno, agent.Id)
+	switch {
+	case err == nil:
+		ct.degraded.ok()
+	case es.IsUnavailable(err) && ctx.Err() == nil && ct.degraded.fail(err):
+		// Actions dispatched from now on still reach the agent through the
+		// dispatcher; the pending ones are fetched on a later checkin.
+		log.Debug().Err(err).Str("agent_id", agent.Id).Msg("Elasticsearch unavailable; skip fetching pending actions")
+		pendingActions, total, err, degraded = nil, 0, nil, true
+	default:
 		return err
 	}
+	var skipped uint64
+	if total > uint64(len(pendingActions)) {
+		skipped = total - uint64(len(pendingActions))
+		cntActionsSkipped.Add(skipped)
+		log.Warn().
+			Str("agent_id", agent.Id).
+			Uint64("skipped", skipped).
+			Int("max_queued", ct.cfg.PendingActions.MaxQueued).
+			Msg("Too many pending actions; skip the oldest but the control actions")
+	}
+	if quarantined {
+		pendingActions = quarantineActions(pendingActions)
+	}
+	pendingActions, more = ct.capActions(pendingActions)
 	actions, ackToken = convertActions(agent.Id, pendingActions)
+	sent := maxSeqNo(pendingActions, seqno.Value())
+	ackToken = ct.signAckToken(agent.Id, pendingActions, ackToken)
 
 	if len(actions) == 0 {
-	LOOP:
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case acdocs := <-actCh:
-				var acs []ActionResp
-				acs, ackToken = convertActions(agent.Id, acdocs)
-				actions = append(actions, acs...)
-				break LOOP
-			case policy := <-sub.Output():
-				actionResp, err := processPolicy(ctx, bulker, agent.Id, policy)
-				if err != nil {
-					return err
-				}
-				actions = append(actions, *actionResp)
-				break LOOP
-			case <-longPoll.C:
-				log.Trace().Msg("fire long poll")
-				break LOOP
-			case <-tick.C:
-				ct.bc.CheckIn(agent.Id, nil, seqno)
-			}
+		var acs []ActionResp
+		acs, ackToken, sent, more, err = ct.waitForActions(ctx, w, bulker, agent, seqno, quarantined, actCh, policyCh)
+		if err != nil {
+			return err
 		}
+		actions = append(actions, acs...)
 	}
 
 	resp := CheckinResponse{
-		AckToken: ackToken,
-		Action:   "checkin",
-		Actions:  actions,
+		AckToken:       ackToken,
+		Action:         "checkin",
+		Actions:        actions,
+		CacheHints:     ct.caches.hints(r),
+		Degraded:       degraded,
+		MoreActions:    more,
+		SkippedActions: int64(skipped),
+	}
+	if ct.cfg.ClockSkew.ServerTime {
+		resp.ServerTime = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
-	return ct.writeResponse(w, r, resp)
+	size, err := ct.writeResponse(w, r, resp)
+	if err == nil {
+		aSub.Sent(sent)
+		recordDispatch(ct.journal, bulker, agent.Id, &resp, size)
+	}
+	return err
+}
+
+// waitForActions long polls for the actions dispatched to the agent or a new
+// policy of the agent. A policy that is not delivered to the agent, like one
+// of another Kibana space, does not end the long poll.
+func (ct *CheckinT) waitForActions(ctx context.Context, w http.ResponseWriter, bulker bulk.Bulk, agent *model.Agent, seqno sqn.SeqNo, quarantined bool, actCh <-chan []model.Action, policyCh <-chan *policy.ParsedPolicy) ([]ActionResp, string, int64, bool, error) {
+	// Update check-in timestamp on timeout
+	tick := time.NewTicker(ct.cfg.Timeouts.CheckinTimestamp)
+	defer tick.Stop()
+
+	// Chill out for for a bit. Long poll.
+	longPoll := time.NewTicker(ct.cfg.Timeouts.CheckinLongPoll)
+	defer longPoll.Stop()
+
+	poll, done := ct.polls.add(agent.Id, agent.PolicyId)
+	defer done()
+
+	sent := seqno.Value()
+	waited := timePhase(ctx, phaseLongPoll)
+	defer func() { waited() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, "", sent, false, ctx.Err()
+		case acdocs := <-actCh:
+			if quarantined {
+				if acdocs = quarantineActions(acdocs); len(acdocs) == 0 {
+					continue
+				}
+			}
+			acdocs, more := ct.capDispatched(acdocs)
+			actions, ackToken := convertActions(agent.Id, acdocs)
+			ackToken = ct.signAckToken(agent.Id, acdocs, ackToken)
+			return actions, ackToken, maxSeqNo(acdocs, sent), more, nil
+		case policy := <-policyCh:
+			if policy == nil {
+				// Policy deleted and the agent reassigned; it gets its new policy on its next checkin
+				return nil, "", sent, false, nil
+			}
+			waited()
+			actionResp, err := processPolicy(ctx, bulker, ct.bc, agent.Id, policy)
+			if err != nil {
+				return nil, "", sent, false, err
+			}
+			if actionResp == nil {
+				// Not delivered to the agent; keep waiting
+				waited = timePhase(ctx, phaseLongPoll)
+				continue
+			}
+			return []ActionResp{*actionResp}, "", sent, false, nil
+		case <-longPoll.C:
+			log.Trace().Msg("fire long poll")
+			return nil, "", sent, false, nil
+		case <-poll.Closed():
+			// Disconnected by an operator; drop the connection so the
+			// agent may check in to another Fleet Server
+			w.Header().Set("Connection", "close")
+			return nil, "", sent, false, nil
+		case <-tick.C:
+			ct.bc.CheckIn(agent.Id, nil, seqno)
+		}
+	}
 }
 
-func (ct *CheckinT) writeResponse(w http.ResponseWriter, r *http.Request, resp CheckinResponse) error {
+// writeResponse writes the response and returns the number of bytes written.
+func (ct *CheckinT) writeResponse(w http.ResponseWriter, r *http.Request, resp CheckinResponse) (uint64, error) {
+	if ct.streams(&resp) {
+		return ct.streamResponse(w, r, resp)
+	}
 
-	payload, err := json.Marshal(&resp)
+	marshaled := timePhase(r.Context(), phaseMarshal)
+	payload, err := codec.Marshal(&resp)
+	marshaled()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	compressionLevel := ct.cfg.CompressionLevel
-	compressThreshold := ct.cfg.CompressionThresh
+	compressionLevel, compressThreshold := ct.compression.settings()
+	ct.compression.observe(len(payload))
+
+	var written uint64
 
 	if len(payload) > compressThreshold && compressionLevel != flate.NoCompression && acceptsEncoding(r, kEncodingGzip) {
 
@@ -252,18 +406,19 @@ func (ct *CheckinT) writeResponse(w http.ResponseWriter, r *http.Request, resp C
 
 		zipper, err := gzip.NewWriterLevel(wrCounter, compressionLevel)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		w.Header().Set("Content-Encoding", kEncodingGzip)
 
 		if _, err = zipper.Write(payload); err != nil {
-			return err
+			return wrCounter.Count(), err
 		}
 
 		err = zipper.Close()
 
-		cntCheckin.bodyOut.Add(wrCounter.Count())
+		written = wrCounter.Count()
+		cntCheckin.bodyOut.Add(written)
 
 		log.Trace().
 			Err(err).
@@ -274,10 +429,11 @@ func (ct *CheckinT) writeResponse(w http.ResponseWriter, r *http.Request, resp C
 	} else {
 		var nWritten int
 		nWritten, err = w.Write(payload)
-		cntCheckin.bodyOut.Add(uint64(nWritten))
+		written = uint64(nWritten)
+		cntCheckin.bodyOut.Add(written)
 	}
 
-	return err
+	return written, err
 }
 
 func acceptsEncoding(r *http.Request, encoding string) bool {
@@ -289,17 +445,66 @@ func acceptsEncoding(r *http.Request, encoding string) bool {
 	return false
 }
 
+// authAgent authenticates the agent and remembers its record. While
+// Elasticsearch is unavailable an agent authenticated within the offline grace
+// period is served from the remembered record in degraded mode instead of
+// failing its checkin. Agents failing to authenticate repeatedly may be
+// unenrolled.
+func (ct *CheckinT) authAgent(r *http.Request, id string) (agent *model.Agent, degraded bool, err error) {
+	agent, err = authAgent(r, id, ct.bulker, ct.cache)
+	ct.unenroll.observe(r, err)
+	grace := ct.cfg.Offline.GracePeriod
+	if grace <= 0 {
+		return agent, false, err
+	}
+
+	key, kerr := apikey.ExtractAPIKey(r)
+	if kerr != nil {
+		return agent, false, err
+	}
+
+	if err == nil {
+		ct.cache.SetAgent(*key, *agent, grace)
+		return agent, false, nil
+	}
+	if !es.IsUnavailable(err) || !ct.degraded.fail(err) {
+		return nil, false, err
+	}
+
+	cached, ok := ct.cache.GetAgent(*key)
+	if !ok {
+		return nil, false, err
+	}
+
+	cntCheckinOffline.Inc()
+	log.Debug().
+		Err(err).
+		Str("agent_id", cached.Id).
+		Msg("Elasticsearch unavailable; serve checkin from last known agent record")
+	return &cached, true, nil
+}
+
 // Resolve AckToken from request, fallback on the agent record
 func (ct *CheckinT) resolveSeqNo(ctx context.Context, req CheckinRequest, agent *model.Agent) (seqno sqn.SeqNo, err error) {
 	// Resolve AckToken from request, fallback on the agent record
 	ackToken := req.AckToken
 	seqno = agent.ActionSeqNo
 
+	if action.IsSignedAckToken(ackToken) && ct.signer != nil {
+		return ct.verifyAckToken(agent, ackToken)
+	}
+	if action.IsSignedAckToken(ackToken) {
+		// Signing was turned off since the token was issued
+		log.Debug().Str("agent_id", agent.Id).Msg("signed ack token not verified; resume from the agent record")
+		return seqno, nil
+	}
+
 	if ct.tr != nil && ackToken != "" {
 		var sn int64
 		sn, err = ct.tr.Resolve(ctx, ackToken)
 		if err != nil {
 			if errors.Is(err, dl.ErrNotFound) {
+				cntAckTokenNotFound.Inc()
 				log.Debug().Str("token", ackToken).Str("agent_id", agent.Id).Msg("revision token not found")
 				err = nil
 			} else {
@@ -311,15 +516,103 @@ func (ct *CheckinT) resolveSeqNo(ctx context.Context, req CheckinRequest, agent
 	return seqno, nil
 }
 
-func (ct *CheckinT) fetchAgentPendingActions(ctx context.Context, seqno sqn.SeqNo, agentId string) ([]model.Action, error) {
+// verifyAckToken returns the sequence number of the signed token. A token
+// older than the one of the last checkin of the agent is stale, as replayed by
+// an agent restored from a snapshot, and refused like a forged one; the agent
+// re-syncs by checking in without a token.
+func (ct *CheckinT) verifyAckToken(agent *model.Agent, token string) (sqn.SeqNo, error) {
+	sn, err := ct.signer.Verify(agent.Id, token)
+	if err != nil {
+		cntAckTokenInvalid.Inc()
+		return nil, err
+	}
+	if recorded := sqn.SeqNo(agent.ActionSeqNo).Value(); sn < recorded {
+		cntAckTokenStale.Inc()
+		log.Info().
+			Str("agent_id", agent.Id).
+			Int64("seqno", sn).
+			Int64("recorded", recorded).
+			Msg("stale ack token")
+		return nil, action.ErrInvalidAckToken
+	}
+	return []int64{sn}, nil
+}
+
+// maxSeqNo returns the highest seqno of the actions, or seqNo if higher.
+func maxSeqNo(actions []model.Action, seqNo int64) int64 {
+	for _, a := range actions {
+		if a.SeqNo > seqNo {
+			seqNo = a.SeqNo
+		}
+	}
+	return seqNo
+}
+
+// signAckToken replaces the action ID token of the actions by a signed one
+// when signing is enabled.
+func (ct *CheckinT) signAckToken(agentId string, actions []model.Action, token string) string {
+	if ct.signer == nil || len(actions) == 0 {
+		return token
+	}
+	return ct.signer.Sign(agentId, maxSeqNo(actions[1:], actions[0].SeqNo))
+}
+
+// capActions returns the first actions that fit in a checkin in delivery
+// order, and whether some were held back for the next checkins. The actions
+// held back are the newest so the ack token covers all those delivered.
+func (ct *CheckinT) capActions(actions []model.Action) ([]model.Action, bool) {
+	max := ct.cfg.PendingActions.MaxPerCheckin
+	if max <= 0 || len(actions) <= max {
+		action.SortByPriority(actions)
+		return actions, false
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].SeqNo < actions[j].SeqNo
+	})
+	cntActionsDeferred.Add(uint64(len(actions) - max))
+	actions = actions[:max]
+	action.SortByPriority(actions)
+	return actions, true
+}
+
+// capDispatched is capActions for the actions of the dispatcher. They are
+// already in delivery order and shared with the other agents, so they are
+// only copied when some must be held back.
+func (ct *CheckinT) capDispatched(actions []model.Action) ([]model.Action, bool) {
+	max := ct.cfg.PendingActions.MaxPerCheckin
+	if max <= 0 || len(actions) <= max {
+		return actions, false
+	}
+	return ct.capActions(append([]model.Action(nil), actions...))
+}
+
+// fetchAgentPendingActions returns the newest pending actions of the agent, up
+// to the queue size, along with the older control actions, never skipped, and
+// the number of actions pending.
+func (ct *CheckinT) fetchAgentPendingActions(ctx context.Context, seqno sqn.SeqNo, agentId string) ([]model.Action, uint64, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	return dl.FindActions(ctx, ct.bulker, dl.QueryAgentActions, map[string]interface{}{
+	actions, total, err := dl.FindAgentPendingActions(ctx, ct.bulker, ct.actionsQuery, map[string]interface{}{
 		dl.FieldSeqNo:      seqno.Value(),
 		dl.FieldMaxSeqNo:   ct.gcp.GetCheckpoint().Value(),
 		dl.FieldExpiration: now,
 		dl.FieldAgents:     []string{agentId},
 	})
+	if err != nil || total <= uint64(len(actions)) || len(actions) == 0 {
+		return actions, total, err
+	}
+
+	control, err := dl.FindAgentControlActions(ctx, ct.bulker, map[string]interface{}{
+		dl.FieldSeqNo:      seqno.Value(),
+		dl.FieldMaxSeqNo:   actions[0].SeqNo - 1,
+		dl.FieldExpiration: now,
+		dl.FieldAgents:     []string{agentId},
+		dl.FieldType:       action.ControlTypes(),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(control, actions...), total, nil
 }
 
 func convertActions(agentId string, actions []model.Action) ([]ActionResp, string) {
@@ -335,21 +628,29 @@ func convertActions(agentId string, actions []model.Action) ([]ActionResp, strin
 			Id:        action.ActionId,
 			Type:      action.Type,
 			InputType: action.InputType,
+			Signed:    action.Signed,
 		})
 	}
 
-	if sz > 0 {
-		ackToken = actions[sz-1].Id
+	// Actions are in delivery order; the token is the newest one
+	var seqNo int64
+	for _, a := range actions {
+		if ackToken == "" || a.SeqNo > seqNo {
+			ackToken = a.Id
+			seqNo = a.SeqNo
+		}
 	}
 
 	return respList, ackToken
 }
 
 // A new policy exists for this agent.  Perform the following:
+//  - Skip the policy, returning no action, if it is of another Kibana space.
 //  - Generate and update default ApiKey if roles have changed.
 //  - Rewrite the policy for delivery to the agent injecting the key material.
+//  - Record the policy dispatched with the checkin of the agent.
 //
-func processPolicy(ctx context.Context, bulker bulk.Bulk, agentId string, pp *policy.ParsedPolicy) (*ActionResp, error) {
+func processPolicy(ctx context.Context, bulker bulk.Bulk, bc *BulkCheckin, agentId string, pp *policy.ParsedPolicy) (*ActionResp, error) {
 
 	zlog := log.With().
 		Str("ctx", "processPolicy").
@@ -371,6 +672,15 @@ func processPolicy(ctx context.Context, bulker bulk.Bulk, agentId string, pp *po
 		return nil, err
 	}
 
+	// Never hand out the policy of another Kibana space
+	if !model.SameSpace(agent.Namespaces, pp.Policy.Namespaces) {
+		zlog.Warn().
+			Strs("namespaces", model.Spaces(agent.Namespaces)).
+			Strs("policy_namespaces", model.Spaces(pp.Policy.Namespaces)).
+			Msg("policy is not in the spaces of the agent; not delivered")
+		return nil, nil
+	}
+
 	// Determine whether we need to generate a default output ApiKey.
 	// This is accomplished by comparing the sha2 hash stored in the agent
 	// record with the precalculated sha2 hash of the role.
@@ -386,13 +696,14 @@ func processPolicy(ctx context.Context, bulker bulk.Bulk, agentId string, pp *po
 	}
 
 	if needKey {
-		zlog.Debug().
-			RawJSON("roles", defaultRole.Raw).
-			Str("oldHash", agent.PolicyOutputPermissionsHash).
-			Str("newHash", defaultRole.Sha2).
-			Msg("Generating a new API key")
+		if e := zlog.Debug(); e.Enabled() {
+			e.RawJSON("roles", redact.JSON(defaultRole.Raw)).
+				Str("oldHash", agent.PolicyOutputPermissionsHash).
+				Str("newHash", defaultRole.Sha2).
+				Msg("Generating a new API key")
+		}
 
-		defaultOutputApiKey, err := generateOutputApiKey(ctx, bulker.Client(), agent.Id, policy.DefaultOutputName, defaultRole.Raw)
+		defaultOutputApiKey, err := generateOutputApiKey(ctx, bulker.Client(), agent.Id, policy.DefaultOutputName, defaultRole.Raw, agent.Namespaces)
 		if err != nil {
 			zlog.Error().Err(err).Msg("fail generate output key")
 			return nil, err
@@ -423,32 +734,91 @@ func processPolicy(ctx context.Context, bulker bulk.Bulk, agentId string, pp *po
 		agent.DefaultApiKey = defaultOutputApiKey.Agent()
 	}
 
-	rewrittenPolicy, err := rewritePolicy(pp, agent.DefaultApiKey)
+	r := policy.RevisionFromPolicy(pp.Policy)
+	key := policy.CompileKey{
+		Revision:   r,
+		Platform:   policy.PlatformFromMetadata(agent.LocalMetadata),
+		OutputHash: defaultRole.Sha2,
+	}
+
+	rewrittenPolicy, err := renderPolicy(pp, key, agent.DefaultApiKey)
 	if err != nil {
 		zlog.Error().Err(err).Msg("fail rewrite policy")
 		return nil, err
 	}
 
-	r := policy.RevisionFromPolicy(pp.Policy)
+	// The data is sent as marshaled here so the agent can hash what it got
+	data, err := json.Marshal(rewrittenPolicy)
+	if err != nil {
+		return nil, err
+	}
+	dispatched := model.PolicyDispatched{
+		ActionId: r.String(),
+		Hash:     policyHash(data),
+		Attempts: 1,
+	}
+	if prev := agent.PolicyDispatched; prev != nil && prev.ActionId == dispatched.ActionId && prev.Hash == dispatched.Hash {
+		dispatched.Attempts = prev.Attempts + 1
+	}
+
+	// Recorded for the ack to be verified against, written with the
+	// checkins; an ack before the flush is not verified
+	bc.CheckIn(agent.Id, Fields{dl.FieldPolicyDispatched: dispatched}, nil)
+
 	resp := ActionResp{
 		AgentId:   agent.Id,
 		CreatedAt: pp.Policy.Timestamp,
-		Data:      rewrittenPolicy,
-		Id:        r.String(),
+		Data:      json.RawMessage(data),
+		DataHash:  dispatched.Hash,
+		Id:        dispatched.ActionId,
 		Type:      TypePolicyChange,
 	}
 
 	return &resp, nil
 }
 
+// policyHash returns the hex SHA-256 of the JSON of a policy dispatched.
+func policyHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// renderPolicy returns the policy of the agent from the compiled policy of its
+// revision, platform and output permissions, so the policy is rendered once
+// for all of their agents rather than once per agent. A policy that cannot be
+// compiled is rendered for the agent.
+func renderPolicy(pp *policy.ParsedPolicy, key policy.CompileKey, apiKey string) (interface{}, error) {
+	compiled, err := pp.CompiledFor(key, func() ([]byte, error) {
+		cntPolicyCompiled.Inc()
+		data, err := rewritePolicy(pp, key.Platform, policy.ApiKeyPlaceholder)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(data)
+	})
+	if errors.Is(err, policy.ErrNotCompilable) {
+		return rewritePolicy(pp, key.Platform, apiKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Render(apiKey)
+}
+
 // Return Serializable policy injecting the apikey into the output field.
 // This avoids reallocation of each section of the policy by duping
 // the map object and only replacing the targeted section.
-func rewritePolicy(pp *policy.ParsedPolicy, apiKey string) (interface{}, error) {
+func rewritePolicy(pp *policy.ParsedPolicy, platform policy.Platform, apiKey string) (interface{}, error) {
+
+	// Substitute the variables of the agent platform
+	ppFields, err := pp.FieldsFor(platform)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse the outputs maps in order to inject the api key
 	const outputsProperty = "outputs"
-	outputs, err := smap.Parse(pp.Fields[outputsProperty])
+	outputs, err := smap.Parse(ppFields[outputsProperty])
 	if err != nil {
 		return nil, err
 	}
@@ -467,9 +837,9 @@ func rewritePolicy(pp *policy.ParsedPolicy, apiKey string) (interface{}, error)
 	}
 
 	// Dupe field map; pp is immutable
-	fields := make(map[string]json.RawMessage, len(pp.Fields))
+	fields := make(map[string]json.RawMessage, len(ppFields))
 
-	for k, v := range pp.Fields {
+	for k, v := range ppFields {
 		fields[k] = v
 	}
 
@@ -511,19 +881,70 @@ func findAgentByApiKeyId(ctx context.Context, bulker bulk.Bulk, id string) (*mod
 	return &agent, err
 }
 
-// parseMeta compares the agent and the request local_metadata content
-// and returns fields to update the agent record or nil
-func parseMeta(agent *model.Agent, req *CheckinRequest) (fields Fields, err error) {
+// processComponents indexes the inventory of the components reported by the
+// agent when it differs from the last one indexed, and returns the fields to
+// update the agent record with: the components as reported when they changed,
+// in a field that is not indexed, and their summary with the inventory. Failing
+// to index the inventory does not fail the checkin; it is indexed on a later
+// checkin.
+func (ct *CheckinT) processComponents(ctx context.Context, agent *model.Agent, comps []CheckinComponent, fields Fields) Fields {
+	if comps == nil {
+		return fields
+	}
+	comps = sortComponents(comps)
+
+	if raw, err := json.Marshal(comps); err != nil {
+		log.Warn().Err(err).Str("agent_id", agent.Id).Msg("fail encode components")
+	} else if !bytes.Equal(raw, agent.Components) {
+		if fields == nil {
+			fields = make(Fields)
+		}
+		fields[dl.FieldComponents] = json.RawMessage(raw)
+	}
+
+	hash, docs := componentsInventory(agent, comps, time.Now().UTC().Format(time.RFC3339))
+	if hash == agent.ComponentsHash {
+		return fields
+	}
+
+	if err := dl.CreateAgentComponents(ctx, ct.bulker, docs); err != nil {
+		log.Warn().Err(err).Str("agent_id", agent.Id).Int("components", len(docs)).Msg("fail index component inventory")
+		return fields
+	}
+
+	if fields == nil {
+		fields = make(Fields)
+	}
+	fields[dl.FieldComponentsHash] = hash
+	fields[dl.FieldComponentsSummary] = componentsSummary(docs)
+	return fields
+}
+
+// parseMeta compares the agent and the request local_metadata content, once
+// truncated to the limits, and returns fields to update the agent record or nil
+func parseMeta(agent *model.Agent, req *CheckinRequest, cfg *config.LocalMetadata) (fields Fields, err error) {
 	// Quick comparison first
 	if bytes.Equal(req.LocalMeta, agent.LocalMetadata) {
 		log.Trace().Msg("quick comparing local metadata is equal")
 		return nil, nil
 	}
 
+	localMeta, truncated, err := truncateLocalMeta(req.LocalMeta, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		log.Warn().
+			Str("agentId", agent.Id).
+			Int("size", len(req.LocalMeta)).
+			Int("truncatedSize", len(localMeta)).
+			Msg("Local metadata exceeds the limits; truncated")
+	}
+
 	// Compare local_metadata content and update if different
 	var reqLocalMeta Fields
 	var agentLocalMeta Fields
-	err = json.Unmarshal(req.LocalMeta, &reqLocalMeta)
+	err = json.Unmarshal(localMeta, &reqLocalMeta)
 	if err != nil {
 		return nil, err
 	}
@@ -533,11 +954,19 @@ func parseMeta(agent *model.Agent, req *CheckinRequest) (fields Fields, err erro
 	}
 
 	if reqLocalMeta != nil && !reflect.DeepEqual(reqLocalMeta, agentLocalMeta) {
-		log.Trace().RawJSON("oldLocalMeta", agent.LocalMetadata).RawJSON("newLocalMeta", req.LocalMeta).Msg("local metadata not equal")
-		log.Info().RawJSON("req.LocalMeta", req.LocalMeta).Msg("applying new local metadata")
+		if e := log.Trace(); e.Enabled() {
+			e.RawJSON("oldLocalMeta", redact.JSON(agent.LocalMetadata)).RawJSON("newLocalMeta", redact.JSON(req.LocalMeta)).Msg("local metadata not equal")
+		}
+		log.Info().RawJSON("req.LocalMeta", redact.JSON(localMeta)).Msg("applying new local metadata")
 		fields = map[string]interface{}{
-			FieldLocalMetadata: req.LocalMeta,
+			FieldLocalMetadata: localMeta,
+		}
+	}
+	if reqLocalMeta != nil && truncated != agent.LocalMetadataTruncated {
+		if fields == nil {
+			fields = make(Fields)
 		}
+		fields[FieldLocalMetadataTruncated] = truncated
 	}
 	return fields, nil
 }
@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// How long the agent record found by a poll is reused by the next polls.
+const kCheckinPollAgentTTL = time.Minute
+
+func (rt Router) handleCheckinPoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+	err := rt.ct.handleCheckinPoll(w, r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntCheckinPoll.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("id", id).
+			Int("code", code).
+			Msg("fail checkin poll")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+// handleCheckinPoll tells the agent whether a checkin would return new
+// actions or a new policy, from the action dispatcher and policy monitor, and
+// without writing the agent record. When it cannot be ruled out the agent is
+// told to check in.
+func (ct *CheckinT) handleCheckinPoll(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := ct.pollLimit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	agent, err := ct.pollAgent(r, id)
+	if err != nil {
+		return err
+	}
+
+	err = validateUserAgent(r, ct.ua)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntCheckinPoll.IncStart()
+	defer dfunc()
+
+	query := r.URL.Query()
+
+	seqno, err := ct.resolveSeqNo(r.Context(), CheckinRequest{AckToken: query.Get("ack_token")}, agent)
+	if err != nil {
+		return err
+	}
+
+	resp := CheckinPollResponse{
+		Actions: ct.actionsPending(agent.Id, seqno.Value()),
+		Policy:  !isQuarantined(agent) && ct.policyChanged(agent, query.Get("policy_revision")),
+	}
+
+	if !resp.Actions && !resp.Policy {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	n, err := w.Write(data)
+	cntCheckinPoll.bodyOut.Add(uint64(n))
+	return err
+}
+
+// pollAgent authenticates the agent and returns its record, reusing the one
+// found by a recent poll of the same agent.
+func (ct *CheckinT) pollAgent(r *http.Request, id string) (*model.Agent, error) {
+	key, err := authApiKey(r, ct.bulker.Client(), ct.cache)
+	if err != nil {
+		return nil, err
+	}
+	// The agent of the key must be the one polled; authAgent fails otherwise
+	if agent, ok := ct.cache.GetAgent(*key); ok && agent.Id == id {
+		return &agent, nil
+	}
+
+	agent, err := authAgent(r, id, ct.bulker, ct.cache)
+	if err != nil {
+		return nil, err
+	}
+	ct.cache.SetAgent(*key, *agent, kCheckinPollAgentTTL)
+	return agent, nil
+}
+
+func (ct *CheckinT) actionsPending(agentId string, seqno int64) bool {
+	if ct.ad == nil {
+		return true
+	}
+	pending, known := ct.ad.Pending(agentId, seqno)
+	return pending || !known
+}
+
+// policyChanged tells whether the policy of the agent has a revision newer
+// than the one it runs, given by its action ID or else the acknowledged one.
+func (ct *CheckinT) policyChanged(agent *model.Agent, revision string) bool {
+	rev, ok := policy.RevisionFromString(revision)
+	if !ok {
+		rev = policy.Revision{
+			PolicyId:       agent.PolicyId,
+			RevisionIdx:    agent.PolicyRevisionIdx,
+			CoordinatorIdx: agent.PolicyCoordinatorIdx,
+		}
+	}
+	if rev.PolicyId != agent.PolicyId {
+		return true
+	}
+
+	latest, ok := ct.pm.LatestRevision(agent.PolicyId)
+	if !ok {
+		return true
+	}
+	return latest.RevisionIdx > rev.RevisionIdx ||
+		(latest.RevisionIdx == rev.RevisionIdx && latest.CoordinatorIdx > rev.CoordinatorIdx)
+}
@@ -0,0 +1,91 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPolicyMonitor struct {
+	policy.Monitor
+	latest map[string]policy.Revision
+	subs   map[string]int
+}
+
+func (m *mockPolicyMonitor) Subscriptions() map[string]int {
+	return m.subs
+}
+
+func (m *mockPolicyMonitor) LatestRevision(policyId string) (policy.Revision, bool) {
+	rev, ok := m.latest[policyId]
+	return rev, ok
+}
+
+func TestCheckinPollPolicyChanged(t *testing.T) {
+	ct := &CheckinT{pm: &mockPolicyMonitor{latest: map[string]policy.Revision{
+		"p1": {PolicyId: "p1", RevisionIdx: 3, CoordinatorIdx: 1},
+	}}}
+	agent := &model.Agent{PolicyId: "p1", PolicyRevisionIdx: 2, PolicyCoordinatorIdx: 1}
+
+	tests := []struct {
+		name     string
+		agent    *model.Agent
+		revision string
+		changed  bool
+	}{
+		{"acknowledged older revision", agent, "", true},
+		{"running latest revision", agent, "policy:p1:3:1", false},
+		{"running older coordinator", agent, "policy:p1:3:0", true},
+		{"running other policy", agent, "policy:p0:9:1", true},
+		{"unknown policy", &model.Agent{PolicyId: "p2"}, "policy:p2:1:1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if changed := ct.policyChanged(tt.agent, tt.revision); changed != tt.changed {
+				t.Errorf("policyChanged = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestCheckinWaitSkipsPolicyOfOtherSpace(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.Timeouts.CheckinTimestamp = time.Minute
+	cfg.Timeouts.CheckinLongPoll = time.Minute
+	agent := model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}, PolicyId: "p1", Namespaces: []string{"space-a"}}
+	ct := &CheckinT{cfg: cfg, polls: newLongPolls()}
+	bulker := &keyAgentBulk{agent: agent}
+
+	actCh := make(chan []model.Action)
+	policyCh := make(chan *policy.ParsedPolicy)
+	go func() {
+		policyCh <- &policy.ParsedPolicy{
+			Policy: model.Policy{PolicyId: "p1", Namespaces: []string{"space-b"}},
+			Roles:  policy.RoleMapT{policy.DefaultOutputName: {}},
+		}
+		select {
+		case actCh <- []model.Action{{ActionId: "action-1"}}:
+		case <-time.After(5 * time.Second):
+		}
+	}()
+
+	actions, _, _, _, err := ct.waitForActions(context.Background(), httptest.NewRecorder(), bulker, &agent, sqn.SeqNo{0}, false, actCh, policyCh)
+	require.NoError(t, err)
+	require.Len(t, actions, 1, "the policy of another space does not end the long poll")
+	assert.Equal(t, "action-1", actions[0].Id)
+}
@@ -5,9 +5,20 @@
 package fleet
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/monitor/mock"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -33,3 +44,121 @@ func TestConvertActions(t *testing.T) {
 	})
 	assert.Equal(t, token, "")
 }
+
+func TestCapActions(t *testing.T) {
+	ct := &CheckinT{cfg: &config.Server{}}
+	ct.cfg.PendingActions.MaxPerCheckin = 2
+
+	actions := []model.Action{
+		{ESDocument: model.ESDocument{SeqNo: 3}},
+		{ESDocument: model.ESDocument{SeqNo: 1}},
+	}
+	capped, more := ct.capActions(actions)
+	assert.False(t, more)
+	assert.Len(t, capped, 2)
+
+	actions = append(actions, model.Action{ESDocument: model.ESDocument{SeqNo: 2}})
+	capped, more = ct.capActions(actions)
+	assert.True(t, more)
+	assert.Equal(t, []model.Action{
+		{ESDocument: model.ESDocument{SeqNo: 1}},
+		{ESDocument: model.ESDocument{SeqNo: 2}},
+	}, capped)
+}
+
+func TestConvertActionsPriorityToken(t *testing.T) {
+	ct := &CheckinT{cfg: &config.Server{}}
+
+	actions := []model.Action{
+		{ESDocument: model.ESDocument{Id: "settings", SeqNo: 1}, ActionId: "settings", Type: "SETTINGS"},
+		{ESDocument: model.ESDocument{Id: "unenroll", SeqNo: 2}, ActionId: "unenroll", Type: TypeUnenroll},
+		{ESDocument: model.ESDocument{Id: "diagnostics", SeqNo: 3}, ActionId: "diagnostics", Type: TypeDiagnostics},
+	}
+	capped, _ := ct.capActions(actions)
+	resp, token := convertActions("agent-id", capped)
+
+	// Delivered by priority, acknowledged up to the newest
+	assert.Equal(t, "unenroll", resp[0].Id)
+	assert.Equal(t, "settings", resp[1].Id)
+	assert.Equal(t, "diagnostics", token)
+}
+
+func TestRenderPolicy(t *testing.T) {
+	pp, err := policy.NewParsedPolicy(model.Policy{
+		PolicyId:    "policy",
+		RevisionIdx: 2,
+		Data: json.RawMessage(`{
+			"outputs": {"default": {"type": "elasticsearch", "hosts": ["${platform.host}"]}},
+			"platform_vars": {"default": {"host": "es:9200"}, "windows": {"host": "es-win:9200"}}
+		}`),
+	})
+	require.NoError(t, err)
+
+	for _, p := range []policy.Platform{{OS: "linux"}, {OS: "windows"}} {
+		key := policy.CompileKey{
+			Revision:   policy.RevisionFromPolicy(pp.Policy),
+			Platform:   p,
+			OutputHash: "hash",
+		}
+		for _, apiKey := range []string{"id:key1", "id:key2"} {
+			want, err := rewritePolicy(pp, p, apiKey)
+			require.NoError(t, err)
+			wantRaw, err := json.Marshal(want)
+			require.NoError(t, err)
+
+			got, err := renderPolicy(pp, key, apiKey)
+			require.NoError(t, err)
+			gotRaw, err := json.Marshal(got)
+			require.NoError(t, err)
+
+			assert.JSONEq(t, string(wantRaw), string(gotRaw))
+		}
+	}
+}
+
+// pendingBulk returns the newest pending actions, and the control ones when
+// searched by type.
+type pendingBulk struct {
+	ftesting.MockBulk
+	newest  []es.HitT
+	total   uint64
+	control []es.HitT
+}
+
+func (m pendingBulk) Search(ctx context.Context, index []string, body []byte, opts ...bulk.Opt) (*es.ResultT, error) {
+	res := &es.ResultT{}
+	if bytes.Contains(body, []byte(`"terms":{"type"`)) {
+		res.Hits = m.control
+	} else {
+		res.Hits = m.newest
+		res.Total.Value = m.total
+	}
+	return res, nil
+}
+
+func TestFetchAgentPendingActionsKeepsControl(t *testing.T) {
+	hit := func(seqNo int64, typ string) es.HitT {
+		src, err := json.Marshal(model.Action{ActionId: typ, Type: typ})
+		require.NoError(t, err)
+		return es.HitT{Id: typ, SeqNo: seqNo, Source: src}
+	}
+
+	ct := &CheckinT{
+		bulker: pendingBulk{
+			// Newest first
+			newest:  []es.HitT{hit(5, "INPUT_ACTION"), hit(4, "INPUT_ACTION")},
+			total:   4,
+			control: []es.HitT{hit(2, "UNENROLL")},
+		},
+		gcp:          mock.NewMockIndexMonitor(),
+		actionsQuery: dl.PrepareAgentPendingActions(2),
+	}
+
+	actions, total, err := ct.fetchAgentPendingActions(context.Background(), sqn.SeqNo{0}, "agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), total)
+	require.Len(t, actions, 3)
+	assert.Equal(t, "UNENROLL", actions[0].Type, "skipped control action kept")
+	assert.Equal(t, int64(4), actions[1].SeqNo)
+	assert.Equal(t, int64(5), actions[2].SeqNo)
+}
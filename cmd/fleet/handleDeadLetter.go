@@ -0,0 +1,178 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrDeadLetterStatus   = errors.New("invalid dead letter status")
+)
+
+type DeadLetterT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+}
+
+func NewDeadLetterT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *DeadLetterT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Dead letter install limits")
+
+	return &DeadLetterT{
+		bulk:  bulker,
+		cache: cache,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleDeadLetters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.dlt.handleDeadLetters(w, r)
+
+	if err != nil {
+		rt.dlt.writeError(w, err, "Fail dead letter list")
+	}
+}
+
+func (rt Router) handleDeadLetterRetry(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.dlt.handleDeadLetterRetry(w, r, id)
+
+	if err != nil {
+		rt.dlt.writeError(w, err, "Fail dead letter retry")
+	}
+}
+
+func (dlt *DeadLetterT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntDeadLetter.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (dlt *DeadLetterT) handleDeadLetters(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := dlt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, dlt.bulk, dlt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntDeadLetter.IncStart()
+	defer dfunc()
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = model.DeadLetterStatusPending
+	case model.DeadLetterStatusPending, model.DeadLetterStatusRetried:
+	default:
+		return ErrDeadLetterStatus
+	}
+
+	docs, err := dl.FindDeadLetters(r.Context(), dlt.bulk, status)
+	if err != nil {
+		return err
+	}
+
+	resp := DeadLetterList{
+		Items: make([]DeadLetter, len(docs)),
+	}
+	for i, doc := range docs {
+		resp.Items[i] = makeDeadLetter(doc)
+	}
+
+	return dlt.writeResponse(w, &resp)
+}
+
+// handleDeadLetterRetry writes the dead-lettered document back to the index it
+// was read from so it goes through the monitors again.
+func (dlt *DeadLetterT) handleDeadLetterRetry(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := dlt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, dlt.bulk, dlt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntDeadLetter.IncStart()
+	defer dfunc()
+
+	doc, err := dl.RetryDeadLetter(r.Context(), dlt.bulk, id)
+	if err != nil {
+		if err == dl.ErrNotFound {
+			err = ErrDeadLetterNotFound
+		}
+		return err
+	}
+
+	log.Info().
+		Str("id", id).
+		Str("index", doc.Index).
+		Str("docId", doc.DocId).
+		Msg("Dead letter retried")
+
+	resp := makeDeadLetter(doc)
+
+	return dlt.writeResponse(w, &resp)
+}
+
+func (dlt *DeadLetterT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntDeadLetter.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+func makeDeadLetter(doc model.DeadLetter) DeadLetter {
+	return DeadLetter{
+		Id:        doc.Id,
+		Index:     doc.Index,
+		DocId:     doc.DocId,
+		SeqNo:     doc.SeqNo,
+		Error:     doc.Error,
+		Status:    doc.Status,
+		Timestamp: doc.Timestamp,
+		RetriedAt: doc.RetriedAt,
+		Source:    doc.Source,
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/miolini/datacounter"
+	"github.com/rs/zerolog/log"
+)
+
+type DebugCaptureT struct {
+	limit   *limit.Limiter
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	capture *debugCapture
+}
+
+func NewDebugCaptureT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, capture *debugCapture) *DebugCaptureT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Debug capture install limits")
+
+	return &DebugCaptureT{
+		bulk:    bulker,
+		cache:   cache,
+		capture: capture,
+		limit:   limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+// track captures the request when its agent is captured.
+func (dct *DebugCaptureT) track(endpoint string, w http.ResponseWriter, r *http.Request, ps httprouter.Params) (http.ResponseWriter, *http.Request, func()) {
+	if dct == nil {
+		return w, r, func() {}
+	}
+	return dct.capture.track(endpoint, w, r, ps)
+}
+
+func (rt Router) handleEnableDebugCapture(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.dct.handleEnable(w, r, id)
+
+	if err != nil {
+		rt.dct.writeError(w, err, "Fail enable debug capture")
+	}
+}
+
+func (rt Router) handleDisableDebugCapture(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.dct.handleDisable(w, r, id)
+
+	if err != nil {
+		rt.dct.writeError(w, err, "Fail disable debug capture")
+	}
+}
+
+func (dct *DebugCaptureT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntDebugCapture.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (dct *DebugCaptureT) handleEnable(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := dct.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, dct.bulk, dct.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntDebugCapture.IncStart()
+	defer dfunc()
+
+	readCounter := datacounter.NewReaderCounter(r.Body)
+
+	var req DebugCaptureRequest
+	if err := json.NewDecoder(readCounter).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	cntDebugCapture.bodyIn.Add(readCounter.Count())
+
+	// Captures only the agents known, so a typo does not go unnoticed
+	_, err = dl.FindAgent(r.Context(), dct.bulk, dl.QueryAgentByID, dl.FieldId, id)
+	if errors.Is(err, dl.ErrNotFound) {
+		return ErrAgentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	expiresAt, err := dct.capture.enable(id, time.Duration(req.Ttl)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	auditLog("agent-debug-capture", "success").
+		Str("agent_id", id).
+		Time("expires_at", expiresAt).
+		Str("operator", key.Id).
+		Msg("Debug capture of agent enabled")
+
+	resp := DebugCapture{
+		AgentId:   id,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	}
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntDebugCapture.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+func (dct *DebugCaptureT) handleDisable(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := dct.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, dct.bulk, dct.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntDebugCapture.IncStart()
+	defer dfunc()
+
+	if !dct.capture.disable(id) {
+		return ErrCaptureNotFound
+	}
+
+	auditLog("agent-debug-capture", "success").
+		Str("agent_id", id).
+		Str("operator", key.Id).
+		Msg("Debug capture of agent disabled")
+
+	return nil
+}
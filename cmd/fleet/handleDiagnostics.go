@@ -0,0 +1,344 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	kDiagnosticsExpiration = time.Hour
+	kDiagnosticsBatchSize  = 1000
+
+	DiagnosticsInProgress = "IN_PROGRESS"
+	DiagnosticsComplete   = "COMPLETE"
+	DiagnosticsExpired    = "EXPIRED"
+
+	DiagnosticsAgentPending  = "PENDING"
+	DiagnosticsAgentUploaded = "UPLOADED"
+	DiagnosticsAgentFailed   = "FAILED"
+	DiagnosticsAgentExpired  = "EXPIRED"
+)
+
+var (
+	ErrDiagnosticsNotFound = errors.New("diagnostics action not found")
+	ErrDiagnosticsNoAgents = errors.New("no active agents match the filter")
+	ErrDiagnosticsNoUpload = errors.New("agent completed the action without uploading a bundle")
+)
+
+type DiagnosticsT struct {
+	limit   *limit.Limiter
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	actions *config.Actions
+}
+
+func NewDiagnosticsT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *DiagnosticsT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Diagnostics install limits")
+
+	return &DiagnosticsT{
+		bulk:    bulker,
+		cache:   cache,
+		actions: &cfg.Actions,
+		limit:   limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleDiagnostics(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.dt.handleDiagnostics(w, r)
+
+	if err != nil {
+		rt.dt.writeError(w, err, "Fail diagnostics request")
+	}
+}
+
+func (rt Router) handleDiagnosticsStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.dt.handleDiagnosticsStatus(w, r, id)
+
+	if err != nil {
+		rt.dt.writeError(w, err, "Fail diagnostics status")
+	}
+}
+
+func (dt *DiagnosticsT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntDiagnostics.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+// handleDiagnostics dispatches a DIAGNOSTICS action to the active agents
+// matching the filter of the request, one action document per batch of agents.
+func (dt *DiagnosticsT) handleDiagnostics(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := dt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, dt.bulk, dt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntDiagnostics.IncStart()
+	defer dfunc()
+
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	cntDiagnostics.bodyIn.Add(uint64(len(raw)))
+
+	var req DiagnosticsRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return err
+	}
+
+	ttl := dt.actions.Expiration(TypeDiagnostics, kDiagnosticsExpiration)
+	if req.Expiration != "" {
+		if ttl, err = time.ParseDuration(req.Expiration); err != nil {
+			return err
+		}
+	}
+
+	sel, err := newAgentSelector(req.Filter)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	actionId := uuid.Must(uuid.NewV4()).String()
+
+	action := model.Action{
+		ActionId:   actionId,
+		Timestamp:  now.Format(time.RFC3339),
+		Expiration: now.Add(ttl).Format(time.RFC3339),
+		Type:       TypeDiagnostics,
+	}
+
+	var nAgents int
+	err = dl.ForEachActiveAgents(r.Context(), dt.bulk, sel.filter, selectorAgentFields, kDiagnosticsBatchSize, func(hits []es.HitT) error {
+		ids, err := sel.targets(hits)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		doc := action
+		doc.Id = uuid.Must(uuid.NewV4()).String()
+		doc.Agents = ids
+		if _, err := dl.CreateAction(r.Context(), dt.bulk, doc); err != nil {
+			return err
+		}
+		nAgents += len(ids)
+		return nil
+	})
+	if errors.Is(err, es.ErrIndexNotFound) {
+		err = nil
+	}
+	if err != nil {
+		if nAgents > 0 {
+			log.Warn().
+				Err(err).
+				Str("actionId", actionId).
+				Int("agents", nAgents).
+				Msg("Diagnostics action dispatched to part of the matching agents")
+		}
+		return err
+	}
+	if nAgents == 0 {
+		return ErrDiagnosticsNoAgents
+	}
+
+	log.Info().
+		Str("actionId", actionId).
+		Int("agents", nAgents).
+		Str("expiration", action.Expiration).
+		Msg("Diagnostics action dispatched")
+
+	resp := DiagnosticsResponse{
+		ActionId:   actionId,
+		Agents:     int64(nAgents),
+		Expiration: action.Expiration,
+	}
+
+	return dt.writeResponse(w, &resp)
+}
+
+func (dt *DiagnosticsT) handleDiagnosticsStatus(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := dt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, dt.bulk, dt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntDiagnostics.IncStart()
+	defer dfunc()
+
+	actions, results, err := dl.FindActionWithResults(r.Context(), dt.bulk, id)
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 || actions[0].Type != TypeDiagnostics {
+		return ErrDiagnosticsNotFound
+	}
+
+	failed, err := dl.FindFailedUploads(r.Context(), dt.bulk, id)
+	if err != nil {
+		return err
+	}
+
+	resp := diagnosticsStatus(actions, results, failed, time.Now().UTC())
+
+	return dt.writeResponse(w, &resp)
+}
+
+func (dt *DiagnosticsT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntDiagnostics.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// diagnosticsStatus consolidates the results reported for a DIAGNOSTICS action
+// into the status of each agent targeted by its documents. An agent that reported more than one
+// result is considered uploaded if any of them references an upload. An agent
+// yet to report a result whose upload failed, as when abandoned, has failed.
+func diagnosticsStatus(actions []model.Action, results []model.ActionResult, failed []model.Upload, now time.Time) DiagnosticsStatus {
+	// The documents of the action only differ by the agents they target
+	action := actions[0]
+	expired := false
+	if exp, err := time.Parse(time.RFC3339, action.Expiration); err == nil {
+		expired = now.After(exp)
+	}
+
+	agents := make(map[string]*DiagnosticsAgentStatus)
+	for _, doc := range actions {
+		for _, agentId := range doc.Agents {
+			agents[agentId] = &DiagnosticsAgentStatus{
+				AgentId: agentId,
+				Status:  DiagnosticsAgentPending,
+			}
+		}
+	}
+
+	for _, acr := range results {
+		st, ok := agents[acr.AgentId]
+		if !ok || st.Status == DiagnosticsAgentUploaded {
+			continue
+		}
+
+		switch {
+		case acr.UploadId != "":
+			st.Status = DiagnosticsAgentUploaded
+			st.UploadId = acr.UploadId
+			st.Error = ""
+			if acr.File != nil {
+				st.File = &DiagnosticsFile{
+					Name:   acr.File.Name,
+					Size:   acr.File.Size,
+					Sha256: acr.File.Sha256,
+				}
+			}
+		case acr.Error != "":
+			st.Status = DiagnosticsAgentFailed
+			st.Error = acr.Error
+		default:
+			st.Status = DiagnosticsAgentFailed
+			st.Error = ErrDiagnosticsNoUpload.Error()
+		}
+	}
+
+	for _, upload := range failed {
+		st, ok := agents[upload.AgentId]
+		if !ok || st.Status != DiagnosticsAgentPending {
+			continue
+		}
+		st.Status = DiagnosticsAgentFailed
+		st.UploadId = upload.Id
+		st.Error = "upload failed"
+		if upload.Error != "" {
+			st.Error = "upload failed: " + upload.Error
+		}
+	}
+
+	resp := DiagnosticsStatus{
+		ActionId:   action.ActionId,
+		Expiration: action.Expiration,
+		Total:      int64(len(agents)),
+		Agents:     make([]DiagnosticsAgentStatus, 0, len(agents)),
+	}
+
+	for _, st := range agents {
+		switch st.Status {
+		case DiagnosticsAgentUploaded:
+			resp.Uploaded++
+		case DiagnosticsAgentFailed:
+			resp.Failed++
+		case DiagnosticsAgentPending:
+			if expired {
+				st.Status = DiagnosticsAgentExpired
+			} else {
+				resp.Pending++
+			}
+		}
+		resp.Agents = append(resp.Agents, *st)
+	}
+
+	sort.Slice(resp.Agents, func(i, j int) bool {
+		return resp.Agents[i].AgentId < resp.Agents[j].AgentId
+	})
+
+	switch {
+	case resp.Pending == 0 && resp.Uploaded+resp.Failed == resp.Total:
+		resp.Status = DiagnosticsComplete
+	case expired:
+		resp.Status = DiagnosticsExpired
+	default:
+		resp.Status = DiagnosticsInProgress
+	}
+
+	return resp
+}
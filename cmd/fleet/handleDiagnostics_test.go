@@ -0,0 +1,124 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+func TestDiagnosticsStatus(t *testing.T) {
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	action := model.Action{
+		ActionId:   "diag1",
+		Agents:     []string{"c", "a"},
+		Expiration: now.Add(time.Hour).Format(time.RFC3339),
+		Type:       TypeDiagnostics,
+	}
+	// A document per batch of agents
+	actions := []model.Action{action, action}
+	actions[1].Agents = []string{"b", "d"}
+
+	results := []model.ActionResult{
+		{AgentId: "a", ActionId: "diag1", Error: "timeout"},
+		{AgentId: "a", ActionId: "diag1", UploadId: "up1", File: &model.FileMetadata{Name: "diag.zip", Size: 42}},
+		{AgentId: "b", ActionId: "diag1", Error: "disk full"},
+		{AgentId: "c", ActionId: "diag1"},
+		{AgentId: "unknown", ActionId: "diag1", UploadId: "up2"},
+	}
+
+	agents := []DiagnosticsAgentStatus{
+		{AgentId: "a", Status: DiagnosticsAgentUploaded, UploadId: "up1", File: &DiagnosticsFile{Name: "diag.zip", Size: 42}},
+		{AgentId: "b", Status: DiagnosticsAgentFailed, Error: "disk full"},
+		{AgentId: "c", Status: DiagnosticsAgentFailed, Error: ErrDiagnosticsNoUpload.Error()},
+		{AgentId: "d", Status: DiagnosticsAgentPending},
+	}
+
+	failed := []model.Upload{
+		{ESDocument: model.ESDocument{Id: "up4"}, AgentId: "d", ActionId: "diag1", Status: model.UploadStatusFail, Error: "abandoned"},
+		{ESDocument: model.ESDocument{Id: "up5"}, AgentId: "a", ActionId: "diag1", Status: model.UploadStatusFail},
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		res    []model.ActionResult
+		failed []model.Upload
+		want   DiagnosticsStatus
+	}{
+		{
+			name: "in progress",
+			now:  now,
+			res:  results,
+			want: DiagnosticsStatus{
+				Status:   DiagnosticsInProgress,
+				Total:    4,
+				Uploaded: 1,
+				Failed:   2,
+				Pending:  1,
+				Agents:   agents,
+			},
+		},
+		{
+			name: "expired",
+			now:  now.Add(2 * time.Hour),
+			res:  results,
+			want: DiagnosticsStatus{
+				Status:   DiagnosticsExpired,
+				Total:    4,
+				Uploaded: 1,
+				Failed:   2,
+				Agents: append(append([]DiagnosticsAgentStatus{}, agents[:3]...),
+					DiagnosticsAgentStatus{AgentId: "d", Status: DiagnosticsAgentExpired}),
+			},
+		},
+		{
+			name: "complete",
+			now:  now,
+			res:  append(results, model.ActionResult{AgentId: "d", ActionId: "diag1", UploadId: "up3"}),
+			want: DiagnosticsStatus{
+				Status:   DiagnosticsComplete,
+				Total:    4,
+				Uploaded: 2,
+				Failed:   2,
+				Agents: append(append([]DiagnosticsAgentStatus{}, agents[:3]...),
+					DiagnosticsAgentStatus{AgentId: "d", Status: DiagnosticsAgentUploaded, UploadId: "up3"}),
+			},
+		},
+		{
+			name:   "upload failed",
+			now:    now,
+			res:    results,
+			failed: failed,
+			want: DiagnosticsStatus{
+				Status:   DiagnosticsComplete,
+				Total:    4,
+				Uploaded: 1,
+				Failed:   3,
+				Agents: append(append([]DiagnosticsAgentStatus{}, agents[:3]...),
+					DiagnosticsAgentStatus{AgentId: "d", Status: DiagnosticsAgentFailed, UploadId: "up4", Error: "upload failed: abandoned"}),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want.ActionId = action.ActionId
+			tc.want.Expiration = action.Expiration
+
+			got := diagnosticsStatus(actions, tc.res, tc.failed, tc.now)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
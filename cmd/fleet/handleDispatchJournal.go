@@ -0,0 +1,200 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+type DispatchJournalT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+}
+
+func NewDispatchJournalT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *DispatchJournalT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Bool("enabled", cfg.DispatchJournal.Enabled).
+		Dur("retention", cfg.DispatchJournal.Retention).
+		Msg("Dispatch journal install limits")
+
+	return &DispatchJournalT{
+		bulk:  bulker,
+		cache: cache,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleDispatchJournal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.djt.handleDispatchJournal(w, r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntDispatches.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("agentId", id).
+			Int("code", code).
+			Msg("Fail dispatch journal")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+// handleDispatchJournal returns the checkin responses that sent actions to
+// the agent, most recent first.
+func (djt *DispatchJournalT) handleDispatchJournal(w http.ResponseWriter, r *http.Request, agentId string) error {
+	limitF, err := djt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, djt.bulk, djt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntDispatches.IncStart()
+	defer dfunc()
+
+	filter, err := dispatchEntryFilter(agentId, r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	entries, err := dl.FindDispatchEntries(r.Context(), djt.bulk, filter)
+	if err != nil {
+		return err
+	}
+
+	resp := DispatchJournal{
+		Items: make([]DispatchEntry, len(entries)),
+	}
+	for i, e := range entries {
+		resp.Items[i] = DispatchEntry{
+			Timestamp:      e.Timestamp,
+			ActionIds:      e.ActionIds,
+			PolicyRevision: e.PolicyRevision,
+			PolicyHash:     e.PolicyHash,
+			ResponseBytes:  e.ResponseBytes,
+		}
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	n, err := w.Write(data)
+	cntDispatches.bodyOut.Add(uint64(n))
+	return err
+}
+
+// dispatchEntryFilter parses the search parameters.
+func dispatchEntryFilter(agentId string, q url.Values) (dl.DispatchEntryFilter, error) {
+	f := dl.DispatchEntryFilter{AgentId: agentId}
+
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"from", &f.From},
+		{"to", &f.To},
+	} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s %q", p.name, v)
+			}
+			*p.t = t
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.To.After(f.From) {
+		return f, fmt.Errorf("to must be after from")
+	}
+	if size := q.Get("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 || n > dl.MaxDispatchEntriesSize {
+			return f, fmt.Errorf("size must be between 1 and %d", dl.MaxDispatchEntriesSize)
+		}
+		f.Size = n
+	}
+	return f, nil
+}
+
+// dispatchEntry returns the journal entry of the response, or false when it
+// sent no action.
+func dispatchEntry(agentId string, resp *CheckinResponse, size uint64, now time.Time) (model.DispatchEntry, bool) {
+	if len(resp.Actions) == 0 {
+		return model.DispatchEntry{}, false
+	}
+
+	entry := model.DispatchEntry{
+		AgentId:       agentId,
+		ActionIds:     make([]string, len(resp.Actions)),
+		ResponseBytes: int64(size),
+		Timestamp:     now.UTC().Format(time.RFC3339Nano),
+	}
+	for i, a := range resp.Actions {
+		entry.ActionIds[i] = a.Id
+		if a.Type == TypePolicyChange {
+			entry.PolicyRevision = a.Id
+			entry.PolicyHash = a.DataHash
+		}
+	}
+	return entry, true
+}
+
+// newDispatchJournal returns the recorder of the dispatch journal; nil when
+// disabled.
+func newDispatchJournal(cfg *config.Server) *historyRecorder {
+	if !cfg.DispatchJournal.Enabled {
+		return nil
+	}
+	return newHistoryRecorder("dispatch_journal")
+}
+
+// recordDispatch writes the response into the dispatch journal in the
+// background, so the checkin does not wait on it. The responses sending no
+// action are not recorded.
+func recordDispatch(journal *historyRecorder, bulker bulk.Bulk, agentId string, resp *CheckinResponse, size uint64) {
+	entry, ok := dispatchEntry(agentId, resp, size, time.Now())
+	if !ok {
+		return
+	}
+
+	journal.record(agentId, func(ctx context.Context) error {
+		return dl.CreateDispatchEntry(ctx, bulker, entry)
+	})
+}
+
+// ensureDispatchJournal installs the template of the dispatch journal data
+// stream, mapping its fields and deleting its entries past their retention.
+func ensureDispatchJournal(ctx context.Context, esCli *elasticsearch.Client, cfg *config.DispatchJournal) error {
+	return es.EnsureDataStream(ctx, esCli, es.ResolveIndex(dl.FleetDispatchJournal), es.MappingDispatchEntry, cfg.Retention)
+}
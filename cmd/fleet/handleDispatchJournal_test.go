@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchEntryFilter(t *testing.T) {
+	f, err := dispatchEntryFilter("agent-1", url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, dl.DispatchEntryFilter{AgentId: "agent-1"}, f)
+
+	f, err = dispatchEntryFilter("agent-1", url.Values{
+		"from": {"2026-10-06T00:00:00Z"},
+		"to":   {"2026-10-07T00:00:00Z"},
+		"size": {"10"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, dl.DispatchEntryFilter{
+		AgentId: "agent-1",
+		From:    time.Date(2026, 10, 6, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2026, 10, 7, 0, 0, 0, 0, time.UTC),
+		Size:    10,
+	}, f)
+
+	for _, q := range []url.Values{
+		{"from": {"tuesday"}},
+		{"to": {"2026-10-07"}},
+		{"from": {"2026-10-07T00:00:00Z"}, "to": {"2026-10-06T00:00:00Z"}},
+		{"size": {"0"}},
+		{"size": {"1001"}},
+	} {
+		_, err := dispatchEntryFilter("agent-1", q)
+		assert.Error(t, err, q.Encode())
+	}
+}
+
+func TestDispatchEntry(t *testing.T) {
+	now := time.Date(2026, 10, 6, 12, 0, 0, 0, time.UTC)
+
+	_, ok := dispatchEntry("agent-1", &CheckinResponse{Action: "checkin"}, 30, now)
+	assert.False(t, ok)
+
+	entry, ok := dispatchEntry("agent-1", &CheckinResponse{
+		Action: "checkin",
+		Actions: []ActionResp{
+			{Id: "action-1", Type: "UPGRADE"},
+			{Id: "policy:p1:3:1", Type: TypePolicyChange, DataHash: "hash"},
+		},
+	}, 1234, now)
+	require.True(t, ok)
+	assert.Equal(t, model.DispatchEntry{
+		AgentId:        "agent-1",
+		ActionIds:      []string{"action-1", "policy:p1:3:1"},
+		PolicyRevision: "policy:p1:3:1",
+		PolicyHash:     "hash",
+		ResponseBytes:  1234,
+		Timestamp:      "2026-10-06T12:00:00Z",
+	}, entry)
+}
@@ -6,6 +6,7 @@ package fleet
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,15 +17,18 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/lifecycle"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
 	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gofrs/uuid"
-	"github.com/hashicorp/go-version"
 	"github.com/julienschmidt/httprouter"
 	"github.com/miolini/datacounter"
 	"github.com/rs/zerolog/log"
@@ -35,30 +39,58 @@ const (
 
 	kCacheAccessInitTTL = time.Second * 30 // Cache a bit longer to handle expensive initial checkin
 	kCacheEnrollmentTTL = time.Second * 30
+
+	kEnrollConflictAttempts = 3
 )
 
+// kAgentIdNamespace is the namespace of the agent ids derived from their
+// fingerprint.
+var kAgentIdNamespace = uuid.Must(uuid.FromString("d38fead1-9c20-4cee-b5a4-235f304436a9"))
+
 var (
 	ErrUnknownEnrollType = errors.New("unknown enroll request type")
+	ErrPolicyNotInSpace  = errors.New("policy not in the spaces of the enrollment key")
+	ErrPolicySpaceCheck  = errors.New("fail to check the space of the policy")
 )
 
 type EnrollerT struct {
-	verCon version.Constraints
+	ua     *userAgentRule
 	bulker bulk.Bulk
 	cache  cache.Cache
 	limit  *limit.Limiter
+
+	reissueLimit *limit.Limiter
+	reissueUA    *userAgentRule
+
+	localMeta *config.LocalMetadata
+	agentId   *config.AgentID
+	fence     *geofence
+
+	// Records the enrollment attempts into the enrollment history
+	history *historyRecorder
+
+	events *lifecycle.Outbox
 }
 
-func NewEnrollerT(verCon version.Constraints, cfg *config.Server, bulker bulk.Bulk, c cache.Cache) (*EnrollerT, error) {
+func NewEnrollerT(ua *userAgentPolicy, cfg *config.Server, bulker bulk.Bulk, c cache.Cache, fence *geofence, events *lifecycle.Outbox) (*EnrollerT, error) {
 
 	log.Info().
 		Interface("limits", cfg.Limits.EnrollLimit).
+		Interface("reissue", cfg.Limits.ReissueLimit).
 		Msg("Enroller install limits")
 
 	return &EnrollerT{
-		verCon: verCon,
-		limit:  limit.NewLimiter(&cfg.Limits.EnrollLimit),
-		bulker: bulker,
-		cache:  c,
+		ua:           ua.enroll,
+		limit:        limit.NewGlobalLimiter("enroll", &cfg.Limits.EnrollLimit, &cfg.Limits.Global, globalCount(bulker)),
+		reissueLimit: limit.NewLimiter(&cfg.Limits.ReissueLimit),
+		reissueUA:    ua.reissue,
+		bulker:       bulker,
+		cache:        c,
+		history:      newEnrollmentHistory(cfg),
+		localMeta:    &cfg.LocalMetadata,
+		agentId:      &cfg.AgentID,
+		fence:        fence,
+		events:       events,
 	}, nil
 
 }
@@ -72,7 +104,13 @@ func (rt Router) handleEnroll(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	data, err := rt.et.handleEnroll(r)
+	ev := model.EnrollmentEvent{
+		SourceIp:  remoteIP(r),
+		UserAgent: r.Header.Get("User-Agent"),
+	}
+	data, err := rt.et.handleEnroll(r, &ev)
+
+	recordEnrollment(rt.et.history, rt.et.bulker, ev, start, err)
 
 	if err != nil {
 		code, str, msg, lvl := cntEnroll.IncError(err)
@@ -97,15 +135,18 @@ func (rt Router) handleEnroll(w http.ResponseWriter, r *http.Request, ps httprou
 
 	cntEnroll.bodyOut.Add(uint64(numWritten))
 
-	log.Trace().
-		Err(err).
-		RawJSON("raw", data).
-		Str("mod", kEnrollMod).
-		Dur("rtt", time.Since(start)).
-		Msg("handleEnroll OK")
+	if e := log.Trace(); e.Enabled() {
+		e.Err(err).
+			RawJSON("raw", redact.JSON(data)).
+			Str("mod", kEnrollMod).
+			Dur("rtt", time.Since(start)).
+			Msg("handleEnroll OK")
+	}
 }
 
-func (et *EnrollerT) handleEnroll(r *http.Request) ([]byte, error) {
+// handleEnroll enrolls the agent, filling ev with what is known of the attempt
+// as it goes.
+func (et *EnrollerT) handleEnroll(r *http.Request, ev *model.EnrollmentEvent) ([]byte, error) {
 
 	limitF, err := et.limit.Acquire()
 	if err != nil {
@@ -117,8 +158,9 @@ func (et *EnrollerT) handleEnroll(r *http.Request) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	ev.EnrollmentApiKeyId = key.Id
 
-	err = validateUserAgent(r, et.verCon)
+	err = validateUserAgent(r, et.ua)
 	if err != nil {
 		return nil, err
 	}
@@ -132,6 +174,12 @@ func (et *EnrollerT) handleEnroll(r *http.Request) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	ev.PolicyId = erec.PolicyId
+	setBodySizePolicy(r, erec.PolicyId)
+
+	if err := et.fence.check(r, "enroll-geofence", erec.PolicyId); err != nil {
+		return nil, err
+	}
 
 	readCounter := datacounter.NewReaderCounter(r.Body)
 
@@ -143,15 +191,45 @@ func (et *EnrollerT) handleEnroll(r *http.Request) ([]byte, error) {
 
 	cntEnroll.bodyIn.Add(readCounter.Count())
 
-	resp, err := _enroll(r.Context(), et.bulker, et.cache, *req, *erec)
+	resp, err := _enroll(r.Context(), et.bulker, et.cache, *req, *erec, et.localMeta, et.agentId)
 	if err != nil {
 		return nil, err
 	}
+	ev.AgentId = resp.Item.ID
+
+	et.events.Emit(lifecycle.NewEvent(lifecycle.TypeEnrolled, resp.Item.ID, resp.Item.PolicyId, 0, time.Now()))
 
-	return json.Marshal(resp)
+	defer timePhase(r.Context(), phaseMarshal)()
+	return codec.Marshal(resp)
 }
 
-func _enroll(ctx context.Context, bulker bulk.Bulk, c cache.Cache, req EnrollRequest, erec model.EnrollmentApiKey) (*EnrollResponse, error) {
+// checkPolicySpace keeps the key from enrolling into the policy of another
+// Kibana space. Kibana sets the namespaces of the keys only with the spaces
+// enabled, so the keys without any are not checked.
+func checkPolicySpace(ctx context.Context, bulker bulk.Bulk, erec model.EnrollmentApiKey) error {
+	if len(erec.Namespaces) == 0 {
+		return nil
+	}
+
+	_, err := dl.FindLatestPolicyInSpaces(ctx, bulker, erec.PolicyId, erec.Namespaces)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, dl.ErrNotFound) || errors.Is(err, es.ErrIndexNotFound) {
+		log.Warn().
+			Str("enrollment_api_key_id", erec.ApiKeyId).
+			Str("policy_id", erec.PolicyId).
+			Strs("namespaces", erec.Namespaces).
+			Msg("policy not found in the spaces of the enrollment key")
+		return ErrPolicyNotInSpace
+	}
+	if es.IsUnavailable(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrPolicySpaceCheck, err)
+}
+
+func _enroll(ctx context.Context, bulker bulk.Bulk, c cache.Cache, req EnrollRequest, erec model.EnrollmentApiKey, metaCfg *config.LocalMetadata, idCfg *config.AgentID) (*EnrollResponse, error) {
 
 	if req.SharedId != "" {
 		// TODO: Support pre-existing install
@@ -160,42 +238,31 @@ func _enroll(ctx context.Context, bulker bulk.Bulk, c cache.Cache, req EnrollReq
 
 	now := time.Now()
 
-	// Generate an ID here so we can pre-create the api key and avoid a round trip
-	u, err := uuid.NewV4()
-	if err != nil {
-		return nil, err
-	}
-
-	// TODO: Cleanup after ourselves on failure:
-	// Revoke generated keys.
-	// Remove agent record.
-
-	agentId := u.String()
-
-	accessApiKey, err := generateAccessApiKey(ctx, bulker.Client(), agentId)
-	if err != nil {
-		return nil, err
-	}
-
-	// Update the local metadata agent id
-	localMeta, err := updateLocalMetaAgentId(req.Meta.Local, agentId)
-	if err != nil {
+	if err := checkPolicySpace(ctx, bulker, erec); err != nil {
 		return nil, err
 	}
 
-	agentData := model.Agent{
-		Active:         true,
-		PolicyId:       erec.PolicyId,
-		Type:           req.Type,
-		EnrolledAt:     now.UTC().Format(time.RFC3339),
-		LocalMetadata:  localMeta,
-		AccessApiKeyId: accessApiKey.Id,
-		ActionSeqNo:    []int64{sqn.UndefinedSeqNo},
-	}
-
-	err = createFleetAgent(ctx, bulker, agentId, agentData)
-	if err != nil {
-		return nil, err
+	// A concurrent enrollment of the same host writing its document first
+	// makes this one resolve its document again
+	var (
+		agentId      string
+		accessApiKey *apikey.ApiKey
+		agentData    model.Agent
+		err          error
+	)
+	for attempt := 1; ; attempt++ {
+		agentId, accessApiKey, agentData, err = enrollAgent(ctx, bulker, req, erec, metaCfg, idCfg, now)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, es.ErrElasticVersionConflict) || attempt >= kEnrollConflictAttempts {
+			return nil, err
+		}
+		log.Debug().
+			Err(err).
+			Str("agentId", agentId).
+			Int("attempt", attempt).
+			Msg("Agent document written concurrently; enrolling again")
 	}
 
 	resp := EnrollResponse{
@@ -220,6 +287,121 @@ func _enroll(ctx context.Context, bulker bulk.Bulk, c cache.Cache, req EnrollReq
 	return &resp, nil
 }
 
+// enrollAgent creates the access API key and writes the document of the
+// agent. The key is invalidated when the document fails to be written.
+func enrollAgent(ctx context.Context, bulker bulk.Bulk, req EnrollRequest, erec model.EnrollmentApiKey, metaCfg *config.LocalMetadata, idCfg *config.AgentID, now time.Time) (string, *apikey.ApiKey, model.Agent, error) {
+	agentId, previous, meta, err := enrollTarget(ctx, bulker, idCfg, erec.PolicyId, req)
+	if err != nil {
+		return "", nil, model.Agent{}, err
+	}
+
+	// Update the local metadata agent id
+	localMeta, err := updateLocalMetaAgentId(req.Meta.Local, agentId)
+	if err != nil {
+		return "", nil, model.Agent{}, err
+	}
+	localMeta, truncated, err := truncateLocalMeta(localMeta, metaCfg)
+	if err != nil {
+		return "", nil, model.Agent{}, err
+	}
+	if truncated {
+		log.Warn().
+			Str("agentId", agentId).
+			Int("size", len(req.Meta.Local)).
+			Msg("Local metadata exceeds the limits; truncated")
+	}
+
+	accessApiKey, err := generateAccessApiKey(ctx, bulker.Client(), agentId, erec.Namespaces)
+	if err != nil {
+		return "", nil, model.Agent{}, err
+	}
+
+	agentData := model.Agent{
+		Active:                 true,
+		PolicyId:               erec.PolicyId,
+		Namespaces:             erec.Namespaces,
+		Type:                   req.Type,
+		EnrolledAt:             now.UTC().Format(time.RFC3339),
+		LocalMetadata:          localMeta,
+		LocalMetadataTruncated: truncated,
+		AccessApiKeyId:         accessApiKey.Id,
+		AccessApiKeyHash:       accessApiKeyHash(*accessApiKey),
+		EnrollmentApiKeyId:     erec.ApiKeyId,
+		ActionSeqNo:            []int64{sqn.UndefinedSeqNo},
+	}
+
+	if previous == nil {
+		err = createFleetAgent(ctx, bulker, agentId, agentData)
+	} else {
+		err = replaceFleetAgent(ctx, bulker, previous, meta, agentData)
+	}
+	if err != nil {
+		if ierr := invalidateAPIKeys(ctx, bulker, accessApiKey.Id); ierr != nil {
+			log.Warn().
+				Err(ierr).
+				Str("agentId", agentId).
+				Str("apiKeyId", accessApiKey.Id).
+				Msg("Fail to invalidate the access API key of a failed enrollment")
+		}
+		return agentId, nil, model.Agent{}, err
+	}
+	return agentId, accessApiKey, agentData, nil
+}
+
+// enrollTarget returns the id of the document the agent enrolls into. A host
+// takes over the existing document of its fingerprint only when it presents
+// the access API key of that enrollment, and the document is returned with
+// the metadata to replace it conditionally. Otherwise, so that a host cannot
+// take over nor evict another claiming its fingerprint, such as a cloned
+// virtual machine, it is given a random id.
+func enrollTarget(ctx context.Context, bulker bulk.Bulk, idCfg *config.AgentID, policyId string, req EnrollRequest) (string, *model.Agent, bulk.DocMeta, error) {
+	agentId, fingerprinted, err := enrollAgentId(idCfg, policyId, req.Meta.Local)
+	if err != nil || !fingerprinted {
+		return agentId, nil, bulk.DocMeta{}, err
+	}
+
+	agent, meta, err := dl.ReadAgentWithMeta(ctx, bulker, agentId)
+	switch {
+	case errors.Is(err, dl.ErrNotFound):
+		return agentId, nil, bulk.DocMeta{}, nil
+	case err != nil:
+		return "", nil, bulk.DocMeta{}, err
+	case holdsAccessApiKey(&agent, req.PreviousAccessApiKey):
+		return agentId, &agent, meta, nil
+	}
+
+	log.Warn().
+		Str("fingerprintAgentId", agentId).
+		Msg("Agent fingerprint enrolled by another host; random agent id")
+	cntEnrollFingerprintTaken.Inc()
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return "", nil, bulk.DocMeta{}, err
+	}
+	return u.String(), nil, bulk.DocMeta{}, nil
+}
+
+// holdsAccessApiKey reports whether token is the access API key the agent was
+// last given.
+func holdsAccessApiKey(agent *model.Agent, token string) bool {
+	if token == "" || agent.AccessApiKeyHash == "" {
+		return false
+	}
+	held, err := apikey.NewApiKeyFromToken(token)
+	if err != nil {
+		return false
+	}
+	return holdsApiKey(agent, *held)
+}
+
+// holdsApiKey reports whether held is the access API key the agent was last
+// given.
+func holdsApiKey(agent *model.Agent, held apikey.ApiKey) bool {
+	return agent.AccessApiKeyHash != "" && agent.AccessApiKeyId == held.Id &&
+		subtle.ConstantTimeCompare([]byte(agent.AccessApiKeyHash), []byte(accessApiKeyHash(held))) == 1
+}
+
 // updateMetaLocalAgentId updates the agent id in the local metadata if exists
 // At the time of writing the local metadata blob looks something like this
 // {
@@ -276,6 +458,76 @@ func updateLocalMetaAgentId(data []byte, agentId string) ([]byte, error) {
 	return data, nil
 }
 
+// replaceFleetAgent replaces the document of the agent enrolling again, unless
+// it changed since it was read, and invalidates the API keys of its previous
+// enrollment.
+func replaceFleetAgent(ctx context.Context, bulker bulk.Bulk, previous *model.Agent, meta bulk.DocMeta, agent model.Agent) error {
+	data, err := json.Marshal(agent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := bulker.Index(ctx, dl.FleetAgents, previous.Id, data, bulk.WithRefresh(), bulk.WithIfSeqNo(meta)); err != nil {
+		return err
+	}
+	cntEnrollReplaced.Inc()
+
+	log.Info().
+		Str("agentId", previous.Id).
+		Str("previousAccessApiKeyId", previous.AccessApiKeyId).
+		Str("previousEnrolledAt", previous.EnrolledAt).
+		Msg("Agent enrolled again; document replaced")
+
+	// The agent has its new keys already; the previous ones failing to be
+	// invalidated does not fail it
+	if ids := _getAPIKeyIDs(previous); len(ids) > 0 {
+		if err := invalidateAPIKeys(ctx, bulker, ids...); err != nil {
+			log.Warn().
+				Err(err).
+				Str("agentId", previous.Id).
+				Strs("apiKeyIds", ids).
+				Msg("Fail to invalidate the API keys of the previous enrollment")
+		}
+	}
+	return nil
+}
+
+// enrollAgentId returns the id of the document of the agent enrolling, and
+// whether it is derived from its fingerprint: the policy and the configured
+// fields of its local metadata, as a name-based UUID. The agents lacking one
+// of the fields get a random id.
+func enrollAgentId(cfg *config.AgentID, policyId string, localMeta []byte) (string, bool, error) {
+	if cfg.Strategy == config.AgentIDFingerprint && localMeta != nil {
+		var m map[string]interface{}
+		if err := json.Unmarshal(localMeta, &m); err != nil {
+			return "", false, err
+		}
+
+		name := policyId
+		found := true
+		for _, f := range cfg.Fields {
+			v := lookupPath(m, f)
+			if v == nil || v == "" {
+				found = false
+				break
+			}
+			name += "\n" + fmt.Sprint(v)
+		}
+		if found {
+			return uuid.NewV5(kAgentIdNamespace, name).String(), true, nil
+		}
+		log.Debug().
+			Strs("fields", cfg.Fields).
+			Msg("Local metadata lacks the fingerprint fields; random agent id")
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return "", false, err
+	}
+	return u.String(), false, nil
+}
+
 func createFleetAgent(ctx context.Context, bulker bulk.Bulk, id string, agent model.Agent) error {
 	data, err := json.Marshal(agent)
 	if err != nil {
@@ -289,15 +541,15 @@ func createFleetAgent(ctx context.Context, bulker bulk.Bulk, id string, agent mo
 	return nil
 }
 
-func generateAccessApiKey(ctx context.Context, client *elasticsearch.Client, agentId string) (*apikey.ApiKey, error) {
+func generateAccessApiKey(ctx context.Context, client *elasticsearch.Client, agentId string, namespaces []string) (*apikey.ApiKey, error) {
 	return apikey.Create(ctx, client, agentId, "", []byte(kFleetAccessRolesJSON),
-		apikey.NewMetadata(agentId, apikey.TypeAccess))
+		apikey.NewMetadata(agentId, apikey.TypeAccess, namespaces...))
 }
 
-func generateOutputApiKey(ctx context.Context, client *elasticsearch.Client, agentId, outputName string, roles []byte) (*apikey.ApiKey, error) {
+func generateOutputApiKey(ctx context.Context, client *elasticsearch.Client, agentId, outputName string, roles []byte, namespaces []string) (*apikey.ApiKey, error) {
 	name := fmt.Sprintf("%s:%s", agentId, outputName)
 	return apikey.Create(ctx, client, name, "", roles,
-		apikey.NewMetadata(agentId, apikey.TypeOutput))
+		apikey.NewMetadata(agentId, apikey.TypeOutput, namespaces...))
 }
 
 func (et *EnrollerT) fetchEnrollmentKeyRecord(ctx context.Context, id string) (*model.EnrollmentApiKey, error) {
@@ -316,7 +568,7 @@ func (et *EnrollerT) fetchEnrollmentKeyRecord(ctx context.Context, id string) (*
 		return nil, fmt.Errorf("record is inactive")
 	}
 
-	cost := int64(len(rec.ApiKey))
+	cost := int64(len(id) + len(rec.ApiKey) + len(rec.ApiKeyId) + len(rec.Name) + len(rec.PolicyId))
 	et.cache.SetEnrollmentApiKey(id, rec, cost, kCacheEnrollmentTTL)
 
 	return &rec, nil
@@ -326,18 +578,25 @@ func decodeEnrollRequest(data io.Reader) (*EnrollRequest, error) {
 
 	// TODO: defend overflow, slow roll
 	var req EnrollRequest
-	decoder := json.NewDecoder(data)
+	decoder := codec.NewDecoder(data)
 	if err := decoder.Decode(&req); err != nil {
 		return nil, err
 	}
 
-	// Validate
-	switch req.Type {
-	// TODO: Should these be converted to constant? Need to be kept in sync with Kibana?
-	case "EPHEMERAL", "PERMANENT", "TEMPORARY":
-	default:
-		return nil, ErrUnknownEnrollType
+	if err := req.Validate(); err != nil {
+		return nil, err
 	}
 
 	return &req, nil
 }
+
+// globalCount shares the count of the global limits through the fleet rate
+// limits index.
+func globalCount(bulker bulk.Bulk) limit.CountFunc {
+	if bulker == nil {
+		return nil
+	}
+	return func(ctx context.Context, name string, window, delta int64) (int64, error) {
+		return dl.AddRateCount(ctx, bulker, name, window, delta)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollAgentId(t *testing.T) {
+	random := &config.AgentID{}
+	random.InitDefaults()
+	fingerprint := &config.AgentID{Strategy: config.AgentIDFingerprint, Fields: []string{"host.id", "host.name"}}
+	require.NoError(t, fingerprint.Validate())
+
+	meta := []byte(`{"host":{"id":"machine-1","name":"runner"},"elastic":{"agent":{"id":"x"}}}`)
+
+	id := func(cfg *config.AgentID, policyId string, meta []byte) (string, bool) {
+		t.Helper()
+		id, fingerprinted, err := enrollAgentId(cfg, policyId, meta)
+		require.NoError(t, err)
+		_, err = uuid.FromString(id)
+		require.NoError(t, err)
+		return id, fingerprinted
+	}
+
+	id1, fingerprinted := id(random, "policy-1", meta)
+	assert.False(t, fingerprinted)
+	id2, _ := id(random, "policy-1", meta)
+	assert.NotEqual(t, id1, id2)
+
+	id1, fingerprinted = id(fingerprint, "policy-1", meta)
+	assert.True(t, fingerprinted)
+	id2, _ = id(fingerprint, "policy-1", meta)
+	assert.Equal(t, id1, id2, "same host enrolling again")
+
+	id2, _ = id(fingerprint, "policy-2", meta)
+	assert.NotEqual(t, id1, id2, "another policy")
+	id2, _ = id(fingerprint, "policy-1", []byte(`{"host":{"id":"machine-2","name":"runner"}}`))
+	assert.NotEqual(t, id1, id2, "another host")
+
+	// Hosts lacking a field get a random id
+	_, fingerprinted = id(fingerprint, "policy-1", []byte(`{"host":{"id":"machine-1"}}`))
+	assert.False(t, fingerprinted)
+	_, fingerprinted = id(fingerprint, "policy-1", nil)
+	assert.False(t, fingerprinted)
+
+	_, _, err := enrollAgentId(fingerprint, "policy-1", []byte(`not json`))
+	assert.Error(t, err)
+}
+
+type agentBulk struct {
+	ftesting.MockBulk
+	docs map[string][]byte
+}
+
+func (m agentBulk) ReadWithMeta(ctx context.Context, index, id string, opts ...bulk.Opt) ([]byte, bulk.DocMeta, error) {
+	if doc, ok := m.docs[id]; ok {
+		return doc, bulk.DocMeta{SeqNo: 7, PrimaryTerm: 1}, nil
+	}
+	return nil, bulk.DocMeta{}, es.ErrElasticNotFound
+}
+
+func TestEnrollTarget(t *testing.T) {
+	cfg := &config.AgentID{Strategy: config.AgentIDFingerprint, Fields: []string{"host.id"}}
+	meta := []byte(`{"host":{"id":"machine-1"}}`)
+	fingerprintId, _, err := enrollAgentId(cfg, "policy-1", meta)
+	require.NoError(t, err)
+
+	held := apikey.ApiKey{Id: "access-1", Key: "secret"}
+	doc, err := json.Marshal(model.Agent{
+		Active:           true,
+		AccessApiKeyId:   held.Id,
+		AccessApiKeyHash: accessApiKeyHash(held),
+	})
+	require.NoError(t, err)
+
+	req := func(previous string) EnrollRequest {
+		return EnrollRequest{Meta: EnrollMetadata{Local: meta}, PreviousAccessApiKey: previous}
+	}
+
+	// New fingerprint: created under it
+	id, previous, _, err := enrollTarget(context.Background(), agentBulk{}, cfg, "policy-1", req(""))
+	require.NoError(t, err)
+	assert.Equal(t, fingerprintId, id)
+	assert.Nil(t, previous)
+
+	bulker := agentBulk{docs: map[string][]byte{fingerprintId: doc}}
+
+	// The host presenting its previous access key takes over its document
+	id, previous, docMeta, err := enrollTarget(context.Background(), bulker, cfg, "policy-1", req(held.Token()))
+	require.NoError(t, err)
+	assert.Equal(t, fingerprintId, id)
+	require.NotNil(t, previous)
+	assert.Equal(t, fingerprintId, previous.Id)
+	assert.Equal(t, bulk.DocMeta{SeqNo: 7, PrimaryTerm: 1}, docMeta)
+
+	// Another host claiming the fingerprint gets a random id
+	for _, token := range []string{
+		"",
+		"not a token",
+		apikey.ApiKey{Id: held.Id, Key: "guess"}.Token(),
+		apikey.ApiKey{Id: "access-2", Key: held.Key}.Token(),
+	} {
+		id, previous, _, err = enrollTarget(context.Background(), bulker, cfg, "policy-1", req(token))
+		require.NoError(t, err)
+		assert.NotEqual(t, fingerprintId, id, token)
+		assert.Nil(t, previous, token)
+	}
+}
+
+type spaceBulk struct {
+	ftesting.MockBulk
+	searches *int
+	res      *es.ResultT
+	err      error
+}
+
+func (m spaceBulk) Search(ctx context.Context, index []string, body []byte, opts ...bulk.Opt) (*es.ResultT, error) {
+	*m.searches++
+	return m.res, m.err
+}
+
+func TestCheckPolicySpace(t *testing.T) {
+	var searches int
+	found := &es.ResultT{HitsT: es.HitsT{Hits: []es.HitT{{Source: []byte(`{"policy_id":"policy-1"}`)}}}}
+	erec := model.EnrollmentApiKey{PolicyId: "policy-1", Namespaces: []string{"space-1"}}
+
+	// The spaces disabled, the keys have no namespaces and are not checked
+	err := checkPolicySpace(context.Background(), spaceBulk{searches: &searches}, model.EnrollmentApiKey{PolicyId: "policy-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, searches)
+
+	err = checkPolicySpace(context.Background(), spaceBulk{searches: &searches, res: found}, erec)
+	require.NoError(t, err)
+	assert.Equal(t, 1, searches)
+
+	err = checkPolicySpace(context.Background(), spaceBulk{searches: &searches, res: &es.ResultT{}}, erec)
+	assert.Equal(t, ErrPolicyNotInSpace, err)
+
+	err = checkPolicySpace(context.Background(), spaceBulk{searches: &searches, err: es.ErrIndexNotFound}, erec)
+	assert.Equal(t, ErrPolicyNotInSpace, err)
+
+	err = checkPolicySpace(context.Background(), spaceBulk{searches: &searches, err: &es.ErrElastic{Status: 403, Type: "security_exception"}}, erec)
+	assert.True(t, errors.Is(err, ErrPolicySpaceCheck))
+	code, _, _, _ := cntEnroll.IncError(err)
+	assert.Equal(t, 503, code)
+}
@@ -0,0 +1,195 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+type EnrollmentHistoryT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+}
+
+func NewEnrollmentHistoryT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *EnrollmentHistoryT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Enrollment history install limits")
+
+	return &EnrollmentHistoryT{
+		bulk:  bulker,
+		cache: cache,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleEnrollmentHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.eht.handleEnrollmentHistory(w, r)
+
+	if err != nil {
+		rt.eht.writeError(w, err, "Fail enrollment history")
+	}
+}
+
+func (eht *EnrollmentHistoryT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntEnrollHistory.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (eht *EnrollmentHistoryT) handleEnrollmentHistory(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := eht.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, eht.bulk, eht.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntEnrollHistory.IncStart()
+	defer dfunc()
+
+	filter, err := enrollmentEventFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	events, err := dl.FindEnrollmentEvents(r.Context(), eht.bulk, filter)
+	if err != nil {
+		return err
+	}
+
+	resp := EnrollmentHistory{
+		Items: make([]EnrollmentEvent, len(events)),
+	}
+	for i, ev := range events {
+		resp.Items[i] = EnrollmentEvent{
+			Timestamp:          ev.Timestamp,
+			AgentId:            ev.AgentId,
+			EnrollmentApiKeyId: ev.EnrollmentApiKeyId,
+			PolicyId:           ev.PolicyId,
+			SourceIp:           ev.SourceIp,
+			UserAgent:          ev.UserAgent,
+			Outcome:            ev.Outcome,
+			Error:              ev.Error,
+			LatencyMs:          ev.LatencyMs,
+		}
+	}
+
+	return eht.writeResponse(w, &resp)
+}
+
+// enrollmentEventFilter parses the search parameters.
+func enrollmentEventFilter(q url.Values, now time.Time) (dl.EnrollmentEventFilter, error) {
+	f := dl.EnrollmentEventFilter{
+		AgentId:            q.Get("agent_id"),
+		EnrollmentApiKeyId: q.Get("enrollment_api_key_id"),
+		PolicyId:           q.Get("policy_id"),
+		SourceIp:           q.Get("source_ip"),
+		Outcome:            q.Get("outcome"),
+	}
+
+	switch f.Outcome {
+	case "", model.EnrollmentOutcomeSuccess, model.EnrollmentOutcomeFailure:
+	default:
+		return f, fmt.Errorf("invalid outcome %q", f.Outcome)
+	}
+	if since := q.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return f, fmt.Errorf("invalid since %q", since)
+		}
+		f.Since = now.Add(-d)
+	}
+	if size := q.Get("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 || n > dl.MaxEnrollmentEventsSize {
+			return f, fmt.Errorf("size must be between 1 and %d", dl.MaxEnrollmentEventsSize)
+		}
+		f.Size = n
+	}
+	return f, nil
+}
+
+func (eht *EnrollmentHistoryT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntEnrollHistory.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// newEnrollmentHistory returns the recorder of the enrollment history; nil
+// when disabled.
+func newEnrollmentHistory(cfg *config.Server) *historyRecorder {
+	if !cfg.EnrollmentHistory.Enabled {
+		return nil
+	}
+	return newHistoryRecorder("enrollment_history")
+}
+
+// recordEnrollment writes the enrollment attempt into the enrollment history
+// in the background, so the agent does not wait on it. Attempts turned away by
+// the rate limits are not recorded, they would flood the history when agents
+// storm the server.
+func recordEnrollment(history *historyRecorder, bulker bulk.Bulk, ev model.EnrollmentEvent, start time.Time, err error) {
+	if err == limit.ErrRateLimit || err == limit.ErrMaxLimit {
+		return
+	}
+
+	ev.Timestamp = start.UTC().Format(time.RFC3339Nano)
+	ev.LatencyMs = time.Since(start).Milliseconds()
+	ev.Outcome = model.EnrollmentOutcomeSuccess
+	if err != nil {
+		ev.Outcome = model.EnrollmentOutcomeFailure
+		ev.Error = err.Error()
+	}
+
+	history.record(ev.AgentId, func(ctx context.Context) error {
+		return dl.CreateEnrollmentEvent(ctx, bulker, ev)
+	})
+}
+
+// ensureEnrollmentHistory installs the template of the enrollment history data
+// stream, mapping its fields and deleting its events past their retention.
+func ensureEnrollmentHistory(ctx context.Context, esCli *elasticsearch.Client, cfg *config.EnrollmentHistory) error {
+	return es.EnsureDataStream(ctx, esCli, es.ResolveIndex(dl.FleetEnrollmentEvents), es.MappingEnrollmentEvent, cfg.Retention)
+}
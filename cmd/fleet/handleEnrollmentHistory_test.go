@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollmentEventFilter(t *testing.T) {
+	now := time.Now()
+
+	f, err := enrollmentEventFilter(url.Values{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, dl.EnrollmentEventFilter{}, f)
+
+	f, err = enrollmentEventFilter(url.Values{
+		"agent_id":              {"agent-1"},
+		"enrollment_api_key_id": {"key-1"},
+		"policy_id":             {"policy-1"},
+		"source_ip":             {"10.0.0.1"},
+		"outcome":               {"failure"},
+		"since":                 {"1h"},
+		"size":                  {"10"},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, dl.EnrollmentEventFilter{
+		AgentId:            "agent-1",
+		EnrollmentApiKeyId: "key-1",
+		PolicyId:           "policy-1",
+		SourceIp:           "10.0.0.1",
+		Outcome:            "failure",
+		Since:              now.Add(-time.Hour),
+		Size:               10,
+	}, f)
+
+	for _, q := range []url.Values{
+		{"outcome": {"maybe"}},
+		{"since": {"yesterday"}},
+		{"since": {"-1h"}},
+		{"size": {"0"}},
+		{"size": {"1001"}},
+	} {
+		_, err := enrollmentEventFilter(q, now)
+		assert.Error(t, err, q.Encode())
+	}
+}
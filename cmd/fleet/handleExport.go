@@ -0,0 +1,396 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	kExportNDJSON = "ndjson"
+	kExportCSV    = "csv"
+
+	kExportPageSize = 1000
+
+	// kExportId is the field of the agent ID, which is not in the source.
+	kExportId = "id"
+)
+
+// errExportAborted is returned when the client stops reading the export.
+var errExportAborted = errors.New("export aborted")
+
+// kExportDefaultFields are exported when no fields are asked for.
+var kExportDefaultFields = []string{
+	kExportId,
+	"policy_id",
+	"policy_revision_idx",
+	"last_checkin_status",
+	"last_checkin",
+	"agent.version",
+	"local_metadata.host.hostname",
+	"local_metadata.os.platform",
+	"tags",
+}
+
+// kExportFields are the top level fields of the agents that can be exported;
+// the API keys and the other internal fields of the agents cannot.
+var kExportFields = stringSet([]string{
+	"access_api_key_id",
+	"active",
+	"agent",
+	"components_summary",
+	"enrolled_at",
+	"enrollment_api_key_id",
+	"last_checkin",
+	"last_checkin_status",
+	"last_updated",
+	"local_metadata",
+	"namespaces",
+	"orphaned_at",
+	"packages",
+	"policy_id",
+	"policy_revision_idx",
+	"quarantine_reason",
+	"quarantined_at",
+	"shared_id",
+	"tags",
+	"type",
+	"unenrolled_at",
+	"upgraded_at",
+})
+
+type ExportT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+}
+
+func NewExportT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *ExportT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Agent export install limits")
+
+	return &ExportT{
+		bulk:  bulker,
+		cache: cache,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleExportAgents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.xt.handleExportAgents(w, r)
+
+	if err != nil {
+		code, str, msg, lvl := cntExport.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail agent export")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+// handleExportAgents streams the active agents matching the filter a page at
+// a time. The errors past the first page cannot be reported to the client
+// anymore; they end the export early and are logged.
+func (xt *ExportT) handleExportAgents(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := xt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, xt.bulk, xt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntExport.IncStart()
+	defer dfunc()
+
+	q := r.URL.Query()
+	enc, err := newExportEncoder(q.Get("format"))
+	if err != nil {
+		return err
+	}
+	fields, err := exportFields(q.Get("fields"))
+	if err != nil {
+		return err
+	}
+	filter := dl.ActiveAgentsFilter{
+		PolicyId: q.Get("policy_id"),
+		Status:   q.Get("status"),
+		Tags:     splitList(q.Get("tags")),
+	}
+
+	var source []string
+	for _, f := range fields {
+		if f != kExportId {
+			source = append(source, f)
+		}
+	}
+
+	// The response starts with the first page, so the errors before it are
+	// still reported to the client
+	var buf bytes.Buffer
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", enc.contentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="agents.%s"`, enc.name()))
+		w.WriteHeader(http.StatusOK)
+		return enc.header(&buf, fields)
+	}
+	// flush writes the rows buffered, returning errExportAborted when the client
+	// is gone
+	flush := func() error {
+		n, err := w.Write(buf.Bytes())
+		cntExport.bodyOut.Add(uint64(n))
+		if err != nil {
+			return fmt.Errorf("%w: %v", errExportAborted, err)
+		}
+		buf.Reset()
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	total := 0
+	err = dl.ForEachActiveAgents(r.Context(), xt.bulk, filter, source, kExportPageSize, func(hits []es.HitT) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		for _, hit := range hits {
+			values, err := exportValues(hit, fields)
+			if err != nil {
+				log.Warn().Err(err).Str("agentId", hit.Id).Msg("Skip agent with an invalid document in export")
+				continue
+			}
+			if err := enc.row(&buf, values); err != nil {
+				return err
+			}
+		}
+		total += len(hits)
+		return flush()
+	})
+	if err == nil && !started {
+		// No agents; the header only
+		if err = start(); err == nil {
+			err = flush()
+		}
+	}
+	switch {
+	case err == nil:
+	case !started:
+		return err
+	case errors.Is(err, errExportAborted):
+		log.Debug().Err(err).Int("agents", total).Msg("Agent export aborted by the client")
+		return nil
+	default:
+		log.Warn().Err(err).Int("agents", total).Msg("Agent export ended early")
+		return nil
+	}
+
+	log.Info().Int("agents", total).Str("format", enc.name()).Msg("Agents exported")
+	return nil
+}
+
+// exportFields parses the comma separated fields asked for.
+func exportFields(s string) ([]string, error) {
+	if s == "" {
+		return kExportDefaultFields, nil
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, f := range splitList(s) {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+
+		top := f
+		if i := strings.IndexByte(f, '.'); i >= 0 {
+			top = f[:i]
+		}
+		if f != kExportId && !kExportFields[top] {
+			return nil, fmt.Errorf("field %q cannot be exported", f)
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no field to export")
+	}
+	return fields, nil
+}
+
+// exportValues returns the values of the fields of the agent; nil for those
+// it does not have.
+func exportValues(hit es.HitT, fields []string) ([]interface{}, error) {
+	var src map[string]interface{}
+	if len(hit.Source) != 0 {
+		dec := json.NewDecoder(bytes.NewReader(hit.Source))
+		dec.UseNumber()
+		if err := dec.Decode(&src); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		if f == kExportId {
+			values[i] = hit.Id
+			continue
+		}
+		values[i] = lookupPath(src, f)
+	}
+	return values, nil
+}
+
+// lookupPath returns the value at the dotted path of the object.
+func lookupPath(obj map[string]interface{}, path string) interface{} {
+	var v interface{} = obj
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// splitList splits a comma separated list, dropping the empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// exportEncoder writes the exported agents in a format.
+type exportEncoder interface {
+	name() string
+	contentType() string
+	header(buf *bytes.Buffer, fields []string) error
+	row(buf *bytes.Buffer, values []interface{}) error
+}
+
+func newExportEncoder(format string) (exportEncoder, error) {
+	switch format {
+	case "", kExportNDJSON:
+		return &ndjsonEncoder{}, nil
+	case kExportCSV:
+		return &csvEncoder{}, nil
+	}
+	return nil, fmt.Errorf("invalid format %q; must be %s or %s", format, kExportNDJSON, kExportCSV)
+}
+
+// ndjsonEncoder writes an object per agent, its keys in the order of the
+// fields.
+type ndjsonEncoder struct {
+	keys [][]byte
+}
+
+func (e *ndjsonEncoder) name() string        { return kExportNDJSON }
+func (e *ndjsonEncoder) contentType() string { return "application/x-ndjson" }
+
+func (e *ndjsonEncoder) header(_ *bytes.Buffer, fields []string) error {
+	e.keys = make([][]byte, len(fields))
+	for i, f := range fields {
+		key, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		e.keys[i] = key
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) row(buf *bytes.Buffer, values []interface{}) error {
+	buf.WriteByte('{')
+	for i, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(e.keys[i])
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// csvEncoder writes a header line with the fields, then a line per agent. The
+// arrays and objects are written as JSON.
+type csvEncoder struct{}
+
+func (e *csvEncoder) name() string        { return kExportCSV }
+func (e *csvEncoder) contentType() string { return "text/csv; charset=utf-8" }
+
+func (e *csvEncoder) header(buf *bytes.Buffer, fields []string) error {
+	return writeCSV(buf, fields)
+}
+
+func (e *csvEncoder) row(buf *bytes.Buffer, values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch t := v.(type) {
+		case nil:
+		case string:
+			record[i] = t
+		case json.Number:
+			record[i] = t.String()
+		case bool:
+			record[i] = strconv.FormatBool(t)
+		default:
+			data, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			record[i] = string(data)
+		}
+	}
+	return writeCSV(buf, record)
+}
+
+func writeCSV(buf *bytes.Buffer, record []string) error {
+	cw := csv.NewWriter(buf)
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
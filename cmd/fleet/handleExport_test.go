@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+)
+
+func TestExportFields(t *testing.T) {
+	fields, err := exportFields("")
+	require.NoError(t, err)
+	assert.Equal(t, kExportDefaultFields, fields)
+
+	fields, err = exportFields(" id, local_metadata.host.hostname,id,,tags ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "local_metadata.host.hostname", "tags"}, fields)
+
+	for _, s := range []string{"default_api_key", "access_api_key_hash", "policy_id,default_api_key_id", ","} {
+		_, err := exportFields(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestExportEncoders(t *testing.T) {
+	hits := []es.HitT{
+		{
+			Id:     "agent-1",
+			Source: []byte(`{"policy_id": "policy-1", "policy_revision_idx": 3, "active": true, "tags": ["a", "b"], "local_metadata": {"host": {"hostname": "host, one"}}}`),
+		},
+		{
+			Id:     "agent-2",
+			Source: []byte(`{"policy_id": "policy-2"}`),
+		},
+	}
+	fields := []string{"id", "policy_id", "policy_revision_idx", "active", "tags", "local_metadata.host.hostname"}
+
+	encode := func(format string) string {
+		enc, err := newExportEncoder(format)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, enc.header(&buf, fields))
+		for _, hit := range hits {
+			values, err := exportValues(hit, fields)
+			require.NoError(t, err)
+			require.NoError(t, enc.row(&buf, values))
+		}
+		return buf.String()
+	}
+
+	assert.Equal(t,
+		`{"id":"agent-1","policy_id":"policy-1","policy_revision_idx":3,"active":true,"tags":["a","b"],"local_metadata.host.hostname":"host, one"}`+"\n"+
+			`{"id":"agent-2","policy_id":"policy-2","policy_revision_idx":null,"active":null,"tags":null,"local_metadata.host.hostname":null}`+"\n",
+		encode(""))
+
+	assert.Equal(t,
+		"id,policy_id,policy_revision_idx,active,tags,local_metadata.host.hostname\n"+
+			`agent-1,policy-1,3,true,"[""a"",""b""]","host, one"`+"\n"+
+			"agent-2,policy-2,,,,\n",
+		encode("csv"))
+
+	_, err := newExportEncoder("xml")
+	assert.Error(t, err)
+}
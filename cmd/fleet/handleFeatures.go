@@ -0,0 +1,205 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/miolini/datacounter"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoFeatureState = errors.New("feature flag state not given")
+
+type FeaturesT struct {
+	limit    *limit.Limiter
+	bulk     bulk.Bulk
+	cache    cache.Cache
+	registry *feature.Registry
+}
+
+func NewFeaturesT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, registry *feature.Registry) *FeaturesT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Features install limits")
+
+	return &FeaturesT{
+		bulk:     bulker,
+		cache:    cache,
+		registry: registry,
+		limit:    limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+// applyFeatures sets the feature flags from the configuration of the server.
+func applyFeatures(cfg *config.Server) {
+	if unknown := feature.Default.Configure(cfg.Features); len(unknown) != 0 {
+		log.Warn().Strs("features", unknown).Msg("Ignore unknown feature flags")
+	}
+}
+
+// withoutFeatures removes the feature flags from the changed settings; they
+// apply without restarting the server. changed is left unmodified.
+func withoutFeatures(changed []string) []string {
+	kept := make([]string, 0, len(changed))
+	for _, name := range changed {
+		if name != "server.features" {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+func featureFlag(s feature.State) FeatureFlag {
+	return FeatureFlag{
+		Name:        s.Name,
+		Description: s.Description,
+		Default:     s.Default,
+		Enabled:     s.Enabled,
+		Source:      s.Source,
+	}
+}
+
+func (rt Router) handleFeatures(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.ft.handleFeatures(w, r)
+
+	if err != nil {
+		rt.ft.writeError(w, err, "Fail feature flags list")
+	}
+}
+
+func (rt Router) handleOverrideFeature(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+
+	err := rt.ft.handleOverride(w, r, name, true)
+
+	if err != nil {
+		rt.ft.writeError(w, err, "Fail feature flag override")
+	}
+}
+
+func (rt Router) handleClearFeatureOverride(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+
+	err := rt.ft.handleOverride(w, r, name, false)
+
+	if err != nil {
+		rt.ft.writeError(w, err, "Fail clear feature flag override")
+	}
+}
+
+func (ft *FeaturesT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntFeatures.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (ft *FeaturesT) handleFeatures(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := ft.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, ft.bulk, ft.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntFeatures.IncStart()
+	defer dfunc()
+
+	states := ft.registry.List()
+
+	resp := FeatureFlagList{
+		Items: make([]FeatureFlag, len(states)),
+	}
+	for i, s := range states {
+		resp.Items[i] = featureFlag(s)
+	}
+
+	return ft.writeResponse(w, &resp)
+}
+
+// handleOverride overrides the flag with the state of the request body, or
+// clears its override.
+func (ft *FeaturesT) handleOverride(w http.ResponseWriter, r *http.Request, name string, override bool) error {
+	limitF, err := ft.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, ft.bulk, ft.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntFeatures.IncStart()
+	defer dfunc()
+
+	var req FeatureFlagOverride
+	if override {
+		readCounter := datacounter.NewReaderCounter(r.Body)
+		if err := json.NewDecoder(readCounter).Decode(&req); err != nil {
+			return err
+		}
+		cntFeatures.bodyIn.Add(readCounter.Count())
+
+		if req.Enabled == nil {
+			return ErrNoFeatureState
+		}
+	}
+
+	state, err := ft.registry.Override(name, req.Enabled)
+	if err != nil {
+		return err
+	}
+
+	overridden := "cleared"
+	if req.Enabled != nil {
+		overridden = strconv.FormatBool(*req.Enabled)
+	}
+	auditLog("feature-override", "success").
+		Str("feature", name).
+		Str("override", overridden).
+		Bool("enabled", state.Enabled).
+		Str("operator", key.Id).
+		Msg("Feature flag overridden")
+
+	return ft.writeResponse(w, featureFlag(state))
+}
+
+func (ft *FeaturesT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntFeatures.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutFeatures(t *testing.T) {
+	assert.Empty(t, withoutFeatures([]string{"server.features"}))
+	changed := []string{"server.limits", "server.features", "cache"}
+	assert.Equal(t, []string{"server.limits", "cache"}, withoutFeatures(changed))
+	assert.Equal(t, []string{"server.limits", "server.features", "cache"}, changed)
+	assert.Empty(t, withoutFeatures(nil))
+}
@@ -0,0 +1,203 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// Steps of the deep health check, in order.
+const (
+	kDeepStepWrite  = "write"
+	kDeepStepRead   = "read"
+	kDeepStepFlush  = "bulk_flush"
+	kDeepStepDelete = "delete"
+)
+
+// kDeepHealthTimeout bounds a deep health check; the delete of the canary is
+// given as long again.
+const kDeepHealthTimeout = 10 * time.Second
+
+var ErrCanaryMismatch = errors.New("canary read back differs from the one written")
+
+// canaryDoc is the document the deep health check writes.
+type canaryDoc struct {
+	Timestamp string `json:"@timestamp"`
+	ServerId  string `json:"server_id,omitempty"`
+	Nonce     string `json:"nonce"`
+}
+
+// HealthzDeepT checks the write path to Elasticsearch the agents depend on,
+// which the status endpoint does not exercise: a canary document goes through
+// the bulker to the .fleet-health index, is read back, updated in a bulk
+// flush that changes nothing and deleted.
+type HealthzDeepT struct {
+	limit    *limit.Limiter
+	bulk     bulk.Bulk
+	cache    cache.Cache
+	serverId string
+	deleteF  func(ctx context.Context, bulker bulk.Bulk, index, id string) error
+}
+
+func NewHealthzDeepT(cfg *config.Server, serverId string, bulker bulk.Bulk, cache cache.Cache) *HealthzDeepT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Deep health check install limits")
+
+	return &HealthzDeepT{
+		bulk:     bulker,
+		cache:    cache,
+		serverId: serverId,
+		deleteF:  dl.DeleteDocument,
+		limit:    limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleHealthzDeep(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.hdt.handleHealthzDeep(w, r)
+
+	if err != nil {
+		code, str, errMsg, lvl := cntHealthzDeep.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail deep health check")
+
+		if err := WriteError(w, code, str, errMsg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (hdt *HealthzDeepT) handleHealthzDeep(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := hdt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, hdt.bulk, hdt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntHealthzDeep.IncStart()
+	defer dfunc()
+
+	resp := hdt.check(r.Context())
+	if !resp.Healthy {
+		log.Warn().Interface("steps", resp.Steps).Msg("Deep health check failed")
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+
+	code := http.StatusOK
+	if !resp.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntHealthzDeep.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// check runs the steps until one fails; the canary is deleted once written
+// whatever the outcome of the steps after the write.
+func (hdt *HealthzDeepT) check(ctx context.Context) DeepHealth {
+	start := time.Now()
+	resp := DeepHealth{Healthy: true}
+
+	step := func(name string, fn func(ctx context.Context) error) bool {
+		ctx, cancel := context.WithTimeout(ctx, kDeepHealthTimeout)
+		defer cancel()
+
+		stepStart := time.Now()
+		err := fn(ctx)
+		s := DeepHealthStep{Name: name, Took: time.Since(stepStart).Seconds()}
+		if err != nil {
+			s.Error = err.Error()
+			resp.Healthy = false
+		}
+		resp.Steps = append(resp.Steps, s)
+		return err == nil
+	}
+
+	id := uuid.Must(uuid.NewV4()).String()
+	canary := canaryDoc{
+		Timestamp: start.UTC().Format(time.RFC3339Nano),
+		ServerId:  hdt.serverId,
+		Nonce:     id,
+	}
+	body, err := json.Marshal(&canary)
+	if err != nil {
+		resp.Healthy = false
+		resp.Steps = append(resp.Steps, DeepHealthStep{Name: kDeepStepWrite, Error: err.Error()})
+		return resp
+	}
+
+	written := step(kDeepStepWrite, func(ctx context.Context) error {
+		_, err := hdt.bulk.Create(ctx, dl.FleetHealth, id, body)
+		return err
+	})
+	if !written {
+		resp.Took = time.Since(start).Seconds()
+		return resp
+	}
+
+	read := step(kDeepStepRead, func(ctx context.Context) error {
+		data, err := hdt.bulk.Read(ctx, dl.FleetHealth, id)
+		if err != nil {
+			return err
+		}
+		var got canaryDoc
+		if err := json.Unmarshal(data, &got); err != nil {
+			return err
+		}
+		if got != canary {
+			return ErrCanaryMismatch
+		}
+		return nil
+	})
+	if read {
+		// Goes through a flush of the bulker like the checkins do
+		step(kDeepStepFlush, func(ctx context.Context) error {
+			return hdt.bulk.Update(ctx, dl.FleetHealth, id, []byte(`{"doc":`+string(body)+`}`))
+		})
+	}
+
+	// Not canceled with the request, so the canary does not linger
+	step(kDeepStepDelete, func(_ context.Context) error {
+		ctx, cancel := context.WithTimeout(context.Background(), kDeepHealthTimeout)
+		defer cancel()
+		return hdt.deleteF(ctx, hdt.bulk, dl.FleetHealth, id)
+	})
+
+	resp.Took = time.Since(start).Seconds()
+	return resp
+}
@@ -0,0 +1,104 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// canaryBulk holds the documents written; readErr fails the reads and
+// corrupt stores another document than the one written.
+type canaryBulk struct {
+	ftesting.MockBulk
+	docs    map[string][]byte
+	updates int
+	readErr error
+	corrupt bool
+}
+
+func (m *canaryBulk) Create(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) (string, error) {
+	if m.corrupt {
+		body = []byte(`{"nonce":"other"}`)
+	}
+	m.docs[index+"/"+id] = body
+	return id, nil
+}
+
+func (m *canaryBulk) Read(ctx context.Context, index, id string, opts ...bulk.Opt) ([]byte, error) {
+	if m.readErr != nil {
+		return nil, m.readErr
+	}
+	return m.docs[index+"/"+id], nil
+}
+
+func (m *canaryBulk) Update(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) error {
+	m.updates++
+	return nil
+}
+
+func newTestHealthzDeepT(bulker *canaryBulk) *HealthzDeepT {
+	return &HealthzDeepT{
+		bulk:     bulker,
+		serverId: "server-1",
+		deleteF: func(ctx context.Context, _ bulk.Bulk, index, id string) error {
+			delete(bulker.docs, index+"/"+id)
+			return nil
+		},
+	}
+}
+
+func stepNames(steps []DeepHealthStep) []string {
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func TestHealthzDeepCheck(t *testing.T) {
+	bulker := &canaryBulk{docs: make(map[string][]byte)}
+	resp := newTestHealthzDeepT(bulker).check(context.Background())
+
+	require.True(t, resp.Healthy, "%+v", resp)
+	assert.Equal(t, []string{kDeepStepWrite, kDeepStepRead, kDeepStepFlush, kDeepStepDelete}, stepNames(resp.Steps))
+	assert.Equal(t, 1, bulker.updates)
+	assert.Empty(t, bulker.docs)
+	for _, s := range resp.Steps {
+		assert.Empty(t, s.Error)
+	}
+}
+
+func TestHealthzDeepCheckReadFails(t *testing.T) {
+	bulker := &canaryBulk{docs: make(map[string][]byte), readErr: errors.New("boom")}
+	resp := newTestHealthzDeepT(bulker).check(context.Background())
+
+	// The flush is skipped, the canary deleted all the same
+	assert.False(t, resp.Healthy)
+	assert.Equal(t, []string{kDeepStepWrite, kDeepStepRead, kDeepStepDelete}, stepNames(resp.Steps))
+	assert.Equal(t, "boom", resp.Steps[1].Error)
+	assert.Zero(t, bulker.updates)
+	assert.Empty(t, bulker.docs)
+}
+
+func TestHealthzDeepCheckMismatch(t *testing.T) {
+	bulker := &canaryBulk{docs: make(map[string][]byte), corrupt: true}
+	resp := newTestHealthzDeepT(bulker).check(context.Background())
+
+	assert.False(t, resp.Healthy)
+	require.Len(t, resp.Steps, 3)
+	assert.Equal(t, kDeepStepRead, resp.Steps[1].Name)
+	assert.Equal(t, ErrCanaryMismatch.Error(), resp.Steps[1].Error)
+	assert.Empty(t, bulker.docs)
+}
@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"compress/flate"
+	"encoding/json"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// LimitsT tells the agents the limits in effect on this server, so they can
+// size their requests to them.
+type LimitsT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+	resp  LimitsResponse
+}
+
+func NewLimitsT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *LimitsT {
+	// As cheap as a checkin poll, and as frequent at most
+	log.Info().
+		Interface("limits", cfg.Limits.CheckinPollLimit).
+		Msg("Limits install limits")
+
+	resp := LimitsResponse{
+		MaxBodyByteSize: BodySizeLimits{
+			Checkin:     cfg.Limits.CheckinLimit.MaxBody,
+			Acks:        cfg.Limits.AckLimit.MaxBody,
+			OtlpMetrics: cfg.Limits.TelemetryLimit.MaxBody,
+		},
+		MaxHeaderByteSize: int64(cfg.Limits.MaxHeaderByteSize),
+		Checkin: CheckinLimits{
+			LongPollTimeout: cfg.Timeouts.CheckinLongPoll.Seconds(),
+		},
+		ApiKeyRate: RateLimit{
+			Interval: cfg.Limits.ApiKeyLimit.Interval.Seconds(),
+			Burst:    int64(cfg.Limits.ApiKeyLimit.Burst),
+			Block:    cfg.Limits.ApiKeyLimit.Block.Seconds(),
+		},
+		Compression: CompressionLimits{
+			Request:           []string{kEncodingGzip, kEncodingZstd},
+			Response:          []string{},
+			ResponseThreshold: int64(cfg.CompressionThresh),
+		},
+	}
+	if cfg.CompressionLevel != flate.NoCompression {
+		resp.Compression.Response = []string{kEncodingGzip}
+	}
+
+	return &LimitsT{
+		bulk:  bulker,
+		cache: cache,
+		limit: limit.NewLimiter(&cfg.Limits.CheckinPollLimit),
+		resp:  resp,
+	}
+}
+
+func (rt Router) handleLimits(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.lt.handleLimits(w, r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntLimits.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("agentId", id).
+			Int("code", code).
+			Msg("Fail limits")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (lt *LimitsT) handleLimits(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := lt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	agent, err := authAgent(r, id, lt.bulk, lt.cache)
+	if err != nil {
+		return err
+	}
+	setBodySizePolicy(r, agent.PolicyId)
+
+	dfunc := cntLimits.IncStart()
+	defer dfunc()
+
+	data, err := json.Marshal(&lt.resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	nWritten, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+	cntLimits.bodyOut.Add(uint64(nWritten))
+	return nil
+}
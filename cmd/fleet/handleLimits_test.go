@@ -0,0 +1,50 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"compress/flate"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestLimitsResponse(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+
+	lt := NewLimitsT(cfg, nil, cache.Cache{})
+	assert.Equal(t, LimitsResponse{
+		MaxBodyByteSize: BodySizeLimits{
+			Checkin:     1024 * 1024,
+			Acks:        2 * 1024 * 1024,
+			OtlpMetrics: 1024 * 1024,
+		},
+		MaxHeaderByteSize: 8192,
+		Checkin:           CheckinLimits{LongPollTimeout: 300},
+		ApiKeyRate:        RateLimit{Interval: 0.1, Burst: 100, Block: 300},
+		Compression: CompressionLimits{
+			Request:           []string{"gzip", "zstd"},
+			Response:          []string{"gzip"},
+			ResponseThreshold: 1024,
+		},
+	}, lt.resp)
+
+	cfg.CompressionLevel = flate.NoCompression
+	lt = NewLimitsT(cfg, nil, cache.Cache{})
+	data, err := json.Marshal(&lt.resp)
+	require.NoError(t, err)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &resp))
+	assert.Equal(t, []interface{}{}, resp["compression"].(map[string]interface{})["response"])
+}
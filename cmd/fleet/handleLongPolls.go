@@ -0,0 +1,176 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/miolini/datacounter"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoLongPollFilter = errors.New("no long poll condition given")
+
+type LongPollsT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+	polls *longPolls
+}
+
+func NewLongPollsT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, polls *longPolls) *LongPollsT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Long polls install limits")
+
+	return &LongPollsT{
+		bulk:  bulker,
+		cache: cache,
+		polls: polls,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleLongPolls(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.lpt.handleLongPolls(w, r)
+
+	if err != nil {
+		rt.lpt.writeError(w, err, "Fail long polls")
+	}
+}
+
+func (rt Router) handleLongPollsDisconnect(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.lpt.handleLongPollsDisconnect(w, r)
+
+	if err != nil {
+		rt.lpt.writeError(w, err, "Fail long polls disconnect")
+	}
+}
+
+func (lpt *LongPollsT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntLongPolls.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (lpt *LongPollsT) handleLongPolls(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := lpt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, lpt.bulk, lpt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntLongPolls.IncStart()
+	defer dfunc()
+
+	stats := lpt.polls.stats()
+
+	return lpt.writeResponse(w, &LongPollStats{
+		Open:   int64(stats.Open),
+		Oldest: stats.Oldest.Seconds(),
+		Mean:   stats.Mean.Seconds(),
+	})
+}
+
+func (lpt *LongPollsT) handleLongPollsDisconnect(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := lpt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, lpt.bulk, lpt.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntLongPolls.IncStart()
+	defer dfunc()
+
+	readCounter := datacounter.NewReaderCounter(r.Body)
+
+	var req LongPollDisconnectRequest
+	if err := json.NewDecoder(readCounter).Decode(&req); err != nil {
+		return err
+	}
+
+	cntLongPolls.bodyIn.Add(readCounter.Count())
+
+	filter, err := req.filter()
+	if err != nil {
+		return err
+	}
+
+	n := lpt.polls.disconnect(filter)
+
+	auditLog("long-poll-disconnect", "success").
+		Str("operator", key.Id).
+		Str("older_than", req.OlderThan).
+		Str("agent.id", req.AgentId).
+		Str("policy.id", req.PolicyId).
+		Int("disconnected", n).
+		Msg("Disconnected long polls")
+
+	return lpt.writeResponse(w, &LongPollDisconnectResponse{Disconnected: int64(n)})
+}
+
+func (req *LongPollDisconnectRequest) filter() (longPollFilter, error) {
+	if req.OlderThan == "" && req.AgentId == "" && req.PolicyId == "" {
+		return longPollFilter{}, ErrNoLongPollFilter
+	}
+
+	f := longPollFilter{
+		agentId:  req.AgentId,
+		policyId: req.PolicyId,
+	}
+	if req.OlderThan != "" {
+		d, err := time.ParseDuration(req.OlderThan)
+		if err != nil {
+			return f, fmt.Errorf("invalid older_than: %w", err)
+		}
+		if d < 0 {
+			return f, fmt.Errorf("older_than must not be negative")
+		}
+		f.olderThan = d
+	}
+	return f, nil
+}
+
+func (lpt *LongPollsT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntLongPolls.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// kPreviewApiKey stands for the API key of the default output, as each agent
+// is sent its own.
+const kPreviewApiKey = "<output_api_key>"
+
+var (
+	ErrPreviewPolicyNotFound = errors.New("policy not found in the spaces of the profile")
+	ErrPolicyNotSent         = errors.New("policy would not be sent")
+)
+
+type PolicyPreviewT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+}
+
+func NewPolicyPreviewT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *PolicyPreviewT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Policy preview install limits")
+
+	return &PolicyPreviewT{
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+		bulk:  bulker,
+		cache: cache,
+	}
+}
+
+func (rt Router) handlePolicyPreview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.ppt.handlePolicyPreview(w, r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntPolicyPreview.IncError(err)
+
+		// The reason is what the tooling previewing the policy is after
+		if errors.Is(err, ErrPolicyNotSent) {
+			code, str, msg, lvl = http.StatusUnprocessableEntity, "PolicyNotSent", err.Error(), zerolog.InfoLevel
+		}
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("policyId", id).
+			Int("code", code).
+			Msg("Fail policy preview")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+// handlePolicyPreview returns the latest revision of the policy as it would
+// be sent to an agent of the profile of the request.
+func (ppt *PolicyPreviewT) handlePolicyPreview(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := ppt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, ppt.bulk, ppt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntPolicyPreview.IncStart()
+	defer dfunc()
+
+	var req PolicyPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+
+	// The policies of the other spaces are never sent to the agent
+	p, err := dl.FindLatestPolicyInSpaces(r.Context(), ppt.bulk, id, req.Namespaces)
+	if errors.Is(err, dl.ErrNotFound) {
+		return ErrPreviewPolicyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := previewPolicy(p, &req)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	n, err := w.Write(data)
+	cntPolicyPreview.bodyOut.Add(uint64(n))
+	return err
+}
+
+// previewPolicy renders the policy as processPolicy does for an agent of the
+// profile, with the API key of the default output stubbed and the fields
+// holding secrets redacted. The errors that would keep the policy from being
+// sent wrap ErrPolicyNotSent.
+func previewPolicy(p model.Policy, req *PolicyPreviewRequest) (*PolicyPreviewResponse, error) {
+	pp, err := policy.NewParsedPolicy(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPolicyNotSent, err)
+	}
+
+	defaultRole, ok := pp.Roles[policy.DefaultOutputName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrPolicyNotSent, ErrNoOutputPerms)
+	}
+
+	r := policy.RevisionFromPolicy(p)
+	rendered, err := rewritePolicy(pp, policy.Platform{OS: req.Os, Arch: req.Arch}, kPreviewApiKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPolicyNotSent, err)
+	}
+
+	return &PolicyPreviewResponse{
+		PolicyId:              p.PolicyId,
+		Revision:              r.String(),
+		OutputPermissionsHash: defaultRole.Sha2,
+		Data:                  redact.Object(rendered),
+	}, nil
+}
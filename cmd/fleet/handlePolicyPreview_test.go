@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+const testPreviewPolicy = `{
+	"id": "policy",
+	"outputs": {"default": {"type": "elasticsearch", "hosts": ["${platform.host}"]}},
+	"output_permissions": {"default": {"_elastic_agent_checks": {"cluster": ["monitor"]}}},
+	"inputs": [{"type": "httpjson", "password": "hunter2"}],
+	"platform_vars": {"default": {"host": "es:9200"}, "windows": {"host": "es-win:9200"}}
+}`
+
+func TestPreviewPolicy(t *testing.T) {
+	p := model.Policy{PolicyId: "policy", RevisionIdx: 3, CoordinatorIdx: 1, Data: json.RawMessage(testPreviewPolicy)}
+
+	resp, err := previewPolicy(p, &PolicyPreviewRequest{Os: "windows", Arch: "amd64"})
+	require.NoError(t, err)
+	assert.Equal(t, "policy", resp.PolicyId)
+	assert.Equal(t, "policy:policy:3:1", resp.Revision)
+	assert.NotEmpty(t, resp.OutputPermissionsHash)
+	assert.JSONEq(t, `{"policy": {
+		"id": "policy",
+		"outputs": {"default": {"type": "elasticsearch", "hosts": ["es-win:9200"], "api_key": "[REDACTED]"}},
+		"output_permissions": {"default": {"_elastic_agent_checks": {"cluster": ["monitor"]}}},
+		"inputs": [{"type": "httpjson", "password": "[REDACTED]"}]
+	}}`, string(resp.Data))
+
+	resp, err = previewPolicy(p, &PolicyPreviewRequest{Os: "linux"})
+	require.NoError(t, err)
+	var data struct {
+		Policy struct {
+			Outputs map[string]struct {
+				Hosts []string `json:"hosts"`
+			} `json:"outputs"`
+		} `json:"policy"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &data))
+	assert.Equal(t, []string{"es:9200"}, data.Policy.Outputs["default"].Hosts)
+
+	p.Data = json.RawMessage(`{"outputs": {"default": {"type": "elasticsearch"}}}`)
+	_, err = previewPolicy(p, &PolicyPreviewRequest{})
+	assert.True(t, errors.Is(err, ErrPolicyNotSent))
+}
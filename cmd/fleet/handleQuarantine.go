@@ -0,0 +1,277 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/miolini/datacounter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// QuarantineReasonOperator is recorded on the agents quarantined through
+	// the admin API without a reason.
+	QuarantineReasonOperator = "operator"
+
+	// QuarantineReasonKeyBlocked is recorded on the agents quarantined for
+	// exceeding the rate limit of their access API key.
+	QuarantineReasonKeyBlocked = "key_blocked"
+)
+
+// quarantineActionTypes are the actions delivered to the quarantined agents.
+var quarantineActionTypes = map[string]bool{
+	TypeUnenroll:    true,
+	TypeDiagnostics: true,
+}
+
+// isQuarantined tells whether the agent is quarantined: it checks in but
+// receives no policy, and so no output API key, and only the actions to
+// unenroll it or collect its diagnostics.
+func isQuarantined(agent *model.Agent) bool {
+	return agent.QuarantinedAt != ""
+}
+
+// quarantineActions returns the actions delivered to a quarantined agent. The
+// actions may be shared with other agents, so they are copied when some are
+// suppressed.
+func quarantineActions(actions []model.Action) []model.Action {
+	n := 0
+	for _, a := range actions {
+		if quarantineActionTypes[a.Type] {
+			n++
+		}
+	}
+	if n == len(actions) {
+		return actions
+	}
+
+	cntQuarantineSuppressed.Add(uint64(len(actions) - n))
+	allowed := make([]model.Action, 0, n)
+	for _, a := range actions {
+		if quarantineActionTypes[a.Type] {
+			allowed = append(allowed, a)
+		}
+	}
+	return allowed
+}
+
+type QuarantineT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+	polls *longPolls
+	now   func() time.Time
+}
+
+func NewQuarantineT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, polls *longPolls) *QuarantineT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Quarantine install limits")
+
+	return &QuarantineT{
+		bulk:  bulker,
+		cache: cache,
+		polls: polls,
+		now:   time.Now,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleQuarantine(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.qt.handleQuarantine(w, r, id)
+
+	if err != nil {
+		rt.qt.writeError(w, err, "Fail quarantine agent")
+	}
+}
+
+func (rt Router) handleRelease(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.qt.handleRelease(w, r, id)
+
+	if err != nil {
+		rt.qt.writeError(w, err, "Fail release agent from quarantine")
+	}
+}
+
+func (qt *QuarantineT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntQuarantine.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (qt *QuarantineT) handleQuarantine(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := qt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, qt.bulk, qt.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntQuarantine.IncStart()
+	defer dfunc()
+
+	readCounter := datacounter.NewReaderCounter(r.Body)
+
+	var req QuarantineRequest
+	if err := json.NewDecoder(readCounter).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	cntQuarantine.bodyIn.Add(readCounter.Count())
+
+	if req.Reason == "" {
+		req.Reason = QuarantineReasonOperator
+	}
+
+	agent, err := qt.findAgent(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	if err := qt.quarantine(r.Context(), agent, req.Reason); err != nil {
+		return err
+	}
+
+	auditLog("agent-quarantine", "success").
+		Str("agent_id", id).
+		Str("reason", req.Reason).
+		Str("operator", key.Id).
+		Msg("Agent quarantined")
+
+	return nil
+}
+
+func (qt *QuarantineT) handleRelease(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := qt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, qt.bulk, qt.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntQuarantine.IncStart()
+	defer dfunc()
+
+	agent, err := qt.findAgent(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	doc := bulk.UpdateFields{
+		dl.FieldQuarantinedAt:    nil,
+		dl.FieldQuarantineReason: nil,
+		dl.FieldUpdatedAt:        qt.now().UTC().Format(time.RFC3339),
+	}
+	if err := qt.update(r.Context(), agent.Id, doc); err != nil {
+		return err
+	}
+
+	auditLog("agent-release", "success").
+		Str("agent_id", id).
+		Str("operator", key.Id).
+		Msg("Agent released from quarantine")
+
+	return nil
+}
+
+// quarantineBlocked quarantines the agent of the access API key of the
+// request, blocked for exceeding its rate limit. The key is authenticated
+// first so a request forging the key of an agent does not quarantine it.
+func (qt *QuarantineT) quarantineBlocked(r *http.Request) {
+	key, err := authApiKey(r, qt.bulk.Client(), qt.cache)
+	if err != nil {
+		return
+	}
+
+	agent, err := findAgentByApiKeyId(r.Context(), qt.bulk, key.Id)
+	if err != nil || !agent.Active || isQuarantined(agent) {
+		return
+	}
+
+	if err := qt.quarantine(r.Context(), agent, QuarantineReasonKeyBlocked); err != nil {
+		log.Warn().
+			Err(err).
+			Str("agent_id", agent.Id).
+			Msg("Fail to quarantine agent of blocked API key")
+		return
+	}
+
+	auditLog("agent-quarantine", "success").
+		Str("agent_id", agent.Id).
+		Str("reason", QuarantineReasonKeyBlocked).
+		Str("id", key.Id).
+		Msg("Agent quarantined for exceeding the rate limit of its API key")
+}
+
+// quarantine marks the agent quarantined and ends its open long polls so the
+// quarantine applies from its next checkin.
+func (qt *QuarantineT) quarantine(ctx context.Context, agent *model.Agent, reason string) error {
+	now := qt.now().UTC().Format(time.RFC3339)
+	doc := bulk.UpdateFields{
+		dl.FieldQuarantinedAt:    now,
+		dl.FieldQuarantineReason: reason,
+		dl.FieldUpdatedAt:        now,
+	}
+	if err := qt.update(ctx, agent.Id, doc); err != nil {
+		return err
+	}
+
+	cntQuarantined.Inc()
+	if qt.polls != nil {
+		qt.polls.disconnect(longPollFilter{agentId: agent.Id})
+	}
+	return nil
+}
+
+func (qt *QuarantineT) findAgent(ctx context.Context, id string) (*model.Agent, error) {
+	agent, err := dl.FindAgent(ctx, qt.bulk, dl.QueryAgentByID, dl.FieldId, id)
+	if errors.Is(err, dl.ErrNotFound) {
+		return nil, ErrAgentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+func (qt *QuarantineT) update(ctx context.Context, id string, doc bulk.UpdateFields) error {
+	body, err := doc.Marshal()
+	if err != nil {
+		return err
+	}
+	return qt.bulk.Update(ctx, dl.FleetAgents, id, body, bulk.WithRefresh())
+}
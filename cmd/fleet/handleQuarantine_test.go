@@ -0,0 +1,45 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantineActions(t *testing.T) {
+	allowed := []model.Action{
+		{ActionId: "1", Type: TypeUnenroll},
+		{ActionId: "2", Type: TypeDiagnostics},
+	}
+	out := quarantineActions(allowed)
+	assert.Same(t, &allowed[0], &out[0])
+
+	mixed := []model.Action{
+		{ActionId: "1", Type: TypePolicyChange},
+		{ActionId: "2", Type: TypeDiagnostics},
+		{ActionId: "3", Type: TypeUpgrade},
+		{ActionId: "4", Type: TypeUnenroll},
+	}
+	out = quarantineActions(mixed)
+	assert.Equal(t, []model.Action{
+		{ActionId: "2", Type: TypeDiagnostics},
+		{ActionId: "4", Type: TypeUnenroll},
+	}, out)
+	// The actions dispatched are shared and left untouched
+	assert.Equal(t, "1", mixed[0].ActionId)
+
+	assert.Empty(t, quarantineActions([]model.Action{{Type: TypeUpgrade}}))
+}
+
+func TestIsQuarantined(t *testing.T) {
+	assert.False(t, isQuarantined(&model.Agent{}))
+	assert.True(t, isQuarantined(&model.Agent{QuarantinedAt: "2021-06-01T00:00:00Z", QuarantineReason: QuarantineReasonOperator}))
+}
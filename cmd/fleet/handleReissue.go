@@ -0,0 +1,254 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/miolini/datacounter"
+	"github.com/rs/zerolog/log"
+)
+
+const kReissueMod = "reissue"
+
+var (
+	ErrReissueDenied   = errors.New("access API key reissue denied")
+	ErrReissueKeyValid = errors.New("access API key is still valid")
+)
+
+// accessApiKeyHash is kept on the agent record so an agent can prove it holds
+// its access API key once elasticsearch no longer authenticates it.
+func accessApiKeyHash(key apikey.ApiKey) string {
+	sum := sha256.Sum256([]byte(key.Key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (rt Router) handleReissue(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	start := time.Now()
+
+	id := ps.ByName("id")
+
+	data, err := rt.et.handleReissue(r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntReissue.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("mod", kReissueMod).
+			Str("agentId", id).
+			Int("code", code).
+			Dur("tdiff", time.Since(start)).
+			Msg("Reissue fail")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+		return
+	}
+
+	var numWritten int
+	if numWritten, err = w.Write(data); err != nil {
+		log.Error().Err(err).Msg("fail send reissue response")
+	}
+
+	cntReissue.bodyOut.Add(uint64(numWritten))
+
+	log.Trace().
+		Str("mod", kReissueMod).
+		Str("agentId", id).
+		Dur("rtt", time.Since(start)).
+		Msg("handleReissue OK")
+}
+
+// handleReissue issues a new access API key to an agent whose key was
+// invalidated, without enrolling it again. The request is authenticated with
+// the enrollment API key the agent enrolled with and carries the invalidated
+// access API key, which must match the one recorded for the agent.
+func (et *EnrollerT) handleReissue(r *http.Request, id string) ([]byte, error) {
+
+	limitF, err := et.reissueLimit.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer limitF()
+
+	key, err := authApiKey(r, et.bulker.Client(), et.cache)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateUserAgent(r, et.reissueUA)
+	if err != nil {
+		return nil, err
+	}
+
+	// Metrics; serenity now.
+	dfunc := cntReissue.IncStart()
+	defer dfunc()
+
+	ctx := r.Context()
+
+	// The enrollment key must still be active
+	if _, err := et.fetchEnrollmentKeyRecord(ctx, key.Id); err != nil {
+		return nil, err
+	}
+
+	readCounter := datacounter.NewReaderCounter(r.Body)
+
+	var req ReissueRequest
+	if err := json.NewDecoder(readCounter).Decode(&req); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	cntReissue.bodyIn.Add(readCounter.Count())
+
+	held, err := apikey.NewApiKeyFromToken(req.AccessAPIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	agent, err := dl.FindAgent(ctx, et.bulker, dl.QueryAgentByID, dl.FieldId, id)
+	if errors.Is(err, dl.ErrNotFound) {
+		err = ErrAgentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deny := func(reason string) error {
+		auditLog("access-api-key-reissue", "failure").
+			Str("agent.id", id).
+			Str("enrollment_api_key.id", key.Id).
+			Str("access_api_key.id", held.Id).
+			Str("remote", remoteIP(r)).
+			Str("reason", reason).
+			Msg("Access API key reissue denied")
+		return ErrReissueDenied
+	}
+
+	// Back off repeated guesses of the access key like failed authentications
+	if failure, ok := et.cache.GetAuthFailure(*held); ok && time.Now().Before(failure.Until) {
+		cntAuthSuppressed.Inc()
+		return nil, deny("access API key recently rejected")
+	}
+
+	if err := verifyReissue(&agent, key.Id, *held); err != nil {
+		if errors.Is(err, errReissueKeyMismatch) {
+			cacheAuthFailure(et.cache, *held, ErrReissueDenied)
+		}
+		return nil, deny(err.Error())
+	}
+
+	// Only agents locked out need a new key
+	if info, err := held.Authenticate(ctx, et.bulker.Client()); err == nil && info.Enabled {
+		return nil, ErrReissueKeyValid
+	} else if err != nil && !errors.Is(err, apikey.ErrUnauthorized) {
+		return nil, err
+	}
+
+	accessApiKey, err := reissueAccessApiKey(ctx, et.bulker, &agent)
+	if err != nil {
+		return nil, err
+	}
+
+	auditLog("access-api-key-reissue", "success").
+		Str("agent.id", id).
+		Str("enrollment_api_key.id", key.Id).
+		Str("access_api_key.id", held.Id).
+		Str("access_api_key.new_id", accessApiKey.Id).
+		Str("remote", remoteIP(r)).
+		Msg("Access API key reissued")
+
+	et.cache.SetApiKey(*accessApiKey, kCacheAccessInitTTL)
+
+	resp := EnrollResponse{
+		Action: "reissued",
+		Item: EnrollResponseItem{
+			ID:             agent.Id,
+			Active:         agent.Active,
+			PolicyId:       agent.PolicyId,
+			Type:           agent.Type,
+			EnrolledAt:     agent.EnrolledAt,
+			UserMeta:       agent.UserProvidedMetadata,
+			LocalMeta:      agent.LocalMetadata,
+			AccessApiKeyId: accessApiKey.Id,
+			AccessAPIKey:   accessApiKey.Token(),
+			Status:         "online",
+		},
+	}
+
+	return json.Marshal(resp)
+}
+
+var errReissueKeyMismatch = errors.New("access API key does not match the agent")
+
+// verifyReissue checks the agent may be reissued an access key on the
+// presentation of the enrollment key and the access key it holds. Agents
+// enrolled before the access key hash was recorded cannot prove they hold the
+// key and must enroll again.
+func verifyReissue(agent *model.Agent, enrollmentKeyId string, held apikey.ApiKey) error {
+	switch {
+	case !agent.Active:
+		return errors.New("agent is not active")
+	case agent.EnrollmentApiKeyId == "" || agent.AccessApiKeyHash == "":
+		return errors.New("agent enrolled without a recorded access API key")
+	case agent.EnrollmentApiKeyId != enrollmentKeyId:
+		return errors.New("agent enrolled with another enrollment API key")
+	case agent.AccessApiKeyId != held.Id:
+		return errReissueKeyMismatch
+	case subtle.ConstantTimeCompare([]byte(agent.AccessApiKeyHash), []byte(accessApiKeyHash(held))) != 1:
+		return errReissueKeyMismatch
+	}
+	return nil
+}
+
+// reissueAccessApiKey creates a new access API key for the agent and records
+// it on the agent document.
+func reissueAccessApiKey(ctx context.Context, bulker bulk.Bulk, agent *model.Agent) (*apikey.ApiKey, error) {
+	accessApiKey, err := generateAccessApiKey(ctx, bulker.Client(), agent.Id, agent.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"doc": map[string]interface{}{
+			dl.FieldAccessAPIKeyID:   accessApiKey.Id,
+			dl.FieldAccessAPIKeyHash: accessApiKeyHash(*accessApiKey),
+			dl.FieldUpdatedAt:        time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = bulker.Update(ctx, dl.FleetAgents, agent.Id, body, bulk.WithRefresh()); err != nil {
+		// The agent is left with its invalidated key; do not leave a usable one behind
+		if ierr := apikey.Invalidate(ctx, bulker.Client(), accessApiKey.Id); ierr != nil {
+			log.Warn().Err(ierr).Str("id", accessApiKey.Id).Msg("fail invalidate unused access API key")
+		}
+		return nil, err
+	}
+
+	agent.AccessApiKeyId = accessApiKey.Id
+	agent.AccessApiKeyHash = accessApiKeyHash(*accessApiKey)
+	return accessApiKey, nil
+}
@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+func TestVerifyReissue(t *testing.T) {
+	held := apikey.ApiKey{Id: "access-id", Key: "access-secret"}
+	enrolled := model.Agent{
+		Active:             true,
+		AccessApiKeyId:     held.Id,
+		AccessApiKeyHash:   accessApiKeyHash(held),
+		EnrollmentApiKeyId: "enroll-id",
+	}
+
+	tests := []struct {
+		name     string
+		agent    func(a *model.Agent)
+		enrollId string
+		held     apikey.ApiKey
+		mismatch bool
+		ok       bool
+	}{
+		{name: "valid", enrollId: "enroll-id", held: held, ok: true},
+		{name: "inactive", agent: func(a *model.Agent) { a.Active = false }, enrollId: "enroll-id", held: held},
+		{name: "no hash", agent: func(a *model.Agent) { a.AccessApiKeyHash = "" }, enrollId: "enroll-id", held: held},
+		{name: "other enrollment key", enrollId: "other", held: held},
+		{name: "other access key", enrollId: "enroll-id", held: apikey.ApiKey{Id: "other", Key: held.Key}, mismatch: true},
+		{name: "wrong secret", enrollId: "enroll-id", held: apikey.ApiKey{Id: held.Id, Key: "guess"}, mismatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := enrolled
+			if tt.agent != nil {
+				tt.agent(&agent)
+			}
+			err := verifyReissue(&agent, tt.enrollId, tt.held)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected reissue to be denied")
+			}
+			if errors.Is(err, errReissueKeyMismatch) != tt.mismatch {
+				t.Errorf("mismatch = %v, want %v (%v)", !tt.mismatch, tt.mismatch, err)
+			}
+		})
+	}
+}
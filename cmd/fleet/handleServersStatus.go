@@ -0,0 +1,139 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/certmon"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/transport"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// Servers update their status with their leadership checks, every 20 seconds;
+// one that missed a few of them is reported stale.
+const kServerStaleAfter = time.Minute
+
+type ServersStatusT struct {
+	limit *limit.Limiter
+	bulk  bulk.Bulk
+	cache cache.Cache
+	sm    policy.SelfMonitor
+	cm    *certmon.Monitor
+	res   *transport.Resolver
+}
+
+func NewServersStatusT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, sm policy.SelfMonitor, cm *certmon.Monitor, res *transport.Resolver) *ServersStatusT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Servers status install limits")
+
+	return &ServersStatusT{
+		bulk:  bulker,
+		cache: cache,
+		sm:    sm,
+		cm:    cm,
+		res:   res,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleServersStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.sst.handleServersStatus(w, r)
+
+	if err != nil {
+		code, str, errMsg, lvl := cntServersStatus.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail servers status")
+
+		if err := WriteError(w, code, str, errMsg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (sst *ServersStatusT) handleServersStatus(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := sst.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, sst.bulk, sst.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntServersStatus.IncStart()
+	defer dfunc()
+
+	servers, err := dl.QueryServers(r.Context(), sst.bulk)
+	if err != nil && !errors.Is(err, es.ErrIndexNotFound) {
+		return err
+	}
+
+	_, local := localStatus(sst.sm, sst.cm, sst.res, true)
+	resp := ServersStatus{
+		Local:   local,
+		Servers: serverStatuses(servers, time.Now()),
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntServersStatus.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// serverStatuses reports the servers by their last written status. Servers of
+// versions that did not record their status have none.
+func serverStatuses(servers []model.Server, now time.Time) []ServerStatus {
+	statuses := make([]ServerStatus, 0, len(servers))
+	for _, server := range servers {
+		s := ServerStatus{
+			Status:   server.Status,
+			LastSeen: server.Timestamp,
+			Stale:    true,
+		}
+		if server.Server != nil {
+			s.Id = server.Server.Id
+			s.Version = server.Server.Version
+		}
+		if server.Host != nil {
+			s.Hostname = server.Host.Name
+		}
+		if server.Restart != nil {
+			s.Restart = server.Restart.State
+		}
+		if t, err := server.Time(); err == nil {
+			s.Stale = now.Sub(t) > kServerStaleAfter
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
@@ -0,0 +1,45 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+func TestServerStatuses(t *testing.T) {
+	now := time.Now().UTC()
+
+	recent := model.Server{
+		Host:   &model.HostMetadata{Name: "host-a"},
+		Server: &model.ServerMetadata{Id: "a", Version: "8.0.0"},
+		Status: "HEALTHY",
+	}
+	recent.SetTime(now.Add(-10 * time.Second))
+
+	stopped := model.Server{
+		Host:   &model.HostMetadata{Name: "host-b"},
+		Server: &model.ServerMetadata{Id: "b", Version: "7.16.0"},
+	}
+	stopped.SetTime(now.Add(-kServerStaleAfter - time.Second))
+
+	unknown := model.Server{
+		Server: &model.ServerMetadata{Id: "c"},
+	}
+
+	statuses := serverStatuses([]model.Server{recent, stopped, unknown}, now)
+
+	assert.Equal(t, []ServerStatus{
+		{Id: "a", Version: "8.0.0", Hostname: "host-a", Status: "HEALTHY", LastSeen: recent.Timestamp},
+		{Id: "b", Version: "7.16.0", Hostname: "host-b", LastSeen: stopped.Timestamp, Stale: true},
+		{Id: "c", Stale: true},
+	}, statuses)
+}
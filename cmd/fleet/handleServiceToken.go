@@ -0,0 +1,151 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+type ServiceTokenT struct {
+	limit  *limit.Limiter
+	bulk   bulk.Bulk
+	cache  cache.Cache
+	tokens *es.ServiceTokens
+}
+
+// NewServiceTokenT reports and cuts over the service token; tokens is nil when
+// no secondary service token is configured.
+func NewServiceTokenT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, tokens *es.ServiceTokens) *ServiceTokenT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Service token install limits")
+
+	return &ServiceTokenT{
+		bulk:   bulker,
+		cache:  cache,
+		tokens: tokens,
+		limit:  limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+func (rt Router) handleServiceToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.stt.handleServiceToken(w, r)
+
+	if err != nil {
+		rt.stt.writeError(w, err, "Fail service token status")
+	}
+}
+
+func (rt Router) handleServiceTokenCutover(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.stt.handleServiceTokenCutover(w, r)
+
+	if err != nil {
+		rt.stt.writeError(w, err, "Fail service token cutover")
+	}
+}
+
+func (stt *ServiceTokenT) writeError(w http.ResponseWriter, err error, msg string) {
+	code, str, errMsg, lvl := cntServiceToken.IncError(err)
+
+	log.WithLevel(lvl).
+		Err(err).
+		Int("code", code).
+		Msg(msg)
+
+	if err := WriteError(w, code, str, errMsg); err != nil {
+		log.Error().Err(err).Msg("fail writing error response")
+	}
+}
+
+func (stt *ServiceTokenT) handleServiceToken(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := stt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, stt.bulk, stt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntServiceToken.IncStart()
+	defer dfunc()
+
+	return stt.writeResponse(w, stt.status())
+}
+
+func (stt *ServiceTokenT) handleServiceTokenCutover(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := stt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, stt.bulk, stt.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntServiceToken.IncStart()
+	defer dfunc()
+
+	if stt.tokens == nil {
+		return es.ErrNoSecondaryToken
+	}
+
+	if err := stt.tokens.Cutover(r.Context(), stt.bulk.Client()); err != nil {
+		auditLog("service-token-cutover", "failure").
+			Err(err).
+			Str("operator", key.Id).
+			Msg("Service token cutover failed")
+		return err
+	}
+
+	auditLog("service-token-cutover", "success").
+		Str("operator", key.Id).
+		Msg("Cut over to secondary service token")
+
+	return stt.writeResponse(w, stt.status())
+}
+
+func (stt *ServiceTokenT) status() *ServiceTokenStatus {
+	if stt.tokens == nil {
+		return &ServiceTokenStatus{Active: es.TokenPrimary}
+	}
+
+	active, since := stt.tokens.Active()
+	return &ServiceTokenStatus{
+		Active:              active,
+		Since:               since.UTC().Format(time.RFC3339),
+		SecondaryConfigured: true,
+	}
+}
+
+func (stt *ServiceTokenT) writeResponse(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntServiceToken.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
@@ -8,8 +8,13 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/elastic/elastic-agent-client/v7/pkg/proto"
+	"github.com/elastic/fleet-server/v7/internal/pkg/certmon"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/transport"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog/log"
 )
@@ -19,10 +24,13 @@ func (rt Router) handleStatus(w http.ResponseWriter, _ *http.Request, _ httprout
 	dfunc := cntStatus.IncStart()
 	defer dfunc()
 
-	status := rt.sm.Status()
-	resp := StatusResponse{
-		Name:   "fleet-server",
-		Status: status.String(),
+	// The callers of the status are not authenticated; the operators get the
+	// details from the servers status
+	status, resp := localStatus(rt.sm, rt.cm, rt.res, false)
+	if rt.rrt.isDraining() {
+		// Out of the load balancers while draining
+		status = proto.StateObserved_STOPPING
+		resp.Status = status.String()
 	}
 
 	data, err := json.Marshal(&resp)
@@ -48,3 +56,64 @@ func (rt Router) handleStatus(w http.ResponseWriter, _ *http.Request, _ httprout
 
 	cntStatus.bodyOut.Add(uint64(nWritten))
 }
+
+// localStatus returns the status of this Fleet Server, degraded while a
+// certificate is about to expire, and the addresses the Elasticsearch hosts
+// resolved to. The certificates expiring, the addresses, the feature flags and
+// the runtime settings are only reported with the details, which are for the
+// operators.
+func localStatus(sm policy.SelfMonitor, cm *certmon.Monitor, res *transport.Resolver, details bool) (proto.StateObserved_Status, StatusResponse) {
+	status := sm.Status()
+	resp := StatusResponse{
+		Name: "fleet-server",
+	}
+	if details {
+		runtime := currentRuntimeSettings()
+		resp.Runtime = &runtime
+	}
+
+	if cm != nil {
+		expiring, critical := cm.Expiring()
+		if details {
+			now := time.Now()
+			for _, e := range expiring {
+				resp.Certificates = append(resp.Certificates, CertificateExpiry{
+					Name:         e.Name,
+					Subject:      e.Subject,
+					NotAfter:     e.NotAfter.UTC().Format(time.RFC3339),
+					DaysToExpiry: int64(e.Remaining(now) / (24 * time.Hour)),
+				})
+			}
+		}
+		if critical && status == proto.StateObserved_HEALTHY {
+			status = proto.StateObserved_DEGRADED
+		}
+	}
+	resp.Status = status.String()
+
+	if details {
+		for _, e := range res.Endpoints() {
+			endpoint := ResolvedEndpoint{
+				Host:      e.Host,
+				Addresses: e.Addrs,
+			}
+			if !e.ResolvedAt.IsZero() {
+				endpoint.ResolvedAt = e.ResolvedAt.UTC().Format(time.RFC3339)
+			}
+			if e.Err != nil {
+				endpoint.Error = e.Err.Error()
+			}
+			resp.Elasticsearch = append(resp.Elasticsearch, endpoint)
+		}
+	}
+
+	if details {
+		for _, s := range feature.Default.List() {
+			if s.Source != feature.SourceDefault {
+				resp.Features = append(resp.Features, featureFlag(s))
+			}
+		}
+	}
+
+	return status, resp
+}
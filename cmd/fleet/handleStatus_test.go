@@ -0,0 +1,37 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elastic/elastic-agent-client/v7/pkg/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/transport"
+)
+
+type healthySelf struct{}
+
+func (healthySelf) Run(ctx context.Context) error      { return nil }
+func (healthySelf) Status() proto.StateObserved_Status { return proto.StateObserved_HEALTHY }
+
+func TestLocalStatusDetails(t *testing.T) {
+	res := transport.NewResolver(transport.Default, []string{"https://es.internal:9200"}, time.Minute)
+
+	status, resp := localStatus(healthySelf{}, nil, res, false)
+	assert.Equal(t, proto.StateObserved_HEALTHY, status)
+	assert.Equal(t, StatusResponse{Name: "fleet-server", Status: "HEALTHY"}, resp)
+
+	_, resp = localStatus(healthySelf{}, nil, res, true)
+	require.NotNil(t, resp.Runtime)
+	require.Len(t, resp.Elasticsearch, 1)
+	assert.Equal(t, "es.internal", resp.Elasticsearch[0].Host)
+}
@@ -0,0 +1,243 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	kOtlpProtobuf = "application/x-protobuf"
+	kOtlpJSON     = "application/json"
+
+	kTelemetryMaxResponse = 64 * 1024
+)
+
+var (
+	ErrTelemetryDisabled         = errors.New("agent telemetry not enabled")
+	ErrTelemetryMediaType        = errors.New("unsupported telemetry media type")
+	ErrTelemetryInvalid          = errors.New("invalid telemetry payload")
+	ErrTelemetryCollectorFailure = errors.New("telemetry collector unavailable")
+)
+
+// telemetryDoc is the document indexed into the data stream for every export
+// request; the request is kept as received under otlp.
+type telemetryDoc struct {
+	Timestamp string          `json:"@timestamp"`
+	Agent     telemetryAgent  `json:"agent"`
+	PolicyId  string          `json:"policy_id,omitempty"`
+	Otlp      json.RawMessage `json:"otlp"`
+}
+
+type telemetryAgent struct {
+	Id string `json:"id"`
+}
+
+// TelemetryT passes the OTLP/HTTP metrics of the agents on to a collector or a
+// data stream, so that the agents only need a path to Fleet Server to report
+// their own health.
+type TelemetryT struct {
+	limit   *limit.Limiter
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	maxBody int64
+	cfg     config.AgentTelemetry
+	client  *http.Client
+}
+
+func NewTelemetryT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *TelemetryT {
+	log.Info().
+		Interface("limits", cfg.Limits.TelemetryLimit).
+		Bool("enabled", cfg.AgentTelemetry.Enabled).
+		Str("collector", cfg.AgentTelemetry.CollectorURL).
+		Str("dataStream", cfg.AgentTelemetry.DataStream).
+		Msg("Agent telemetry install limits")
+
+	return &TelemetryT{
+		bulk:    bulker,
+		cache:   cache,
+		limit:   limit.NewLimiter(&cfg.Limits.TelemetryLimit),
+		maxBody: cfg.Limits.TelemetryLimit.MaxBody,
+		cfg:     cfg.AgentTelemetry,
+		client:  &http.Client{Timeout: cfg.AgentTelemetry.Timeout},
+	}
+}
+
+func (rt Router) handleOtlpMetrics(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.tt.handleOtlpMetrics(w, r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntTelemetry.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("agentId", id).
+			Int("code", code).
+			Msg("Fail OTLP metrics")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (tt *TelemetryT) handleOtlpMetrics(w http.ResponseWriter, r *http.Request, id string) error {
+	if tt == nil || !tt.cfg.Enabled {
+		return ErrTelemetryDisabled
+	}
+
+	limitF, err := tt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	agent, err := authAgent(r, id, tt.bulk, tt.cache)
+	if err != nil {
+		return err
+	}
+	setBodySizePolicy(r, agent.PolicyId)
+
+	dfunc := cntTelemetry.IncStart()
+	defer dfunc()
+
+	contentType, err := otlpContentType(r)
+	if err != nil {
+		return err
+	}
+	if tt.cfg.DataStream != "" && contentType != kOtlpJSON {
+		return ErrTelemetryMediaType
+	}
+
+	body, err := newRequestBody(r, tt.maxBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	body.count(&cntTelemetry)
+
+	if tt.cfg.CollectorURL != "" {
+		return tt.forward(r.Context(), w, contentType, raw)
+	}
+
+	if err := tt.index(r.Context(), agent, raw); err != nil {
+		return err
+	}
+
+	// An empty ExportMetricsServiceResponse: all the data points accepted.
+	w.Header().Set("Content-Type", kOtlpJSON)
+	nWritten, err := w.Write([]byte("{}"))
+	if err != nil {
+		return err
+	}
+
+	cntTelemetry.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// forward posts the export request to the collector and relays its response,
+// including a partial success or a rejection, to the agent.
+func (tt *TelemetryT) forward(ctx context.Context, w http.ResponseWriter, contentType string, raw []byte) error {
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, tt.cfg.CollectorURL, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	for k, v := range tt.cfg.Headers {
+		hreq.Header.Set(k, v)
+	}
+	hreq.Header.Set("Content-Type", contentType)
+
+	hres, err := tt.client.Do(hreq)
+	if err != nil {
+		log.Warn().Err(err).Str("collector", tt.cfg.CollectorURL).Msg("Fail forwarding OTLP metrics")
+		return ErrTelemetryCollectorFailure
+	}
+	defer hres.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(hres.Body, kTelemetryMaxResponse))
+	if err != nil {
+		return ErrTelemetryCollectorFailure
+	}
+
+	if ct := hres.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if ra := hres.Header.Get("Retry-After"); ra != "" {
+		w.Header().Set("Retry-After", ra)
+	}
+	w.WriteHeader(hres.StatusCode)
+
+	nWritten, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+
+	cntTelemetry.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
+
+// index writes the export request into the data stream, tagged with the agent
+// that sent it.
+func (tt *TelemetryT) index(ctx context.Context, agent *model.Agent, raw []byte) error {
+	if !json.Valid(raw) {
+		return ErrTelemetryInvalid
+	}
+
+	doc := telemetryDoc{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Agent:     telemetryAgent{Id: agent.Id},
+		PolicyId:  agent.PolicyId,
+		Otlp:      raw,
+	}
+
+	body, err := json.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = tt.bulk.Create(ctx, tt.cfg.DataStream, "", body)
+	return err
+}
+
+// otlpContentType returns the OTLP encoding of the request; OTLP/HTTP only
+// defines the binary protobuf and the JSON ones.
+func otlpContentType(r *http.Request) (string, error) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", ErrTelemetryMediaType
+	}
+	switch mt {
+	case kOtlpProtobuf, kOtlpJSON:
+		return mt, nil
+	}
+	return "", ErrTelemetryMediaType
+}
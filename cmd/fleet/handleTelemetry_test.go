@@ -0,0 +1,144 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+type telemetryBulk struct {
+	ftesting.MockBulk
+	index string
+	body  []byte
+}
+
+func (m *telemetryBulk) Create(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) (string, error) {
+	m.index = index
+	m.body = body
+	return "doc-1", nil
+}
+
+func newTestTelemetryT(tcfg config.AgentTelemetry, bulker bulk.Bulk) *TelemetryT {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.AgentTelemetry = tcfg
+	return NewTelemetryT(cfg, bulker, cache.Cache{})
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+	tt := newTestTelemetryT(config.AgentTelemetry{}, ftesting.MockBulk{})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-1/otlp/v1/metrics", strings.NewReader("{}"))
+	err := tt.handleOtlpMetrics(httptest.NewRecorder(), r, "agent-1")
+	assert.True(t, errors.Is(err, ErrTelemetryDisabled))
+
+	var none *TelemetryT
+	err = none.handleOtlpMetrics(httptest.NewRecorder(), r, "agent-1")
+	assert.True(t, errors.Is(err, ErrTelemetryDisabled))
+}
+
+func TestTelemetryForward(t *testing.T) {
+	var gotType, gotAuth string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		gotAuth = r.Header.Get("Authorization")
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", kOtlpProtobuf)
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("slow down"))
+	}))
+	defer srv.Close()
+
+	tt := newTestTelemetryT(config.AgentTelemetry{
+		Enabled:      true,
+		CollectorURL: srv.URL,
+		Headers:      map[string]string{"Authorization": "Bearer token"},
+		Timeout:      time.Second,
+	}, ftesting.MockBulk{})
+
+	w := httptest.NewRecorder()
+	require.NoError(t, tt.forward(context.Background(), w, kOtlpProtobuf, []byte("metrics")))
+
+	assert.Equal(t, kOtlpProtobuf, gotType)
+	assert.Equal(t, "Bearer token", gotAuth)
+	assert.Equal(t, "metrics", string(gotBody))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	assert.Equal(t, kOtlpProtobuf, w.Header().Get("Content-Type"))
+	assert.Equal(t, "slow down", w.Body.String())
+
+	srv.Close()
+	err := tt.forward(context.Background(), httptest.NewRecorder(), kOtlpProtobuf, []byte("metrics"))
+	assert.True(t, errors.Is(err, ErrTelemetryCollectorFailure))
+}
+
+func TestTelemetryIndex(t *testing.T) {
+	bulker := &telemetryBulk{}
+	tt := newTestTelemetryT(config.AgentTelemetry{
+		Enabled:    true,
+		DataStream: "metrics-elastic_agent.otlp-default",
+		Timeout:    time.Second,
+	}, bulker)
+
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}, PolicyId: "policy-1"}
+	raw := []byte(`{"resourceMetrics":[]}`)
+	require.NoError(t, tt.index(context.Background(), agent, raw))
+
+	assert.Equal(t, "metrics-elastic_agent.otlp-default", bulker.index)
+	var doc telemetryDoc
+	require.NoError(t, json.Unmarshal(bulker.body, &doc))
+	assert.Equal(t, "agent-1", doc.Agent.Id)
+	assert.Equal(t, "policy-1", doc.PolicyId)
+	assert.JSONEq(t, string(raw), string(doc.Otlp))
+	assert.NotEmpty(t, doc.Timestamp)
+
+	err := tt.index(context.Background(), agent, []byte("not json"))
+	assert.True(t, errors.Is(err, ErrTelemetryInvalid))
+}
+
+func TestOtlpContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+		err         error
+	}{
+		{"application/x-protobuf", kOtlpProtobuf, nil},
+		{"application/json; charset=utf-8", kOtlpJSON, nil},
+		{"text/plain", "", ErrTelemetryMediaType},
+		{"", "", ErrTelemetryMediaType},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.contentType, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Content-Type", tc.contentType)
+			got, err := otlpContentType(r)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	kUploadChunkHashHeader = "X-Chunk-SHA256"
+
+	kUploadBeginMaxBody = 64 * 1024
+
+	// kUploadVerifyWorkers is how many chunks are read back at once when an
+	// upload completes, and so the most held in memory.
+	kUploadVerifyWorkers = 4
+)
+
+var (
+	ErrUploadUnknown       = errors.New("unknown upload")
+	ErrUploadFileSize      = errors.New("upload file size out of range")
+	ErrUploadAction        = errors.New("upload action is not for the agent")
+	ErrUploadNotUploading  = errors.New("upload is not uploading")
+	ErrUploadChunkInvalid  = errors.New("upload chunk out of the file or of the wrong size")
+	ErrUploadChunkHash     = errors.New("upload chunk does not match its sha256")
+	ErrUploadChunksMissing = errors.New("upload chunks missing")
+	ErrUploadFileHash      = errors.New("upload file does not match its sha256")
+)
+
+// UploadT takes the files uploaded by the agents for their actions, such as
+// diagnostics bundles, in chunks. The bytes of the chunks go to the storage
+// backend; the upload and chunk documents stay in Elasticsearch.
+type UploadT struct {
+	cfg     *config.Upload
+	limit   *limit.Limiter
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	storage uploadStorage
+	now     func() time.Time
+}
+
+func NewUploadT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, storage uploadStorage) *UploadT {
+	log.Info().
+		Interface("limits", cfg.Limits.UploadLimit).
+		Int64("chunkSize", cfg.Upload.ChunkSize).
+		Int64("maxFileSize", cfg.Upload.MaxFileSize).
+		Str("storage", storage.name()).
+		Msg("Upload install limits")
+
+	return &UploadT{
+		cfg:     &cfg.Upload,
+		limit:   limit.NewLimiter(&cfg.Limits.UploadLimit),
+		bulk:    bulker,
+		cache:   cache,
+		storage: storage,
+		now:     time.Now,
+	}
+}
+
+func (rt Router) handleUploadBegin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.ut.handleUploadBegin(w, r)
+
+	if err != nil {
+		code, str, msg, lvl := cntUploadBegin.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail upload begin")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (rt Router) handleUploadChunk(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.ut.handleUploadChunk(w, r, id, ps.ByName("chunk"))
+
+	if err != nil {
+		code, str, msg, lvl := cntUploadChunk.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("uploadId", id).
+			Str("chunk", ps.ByName("chunk")).
+			Int("code", code).
+			Msg("Fail upload chunk")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (rt Router) handleUploadComplete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	err := rt.ut.handleUploadComplete(w, r, id)
+
+	if err != nil {
+		code, str, msg, lvl := cntUploadComplete.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Str("uploadId", id).
+			Int("code", code).
+			Msg("Fail upload complete")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (ut *UploadT) handleUploadBegin(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := ut.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	dfunc := cntUploadBegin.IncStart()
+	defer dfunc()
+
+	body, err := newRequestBody(r, kUploadBeginMaxBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	body.count(&cntUploadBegin)
+
+	var req UploadBeginRequest
+	if err := codec.Unmarshal(raw, &req); err != nil {
+		return err
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if err := req.File.Validate(); err != nil {
+		return err
+	}
+
+	agent, err := authAgent(r, req.AgentId, ut.bulk, ut.cache)
+	if err != nil {
+		return err
+	}
+	if agent.Id != req.AgentId {
+		return ErrUploadMismatch
+	}
+
+	if req.File.Size <= 0 || req.File.Size > ut.cfg.MaxFileSize {
+		return ErrUploadFileSize
+	}
+
+	ctx := r.Context()
+	if err := ut.checkAction(ctx, req.ActionId, agent.Id); err != nil {
+		return err
+	}
+
+	upload := model.Upload{
+		ESDocument: model.ESDocument{Id: uuid.Must(uuid.NewV4()).String()},
+		Timestamp:  ut.now().UTC().Format(time.RFC3339),
+		ActionId:   req.ActionId,
+		AgentId:    agent.Id,
+		Status:     model.UploadStatusUploading,
+		ChunkSize:  ut.cfg.ChunkSize,
+		Storage:    ut.storage.name(),
+		File: &model.FileMetadata{
+			Name:     req.File.Name,
+			Size:     req.File.Size,
+			MimeType: req.File.MimeType,
+			Sha256:   strings.ToLower(req.File.Sha256),
+		},
+	}
+	if err := dl.CreateUpload(ctx, ut.bulk, upload); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("uploadId", upload.Id).
+		Str("agentId", upload.AgentId).
+		Str("actionId", upload.ActionId).
+		Int64("size", upload.File.Size).
+		Msg("Upload started")
+
+	data, err := codec.Marshal(&UploadBeginResponse{
+		UploadId:  upload.Id,
+		ChunkSize: upload.ChunkSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	nWritten, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+	cntUploadBegin.bodyOut.Add(uint64(nWritten))
+	return nil
+}
+
+// checkAction ensures the upload is for an action of the agent.
+func (ut *UploadT) checkAction(ctx context.Context, actionId, agentId string) error {
+	actions, err := dl.FindAction(ctx, ut.bulk, actionId)
+	if err != nil {
+		return err
+	}
+	for _, action := range actions {
+		for _, id := range action.Agents {
+			if id == agentId {
+				return nil
+			}
+		}
+	}
+	return ErrUploadAction
+}
+
+// findUpload returns the upload of the agent authenticated by the request.
+func (ut *UploadT) findUpload(r *http.Request, id string) (model.Upload, error) {
+	upload, err := dl.FindUpload(r.Context(), ut.bulk, id)
+	if err == dl.ErrNotFound {
+		return upload, ErrUploadUnknown
+	} else if err != nil {
+		return upload, err
+	}
+
+	agent, err := authAgent(r, upload.AgentId, ut.bulk, ut.cache)
+	if err != nil {
+		return upload, err
+	}
+	if agent.Id != upload.AgentId {
+		return upload, ErrUploadMismatch
+	}
+	// Not started through this API
+	if upload.File == nil || upload.ChunkSize <= 0 {
+		return upload, ErrUploadUnknown
+	}
+	return upload, nil
+}
+
+func (ut *UploadT) handleUploadChunk(w http.ResponseWriter, r *http.Request, id, chunkStr string) error {
+	limitF, err := ut.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	dfunc := cntUploadChunk.IncStart()
+	defer dfunc()
+
+	upload, err := ut.findUpload(r, id)
+	if err != nil {
+		return err
+	}
+	if upload.Status != model.UploadStatusUploading {
+		return ErrUploadNotUploading
+	}
+
+	n, err := strconv.ParseInt(chunkStr, 10, 64)
+	if err != nil {
+		return ErrUploadChunkInvalid
+	}
+	size, ok := chunkSize(upload, n)
+	if !ok {
+		return ErrUploadChunkInvalid
+	}
+
+	sha2 := strings.ToLower(r.Header.Get(kUploadChunkHashHeader))
+	if sha2 == "" {
+		return ErrUploadChunkHash
+	}
+
+	body, err := newRequestBody(r, upload.ChunkSize)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, upload.ChunkSize+1))
+	if err != nil {
+		return err
+	}
+	body.count(&cntUploadChunk)
+
+	if int64(len(data)) > upload.ChunkSize {
+		return ErrBodyTooLarge
+	}
+	if int64(len(data)) != size {
+		return ErrUploadChunkInvalid
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != sha2 {
+		return ErrUploadChunkHash
+	}
+
+	ctx := r.Context()
+	now := ut.now()
+	err = ut.storage.putChunk(ctx, model.UploadChunk{
+		Bid:       id,
+		Chunk:     n,
+		Sha2:      sha2,
+		Size:      size,
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}, data)
+	if err != nil {
+		return err
+	}
+
+	return dl.SetUploadUpdatedAt(ctx, ut.bulk, id, now)
+}
+
+func (ut *UploadT) handleUploadComplete(w http.ResponseWriter, r *http.Request, id string) error {
+	limitF, err := ut.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	dfunc := cntUploadComplete.IncStart()
+	defer dfunc()
+
+	upload, err := ut.findUpload(r, id)
+	if err != nil {
+		return err
+	}
+	switch upload.Status {
+	case model.UploadStatusUploading:
+	case model.UploadStatusReady:
+		// Completed already; the agent did not get the response
+		return nil
+	default:
+		return ErrUploadNotUploading
+	}
+
+	ctx := r.Context()
+	chunks, err := dl.FindUploadChunks(ctx, ut.bulk, id, config.UploadMaxChunks)
+	if err != nil {
+		return err
+	}
+	if !chunksComplete(upload, chunks) {
+		return ErrUploadChunksMissing
+	}
+
+	if err := ut.verifyChunks(ctx, upload, chunks); err != nil {
+		if err == ErrUploadChunkHash || err == ErrUploadFileHash {
+			// The chunks stored are not the file; it has to be uploaded again
+			if ferr := dl.FailUpload(ctx, ut.bulk, id, err.Error()); ferr != nil {
+				log.Warn().Err(ferr).Str("uploadId", id).Msg("Fail to set the upload failed")
+			}
+		}
+		return err
+	}
+
+	if err := dl.SetUploadStatus(ctx, ut.bulk, id, model.UploadStatusReady); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("uploadId", id).
+		Str("agentId", upload.AgentId).
+		Str("actionId", upload.ActionId).
+		Int("chunks", len(chunks)).
+		Msg("Upload complete")
+	return nil
+}
+
+// verifyChunks reads back the chunks of the upload, kUploadVerifyWorkers at a
+// time, checking each against its sha256, and streams them in order through
+// the sha256 of the file, checked against the one given when the upload began.
+func (ut *UploadT) verifyChunks(ctx context.Context, upload model.Upload, chunks []model.UploadChunk) error {
+	fileHash := sha256.New()
+	window := make([][]byte, kUploadVerifyWorkers)
+
+	for start := 0; start < len(chunks); start += kUploadVerifyWorkers {
+		end := start + kUploadVerifyWorkers
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+
+		g, gctx := errgroup.WithContext(ctx)
+		for i := start; i < end; i++ {
+			i := i
+			g.Go(func() error {
+				data, err := ut.readChunk(gctx, chunks[i])
+				window[i-start] = data
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+
+		for i, data := range window[:end-start] {
+			fileHash.Write(data)
+			window[i] = nil
+		}
+	}
+
+	if upload.File.Sha256 != "" && hex.EncodeToString(fileHash.Sum(nil)) != upload.File.Sha256 {
+		return ErrUploadFileHash
+	}
+	return nil
+}
+
+// readChunk returns the bytes of the chunk read back from the storage, once
+// checked against the size and sha256 of the chunk.
+func (ut *UploadT) readChunk(ctx context.Context, chunk model.UploadChunk) ([]byte, error) {
+	rc, err := ut.storage.openChunk(ctx, chunk)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, chunk.Size+1))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != chunk.Size || hex.EncodeToString(sum[:]) != chunk.Sha2 {
+		return nil, ErrUploadChunkHash
+	}
+	return data, nil
+}
+
+// chunkCount returns the number of chunks the file of the upload is split in.
+func chunkCount(upload model.Upload) int64 {
+	return (upload.File.Size + upload.ChunkSize - 1) / upload.ChunkSize
+}
+
+// chunkSize returns the size of the chunk n of the upload, false when the
+// file has no such chunk.
+func chunkSize(upload model.Upload, n int64) (int64, bool) {
+	count := chunkCount(upload)
+	if n < 0 || n >= count {
+		return 0, false
+	}
+	if n < count-1 {
+		return upload.ChunkSize, true
+	}
+	return upload.File.Size - (count-1)*upload.ChunkSize, true
+}
+
+// chunksComplete tells whether chunks, in their order, are all the chunks of
+// the upload, each of its size.
+func chunksComplete(upload model.Upload, chunks []model.UploadChunk) bool {
+	if int64(len(chunks)) != chunkCount(upload) {
+		return false
+	}
+	for i, chunk := range chunks {
+		size, _ := chunkSize(upload, int64(i))
+		if chunk.Chunk != int64(i) || chunk.Size != size {
+			return false
+		}
+	}
+	return true
+}
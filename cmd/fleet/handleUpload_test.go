@@ -0,0 +1,105 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+func TestChunkSize(t *testing.T) {
+	upload := model.Upload{ChunkSize: 4, File: &model.FileMetadata{Size: 10}}
+
+	tests := []struct {
+		chunk int64
+		size  int64
+		ok    bool
+	}{
+		{0, 4, true},
+		{1, 4, true},
+		{2, 2, true},
+		{3, 0, false},
+		{-1, 0, false},
+	}
+	for _, tt := range tests {
+		size, ok := chunkSize(upload, tt.chunk)
+		assert.Equal(t, tt.ok, ok, "chunk %d", tt.chunk)
+		assert.Equal(t, tt.size, size, "chunk %d", tt.chunk)
+	}
+
+	// A file of a whole number of chunks
+	upload.File.Size = 8
+	size, ok := chunkSize(upload, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), size)
+}
+
+func TestChunksComplete(t *testing.T) {
+	upload := model.Upload{ChunkSize: 4, File: &model.FileMetadata{Size: 10}}
+	chunks := []model.UploadChunk{
+		{Chunk: 0, Size: 4},
+		{Chunk: 1, Size: 4},
+		{Chunk: 2, Size: 2},
+	}
+	assert.True(t, chunksComplete(upload, chunks))
+
+	assert.False(t, chunksComplete(upload, chunks[:2]))
+	assert.False(t, chunksComplete(upload, []model.UploadChunk{chunks[0], chunks[2], chunks[2]}))
+	assert.False(t, chunksComplete(upload, []model.UploadChunk{chunks[0], chunks[1], {Chunk: 2, Size: 3}}))
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadVerifyChunks(t *testing.T) {
+	ctx := context.Background()
+	file := "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	upload := model.Upload{
+		ChunkSize: 4,
+		File:      &model.FileMetadata{Size: int64(len(file)), Sha256: sha256Hex(file)},
+	}
+
+	bulker := newChunksBulk()
+	ut := &UploadT{storage: &esUploadStorage{bulk: bulker}}
+
+	// More chunks than read back at once, stored out of order
+	var chunks []model.UploadChunk
+	for n := int64(0); n < chunkCount(upload); n++ {
+		size, _ := chunkSize(upload, n)
+		data := file[n*upload.ChunkSize : n*upload.ChunkSize+size]
+		chunks = append(chunks, model.UploadChunk{Bid: "up1", Chunk: n, Sha2: sha256Hex(data), Size: size})
+	}
+	require.Greater(t, len(chunks), kUploadVerifyWorkers)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		n := chunks[i].Chunk
+		require.NoError(t, ut.storage.putChunk(ctx, chunks[i], []byte(file[n*upload.ChunkSize:n*upload.ChunkSize+chunks[i].Size])))
+	}
+
+	require.NoError(t, ut.verifyChunks(ctx, upload, chunks))
+
+	// No sha256 given for the file
+	upload.File.Sha256 = ""
+	require.NoError(t, ut.verifyChunks(ctx, upload, chunks))
+
+	upload.File.Sha256 = sha256Hex(file + "!")
+	assert.Equal(t, ErrUploadFileHash, ut.verifyChunks(ctx, upload, chunks))
+
+	// A chunk whose bytes changed once stored
+	upload.File.Sha256 = sha256Hex(file)
+	require.NoError(t, ut.storage.putChunk(ctx, chunks[5], []byte("XXXX")))
+	assert.Equal(t, ErrUploadChunkHash, ut.verifyChunks(ctx, upload, chunks))
+}
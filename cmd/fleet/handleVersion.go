@@ -0,0 +1,182 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/build"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// VersionT reports the build of the server and the capabilities it supports,
+// for the agents, proxies and monitoring to adapt to and operators to audit.
+// Its OpenAPI document is served to the operators.
+type VersionT struct {
+	resp VersionResponse
+
+	bulk  bulk.Bulk
+	cache cache.Cache
+	limit *limit.Limiter
+
+	specOnce sync.Once
+	spec     []byte
+	specErr  error
+}
+
+func NewVersionT(cfg *config.Server, ver string, ua *userAgentPolicy, bulker bulk.Bulk, cache cache.Cache) *VersionT {
+	return &VersionT{
+		bulk:  bulker,
+		cache: cache,
+		limit: limit.NewLimiter(&cfg.Limits.AdminLimit),
+		resp: VersionResponse{
+			Name:          "fleet-server",
+			Version:       ver,
+			Commit:        build.Commit,
+			BuildTime:     build.Time,
+			GoVersion:     runtime.Version(),
+			AgentVersions: ua.checkin.versions(),
+			Auth:          []string{"ApiKey"},
+			Compression: CompressionCapabilities{
+				Request:  []string{kEncodingGzip, kEncodingZstd},
+				Response: []string{kEncodingGzip},
+			},
+		},
+	}
+}
+
+func (rt Router) handleVersion(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	dfunc := cntVersion.IncStart()
+	defer dfunc()
+
+	data, err := json.Marshal(rt.vt.response())
+	if err != nil {
+		code := http.StatusInternalServerError
+		log.Error().Err(err).Int("code", code).Msg("fail version")
+		http.Error(w, "", code)
+		return
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		if err != context.Canceled {
+			log.Error().Err(err).Msg("fail version")
+		}
+	}
+
+	cntVersion.bodyOut.Add(uint64(nWritten))
+}
+
+func (rt Router) handleOpenAPI(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	err := rt.vt.handleOpenAPI(w, r)
+
+	if err != nil {
+		code, str, msg, lvl := cntOpenAPI.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail openapi")
+
+		if err := WriteError(w, code, str, msg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (vt *VersionT) handleOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := vt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	if _, err := authOperator(r, vt.bulk, vt.cache); err != nil {
+		return err
+	}
+
+	dfunc := cntOpenAPI.IncStart()
+	defer dfunc()
+
+	data, err := vt.openAPI()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	nWritten, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+	cntOpenAPI.bodyOut.Add(uint64(nWritten))
+	return nil
+}
+
+// openAPI returns the API spec the server is built from, with the version of
+// the server as its version and the response of /api/version, as of the
+// time, as its x-fleet-server extension. The spec is only parsed once.
+func (vt *VersionT) openAPI() ([]byte, error) {
+	vt.specOnce.Do(func() {
+		vt.spec, vt.specErr = versionedSpec(vt.resp.Version)
+	})
+	if vt.specErr != nil {
+		return nil, vt.specErr
+	}
+
+	ext, err := json.Marshal(vt.response())
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the extension as the last member of the document
+	data := make([]byte, 0, len(vt.spec)+len(ext)+20)
+	data = append(data, vt.spec[:len(vt.spec)-1]...)
+	data = append(data, `,"x-fleet-server":`...)
+	data = append(data, ext...)
+	return append(data, '}'), nil
+}
+
+// versionedSpec returns the API spec with its version set to ver.
+func versionedSpec(ver string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(openAPISpec), &doc); err != nil {
+		return nil, err
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal(doc["info"], &info); err != nil {
+		return nil, err
+	}
+	info["version"] = ver
+
+	var err error
+	if doc["info"], err = json.Marshal(info); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// response returns the build and capabilities, with the feature flags
+// enabled at the time.
+func (vt *VersionT) response() *VersionResponse {
+	resp := vt.resp
+	resp.Features = []string{}
+	for _, s := range feature.Default.List() {
+		if s.Enabled {
+			resp.Features = append(resp.Features, s.Name)
+		}
+	}
+	return &resp
+}
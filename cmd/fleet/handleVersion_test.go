@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleVersion(t *testing.T) {
+	cfg := config.UserAgent{Allow: []string{">= 7.16, < 8.1"}}
+	ua, err := newUserAgentPolicy(mustBuildConstraints("8.0.0"), &cfg)
+	require.NoError(t, err)
+
+	rt := Router{vt: NewVersionT(&config.Server{}, "8.0.0", ua, ftesting.MockBulk{}, cache.Cache{})}
+
+	w := httptest.NewRecorder()
+	rt.handleVersion(w, httptest.NewRequest(http.MethodGet, ROUTE_VERSION, nil), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp VersionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "fleet-server", resp.Name)
+	assert.Equal(t, "8.0.0", resp.Version)
+	assert.Equal(t, runtime.Version(), resp.GoVersion)
+	assert.Equal(t, []string{">= 7.16, < 8.1"}, resp.AgentVersions)
+	assert.Equal(t, []string{"gzip", "zstd"}, resp.Compression.Request)
+
+	var enabled []string
+	for _, s := range feature.Default.List() {
+		if s.Enabled {
+			enabled = append(enabled, s.Name)
+		}
+	}
+	assert.ElementsMatch(t, enabled, resp.Features)
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	ua, err := newUserAgentPolicy(mustBuildConstraints("8.1.2"), &config.UserAgent{})
+	require.NoError(t, err)
+
+	rt := Router{vt: NewVersionT(&config.Server{}, "8.1.2", ua, ftesting.MockBulk{}, cache.Cache{})}
+
+	// Operators only
+	w := httptest.NewRecorder()
+	rt.handleOpenAPI(w, httptest.NewRequest(http.MethodGet, ROUTE_OPENAPI, nil), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	for i := 0; i < 2; i++ {
+		data, err := rt.vt.openAPI()
+		require.NoError(t, err)
+
+		var doc struct {
+			OpenAPI string `json:"openapi"`
+			Info    struct {
+				Title   string `json:"title"`
+				Version string `json:"version"`
+			} `json:"info"`
+			Paths       map[string]json.RawMessage `json:"paths"`
+			FleetServer VersionResponse            `json:"x-fleet-server"`
+		}
+		require.NoError(t, json.Unmarshal(data, &doc))
+		assert.Equal(t, "3.0.0", doc.OpenAPI)
+		assert.Equal(t, "Fleet Server API", doc.Info.Title)
+		assert.Equal(t, "8.1.2", doc.Info.Version)
+		assert.Contains(t, doc.Paths, "/api/fleet/agents/{id}/checkin")
+		assert.Contains(t, doc.Paths, "/api/openapi.json")
+		assert.Equal(t, "8.1.2", doc.FleetServer.Version)
+		assert.NotNil(t, doc.FleetServer.Features)
+	}
+}
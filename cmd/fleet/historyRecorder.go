@@ -0,0 +1,108 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// kHistoryMaxPending is the number of documents of a history being
+	// written at once; the bulker batches them together.
+	kHistoryMaxPending = 256
+
+	kHistoryWriteTimeout = 30 * time.Second
+)
+
+// historyRecorder writes the documents of a history in the background, so the
+// requests recording them do not wait on Elasticsearch. The writes pending are
+// bounded: while Elasticsearch is too slow to keep up, the documents beyond
+// the bound are dropped and counted rather than piling up. The nil recorder
+// drops every document, so the callers record without checking whether the
+// history is enabled.
+type historyRecorder struct {
+	// Accessed atomically, first for their alignment
+	recorded uint64
+	dropped  uint64
+	failed   uint64
+	full     int32
+
+	name    string
+	pending chan struct{}
+}
+
+func newHistoryRecorder(name string) *historyRecorder {
+	return &historyRecorder{
+		name:    name,
+		pending: make(chan struct{}, kHistoryMaxPending),
+	}
+}
+
+// record runs the write of the document of the agent in the background; it
+// never blocks.
+func (hr *historyRecorder) record(agentId string, write func(ctx context.Context) error) {
+	if hr == nil {
+		return
+	}
+
+	select {
+	case hr.pending <- struct{}{}:
+	default:
+		atomic.AddUint64(&hr.dropped, 1)
+		// Logged once per overflow, the metrics count every document
+		if atomic.CompareAndSwapInt32(&hr.full, 0, 1) {
+			log.Warn().
+				Str("history", hr.name).
+				Int("max_pending", kHistoryMaxPending).
+				Msg("History writes pending at the limit; dropping the entries")
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&hr.full, 1, 0) {
+		log.Info().
+			Str("history", hr.name).
+			Uint64("dropped", atomic.LoadUint64(&hr.dropped)).
+			Msg("History writes below the limit; recording the entries again")
+	}
+
+	go func() {
+		defer func() { <-hr.pending }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), kHistoryWriteTimeout)
+		defer cancel()
+
+		if err := write(ctx); err != nil {
+			atomic.AddUint64(&hr.failed, 1)
+			log.Warn().
+				Err(err).
+				Str("history", hr.name).
+				Str("agentId", agentId).
+				Msg("Fail to record history entry")
+			return
+		}
+		atomic.AddUint64(&hr.recorded, 1)
+	}()
+}
+
+// historyStats are the counts of the recorder.
+type historyStats struct {
+	Pending  int
+	Recorded uint64
+	Dropped  uint64
+	Failed   uint64
+}
+
+func (hr *historyRecorder) stats() historyStats {
+	return historyStats{
+		Pending:  len(hr.pending),
+		Recorded: atomic.LoadUint64(&hr.recorded),
+		Dropped:  atomic.LoadUint64(&hr.dropped),
+		Failed:   atomic.LoadUint64(&hr.failed),
+	}
+}
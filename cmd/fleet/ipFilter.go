@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrIPFiltered = errors.New("address not allowed")
+
+const (
+	kIPGroupEnroll     = "enroll"
+	kIPGroupCheckin    = "checkin"
+	kIPGroupArtifacts  = "artifacts"
+	kIPGroupMonitoring = "monitoring"
+	kIPGroupAdmin      = "admin"
+)
+
+// ipGroups are the groups of the agent and monitoring endpoints, by operation
+// id; the other endpoints are the operator APIs of the admin group.
+var ipGroups = map[string]string{
+	"enroll":              kIPGroupEnroll,
+	"reissue":             kIPGroupEnroll,
+	"checkin":             kIPGroupCheckin,
+	"checkin_poll":        kIPGroupCheckin,
+	"checkin_poll_head":   kIPGroupCheckin,
+	"acks":                kIPGroupCheckin,
+	"otlp_metrics":        kIPGroupCheckin,
+	"limits":              kIPGroupCheckin,
+	"artifact":            kIPGroupArtifacts,
+	"artifact_head":       kIPGroupArtifacts,
+	"artifact_deprecated": kIPGroupArtifacts,
+	"artifact_blob":       kIPGroupArtifacts,
+	"artifact_blob_head":  kIPGroupArtifacts,
+	"status":              kIPGroupMonitoring,
+	"version":             kIPGroupMonitoring,
+}
+
+func ipGroup(endpoint string) string {
+	if group, ok := ipGroups[endpoint]; ok {
+		return group
+	}
+	return kIPGroupAdmin
+}
+
+type ipRule struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (r ipRule) allows(ip net.IP) bool {
+	if ip == nil {
+		return len(r.allow) == 0 && len(r.deny) == 0
+	}
+	if containsIP(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || containsIP(r.allow, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipFilter refuses the requests from the addresses the lists of the group of
+// their endpoint do not allow, before they are authenticated.
+type ipFilter struct {
+	groups map[string]ipRule
+}
+
+// newIPFilter returns nil when no list is set.
+func newIPFilter(cfg *config.IPFilter) (*ipFilter, error) {
+	f := &ipFilter{groups: make(map[string]ipRule)}
+	for name, l := range cfg.Groups() {
+		if len(l.Allow) == 0 && len(l.Deny) == 0 {
+			continue
+		}
+		var rule ipRule
+		for _, s := range l.Allow {
+			n, err := config.ParseNetwork(s)
+			if err != nil {
+				return nil, err
+			}
+			rule.allow = append(rule.allow, n)
+		}
+		for _, s := range l.Deny {
+			n, err := config.ParseNetwork(s)
+			if err != nil {
+				return nil, err
+			}
+			rule.deny = append(rule.deny, n)
+		}
+		f.groups[name] = rule
+
+		log.Info().
+			Str("group", name).
+			Strs("allow", l.Allow).
+			Strs("deny", l.Deny).
+			Msg("IP filter install")
+	}
+	if len(f.groups) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// check returns ErrIPFiltered, recording an audit event, if the lists of the
+// group of the endpoint do not allow the address of the request.
+func (f *ipFilter) check(endpoint string, r *http.Request) error {
+	if f == nil {
+		return nil
+	}
+	group := ipGroup(endpoint)
+	rule, ok := f.groups[group]
+	if !ok {
+		return nil
+	}
+
+	ip := remoteIP(r)
+	if rule.allows(net.ParseIP(ip)) {
+		return nil
+	}
+
+	cntIPFiltered.Inc()
+	auditLog("ip-filtered", "failure").
+		Str("group", group).
+		Str("endpoint", endpoint).
+		Str("source_ip", ip).
+		Str("path", r.URL.Path).
+		Msg("Address not allowed for the endpoint")
+	return ErrIPFiltered
+}
@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestIPFilter(t *testing.T) {
+	f, err := newIPFilter(&config.IPFilter{})
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	f, err = newIPFilter(&config.IPFilter{
+		Enroll: config.IPList{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.1.0.0/16"}},
+		Admin:  config.IPList{Allow: []string{"192.168.1.10", "::1"}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		endpoint string
+		remote   string
+		err      error
+	}{
+		{"enroll", "10.2.3.4:1234", nil},
+		{"reissue", "10.1.3.4:1234", ErrIPFiltered},
+		{"enroll", "172.16.0.1:1234", ErrIPFiltered},
+		{"checkin", "172.16.0.1:1234", nil},
+		{"long_polls", "192.168.1.10:1234", nil},
+		{"dead_letters", "192.168.1.11:1234", ErrIPFiltered},
+		{"features", "[::1]:1234", nil},
+		{"features", "[::2]:1234", ErrIPFiltered},
+		{"status", "172.16.0.1:1234", nil},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		assert.Equal(t, tc.err, f.check(tc.endpoint, r), "%s from %s", tc.endpoint, tc.remote)
+	}
+
+	// Refused before the handler runs
+	rt := Router{ipf: f}
+	var called bool
+	h := rt.measured("enroll", func(http.ResponseWriter, *http.Request, httprouter.Params) { called = true })
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = "172.16.0.1:1234"
+	w := httptest.NewRecorder()
+	h(w, r, nil)
+	assert.False(t, called)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The client behind a trusted proxy is filtered, not the proxy
+	cip, err := newClientIPs(&config.ClientIP{TrustedProxies: []string{"10.2.0.1"}})
+	require.NoError(t, err)
+	rt = Router{cip: cip, ipf: f}
+	h = rt.measured("enroll", func(http.ResponseWriter, *http.Request, httprouter.Params) { called = true })
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = "10.2.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "172.16.0.1")
+	w = httptest.NewRecorder()
+	h(w, r, nil)
+	assert.False(t, called)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,139 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/action"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+
+	"github.com/rs/zerolog/log"
+)
+
+// leakCounts are the sizes of the state kept per checkin or per agent, which
+// leak slowly when not released.
+type leakCounts struct {
+	Connections         int64
+	LongPolls           int
+	PolicySubscriptions map[string]int // by policy id
+	ActionSubscriptions int
+	AckSeqNos           int // latest seqnos kept by the dispatcher
+	AckTokens           int // ack tokens cached by the resolver
+	Divergences         uint64
+}
+
+// leakDetector reports the state kept per checkin and per agent, and checks
+// that the state kept per checkin is no more than the open connections.
+type leakDetector struct {
+	cfg   config.LeakDetection
+	conns func() int64
+	pm    policy.Monitor
+	ad    *action.Dispatcher
+	tr    *action.TokenResolver
+	polls *longPolls
+
+	mut         sync.Mutex
+	over        map[string]int // consecutive checks over the connections
+	divergences uint64
+}
+
+func newLeakDetector(cfg *config.Server, pm policy.Monitor, ad *action.Dispatcher, tr *action.TokenResolver, polls *longPolls) *leakDetector {
+	return &leakDetector{
+		cfg:   cfg.LeakDetection,
+		conns: openConnections,
+		pm:    pm,
+		ad:    ad,
+		tr:    tr,
+		polls: polls,
+		over:  make(map[string]int),
+	}
+}
+
+// openConnections is the count of the connections accepted and not closed.
+func openConnections() int64 {
+	return int64(cntHttpNew.Get()) - int64(cntHttpClose.Get())
+}
+
+func (ld *leakDetector) counts() leakCounts {
+	dstats := ld.ad.Stats()
+	counts := leakCounts{
+		Connections:         ld.conns(),
+		LongPolls:           ld.polls.stats().Open,
+		PolicySubscriptions: ld.pm.Subscriptions(),
+		ActionSubscriptions: dstats.Subscriptions,
+		AckSeqNos:           dstats.Latest,
+		AckTokens:           ld.tr.Len(),
+	}
+
+	ld.mut.Lock()
+	counts.Divergences = ld.divergences
+	ld.mut.Unlock()
+	return counts
+}
+
+// Run checks the counts every interval until ctx is done.
+func (ld *leakDetector) Run(ctx context.Context) error {
+	log.Info().
+		Dur("interval", ld.cfg.Interval).
+		Int("tolerance", ld.cfg.Tolerance).
+		Msg("Leak detection started")
+
+	ticker := time.NewTicker(ld.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			ld.check()
+		}
+	}
+}
+
+// check logs the counts over the open connections by more than the
+// tolerance on two checks in a row; a single one may be a checkin between
+// its connection closing and its handler returning.
+func (ld *leakDetector) check() {
+	counts := ld.counts()
+
+	var policySubs int
+	for _, n := range counts.PolicySubscriptions {
+		policySubs += n
+	}
+	checked := []struct {
+		name  string
+		count int
+	}{
+		{"policy_subscriptions", policySubs},
+		{"action_subscriptions", counts.ActionSubscriptions},
+		{"long_polls", counts.LongPolls},
+	}
+
+	ld.mut.Lock()
+	defer ld.mut.Unlock()
+
+	for _, c := range checked {
+		if int64(c.count) <= counts.Connections+int64(ld.cfg.Tolerance) {
+			ld.over[c.name] = 0
+			continue
+		}
+		ld.over[c.name]++
+		if ld.over[c.name] < 2 {
+			continue
+		}
+		ld.divergences++
+		log.Warn().
+			Str("count", c.name).
+			Int("value", c.count).
+			Int64("connections", counts.Connections).
+			Int("checks", ld.over[c.name]).
+			Msg("Count diverges from the open connections; state kept per checkin may be leaking")
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/action"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
+)
+
+func TestLeakDetector(t *testing.T) {
+	var cfg config.Server
+	cfg.InitDefaults()
+	cfg.LeakDetection.Tolerance = 1
+
+	ad := action.NewDispatcher(nil, nil)
+	tr, err := action.NewTokenResolver(nil)
+	require.NoError(t, err)
+	pm := &mockPolicyMonitor{subs: map[string]int{"p1": 2, "p2": 1}}
+	polls := newLongPolls()
+
+	ld := newLeakDetector(&cfg, pm, ad, tr, polls)
+	conns := int64(3)
+	ld.conns = func() int64 { return conns }
+
+	for _, agentId := range []string{"a1", "a2", "a3"} {
+		ad.Subscribe(agentId, sqn.SeqNo{})
+		polls.add(agentId, "p1")
+	}
+
+	counts := ld.counts()
+	assert.Equal(t, int64(3), counts.Connections)
+	assert.Equal(t, 3, counts.LongPolls)
+	assert.Equal(t, 3, counts.ActionSubscriptions)
+	assert.Equal(t, map[string]int{"p1": 2, "p2": 1}, counts.PolicySubscriptions)
+
+	ld.check()
+	assert.Equal(t, uint64(0), ld.counts().Divergences)
+
+	// The subscriptions outlive their connections
+	conns = 1
+	ld.check()
+	assert.Equal(t, uint64(0), ld.counts().Divergences, "over once")
+	ld.check()
+	assert.Equal(t, uint64(3), ld.counts().Divergences, "over twice in a row")
+
+	conns = 3
+	ld.check()
+	conns = 1
+	ld.check()
+	assert.Equal(t, uint64(3), ld.counts().Divergences, "reset once under")
+}
@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/lifecycle"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	kOfflineScanInterval = time.Minute
+	kOfflineScanPageSize = 1000
+)
+
+// offlineAgentFields are the fields read of the agents gone offline.
+var offlineAgentFields = []string{dl.FieldLastCheckin, dl.FieldPolicyId, dl.FieldPolicyRevisionIdx}
+
+type offlineAgent struct {
+	LastCheckin       string `json:"last_checkin"`
+	PolicyId          string `json:"policy_id"`
+	PolicyRevisionIdx int64  `json:"policy_revision_idx"`
+}
+
+// newLifecycleOutbox returns the outbox of the configured publisher; nil when
+// the lifecycle events are disabled.
+func newLifecycleOutbox(cfg *config.LifecycleEvents) (*lifecycle.Outbox, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	pub, err := lifecycle.NewPublisher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return lifecycle.NewOutbox(cfg, pub), nil
+}
+
+// runOfflineDetector reports the active agents whose last checkin crossed the
+// offline threshold since the previous scan. The agents offline when the
+// scan starts are not reported. Only the leader of the scan runs it; the event
+// is dated at the last checkin of the agent so its ID is the same when the
+// next leader reports it again.
+func runOfflineDetector(ctx context.Context, bulker bulk.Bulk, cfg *config.LifecycleEvents, events *lifecycle.Outbox) error {
+	since := time.Now().Add(-cfg.OfflineAfter)
+
+	t := time.NewTicker(kOfflineScanInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		until := time.Now().Add(-cfg.OfflineAfter)
+		n, err := emitOfflineAgents(ctx, bulker, since, until, events)
+		if err != nil {
+			// The window grows to the next scan
+			log.Warn().Err(err).Msg("Fail to scan for offline agents")
+			continue
+		}
+		if n > 0 {
+			log.Debug().Int("agents", n).Msg("Agents went offline")
+		}
+		since = until
+	}
+}
+
+func emitOfflineAgents(ctx context.Context, bulker bulk.Bulk, since, until time.Time, events *lifecycle.Outbox) (int, error) {
+	filter := dl.ActiveAgentsFilter{CheckinAfter: since, CheckinUntil: until}
+
+	total := 0
+	err := dl.ForEachActiveAgents(ctx, bulker, filter, offlineAgentFields, kOfflineScanPageSize, func(hits []es.HitT) error {
+		for _, hit := range hits {
+			var agent offlineAgent
+			if err := json.Unmarshal(hit.Source, &agent); err != nil {
+				log.Warn().Err(err).Str("agentId", hit.Id).Msg("Skip agent with an invalid document")
+				continue
+			}
+			ts, err := time.Parse(time.RFC3339Nano, agent.LastCheckin)
+			if err != nil {
+				ts = until
+			}
+			events.Emit(lifecycle.NewEvent(lifecycle.TypeOffline, hit.Id, agent.PolicyId, agent.PolicyRevisionIdx, ts))
+			total++
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,134 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// truncateLocalMeta returns the local metadata within the limits of cfg and
+// whether it had to be truncated. Metadata within the limits is returned as
+// is. Otherwise the object keys are walked in order and the values kept while
+// they fit, so the same metadata is always truncated the same way; the objects
+// and arrays left empty are dropped.
+func truncateLocalMeta(raw json.RawMessage, cfg *config.LocalMetadata) (json.RawMessage, bool, error) {
+	if len(raw) == 0 || (cfg.MaxSize == 0 && cfg.MaxFields == 0) {
+		return raw, false, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var meta interface{}
+	if err := dec.Decode(&meta); err != nil {
+		return nil, false, err
+	}
+
+	if (cfg.MaxSize == 0 || len(raw) <= cfg.MaxSize) && (cfg.MaxFields == 0 || countMetaFields(meta) <= cfg.MaxFields) {
+		return raw, false, nil
+	}
+
+	t := metaTruncator{maxSize: cfg.MaxSize, maxFields: cfg.MaxFields}
+	kept, ok := t.value(meta, 0)
+	if !ok {
+		kept = map[string]interface{}{}
+	}
+	data, err := json.Marshal(kept)
+	return data, true, err
+}
+
+func countMetaFields(v interface{}) int {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		n := 0
+		for _, e := range v {
+			n += countMetaFields(e)
+		}
+		return n
+	case []interface{}:
+		n := 0
+		for _, e := range v {
+			n += countMetaFields(e)
+		}
+		return n
+	default:
+		return 1
+	}
+}
+
+// metaTruncator keeps the metadata values while their encoded size and count
+// fit the limits. The size accounted for a value includes its key and the
+// separators, so the encoded result is never larger than maxSize.
+type metaTruncator struct {
+	maxSize   int
+	maxFields int
+	size      int
+	fields    int
+}
+
+func (t *metaTruncator) reserve(n int) bool {
+	if t.maxSize > 0 && t.size+n > t.maxSize {
+		return false
+	}
+	t.size += n
+	return true
+}
+
+// value returns what is kept of v; overhead is the size of its key and
+// separators in the enclosing object or array.
+func (t *metaTruncator) value(v interface{}, overhead int) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if !t.reserve(overhead + 2) {
+			return nil, false
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		out := make(map[string]interface{}, len(v))
+		for _, k := range keys {
+			key, _ := json.Marshal(k)
+			if e, ok := t.value(v[k], len(key)+2); ok {
+				out[k] = e
+			}
+		}
+		if len(out) == 0 && len(v) > 0 {
+			t.size -= overhead + 2
+			return nil, false
+		}
+		return out, true
+	case []interface{}:
+		if !t.reserve(overhead + 2) {
+			return nil, false
+		}
+		out := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			if e, ok := t.value(e, 1); ok {
+				out = append(out, e)
+			}
+		}
+		if len(out) == 0 && len(v) > 0 {
+			t.size -= overhead + 2
+			return nil, false
+		}
+		return out, true
+	default:
+		if t.maxFields > 0 && t.fields >= t.maxFields {
+			return nil, false
+		}
+		data, err := json.Marshal(v)
+		if err != nil || !t.reserve(overhead+len(data)) {
+			return nil, false
+		}
+		t.fields++
+		return v, true
+	}
+}
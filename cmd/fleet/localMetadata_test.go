@@ -0,0 +1,80 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func interfacesMeta(n int) json.RawMessage {
+	ips := make([]string, n)
+	for i := range ips {
+		ips[i] = fmt.Sprintf(`"10.0.%d.%d"`, i/256, i%256)
+	}
+	return json.RawMessage(`{"host":{"name":"host-1","ip":[` + strings.Join(ips, ",") + `]},"elastic":{"agent":{"id":"agent-1","version":"7.14.0"}}}`)
+}
+
+func TestTruncateLocalMeta(t *testing.T) {
+	meta := interfacesMeta(10)
+
+	data, truncated, err := truncateLocalMeta(meta, &config.LocalMetadata{MaxSize: 1024, MaxFields: 100})
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, meta, data)
+
+	// Keys are kept in order: elastic before host, name after ip
+	data, truncated, err = truncateLocalMeta(meta, &config.LocalMetadata{MaxFields: 5})
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.JSONEq(t, `{"host":{"ip":["10.0.0.0","10.0.0.1","10.0.0.2"]},"elastic":{"agent":{"id":"agent-1","version":"7.14.0"}}}`, string(data))
+
+	data, truncated, err = truncateLocalMeta(interfacesMeta(5000), &config.LocalMetadata{MaxSize: 4096})
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.LessOrEqual(t, len(data), 4096)
+	again, _, err := truncateLocalMeta(interfacesMeta(5000), &config.LocalMetadata{MaxSize: 4096})
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	// Numbers are kept as sent
+	data, _, err = truncateLocalMeta(json.RawMessage(`{"a":12345678901234567890,"b":1}`), &config.LocalMetadata{MaxFields: 1})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":12345678901234567890}`, string(data))
+}
+
+func TestParseMetaTruncated(t *testing.T) {
+	cfg := &config.LocalMetadata{MaxFields: 5}
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}, LocalMetadata: json.RawMessage(`{}`)}
+	req := &CheckinRequest{LocalMeta: interfacesMeta(10)}
+
+	fields, err := parseMeta(agent, req, cfg)
+	require.NoError(t, err)
+	require.Contains(t, fields, FieldLocalMetadata)
+	assert.Equal(t, true, fields[FieldLocalMetadataTruncated])
+
+	// The same metadata once stored is not updated again
+	agent.LocalMetadata = fields[FieldLocalMetadata].(json.RawMessage)
+	agent.LocalMetadataTruncated = true
+	fields, err = parseMeta(agent, req, cfg)
+	require.NoError(t, err)
+	assert.Nil(t, fields)
+
+	// Metadata back within the limits clears the flag
+	req.LocalMeta = json.RawMessage(`{"host":{"name":"host-1"}}`)
+	fields, err = parseMeta(agent, req, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, false, fields[FieldLocalMetadataTruncated])
+}
@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrLongPollBudget = errors.New("too many checkins open from the address")
+
+// longPollBudget caps the checkins open at once from each source address, so
+// a NAT'd site or a misconfigured client cannot exhaust the file descriptors
+// of the server with parallel long polls.
+type longPollBudget struct {
+	max       int
+	exemptMax int
+	exempt    []*net.IPNet
+
+	mut  sync.Mutex
+	open map[string]int
+}
+
+// newLongPollBudget returns nil when the budget is disabled.
+func newLongPollBudget(cfg *config.LongPollBudget) (*longPollBudget, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	b := &longPollBudget{
+		max:       cfg.MaxPerIP,
+		exemptMax: cfg.ExemptMaxPerIP,
+		open:      make(map[string]int),
+	}
+	for _, s := range cfg.Exempt {
+		n, err := config.ParseNetwork(s)
+		if err != nil {
+			return nil, err
+		}
+		b.exempt = append(b.exempt, n)
+	}
+
+	log.Info().
+		Int("max_per_ip", cfg.MaxPerIP).
+		Strs("exempt", cfg.Exempt).
+		Int("exempt_max_per_ip", cfg.ExemptMaxPerIP).
+		Msg("Long poll budget install")
+	return b, nil
+}
+
+// acquire counts a checkin open from the source of the request until the
+// returned func is called, or returns ErrLongPollBudget when its source has
+// used its budget.
+func (b *longPollBudget) acquire(r *http.Request) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	ip := remoteIP(r)
+	max := b.max
+	if containsIP(b.exempt, net.ParseIP(ip)) {
+		if b.exemptMax == 0 {
+			return func() {}, nil
+		}
+		max = b.exemptMax
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.open[ip] >= max {
+		cntLongPollRefused.Inc()
+		log.Debug().
+			Str("source_ip", ip).
+			Int("max", max).
+			Msg("Long poll budget of the address used")
+		return nil, ErrLongPollBudget
+	}
+	b.open[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mut.Lock()
+			defer b.mut.Unlock()
+			if b.open[ip]--; b.open[ip] <= 0 {
+				delete(b.open, ip)
+			}
+		})
+	}, nil
+}
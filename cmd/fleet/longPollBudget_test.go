@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestLongPollBudget(t *testing.T) {
+	b, err := newLongPollBudget(&config.LongPollBudget{})
+	require.NoError(t, err)
+	assert.Nil(t, b)
+	release, err := b.acquire(httptest.NewRequest(http.MethodPost, "/", nil))
+	require.NoError(t, err)
+	release()
+
+	b, err = newLongPollBudget(&config.LongPollBudget{
+		Enabled:        true,
+		MaxPerIP:       2,
+		Exempt:         []string{"10.9.0.0/16"},
+		ExemptMaxPerIP: 3,
+	})
+	require.NoError(t, err)
+
+	request := func(remote string, forwarded ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = remote
+		for _, f := range forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		return r
+	}
+
+	// Capped per source address
+	release1, err := b.acquire(request("10.0.0.1:1000"))
+	require.NoError(t, err)
+	_, err = b.acquire(request("10.0.0.1:1001"))
+	require.NoError(t, err)
+	_, err = b.acquire(request("10.0.0.1:1002"))
+	assert.Equal(t, ErrLongPollBudget, err)
+	_, err = b.acquire(request("10.0.0.2:1000"))
+	assert.NoError(t, err)
+
+	release1()
+	release1()
+	_, err = b.acquire(request("10.0.0.1:1003"))
+	assert.NoError(t, err)
+	_, err = b.acquire(request("10.0.0.1:1004"))
+	assert.Equal(t, ErrLongPollBudget, err)
+
+	// The exempt addresses have their own cap
+	for i := 0; i < 3; i++ {
+		_, err = b.acquire(request("10.9.0.1:1000"))
+		require.NoError(t, err)
+	}
+	_, err = b.acquire(request("10.9.0.1:1000"))
+	assert.Equal(t, ErrLongPollBudget, err)
+
+	// The source is the client tracked by the router
+	cip, err := newClientIPs(&config.ClientIP{TrustedProxies: []string{"192.168.0.1"}})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = b.acquire(cip.track(request("192.168.0.1:1000", "10.0.0.7")))
+		require.NoError(t, err)
+	}
+	_, err = b.acquire(cip.track(request("192.168.0.1:1001", "10.0.0.7")))
+	assert.Equal(t, ErrLongPollBudget, err)
+	_, err = b.acquire(cip.track(request("192.168.0.1:1002", "10.0.0.8")))
+	assert.NoError(t, err)
+}
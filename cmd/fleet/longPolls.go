@@ -0,0 +1,125 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"sync"
+	"time"
+)
+
+// longPoll is a checkin waiting for actions or a policy change.
+type longPoll struct {
+	agentId  string
+	policyId string
+	start    time.Time
+
+	once   sync.Once
+	closeC chan struct{}
+}
+
+// Closed is closed when the long poll must end early.
+func (p *longPoll) Closed() <-chan struct{} {
+	return p.closeC
+}
+
+func (p *longPoll) close() {
+	p.once.Do(func() {
+		close(p.closeC)
+	})
+}
+
+// longPollFilter selects long polls; its fields are ignored when empty and
+// combined otherwise.
+type longPollFilter struct {
+	olderThan time.Duration
+	agentId   string
+	policyId  string
+}
+
+func (f longPollFilter) match(p *longPoll, now time.Time) bool {
+	return now.Sub(p.start) >= f.olderThan &&
+		(f.agentId == "" || f.agentId == p.agentId) &&
+		(f.policyId == "" || f.policyId == p.policyId)
+}
+
+// longPollStats are the count and ages of the open long polls.
+type longPollStats struct {
+	Open   int
+	Oldest time.Duration
+	Mean   time.Duration
+}
+
+// longPolls tracks the open long polls so they can be reported and closed.
+type longPolls struct {
+	mut   sync.Mutex
+	next  uint64
+	polls map[uint64]*longPoll
+	now   func() time.Time
+}
+
+func newLongPolls() *longPolls {
+	return &longPolls{
+		polls: make(map[uint64]*longPoll),
+		now:   time.Now,
+	}
+}
+
+// add tracks a long poll of the agent until the returned func is called.
+func (lp *longPolls) add(agentId, policyId string) (*longPoll, func()) {
+	p := &longPoll{
+		agentId:  agentId,
+		policyId: policyId,
+		start:    lp.now(),
+		closeC:   make(chan struct{}),
+	}
+
+	lp.mut.Lock()
+	id := lp.next
+	lp.next++
+	lp.polls[id] = p
+	lp.mut.Unlock()
+
+	return p, func() {
+		lp.mut.Lock()
+		delete(lp.polls, id)
+		lp.mut.Unlock()
+	}
+}
+
+// disconnect ends the long polls matching the filter and returns how many.
+func (lp *longPolls) disconnect(f longPollFilter) int {
+	lp.mut.Lock()
+	defer lp.mut.Unlock()
+
+	now := lp.now()
+	var n int
+	for _, p := range lp.polls {
+		if f.match(p, now) {
+			p.close()
+			n++
+		}
+	}
+	return n
+}
+
+func (lp *longPolls) stats() longPollStats {
+	lp.mut.Lock()
+	defer lp.mut.Unlock()
+
+	now := lp.now()
+	stats := longPollStats{Open: len(lp.polls)}
+	var total time.Duration
+	for _, p := range lp.polls {
+		age := now.Sub(p.start)
+		total += age
+		if age > stats.Oldest {
+			stats.Oldest = age
+		}
+	}
+	if stats.Open > 0 {
+		stats.Mean = total / time.Duration(stats.Open)
+	}
+	return stats
+}
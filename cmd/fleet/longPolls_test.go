@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func isClosed(p *longPoll) bool {
+	select {
+	case <-p.Closed():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestLongPolls(t *testing.T) {
+	now := time.Now()
+	lp := newLongPolls()
+	lp.now = func() time.Time { return now }
+
+	old, _ := lp.add("agent-1", "policy-1")
+	now = now.Add(10 * time.Minute)
+	recent, _ := lp.add("agent-2", "policy-1")
+	other, doneOther := lp.add("agent-3", "policy-2")
+	now = now.Add(time.Minute)
+
+	assert.Equal(t, longPollStats{Open: 3, Oldest: 11 * time.Minute, Mean: 13 * time.Minute / 3}, lp.stats())
+
+	assert.Equal(t, 1, lp.disconnect(longPollFilter{olderThan: 5 * time.Minute}))
+	assert.True(t, isClosed(old))
+	assert.False(t, isClosed(recent))
+
+	assert.Equal(t, 1, lp.disconnect(longPollFilter{policyId: "policy-2", agentId: "agent-3"}))
+	assert.True(t, isClosed(other))
+	assert.False(t, isClosed(recent))
+
+	// Closing twice is harmless
+	assert.Equal(t, 1, lp.disconnect(longPollFilter{agentId: "agent-3"}))
+
+	doneOther()
+	assert.Equal(t, 2, lp.stats().Open)
+	assert.Equal(t, 0, lp.disconnect(longPollFilter{agentId: "agent-3"}))
+}
+
+func TestLongPollDisconnectFilter(t *testing.T) {
+	_, err := (&LongPollDisconnectRequest{}).filter()
+	assert.Equal(t, ErrNoLongPollFilter, err)
+
+	_, err = (&LongPollDisconnectRequest{OlderThan: "soon"}).filter()
+	assert.Error(t, err)
+
+	_, err = (&LongPollDisconnectRequest{OlderThan: "-1m"}).filter()
+	assert.Error(t, err)
+
+	f, err := (&LongPollDisconnectRequest{OlderThan: "0s"}).filter()
+	require.NoError(t, err)
+	assert.Equal(t, longPollFilter{}, f)
+
+	f, err = (&LongPollDisconnectRequest{OlderThan: "10m", PolicyId: "policy-1"}).filter()
+	require.NoError(t, err)
+	assert.Equal(t, longPollFilter{olderThan: 10 * time.Minute, policyId: "policy-1"}, f)
+}
@@ -6,9 +6,11 @@ package fleet
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"runtime/debug"
 	"sync"
 	"time"
@@ -19,20 +21,26 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/action"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/certmon"
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/coordinator"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
 	"github.com/elastic/fleet-server/v7/internal/pkg/monitor"
 	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
 	"github.com/elastic/fleet-server/v7/internal/pkg/profile"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
 	"github.com/elastic/fleet-server/v7/internal/pkg/reload"
 	"github.com/elastic/fleet-server/v7/internal/pkg/signal"
 	"github.com/elastic/fleet-server/v7/internal/pkg/sleep"
 	"github.com/elastic/fleet-server/v7/internal/pkg/status"
-	"github.com/elastic/fleet-server/v7/internal/pkg/ver"
+	"github.com/elastic/fleet-server/v7/internal/pkg/transport"
 
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 	"github.com/elastic/elastic-agent-client/v7/pkg/client"
 	"github.com/elastic/elastic-agent-client/v7/pkg/proto"
 	"github.com/hashicorp/go-version"
@@ -44,6 +52,8 @@ import (
 
 const (
 	kAgentMode                 = "agent-mode"
+	kPreflightOnly             = "preflight-only"
+	kWaitForElasticsearch      = "wait-for-elasticsearch"
 	kAgentModeRestartLoopDelay = 2 * time.Second
 )
 
@@ -59,12 +69,30 @@ func makeCache(cfg *config.Config) (cache.Cache, error) {
 		Int64("maxCost", cfg.Inputs[0].Cache.MaxCost).
 		Msg("makeCache")
 
-	cacheCfg := cache.Config{
-		NumCounters: cfg.Inputs[0].Cache.NumCounters,
-		MaxCost:     cfg.Inputs[0].Cache.MaxCost,
+	c, err := cache.New(cacheConfig(cfg))
+	if err != nil {
+		return c, err
 	}
 
-	return cache.New(cacheCfg)
+	registerCacheMetrics(c)
+	return c, nil
+}
+
+func cacheConfig(cfg *config.Config) cache.Config {
+	ccfg := cfg.Inputs[0].Cache
+	return cache.Config{
+		NumCounters:    ccfg.NumCounters,
+		MaxCost:        ccfg.MaxCost,
+		ApiKeys:        cache.SegmentConfig(ccfg.ApiKeys),
+		EnrollmentKeys: cache.SegmentConfig(ccfg.EnrollmentKeys),
+		Artifacts:      cache.SegmentConfig(ccfg.Artifacts),
+		Actions:        cache.SegmentConfig(ccfg.Actions),
+		AuthFailures:   cache.SegmentConfig(ccfg.AuthFailures),
+		Agents:         cache.SegmentConfig(ccfg.Agents),
+
+		ActionTTL:       ccfg.ActionTTL,
+		ActionTTLByType: ccfg.ActionTTLByType,
+	}
 }
 
 func getRunCommand(version string) func(cmd *cobra.Command, args []string) error {
@@ -80,6 +108,17 @@ func getRunCommand(version string) func(cmd *cobra.Command, args []string) error
 		var l *logger.Logger
 		var runErr error
 		if agentMode {
+			// Environment overrides apply below the command line; the
+			// configuration from the agent is merged on top of both.
+			envCfg := ucfg.New()
+			if err := config.MergeEnv(envCfg); err != nil {
+				return err
+			}
+			if err := envCfg.Merge(cliCfg, config.DefaultOptions...); err != nil {
+				return err
+			}
+			cliCfg = envCfg
+
 			cfg, err := config.FromConfig(cliCfg)
 			if err != nil {
 				return err
@@ -101,25 +140,23 @@ func getRunCommand(version string) func(cmd *cobra.Command, args []string) error
 
 			runErr = agent.Run(installSignalHandler())
 		} else {
-			cfgPath, err := cmd.Flags().GetString("config")
-			if err != nil {
-				return err
-			}
-			cfgData, err := yaml.NewConfigWithFile(cfgPath, config.DefaultOptions...)
+			cfg, err := loadStandaloneConfig(cmd)
 			if err != nil {
 				return err
 			}
-			err = cfgData.Merge(cliCfg, config.DefaultOptions...)
+
+			l, err = logger.Init(cfg)
 			if err != nil {
 				return err
 			}
-			cfg, err := config.FromConfig(cfgData)
+
+			preflightOnly, err := cmd.Flags().GetBool(kPreflightOnly)
 			if err != nil {
 				return err
 			}
-
-			l, err = logger.Init(cfg)
-			if err != nil {
+			if preflightOnly {
+				err = runPreflightOnly(installSignalHandler(), cfg, version)
+				l.Sync()
 				return err
 			}
 
@@ -132,10 +169,19 @@ func getRunCommand(version string) func(cmd *cobra.Command, args []string) error
 			if err != nil {
 				return err
 			}
+			if srv.waitForES, err = cmd.Flags().GetDuration(kWaitForElasticsearch); err != nil {
+				return err
+			}
 
 			runErr = srv.Run(installSignalHandler())
 		}
 
+		if errors.Is(runErr, ErrRollingRestart) {
+			// Started again by the supervisor of the process
+			log.Info().Msg("Exiting for the rolling restart")
+			l.Sync()
+			return runErr
+		}
 		if runErr != nil && runErr != context.Canceled {
 			log.Error().Err(runErr).Msg("Exiting")
 			l.Sync()
@@ -152,12 +198,38 @@ func NewCommand(version string) *cobra.Command {
 		Short: "Fleet Server controls a fleet of Elastic Agents",
 		RunE:  getRunCommand(version),
 	}
-	cmd.Flags().StringP("config", "c", "fleet-server.yml", "Configuration for Fleet Server")
+	cmd.PersistentFlags().StringP("config", "c", "fleet-server.yml", "Configuration for Fleet Server")
 	cmd.Flags().Bool(kAgentMode, false, "Running under execution of the Elastic Agent")
-	cmd.Flags().VarP(config.NewFlag(), "E", "E", "Overwrite configuration value")
+	cmd.Flags().Bool(kPreflightOnly, false, "Run the preflight checks, print their results and exit")
+	cmd.Flags().Duration(kWaitForElasticsearch, 0, "Retry reaching Elasticsearch at startup for up to this long, answering requests with 503 meanwhile, instead of exiting; standalone mode only")
+	cmd.PersistentFlags().VarP(config.NewFlag(), "E", "E", "Overwrite configuration value")
+	cmd.AddCommand(newCheckCommand(version))
+	cmd.AddCommand(newStateCommand(version))
 	return cmd
 }
 
+// loadStandaloneConfig loads the configuration file, overridden by the
+// environment and then by the command line.
+func loadStandaloneConfig(cmd *cobra.Command) (*config.Config, error) {
+	cliCfg := cmd.Flags().Lookup("E").Value.(*config.Flag).Config()
+
+	cfgPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	cfgData, err := yaml.NewConfigWithFile(cfgPath, config.DefaultOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.MergeEnv(cfgData); err != nil {
+		return nil, err
+	}
+	if err := cfgData.Merge(cliCfg, config.DefaultOptions...); err != nil {
+		return nil, err
+	}
+	return config.FromConfig(cfgData)
+}
+
 type firstCfg struct {
 	cfg *config.Config
 	err error
@@ -376,6 +448,9 @@ type FleetServer struct {
 	cfgCh    chan *config.Config
 	cache    cache.Cache
 	reporter status.Reporter
+
+	// Wait for elasticsearch to be reachable when starting
+	waitForES time.Duration
 }
 
 // NewFleetServer creates the actual fleet server service.
@@ -457,9 +532,24 @@ func (f *FleetServer) Run(ctx context.Context) error {
 			}
 		}
 
-		// Restart server
-		if curCfg == nil || curCfg.Inputs[0].Server != newCfg.Inputs[0].Server {
+		// Feature flags apply in place, without restarting the server
+		applyFeatures(&newCfg.Inputs[0].Server)
+
+		// Restart server when the settings it is built from change; with
+		// agent mode they are driven by the fleet_server integration policy.
+		var changed []string
+		if curCfg != nil {
+			changed = curCfg.Inputs[0].Changed(&newCfg.Inputs[0])
+			log.Info().Strs("changed", changed).Msg("Apply configuration update")
+			changed = withoutFeatures(changed)
+		}
+		if curCfg == nil || len(changed) != 0 {
 			stop(srvCancel, srvEg)
+			for _, name := range changed {
+				if name == "cache" {
+					f.resizeCache(newCfg)
+				}
+			}
 			srvEg, srvCancel = start(ctx, func(ctx context.Context) error {
 				return f.runServer(ctx, newCfg)
 			}, ech)
@@ -497,7 +587,9 @@ func loggedRunFunc(ctx context.Context, tag string, runfn runFunc) func() error
 }
 
 func initRuntime(cfg *config.Config) {
-	gcPercent := cfg.Inputs[0].Server.Runtime.GCPercent
+	rcfg := &cfg.Inputs[0].Server.Runtime
+
+	gcPercent := rcfg.GCPercent
 	if gcPercent != 0 {
 		old := debug.SetGCPercent(gcPercent)
 
@@ -506,11 +598,125 @@ func initRuntime(cfg *config.Config) {
 			Int("new", gcPercent).
 			Msg("SetGCPercent")
 	}
+
+	if rcfg.MemoryLimit != 0 {
+		if old, ok := setMemoryLimit(rcfg.MemoryLimit); ok {
+			log.Info().
+				Int64("old", old).
+				Int64("new", rcfg.MemoryLimit).
+				Msg("SetMemoryLimit")
+		} else {
+			log.Warn().
+				Int64("memory_limit", rcfg.MemoryLimit).
+				Str("go", runtime.Version()).
+				Msg("Memory limit needs a build with Go 1.19 or later; ignored")
+		}
+	}
+
+	if rcfg.MaxThreads != 0 {
+		old := debug.SetMaxThreads(rcfg.MaxThreads)
+
+		log.Info().
+			Int("old", old).
+			Int("new", rcfg.MaxThreads).
+			Msg("SetMaxThreads")
+	}
+
+	settings := recordRuntimeSettings()
+	log.Debug().Interface("runtime", settings).Msg("Go runtime settings")
+
+	if err := codec.Use(cfg.Inputs[0].Server.Runtime.JSONCodec); err != nil {
+		log.Error().Err(err).Str("default", codec.Default).Msg("Fail to select the JSON codec; use the default one")
+		codec.Use("")
+	}
+	log.Debug().Str("codec", codec.Name()).Msg("JSON codec")
+}
+
+// initIndices sets the indices the Fleet indices are stored in, before the
+// bulker and the monitors access them.
+func initIndices(cfg *config.Indices) error {
+	overrides := make(map[string]string, len(cfg.Overrides))
+	for name, index := range cfg.Overrides {
+		overrides[dl.FleetIndexPrefix+name] = index
+	}
+	r, err := es.NewIndexResolver(dl.Indices, cfg.Suffix, overrides)
+	if err != nil {
+		return err
+	}
+	es.SetIndexResolver(r)
+
+	if cfg.Suffix != "" || len(overrides) > 0 {
+		log.Info().
+			Str("suffix", cfg.Suffix).
+			Interface("overrides", overrides).
+			Msg("Fleet indices renamed")
+	}
+	return nil
+}
+
+// initValidator wraps the bulker into a Validator of the documents written to
+// the indices shared by the Fleet Servers of all versions.
+func initValidator(bulker bulk.Bulk) (*bulk.Validator, error) {
+	mappings := map[string]string{
+		dl.FleetAgents:         es.MappingAgent,
+		dl.FleetActionsResults: es.MappingActionResult,
+		dl.FleetPoliciesLeader: es.MappingPolicyLeader,
+	}
+	schemas := make(map[string]*es.Schema, len(mappings))
+	for index, mapping := range mappings {
+		schema, err := es.NewSchema(mapping)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", index, err)
+		}
+		schemas[index] = schema
+	}
+	return bulk.NewValidator(bulker, schemas), nil
+}
+
+// certSources returns the certificates configured for the server and for the
+// connection to Elasticsearch.
+func certSources(cfg *config.Config) []certmon.Source {
+	var sources []certmon.Source
+	add := func(prefix string, tls *tlscommon.Config) {
+		if !tls.IsEnabled() {
+			return
+		}
+		if tls.Certificate.Certificate != "" {
+			sources = append(sources, certmon.Source{Name: prefix, PEM: tls.Certificate.Certificate})
+		}
+		for i, ca := range tls.CAs {
+			name := prefix + "_ca"
+			if i > 0 {
+				name = fmt.Sprintf("%s_ca%d", prefix, i)
+			}
+			sources = append(sources, certmon.Source{Name: name, PEM: ca})
+		}
+	}
+	add("server", cfg.Inputs[0].Server.TLS)
+	add("elasticsearch", cfg.Output.Elasticsearch.TLS)
+	return sources
 }
 
 func (f *FleetServer) runServer(ctx context.Context, cfg *config.Config) (err error) {
 	initRuntime(cfg)
 
+	if err := redact.Default.Configure(cfg.Inputs[0].Server.LogRedaction.Patterns); err != nil {
+		return err
+	}
+
+	if err := initIndices(&cfg.Inputs[0].Server.Indices); err != nil {
+		return err
+	}
+
+	if preset := cfg.Inputs[0].Server.Limits.Preset; preset != "" {
+		log.Info().
+			Str("preset", preset).
+			Interface("limits", cfg.Inputs[0].Server.Limits).
+			Interface("cache", cfg.Inputs[0].Cache).
+			Dur("checkin_long_poll", cfg.Inputs[0].Server.Timeouts.CheckinLongPoll).
+			Msg("Using limits preset")
+	}
+
 	// The metricsServer is only enabled if http.enabled is set in the config
 	metricsServer, err := f.initMetrics(ctx, cfg)
 	switch {
@@ -520,20 +726,25 @@ func (f *FleetServer) runServer(ctx context.Context, cfg *config.Config) (err er
 		defer metricsServer.Stop()
 	}
 
-	// Bulker is started in its own context and managed inside of this function. This is done so
-	// when the `ctx` is cancelled every worker using the bulker can get everything written on
-	// shutdown before the bulker is then cancelled.
-	bulkCtx, bulkCancel := context.WithCancel(context.Background())
-	defer bulkCancel()
-	esCli, bulker, err := bulk.InitES(bulkCtx, cfg)
+	// Bulker and preflight checks, waiting for Elasticsearch if configured to
+	esCli, bulker, bulkCancel, err := f.initES(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	defer bulkCancel()
+	if b, ok := bulker.(*bulk.Bulker); ok {
+		registerBulkRetryMetrics(b)
+		registerBulkFlushMetrics(b)
+	}
 
-	// Check version compatibility with Elasticsearch
-	err = ver.CheckCompatibility(ctx, esCli, f.ver)
-	if err != nil {
-		return fmt.Errorf("failed version compatibility check with elasticsearch: %w", err)
+	// Before the mirror, so the refused writes are not mirrored either
+	if cfg.Inputs[0].Server.SchemaValidation.Enabled {
+		validator, err := initValidator(bulker)
+		if err != nil {
+			return err
+		}
+		bulker = validator
+		registerSchemaValidationMetrics(validator)
 	}
 
 	// Monitoring es client, longer timeout, no retries
@@ -545,25 +756,60 @@ func (f *FleetServer) runServer(ctx context.Context, cfg *config.Config) (err er
 	// Replacing to errgroup context
 	g, ctx := errgroup.WithContext(ctx)
 
+	// Mirrors the writes to the cluster the fleet is migrated to
+	if mcfg := &cfg.Inputs[0].Server.Migration; mcfg.Enabled {
+		mirror, err := bulk.InitMirror(ctx, bulker, mcfg, mirroredIndices(mcfg))
+		if err != nil {
+			return err
+		}
+		bulker = mirror
+		g.Go(loggedRunFunc(ctx, "Migration mirror", mirror.Run))
+
+		checker := newMirrorChecker(mirror, mcfg)
+		registerMigrationMetrics(mirror, checker)
+		if mcfg.CheckInterval > 0 {
+			g.Go(loggedRunFunc(ctx, "Migration consistency checks", func(ctx context.Context) error {
+				return runMirrorChecks(ctx, checker, mcfg.CheckInterval)
+			}))
+		}
+		log.Warn().
+			Strs("hosts", mcfg.Elasticsearch.Hosts).
+			Strs("indices", mirroredIndices(mcfg)).
+			Msg("Migration mode: writes mirrored to a second cluster")
+	}
+
 	// Coordinator policy monitor
 	pim, err := monitor.New(dl.FleetPolicies, esCli, monCli,
 		monitor.WithFetchSize(cfg.Inputs[0].Monitor.FetchSize),
 		monitor.WithPollTimeout(cfg.Inputs[0].Monitor.PollTimeout),
+		monitor.WithWaitForAdvance(cfg.Inputs[0].Monitor.WaitForAdvance),
+		monitor.WithPollInterval(cfg.Inputs[0].Monitor.MinPollInterval, cfg.Inputs[0].Monitor.MaxPollInterval),
 	)
 	if err != nil {
 		return err
 	}
 
 	g.Go(loggedRunFunc(ctx, "Policy index monitor", pim.Run))
-	cord := coordinator.NewMonitor(cfg.Fleet, f.ver, bulker, pim, coordinator.NewCoordinatorZero)
-	g.Go(loggedRunFunc(ctx, "Coordinator policy monitor", cord.Run))
-
 	// Policy monitor
-	pm := policy.NewMonitor(bulker, pim, cfg.Inputs[0].Server.Limits.PolicyThrottle)
+	var pmOpts []policy.MonitorOpt
+	dpCfg := &cfg.Inputs[0].Server.DeletedPolicy
+	if fn := deletedPolicyHandler(dpCfg, &cfg.Inputs[0].Server.Actions, bulker); fn != nil {
+		// Checked by a single server, the leader of the task
+		deleted := coordinator.NewTaskLeader(bulker, "deleted-policies", cfg.Fleet.Agent.ID, f.ver)
+		g.Go(loggedRunFunc(ctx, "Deleted policies checker", func(ctx context.Context) error {
+			return deleted.Run(ctx, func(ctx context.Context) error {
+				return runDeletedPolicyCheck(ctx, bulker, dpCfg.CheckInterval, fn)
+			})
+		}))
+	}
+	if dpCfg.Action == config.DeletedPolicyReassign {
+		pmOpts = append(pmOpts, policy.WithReleaseDeleted(dpCfg.CheckInterval))
+	}
+	pm := policy.NewMonitor(bulker, pim, cfg.Inputs[0].Server.Limits.PolicyThrottle, pmOpts...)
 	g.Go(loggedRunFunc(ctx, "Policy monitor", pm.Run))
 
 	// Policy self monitor
-	sm := policy.NewSelfMonitor(cfg.Fleet, bulker, pim, cfg.Inputs[0].Policy.ID, f.reporter)
+	sm := policy.NewSelfMonitor(cfg.Fleet, bulker, pim, cfg.Inputs[0].Policy.ID, f.reporter, policy.WithRefusedPolicies(pm))
 	g.Go(loggedRunFunc(ctx, "Policy self monitor", sm.Run))
 
 	// Actions monitoring
@@ -575,40 +821,262 @@ func (f *FleetServer) runServer(ctx context.Context, cfg *config.Config) (err er
 		monitor.WithExpiration(true),
 		monitor.WithFetchSize(cfg.Inputs[0].Monitor.FetchSize),
 		monitor.WithPollTimeout(cfg.Inputs[0].Monitor.PollTimeout),
+		monitor.WithWaitForAdvance(cfg.Inputs[0].Monitor.WaitForAdvance),
+		monitor.WithPollInterval(cfg.Inputs[0].Monitor.MinPollInterval, cfg.Inputs[0].Monitor.MaxPollInterval),
 	)
 	if err != nil {
 		return err
 	}
 	g.Go(loggedRunFunc(ctx, "Revision monitor", am.Run))
 
-	ad = action.NewDispatcher(am)
+	ad = action.NewDispatcher(am, bulker)
 	g.Go(loggedRunFunc(ctx, "Revision dispatcher", ad.Run))
 	tr, err = action.NewTokenResolver(bulker)
 	if err != nil {
 		return err
 	}
 
-	bc := NewBulkCheckin(bulker)
+	bc := NewBulkCheckin(bulker, &cfg.Inputs[0].Server.Offline)
 	g.Go(loggedRunFunc(ctx, "Bulk checkin", bc.Run))
 
-	ct := NewCheckinT(f.verCon, &f.cfg.Inputs[0].Server, f.cache, bc, pm, am, ad, tr, bulker)
-	et, err := NewEnrollerT(f.verCon, &f.cfg.Inputs[0].Server, bulker, f.cache)
+	ua, err := newUserAgentPolicy(f.verCon, &cfg.Inputs[0].Server.UserAgent)
 	if err != nil {
 		return err
 	}
 
-	at := NewArtifactT(&f.cfg.Inputs[0].Server, bulker, f.cache)
-	ack := NewAckT(&f.cfg.Inputs[0].Server, bulker, f.cache)
+	fence, err := newGeofence(&cfg.Inputs[0].Server.Geofence)
+	if err != nil {
+		return err
+	}
+	events, err := newLifecycleOutbox(&cfg.Inputs[0].Server.LifecycleEvents)
+	if err != nil {
+		return err
+	}
+	if events != nil {
+		registerLifecycleMetrics(events)
+		g.Go(loggedRunFunc(ctx, "Lifecycle events publisher", events.Run))
+		if cfg.Inputs[0].Server.LifecycleEvents.OfflineAfter > 0 {
+			// Scanned by a single server, the leader of the task
+			offline := coordinator.NewTaskLeader(bulker, "offline-agents", cfg.Fleet.Agent.ID, f.ver)
+			g.Go(loggedRunFunc(ctx, "Offline agents detector", func(ctx context.Context) error {
+				return offline.Run(ctx, func(ctx context.Context) error {
+					return runOfflineDetector(ctx, bulker, &cfg.Inputs[0].Server.LifecycleEvents, events)
+				})
+			}))
+		}
+	}
+
+	budget, err := newLongPollBudget(&cfg.Inputs[0].Server.LongPollBudget)
+	if err != nil {
+		return err
+	}
+	caches, err := newPeerCache(&cfg.Inputs[0].Server.PeerCache, &cfg.Inputs[0].Server.Geofence)
+	if err != nil {
+		return err
+	}
+	ct := NewCheckinT(ua, &cfg.Inputs[0].Server, f.cache, bc, pm, am, ad, tr, bulker, fence, events, budget, caches)
+	et, err := NewEnrollerT(ua, &cfg.Inputs[0].Server, bulker, f.cache, fence, events)
+	if err != nil {
+		return err
+	}
 
-	router := NewRouter(bulker, ct, et, at, ack, sm)
+	at := NewArtifactT(&cfg.Inputs[0].Server, bulker, f.cache)
+	registerBandwidthMetrics("artifact_bandwidth", at.bandwidth)
+	ack := NewAckT(&cfg.Inputs[0].Server, bulker, f.cache, events)
+	dt := NewDiagnosticsT(&cfg.Inputs[0].Server, bulker, f.cache)
+	dlt := NewDeadLetterT(&cfg.Inputs[0].Server, bulker, f.cache)
+
+	kl := limit.NewKeyLimiter(&cfg.Inputs[0].Server.Limits.ApiKeyLimit)
+	bkt := NewBlockedKeysT(&cfg.Inputs[0].Server, bulker, f.cache, kl)
+	ft := NewFeaturesT(&cfg.Inputs[0].Server, bulker, f.cache, feature.Default)
+
+	cm := certmon.NewMonitor(&cfg.Inputs[0].Server.CertExpiry, certSources(cfg))
+	registerCertMetrics(cm)
+	g.Go(loggedRunFunc(ctx, "Certificate expiry monitor", cm.Run))
+
+	var res *transport.Resolver
+	if interval := cfg.Output.Elasticsearch.DNSResolveInterval; interval > 0 {
+		addrs, err := cfg.Output.Elasticsearch.Addresses()
+		if err != nil {
+			return err
+		}
+		res = transport.NewResolver(transport.Default, addrs, interval, transport.PurposeElasticsearch, transport.PurposeElasticsearchLongPoll)
+		g.Go(loggedRunFunc(ctx, "Elasticsearch hosts resolver", res.Run))
+	}
+
+	// Coordinator policy monitor; records the status of this server for its peers
+	withStatus := coordinator.WithServerStatus(func() string {
+		status, _ := localStatus(sm, cm, res, false)
+		return status.String()
+	})
+	cord := coordinator.NewMonitor(cfg.Fleet, f.ver, bulker, pim, coordinator.NewCoordinatorZero, withStatus)
+	g.Go(loggedRunFunc(ctx, "Coordinator policy monitor", cord.Run))
+
+	if n := cfg.Inputs[0].Server.Simulation.Peers; n > 0 {
+		log.Warn().Int("peers", n).Msg("Simulating Fleet Server peers; for development only")
+		for i := 1; i <= n; i++ {
+			i := i
+			peer := &simulatedPeer{
+				id: coordinator.PeerFleet(cfg.Fleet, i).Agent.ID,
+				newMonitor: func() coordinator.Monitor {
+					return coordinator.NewSimulatedPeer(i, cfg.Fleet, f.ver, bulker, pim, coordinator.NewCoordinatorZero, withStatus)
+				},
+			}
+			if cfg.Inputs[0].Server.RollingRestart.Enabled {
+				peer.newRestart = func() *RollingRestartT {
+					return NewRollingRestartT(&cfg.Inputs[0].Server, peer.id, bulker, f.cache, newLongPolls())
+				}
+			}
+			g.Go(loggedRunFunc(ctx, fmt.Sprintf("Simulated peer %d", i), peer.Run))
+		}
+	}
+
+	tokens := es.ServiceTokensFor(&cfg.Output.Elasticsearch)
+	stt := NewServiceTokenT(&cfg.Inputs[0].Server, bulker, f.cache, tokens)
+	if cutover, _ := cfg.Output.Elasticsearch.CutoverTime(); tokens != nil && !cutover.IsZero() {
+		g.Go(loggedRunFunc(ctx, "Service token cutover", func(ctx context.Context) error {
+			return tokens.CutoverAt(ctx, esCli, cutover)
+		}))
+	}
+
+	sst := NewServersStatusT(&cfg.Inputs[0].Server, bulker, f.cache, sm, cm, res)
+
+	registerLongPollMetrics(ct.polls)
+	registerClockSkewMetrics(ct.skew)
+
+	// Reports the state kept per checkin and per agent, checked against the
+	// open connections for leaks
+	ld := newLeakDetector(&cfg.Inputs[0].Server, pm, ad, tr, ct.polls)
+	registerLeakMetrics(ld)
+	if cfg.Inputs[0].Server.LeakDetection.Enabled {
+		g.Go(loggedRunFunc(ctx, "Leak detection", ld.Run))
+	}
+	if ct.compression.adaptive() {
+		registerCompressionMetrics(ct.compression)
+		g.Go(loggedRunFunc(ctx, "Compression tuner", ct.compression.Run))
+	}
+	lpt := NewLongPollsT(&cfg.Inputs[0].Server, bulker, f.cache, ct.polls)
+	qt := NewQuarantineT(&cfg.Inputs[0].Server, bulker, f.cache, ct.polls)
+
+	// Agents of the access API keys blocked by the key limiter are quarantined
+	var autoQuarantine *QuarantineT
+	if cfg.Inputs[0].Server.Limits.ApiKeyLimit.Quarantine {
+		autoQuarantine = qt
+	}
+
+	// Disruptive background jobs only run within the maintenance windows
+	mw, err := cfg.Inputs[0].Server.Maintenance.MaintenanceWindows()
+	if err != nil {
+		return err
+	}
+
+	eht := NewEnrollmentHistoryT(&cfg.Inputs[0].Server, bulker, f.cache)
+	if hcfg := &cfg.Inputs[0].Server.EnrollmentHistory; hcfg.Enabled {
+		if err := ensureEnrollmentHistory(ctx, esCli, hcfg); err != nil {
+			return fmt.Errorf("enrollment history: %w", err)
+		}
+		registerHistoryMetrics("enrollment_history", et.history)
+	}
+
+	djt := NewDispatchJournalT(&cfg.Inputs[0].Server, bulker, f.cache)
+	if jcfg := &cfg.Inputs[0].Server.DispatchJournal; jcfg.Enabled {
+		if err := ensureDispatchJournal(ctx, esCli, jcfg); err != nil {
+			return fmt.Errorf("dispatch journal: %w", err)
+		}
+		registerHistoryMetrics("dispatch_journal", ct.journal)
+	}
+
+	storage, err := newUploadStorage(&cfg.Inputs[0].Server.Upload.Storage, bulker)
+	if err != nil {
+		return err
+	}
+	ut := NewUploadT(&cfg.Inputs[0].Server, bulker, f.cache, storage)
+
+	if gcfg := &cfg.Inputs[0].Server.UploadGC; gcfg.Enabled {
+		g.Go(loggedRunFunc(ctx, "Upload GC", func(ctx context.Context) error {
+			return newUploadGC(gcfg, storage, bulker, mw).Run(ctx)
+		}))
+	}
+
+	aft := NewActionsFanOutT(&cfg.Inputs[0].Server, bulker, f.cache)
+	bat, err := NewBulkActionsT(&cfg.Inputs[0].Server, bulker)
+	if err != nil {
+		return err
+	}
+	ppt := NewPolicyPreviewT(&cfg.Inputs[0].Server, bulker, f.cache)
+	vt := NewVersionT(&cfg.Inputs[0].Server, f.ver, ua, bulker, f.cache)
+	tt := NewTelemetryT(&cfg.Inputs[0].Server, bulker, f.cache)
+	xt := NewExportT(&cfg.Inputs[0].Server, bulker, f.cache)
+	lt := NewLimitsT(&cfg.Inputs[0].Server, bulker, f.cache)
+
+	// Reports the request handlers stuck past the timeout budget of their endpoint
+	wd := newWatchdog(&cfg.Inputs[0].Server)
+	if wd != nil {
+		registerWatchdogMetrics(wd)
+		g.Go(loggedRunFunc(ctx, "Request watchdog", wd.Run))
+	}
+
+	// Logs the requests slower than the threshold of their endpoint
+	srl := newSlowRequests(&cfg.Inputs[0].Server)
+
+	cip, err := newClientIPs(&cfg.Inputs[0].Server.ClientIP)
+	if err != nil {
+		return err
+	}
+	ipf, err := newIPFilter(&cfg.Inputs[0].Server.IPFilter)
+	if err != nil {
+		return err
+	}
+
+	// Takes the turns of this server in the rolling restarts
+	rrt := NewRollingRestartT(&cfg.Inputs[0].Server, cfg.Fleet.Agent.ID, bulker, f.cache, ct.polls)
+	if cfg.Inputs[0].Server.RollingRestart.Enabled {
+		g.Go(loggedRunFunc(ctx, "Rolling restart", rrt.Run))
+	}
+
+	hdt := NewHealthzDeepT(&cfg.Inputs[0].Server, cfg.Fleet.Agent.ID, bulker, f.cache)
+
+	// Logs the requests of the agents captured through the admin API
+	capture := newDebugCapture(&cfg.Inputs[0].Server.DebugCapture, logFilesPath(cfg))
+	defer capture.close()
+	dct := NewDebugCaptureT(&cfg.Inputs[0].Server, bulker, f.cache, capture)
+
+	router := NewRouter(bulker, ct, et, at, ack, dt, dlt, bkt, ft, qt, sm, cm, res, stt, sst, lpt, eht, aft, vt, tt, xt, wd, lt, cip, ipf, rrt, hdt, dct, srl, ut, bat, ppt, djt)
+
+	// Mirrors a sample of the checkins to a staging Fleet Server
+	sh, err := newShadow(&cfg.Inputs[0].Server.Shadow)
+	if err != nil {
+		return err
+	}
+	if sh != nil {
+		registerShadowMetrics(sh)
+		g.Go(loggedRunFunc(ctx, "Request shadowing", sh.Run))
+	}
 
 	g.Go(loggedRunFunc(ctx, "Http server", func(ctx context.Context) error {
-		return runServer(ctx, router, &f.cfg.Inputs[0].Server)
+		return runServer(ctx, withShadow(withKeyLimit(router, kl, autoQuarantine), sh), &cfg.Inputs[0].Server)
 	}))
 
 	return g.Wait()
 }
 
+// resizeCache resizes the cache after cfg; the resized segments take over
+// the cached entries. It must not be called while the server runs.
+func (f *FleetServer) resizeCache(cfg *config.Config) {
+	log.Info().
+		Int64("numCounters", cfg.Inputs[0].Cache.NumCounters).
+		Int64("maxCost", cfg.Inputs[0].Cache.MaxCost).
+		Msg("resizeCache")
+
+	c, err := f.cache.Resize(cacheConfig(cfg))
+	if err != nil {
+		log.Error().Err(err).Msg("Fail to resize cache; keep current cache")
+		return
+	}
+	f.cache = c
+	registerCacheMetrics(c)
+}
+
 // Reload reloads the fleet server with the latest configuration.
 func (f *FleetServer) Reload(ctx context.Context, cfg *config.Config) error {
 	select {
@@ -0,0 +1,20 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build go1.19
+
+package fleet
+
+import "runtime/debug"
+
+// setMemoryLimit sets the soft memory limit of the runtime and returns the
+// previous one.
+func setMemoryLimit(limit int64) (int64, bool) {
+	return debug.SetMemoryLimit(limit), true
+}
+
+// memoryLimit returns the soft memory limit of the runtime.
+func memoryLimit() int64 {
+	return debug.SetMemoryLimit(-1)
+}
@@ -0,0 +1,18 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !go1.19
+
+package fleet
+
+// setMemoryLimit is not supported before Go 1.19, which added the soft memory
+// limit.
+func setMemoryLimit(limit int64) (int64, bool) {
+	return -1, false
+}
+
+// memoryLimit returns -1, no limit being supported.
+func memoryLimit() int64 {
+	return -1
+}
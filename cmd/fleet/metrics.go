@@ -8,10 +8,21 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"net/http"
+	"time"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/action"
+	"github.com/elastic/fleet-server/v7/internal/pkg/build"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/certmon"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	"github.com/elastic/fleet-server/v7/internal/pkg/lifecycle"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/throttle"
 
 	"github.com/elastic/beats/v7/libbeat/api"
 	"github.com/elastic/beats/v7/libbeat/cmd/instance/metrics"
@@ -27,11 +38,79 @@ var (
 	cntHttpNew   *monitoring.Uint
 	cntHttpClose *monitoring.Uint
 
-	cntCheckin   routeStats
-	cntEnroll    routeStats
-	cntAcks      routeStats
-	cntStatus    routeStats
-	cntArtifacts artifactStats
+	cntAuthFail       *monitoring.Uint
+	cntAuthSuppressed *monitoring.Uint
+	cntAuthBlocked    *monitoring.Uint
+	cntAuthUnenrolled *monitoring.Uint
+	cntGeofenced      *monitoring.Uint
+	cntIPFiltered     *monitoring.Uint
+
+	cntCheckinQueued   *monitoring.Uint
+	cntCheckinDropped  *monitoring.Uint
+	cntCheckinReplayed *monitoring.Uint
+	cntCheckinOffline  *monitoring.Uint
+	cntDegraded        *monitoring.Uint
+	cntDrainRefused    *monitoring.Uint
+	cntEnrollReplaced  *monitoring.Uint
+	cntLongPollRefused *monitoring.Uint
+	cntPeerCacheHinted *monitoring.Uint
+
+	cntEnrollFingerprintTaken *monitoring.Uint
+
+	cntAckTokenInvalid  *monitoring.Uint
+	cntAckTokenStale    *monitoring.Uint
+	cntAckTokenNotFound *monitoring.Uint
+
+	cntActionsSkipped  *monitoring.Uint
+	cntActionsDeferred *monitoring.Uint
+
+	cntQuarantined          *monitoring.Uint
+	cntQuarantineSuppressed *monitoring.Uint
+
+	cntUploadScanClean    *monitoring.Uint
+	cntUploadScanRejected *monitoring.Uint
+	cntUploadScanFailed   *monitoring.Uint
+
+	cntPolicyCompiled     *monitoring.Uint
+	cntPolicyHashVerified *monitoring.Uint
+	cntPolicyHashMismatch *monitoring.Uint
+
+	cntBodySizes bodySizes
+
+	cntUserAgentRejected versionBuckets
+	cntUserAgentWarned   versionBuckets
+
+	cntCheckin        routeStats
+	cntCheckinPoll    routeStats
+	cntEnroll         routeStats
+	cntReissue        routeStats
+	cntAcks           routeStats
+	cntStatus         routeStats
+	cntVersion        routeStats
+	cntOpenAPI        routeStats
+	cntDiagnostics    routeStats
+	cntDeadLetter     routeStats
+	cntEnrollHistory  routeStats
+	cntBlockedKeys    routeStats
+	cntFeatures       routeStats
+	cntQuarantine     routeStats
+	cntServersStatus  routeStats
+	cntServersRestart routeStats
+	cntHealthzDeep    routeStats
+	cntDebugCapture   routeStats
+	cntLongPolls      routeStats
+	cntServiceToken   routeStats
+	cntActionsFanOut  routeStats
+	cntBulkActions    routeStats
+	cntPolicyPreview  routeStats
+	cntDispatches     routeStats
+	cntTelemetry      routeStats
+	cntExport         routeStats
+	cntLimits         routeStats
+	cntUploadBegin    routeStats
+	cntUploadChunk    routeStats
+	cntUploadComplete routeStats
+	cntArtifacts      artifactStats
 )
 
 func (f *FleetServer) initMetrics(ctx context.Context, cfg *config.Config) (*api.Server, error) {
@@ -39,6 +118,9 @@ func (f *FleetServer) initMetrics(ctx context.Context, cfg *config.Config) (*api
 	if registry.Get("version") == nil {
 		monitoring.NewString(registry, "version").Set(f.ver)
 	}
+	if registry.Get("commit") == nil {
+		monitoring.NewString(registry, "commit").Set(build.Commit)
+	}
 	if registry.Get("name") == nil {
 		monitoring.NewString(registry, "name").Set("fleet-server")
 	}
@@ -72,6 +154,9 @@ type routeStats struct {
 	drop      *monitoring.Uint
 	bodyIn    *monitoring.Uint
 	bodyOut   *monitoring.Uint
+
+	// Request bytes once decompressed, bodyIn being the bytes received
+	bodyInUncompressed *monitoring.Uint
 }
 
 func (rt *routeStats) Register(registry *monitoring.Registry) {
@@ -83,6 +168,7 @@ func (rt *routeStats) Register(registry *monitoring.Registry) {
 	rt.drop = monitoring.NewUint(registry, "drop")
 	rt.bodyIn = monitoring.NewUint(registry, "body_in")
 	rt.bodyOut = monitoring.NewUint(registry, "body_out")
+	rt.bodyInUncompressed = monitoring.NewUint(registry, "body_in_uncompressed")
 }
 
 func init() {
@@ -91,13 +177,400 @@ func init() {
 	cntHttpNew = monitoring.NewUint(registry, "tcp_open")
 	cntHttpClose = monitoring.NewUint(registry, "tcp_close")
 
+	authRegistry := registry.NewRegistry("auth")
+	cntAuthFail = monitoring.NewUint(authRegistry, "fail_cached")
+	cntAuthSuppressed = monitoring.NewUint(authRegistry, "suppressed")
+	cntAuthBlocked = monitoring.NewUint(authRegistry, "blocked")
+	cntAuthUnenrolled = monitoring.NewUint(authRegistry, "unenrolled")
+	cntGeofenced = monitoring.NewUint(authRegistry, "geofenced")
+	cntIPFiltered = monitoring.NewUint(authRegistry, "ip_filtered")
+
+	offlineRegistry := registry.NewRegistry("offline")
+	cntCheckinQueued = monitoring.NewUint(offlineRegistry, "queued")
+	cntCheckinDropped = monitoring.NewUint(offlineRegistry, "dropped")
+	cntCheckinReplayed = monitoring.NewUint(offlineRegistry, "replayed")
+	cntCheckinOffline = monitoring.NewUint(offlineRegistry, "checkin")
+	cntDegraded = monitoring.NewUint(offlineRegistry, "degraded")
+
+	cntDrainRefused = monitoring.NewUint(registry.NewRegistry("rolling_restart"), "drain_refused")
+	cntLongPollRefused = monitoring.NewUint(registry.NewRegistry("long_poll_budget"), "refused")
+	cntPeerCacheHinted = monitoring.NewUint(registry.NewRegistry("peer_cache"), "hinted")
+	enrollRegistry := registry.NewRegistry("enroll")
+	cntEnrollReplaced = monitoring.NewUint(enrollRegistry, "replaced")
+	cntEnrollFingerprintTaken = monitoring.NewUint(enrollRegistry, "fingerprint_taken")
+
+	ackTokenRegistry := registry.NewRegistry("ack_token")
+	cntAckTokenInvalid = monitoring.NewUint(ackTokenRegistry, "invalid")
+	cntAckTokenStale = monitoring.NewUint(ackTokenRegistry, "stale")
+	cntAckTokenNotFound = monitoring.NewUint(ackTokenRegistry, "not_found")
+
+	actionsRegistry := registry.NewRegistry("pending_actions")
+	cntActionsSkipped = monitoring.NewUint(actionsRegistry, "skipped")
+	cntActionsDeferred = monitoring.NewUint(actionsRegistry, "deferred")
+
+	quarantineRegistry := registry.NewRegistry("quarantine")
+	cntQuarantined = monitoring.NewUint(quarantineRegistry, "quarantined")
+	cntQuarantineSuppressed = monitoring.NewUint(quarantineRegistry, "suppressed")
+
+	uploadScanRegistry := registry.NewRegistry("upload_scan")
+	cntUploadScanClean = monitoring.NewUint(uploadScanRegistry, "clean")
+	cntUploadScanRejected = monitoring.NewUint(uploadScanRegistry, "rejected")
+	cntUploadScanFailed = monitoring.NewUint(uploadScanRegistry, "failed")
+
+	policyRegistry := registry.NewRegistry("policy")
+	cntPolicyCompiled = monitoring.NewUint(policyRegistry, "compiled")
+	cntPolicyHashVerified = monitoring.NewUint(policyRegistry, "hash_verified")
+	cntPolicyHashMismatch = monitoring.NewUint(policyRegistry, "hash_mismatch")
+
+	userAgentRegistry := registry.NewRegistry("user_agent")
+	monitoring.NewFunc(userAgentRegistry, "rejected", cntUserAgentRejected.report)
+	monitoring.NewFunc(userAgentRegistry, "warned", cntUserAgentWarned.report)
+
+	monitoring.NewFunc(registry, "body_size", cntBodySizes.report)
+
 	routesRegistry := registry.NewRegistry("routes")
 
 	cntCheckin.Register(routesRegistry.NewRegistry("checkin"))
+	cntCheckinPoll.Register(routesRegistry.NewRegistry("checkin_poll"))
 	cntEnroll.Register(routesRegistry.NewRegistry("enroll"))
+	cntReissue.Register(routesRegistry.NewRegistry("reissue"))
 	cntArtifacts.Register(routesRegistry.NewRegistry("artifacts"))
 	cntAcks.Register(routesRegistry.NewRegistry("acks"))
 	cntStatus.Register(routesRegistry.NewRegistry("status"))
+	cntVersion.Register(routesRegistry.NewRegistry("version"))
+	cntOpenAPI.Register(routesRegistry.NewRegistry("openapi"))
+	cntDiagnostics.Register(routesRegistry.NewRegistry("diagnostics"))
+	cntDeadLetter.Register(routesRegistry.NewRegistry("deadletter"))
+	cntEnrollHistory.Register(routesRegistry.NewRegistry("enrollment_history"))
+	cntBlockedKeys.Register(routesRegistry.NewRegistry("blocked_keys"))
+	cntFeatures.Register(routesRegistry.NewRegistry("features"))
+	cntQuarantine.Register(routesRegistry.NewRegistry("quarantine"))
+	cntServersStatus.Register(routesRegistry.NewRegistry("servers_status"))
+	cntServersRestart.Register(routesRegistry.NewRegistry("servers_restart"))
+	cntHealthzDeep.Register(routesRegistry.NewRegistry("healthz_deep"))
+	cntDebugCapture.Register(routesRegistry.NewRegistry("debug_capture"))
+	cntLongPolls.Register(routesRegistry.NewRegistry("long_polls"))
+	cntServiceToken.Register(routesRegistry.NewRegistry("service_token"))
+	cntActionsFanOut.Register(routesRegistry.NewRegistry("actions_fan_out"))
+	cntBulkActions.Register(routesRegistry.NewRegistry("bulk_actions"))
+	cntPolicyPreview.Register(routesRegistry.NewRegistry("policy_preview"))
+	cntDispatches.Register(routesRegistry.NewRegistry("dispatch_journal"))
+	cntTelemetry.Register(routesRegistry.NewRegistry("otlp_metrics"))
+	cntExport.Register(routesRegistry.NewRegistry("export_agents"))
+	cntLimits.Register(routesRegistry.NewRegistry("limits"))
+	cntUploadBegin.Register(routesRegistry.NewRegistry("upload_begin"))
+	cntUploadChunk.Register(routesRegistry.NewRegistry("upload_chunk"))
+	cntUploadComplete.Register(routesRegistry.NewRegistry("upload_complete"))
+
+	registerTemplateMetrics()
+}
+
+// registerTemplateMetrics reports the renders of the prepared queries, in
+// seconds for their mean latency, under "dl_templates.<template>".
+func registerTemplateMetrics() {
+	monitoring.Default.Remove("dl_templates")
+	monitoring.NewFunc(monitoring.Default, "dl_templates", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		for name, stats := range dl.TemplatesStats() {
+			stats := stats
+			monitoring.ReportNamespace(V, name, func() {
+				monitoring.ReportInt(V, "renders", int64(stats.Renders))
+				monitoring.ReportInt(V, "failures", int64(stats.Failures))
+				monitoring.ReportFloat(V, "mean_latency", stats.Latency.Seconds())
+			})
+		}
+	})
+}
+
+// registerCacheMetrics reports the counters of each cache segment under
+// "cache.<segment>"; the values are read from the cache when collected.
+func registerCacheMetrics(c cache.Cache) {
+	reg := monitoring.Default.GetRegistry("cache")
+	if reg == nil {
+		reg = monitoring.Default.NewRegistry("cache")
+	}
+
+	for _, name := range c.Segments() {
+		name := name
+		reg.Remove(name)
+		monitoring.NewFunc(reg, name, func(_ monitoring.Mode, V monitoring.Visitor) {
+			stats, _ := c.Stats(name)
+
+			V.OnRegistryStart()
+			defer V.OnRegistryFinished()
+
+			monitoring.ReportInt(V, "hits", int64(stats.Hits))
+			monitoring.ReportInt(V, "misses", int64(stats.Misses))
+			monitoring.ReportInt(V, "added", int64(stats.KeysAdded))
+			monitoring.ReportInt(V, "evicted", int64(stats.KeysEvicted))
+			monitoring.ReportInt(V, "entries", int64(stats.Entries))
+			monitoring.ReportInt(V, "cost", int64(stats.Cost))
+			monitoring.ReportInt(V, "max_cost", stats.MaxCost)
+		})
+	}
+}
+
+// registerCertMetrics reports the expiry of each configured certificate under
+// "certificates.expiry.<certificate>".
+func registerCertMetrics(cm *certmon.Monitor) {
+	reg := monitoring.Default.GetRegistry("certificates")
+	if reg == nil {
+		reg = monitoring.Default.NewRegistry("certificates")
+	}
+
+	reg.Remove("expiry")
+	monitoring.NewFunc(reg, "expiry", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		now := time.Now()
+		for _, e := range cm.Certificates() {
+			e := e
+			monitoring.ReportNamespace(V, e.Name, func() {
+				monitoring.ReportInt(V, "days_to_expiry", int64(e.Remaining(now)/(24*time.Hour)))
+				monitoring.ReportString(V, "not_after", e.NotAfter.UTC().Format(time.RFC3339))
+			})
+		}
+	})
+}
+
+// registerLongPollMetrics reports the count and ages, in seconds, of the open
+// checkin long polls under "long_poll".
+func registerLongPollMetrics(lp *longPolls) {
+	monitoring.Default.Remove("long_poll")
+	monitoring.NewFunc(monitoring.Default, "long_poll", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := lp.stats()
+		monitoring.ReportInt(V, "open", int64(stats.Open))
+		monitoring.ReportFloat(V, "oldest_age", stats.Oldest.Seconds())
+		monitoring.ReportFloat(V, "mean_age", stats.Mean.Seconds())
+	})
+}
+
+// registerClockSkewMetrics reports the distribution of the skews of the agent
+// clocks, in seconds, under "clock_skew".
+func registerClockSkewMetrics(cs *clockSkew) {
+	monitoring.Default.Remove("clock_skew")
+	monitoring.NewFunc(monitoring.Default, "clock_skew", cs.report)
+}
+
+// registerLeakMetrics reports the open connections and the state kept per
+// checkin and per agent, with the live policy subscriptions by policy id, and
+// the divergences detected, under "leaks".
+func registerLeakMetrics(ld *leakDetector) {
+	monitoring.Default.Remove("leaks")
+	monitoring.NewFunc(monitoring.Default, "leaks", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		counts := ld.counts()
+		monitoring.ReportInt(V, "connections", counts.Connections)
+		monitoring.ReportInt(V, "long_polls", int64(counts.LongPolls))
+		monitoring.ReportInt(V, "action_subscriptions", int64(counts.ActionSubscriptions))
+		monitoring.ReportInt(V, "ack_seqnos", int64(counts.AckSeqNos))
+		monitoring.ReportInt(V, "ack_tokens", int64(counts.AckTokens))
+		monitoring.ReportInt(V, "divergences", int64(counts.Divergences))
+		monitoring.ReportNamespace(V, "policy_subscriptions", func() {
+			for policyId, n := range counts.PolicySubscriptions {
+				monitoring.ReportInt(V, policyId, int64(n))
+			}
+		})
+	})
+}
+
+// registerCompressionMetrics reports the gzip level and threshold of the
+// checkin responses, the CPU they were tuned to and the tuning decisions
+// under "compression".
+func registerCompressionMetrics(t *compressionTuner) {
+	monitoring.Default.Remove("compression")
+	monitoring.NewFunc(monitoring.Default, "compression", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := t.stats()
+		monitoring.ReportInt(V, "level", int64(stats.Level))
+		monitoring.ReportInt(V, "threshold", int64(stats.Threshold))
+		monitoring.ReportFloat(V, "cpu", stats.CPU)
+		monitoring.ReportInt(V, "lowered", int64(stats.Lowered))
+		monitoring.ReportInt(V, "raised", int64(stats.Raised))
+	})
+}
+
+// registerShadowMetrics reports the checkin requests mirrored to the staging
+// server under "shadow".
+func registerShadowMetrics(s *shadow) {
+	monitoring.Default.Remove("shadow")
+	monitoring.NewFunc(monitoring.Default, "shadow", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := s.stats()
+		monitoring.ReportInt(V, "mirrored", int64(stats.Mirrored))
+		monitoring.ReportInt(V, "dropped", int64(stats.Dropped))
+		monitoring.ReportInt(V, "failed", int64(stats.Failed))
+		monitoring.ReportInt(V, "queued", int64(stats.Queued))
+	})
+}
+
+// registerWatchdogMetrics reports the request handlers tracked by the
+// watchdog, and those stuck past their budget, under "watchdog".
+func registerWatchdogMetrics(wd *watchdog) {
+	monitoring.Default.Remove("watchdog")
+	monitoring.NewFunc(monitoring.Default, "watchdog", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := wd.stats()
+		monitoring.ReportInt(V, "tracked", int64(stats.Tracked))
+		monitoring.ReportInt(V, "stuck", int64(stats.Stuck))
+		monitoring.ReportInt(V, "detected", int64(stats.Detected))
+		monitoring.ReportInt(V, "canceled", int64(stats.Canceled))
+	})
+}
+
+// registerMigrationMetrics reports the writes mirrored to the cluster of the
+// migration, the lag of the mirror in seconds and the last consistency check
+// under "migration".
+func registerMigrationMetrics(m *bulk.Mirror, c *mirrorChecker) {
+	monitoring.Default.Remove("migration")
+	monitoring.NewFunc(monitoring.Default, "migration", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := m.Stats()
+		monitoring.ReportInt(V, "pending", stats.Pending)
+		monitoring.ReportFloat(V, "lag", stats.Lag.Seconds())
+		monitoring.ReportInt(V, "mirrored", int64(stats.Mirrored))
+		monitoring.ReportInt(V, "repaired", int64(stats.Repaired))
+		monitoring.ReportInt(V, "failed", int64(stats.Failed))
+		monitoring.ReportInt(V, "dropped", int64(stats.Dropped))
+
+		check := c.stats()
+		monitoring.ReportInt(V, "check_checked", int64(check.Checked))
+		monitoring.ReportInt(V, "check_missing", int64(check.Missing))
+		monitoring.ReportInt(V, "check_mismatched", int64(check.Mismatched))
+		monitoring.ReportInt(V, "check_count_diff", check.CountDiff)
+	})
+}
+
+// registerBulkRetryMetrics reports the bulk items rejected with a 429 and
+// retried under "bulk_retry".
+func registerBulkRetryMetrics(b *bulk.Bulker) {
+	monitoring.Default.Remove("bulk_retry")
+	monitoring.NewFunc(monitoring.Default, "bulk_retry", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := b.RetryStats()
+		monitoring.ReportInt(V, "depth", stats.Depth)
+		monitoring.ReportInt(V, "retried", int64(stats.Retried))
+		monitoring.ReportInt(V, "exhausted", int64(stats.Exhausted))
+	})
+}
+
+// registerBulkFlushMetrics reports the flush interval in seconds and the max
+// pending flushes of the bulker, and the arrival rate and flush latency they
+// are tuned to, under "bulk_flush".
+func registerBulkFlushMetrics(b *bulk.Bulker) {
+	monitoring.Default.Remove("bulk_flush")
+	monitoring.NewFunc(monitoring.Default, "bulk_flush", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := b.FlushStats()
+		monitoring.ReportFloat(V, "interval", stats.Interval.Seconds())
+		monitoring.ReportInt(V, "max_pending", int64(stats.MaxPending))
+		monitoring.ReportFloat(V, "rate", stats.Rate)
+		monitoring.ReportFloat(V, "latency", stats.Latency.Seconds())
+	})
+}
+
+// registerSchemaValidationMetrics reports the writes refused for not matching
+// the mappings under "schema_validation".
+func registerSchemaValidationMetrics(v *bulk.Validator) {
+	monitoring.Default.Remove("schema_validation")
+	monitoring.NewFunc(monitoring.Default, "schema_validation", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		monitoring.ReportInt(V, "refused", int64(v.Refused()))
+	})
+}
+
+// registerLifecycleMetrics reports the outbox of the lifecycle events under
+// "lifecycle_events".
+func registerLifecycleMetrics(o *lifecycle.Outbox) {
+	monitoring.Default.Remove("lifecycle_events")
+	monitoring.NewFunc(monitoring.Default, "lifecycle_events", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := o.Stats()
+		monitoring.ReportInt(V, "pending", int64(stats.Pending))
+		monitoring.ReportInt(V, "published", int64(stats.Published))
+		monitoring.ReportInt(V, "dropped", int64(stats.Dropped))
+		monitoring.ReportInt(V, "failures", int64(stats.Failures))
+	})
+}
+
+// registerHistoryMetrics reports the writes of the recorder of a history under
+// name.
+func registerHistoryMetrics(name string, hr *historyRecorder) {
+	monitoring.Default.Remove(name)
+	monitoring.NewFunc(monitoring.Default, name, func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := hr.stats()
+		monitoring.ReportInt(V, "pending", int64(stats.Pending))
+		monitoring.ReportInt(V, "recorded", int64(stats.Recorded))
+		monitoring.ReportInt(V, "dropped", int64(stats.Dropped))
+		monitoring.ReportInt(V, "failed", int64(stats.Failed))
+	})
+}
+
+// registerBandwidthMetrics reports the use of the global budget of the
+// bandwidth throttle, and of the budgets and queues of the policies of its
+// configuration under policy.<id>, under name.
+func registerBandwidthMetrics(name string, b *throttle.Bandwidth) {
+	monitoring.Default.Remove(name)
+	monitoring.NewFunc(monitoring.Default, name, func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		stats := b.Stats()
+		monitoring.ReportInt(V, "limit", stats.Limit)
+		monitoring.ReportInt(V, "rate", int64(stats.Rate))
+		monitoring.ReportInt(V, "bytes", int64(stats.Bytes))
+		monitoring.ReportInt(V, "transfers", stats.Transfers)
+		monitoring.ReportInt(V, "policies", int64(stats.Policies))
+		monitoring.ReportInt(V, "agents", int64(stats.Agents))
+		monitoring.ReportInt(V, "queued", int64(stats.Queued))
+		monitoring.ReportInt(V, "rejected", int64(stats.Rejected))
+		if stats.Limit > 0 {
+			monitoring.ReportFloat(V, "utilization", float64(stats.Rate)/float64(stats.Limit))
+		}
+
+		policies := b.PolicyStats()
+		if len(policies) == 0 {
+			return
+		}
+		monitoring.ReportNamespace(V, "policy", func() {
+			for id, stats := range policies {
+				stats := stats
+				monitoring.ReportNamespace(V, id, func() {
+					monitoring.ReportInt(V, "limit", stats.Limit)
+					monitoring.ReportInt(V, "rate", int64(stats.Rate))
+					monitoring.ReportInt(V, "transfers", int64(stats.Transfers))
+					monitoring.ReportInt(V, "queued", int64(stats.Queued))
+				})
+			}
+		})
+	})
 }
 
 // Increment error metric, log and return code
@@ -133,6 +606,16 @@ func (rt *routeStats) IncError(err error) (int, string, string, zerolog.Level) {
 		code = http.StatusServiceUnavailable
 		rt.drop.Inc()
 		incFail = false
+	case ErrBodyTooLarge:
+		errStr = "RequestEntityTooLarge"
+		msgStr = "request body too large"
+		code = http.StatusRequestEntityTooLarge
+		lvl = zerolog.WarnLevel
+	case ErrUnsupportedEncoding:
+		errStr = "UnsupportedMediaType"
+		msgStr = "unsupported content encoding"
+		code = http.StatusUnsupportedMediaType
+		lvl = zerolog.InfoLevel
 	case ErrInvalidUserAgent:
 		errStr = "InvalidUserAgent"
 		msgStr = "user-agent is invalid"
@@ -143,7 +626,246 @@ func (rt *routeStats) IncError(err error) (int, string, string, zerolog.Level) {
 		msgStr = "version is not supported"
 		code = http.StatusBadRequest
 		lvl = zerolog.InfoLevel
+	case ErrOperatorUnauthorized:
+		errStr = "Forbidden"
+		msgStr = "API key is not authorized for operator APIs"
+		code = http.StatusForbidden
+		lvl = zerolog.InfoLevel
+	case ErrReissueDenied:
+		errStr = "Unauthorized"
+		msgStr = "access API key reissue denied"
+		code = http.StatusUnauthorized
+		lvl = zerolog.WarnLevel
+	case ErrReissueKeyValid:
+		errStr = "KeyValid"
+		msgStr = "access API key is still valid"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrDiagnosticsNotFound:
+		errStr = "NotFound"
+		msgStr = "diagnostics request could not be found"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case ErrDiagnosticsNoAgents:
+		errStr = "NoAgents"
+		msgStr = "query did not match any active agents"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrDeadLetterNotFound:
+		errStr = "NotFound"
+		msgStr = "dead letter could not be found"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case dl.ErrDeadLetterRetried:
+		errStr = "AlreadyRetried"
+		msgStr = "dead letter was already retried"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case dl.ErrDeadLetterStale:
+		errStr = "DeadLetterStale"
+		msgStr = "document changed since it was dead-lettered"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrKeyNotBlocked:
+		errStr = "NotFound"
+		msgStr = "api key is not blocked"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case feature.ErrUnknownFlag:
+		errStr = "NotFound"
+		msgStr = "unknown feature flag"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case ErrNoFeatureState:
+		errStr = "BadRequest"
+		msgStr = "enabled is required"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case es.ErrNoSecondaryToken:
+		errStr = "NoSecondaryToken"
+		msgStr = "no secondary service token configured"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrActionIngestDisabled:
+		errStr = "NotFound"
+		msgStr = "action ingestion is not enabled"
+		code = http.StatusNotFound
+		lvl = zerolog.DebugLevel
+	case ErrServiceTokenRequired:
+		errStr = "Unauthorized"
+		msgStr = "a service token is required"
+		code = http.StatusUnauthorized
+		lvl = zerolog.InfoLevel
+	case es.ErrServiceTokenRejected:
+		errStr = "Unauthorized"
+		msgStr = "service token rejected by elasticsearch"
+		code = http.StatusUnauthorized
+		lvl = zerolog.InfoLevel
+	case ErrWriterUnauthorized:
+		errStr = "Forbidden"
+		msgStr = "service token is not of a trusted writer"
+		code = http.StatusForbidden
+		lvl = zerolog.WarnLevel
+	case ErrPreviewPolicyNotFound:
+		errStr = "NotFound"
+		msgStr = "policy could not be found in the spaces of the profile"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case es.ErrSecondaryTokenRejected:
+		errStr = "SecondaryTokenRejected"
+		msgStr = "secondary service token rejected by elasticsearch"
+		code = http.StatusBadRequest
+		lvl = zerolog.WarnLevel
+	case action.ErrInvalidAckToken:
+		errStr = "InvalidAckToken"
+		msgStr = "ack token is invalid; check in without it to re-sync"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrLongPollBudget:
+		errStr = "LongPollBudget"
+		msgStr = "too many checkins open from the address"
+		code = http.StatusTooManyRequests
+		lvl = zerolog.InfoLevel
+	case ErrGeofenced:
+		errStr = "Geofenced"
+		msgStr = "agent location not allowed by the policy"
+		code = http.StatusForbidden
+		lvl = zerolog.WarnLevel
+	case ErrPolicyNotInSpace:
+		errStr = "Forbidden"
+		msgStr = "policy is not in the spaces of the enrollment key"
+		code = http.StatusForbidden
+		lvl = zerolog.WarnLevel
+	case ErrUploadNotFound:
+		errStr = "UploadNotFound"
+		msgStr = "referenced upload could not be found"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadMismatch:
+		errStr = "UploadMismatch"
+		msgStr = "referenced upload does not belong to the agent and action"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadIncomplete:
+		errStr = "UploadIncomplete"
+		msgStr = "referenced upload is not complete"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrUploadRejected:
+		errStr = "UploadRejected"
+		msgStr = "referenced upload was rejected by the scanner"
+		code = http.StatusUnprocessableEntity
+		lvl = zerolog.WarnLevel
+	case ErrUploadScanUnavailable:
+		errStr = "UploadScanUnavailable"
+		msgStr = "referenced upload could not be scanned"
+		code = http.StatusServiceUnavailable
+		lvl = zerolog.WarnLevel
+	case ErrUploadUnknown:
+		errStr = "UploadNotFound"
+		msgStr = "upload could not be found"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case ErrUploadFileSize:
+		errStr = "UploadFileSize"
+		msgStr = "file size must be positive and at most the max_file_size of the server"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadAction:
+		errStr = "UploadAction"
+		msgStr = "action could not be found for the agent"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadNotUploading:
+		errStr = "UploadNotUploading"
+		msgStr = "upload is completed or failed"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrUploadChunkInvalid:
+		errStr = "UploadChunkInvalid"
+		msgStr = "chunk is out of the file or of the wrong size"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadChunkHash:
+		errStr = "UploadChunkHash"
+		msgStr = "chunk does not match its sha256"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadChunksMissing:
+		errStr = "UploadChunksMissing"
+		msgStr = "chunks of the upload are missing"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrUploadFileHash:
+		errStr = "UploadFileHash"
+		msgStr = "file does not match its sha256"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrRollingRestartDisabled:
+		errStr = "RollingRestartDisabled"
+		msgStr = "rolling restart is not enabled"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrRollingRestartInProgress:
+		errStr = "RollingRestartInProgress"
+		msgStr = "a rolling restart is in progress"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrRollingRestartTooFew:
+		errStr = "TooFewServers"
+		msgStr = "too few servers to restart while keeping min_serving"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrTelemetryDisabled:
+		errStr = "NotFound"
+		msgStr = "agent telemetry is not enabled"
+		code = http.StatusNotFound
+		lvl = zerolog.DebugLevel
+	case ErrTelemetryMediaType:
+		errStr = "UnsupportedMediaType"
+		msgStr = "telemetry must be OTLP protobuf or, to a data stream, OTLP JSON"
+		code = http.StatusUnsupportedMediaType
+		lvl = zerolog.InfoLevel
+	case ErrTelemetryInvalid:
+		errStr = "BadRequest"
+		msgStr = "telemetry payload is not valid OTLP JSON"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrCaptureTTL:
+		errStr = "BadRequest"
+		msgStr = "ttl exceeds the max_ttl of the debug capture"
+		code = http.StatusBadRequest
+		lvl = zerolog.InfoLevel
+	case ErrCaptureTooMany:
+		errStr = "TooManyCaptures"
+		msgStr = "already capturing the max_agents of the debug capture"
+		code = http.StatusConflict
+		lvl = zerolog.InfoLevel
+	case ErrCaptureNotFound:
+		errStr = "NotFound"
+		msgStr = "agent is not captured"
+		code = http.StatusNotFound
+		lvl = zerolog.InfoLevel
+	case ErrTelemetryCollectorFailure:
+		errStr = "BadGateway"
+		msgStr = "telemetry collector could not be reached"
+		code = http.StatusBadGateway
+		lvl = zerolog.WarnLevel
 	default:
+		if es.IsUnavailable(err) {
+			errStr = "ServiceUnavailable"
+			msgStr = "elasticsearch is unavailable"
+			code = http.StatusServiceUnavailable
+			lvl = zerolog.WarnLevel
+			break
+		}
+		if errors.Is(err, ErrPolicySpaceCheck) {
+			errStr = "ServiceUnavailable"
+			msgStr = "space of the policy could not be checked"
+			code = http.StatusServiceUnavailable
+			lvl = zerolog.ErrorLevel
+			break
+		}
 		errStr = "BadRequest"
 		lvl = zerolog.InfoLevel
 		code = http.StatusBadRequest
@@ -164,14 +886,18 @@ func (rt *routeStats) IncStart() func() {
 
 type artifactStats struct {
 	routeStats
-	notFound *monitoring.Uint
-	throttle *monitoring.Uint
+	notFound    *monitoring.Uint
+	throttle    *monitoring.Uint
+	notModified *monitoring.Uint
+	redirects   *monitoring.Uint
 }
 
 func (rt *artifactStats) Register(registry *monitoring.Registry) {
 	rt.routeStats.Register(registry)
 	rt.notFound = monitoring.NewUint(registry, "not_found")
 	rt.throttle = monitoring.NewUint(registry, "throttle")
+	rt.notModified = monitoring.NewUint(registry, "not_modified")
+	rt.redirects = monitoring.NewUint(registry, "redirects")
 }
 
 func (rt *artifactStats) IncError(err error) (code int, str string, msg string, lvl zerolog.Level) {
@@ -185,11 +911,16 @@ func (rt *artifactStats) IncError(err error) (code int, str string, msg string,
 		msg = "not found"
 		rt.notFound.Inc()
 		lvl = zerolog.WarnLevel
-	case ErrorThrottle:
+	case ErrorThrottle, throttle.ErrQueueFull:
 		code = http.StatusTooManyRequests
 		str = "TooManyRequests"
 		msg = "too many requests"
 		rt.throttle.Inc()
+	case signedurl.ErrInvalidSignature, signedurl.ErrExpired:
+		code = http.StatusUnauthorized
+		str = "Unauthorized"
+		msg = err.Error()
+		lvl = zerolog.InfoLevel
 	default:
 		code, str, msg, lvl = rt.routeStats.IncError(err)
 	}
@@ -0,0 +1,171 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/rs/zerolog/log"
+)
+
+// mirroredIndices are the indices mirrored during a migration: by default
+// those of the agents, their enrollment keys and their actions. The indices
+// coordinating the Fleet Servers of a cluster are not.
+func mirroredIndices(cfg *config.Migration) []string {
+	if len(cfg.Indices) > 0 {
+		return cfg.Indices
+	}
+	return []string{
+		dl.FleetAgents,
+		dl.FleetAgentComponents,
+		dl.FleetEnrollmentAPIKeys,
+		dl.FleetActions,
+		dl.FleetActionsResults,
+	}
+}
+
+// invalidateAPIKeys invalidates the API keys, on the cluster the fleet is
+// migrated to as well, where they exist once the security feature state is
+// restored.
+func invalidateAPIKeys(ctx context.Context, bulker bulk.Bulk, ids ...string) error {
+	if err := apikey.Invalidate(ctx, bulker.Client(), ids...); err != nil {
+		return err
+	}
+	if m, ok := bulker.(*bulk.Mirror); ok && len(ids) > 0 {
+		m.Go(ids[0], func(ctx context.Context, secondary bulk.Bulk) error {
+			return apikey.Invalidate(ctx, secondary.Client(), ids...)
+		})
+	}
+	return nil
+}
+
+// mirrorCheckStats are the outcome of the last consistency check; CountDiff
+// sums the differences of the document counts of the mirrored indices.
+type mirrorCheckStats struct {
+	bulk.MirrorCheck
+	CountDiff int64
+	At        time.Time
+}
+
+// mirrorChecker compares the clusters of a migration every interval.
+type mirrorChecker struct {
+	m       *bulk.Mirror
+	indices []string
+	sample  int
+
+	mut  sync.Mutex
+	last mirrorCheckStats
+}
+
+func newMirrorChecker(m *bulk.Mirror, cfg *config.Migration) *mirrorChecker {
+	return &mirrorChecker{
+		m:       m,
+		indices: mirroredIndices(cfg),
+		sample:  cfg.CheckSample,
+	}
+}
+
+// runMirrorChecks checks the clusters every interval until ctx is done.
+func runMirrorChecks(ctx context.Context, c *mirrorChecker, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		stats, err := c.check(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Fail migration consistency check")
+			continue
+		}
+
+		ev := log.Info()
+		if stats.Missing > 0 || stats.Mismatched > 0 {
+			ev = log.Warn()
+		}
+		ev.Int("checked", stats.Checked).
+			Int("skipped", stats.Skipped).
+			Int("missing", stats.Missing).
+			Int("mismatched", stats.Mismatched).
+			Int64("countDiff", stats.CountDiff).
+			Msg("Migration consistency check")
+	}
+}
+
+// check compares the agents last updated between the clusters, repairing
+// those that differ, and the document counts of the mirrored indices.
+func (c *mirrorChecker) check(ctx context.Context) (mirrorCheckStats, error) {
+	stats := mirrorCheckStats{At: time.Now()}
+
+	if c.sample > 0 {
+		body, err := json.Marshal(map[string]interface{}{
+			"size": c.sample,
+			"sort": []interface{}{map[string]string{dl.FieldUpdatedAt: "desc"}},
+		})
+		if err != nil {
+			return stats, err
+		}
+		res, err := c.m.Search(ctx, []string{dl.FleetAgents}, body)
+		if err != nil {
+			return stats, err
+		}
+		if stats.MirrorCheck, err = c.m.Check(ctx, dl.FleetAgents, res.Hits); err != nil {
+			return stats, err
+		}
+	}
+
+	for _, index := range c.indices {
+		primary, err := countDocs(ctx, c.m, index)
+		if err != nil {
+			return stats, err
+		}
+		secondary, err := countDocs(ctx, c.m.Secondary(), index)
+		if err != nil {
+			return stats, err
+		}
+		if diff := int64(primary) - int64(secondary); diff < 0 {
+			stats.CountDiff -= diff
+		} else {
+			stats.CountDiff += diff
+		}
+	}
+
+	c.mut.Lock()
+	c.last = stats
+	c.mut.Unlock()
+	return stats, nil
+}
+
+func (c *mirrorChecker) stats() mirrorCheckStats {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.last
+}
+
+// countDocs counts the documents of the index; a missing index has none.
+func countDocs(ctx context.Context, bulker bulk.Bulk, index string) (uint64, error) {
+	res, err := bulker.Search(ctx, []string{index}, []byte(`{"size":0,"track_total_hits":true}`))
+	if errors.Is(err, es.ErrIndexNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.Total.Value, nil
+}
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/netlabel"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
+
+	"github.com/rs/zerolog/log"
+)
+
+// peerCache hints the agents at the cache of their zone, labelled by the
+// network table, with a URL signed for a time.
+type peerCache struct {
+	table  *netlabel.Table
+	zones  map[string]*url.URL
+	signer signedurl.HMAC
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// newPeerCache returns nil when disabled.
+func newPeerCache(cfg *config.PeerCache, networks *config.Geofence) (*peerCache, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	table, err := newNetworkTable(networks)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &peerCache{
+		table:  table,
+		zones:  make(map[string]*url.URL, len(cfg.Zones)),
+		signer: signedurl.HMAC{Secret: []byte(cfg.Secret)},
+		ttl:    cfg.TTL,
+		now:    time.Now,
+	}
+	for _, z := range cfg.Zones {
+		u, err := url.Parse(z.URL)
+		if err != nil {
+			return nil, err
+		}
+		pc.zones[z.Zone] = u
+	}
+
+	log.Info().
+		Int("networks", table.Len()).
+		Int("zones", len(pc.zones)).
+		Dur("ttl", pc.ttl).
+		Msg("Peer cache install")
+
+	return pc, nil
+}
+
+// hints returns the cache of the zone of the address of the request, if any.
+func (pc *peerCache) hints(r *http.Request) []CacheHint {
+	if pc == nil {
+		return nil
+	}
+	labels, ok := pc.table.Lookup(net.ParseIP(remoteIP(r)))
+	if !ok || labels.Zone == "" {
+		return nil
+	}
+	base, ok := pc.zones[labels.Zone]
+	if !ok {
+		return nil
+	}
+
+	// The signature expires on a second, as the expiry it signs
+	now := pc.now()
+	expires := time.Unix(now.Add(pc.ttl).Unix(), 0)
+	signed, err := pc.signer.Sign(http.MethodGet, base, now, pc.ttl)
+	if err != nil {
+		log.Warn().Err(err).Str("zone", labels.Zone).Msg("Fail to sign the peer cache URL")
+		return nil
+	}
+
+	cntPeerCacheHinted.Inc()
+	return []CacheHint{{
+		Zone:      labels.Zone,
+		Url:       signed.String(),
+		ExpiresAt: expires.UTC().Format(time.RFC3339),
+	}}
+}
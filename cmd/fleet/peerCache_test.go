@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
+)
+
+func TestPeerCacheHints(t *testing.T) {
+	networks := &config.Geofence{
+		Networks: []config.NetworkLabels{
+			{CIDR: "10.0.0.0/8", Country: "DE"},
+			{CIDR: "10.20.0.0/16", Country: "DE", Zone: "berlin"},
+			{CIDR: "10.30.0.0/16", Country: "DE", Zone: "munich"},
+		},
+	}
+
+	pc, err := newPeerCache(&config.PeerCache{}, networks)
+	require.NoError(t, err)
+	assert.Nil(t, pc)
+	assert.Nil(t, pc.hints(httptest.NewRequest(http.MethodPost, "/", nil)))
+
+	pc, err = newPeerCache(&config.PeerCache{
+		Enabled: true,
+		Secret:  "secret",
+		TTL:     time.Hour,
+		Zones:   []config.PeerCacheZone{{Zone: "berlin", URL: "https://cache.berlin/downloads"}},
+	}, networks)
+	require.NoError(t, err)
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	pc.now = func() time.Time { return now }
+
+	hints := func(remote string) []CacheHint {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = remote
+		return pc.hints(r)
+	}
+
+	got := hints("10.20.1.2:1234")
+	require.Len(t, got, 1)
+	assert.Equal(t, "berlin", got[0].Zone)
+	assert.Equal(t, "2021-05-01T13:00:00Z", got[0].ExpiresAt)
+
+	// The cache verifies the signature against its own prefix
+	u, err := url.Parse(got[0].Url)
+	require.NoError(t, err)
+	assert.Equal(t, "cache.berlin", u.Host)
+	assert.Equal(t, "/downloads", u.Path)
+	q := u.Query()
+	verifier := signedurl.HMAC{Secret: []byte("secret")}
+	assert.NoError(t, verifier.Verify("downloads", q.Get(signedurl.ParamExpires), q.Get(signedurl.ParamSignature), now))
+
+	// No cache for the zone, no zone, or not labelled
+	assert.Nil(t, hints("10.30.1.2:1234"))
+	assert.Nil(t, hints("10.40.1.2:1234"))
+	assert.Nil(t, hints("192.168.1.2:1234"))
+}
@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/preflight"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+var ErrPreflightFailed = errors.New("preflight checks failed")
+
+func preflightChecks(cfg *config.Config, esCli *elasticsearch.Client, version string) []preflight.Check {
+	// The service token takes precedence over the username and password
+	basicAuth := cfg.Output.Elasticsearch.ServiceToken == "" && cfg.Output.Elasticsearch.Username != ""
+
+	checks := []preflight.Check{
+		preflight.VersionCheck(esCli, version),
+		preflight.PrivilegesCheck(esCli, basicAuth),
+		preflight.IndicesCheck(esCli),
+		preflight.ClockSkewCheck(esCli, time.Now),
+	}
+
+	warn := cfg.Inputs[0].Server.CertExpiry.Warn
+	if tls := cfg.Inputs[0].Server.TLS; tls != nil && tls.IsEnabled() && tls.Certificate.Certificate != "" {
+		checks = append(checks, preflight.CertificateCheck("server certificate", tls.Certificate.Certificate, warn, time.Now))
+	}
+	if tls := cfg.Output.Elasticsearch.TLS; tls != nil && tls.IsEnabled() && tls.Certificate.Certificate != "" {
+		checks = append(checks, preflight.CertificateCheck("elasticsearch client certificate", tls.Certificate.Certificate, warn, time.Now))
+	}
+	if cfg.Logging.ToFiles && cfg.Logging.Files != nil {
+		checks = append(checks, preflight.DiskSpaceCheck("log directory disk space", cfg.Logging.Files.Path))
+	}
+
+	return checks
+}
+
+// runPreflight runs the preflight checks; any failed check fails the start of
+// the server, warnings are only reported.
+func runPreflight(ctx context.Context, cfg *config.Config, esCli *elasticsearch.Client, version string) ([]preflight.Result, error) {
+	results := preflight.Run(ctx, preflightChecks(cfg, esCli, version))
+	if failed := preflight.Failed(results); len(failed) != 0 {
+		return results, fmt.Errorf("%w: %s", ErrPreflightFailed, strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// runPreflightOnly prints the results of the preflight checks without
+// starting the server.
+func runPreflightOnly(ctx context.Context, cfg *config.Config, version string) error {
+	if err := initIndices(&cfg.Inputs[0].Server.Indices); err != nil {
+		return err
+	}
+
+	esCli, err := es.NewClient(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+
+	results, err := runPreflight(ctx, cfg, esCli, version)
+	if perr := preflight.Print(os.Stdout, results); perr != nil {
+		return perr
+	}
+	return err
+}
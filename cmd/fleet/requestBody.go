@@ -0,0 +1,144 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	kEncodingZstd = "zstd"
+
+	// kMaxBodyExpansion bounds the decompressed body to this many times the
+	// max body size; the JSON bodies of the agents compress well, but not
+	// that well.
+	kMaxBodyExpansion = 32
+
+	// kZstdMaxMemory bounds the window of the zstd decoder, the default window
+	// of the encoders.
+	kZstdMaxMemory = 8 << 20
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrBodyTooLarge        = errors.New("request body too large")
+)
+
+// requestBody reads the body of a request, decompressed as told by its
+// Content-Encoding. The bytes received are limited to the max body size, and
+// the decompressed ones to kMaxBodyExpansion times that, so a small compressed
+// body cannot expand unbounded.
+type requestBody struct {
+	wire  *countingReader
+	plain *countingReader
+	close func()
+}
+
+// newRequestBody returns the body of the request; maxBody 0 does not limit it.
+func newRequestBody(r *http.Request, maxBody int64) (*requestBody, error) {
+	b := &requestBody{
+		wire:  &countingReader{r: r.Body, max: maxBody},
+		close: func() {},
+	}
+
+	var plain io.Reader
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		plain = b.wire
+	case kEncodingGzip:
+		zr, err := gzip.NewReader(b.wire)
+		if err != nil {
+			return nil, b.err(err)
+		}
+		b.close = func() { zr.Close() }
+		plain = zr
+	case kEncodingZstd:
+		zr, err := zstd.NewReader(b.wire,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxMemory(kZstdMaxMemory),
+		)
+		if err != nil {
+			return nil, b.err(err)
+		}
+		b.close = zr.Close
+		plain = zr
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+
+	b.plain = &countingReader{r: plain, max: maxBody}
+	if plain != b.wire {
+		b.plain.max = maxBody * kMaxBodyExpansion
+	}
+	return b, nil
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.plain.Read(p)
+	if err != nil {
+		err = b.err(err)
+	}
+	return n, err
+}
+
+// err reports the decompression failures caused by a body exceeding the limit
+// as such; the decompressors may wrap the error.
+func (b *requestBody) err(err error) error {
+	if b.wire.exceeded() {
+		return ErrBodyTooLarge
+	}
+	return err
+}
+
+// Close releases the decompressor.
+func (b *requestBody) Close() {
+	b.close()
+}
+
+// count adds the bytes received and decompressed to the route metrics.
+func (b *requestBody) count(rt *routeStats) {
+	rt.bodyIn.Add(uint64(b.wire.n))
+	if b.plain != nil {
+		rt.bodyInUncompressed.Add(uint64(b.plain.n))
+	}
+}
+
+// countingReader counts the bytes read and fails with ErrBodyTooLarge past max
+// bytes, 0 not limiting.
+type countingReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.max > 0 {
+		if c.exceeded() {
+			return 0, ErrBodyTooLarge
+		}
+		// Read one byte past the limit to tell a body of exactly max bytes
+		// from a larger one.
+		if left := c.max - c.n + 1; int64(len(p)) > left {
+			p = p[:left]
+		}
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.exceeded() {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (c *countingReader) exceeded() bool {
+	return c.max > 0 && c.n > c.max
+}
@@ -0,0 +1,94 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data []byte) []byte {
+	zw, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+func TestRequestBody(t *testing.T) {
+	payload := []byte(`{"status":"online","local_metadata":{"host":{"name":"` + strings.Repeat("a", 1000) + `"}}}`)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxBody  int64
+		err      error
+	}{
+		{"plain", "", payload, 0, nil},
+		{"identity", "identity", payload, int64(len(payload)), nil},
+		{"gzip", "gzip", gzipped(t, payload), int64(len(gzipped(t, payload))), nil},
+		{"zstd", "zstd", zstded(t, payload), int64(len(zstded(t, payload))), nil},
+		{"plain too large", "", payload, int64(len(payload)) - 1, ErrBodyTooLarge},
+		{"gzip too large", "gzip", gzipped(t, payload), int64(len(gzipped(t, payload))) - 1, ErrBodyTooLarge},
+		{"zstd too large", "zstd", zstded(t, payload), int64(len(zstded(t, payload))) - 1, ErrBodyTooLarge},
+		{"unsupported", "br", payload, 0, ErrUnsupportedEncoding},
+	}
+	for _, tr := range tests {
+		t.Run(tr.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(tr.body))
+			if tr.encoding != "" {
+				req.Header.Set("Content-Encoding", tr.encoding)
+			}
+
+			body, err := newRequestBody(req, tr.maxBody)
+			if err == nil {
+				defer body.Close()
+				var data []byte
+				data, err = ioutil.ReadAll(body)
+				if err == nil {
+					assert.Equal(t, payload, data)
+					assert.Equal(t, int64(len(tr.body)), body.wire.n)
+					assert.Equal(t, int64(len(payload)), body.plain.n)
+				}
+			}
+			assert.Equal(t, tr.err, err)
+		})
+	}
+}
+
+func TestRequestBodyGzipBomb(t *testing.T) {
+	// Compresses to about a thousandth of its size
+	bomb := gzipped(t, bytes.Repeat([]byte{0}, 10*1024*1024))
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	body, err := newRequestBody(req, 64*1024)
+	require.NoError(t, err)
+	defer body.Close()
+
+	_, err = ioutil.ReadAll(body)
+	assert.Equal(t, ErrBodyTooLarge, err)
+	assert.False(t, body.wire.exceeded(), "compressed body within the max body size")
+	assert.LessOrEqual(t, body.plain.n, int64(64*1024*kMaxBodyExpansion+1))
+}
@@ -0,0 +1,341 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sleep"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// States of a server in a rolling restart.
+const (
+	kRestartPending    = "pending"
+	kRestartDraining   = "draining"
+	kRestartRestarting = "restarting"
+	kRestartDone       = "done"
+)
+
+// kDrainRetryAfter is the Retry-After, in seconds, of the requests refused
+// while draining.
+const kDrainRetryAfter = "5"
+
+var (
+	// ErrRollingRestart ends the server for its turn of a rolling restart.
+	ErrRollingRestart = errors.New("restart for the rolling restart")
+
+	ErrDraining                 = errors.New("server draining for a restart")
+	ErrRollingRestartDisabled   = errors.New("rolling restart disabled")
+	ErrRollingRestartInProgress = errors.New("rolling restart in progress")
+	ErrRollingRestartTooFew     = errors.New("too few servers to keep min_serving")
+)
+
+// RollingRestartT takes the turn of this server in the rolling restarts and
+// serves the admin API starting them.
+//
+// A rolling restart marks every server that is not stale as pending in its
+// document of .fleet-servers. A pending server takes its turn once no other
+// server of the restart is draining or restarting, no pending one has a lower
+// id, and min_serving others are serving. It then drains: new checkins and
+// enrollments are refused and the long polls are ended, so the agents move to
+// the other servers. After the drain timeout it records it is restarting and
+// ends with ErrRollingRestart, on which the process exits for its supervisor
+// to start it again; under the Elastic Agent the server is run again in
+// place. Once running again the server records it is done, and the next one
+// takes its turn.
+type RollingRestartT struct {
+	cfg      *config.RollingRestart
+	serverId string
+	limit    *limit.Limiter
+	bulk     bulk.Bulk
+	cache    cache.Cache
+	polls    *longPolls
+	now      func() time.Time
+
+	draining int32
+}
+
+func NewRollingRestartT(cfg *config.Server, serverId string, bulker bulk.Bulk, cache cache.Cache, polls *longPolls) *RollingRestartT {
+	log.Info().
+		Interface("limits", cfg.Limits.AdminLimit).
+		Msg("Servers restart install limits")
+
+	return &RollingRestartT{
+		cfg:      &cfg.RollingRestart,
+		serverId: serverId,
+		bulk:     bulker,
+		cache:    cache,
+		polls:    polls,
+		now:      time.Now,
+		limit:    limit.NewLimiter(&cfg.Limits.AdminLimit),
+	}
+}
+
+// isDraining tells whether the server drains before its restart.
+func (rrt *RollingRestartT) isDraining() bool {
+	return rrt != nil && atomic.LoadInt32(&rrt.draining) == 1
+}
+
+// checkDraining refuses the requests of the agents to the enroll and checkin
+// endpoints while draining, so they move to another server.
+func (rrt *RollingRestartT) checkDraining(endpoint string) error {
+	if !rrt.isDraining() {
+		return nil
+	}
+	switch ipGroup(endpoint) {
+	case kIPGroupEnroll, kIPGroupCheckin:
+		cntDrainRefused.Inc()
+		return ErrDraining
+	}
+	return nil
+}
+
+// Run takes the turns of this server until ctx is done or it has to restart.
+func (rrt *RollingRestartT) Run(ctx context.Context) error {
+	if rrt.serverId == "" {
+		log.Warn().Msg("Rolling restart needs fleet.agent.id; this server does not take part")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	t := time.NewTicker(rrt.cfg.CheckInterval)
+	defer t.Stop()
+
+	for {
+		if err := rrt.check(ctx); err != nil {
+			if errors.Is(err, ErrRollingRestart) || errors.Is(err, context.Canceled) {
+				return err
+			}
+			log.Warn().Err(err).Msg("Fail rolling restart check")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (rrt *RollingRestartT) check(ctx context.Context) error {
+	servers, err := dl.QueryServers(ctx, rrt.bulk)
+	if errors.Is(err, es.ErrIndexNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var self *model.Server
+	for i := range servers {
+		if servers[i].Server != nil && servers[i].Server.Id == rrt.serverId {
+			self = &servers[i]
+			break
+		}
+	}
+	if self == nil || self.Restart == nil {
+		return nil
+	}
+
+	restart := *self.Restart
+	switch restart.State {
+	case kRestartDraining, kRestartRestarting:
+		// Stopped draining or restarting, so running again
+		log.Info().Str("restartId", restart.RequestedId).Msg("Rolling restart of this server done")
+		return rrt.setState(ctx, restart, kRestartDone)
+	case kRestartPending:
+	default:
+		return nil
+	}
+
+	ok, reason := restartTurn(servers, rrt.serverId, restart.RequestedId, rrt.cfg.MinServing, rrt.now())
+	if !ok {
+		log.Debug().Str("restartId", restart.RequestedId).Str("reason", reason).Msg("Wait for the rolling restart turn")
+		return nil
+	}
+	return rrt.drain(ctx, restart)
+}
+
+// drain refuses the agents and ends their long polls for the drain timeout,
+// then returns ErrRollingRestart.
+func (rrt *RollingRestartT) drain(ctx context.Context, restart model.ServerRestart) error {
+	if err := rrt.setState(ctx, restart, kRestartDraining); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&rrt.draining, 1)
+	n := rrt.polls.disconnect(longPollFilter{})
+	log.Warn().
+		Str("restartId", restart.RequestedId).
+		Int("longPolls", n).
+		Dur("drainTimeout", rrt.cfg.DrainTimeout).
+		Msg("Rolling restart turn; draining")
+
+	// The agents of the long polls ended meanwhile check in again
+	if err := sleep.WithContext(ctx, rrt.cfg.DrainTimeout); err != nil {
+		return err
+	}
+	rrt.polls.disconnect(longPollFilter{})
+
+	if err := rrt.setState(ctx, restart, kRestartRestarting); err != nil {
+		return err
+	}
+	log.Warn().Str("restartId", restart.RequestedId).Msg("Rolling restart turn; restarting")
+	return ErrRollingRestart
+}
+
+func (rrt *RollingRestartT) setState(ctx context.Context, restart model.ServerRestart, state string) error {
+	restart.State = state
+	restart.UpdatedAt = rrt.now().UTC().Format(time.RFC3339)
+	return dl.UpdateServerRestart(ctx, rrt.bulk, rrt.serverId, restart)
+}
+
+func isStale(server *model.Server, now time.Time) bool {
+	t, err := server.Time()
+	return err != nil || now.Sub(t) > kServerStaleAfter
+}
+
+func isRestarting(server *model.Server) bool {
+	return server.Restart != nil &&
+		(server.Restart.State == kRestartDraining || server.Restart.State == kRestartRestarting)
+}
+
+// restartTurn tells whether the server may take its turn in the restart, or
+// why it may not. The stale servers are ignored: they are not serving and
+// hold no turn.
+func restartTurn(servers []model.Server, self, restartId string, minServing int, now time.Time) (bool, string) {
+	serving := 0
+	for i := range servers {
+		server := &servers[i]
+		if server.Server == nil || server.Server.Id == self || isStale(server, now) {
+			continue
+		}
+		if isRestarting(server) {
+			return false, "server " + server.Server.Id + " is restarting"
+		}
+		r := server.Restart
+		if r != nil && r.RequestedId == restartId && r.State == kRestartPending && server.Server.Id < self {
+			return false, "server " + server.Server.Id + " restarts first"
+		}
+		serving++
+	}
+	if serving < minServing {
+		return false, strconv.Itoa(serving) + " other servers serving, below min_serving"
+	}
+	return true, ""
+}
+
+func (rt Router) handleServersRestart(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := rt.rrt.handleServersRestart(w, r)
+
+	if err != nil {
+		code, str, errMsg, lvl := cntServersRestart.IncError(err)
+
+		log.WithLevel(lvl).
+			Err(err).
+			Int("code", code).
+			Msg("Fail servers restart")
+
+		if err := WriteError(w, code, str, errMsg); err != nil {
+			log.Error().Err(err).Msg("fail writing error response")
+		}
+	}
+}
+
+func (rrt *RollingRestartT) handleServersRestart(w http.ResponseWriter, r *http.Request) error {
+	limitF, err := rrt.limit.Acquire()
+	if err != nil {
+		return err
+	}
+	defer limitF()
+
+	key, err := authOperator(r, rrt.bulk, rrt.cache)
+	if err != nil {
+		return err
+	}
+
+	dfunc := cntServersRestart.IncStart()
+	defer dfunc()
+
+	if !rrt.cfg.Enabled {
+		return ErrRollingRestartDisabled
+	}
+
+	servers, err := dl.QueryServers(r.Context(), rrt.bulk)
+	if err != nil && !errors.Is(err, es.ErrIndexNotFound) {
+		return err
+	}
+
+	now := rrt.now()
+	var ids []string
+	for i := range servers {
+		server := &servers[i]
+		if server.Server == nil || isStale(server, now) {
+			continue
+		}
+		if server.Restart != nil && server.Restart.State != kRestartDone {
+			return ErrRollingRestartInProgress
+		}
+		ids = append(ids, server.Server.Id)
+	}
+	if len(ids) <= rrt.cfg.MinServing {
+		return ErrRollingRestartTooFew
+	}
+	sort.Strings(ids)
+
+	resp := ServersRestartResponse{
+		Id:      uuid.Must(uuid.NewV4()).String(),
+		Servers: ids,
+	}
+	restart := model.ServerRestart{
+		RequestedId: resp.Id,
+		RequestedAt: now.UTC().Format(time.RFC3339),
+		State:       kRestartPending,
+		UpdatedAt:   now.UTC().Format(time.RFC3339),
+	}
+	for _, id := range ids {
+		if err := dl.UpdateServerRestart(r.Context(), rrt.bulk, id, restart); err != nil {
+			return err
+		}
+	}
+
+	auditLog("servers-restart", "success").
+		Str("restartId", resp.Id).
+		Str("apiKeyId", key.Id).
+		Strs("servers", ids).
+		Msg("Rolling restart requested")
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+
+	var nWritten int
+	if nWritten, err = w.Write(data); err != nil {
+		return err
+	}
+
+	cntServersRestart.bodyOut.Add(uint64(nWritten))
+
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testServer(id string, seen time.Time, restart *model.ServerRestart) model.Server {
+	s := model.Server{
+		Server:  &model.ServerMetadata{Id: id},
+		Restart: restart,
+	}
+	s.SetTime(seen)
+	return s
+}
+
+func TestRestartTurn(t *testing.T) {
+	now := time.Now()
+	pending := &model.ServerRestart{RequestedId: "r1", State: kRestartPending}
+	draining := &model.ServerRestart{RequestedId: "r1", State: kRestartDraining}
+	done := &model.ServerRestart{RequestedId: "r1", State: kRestartDone}
+
+	tests := []struct {
+		name       string
+		servers    []model.Server
+		minServing int
+		want       bool
+	}{
+		{
+			name: "lowest pending",
+			servers: []model.Server{
+				testServer("s1", now, pending),
+				testServer("s2", now, pending),
+			},
+			minServing: 1,
+			want:       true,
+		},
+		{
+			name: "lower pending first",
+			servers: []model.Server{
+				testServer("s0", now, pending),
+				testServer("s2", now, pending),
+			},
+			minServing: 1,
+		},
+		{
+			name: "other restarting",
+			servers: []model.Server{
+				testServer("s2", now, draining),
+			},
+		},
+		{
+			name: "below min serving",
+			servers: []model.Server{
+				testServer("s2", now, done),
+				testServer("s3", now, nil),
+			},
+			minServing: 3,
+		},
+		{
+			name: "stale ignored",
+			servers: []model.Server{
+				testServer("s0", now.Add(-time.Hour), draining),
+				testServer("s2", now, done),
+			},
+			minServing: 1,
+			want:       true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			servers := append(tc.servers, testServer("s1", now, pending))
+			ok, reason := restartTurn(servers, "s1", "r1", tc.minServing, now)
+			assert.Equal(t, tc.want, ok, reason)
+		})
+	}
+}
+
+// serversBulk holds the server documents, updated by restart.
+type serversBulk struct {
+	ftesting.MockBulk
+	mut     sync.Mutex
+	servers map[string]model.Server
+}
+
+func (m *serversBulk) Search(ctx context.Context, index []string, body []byte, opts ...bulk.Opt) (*es.ResultT, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	ids := make([]string, 0, len(m.servers))
+	for id := range m.servers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	res := &es.ResultT{}
+	for _, id := range ids {
+		src, err := json.Marshal(m.servers[id])
+		if err != nil {
+			return nil, err
+		}
+		res.Hits = append(res.Hits, es.HitT{Id: id, Source: src})
+	}
+	return res, nil
+}
+
+func (m *serversBulk) Update(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) error {
+	var update struct {
+		Doc struct {
+			Restart *model.ServerRestart `json:"restart"`
+		} `json:"doc"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return err
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	s := m.servers[id]
+	s.Restart = update.Doc.Restart
+	m.servers[id] = s
+	return nil
+}
+
+// restartState returns the state of the server in its restart.
+func (m *serversBulk) restartState(id string) string {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if r := m.servers[id].Restart; r != nil {
+		return r.State
+	}
+	return ""
+}
+
+func TestRollingRestart(t *testing.T) {
+	now := time.Now()
+	pending := &model.ServerRestart{RequestedId: "r1", State: kRestartPending}
+	bulker := &serversBulk{servers: map[string]model.Server{
+		"s1": testServer("s1", now, pending),
+		"s2": testServer("s2", now, pending),
+		"s3": testServer("s3", now, nil),
+	}}
+
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.RollingRestart.DrainTimeout = 0
+
+	newRRT := func(id string) *RollingRestartT {
+		rrt := NewRollingRestartT(cfg, id, bulker, cache.Cache{}, newLongPolls())
+		rrt.now = func() time.Time { return now }
+		return rrt
+	}
+	ctx := context.Background()
+
+	// s1 restarts first, draining the agents
+	s1, s2 := newRRT("s1"), newRRT("s2")
+	assert.NoError(t, s1.checkDraining("checkin"))
+	require.True(t, errors.Is(s1.check(ctx), ErrRollingRestart))
+	assert.Equal(t, kRestartRestarting, bulker.servers["s1"].Restart.State)
+	assert.True(t, s1.isDraining())
+	assert.True(t, errors.Is(s1.checkDraining("checkin"), ErrDraining))
+	assert.True(t, errors.Is(s1.checkDraining("enroll"), ErrDraining))
+	assert.NoError(t, s1.checkDraining("status"))
+
+	// s2 waits for s1 to run again
+	require.NoError(t, s2.check(ctx))
+	assert.Equal(t, kRestartPending, bulker.servers["s2"].Restart.State)
+
+	s1 = newRRT("s1")
+	require.NoError(t, s1.check(ctx))
+	assert.Equal(t, kRestartDone, bulker.servers["s1"].Restart.State)
+	assert.False(t, s1.isDraining())
+
+	require.True(t, errors.Is(s2.check(ctx), ErrRollingRestart))
+	assert.Equal(t, kRestartRestarting, bulker.servers["s2"].Restart.State)
+	assert.Nil(t, bulker.servers["s3"].Restart)
+}
@@ -6,21 +6,12 @@ package fleet
 
 import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/certmon"
 	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/transport"
 	"github.com/julienschmidt/httprouter"
 )
 
-const (
-	ROUTE_STATUS    = "/api/status"
-	ROUTE_ENROLL    = "/api/fleet/agents/:id"
-	ROUTE_CHECKIN   = "/api/fleet/agents/:id/checkin"
-	ROUTE_ACKS      = "/api/fleet/agents/:id/acks"
-	ROUTE_ARTIFACTS = "/api/fleet/artifacts/:id/:sha2"
-
-	// Support previous relative path exposed in Kibana until all feature flags are flipped
-	ROUTE_ARTIFACTS_DEPRECATED = "/api/endpoint/artifacts/download/:id/:sha2"
-)
-
 type Router struct {
 	bulker bulk.Bulk
 	ver    string
@@ -28,10 +19,37 @@ type Router struct {
 	et     *EnrollerT
 	at     *ArtifactT
 	ack    *AckT
+	dt     *DiagnosticsT
+	dlt    *DeadLetterT
+	bkt    *BlockedKeysT
+	ft     *FeaturesT
+	qt     *QuarantineT
 	sm     policy.SelfMonitor
+	cm     *certmon.Monitor
+	res    *transport.Resolver
+	stt    *ServiceTokenT
+	sst    *ServersStatusT
+	lpt    *LongPollsT
+	eht    *EnrollmentHistoryT
+	aft    *ActionsFanOutT
+	vt     *VersionT
+	tt     *TelemetryT
+	xt     *ExportT
+	wd     *watchdog
+	lt     *LimitsT
+	cip    *clientIPs
+	ipf    *ipFilter
+	rrt    *RollingRestartT
+	hdt    *HealthzDeepT
+	dct    *DebugCaptureT
+	srl    *slowRequests
+	ut     *UploadT
+	bat    *BulkActionsT
+	ppt    *PolicyPreviewT
+	djt    *DispatchJournalT
 }
 
-func NewRouter(bulker bulk.Bulk, ct *CheckinT, et *EnrollerT, at *ArtifactT, ack *AckT, sm policy.SelfMonitor) *httprouter.Router {
+func NewRouter(bulker bulk.Bulk, ct *CheckinT, et *EnrollerT, at *ArtifactT, ack *AckT, dt *DiagnosticsT, dlt *DeadLetterT, bkt *BlockedKeysT, ft *FeaturesT, qt *QuarantineT, sm policy.SelfMonitor, cm *certmon.Monitor, res *transport.Resolver, stt *ServiceTokenT, sst *ServersStatusT, lpt *LongPollsT, eht *EnrollmentHistoryT, aft *ActionsFanOutT, vt *VersionT, tt *TelemetryT, xt *ExportT, wd *watchdog, lt *LimitsT, cip *clientIPs, ipf *ipFilter, rrt *RollingRestartT, hdt *HealthzDeepT, dct *DebugCaptureT, srl *slowRequests, ut *UploadT, bat *BulkActionsT, ppt *PolicyPreviewT, djt *DispatchJournalT) *httprouter.Router {
 
 	r := Router{
 		bulker: bulker,
@@ -40,17 +58,37 @@ func NewRouter(bulker bulk.Bulk, ct *CheckinT, et *EnrollerT, at *ArtifactT, ack
 		sm:     sm,
 		at:     at,
 		ack:    ack,
+		dt:     dt,
+		dlt:    dlt,
+		bkt:    bkt,
+		ft:     ft,
+		qt:     qt,
+		cm:     cm,
+		res:    res,
+		stt:    stt,
+		sst:    sst,
+		lpt:    lpt,
+		eht:    eht,
+		aft:    aft,
+		vt:     vt,
+		tt:     tt,
+		xt:     xt,
+		wd:     wd,
+		lt:     lt,
+		cip:    cip,
+		ipf:    ipf,
+		rrt:    rrt,
+		hdt:    hdt,
+		dct:    dct,
+		srl:    srl,
+		ut:     ut,
+		bat:    bat,
+		ppt:    ppt,
+		djt:    djt,
 	}
 
 	router := httprouter.New()
-	router.GET(ROUTE_STATUS, r.handleStatus)
-	router.POST(ROUTE_ENROLL, r.handleEnroll)
-	router.POST(ROUTE_CHECKIN, r.handleCheckin)
-	router.POST(ROUTE_ACKS, r.handleAcks)
-	router.GET(ROUTE_ARTIFACTS, r.handleArtifacts)
-
-	// deprecated: TODO: remove
-	router.GET(ROUTE_ARTIFACTS_DEPRECATED, r.handleArtifacts)
+	r.registerRoutes(router)
 
 	return router
 }
@@ -0,0 +1,45 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// kDefaultMaxThreads is the maximum number of OS threads of the Go runtime
+// when not set.
+const kDefaultMaxThreads = 10000
+
+// runtimeSettings holds the RuntimeSettings in effect, read back once they are
+// applied; the status reports them.
+var runtimeSettings atomic.Value
+
+// recordRuntimeSettings reads back the Go runtime settings in effect. The
+// runtime only reports the GC percent and the maximum number of threads when
+// they are set, so they are set back to the value returned.
+func recordRuntimeSettings() RuntimeSettings {
+	gcPercent := debug.SetGCPercent(100)
+	debug.SetGCPercent(gcPercent)
+
+	maxThreads := debug.SetMaxThreads(kDefaultMaxThreads)
+	debug.SetMaxThreads(maxThreads)
+
+	s := RuntimeSettings{
+		GCPercent:   int64(gcPercent),
+		MemoryLimit: memoryLimit(),
+		MaxThreads:  int64(maxThreads),
+		MaxProcs:    int64(runtime.GOMAXPROCS(0)),
+	}
+	runtimeSettings.Store(s)
+	return s
+}
+
+// currentRuntimeSettings returns the settings last recorded.
+func currentRuntimeSettings() RuntimeSettings {
+	s, _ := runtimeSettings.Load().(RuntimeSettings)
+	return s
+}
@@ -0,0 +1,41 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestInitRuntime(t *testing.T) {
+	oldGC := debug.SetGCPercent(100)
+	oldThreads := debug.SetMaxThreads(kDefaultMaxThreads)
+	defer func() {
+		debug.SetGCPercent(oldGC)
+		debug.SetMaxThreads(oldThreads)
+	}()
+
+	cfg := &config.Config{Inputs: []config.Input{{}}}
+	cfg.Inputs[0].Server.Runtime.GCPercent = 150
+	cfg.Inputs[0].Server.Runtime.MaxThreads = 5000
+
+	initRuntime(cfg)
+
+	s := currentRuntimeSettings()
+	assert.Equal(t, int64(150), s.GCPercent)
+	assert.Equal(t, int64(5000), s.MaxThreads)
+	assert.Equal(t, int64(runtime.GOMAXPROCS(0)), s.MaxProcs)
+
+	// Reading the settings back leaves them unchanged.
+	assert.Equal(t, 150, debug.SetGCPercent(150))
+	assert.Equal(t, 5000, debug.SetMaxThreads(5000))
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
-	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/netutil"
 )
@@ -38,7 +37,7 @@ func diagConn(c net.Conn, s http.ConnState) {
 	}
 }
 
-func runServer(ctx context.Context, router *httprouter.Router, cfg *config.Server) error {
+func runServer(ctx context.Context, router http.Handler, cfg *config.Server) error {
 
 	addr := cfg.BindAddress()
 	rdto := cfg.Timeouts.Read
@@ -33,18 +33,19 @@ func TestRunServer(t *testing.T) {
 	cfg.Host = "localhost"
 	cfg.Port = port
 
-	verCon := mustBuildConstraints("8.0.0")
+	ua, err := newUserAgentPolicy(mustBuildConstraints("8.0.0"), &cfg.UserAgent)
+	require.NoError(t, err)
 	c, err := cache.New(cache.Config{NumCounters: 100, MaxCost: 100000})
 	require.NoError(t, err)
 	bulker := ftesting.MockBulk{}
 	pim := mock.NewMockIndexMonitor()
 	pm := policy.NewMonitor(bulker, pim, 5*time.Millisecond)
-	bc := NewBulkCheckin(nil)
-	ct := NewCheckinT(verCon, cfg, c, bc, pm, nil, nil, nil, nil)
-	et, err := NewEnrollerT(verCon, cfg, nil, c)
+	bc := NewBulkCheckin(nil, &cfg.Offline)
+	ct := NewCheckinT(ua, cfg, c, bc, pm, nil, nil, nil, nil, nil, nil, nil, nil)
+	et, err := NewEnrollerT(ua, cfg, nil, c, nil, nil)
 	require.NoError(t, err)
 
-	router := NewRouter(bulker, ct, et, nil, nil, nil)
+	router := NewRouter(bulker, ct, et, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	errCh := make(chan error)
 
 	var wg sync.WaitGroup
@@ -0,0 +1,242 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// kShadowHeader marks the requests mirrored to the staging server.
+	kShadowHeader = "X-Fleet-Shadow"
+
+	kShadowMaxResponse = 64 * 1024
+)
+
+var ErrShadowBodyTooLarge = errors.New("request body exceeds the max_body_size of the shadowing")
+
+// shadowRequest is a checkin request sanitized for the staging server.
+type shadowRequest struct {
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+// shadow mirrors a sample of the checkin requests to a staging Fleet Server;
+// the workers send them in the background and ignore the responses.
+type shadow struct {
+	cfg    *config.Shadow
+	url    *url.URL
+	client *http.Client
+	sample func() bool
+	queue  chan shadowRequest
+
+	mirrored uint64 // atomic
+	dropped  uint64 // atomic
+	failed   uint64 // atomic
+}
+
+type shadowStats struct {
+	Mirrored uint64 // requests sent to the staging server
+	Dropped  uint64 // requests sampled but not sent: queue full or body not mirrored
+	Failed   uint64 // requests the staging server could not be sent
+	Queued   int    // requests waiting to be sent
+}
+
+// newShadow returns nil when the shadowing is disabled.
+func newShadow(cfg *config.Shadow) (*shadow, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("url", cfg.URL).
+		Float64("sampleRate", cfg.SampleRate).
+		Int("workers", cfg.Workers).
+		Msg("Request shadowing install")
+
+	return &shadow{
+		cfg:    cfg,
+		url:    u,
+		client: &http.Client{Timeout: cfg.Timeout},
+		sample: func() bool { return rand.Float64() < cfg.SampleRate },
+		queue:  make(chan shadowRequest, cfg.QueueSize),
+	}, nil
+}
+
+// withShadow mirrors a sample of the checkin requests once handled.
+func withShadow(next http.Handler, s *shadow) http.Handler {
+	if s == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isCheckinRequest(r) || !s.sample() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := &captureBuffer{max: s.cfg.MaxBodySize}
+		r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, body), Closer: r.Body}
+
+		next.ServeHTTP(w, r)
+
+		s.enqueue(r, body)
+	})
+}
+
+func isCheckinRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost &&
+		strings.HasPrefix(r.URL.Path, "/api/fleet/agents/") &&
+		strings.HasSuffix(r.URL.Path, "/checkin")
+}
+
+// enqueue queues the request for the workers, dropping it when they are
+// behind.
+func (s *shadow) enqueue(r *http.Request, body *captureBuffer) {
+	req, err := sanitizeShadowRequest(r, body)
+	if err != nil {
+		atomic.AddUint64(&s.dropped, 1)
+		log.Debug().Err(err).Str("path", r.URL.Path).Msg("Checkin request not mirrored")
+		return
+	}
+
+	select {
+	case s.queue <- req:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// sanitizeShadowRequest returns the request as mirrored: without its
+// credentials, its body decompressed and its secrets redacted.
+func sanitizeShadowRequest(r *http.Request, body *captureBuffer) (shadowRequest, error) {
+	if body.truncated {
+		return shadowRequest{}, ErrShadowBodyTooLarge
+	}
+
+	data, err := decodeCaptured(body.Bytes(), r.Header.Get("Content-Encoding"))
+	if err != nil {
+		return shadowRequest{}, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return shadowRequest{}, err
+	}
+	if data, err = json.Marshal(redact.Default.Value(v)); err != nil {
+		return shadowRequest{}, err
+	}
+
+	header := make(http.Header, len(r.Header))
+	for k, vs := range r.Header {
+		switch {
+		case redactedHeaders[k]:
+		case k == "Content-Encoding", k == "Content-Length":
+		default:
+			header[k] = vs
+		}
+	}
+	header.Set("Content-Type", "application/json")
+
+	return shadowRequest{
+		path:   r.URL.Path,
+		query:  r.URL.RawQuery,
+		header: header,
+		body:   data,
+	}, nil
+}
+
+// Run sends the requests queued until ctx is done.
+func (s *shadow) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-s.queue:
+					s.send(ctx, req)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// send posts the request to the staging server. The request counts as
+// mirrored once written: the staging server may hold it as a long poll past
+// the timeout.
+func (s *shadow) send(ctx context.Context, req shadowRequest) {
+	u := *s.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + req.path
+	u.RawQuery = req.query
+
+	var written int32 // atomic; written by the transport
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				atomic.StoreInt32(&written, 1)
+			}
+		},
+	}
+
+	hreq, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodPost, u.String(), bytes.NewReader(req.body))
+	if err != nil {
+		atomic.AddUint64(&s.failed, 1)
+		return
+	}
+	hreq.Header = req.header
+	for k, v := range s.cfg.Headers {
+		hreq.Header.Set(k, v)
+	}
+	hreq.Header.Set(kShadowHeader, "true")
+
+	hres, err := s.client.Do(hreq)
+	if err == nil {
+		io.Copy(ioutil.Discard, io.LimitReader(hres.Body, kShadowMaxResponse))
+		hres.Body.Close()
+	}
+	if atomic.LoadInt32(&written) == 0 {
+		atomic.AddUint64(&s.failed, 1)
+		log.Debug().Err(err).Str("path", req.path).Msg("Fail mirroring checkin request")
+		return
+	}
+	atomic.AddUint64(&s.mirrored, 1)
+}
+
+func (s *shadow) stats() shadowStats {
+	return shadowStats{
+		Mirrored: atomic.LoadUint64(&s.mirrored),
+		Dropped:  atomic.LoadUint64(&s.dropped),
+		Failed:   atomic.LoadUint64(&s.failed),
+		Queued:   len(s.queue),
+	}
+}
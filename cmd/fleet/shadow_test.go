@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestShadow(t *testing.T, url string) *shadow {
+	t.Helper()
+	cfg := &config.Shadow{}
+	cfg.InitDefaults()
+	cfg.Enabled = true
+	cfg.URL = url
+	cfg.QueueSize = 1
+	cfg.Headers = map[string]string{"Authorization": "ApiKey staging"}
+	require.NoError(t, cfg.Validate())
+
+	s, err := newShadow(cfg)
+	require.NoError(t, err)
+	s.sample = func() bool { return true }
+	return s
+}
+
+func TestShadow(t *testing.T) {
+	type mirrored struct {
+		path   string
+		header http.Header
+		body   string
+	}
+	mirroredCh := make(chan mirrored, 1)
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mirroredCh <- mirrored{r.URL.String(), r.Header, string(body)}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer staging.Close()
+
+	s := newTestShadow(t, staging.URL+"/staging/")
+	var handled []string
+	h := withShadow(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		handled = append(handled, string(body))
+	}), s)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"status":"online","events":[{"message":"m","access_api_key":"secret"}]}`))
+	zw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-1/checkin?wait=1", &gz)
+	req.Header.Set("Authorization", "ApiKey agent")
+	req.Header.Set("Content-Encoding", kEncodingGzip)
+	req.Header.Set("User-Agent", "elastic agent 8.0.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Not mirrored
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-1/acks", strings.NewReader(`{}`)))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/fleet/agents/agent-1/checkin", nil))
+	require.Len(t, handled, 3)
+	assert.Len(t, s.queue, 1)
+
+	// Dropped, the queue being full
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-2/checkin", strings.NewReader(`{}`)))
+	assert.Equal(t, uint64(1), s.stats().Dropped)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	select {
+	case m := <-mirroredCh:
+		assert.Equal(t, "/staging/api/fleet/agents/agent-1/checkin?wait=1", m.path)
+		assert.JSONEq(t, `{"status":"online","events":[{"message":"m","access_api_key":"[REDACTED]"}]}`, m.body)
+		assert.Equal(t, "ApiKey staging", m.header.Get("Authorization"))
+		assert.Equal(t, "elastic agent 8.0.0", m.header.Get("User-Agent"))
+		assert.Equal(t, "true", m.header.Get(kShadowHeader))
+		assert.Empty(t, m.header.Get("Content-Encoding"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("checkin not mirrored")
+	}
+
+	assert.Eventually(t, func() bool { return s.stats().Mirrored == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, s.stats().Failed)
+}
+
+func TestShadowFailed(t *testing.T) {
+	staging := httptest.NewServer(http.NotFoundHandler())
+	staging.Close()
+
+	s := newTestShadow(t, staging.URL)
+	req, err := sanitizeShadowRequest(httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-1/checkin", nil), &captureBuffer{max: 16, truncated: true})
+	assert.Equal(t, ErrShadowBodyTooLarge, err)
+
+	body := &captureBuffer{max: 16}
+	body.Write([]byte(`{}`))
+	req, err = sanitizeShadowRequest(httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-1/checkin", nil), body)
+	require.NoError(t, err)
+
+	s.send(context.Background(), req)
+	assert.Equal(t, uint64(1), s.stats().Failed)
+	assert.Zero(t, s.stats().Mirrored)
+}
@@ -0,0 +1,52 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/coordinator"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// simulatedPeer is a logical Fleet Server run by this process in the
+// simulation mode. It leads policies through its own coordinator monitor and
+// takes its turns in the rolling restarts: it drains like a server, then
+// restarts in place by running a new monitor, releasing its policies to the
+// other servers meanwhile. A peer serves no agents, so its drain only holds
+// its turn for the drain timeout.
+type simulatedPeer struct {
+	id         string
+	newMonitor func() coordinator.Monitor
+	// newRestart is nil when the rolling restarts are disabled.
+	newRestart func() *RollingRestartT
+}
+
+// Run runs the peer until ctx is done, restarting it for its turns of the
+// rolling restarts.
+func (p *simulatedPeer) Run(ctx context.Context) error {
+	for {
+		err := p.run(ctx)
+		if !errors.Is(err, ErrRollingRestart) {
+			return err
+		}
+		log.Info().Str("simulated_peer", p.id).Msg("Simulated peer restarting for the rolling restart")
+	}
+}
+
+// run runs the peer once, until its turn of a rolling restart.
+func (p *simulatedPeer) run(ctx context.Context) error {
+	g, gctx := errgroup.WithContext(ctx)
+	m := p.newMonitor()
+	g.Go(func() error { return m.Run(gctx) })
+	if p.newRestart != nil {
+		rrt := p.newRestart()
+		g.Go(func() error { return rrt.Run(gctx) })
+	}
+	return g.Wait()
+}
@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/coordinator"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type runsMonitor struct {
+	runs *int32
+}
+
+func (m runsMonitor) Run(ctx context.Context) error {
+	atomic.AddInt32(m.runs, 1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSimulatedPeerRestarts(t *testing.T) {
+	now := time.Now()
+	bulker := &serversBulk{servers: map[string]model.Server{
+		"agent-peer-1": testServer("agent-peer-1", now, &model.ServerRestart{RequestedId: "r1", State: kRestartPending}),
+		"agent-peer-2": testServer("agent-peer-2", now, nil),
+	}}
+
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.RollingRestart.DrainTimeout = 0
+	cfg.RollingRestart.CheckInterval = 10 * time.Millisecond
+
+	var runs int32
+	p := &simulatedPeer{
+		id:         "agent-peer-1",
+		newMonitor: func() coordinator.Monitor { return runsMonitor{runs: &runs} },
+		newRestart: func() *RollingRestartT {
+			rrt := NewRollingRestartT(cfg, "agent-peer-1", bulker, cache.Cache{}, newLongPolls())
+			rrt.now = func() time.Time { return now }
+			return rrt
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	// The peer takes its turn, then runs a new monitor and records it is done
+	assert.Eventually(t, func() bool {
+		return bulker.restartState("agent-peer-1") == kRestartDone && atomic.LoadInt32(&runs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+}
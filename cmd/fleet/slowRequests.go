@@ -0,0 +1,163 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// requestPhase is a part of the handling of a request timed on its own.
+type requestPhase int
+
+const (
+	phaseAuth requestPhase = iota
+	phaseESRead
+	phaseESWrite
+	phaseLongPoll
+	phaseMarshal
+	phaseWrite
+	kNumPhases
+)
+
+var phaseNames = [kNumPhases]string{"auth", "es_read", "es_write", "long_poll", "marshal", "write"}
+
+type requestPhasesKey struct{}
+
+// requestPhases sums the time spent in each phase by a request; the phases
+// may be timed from the goroutines of the handler.
+type requestPhases struct {
+	d [kNumPhases]int64 // atomic
+}
+
+func (rp *requestPhases) add(phase requestPhase, d time.Duration) {
+	atomic.AddInt64(&rp.d[phase], int64(d))
+}
+
+func (rp *requestPhases) get(phase requestPhase) time.Duration {
+	return time.Duration(atomic.LoadInt64(&rp.d[phase]))
+}
+
+// timePhase times the phase of the request of ctx until the returned func is
+// first called; it does nothing unless slow requests are logged.
+func timePhase(ctx context.Context, phase requestPhase) func() {
+	rp, ok := ctx.Value(requestPhasesKey{}).(*requestPhases)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	var done bool
+	return func() {
+		if !done {
+			done = true
+			rp.add(phase, time.Since(start))
+		}
+	}
+}
+
+// slowRequests logs the requests exceeding the threshold of their endpoint,
+// with the time spent in each phase.
+type slowRequests struct {
+	cfg config.SlowRequests
+	now func() time.Time
+}
+
+// newSlowRequests returns nil when disabled.
+func newSlowRequests(cfg *config.Server) *slowRequests {
+	if !cfg.SlowRequests.Enabled {
+		return nil
+	}
+	return &slowRequests{
+		cfg: cfg.SlowRequests,
+		now: time.Now,
+	}
+}
+
+func (sr *slowRequests) threshold(endpoint string) time.Duration {
+	if threshold, ok := sr.cfg.Thresholds[endpoint]; ok {
+		return threshold
+	}
+	return sr.cfg.Threshold
+}
+
+// track times the phases of the request until the returned func is called,
+// which logs the request when slow. The waits on the bulker are timed as the
+// Elasticsearch reads and writes, the writes of the response returned as the
+// write.
+func (sr *slowRequests) track(endpoint string, w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	if sr == nil {
+		return w, r, func() {}
+	}
+
+	start := sr.now()
+	rp := &requestPhases{}
+	ctx := context.WithValue(r.Context(), requestPhasesKey{}, rp)
+	ctx = bulk.WithObserver(ctx, func(action bulk.Action, d time.Duration) {
+		switch action {
+		case bulk.ActionRead, bulk.ActionSearch:
+			rp.add(phaseESRead, d)
+		default:
+			rp.add(phaseESWrite, d)
+		}
+	})
+
+	return &timedResponseWriter{ResponseWriter: w, rp: rp}, r.WithContext(ctx), func() {
+		sr.log(endpoint, r, sr.now().Sub(start), rp)
+	}
+}
+
+// slow tells whether the request took longer than the threshold of its
+// endpoint, not counting its long poll.
+func (sr *slowRequests) slow(endpoint string, took time.Duration, rp *requestPhases) (time.Duration, bool) {
+	threshold := sr.threshold(endpoint)
+	return threshold, took-rp.get(phaseLongPoll) > threshold
+}
+
+func (sr *slowRequests) log(endpoint string, r *http.Request, took time.Duration, rp *requestPhases) {
+	threshold, slow := sr.slow(endpoint, took, rp)
+	if !slow {
+		return
+	}
+
+	ev := log.Warn().
+		Str("endpoint", endpoint).
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Dur("took", took).
+		Dur("threshold", threshold)
+	for phase, name := range phaseNames {
+		ev = ev.Dur(name, rp.get(requestPhase(phase)))
+	}
+	ev.Msg("Slow request")
+}
+
+// timedResponseWriter times the writes of the response.
+type timedResponseWriter struct {
+	http.ResponseWriter
+	rp *requestPhases
+}
+
+func (t *timedResponseWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.ResponseWriter.Write(p)
+	t.rp.add(phaseWrite, time.Since(start))
+	return n, err
+}
+
+// Flush lets the handlers streaming their response flush it.
+func (t *timedResponseWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		start := time.Now()
+		f.Flush()
+		t.rp.add(phaseWrite, time.Since(start))
+	}
+}
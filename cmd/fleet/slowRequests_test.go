@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestSlowRequests(t *testing.T) {
+	var cfg config.Server
+	cfg.InitDefaults()
+	assert.Nil(t, newSlowRequests(&cfg), "disabled")
+
+	cfg.SlowRequests.Enabled = true
+	cfg.SlowRequests.Threshold = time.Second
+	cfg.SlowRequests.Thresholds = map[string]time.Duration{"enroll": 3 * time.Second}
+	sr := newSlowRequests(&cfg)
+	require.NotNil(t, sr)
+
+	w, r, done := sr.track("checkin", httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	defer done()
+
+	rp, ok := r.Context().Value(requestPhasesKey{}).(*requestPhases)
+	require.True(t, ok)
+
+	waited := timePhase(r.Context(), phaseLongPoll)
+	time.Sleep(10 * time.Millisecond)
+	waited()
+	longPoll := rp.get(phaseLongPoll)
+	assert.True(t, longPoll >= 10*time.Millisecond)
+	time.Sleep(time.Millisecond)
+	waited()
+	assert.Equal(t, longPoll, rp.get(phaseLongPoll), "timed once")
+
+	_, err := w.Write([]byte("{}"))
+	require.NoError(t, err)
+	assert.True(t, rp.get(phaseWrite) > 0)
+	assert.Equal(t, time.Duration(0), rp.get(phaseAuth))
+
+	threshold, slow := sr.slow("checkin", time.Second+5*time.Millisecond, rp)
+	assert.Equal(t, time.Second, threshold)
+	assert.False(t, slow, "long poll not counted")
+	_, slow = sr.slow("checkin", 2*time.Second, rp)
+	assert.True(t, slow)
+	threshold, slow = sr.slow("enroll", 2*time.Second, &requestPhases{})
+	assert.Equal(t, 3*time.Second, threshold)
+	assert.False(t, slow)
+}
@@ -0,0 +1,206 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/backup"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	kStateOutput    = "output"
+	kStateInput     = "input"
+	kStateIndex     = "index"
+	kStateMapPolicy = "map-policy"
+	kStateOverwrite = "overwrite"
+)
+
+func newStateCommand(version string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Export and restore the fleet state held in the .fleet-* indices",
+	}
+
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "Export the agents, enrollment keys, policies and policy leaders to an archive",
+		Long: "Export the agents, enrollment keys, policies and policy leaders to an archive.\n\n" +
+			"The API keys are left out of the archive, only their ids are exported: the output keys of the agents " +
+			"and the secrets of the enrollment keys.",
+		Args: cobra.NoArgs,
+		RunE: getStateExportCommand(version),
+	}
+	export.Flags().StringP(kStateOutput, "o", "fleet-state.tar.gz", "Archive to write")
+	export.Flags().StringSlice(kStateIndex, backup.DefaultIndices, "Indices to export")
+	cmd.AddCommand(export)
+
+	restore := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore an archive of the fleet state, typically into a fresh cluster",
+		Long: "Restore an archive of the fleet state, typically into a fresh cluster.\n\n" +
+			"The API keys are not part of the archive: the agents authenticate, and the enrollment keys can be used, " +
+			"once the security feature state is restored from a snapshot of the same cluster; otherwise the agents " +
+			"have to enroll again with new enrollment keys. The agents get new output keys with their next policy.",
+		Args: cobra.NoArgs,
+		RunE: getStateRestoreCommand(),
+	}
+	restore.Flags().StringP(kStateInput, "i", "fleet-state.tar.gz", "Archive to read")
+	restore.Flags().StringSlice(kStateIndex, nil, "Indices to restore; all those of the archive when unset")
+	restore.Flags().StringSlice(kStateMapPolicy, nil, "Policy id of the archive to replace, as old=new; repeatable")
+	restore.Flags().Bool(kStateOverwrite, false, "Overwrite the documents that exist already instead of skipping them")
+	cmd.AddCommand(restore)
+
+	return cmd
+}
+
+func getStateExportCommand(version string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		output, err := cmd.Flags().GetString(kStateOutput)
+		if err != nil {
+			return err
+		}
+		indices, err := cmd.Flags().GetStringSlice(kStateIndex)
+		if err != nil {
+			return err
+		}
+
+		return runStateCommand(cmd, func(ctx context.Context, bulker bulk.Bulk) error {
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			m, err := backup.Export(ctx, bulker, f, version, indices)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+
+			results := make([]backup.IndexResult, len(m.Indices))
+			for i, index := range m.Indices {
+				results[i] = backup.IndexResult{Name: index.Name, Docs: index.Docs}
+			}
+			fmt.Fprintf(os.Stdout, "Exported to %s\n", output)
+			return printStateResults(os.Stdout, results, false)
+		})
+	}
+}
+
+func getStateRestoreCommand() func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		input, err := cmd.Flags().GetString(kStateInput)
+		if err != nil {
+			return err
+		}
+		var opts backup.RestoreOptions
+		if opts.Indices, err = cmd.Flags().GetStringSlice(kStateIndex); err != nil {
+			return err
+		}
+		if opts.Overwrite, err = cmd.Flags().GetBool(kStateOverwrite); err != nil {
+			return err
+		}
+		mappings, err := cmd.Flags().GetStringSlice(kStateMapPolicy)
+		if err != nil {
+			return err
+		}
+		if opts.PolicyIds, err = parseIdMap(mappings); err != nil {
+			return err
+		}
+
+		return runStateCommand(cmd, func(ctx context.Context, bulker bulk.Bulk) error {
+			f, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			m, results, err := backup.Restore(ctx, bulker, f, opts)
+			if err == nil || len(results) > 0 {
+				fmt.Fprintf(os.Stdout, "Restored %s, exported by Fleet Server %s at %s\n", input, m.ServerVersion, m.CreatedAt)
+				if perr := printStateResults(os.Stdout, results, true); err == nil {
+					err = perr
+				}
+			}
+			return err
+		})
+	}
+}
+
+// runStateCommand runs fn with a bulker to the Elasticsearch cluster of the
+// configuration.
+func runStateCommand(cmd *cobra.Command, fn func(ctx context.Context, bulker bulk.Bulk) error) error {
+	cfg, err := loadStandaloneConfig(cmd)
+	if err != nil {
+		return err
+	}
+	l, err := logger.Init(cfg)
+	if err != nil {
+		return err
+	}
+	defer l.Sync()
+
+	if err := initIndices(&cfg.Inputs[0].Server.Indices); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(installSignalHandler())
+	defer cancel()
+
+	_, bulker, err := bulk.InitES(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, bulker); err != nil {
+		log.Error().Err(err).Msg("Fail fleet state command")
+		return err
+	}
+	return nil
+}
+
+// parseIdMap parses the old=new pairs.
+func parseIdMap(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid id mapping %q, expecting old=new", pair)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+func printStateResults(w io.Writer, results []backup.IndexResult, restored bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if restored {
+		fmt.Fprintln(tw, "INDEX\tDOCS\tRESTORED\tEXISTING")
+	} else {
+		fmt.Fprintln(tw, "INDEX\tDOCS")
+	}
+	for _, r := range results {
+		if restored {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", r.Name, r.Docs, r.Restored, r.Existing)
+		} else {
+			fmt.Fprintf(tw, "%s\t%d\n", r.Name, r.Docs)
+		}
+	}
+	return tw.Flush()
+}
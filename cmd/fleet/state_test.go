@@ -0,0 +1,29 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIdMap(t *testing.T) {
+	m, err := parseIdMap([]string{"p1=p2", "p3=p4=x"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"p1": "p2", "p3": "p4=x"}, m)
+
+	m, err = parseIdMap(nil)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	for _, pair := range []string{"p1", "=p2", "p1="} {
+		_, err := parseIdMap([]string{pair})
+		assert.Error(t, err, pair)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/maintenance"
+
+	"github.com/rs/zerolog/log"
+)
+
+// uploadGC fails the uploads abandoned by their agents and deletes their
+// chunks from the upload storage, where they are otherwise kept forever. The
+// deletions only run within the maintenance windows.
+type uploadGC struct {
+	cfg          *config.UploadGC
+	bulk         bulk.Bulk
+	mw           *maintenance.Windows
+	deleteChunks func(ctx context.Context, id string) (int64, error)
+}
+
+func newUploadGC(cfg *config.UploadGC, storage uploadStorage, bulker bulk.Bulk, mw *maintenance.Windows) *uploadGC {
+	return &uploadGC{
+		cfg:          cfg,
+		bulk:         bulker,
+		mw:           mw,
+		deleteChunks: storage.deleteChunks,
+	}
+}
+
+// Run collects the abandoned uploads every interval until ctx is done.
+func (gc *uploadGC) Run(ctx context.Context) error {
+	log.Info().
+		Dur("interval", gc.cfg.Interval).
+		Dur("timeout", gc.cfg.Timeout).
+		Msg("Upload GC started")
+
+	t := time.NewTicker(gc.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if err := gc.mw.Wait(ctx, "upload GC"); err != nil {
+			return err
+		}
+
+		if n, err := gc.collect(ctx, time.Now()); err != nil {
+			log.Warn().Err(err).Msg("Fail to collect abandoned uploads")
+		} else if n > 0 {
+			log.Info().Int("uploads", n).Msg("Collected abandoned uploads")
+		}
+	}
+}
+
+// collect deletes the chunks of the uploads abandoned as of now and fails
+// them, and returns how many were. The chunks are deleted first so an upload
+// whose chunks could not be is found again on the next interval.
+func (gc *uploadGC) collect(ctx context.Context, now time.Time) (int, error) {
+	uploads, err := dl.FindAbandonedUploads(ctx, gc.bulk, now.Add(-gc.cfg.Timeout), gc.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	reason := "abandoned: no chunk written for " + gc.cfg.Timeout.String()
+	var n int
+	for _, upload := range uploads {
+		zlog := log.With().
+			Str("uploadId", upload.Id).
+			Str("agentId", upload.AgentId).
+			Str("actionId", upload.ActionId).
+			Logger()
+
+		chunks, err := gc.deleteChunks(ctx, upload.Id)
+		if err != nil {
+			zlog.Warn().Err(err).Msg("Fail to delete the chunks of abandoned upload")
+			continue
+		}
+		if err := dl.FailUpload(ctx, gc.bulk, upload.Id, reason); err != nil {
+			zlog.Warn().Err(err).Msg("Fail to mark abandoned upload failed")
+			continue
+		}
+		zlog.Info().
+			Int64("chunks", chunks).
+			Str("updatedAt", upload.UpdatedAt).
+			Msg("Abandoned upload failed")
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+// uploadsBulk returns the uploads on search and records their updates.
+type uploadsBulk struct {
+	ftesting.MockBulk
+	uploads []model.Upload
+	query   string
+	updates map[string]string
+}
+
+func (m *uploadsBulk) Search(ctx context.Context, index []string, body []byte, opts ...bulk.Opt) (*es.ResultT, error) {
+	m.query = string(body)
+	res := &es.ResultT{}
+	for _, u := range m.uploads {
+		src, err := json.Marshal(u)
+		if err != nil {
+			return nil, err
+		}
+		res.Hits = append(res.Hits, es.HitT{Id: u.Id, Source: src})
+	}
+	return res, nil
+}
+
+func (m *uploadsBulk) Update(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) error {
+	m.updates[id] = string(body)
+	return nil
+}
+
+func TestUploadGC_Collect(t *testing.T) {
+	bulker := &uploadsBulk{
+		uploads: []model.Upload{
+			{ESDocument: model.ESDocument{Id: "up1"}, AgentId: "a", ActionId: "act", Status: model.UploadStatusUploading},
+			{ESDocument: model.ESDocument{Id: "up2"}, AgentId: "b", ActionId: "act", Status: model.UploadStatusUploading},
+		},
+		updates: make(map[string]string),
+	}
+
+	var cfg config.UploadGC
+	cfg.InitDefaults()
+	gc := newUploadGC(&cfg, &esUploadStorage{bulk: bulker}, bulker, nil)
+
+	var deleted []string
+	gc.deleteChunks = func(ctx context.Context, id string) (int64, error) {
+		deleted = append(deleted, id)
+		if id == "up2" {
+			return 0, errors.New("unavailable")
+		}
+		return 3, nil
+	}
+
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	n, err := gc.collect(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Contains(t, bulker.query, `"2021-05-01T11:00:00Z"`)
+	assert.Contains(t, bulker.query, `"UPLOADING"`)
+	assert.Equal(t, []string{"up1", "up2"}, deleted)
+
+	// The upload whose chunks could not be deleted is left for the next run
+	require.Len(t, bulker.updates, 1)
+	assert.JSONEq(t, `{"doc":{"status":"FAIL","error":"abandoned: no chunk written for 1h0m0s"}}`, bulker.updates["up1"])
+}
@@ -0,0 +1,156 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	kUploadScanClean     = "clean"
+	kUploadScanMalicious = "malicious"
+
+	kUploadScanMaxResponse = 64 * 1024
+)
+
+var (
+	ErrUploadRejected        = errors.New("upload rejected by the scanner")
+	ErrUploadScanUnavailable = errors.New("upload scanner unavailable")
+)
+
+// uploadScanRequest is the body posted to the scanner for every upload.
+type uploadScanRequest struct {
+	UploadId    string              `json:"upload_id"`
+	AgentId     string              `json:"agent_id"`
+	ActionId    string              `json:"action_id"`
+	Integration string              `json:"integration,omitempty"`
+	File        *model.FileMetadata `json:"file"`
+}
+
+// uploadScanResponse is the verdict of the scanner.
+type uploadScanResponse struct {
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// uploadScanner asks an external scanner for a verdict on the uploaded files
+// before they are attached to their action result.
+type uploadScanner struct {
+	url          string
+	client       *http.Client
+	failOpen     bool
+	integrations map[string]bool
+}
+
+// newUploadScanner returns nil when the scanning is disabled.
+func newUploadScanner(cfg *config.UploadScan) *uploadScanner {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	log.Info().
+		Str("url", cfg.URL).
+		Dur("timeout", cfg.Timeout).
+		Bool("failOpen", cfg.FailOpen).
+		Strs("integrations", cfg.Integrations).
+		Msg("Upload scan install")
+
+	return &uploadScanner{
+		url:          cfg.URL,
+		client:       &http.Client{Timeout: cfg.Timeout},
+		failOpen:     cfg.FailOpen,
+		integrations: stringSet(cfg.Integrations),
+	}
+}
+
+// scans tells whether the uploads of the integration are scanned.
+func (s *uploadScanner) scans(integration string) bool {
+	return len(s.integrations) == 0 || s.integrations[integration]
+}
+
+// scan returns ErrUploadRejected if the scanner finds the upload malicious,
+// and ErrUploadScanUnavailable if it gives no verdict, unless failing open.
+func (s *uploadScanner) scan(ctx context.Context, req uploadScanRequest) error {
+	zlog := log.With().
+		Str("agentId", req.AgentId).
+		Str("actionId", req.ActionId).
+		Str("uploadId", req.UploadId).
+		Str("integration", req.Integration).
+		Logger()
+
+	resp, err := s.post(ctx, &req)
+	if err != nil {
+		cntUploadScanFailed.Inc()
+		if s.failOpen {
+			zlog.Warn().Err(err).Msg("Upload scan failed; accepting upload")
+			return nil
+		}
+		zlog.Warn().Err(err).Msg("Upload scan failed")
+		return ErrUploadScanUnavailable
+	}
+
+	if resp.Verdict == kUploadScanMalicious {
+		cntUploadScanRejected.Inc()
+		zlog.Warn().Str("reason", resp.Reason).Msg("Upload rejected by scanner")
+		return ErrUploadRejected
+	}
+
+	cntUploadScanClean.Inc()
+	zlog.Debug().Msg("Upload scanned clean")
+	return nil
+}
+
+func (s *uploadScanner) post(ctx context.Context, req *uploadScanRequest) (*uploadScanResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+
+	hres, err := s.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hres.Body.Close()
+
+	if hres.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scanner returned status %d", hres.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(hres.Body, kUploadScanMaxResponse))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp uploadScanResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	switch resp.Verdict {
+	case kUploadScanClean, kUploadScanMalicious:
+	default:
+		return nil, fmt.Errorf("unknown scanner verdict %q", resp.Verdict)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,148 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+type scanBulk struct {
+	uploadBulk
+	updated map[string]string
+}
+
+func (m scanBulk) Update(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) error {
+	var doc struct {
+		Doc map[string]string `json:"doc"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+	m.updated[id] = doc.Doc["status"]
+	return nil
+}
+
+func TestScanUpload(t *testing.T) {
+	var got uploadScanRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		switch got.File.Sha256 {
+		case "clean":
+			w.Write([]byte(`{"verdict":"clean"}`))
+		case "malicious":
+			w.Write([]byte(`{"verdict":"malicious","reason":"eicar"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := cache.New(cache.Config{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+	c.SetAction(model.Action{ActionId: "action-1", Type: "REQUEST_DIAGNOSTICS", InputType: "endpoint"}, time.Minute)
+	require.Eventually(t, func() bool {
+		_, ok := c.GetAction("action-1")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-1"}}
+	upload := func(sha string) model.Upload {
+		return model.Upload{
+			AgentId:  "agent-1",
+			ActionId: "action-1",
+			Status:   model.UploadStatusReady,
+			File:     &model.FileMetadata{Name: "bundle.zip", Size: 1024, Sha256: sha},
+		}
+	}
+	uploads := map[string]model.Upload{
+		"clean":     upload("clean"),
+		"malicious": upload("malicious"),
+		"failing":   upload("failing"),
+	}
+
+	tests := []struct {
+		name         string
+		uploadId     string
+		failOpen     bool
+		integrations []string
+		err          error
+		status       string
+	}{
+		{"clean", "clean", false, nil, nil, ""},
+		{"malicious", "malicious", false, nil, ErrUploadRejected, model.UploadStatusFail},
+		{"scanner failing", "failing", false, nil, ErrUploadScanUnavailable, ""},
+		{"fail open", "failing", true, nil, nil, ""},
+		{"integration scanned", "malicious", false, []string{"endpoint"}, ErrUploadRejected, model.UploadStatusFail},
+		{"integration not scanned", "malicious", false, []string{"osquery"}, nil, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bulker := scanBulk{uploadBulk{uploads: uploads}, make(map[string]string)}
+			ack := &AckT{
+				bulk:  bulker,
+				cache: c,
+				scanner: newUploadScanner(&config.UploadScan{
+					Enabled:      true,
+					URL:          srv.URL,
+					Timeout:      time.Second,
+					FailOpen:     tc.failOpen,
+					Integrations: tc.integrations,
+				}),
+			}
+
+			events := []Event{{ActionId: "action-1", UploadId: tc.uploadId}}
+			files, failed, err := ack.resolveUploads(context.Background(), agent, events)
+			require.NoError(t, err)
+			assert.Equal(t, tc.err, failed[0])
+			assert.Equal(t, tc.status, bulker.updated[tc.uploadId])
+			if tc.err == nil {
+				assert.Equal(t, uploads[tc.uploadId].File, files[tc.uploadId])
+			}
+		})
+	}
+
+	// The events of the uploads not accepted fail alone
+	ack := &AckT{
+		bulk:    scanBulk{uploadBulk{uploads: uploads}, make(map[string]string)},
+		cache:   c,
+		scanner: newUploadScanner(&config.UploadScan{Enabled: true, URL: srv.URL, Timeout: time.Second}),
+	}
+	events := []Event{
+		{ActionId: "action-1", UploadId: "clean"},
+		{ActionId: "action-1", UploadId: "malicious"},
+		{ActionId: "action-1", UploadId: "failing"},
+	}
+	failed, err := ack.handleAckEvents(context.Background(), agent, events)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]error{1: ErrUploadRejected, 2: ErrUploadScanUnavailable}, failed)
+
+	resp := ackResponse(agent.Id, events, failed)
+	assert.True(t, resp.Errors)
+	assert.Equal(t, []AckResponseItem{
+		{Status: http.StatusOK},
+		{Status: http.StatusUnprocessableEntity, Error: "UploadRejected", Message: "referenced upload was rejected by the scanner"},
+		{Status: http.StatusServiceUnavailable, Error: "UploadScanUnavailable", Message: "referenced upload could not be scanned"},
+	}, resp.Items)
+	assert.Equal(t, AckResponse{Action: "acks"}, ackResponse(agent.Id, events, nil))
+
+	assert.Equal(t, "agent-1", got.AgentId)
+	assert.Equal(t, "endpoint", got.Integration)
+}
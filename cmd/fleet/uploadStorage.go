@@ -0,0 +1,238 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/signedurl"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// kUploadSignTTL is how long the requests to the object store are
+	// presigned for; they are sent at once.
+	kUploadSignTTL = 15 * time.Minute
+
+	kUploadStorageMaxError = 4 * 1024
+)
+
+var ErrUploadChunkNoData = errors.New("upload chunk has no data")
+
+// uploadStorage stores the bytes of the chunks of the uploads. The chunk
+// documents are written to Elasticsearch whatever the backend, so the chunks
+// of an upload are found the same way.
+type uploadStorage interface {
+	// name is the backend, recorded on the uploads.
+	name() string
+
+	// putChunk stores the bytes of the chunk and writes its document.
+	putChunk(ctx context.Context, chunk model.UploadChunk, data []byte) error
+
+	// openChunk returns the bytes of the chunk.
+	openChunk(ctx context.Context, chunk model.UploadChunk) (io.ReadCloser, error)
+
+	// deleteChunks deletes the chunks of the upload, their bytes and their
+	// documents, and returns how many were deleted.
+	deleteChunks(ctx context.Context, id string) (int64, error)
+}
+
+func newUploadStorage(cfg *config.UploadStorage, bulker bulk.Bulk) (uploadStorage, error) {
+	switch cfg.Backend {
+	case config.UploadBackendS3:
+		return newObjectUploadStorage(cfg, bulker, signedurl.S3{
+			Region:          cfg.S3.Region,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+		}, nil)
+	case config.UploadBackendAzure:
+		return newObjectUploadStorage(cfg, bulker, signedurl.SAS{Token: cfg.Azure.SASToken}, http.Header{
+			"X-Ms-Blob-Type": []string{"BlockBlob"},
+		})
+	default:
+		return &esUploadStorage{bulk: bulker}, nil
+	}
+}
+
+// esUploadStorage keeps the bytes of the chunks on their documents.
+type esUploadStorage struct {
+	bulk bulk.Bulk
+}
+
+func (s *esUploadStorage) name() string {
+	return config.UploadBackendElasticsearch
+}
+
+func (s *esUploadStorage) putChunk(ctx context.Context, chunk model.UploadChunk, data []byte) error {
+	// Encoded in base64
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	chunk.Data = raw
+	return dl.WriteUploadChunk(ctx, s.bulk, chunk)
+}
+
+func (s *esUploadStorage) openChunk(ctx context.Context, chunk model.UploadChunk) (io.ReadCloser, error) {
+	stored, err := dl.ReadUploadChunk(ctx, s.bulk, chunk.Bid, chunk.Chunk)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored.Data) == 0 {
+		return nil, ErrUploadChunkNoData
+	}
+
+	var data []byte
+	if err := json.Unmarshal(stored.Data, &data); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *esUploadStorage) deleteChunks(ctx context.Context, id string) (int64, error) {
+	return dl.DeleteUploadChunks(ctx, s.bulk, id)
+}
+
+// objectUploadStorage writes the bytes of each chunk to an object named
+// <prefix><upload id>/<chunk> in the bucket or container at base, with the
+// requests signed by signer; putHeader is added to the writes.
+type objectUploadStorage struct {
+	backend   string
+	base      *url.URL
+	prefix    string
+	signer    signedurl.Signer
+	putHeader http.Header
+	client    *http.Client
+	bulk      bulk.Bulk
+	now       func() time.Time
+}
+
+func newObjectUploadStorage(cfg *config.UploadStorage, bulker bulk.Bulk, signer signedurl.Signer, putHeader http.Header) (*objectUploadStorage, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload storage url: %w", err)
+	}
+
+	log.Info().
+		Str("backend", cfg.Backend).
+		Str("url", cfg.URL).
+		Str("prefix", cfg.Prefix).
+		Msg("Upload storage install")
+
+	return &objectUploadStorage{
+		backend:   cfg.Backend,
+		base:      base,
+		prefix:    cfg.Prefix,
+		signer:    signer,
+		putHeader: putHeader,
+		client:    &http.Client{Timeout: cfg.Timeout},
+		bulk:      bulker,
+		now:       time.Now,
+	}, nil
+}
+
+func (s *objectUploadStorage) name() string {
+	return s.backend
+}
+
+// location returns the URL of the object of the chunk, signed for the method.
+func (s *objectUploadStorage) location(method, id string, chunk int64) (string, error) {
+	u := *s.base
+	u.Path = path.Join("/", u.Path, s.prefix+id, strconv.FormatInt(chunk, 10))
+	u.RawPath = ""
+
+	signed, err := s.signer.Sign(method, &u, s.now(), kUploadSignTTL)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+// do sends the request on the object of the chunk; the responses other than
+// 2xx, and 404 when notFoundOK, are returned as errors.
+func (s *objectUploadStorage) do(ctx context.Context, method, id string, chunk int64, body []byte, notFoundOK bool) (*http.Response, error) {
+	loc, err := s.location(method, id, chunk)
+	if err != nil {
+		return nil, err
+	}
+
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, loc, rd)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPut {
+		for k, v := range s.putHeader {
+			req.Header[k] = v
+		}
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 == 2 || (notFoundOK && res.StatusCode == http.StatusNotFound) {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, kUploadStorageMaxError))
+	return nil, fmt.Errorf("%s %s of chunk %d of upload %s returned status %d: %s", s.backend, method, chunk, id, res.StatusCode, msg)
+}
+
+func (s *objectUploadStorage) putChunk(ctx context.Context, chunk model.UploadChunk, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, chunk.Bid, chunk.Chunk, data, false)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	chunk.Data = nil
+	return dl.WriteUploadChunk(ctx, s.bulk, chunk)
+}
+
+func (s *objectUploadStorage) openChunk(ctx context.Context, chunk model.UploadChunk) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, chunk.Bid, chunk.Chunk, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// deleteChunks deletes the objects of the chunks written before their
+// documents, so the chunks whose objects could not be are found again.
+func (s *objectUploadStorage) deleteChunks(ctx context.Context, id string) (int64, error) {
+	chunks, err := dl.FindUploadChunks(ctx, s.bulk, id, config.UploadMaxChunks)
+	if err != nil {
+		return 0, err
+	}
+	for _, chunk := range chunks {
+		res, err := s.do(ctx, http.MethodDelete, id, chunk.Chunk, nil, true)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+	}
+	return dl.DeleteUploadChunks(ctx, s.bulk, id)
+}
@@ -0,0 +1,137 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+// chunksBulk keeps the documents indexed, by id.
+type chunksBulk struct {
+	ftesting.MockBulk
+	mu   sync.Mutex
+	docs map[string][]byte
+}
+
+func newChunksBulk() *chunksBulk {
+	return &chunksBulk{docs: make(map[string][]byte)}
+}
+
+func (m *chunksBulk) Index(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.docs[id] = body
+	return id, nil
+}
+
+func (m *chunksBulk) Read(ctx context.Context, index, id string, opts ...bulk.Opt) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.docs[id]
+	if !ok {
+		return nil, es.ErrElasticNotFound
+	}
+	return doc, nil
+}
+
+func TestESUploadStorage(t *testing.T) {
+	ctx := context.Background()
+	bulker := newChunksBulk()
+	s := &esUploadStorage{bulk: bulker}
+
+	chunk := model.UploadChunk{Bid: "up1", Chunk: 2, Sha2: "abcd", Size: 5}
+	require.NoError(t, s.putChunk(ctx, chunk, []byte("hello")))
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(bulker.docs["up1.2"], &doc))
+	assert.Equal(t, "aGVsbG8=", doc["data"])
+	assert.Equal(t, "up1", doc["bid"])
+
+	rc, err := s.openChunk(ctx, chunk)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestObjectUploadStorage(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Query().Get("sig") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			assert.Equal(t, "BlockBlob", r.Header.Get("X-Ms-Blob-Type"))
+			data, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			assert.Empty(t, r.Header.Get("X-Ms-Blob-Type"))
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	defer srv.Close()
+
+	bulker := newChunksBulk()
+	s, err := newUploadStorage(&config.UploadStorage{
+		Backend: config.UploadBackendAzure,
+		URL:     srv.URL + "/uploads",
+		Prefix:  "fleet/",
+		Timeout: time.Second,
+		Azure:   config.UploadStorageAzure{SASToken: "?sv=2021-08-06&sig=secret"},
+	}, bulker)
+	require.NoError(t, err)
+	assert.Equal(t, config.UploadBackendAzure, s.name())
+
+	chunk := model.UploadChunk{Bid: "up1", Chunk: 0, Sha2: "abcd", Size: 5}
+	require.NoError(t, s.putChunk(ctx, chunk, []byte("hello")))
+	assert.Equal(t, []byte("hello"), objects["/uploads/fleet/up1/0"])
+
+	// Only the metadata of the chunk is indexed
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(bulker.docs["up1.0"], &doc))
+	assert.NotContains(t, doc, "data")
+	assert.Equal(t, "abcd", doc["sha2"])
+
+	rc, err := s.openChunk(ctx, chunk)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, err = s.openChunk(ctx, model.UploadChunk{Bid: "up1", Chunk: 1})
+	assert.Error(t, err)
+}
@@ -11,8 +11,13 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 	"github.com/hashicorp/go-version"
+	"github.com/rs/zerolog/log"
 )
 
 const (
@@ -20,6 +25,10 @@ const (
 	MinVersion = "7.13"
 
 	userAgentPrefix = "elastic agent "
+
+	kMaxVersionBuckets      = 64
+	kUserAgentInvalidBucket = "invalid"
+	kUserAgentOtherBucket   = "other"
 )
 
 var (
@@ -55,24 +64,163 @@ func maximizePatch(ver *version.Version) string {
 	return strings.Join(segStrs, ".")
 }
 
+// userAgentPolicy holds the user agent rules of the endpoints checking the
+// version of the connecting Elastic Agents.
+type userAgentPolicy struct {
+	checkin *userAgentRule
+	enroll  *userAgentRule
+	reissue *userAgentRule
+}
+
+// userAgentRule accepts the agents which version matches any of its allowed
+// ranges. Warn rules serve the other agents too, only logging them.
+type userAgentRule struct {
+	endpoint string
+	allow    []version.Constraints
+	warn     bool
+}
+
+// newUserAgentPolicy returns the policy configured by cfg; verCon, the
+// versions supported by this Fleet Server, are allowed unless cfg sets other
+// ranges.
+func newUserAgentPolicy(verCon version.Constraints, cfg *config.UserAgent) (*userAgentPolicy, error) {
+	def, err := newUserAgentRule("", verCon, cfg.Mode, cfg.Allow, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &userAgentPolicy{}
+	for _, e := range []struct {
+		name string
+		rule config.UserAgentRule
+		dst  **userAgentRule
+	}{
+		{"checkin", cfg.Endpoints.Checkin, &p.checkin},
+		{"enroll", cfg.Endpoints.Enroll, &p.enroll},
+		{"reissue", cfg.Endpoints.Reissue, &p.reissue},
+	} {
+		if *e.dst, err = newUserAgentRule(e.name, verCon, e.rule.Mode, e.rule.Allow, def); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func newUserAgentRule(endpoint string, verCon version.Constraints, mode string, allow []string, parent *userAgentRule) (*userAgentRule, error) {
+	r := &userAgentRule{
+		endpoint: endpoint,
+		allow:    []version.Constraints{verCon},
+		warn:     mode == config.UserAgentModeWarn,
+	}
+	if parent != nil {
+		r.allow = parent.allow
+		if mode == "" {
+			r.warn = parent.warn
+		}
+	}
+	if len(allow) > 0 {
+		r.allow = make([]version.Constraints, 0, len(allow))
+		for _, a := range allow {
+			c, err := version.NewConstraint(a)
+			if err != nil {
+				return nil, err
+			}
+			r.allow = append(r.allow, c)
+		}
+	}
+	return r, nil
+}
+
+// versions returns the version ranges the rule allows.
+func (r *userAgentRule) versions() []string {
+	versions := make([]string, len(r.allow))
+	for i, c := range r.allow {
+		versions[i] = c.String()
+	}
+	return versions
+}
+
 // validateUserAgent validates that the User-Agent of the connecting Elastic Agent is valid and that the version is
-// supported for this Fleet Server.
-func validateUserAgent(r *http.Request, verConst version.Constraints) error {
+// allowed by the rule. The agents turned away, or only warned about, are counted by minor version.
+func validateUserAgent(r *http.Request, rule *userAgentRule) error {
+	ver, err := userAgentVersion(r)
+	if err != nil {
+		cntUserAgentRejected.inc(kUserAgentInvalidBucket)
+		return err
+	}
+	for _, c := range rule.allow {
+		if c.Check(ver) {
+			return nil
+		}
+	}
+
+	if rule.warn {
+		cntUserAgentWarned.inc(versionBucket(ver))
+		log.Warn().
+			Str("endpoint", rule.endpoint).
+			Str("version", ver.String()).
+			Msg("Serving Elastic Agent of unsupported version")
+		return nil
+	}
+
+	cntUserAgentRejected.inc(versionBucket(ver))
+	return ErrUnsupportedVersion
+}
+
+// userAgentVersion returns the version of the connecting Elastic Agent.
+func userAgentVersion(r *http.Request) (*version.Version, error) {
 	userAgent := r.Header.Get("User-Agent")
 	if userAgent == "" {
-		return ErrInvalidUserAgent
+		return nil, ErrInvalidUserAgent
 	}
 	userAgent = strings.ToLower(userAgent)
 	if !strings.HasPrefix(userAgent, userAgentPrefix) {
-		return ErrInvalidUserAgent
+		return nil, ErrInvalidUserAgent
 	}
 	verStr := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(userAgent, userAgentPrefix), "-snapshot"))
 	ver, err := version.NewVersion(verStr)
 	if err != nil {
-		return ErrInvalidUserAgent
+		return nil, ErrInvalidUserAgent
 	}
-	if !verConst.Check(ver) {
-		return ErrUnsupportedVersion
+	return ver, nil
+}
+
+// versionBucket returns the MAJOR_MINOR of the version; dots would nest the
+// metrics.
+func versionBucket(ver *version.Version) string {
+	segments := ver.Segments()
+	return fmt.Sprintf("%d_%d", segments[0], segments[1])
+}
+
+// versionBuckets counts the agents by version bucket. Past kMaxVersionBuckets
+// the new buckets are counted together, the versions being sent by the
+// clients.
+type versionBuckets struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func (b *versionBuckets) inc(bucket string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.counts == nil {
+		b.counts = make(map[string]uint64)
+	}
+	if _, ok := b.counts[bucket]; !ok && len(b.counts) >= kMaxVersionBuckets {
+		bucket = kUserAgentOtherBucket
+	}
+	b.counts[bucket]++
+}
+
+func (b *versionBuckets) report(_ monitoring.Mode, V monitoring.Visitor) {
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for bucket, n := range b.counts {
+		monitoring.ReportInt(V, bucket, int64(n))
 	}
-	return nil
 }
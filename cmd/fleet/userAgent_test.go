@@ -6,9 +6,14 @@ package fleet
 
 import (
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
 	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidateUserAgent(t *testing.T) {
@@ -82,7 +87,7 @@ func TestValidateUserAgent(t *testing.T) {
 		t.Run(tr.userAgent, func(t *testing.T) {
 			req := httptest.NewRequest("GET", "/", nil)
 			req.Header.Set("User-Agent", tr.userAgent)
-			res := validateUserAgent(req, tr.verCon)
+			res := validateUserAgent(req, &userAgentRule{allow: []version.Constraints{tr.verCon}})
 			if tr.err != res {
 				t.Fatalf("err mismatch: %v != %v", tr.err, res)
 			}
@@ -97,3 +102,51 @@ func mustBuildConstraints(verStr string) version.Constraints {
 	}
 	return con
 }
+
+func TestUserAgentPolicy(t *testing.T) {
+	cfg := config.UserAgent{
+		Mode:  config.UserAgentModeEnforce,
+		Allow: []string{">= 7.12, < 7.14"},
+		Endpoints: config.UserAgentEndpoints{
+			Checkin: config.UserAgentRule{Mode: config.UserAgentModeWarn},
+			Reissue: config.UserAgentRule{Allow: []string{">= 7.13"}},
+		},
+	}
+	p, err := newUserAgentPolicy(mustBuildConstraints("7.13.0"), &cfg)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		rule      *userAgentRule
+		userAgent string
+		err       error
+	}{
+		{"enroll allowed range", p.enroll, "Elastic Agent v7.12.1", nil},
+		{"enroll out of range", p.enroll, "Elastic Agent v7.14.0", ErrUnsupportedVersion},
+		{"checkin warn", p.checkin, "Elastic Agent v7.14.0", nil},
+		{"checkin invalid", p.checkin, "curl/7.64.1", ErrInvalidUserAgent},
+		{"reissue override", p.reissue, "Elastic Agent v8.1.0", nil},
+		{"reissue inherited mode", p.reissue, "Elastic Agent v7.12.1", ErrUnsupportedVersion},
+	}
+	for _, tr := range tests {
+		t.Run(tr.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("User-Agent", tr.userAgent)
+			assert.Equal(t, tr.err, validateUserAgent(req, tr.rule))
+		})
+	}
+}
+
+func TestVersionBuckets(t *testing.T) {
+	var b versionBuckets
+	b.inc("7_13")
+	b.inc("7_13")
+	for i := 0; i < kMaxVersionBuckets; i++ {
+		b.inc(versionBucket(version.Must(version.NewVersion("8." + strconv.Itoa(i)))))
+	}
+
+	assert.Len(t, b.counts, kMaxVersionBuckets+1)
+	assert.Equal(t, uint64(2), b.counts["7_13"])
+	assert.Equal(t, uint64(1), b.counts["8_62"])
+	assert.Equal(t, uint64(1), b.counts[kUserAgentOtherBucket])
+}
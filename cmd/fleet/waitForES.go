@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/preflight"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sleep"
+
+	"github.com/elastic/elastic-agent-client/v7/pkg/proto"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Backoff between the attempts to reach elasticsearch while waiting for
+	// it; doubles on each failed attempt.
+	kWaitForESBackoffInit = time.Second
+	kWaitForESBackoffMax  = 30 * time.Second
+)
+
+// initES connects to elasticsearch and runs the preflight checks. With a wait
+// for elasticsearch, failures are retried with exponential backoff until the
+// wait elapses, while the server answers every request with a 503; an
+// orchestrator then sees a starting server rather than a crash loop. The
+// bulker runs until stop is called.
+func (f *FleetServer) initES(ctx context.Context, cfg *config.Config) (esCli *elasticsearch.Client, bulker bulk.Bulk, stop context.CancelFunc, err error) {
+	deadline := time.Now().Add(f.waitForES)
+
+	var stopUnavailable func()
+	defer func() {
+		if stopUnavailable != nil {
+			stopUnavailable()
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		esCli, bulker, stop, err = f.connectES(ctx, cfg)
+		if err == nil || f.waitForES <= 0 || ctx.Err() != nil {
+			return esCli, bulker, stop, err
+		}
+
+		backoff := waitForESBackoff(attempt)
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, nil, nil, fmt.Errorf("elasticsearch not ready after waiting %s: %w", f.waitForES, err)
+		}
+
+		log.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Dur("retry_in", backoff).
+			Msg("Elasticsearch not ready; retry")
+		f.reporter.Status(proto.StateObserved_STARTING, fmt.Sprintf("Waiting for Elasticsearch - %s", err), nil)
+
+		if stopUnavailable == nil {
+			stopUnavailable = serveUnavailable(ctx, &cfg.Inputs[0].Server, kWaitForESBackoffMax)
+		}
+		if err := sleep.WithContext(ctx, backoff); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+}
+
+// connectES connects the bulker to elasticsearch and runs the preflight
+// checks, including version compatibility with elasticsearch.
+func (f *FleetServer) connectES(ctx context.Context, cfg *config.Config) (*elasticsearch.Client, bulk.Bulk, context.CancelFunc, error) {
+	// Bulker is started in its own context and managed inside of runServer. This is done so
+	// when the `ctx` is cancelled every worker using the bulker can get everything written on
+	// shutdown before the bulker is then cancelled.
+	bulkCtx, bulkCancel := context.WithCancel(context.Background())
+	esCli, bulker, err := bulk.InitES(bulkCtx, cfg)
+	if err != nil {
+		bulkCancel()
+		return nil, nil, nil, err
+	}
+
+	results, err := runPreflight(ctx, cfg, esCli, f.ver)
+	preflight.Log(results)
+	if err != nil {
+		bulkCancel()
+		return nil, nil, nil, err
+	}
+
+	return esCli, bulker, bulkCancel, nil
+}
+
+func waitForESBackoff(attempt int) time.Duration {
+	backoff := kWaitForESBackoffInit
+	for i := 1; i < attempt && backoff < kWaitForESBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > kWaitForESBackoffMax {
+		backoff = kWaitForESBackoffMax
+	}
+	return backoff
+}
+
+// serveUnavailable answers the requests to the server with a 503 until the
+// returned function is called; it returns once the address is released.
+func serveUnavailable(ctx context.Context, cfg *config.Server, retryAfter time.Duration) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		err := runServer(ctx, unavailableHandler(retryAfter), cfg)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Fail to serve while waiting for Elasticsearch")
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// unavailableHandler answers with a 503: a starting status on the status
+// route and an error on the others.
+func unavailableHandler(retryAfter time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+
+		if r.URL.Path != ROUTE_STATUS {
+			WriteError(w, http.StatusServiceUnavailable, "ServiceUnavailable", "waiting for elasticsearch")
+			return
+		}
+
+		data, err := json.Marshal(&StatusResponse{
+			Name:   "fleet-server",
+			Status: proto.StateObserved_STARTING.String(),
+		})
+		if err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(data)
+	})
+}
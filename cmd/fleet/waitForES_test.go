@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForESBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, kWaitForESBackoffInit},
+		{2, 2 * kWaitForESBackoffInit},
+		{3, 4 * kWaitForESBackoffInit},
+		{5, 16 * kWaitForESBackoffInit},
+		{6, kWaitForESBackoffMax},
+		{1000, kWaitForESBackoffMax},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, waitForESBackoff(tc.attempt), "attempt %d", tc.attempt)
+	}
+}
+
+func TestUnavailableHandler(t *testing.T) {
+	h := unavailableHandler(30 * time.Second)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ROUTE_STATUS, nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	var resp StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "fleet-server", resp.Name)
+	assert.Equal(t, "STARTING", resp.Status)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fleet/agents/enroll", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "ServiceUnavailable")
+}
@@ -0,0 +1,248 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// watchedRequest is a request handler tracked by the watchdog.
+type watchedRequest struct {
+	endpoint string
+	goid     uint64
+	start    time.Time
+	budget   time.Duration
+	cancel   context.CancelFunc
+	stuck    bool
+}
+
+// watchdogStats are the handlers tracked and stuck, and the totals detected
+// and canceled.
+type watchdogStats struct {
+	Tracked  int
+	Stuck    int
+	Detected uint64
+	Canceled uint64
+}
+
+// watchdog detects the request handlers running past the timeout budget of
+// their endpoint. The handler goroutines are labeled with their endpoint, so
+// the goroutine profiles of pprof attribute the stuck ones as well.
+type watchdog struct {
+	cfg      config.Watchdog
+	timeouts config.ServerTimeouts
+
+	mut      sync.Mutex
+	next     uint64
+	reqs     map[uint64]*watchedRequest
+	detected uint64
+	canceled uint64
+
+	now    func() time.Time
+	stacks func() []byte
+}
+
+// newWatchdog returns nil when disabled.
+func newWatchdog(cfg *config.Server) *watchdog {
+	if !cfg.Watchdog.Enabled {
+		return nil
+	}
+	return &watchdog{
+		cfg:      cfg.Watchdog,
+		timeouts: cfg.Timeouts,
+		reqs:     make(map[uint64]*watchedRequest),
+		now:      time.Now,
+		stacks:   allStacks,
+	}
+}
+
+// budget is the time the handlers of the endpoint may run.
+func (wd *watchdog) budget(endpoint string) time.Duration {
+	if budget, ok := wd.cfg.Budgets[endpoint]; ok {
+		return budget
+	}
+	switch endpoint {
+	case "checkin", "checkin_poll", "checkin_poll_head":
+		return wd.timeouts.CheckinLongPoll
+	}
+	return wd.timeouts.Write
+}
+
+// track watches the handler of the request, running on the calling goroutine,
+// until the returned func is called. The request returned carries the context
+// the watchdog cancels.
+func (wd *watchdog) track(endpoint string, r *http.Request) (*http.Request, func()) {
+	if wd == nil {
+		return r, func() {}
+	}
+
+	parent := r.Context()
+	ctx, cancel := context.WithCancel(pprof.WithLabels(parent, pprof.Labels("endpoint", endpoint)))
+	pprof.SetGoroutineLabels(ctx)
+
+	req := &watchedRequest{
+		endpoint: endpoint,
+		goid:     goroutineID(),
+		start:    wd.now(),
+		budget:   wd.budget(endpoint),
+		cancel:   cancel,
+	}
+
+	wd.mut.Lock()
+	id := wd.next
+	wd.next++
+	wd.reqs[id] = req
+	wd.mut.Unlock()
+
+	return r.WithContext(ctx), func() {
+		wd.mut.Lock()
+		delete(wd.reqs, id)
+		wd.mut.Unlock()
+
+		cancel()
+		pprof.SetGoroutineLabels(parent)
+	}
+}
+
+// Run checks the tracked handlers every interval until ctx is done.
+func (wd *watchdog) Run(ctx context.Context) error {
+	log.Info().
+		Dur("interval", wd.cfg.Interval).
+		Dur("grace", wd.cfg.Grace).
+		Bool("cancel", wd.cfg.Cancel).
+		Msg("Request watchdog started")
+
+	ticker := time.NewTicker(wd.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			wd.scan()
+		}
+	}
+}
+
+// scan reports, and cancels when configured, the handlers newly past their
+// budget; each is reported once.
+func (wd *watchdog) scan() {
+	now := wd.now()
+
+	var stuck []watchedRequest
+	wd.mut.Lock()
+	for _, req := range wd.reqs {
+		if req.stuck || now.Sub(req.start) < req.budget+wd.cfg.Grace {
+			continue
+		}
+		req.stuck = true
+		wd.detected++
+		if wd.cfg.Cancel {
+			req.cancel()
+			wd.canceled++
+		}
+		stuck = append(stuck, *req)
+	}
+	wd.mut.Unlock()
+
+	if len(stuck) == 0 {
+		return
+	}
+
+	// Dumping the stacks stops the world; it is done once per scan and only
+	// for the first handlers
+	var samples map[uint64]string
+	if wd.cfg.MaxStacks > 0 {
+		ids := make(map[uint64]bool)
+		for i := 0; i < len(stuck) && i < wd.cfg.MaxStacks; i++ {
+			ids[stuck[i].goid] = true
+		}
+		samples = stackSamples(wd.stacks(), ids)
+	}
+
+	for _, req := range stuck {
+		ev := log.Warn().
+			Str("endpoint", req.endpoint).
+			Uint64("goroutine", req.goid).
+			Dur("age", now.Sub(req.start)).
+			Dur("budget", req.budget).
+			Bool("canceled", wd.cfg.Cancel)
+		if stack, ok := samples[req.goid]; ok {
+			ev = ev.Str("stack", stack)
+		}
+		ev.Msg("Request handler exceeded its timeout budget")
+	}
+}
+
+func (wd *watchdog) stats() watchdogStats {
+	wd.mut.Lock()
+	defer wd.mut.Unlock()
+
+	stats := watchdogStats{
+		Tracked:  len(wd.reqs),
+		Detected: wd.detected,
+		Canceled: wd.canceled,
+	}
+	for _, req := range wd.reqs {
+		if req.stuck {
+			stats.Stuck++
+		}
+	}
+	return stats
+}
+
+// goroutineID parses the id of the calling goroutine from the header of its
+// stack, "goroutine 18 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// allStacks dumps the stacks of all the goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// stackSamples returns the stacks of the goroutines of ids from the dump.
+func stackSamples(dump []byte, ids map[uint64]bool) map[uint64]string {
+	samples := make(map[uint64]string, len(ids))
+	for _, stack := range bytes.Split(dump, []byte("\n\n")) {
+		header := bytes.TrimPrefix(stack, []byte("goroutine "))
+		i := bytes.IndexByte(header, ' ')
+		if i < 0 {
+			continue
+		}
+		id, err := strconv.ParseUint(string(header[:i]), 10, 64)
+		if err == nil && ids[id] {
+			samples[id] = string(stack)
+		}
+	}
+	return samples
+}
@@ -0,0 +1,90 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package fleet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestWatchdog(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	assert.Nil(t, newWatchdog(cfg))
+
+	cfg.Watchdog.Enabled = true
+	cfg.Watchdog.Cancel = true
+	cfg.Watchdog.Budgets = map[string]time.Duration{"acks": time.Minute}
+	wd := newWatchdog(cfg)
+	require.NotNil(t, wd)
+
+	assert.Equal(t, 5*time.Minute, wd.budget("checkin"))
+	assert.Equal(t, 10*time.Minute, wd.budget("enroll"))
+	assert.Equal(t, time.Minute, wd.budget("acks"))
+
+	now := time.Now()
+	wd.now = func() time.Time { return now }
+	var dumps int
+	wd.stacks = func() []byte {
+		dumps++
+		return allStacks()
+	}
+
+	checkin, doneCheckin := wd.track("checkin", httptest.NewRequest(http.MethodPost, "/", nil))
+	acks, _ := wd.track("acks", httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, watchdogStats{Tracked: 2}, wd.stats())
+
+	// Within budget and grace
+	now = now.Add(2*time.Minute - time.Second)
+	wd.scan()
+	assert.Equal(t, watchdogStats{Tracked: 2}, wd.stats())
+	assert.Equal(t, 0, dumps)
+
+	now = now.Add(time.Second)
+	wd.scan()
+	assert.Equal(t, watchdogStats{Tracked: 2, Stuck: 1, Detected: 1, Canceled: 1}, wd.stats())
+	assert.Error(t, acks.Context().Err())
+	assert.NoError(t, checkin.Context().Err())
+	assert.Equal(t, 1, dumps)
+
+	// Reported once
+	wd.scan()
+	assert.Equal(t, uint64(1), wd.stats().Detected)
+	assert.Equal(t, 1, dumps)
+
+	doneCheckin()
+	assert.Error(t, checkin.Context().Err())
+	assert.Equal(t, watchdogStats{Tracked: 1, Stuck: 1, Detected: 1, Canceled: 1}, wd.stats())
+}
+
+func TestStackSamples(t *testing.T) {
+	blocked := make(chan struct{})
+	idC := make(chan uint64)
+	go func() {
+		idC <- goroutineID()
+		<-blocked
+	}()
+	id := <-idC
+	defer close(blocked)
+
+	self := goroutineID()
+	assert.NotZero(t, self)
+	assert.NotEqual(t, self, id)
+
+	samples := stackSamples(allStacks(), map[uint64]bool{id: true})
+	require.Len(t, samples, 1)
+	assert.True(t, strings.HasPrefix(samples[id], "goroutine "))
+	assert.Contains(t, samples[id], "TestStackSamples")
+}
@@ -0,0 +1,54 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// envdoc generates the reference of the FLEET_SERVER_ environment variables
+// overriding the configuration keys, from the configuration structs.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+const header = `<!-- Generated by dev-tools/envdoc. DO NOT EDIT. -->
+
+# Environment variable overrides
+
+Every configuration key can be set with an environment variable named after
+its path: ` + "`" + config.EnvPrefix + "`" + ` followed by the key in upper case, with dots
+replaced by underscores. Values are parsed as with the ` + "`-E`" + ` flag.
+
+Environment variables override the configuration file and are overridden by
+the ` + "`-E`" + ` flag. Under the Elastic Agent, the configuration from the policy
+overrides them.
+
+| Variable | Key | Type |
+|----------|-----|------|
+`
+
+func main() {
+	var out string
+	flag.StringVar(&out, "o", "", "output file")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	for _, v := range config.EnvVars() {
+		fmt.Fprintf(&buf, "| `%s` | `%s` | %s |\n", v.Name, v.Key, v.Type)
+	}
+
+	if out == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// openapi-gen generates the request/response structs, request validation and
+// router wiring for the Fleet Server API from model/openapi.json, and embeds
+// the spec itself for the server to serve.
+//
+// Only the subset of OpenAPI used by the spec is supported. The following
+// vendor extensions drive the Go output:
+//
+//	x-go-route    path item; name of the route constant
+//	x-go-handler  operation; Router method that serves the operation
+//	x-go-name     property; Go field name when it differs from the default
+//	x-go-type     property; Go type used verbatim (e.g. json.RawMessage)
+//	x-go-error    property; error returned when validation of the field fails
+//	x-omitempty   property; adds omitempty to the json tag
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const header = `// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Code generated by openapi-gen. DO NOT EDIT.
+
+`
+
+var methods = []string{"get", "head", "post", "put", "patch", "delete"}
+
+type Spec struct {
+	Paths      json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type PathItem struct {
+	Route       string `json:"x-go-route"`
+	Description string `json:"description"`
+	Operations  map[string]*Operation
+}
+
+type Operation struct {
+	OperationId string `json:"operationId"`
+	Handler     string `json:"x-go-handler"`
+	Summary     string `json:"summary"`
+	Deprecated  bool   `json:"deprecated"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Description string             `json:"description"`
+	Required    []string           `json:"required"`
+	Enum        []string           `json:"enum"`
+	Items       *Schema            `json:"items"`
+	Properties  map[string]*Schema `json:"properties"`
+	GoName      string             `json:"x-go-name"`
+	GoType      string             `json:"x-go-type"`
+	GoError     string             `json:"x-go-error"`
+	OmitEmpty   bool               `json:"x-omitempty"`
+}
+
+type field struct {
+	name   string
+	json   string
+	schema *Schema
+}
+
+func main() {
+	var out, pkg string
+	flag.StringVar(&out, "o", "", "output file")
+	flag.StringVar(&pkg, "p", "main", "package name")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: openapi-gen -o <file> -p <package> <spec>")
+		os.Exit(2)
+	}
+
+	src, err := generate(flag.Arg(0), pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate(path, pkg string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	paths, order, err := parsePaths(spec.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	writeRoutes(&body, paths, order)
+	if err := writeSpec(&body, data); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if err := writeStruct(&body, name, spec.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range names {
+		writeValidate(&body, name, spec.Components.Schemas[name])
+	}
+
+	var std []string
+	if bytes.Contains(body.Bytes(), []byte("errors.New(")) {
+		std = append(std, `"errors"`)
+	}
+	if bytes.Contains(body.Bytes(), []byte("json.")) {
+		std = append(std, `"encoding/json"`)
+	}
+	sort.Strings(std)
+
+	imports := `"github.com/julienschmidt/httprouter"`
+	if len(std) > 0 {
+		imports = strings.Join(std, "\n") + "\n\n" + imports
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import (\n%s\n)\n\n", imports)
+	b.Write(body.Bytes())
+
+	return format.Source(b.Bytes())
+}
+
+// parsePaths decodes the path items keeping the order they are declared in,
+// so the generated router registers routes in spec order.
+func parsePaths(raw json.RawMessage) (map[string]*PathItem, []string, error) {
+	var items map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, nil, err
+	}
+
+	order, err := objectKeys(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths := make(map[string]*PathItem, len(items))
+	for path, item := range items {
+		pi := &PathItem{Operations: make(map[string]*Operation)}
+		for key, v := range item {
+			switch key {
+			case "x-go-route":
+				err = json.Unmarshal(v, &pi.Route)
+			case "description":
+				err = json.Unmarshal(v, &pi.Description)
+			default:
+				if isMethod(key) {
+					op := &Operation{}
+					err = json.Unmarshal(v, op)
+					pi.Operations[key] = op
+				}
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if pi.Route == "" {
+			return nil, nil, fmt.Errorf("path %s: missing x-go-route", path)
+		}
+		paths[path] = pi
+	}
+
+	return paths, order, nil
+}
+
+func objectKeys(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func isMethod(s string) bool {
+	for _, m := range methods {
+		if m == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeRoutes(b *bytes.Buffer, paths map[string]*PathItem, order []string) {
+	b.WriteString("const (\n")
+	for _, path := range order {
+		pi := paths[path]
+		if pi.Description != "" {
+			fmt.Fprintf(b, "\n// %s\n", pi.Description)
+		}
+		fmt.Fprintf(b, "%s = %q\n", pi.Route, routerPath(path))
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// registerRoutes wires the handlers declared in the API spec into the router;\n")
+	b.WriteString("// their body sizes are recorded under the snake_case operation id.\n")
+	b.WriteString("func (rt Router) registerRoutes(router *httprouter.Router) {\n")
+	for _, path := range order {
+		pi := paths[path]
+		for _, m := range methods {
+			op, ok := pi.Operations[m]
+			if !ok {
+				continue
+			}
+			if op.Deprecated {
+				b.WriteString("// deprecated\n")
+			}
+			fmt.Fprintf(b, "router.%s(%s, rt.measured(%q, rt.%s))\n", strings.ToUpper(m), pi.Route, snakeCase(op.OperationId), op.Handler)
+		}
+	}
+	b.WriteString("}\n\n")
+}
+
+// writeSpec embeds the spec, compacted.
+func writeSpec(b *bytes.Buffer, data []byte) error {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return err
+	}
+	b.WriteString("// openAPISpec is the API spec the routes and structs are generated from.\n")
+	fmt.Fprintf(b, "const openAPISpec = %s\n\n", strconv.Quote(compact.String()))
+	return nil
+}
+
+// snakeCase converts a camelCase operation id to snake_case.
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// routerPath converts an OpenAPI path template to httprouter syntax.
+func routerPath(path string) string {
+	r := strings.NewReplacer("{", ":", "}", "")
+	return r.Replace(path)
+}
+
+func fields(s *Schema) []field {
+	out := make([]field, 0, len(s.Properties))
+	for name, p := range s.Properties {
+		out = append(out, field{name: goName(name, p), json: name, schema: p})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+func writeStruct(b *bytes.Buffer, name string, s *Schema) error {
+	if s.Description != "" {
+		fmt.Fprintf(b, "// %s %s\n", name, s.Description)
+	}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, f := range fields(s) {
+		typ, err := goType(f.schema)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, f.json, err)
+		}
+		if f.schema.Description != "" {
+			fmt.Fprintf(b, "\n// %s\n", f.schema.Description)
+		}
+		tag := f.json
+		if f.schema.OmitEmpty {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "%s %s `json:\"%s\"`\n", f.name, typ, tag)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+func writeValidate(b *bytes.Buffer, name string, s *Schema) {
+	required := make(map[string]bool, len(s.Required))
+	for _, r := range s.Required {
+		required[r] = true
+	}
+
+	var checks bytes.Buffer
+	for _, f := range fields(s) {
+		fail := fmt.Sprintf("errors.New(%q)", fmt.Sprintf("invalid %s", f.json))
+		if f.schema.GoError != "" {
+			fail = f.schema.GoError
+		}
+
+		switch {
+		case len(f.schema.Enum) > 0:
+			quoted := make([]string, len(f.schema.Enum))
+			for i, e := range f.schema.Enum {
+				quoted[i] = fmt.Sprintf("%q", e)
+			}
+			fmt.Fprintf(&checks, "switch r.%s {\ncase %s:\ndefault:\nreturn %s\n}\n", f.name, strings.Join(quoted, ", "), fail)
+		case required[f.json] && f.schema.Type == "string":
+			fmt.Fprintf(&checks, "if r.%s == \"\" {\nreturn %s\n}\n", f.name, fail)
+		case required[f.json] && (f.schema.Type == "array" || f.schema.GoType == "json.RawMessage"):
+			fmt.Fprintf(&checks, "if len(r.%s) == 0 {\nreturn %s\n}\n", f.name, fail)
+		}
+	}
+
+	if checks.Len() == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "// Validate checks the %s against the constraints declared in the API spec.\n", name)
+	fmt.Fprintf(b, "func (r *%s) Validate() error {\n", name)
+	b.Write(checks.Bytes())
+	b.WriteString("return nil\n}\n\n")
+}
+
+func goName(name string, s *Schema) string {
+	if s.GoName != "" {
+		return s.GoName
+	}
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '@' })
+	for i, p := range parts {
+		parts[i] = strings.ToUpper(p[:1]) + p[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func goType(s *Schema) (string, error) {
+	if s.GoType != "" {
+		return s.GoType, nil
+	}
+	if s.Ref != "" {
+		return s.Ref[strings.LastIndex(s.Ref, "/")+1:], nil
+	}
+	switch s.Type {
+	case "":
+		return "interface{}", nil
+	case "string":
+		return "string", nil
+	case "boolean":
+		return "bool", nil
+	case "integer":
+		return "int64", nil
+	case "number":
+		return "float64", nil
+	case "object":
+		return "map[string]interface{}", nil
+	case "array":
+		if s.Items == nil {
+			return "[]interface{}", nil
+		}
+		typ, err := goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + typ, nil
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
@@ -0,0 +1,62 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	src, err := generate(filepath.Join("testdata", "spec.json"), "api")
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "api.go.golden")
+	if *update {
+		require.NoError(t, ioutil.WriteFile(golden, src, 0644))
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(src), "run go test ./dev-tools/openapi-gen -update after a change of the generator")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		err  string
+	}{
+		{
+			name: "missing route",
+			spec: `{"paths": {"/api/x": {"get": {"operationId": "x", "x-go-handler": "handleX"}}}}`,
+			err:  "path /api/x: missing x-go-route",
+		},
+		{
+			name: "unsupported type",
+			spec: `{"paths": {}, "components": {"schemas": {"X": {"properties": {"f": {"type": "date"}}}}}}`,
+			err:  `X.f: unsupported type "date"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "spec.json")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.spec), 0644))
+
+			_, err := generate(path, "api")
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package action
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const ackTokenV1 = "v1"
+
+var ErrInvalidAckToken = errors.New("invalid ack token")
+
+// AckTokenSigner issues ack tokens carrying the sequence number the agent
+// resumes from, signed for the agent with a secret shared by the Fleet
+// Servers. Unlike the action ID tokens they need no lookup and cannot be
+// forged or replayed by another agent. Tokens signed with a previous secret
+// are accepted so the secret can be rotated.
+type AckTokenSigner struct {
+	secrets [][]byte
+}
+
+// NewAckTokenSigner returns the signer using secret, or nil when the secret is
+// empty and tokens are not signed.
+func NewAckTokenSigner(secret string, previous ...string) *AckTokenSigner {
+	if secret == "" {
+		return nil
+	}
+	s := &AckTokenSigner{
+		secrets: [][]byte{[]byte(secret)},
+	}
+	for _, p := range previous {
+		if p != "" {
+			s.secrets = append(s.secrets, []byte(p))
+		}
+	}
+	return s
+}
+
+// IsSignedAckToken tells whether the token was issued by a signer rather than
+// being an action ID.
+func IsSignedAckToken(token string) bool {
+	return strings.HasPrefix(token, ackTokenV1+".")
+}
+
+// Sign returns the token of the agent for the sequence number.
+func (s *AckTokenSigner) Sign(agentId string, seqno int64) string {
+	sn := strconv.FormatInt(seqno, 10)
+	return ackTokenV1 + "." + sn + "." + ackTokenMAC(s.secrets[0], agentId, sn)
+}
+
+// Verify returns the sequence number of the token issued to the agent, or
+// ErrInvalidAckToken.
+func (s *AckTokenSigner) Verify(agentId, token string) (int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != ackTokenV1 {
+		return 0, ErrInvalidAckToken
+	}
+	seqno, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAckToken
+	}
+	for _, secret := range s.secrets {
+		if hmac.Equal([]byte(parts[2]), []byte(ackTokenMAC(secret, agentId, parts[1]))) {
+			return seqno, nil
+		}
+	}
+	return 0, ErrInvalidAckToken
+}
+
+func ackTokenMAC(secret []byte, agentId, seqno string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ackTokenV1))
+	mac.Write([]byte{0})
+	mac.Write([]byte(agentId))
+	mac.Write([]byte{0})
+	mac.Write([]byte(seqno))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,49 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAckTokenSigner(t *testing.T) {
+	assert.Nil(t, NewAckTokenSigner(""))
+
+	s := NewAckTokenSigner("secret")
+	token := s.Sign("agent-1", 42)
+	assert.True(t, IsSignedAckToken(token))
+	assert.False(t, IsSignedAckToken("3d5f2a8e-action-id"))
+
+	seqno, err := s.Verify("agent-1", token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), seqno)
+
+	// Bound to the agent
+	_, err = s.Verify("agent-2", token)
+	assert.Equal(t, ErrInvalidAckToken, err)
+
+	// Tampered sequence number
+	_, err = s.Verify("agent-1", "v1.43"+token[len("v1.42"):])
+	assert.Equal(t, ErrInvalidAckToken, err)
+
+	for _, bad := range []string{"v1.42", "v2.42.sig", "v1.x.sig", "v1.42.sig.extra"} {
+		_, err = s.Verify("agent-1", bad)
+		assert.Equal(t, ErrInvalidAckToken, err, bad)
+	}
+
+	// Rotation; tokens of the previous secret verify, not of others
+	rotated := NewAckTokenSigner("new-secret", "secret")
+	seqno, err = rotated.Verify("agent-1", token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), seqno)
+
+	_, err = NewAckTokenSigner("new-secret").Verify("agent-1", token)
+	assert.Equal(t, ErrInvalidAckToken, err)
+}
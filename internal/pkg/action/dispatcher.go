@@ -8,7 +8,10 @@ import (
 	"context"
 	"sync"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 	"github.com/elastic/fleet-server/v7/internal/pkg/monitor"
 	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
@@ -16,27 +19,51 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+var sharedDispatch = feature.Register("shared_action_dispatch", "Agents receiving the same actions share them instead of each receiving a copy", true)
+
 type Sub struct {
 	agentId string
 	seqNo   sqn.SeqNo
 	ch      chan []model.Action
+
+	// Highest seqno of the actions sent to the agent
+	sent int64
 }
 
+// Ch returns the channel of the actions dispatched to the agent, in delivery
+// order. The actions are shared with the other agents receiving them and must
+// not be modified, unless the shared_action_dispatch feature flag is disabled.
 func (s Sub) Ch() chan []model.Action {
 	return s.ch
 }
 
+// Sent records that the actions up to seqNo were sent to the agent.
+func (s *Sub) Sent(seqNo int64) {
+	if seqNo > s.sent {
+		s.sent = seqNo
+	}
+}
+
 type Dispatcher struct {
-	am monitor.SimpleMonitor
+	am     monitor.SimpleMonitor
+	bulker bulk.Bulk
 
 	mx   sync.RWMutex
 	subs map[string]Sub
+
+	// Highest seqno of the actions of each agent seen since seqNoFrom, the
+	// checkpoint the dispatcher started from.
+	latest    map[string]int64
+	seqNoFrom int64
 }
 
-func NewDispatcher(am monitor.SimpleMonitor) *Dispatcher {
+func NewDispatcher(am monitor.SimpleMonitor, bulker bulk.Bulk) *Dispatcher {
 	return &Dispatcher{
-		am:   am,
-		subs: make(map[string]Sub),
+		am:        am,
+		bulker:    bulker,
+		subs:      make(map[string]Sub),
+		latest:    make(map[string]int64),
+		seqNoFrom: sqn.UndefinedSeqNo,
 	}
 }
 
@@ -58,6 +85,7 @@ func (d *Dispatcher) Subscribe(agentId string, seqNo sqn.SeqNo) *Sub {
 		agentId: agentId,
 		seqNo:   seqNo,
 		ch:      cbCh,
+		sent:    seqNo.Value(),
 	}
 
 	d.mx.Lock()
@@ -70,6 +98,9 @@ func (d *Dispatcher) Subscribe(agentId string, seqNo sqn.SeqNo) *Sub {
 	return &sub
 }
 
+// Unsubscribe removes the subscription of the agent once disconnected. The
+// latest seqno of its actions is forgotten if they were all sent to it; later
+// ones are recorded again.
 func (d *Dispatcher) Unsubscribe(sub *Sub) {
 	if sub == nil {
 		return
@@ -77,6 +108,9 @@ func (d *Dispatcher) Unsubscribe(sub *Sub) {
 
 	d.mx.Lock()
 	delete(d.subs, sub.agentId)
+	if latest, ok := d.latest[sub.agentId]; ok && latest <= sub.sent {
+		delete(d.latest, sub.agentId)
+	}
 	sz := len(d.subs)
 	d.mx.Unlock()
 
@@ -85,30 +119,141 @@ func (d *Dispatcher) Unsubscribe(sub *Sub) {
 
 func (d *Dispatcher) process(ctx context.Context, hits []es.HitT) {
 	// Parse hits into map of agent -> actions
-	// Actions are ordered by sequence
+	// Actions are ordered by sequence; each hit is parsed once and the agents
+	// receiving the same actions share them.
 
-	agentActions := make(map[string][]model.Action)
-	for _, hit := range hits {
+	root := &actionSet{}
+	agentSets := make(map[string]*actionSet)
+	from := int64(sqn.UndefinedSeqNo)
+	for i, hit := range hits {
+		if from == sqn.UndefinedSeqNo || hit.SeqNo-1 < from {
+			from = hit.SeqNo - 1
+		}
 		var action model.Action
 		err := hit.Unmarshal(&action)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to unmarshal action document")
-			break
+			dl.DeadLetter(d.bulker, dl.FleetActions, hit, err)
+			continue
 		}
-		for _, agentId := range action.Agents {
-			arr := agentActions[agentId]
-			actionNoAgents := action
-			actionNoAgents.Agents = nil
-			arr = append(arr, actionNoAgents)
-			agentActions[agentId] = arr
+		agents := action.Agents
+		action.Agents = nil
+		for _, agentId := range agents {
+			set, ok := agentSets[agentId]
+			if !ok {
+				set = root
+			}
+			agentSets[agentId] = set.with(i, &action)
 		}
 	}
+	if len(hits) > 0 {
+		d.recordLatest(from, agentSets)
+	}
 
-	for agentId, actions := range agentActions {
+	shared := sharedDispatch.Enabled()
+	for agentId, set := range agentSets {
+		actions := set.sorted()
+		if !shared {
+			actions = append([]model.Action(nil), actions...)
+		}
 		d.dispatch(ctx, agentId, actions)
 	}
 }
 
+// actionSet is a list of actions shared by the agents receiving them. The
+// sets form a tree: the set of the actions of a set followed by the hit is
+// built once, by the first agent reaching it, for every agent of the set.
+type actionSet struct {
+	actions []model.Action
+	seqNo   int64
+	next    map[int]*actionSet
+	ordered bool
+}
+
+// with returns the set of the actions of s followed by the action of the hit.
+func (s *actionSet) with(hit int, action *model.Action) *actionSet {
+	if next, ok := s.next[hit]; ok {
+		return next
+	}
+	if s.next == nil {
+		s.next = make(map[int]*actionSet)
+	}
+
+	actions := make([]model.Action, len(s.actions), len(s.actions)+1)
+	copy(actions, s.actions)
+	next := &actionSet{
+		actions: append(actions, *action),
+		seqNo:   s.seqNo,
+	}
+	if action.SeqNo > next.seqNo {
+		next.seqNo = action.SeqNo
+	}
+	s.next[hit] = next
+	return next
+}
+
+// sorted returns the actions of the set in delivery order.
+func (s *actionSet) sorted() []model.Action {
+	if !s.ordered {
+		SortByPriority(s.actions)
+		s.ordered = true
+	}
+	return s.actions
+}
+
+// recordLatest records the highest seqno of the actions of each agent; from is
+// the checkpoint the actions follow.
+func (d *Dispatcher) recordLatest(from int64, agentSets map[string]*actionSet) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.seqNoFrom == sqn.UndefinedSeqNo {
+		d.seqNoFrom = from
+	}
+	for agentId, set := range agentSets {
+		if set.seqNo > d.latest[agentId] {
+			d.latest[agentId] = set.seqNo
+		}
+	}
+}
+
+// Pending tells whether actions newer than seqNo were dispatched for the
+// agent. It is only known for seqnos from the checkpoint the dispatcher
+// started from; actions fetched by the monitor but not yet dispatched are not
+// reported.
+func (d *Dispatcher) Pending(agentId string, seqNo int64) (pending bool, known bool) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.seqNoFrom == sqn.UndefinedSeqNo {
+		checkpoint := d.am.GetCheckpoint().Value()
+		if checkpoint == sqn.UndefinedSeqNo {
+			return false, false
+		}
+		d.seqNoFrom = checkpoint
+	}
+	if seqNo < d.seqNoFrom {
+		return false, false
+	}
+	return d.latest[agentId] > seqNo, true
+}
+
+// DispatcherStats are the sizes of the state the dispatcher keeps per agent.
+type DispatcherStats struct {
+	Subscriptions int // agents subscribed
+	Latest        int // agents of which the latest seqno is kept
+}
+
+// Stats returns the sizes of the state kept per agent.
+func (d *Dispatcher) Stats() DispatcherStats {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	return DispatcherStats{
+		Subscriptions: len(d.subs),
+		Latest:        len(d.latest),
+	}
+}
+
 func (d *Dispatcher) getSub(agentId string) (Sub, bool) {
 	d.mx.RLock()
 	sub, ok := d.subs[agentId]
@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
+
+	"github.com/rs/zerolog"
+)
+
+// BenchmarkDispatcherStorm dispatches batches of actions each targeting every
+// connected agent, as when an action is issued to a whole fleet.
+func BenchmarkDispatcherStorm(b *testing.B) {
+	lvl := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	defer zerolog.SetGlobalLevel(lvl)
+
+	for _, nAgents := range []int{100, 10000} {
+		for _, nActions := range []int{1, 5} {
+			b.Run(fmt.Sprintf("agents=%d/actions=%d", nAgents, nActions), func(b *testing.B) {
+				agents := make([]string, nAgents)
+				for i := range agents {
+					agents[i] = fmt.Sprintf("agent-%d", i)
+				}
+
+				d := NewDispatcher(&mockSimpleMonitor{checkpoint: 0}, nil)
+				subs := make([]*Sub, 0, nAgents)
+				for _, agentId := range agents {
+					subs = append(subs, d.Subscribe(agentId, sqn.SeqNo{0}))
+				}
+
+				data := json.RawMessage(`{"version":"8.0.0","source_uri":"https://artifacts.elastic.co/downloads/"}`)
+				hits := make([]es.HitT, 0, nActions)
+				for i := 0; i < nActions; i++ {
+					src, err := json.Marshal(model.Action{ActionId: fmt.Sprintf("action-%d", i), Type: "UPGRADE", Data: data, Agents: agents})
+					if err != nil {
+						b.Fatal(err)
+					}
+					hits = append(hits, es.HitT{Id: fmt.Sprintf("action-%d", i), SeqNo: int64(i + 1), Source: src})
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					d.process(context.Background(), hits)
+
+					b.StopTimer()
+					for _, sub := range subs {
+						<-sub.Ch()
+					}
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
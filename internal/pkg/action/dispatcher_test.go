@@ -0,0 +1,208 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sqn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSimpleMonitor struct {
+	checkpoint int64
+}
+
+func (m *mockSimpleMonitor) GetCheckpoint() sqn.SeqNo      { return sqn.SeqNo{m.checkpoint} }
+func (m *mockSimpleMonitor) Run(ctx context.Context) error { return nil }
+func (m *mockSimpleMonitor) Output() <-chan []es.HitT      { return nil }
+
+func actionHit(t *testing.T, seqNo int64, agents ...string) es.HitT {
+	t.Helper()
+	src, err := json.Marshal(model.Action{ActionId: "action", Agents: agents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return es.HitT{Id: "action", SeqNo: seqNo, Source: src}
+}
+
+func typedActionHit(t *testing.T, seqNo int64, typ string, agents ...string) es.HitT {
+	t.Helper()
+	src, err := json.Marshal(model.Action{ActionId: typ, Type: typ, Agents: agents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return es.HitT{Id: typ, SeqNo: seqNo, Source: src}
+}
+
+func TestDispatcherPriority(t *testing.T) {
+	am := &mockSimpleMonitor{checkpoint: 10}
+	d := NewDispatcher(am, nil)
+	sub := d.Subscribe("agent-1", sqn.SeqNo{10})
+	defer d.Unsubscribe(sub)
+
+	// The monitor delivers the actions in batches in seqno order; each batch
+	// is ordered by priority, keeping the order of the actions of a type
+	batches := [][]es.HitT{
+		{
+			typedActionHit(t, 11, "SETTINGS", "agent-1"),
+			typedActionHit(t, 12, "POLICY_REASSIGN", "agent-1"),
+			typedActionHit(t, 13, "UPGRADE", "agent-1", "agent-2"),
+		},
+		{
+			typedActionHit(t, 14, "SETTINGS", "agent-1"),
+			typedActionHit(t, 15, "UNENROLL", "agent-1"),
+			typedActionHit(t, 16, "UPGRADE", "agent-1"),
+			typedActionHit(t, 17, "SETTINGS", "agent-2"),
+		},
+	}
+	want := [][]int64{
+		{13, 11, 12},
+		{15, 16, 14},
+	}
+	for i, hits := range batches {
+		d.process(context.Background(), hits)
+		select {
+		case actions := <-sub.Ch():
+			assert.Equal(t, want[i], seqNos(actions))
+		default:
+			t.Fatalf("batch %d not dispatched", i)
+		}
+	}
+
+	pending, known := d.Pending("agent-1", 15)
+	assert.True(t, known)
+	assert.True(t, pending)
+	pending, _ = d.Pending("agent-1", 16)
+	assert.False(t, pending)
+}
+
+func TestDispatcherPending(t *testing.T) {
+	am := &mockSimpleMonitor{checkpoint: sqn.UndefinedSeqNo}
+	d := NewDispatcher(am, nil)
+
+	// Nothing is known before the monitor has a checkpoint
+	if _, known := d.Pending("agent-1", 5); known {
+		t.Fatal("expected pending actions to be unknown without a checkpoint")
+	}
+
+	am.checkpoint = 10
+	if pending, known := d.Pending("agent-1", 10); pending || !known {
+		t.Fatalf("pending = %v, known = %v; want no pending actions", pending, known)
+	}
+
+	d.process(context.Background(), []es.HitT{
+		actionHit(t, 11, "agent-1", "agent-2"),
+		actionHit(t, 12, "agent-2"),
+	})
+
+	tests := []struct {
+		agent   string
+		seqNo   int64
+		pending bool
+		known   bool
+	}{
+		{"agent-1", 10, true, true},
+		{"agent-1", 11, false, true},
+		{"agent-2", 11, true, true},
+		{"agent-2", 12, false, true},
+		{"agent-3", 10, false, true},
+		{"agent-1", 9, false, false},
+	}
+	for _, tt := range tests {
+		pending, known := d.Pending(tt.agent, tt.seqNo)
+		if pending != tt.pending || known != tt.known {
+			t.Errorf("Pending(%s, %d) = %v, %v; want %v, %v", tt.agent, tt.seqNo, pending, known, tt.pending, tt.known)
+		}
+	}
+}
+
+func TestDispatcherUnsubscribeForgetsSent(t *testing.T) {
+	am := &mockSimpleMonitor{checkpoint: 10}
+	d := NewDispatcher(am, nil)
+
+	d.process(context.Background(), []es.HitT{
+		actionHit(t, 11, "agent-1", "agent-2"),
+		actionHit(t, 12, "agent-2"),
+	})
+
+	sub1 := d.Subscribe("agent-1", sqn.SeqNo{10})
+	sub1.Sent(11)
+	d.Unsubscribe(sub1)
+
+	// Disconnected before the action of seqno 12 was sent
+	sub2 := d.Subscribe("agent-2", sqn.SeqNo{10})
+	sub2.Sent(11)
+	d.Unsubscribe(sub2)
+
+	if stats := d.Stats(); stats.Latest != 1 {
+		t.Fatalf("latest kept for %d agents; want 1", stats.Latest)
+	}
+	if pending, known := d.Pending("agent-2", 11); !pending || !known {
+		t.Errorf("pending = %v, known = %v; want the action of seqno 12 pending", pending, known)
+	}
+}
+
+func TestDispatcherSharedActions(t *testing.T) {
+	am := &mockSimpleMonitor{checkpoint: 10}
+	d := NewDispatcher(am, nil)
+	subs := make(map[string]*Sub)
+	for _, agentId := range []string{"agent-1", "agent-2", "agent-3"} {
+		subs[agentId] = d.Subscribe(agentId, sqn.SeqNo{10})
+		defer d.Unsubscribe(subs[agentId])
+	}
+
+	d.process(context.Background(), []es.HitT{
+		typedActionHit(t, 11, "SETTINGS", "agent-1", "agent-2", "agent-3"),
+		typedActionHit(t, 12, "UPGRADE", "agent-1", "agent-2"),
+	})
+
+	actions := make(map[string][]model.Action)
+	for agentId, sub := range subs {
+		select {
+		case actions[agentId] = <-sub.Ch():
+		default:
+			t.Fatalf("%s: actions not dispatched", agentId)
+		}
+		for _, a := range actions[agentId] {
+			assert.Nil(t, a.Agents)
+		}
+	}
+
+	// The agents receiving the same actions share them
+	assert.Equal(t, []int64{12, 11}, seqNos(actions["agent-1"]))
+	assert.Same(t, &actions["agent-1"][0], &actions["agent-2"][0])
+	assert.Equal(t, []int64{11}, seqNos(actions["agent-3"]))
+}
+
+func TestDispatcherSharedActionsDisabled(t *testing.T) {
+	disabled := false
+	_, err := feature.Default.Override(sharedDispatch.Name(), &disabled)
+	require.NoError(t, err)
+	defer feature.Default.Override(sharedDispatch.Name(), nil)
+
+	am := &mockSimpleMonitor{checkpoint: 10}
+	d := NewDispatcher(am, nil)
+	sub1 := d.Subscribe("agent-1", sqn.SeqNo{10})
+	defer d.Unsubscribe(sub1)
+	sub2 := d.Subscribe("agent-2", sqn.SeqNo{10})
+	defer d.Unsubscribe(sub2)
+
+	d.process(context.Background(), []es.HitT{
+		typedActionHit(t, 11, "SETTINGS", "agent-1", "agent-2"),
+	})
+
+	actions1, actions2 := <-sub1.Ch(), <-sub2.Ch()
+	assert.Equal(t, actions1, actions2)
+	assert.NotSame(t, &actions1[0], &actions2[0])
+}
@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package action
+
+import (
+	"sort"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+const (
+	// PriorityRoutine is the priority of the actions of types without one.
+	PriorityRoutine int64 = 0
+
+	// PriorityHigh is the priority of the actions changing the agent itself
+	// and of the security response actions.
+	PriorityHigh int64 = 100
+)
+
+// typePriorities are the priorities of the action types delivered ahead of
+// the routine ones.
+var typePriorities = map[string]int64{
+	"UNENROLL": PriorityHigh,
+	"UPGRADE":  PriorityHigh,
+}
+
+// controlTypes are the types of the actions controlling the agent itself.
+// They are delivered however many actions are pending.
+var controlTypes = []string{
+	"UNENROLL",
+	"UPGRADE",
+	"POLICY_REASSIGN",
+	"POLICY_DELETED",
+	"SETTINGS",
+}
+
+// ControlTypes returns the types of the actions controlling the agent itself,
+// never skipped when too many actions are pending.
+func ControlTypes() []string {
+	return append([]string(nil), controlTypes...)
+}
+
+// inputPriorities are the priorities of the INPUT_ACTION actions by input.
+var inputPriorities = map[string]int64{
+	"endpoint": PriorityHigh,
+}
+
+// Priority returns the priority of the action, its own or the one of its type.
+func Priority(a *model.Action) int64 {
+	if a.Priority != 0 {
+		return a.Priority
+	}
+	if a.Type == "INPUT_ACTION" {
+		if p, ok := inputPriorities[a.InputType]; ok {
+			return p
+		}
+		return PriorityRoutine
+	}
+	if p, ok := typePriorities[a.Type]; ok {
+		return p
+	}
+	return PriorityRoutine
+}
+
+// SortByPriority orders the actions for delivery: higher priority first and
+// otherwise by sequence number. Actions of the same type, and of the same input
+// for input actions, are never reordered; an action raises the priority of the
+// earlier actions of its type so they are delivered ahead of it.
+func SortByPriority(actions []model.Action) {
+	if len(actions) < 2 {
+		return
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].SeqNo < actions[j].SeqNo
+	})
+
+	effective := make([]int64, len(actions))
+	typeMax := make(map[string]int64)
+	for i := len(actions) - 1; i >= 0; i-- {
+		p := Priority(&actions[i])
+		key := actions[i].Type + "/" + actions[i].InputType
+		if max, ok := typeMax[key]; ok && max > p {
+			p = max
+		}
+		typeMax[key] = p
+		effective[i] = p
+	}
+	sort.Stable(byPriority{actions, effective})
+}
+
+type byPriority struct {
+	actions  []model.Action
+	priority []int64
+}
+
+func (s byPriority) Len() int           { return len(s.actions) }
+func (s byPriority) Less(i, j int) bool { return s.priority[i] > s.priority[j] }
+func (s byPriority) Swap(i, j int) {
+	s.actions[i], s.actions[j] = s.actions[j], s.actions[i]
+	s.priority[i], s.priority[j] = s.priority[j], s.priority[i]
+}
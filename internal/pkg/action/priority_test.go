@@ -0,0 +1,105 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package action
+
+import (
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAction(seqNo int64, typ, inputType string, priority int64) model.Action {
+	return model.Action{
+		ESDocument: model.ESDocument{SeqNo: seqNo},
+		Type:       typ,
+		InputType:  inputType,
+		Priority:   priority,
+	}
+}
+
+func seqNos(actions []model.Action) []int64 {
+	res := make([]int64, 0, len(actions))
+	for _, a := range actions {
+		res = append(res, a.SeqNo)
+	}
+	return res
+}
+
+func TestPriority(t *testing.T) {
+	tests := []struct {
+		action model.Action
+		want   int64
+	}{
+		{testAction(1, "SETTINGS", "", 0), PriorityRoutine},
+		{testAction(1, "UNENROLL", "", 0), PriorityHigh},
+		{testAction(1, "UPGRADE", "", 0), PriorityHigh},
+		{testAction(1, "INPUT_ACTION", "endpoint", 0), PriorityHigh},
+		{testAction(1, "INPUT_ACTION", "osquery", 0), PriorityRoutine},
+		{testAction(1, "SETTINGS", "", 5), 5},
+		{testAction(1, "UNENROLL", "", -1), -1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Priority(&tt.action), "%s/%s", tt.action.Type, tt.action.InputType)
+	}
+}
+
+func TestSortByPriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []model.Action
+		want    []int64
+	}{
+		{
+			name: "routine in seqno order",
+			actions: []model.Action{
+				testAction(3, "SETTINGS", "", 0),
+				testAction(1, "SETTINGS", "", 0),
+				testAction(2, "INPUT_ACTION", "osquery", 0),
+			},
+			want: []int64{1, 2, 3},
+		},
+		{
+			name: "high priority first",
+			actions: []model.Action{
+				testAction(1, "SETTINGS", "", 0),
+				testAction(2, "INPUT_ACTION", "osquery", 0),
+				testAction(3, "UPGRADE", "", 0),
+				testAction(4, "INPUT_ACTION", "endpoint", 0),
+				testAction(5, "UNENROLL", "", 0),
+			},
+			want: []int64{3, 4, 5, 1, 2},
+		},
+		{
+			name: "same type keeps its order",
+			actions: []model.Action{
+				testAction(1, "SETTINGS", "", 0),
+				testAction(2, "POLICY_REASSIGN", "", 0),
+				testAction(3, "SETTINGS", "", 50),
+				testAction(4, "UPGRADE", "", 0),
+			},
+			// the first SETTINGS action is raised with the second one
+			want: []int64{4, 1, 3, 2},
+		},
+		{
+			name: "explicit priorities",
+			actions: []model.Action{
+				testAction(1, "UPGRADE", "", 0),
+				testAction(2, "SETTINGS", "", 200),
+				testAction(3, "POLICY_REASSIGN", "", -10),
+				testAction(4, "DIAGNOSTICS", "", 0),
+			},
+			want: []int64{2, 1, 4, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SortByPriority(tt.actions)
+			assert.Equal(t, tt.want, seqNos(tt.actions))
+		})
+	}
+}
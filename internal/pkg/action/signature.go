@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package action
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidActionSignature = errors.New("invalid action signature")
+
+// SignatureVerifier verifies the signatures of the actions by their writer:
+// the ECDSA SHA-256 signature, ASN.1 encoded, of the JSON of the signed fields
+// of the action, both base64 encoded.
+type SignatureVerifier struct {
+	key *ecdsa.PublicKey
+}
+
+// NewSignatureVerifier returns the verifier of the ECDSA public key, PEM
+// encoded in PKIX form.
+func NewSignatureVerifier(pemKey string) (*SignatureVerifier, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("no PEM encoded public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key must be ECDSA, not %T", pub)
+	}
+	return &SignatureVerifier{key: key}, nil
+}
+
+// Verify checks the signature of the data and that the data signs the action
+// of the ID and type. It returns ErrInvalidActionSignature otherwise.
+func (v *SignatureVerifier) Verify(actionId, actionType, data, signature string) error {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("%w: data is not base64", ErrInvalidActionSignature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: signature is not base64", ErrInvalidActionSignature)
+	}
+	digest := sha256.Sum256(raw)
+	if !ecdsa.VerifyASN1(v.key, digest[:], sig) {
+		return ErrInvalidActionSignature
+	}
+
+	var signed struct {
+		ActionId string `json:"action_id"`
+		Type     string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &signed); err != nil {
+		return fmt.Errorf("%w: data is not JSON", ErrInvalidActionSignature)
+	}
+	if signed.ActionId != actionId || signed.Type != actionType {
+		return fmt.Errorf("%w: data signs another action", ErrInvalidActionSignature)
+	}
+	return nil
+}
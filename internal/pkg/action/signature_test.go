@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package action
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	v, err := NewSignatureVerifier(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	require.NoError(t, err)
+
+	sign := func(data string) (string, string) {
+		digest := sha256.Sum256([]byte(data))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString([]byte(data)), base64.StdEncoding.EncodeToString(sig)
+	}
+
+	data, sig := sign(`{"action_id":"a1","type":"UPGRADE","data":{"version":"8.0.0"}}`)
+	assert.NoError(t, v.Verify("a1", "UPGRADE", data, sig))
+
+	// Signs another action
+	err = v.Verify("a2", "UPGRADE", data, sig)
+	assert.True(t, errors.Is(err, ErrInvalidActionSignature))
+
+	// Tampered data
+	tampered := base64.StdEncoding.EncodeToString([]byte(`{"action_id":"a1","type":"UPGRADE","data":{"version":"9.0.0"}}`))
+	err = v.Verify("a1", "UPGRADE", tampered, sig)
+	assert.True(t, errors.Is(err, ErrInvalidActionSignature))
+
+	err = v.Verify("a1", "UPGRADE", data, "not base64!")
+	assert.True(t, errors.Is(err, ErrInvalidActionSignature))
+
+	_, err = NewSignatureVerifier("not a key")
+	assert.Error(t, err)
+}
@@ -52,3 +52,8 @@ func (r *TokenResolver) Resolve(ctx context.Context, token string) (seqno int64,
 
 	return
 }
+
+// Len returns the count of the tokens cached.
+func (r *TokenResolver) Len() int {
+	return r.cache.Len()
+}
@@ -5,16 +5,27 @@
 package apikey
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"unicode/utf8"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/feature"
 )
 
 const (
 	authPrefix = "ApiKey "
+
+	// Elasticsearch API key tokens are about 56 bytes long
+	kTokenBufSize = 128
+
+	// Interned tokens; the table is emptied once full
+	kMaxInternedTokens = 1 << 16
 )
 
 var (
@@ -23,32 +34,73 @@ var (
 	ErrMalformedToken  = errors.New("malformed token")
 	ErrInvalidToken    = errors.New("token not valid utf8")
 	ErrApiKeyNotFound  = errors.New("api key not found")
+	ErrUnauthorized    = errors.New("api key rejected by elasticsearch")
 )
 
 var AuthKey = http.CanonicalHeaderKey("Authorization")
 
+var interning = feature.Register("api_key_interning", "Intern the API keys parsed from the tokens of the requests", true)
+
 type ApiKey struct {
 	Id  string
 	Key string
 }
 
+// NewApiKeyFromToken parses the base64 encoded id:key token. The keys of the
+// recent tokens are interned: agents present the same token on every request,
+// so parsing it again is a lookup that does not allocate. The returned key may
+// be shared and must not be modified. Interning is gated by the
+// api_key_interning feature flag.
 func NewApiKeyFromToken(token string) (*ApiKey, error) {
-	d, err := base64.StdEncoding.DecodeString(token)
+	if !interning.Enabled() {
+		return parseToken(token)
+	}
+	h, ok := hashToken(token)
+	if !ok {
+		return parseToken(token)
+	}
+	if k, ok := tokens.get(h); ok {
+		return k, nil
+	}
+
+	k, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	tokens.put(h, k)
+	return k, nil
+}
+
+// parseToken decodes the token in a buffer on the stack when it fits; the id
+// and key share the single string copied out of it.
+func parseToken(token string) (*ApiKey, error) {
+	var srcBuf [kTokenBufSize]byte
+	var dstBuf [kTokenBufSize]byte
+	src, dst := srcBuf[:], dstBuf[:]
+	if len(token) > len(src) {
+		src = make([]byte, len(token))
+		dst = make([]byte, base64.StdEncoding.DecodedLen(len(token)))
+	}
+	src = src[:copy(src, token)]
+
+	n, err := base64.StdEncoding.Decode(dst, src)
 	if err != nil {
 		return nil, err
 	}
+	d := dst[:n]
 	if !utf8.Valid(d) {
 		return nil, ErrInvalidToken
 	}
-	s := strings.Split(string(d), ":")
-	if len(s) != 2 {
+	i := bytes.IndexByte(d, ':')
+	if i < 0 || bytes.IndexByte(d[i+1:], ':') >= 0 {
 		return nil, ErrMalformedToken
 	}
 
 	// interpret id:key
+	s := string(d)
 	apiKey := ApiKey{
-		Id:  s[0],
-		Key: s[1],
+		Id:  s[:i],
+		Key: s[i+1:],
 	}
 
 	return &apiKey, nil
@@ -76,3 +128,55 @@ func ExtractAPIKey(r *http.Request) (*ApiKey, error) {
 	apiKeyStr = strings.TrimSpace(apiKeyStr)
 	return NewApiKeyFromToken(apiKeyStr)
 }
+
+// tokenHash is the SHA-256 hash of a token, so the tokens themselves are not
+// kept by the table.
+type tokenHash [sha256.Size]byte
+
+// hashToken hashes the token in a buffer on the stack. The tokens longer than
+// kTokenBufSize are not Elasticsearch API keys and are not interned.
+func hashToken(token string) (tokenHash, bool) {
+	if len(token) > kTokenBufSize {
+		return tokenHash{}, false
+	}
+	var buf [kTokenBufSize]byte
+	n := copy(buf[:], token)
+	return sha256.Sum256(buf[:n]), true
+}
+
+// tokenTable interns the keys of the tokens parsed, by the hash of the token.
+// It holds at most max keys.
+type tokenTable struct {
+	mut  sync.RWMutex
+	keys map[tokenHash]*ApiKey
+	max  int
+}
+
+var tokens = newTokenTable(kMaxInternedTokens)
+
+func newTokenTable(max int) *tokenTable {
+	return &tokenTable{
+		keys: make(map[tokenHash]*ApiKey),
+		max:  max,
+	}
+}
+
+func (t *tokenTable) get(h tokenHash) (*ApiKey, bool) {
+	t.mut.RLock()
+	k, ok := t.keys[h]
+	t.mut.RUnlock()
+	return k, ok
+}
+
+// put interns the key of the token. Tokens are not evicted one by one; once
+// full the table starts over, so a flood of distinct tokens costs a parse per
+// request as without the table.
+func (t *tokenTable) put(h tokenHash, k *ApiKey) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if len(t.keys) >= t.max {
+		t.keys = make(map[tokenHash]*ApiKey)
+	}
+	t.keys[h] = k
+}
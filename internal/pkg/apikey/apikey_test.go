@@ -8,9 +8,12 @@ package apikey
 
 import (
 	"encoding/base64"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMonitorLeadership(t *testing.T) {
@@ -21,3 +24,80 @@ func TestMonitorLeadership(t *testing.T) {
 	assert.Equal(t, *apiKey, ApiKey{" foo", "bar"})
 	assert.Equal(t, token, apiKey.Token())
 }
+
+func BenchmarkExtractAPIKey(b *testing.B) {
+	token := base64.StdEncoding.EncodeToString([]byte("dGVzdC1hcGkta2V5LWlk:c2VjcmV0LWtleS12YWx1ZQ"))
+	r := httptest.NewRequest("POST", "/api/fleet/agents/agent-1/checkin", nil)
+	r.Header.Set(AuthKey, authPrefix+token)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ExtractAPIKey(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNewApiKeyFromToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		key   *ApiKey
+		err   error
+	}{
+		{"valid", base64.StdEncoding.EncodeToString([]byte("id:key")), &ApiKey{"id", "key"}, nil},
+		{"empty key", base64.StdEncoding.EncodeToString([]byte("id:")), &ApiKey{"id", ""}, nil},
+		{"long", base64.StdEncoding.EncodeToString([]byte("id:" + strings.Repeat("k", 500))), &ApiKey{"id", strings.Repeat("k", 500)}, nil},
+		{"no separator", base64.StdEncoding.EncodeToString([]byte("idkey")), nil, ErrMalformedToken},
+		{"two separators", base64.StdEncoding.EncodeToString([]byte("id:key:more")), nil, ErrMalformedToken},
+		{"not utf8", base64.StdEncoding.EncodeToString([]byte("id:\xff")), nil, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := NewApiKeyFromToken(tt.token)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+
+	_, err := NewApiKeyFromToken("not base64!")
+	assert.Error(t, err)
+}
+
+func TestTokenTable(t *testing.T) {
+	hash := func(token string) tokenHash {
+		h, ok := hashToken(token)
+		require.True(t, ok)
+		return h
+	}
+
+	table := newTokenTable(2)
+	table.put(hash("a"), &ApiKey{"a", "1"})
+	table.put(hash("b"), &ApiKey{"b", "2"})
+
+	k, ok := table.get(hash("a"))
+	assert.True(t, ok)
+	assert.Equal(t, &ApiKey{"a", "1"}, k)
+
+	// Full; starts over
+	table.put(hash("c"), &ApiKey{"c", "3"})
+	_, ok = table.get(hash("a"))
+	assert.False(t, ok)
+	_, ok = table.get(hash("c"))
+	assert.True(t, ok)
+
+	// Not an Elasticsearch API key; not interned
+	_, ok = hashToken(strings.Repeat("k", kTokenBufSize+1))
+	assert.False(t, ok)
+}
+
+func BenchmarkParseToken(b *testing.B) {
+	token := base64.StdEncoding.EncodeToString([]byte("dGVzdC1hcGkta2V5LWlk:c2VjcmV0LWtleS12YWx1ZQ"))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseToken(token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
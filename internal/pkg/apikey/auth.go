@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
@@ -48,6 +49,9 @@ func (k ApiKey) Authenticate(ctx context.Context, es *elasticsearch.Client) (*Se
 	}
 
 	if res.IsError() {
+		if res.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("fail Auth: %w: %s", ErrUnauthorized, res.String())
+		}
 		return nil, fmt.Errorf("fail Auth: %s", res.String())
 	}
 
@@ -22,13 +22,17 @@ type Metadata struct {
 	Managed   bool   `json:"managed,omitempty"`
 	ManagedBy string `json:"managed_by,omitempty"`
 	Type      string `json:"type,omitempty"`
+
+	// Kibana spaces of the agent; the default space when empty
+	Namespaces []string `json:"namespaces,omitempty"`
 }
 
-func NewMetadata(agentId string, typ Type) Metadata {
+func NewMetadata(agentId string, typ Type, namespaces ...string) Metadata {
 	return Metadata{
-		AgentId:   agentId,
-		Managed:   true,
-		ManagedBy: ManagedByFleetServer,
-		Type:      typ.String(),
+		AgentId:    agentId,
+		Managed:    true,
+		ManagedBy:  ManagedByFleetServer,
+		Type:       typ.String(),
+		Namespaces: namespaces,
 	}
 }
@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+type IndexPrivileges struct {
+	Names      []string `json:"names"`
+	Privileges []string `json:"privileges"`
+}
+
+// HasPrivileges checks that the API key is granted all of the requested
+// index privileges. The request is executed with the API key credentials.
+func (k ApiKey) HasPrivileges(ctx context.Context, es *elasticsearch.Client, privs ...IndexPrivileges) (bool, error) {
+
+	body, err := json.Marshal(struct {
+		Index []IndexPrivileges `json:"index"`
+	}{privs})
+	if err != nil {
+		return false, err
+	}
+
+	token := fmt.Sprintf("%s%s", authPrefix, k.Token())
+
+	req := esapi.SecurityHasPrivilegesRequest{
+		Body:   bytes.NewReader(body),
+		Header: map[string][]string{AuthKey: []string{token}},
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return false, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	if res.IsError() {
+		return false, fmt.Errorf("fail HasPrivileges: %s", res.String())
+	}
+
+	var resp struct {
+		HasAllRequested bool `json:"has_all_requested"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return false, fmt.Errorf("HasPrivileges: error parsing response body: %w", err)
+	}
+
+	return resp.HasAllRequested, nil
+}
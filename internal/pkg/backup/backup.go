@@ -0,0 +1,432 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package backup exports the state of the fleet held in the .fleet-* indices
+// to an archive and restores it, possibly into another cluster.
+//
+// The archive is a gzipped tar holding manifest.json, then a file of NDJSON
+// per index, <index>.ndjson, with a document per line: {"_id":..., "_source":...}.
+// The API keys are left out of the documents.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Version is the version of the archive format.
+	Version = 1
+
+	kManifest    = "manifest.json"
+	kIndexSuffix = ".ndjson"
+
+	kPageSize       = 1000
+	kRestoreBatch   = 500
+	kRestoreWorkers = 32
+
+	// kMaxLine bounds the size of a document of the archive.
+	kMaxLine = 100 * 1024 * 1024
+)
+
+var (
+	ErrNoManifest      = errors.New("archive has no manifest")
+	ErrVersion         = errors.New("unsupported archive version")
+	ErrIndexNotAllowed = errors.New("index is not a fleet index")
+)
+
+// DefaultIndices are the indices Fleet Server depends on: the agents, the
+// enrollment keys, the policies and their leaders.
+var DefaultIndices = []string{
+	dl.FleetAgents,
+	dl.FleetEnrollmentAPIKeys,
+	dl.FleetPolicies,
+	dl.FleetPoliciesLeader,
+}
+
+// Manifest describes the archive.
+type Manifest struct {
+	Version       int             `json:"version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ServerVersion string          `json:"server_version"`
+	Indices       []IndexManifest `json:"indices"`
+}
+
+// IndexManifest is the number of documents of an index in the archive.
+type IndexManifest struct {
+	Name string `json:"name"`
+	Docs int    `json:"docs"`
+}
+
+// secretFields are the fields of the documents of an index left out of the
+// archive: the API keys, of which only the ids are exported.
+var secretFields = map[string][]string{
+	dl.FleetAgents:            {dl.FieldDefaultApiKey},
+	dl.FleetEnrollmentAPIKeys: {dl.FieldApiKey},
+}
+
+// Doc is a document of the archive.
+type Doc struct {
+	Id     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+// checkIndex verifies index is one of the Fleet indices. The archive holds
+// them under their names; the bulker reads and writes them where the index
+// resolver stores them, so an archive restores into Fleet Servers of another
+// suffix.
+func checkIndex(index string) error {
+	for _, name := range dl.Indices {
+		if index == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrIndexNotAllowed, index)
+}
+
+// Export writes the documents of the indices to w as an archive; the indices
+// that do not exist are exported empty. Each index is read at a point in time.
+func Export(ctx context.Context, bulker bulk.Bulk, w io.Writer, serverVersion string, indices []string) (Manifest, error) {
+	m := Manifest{
+		Version:       Version,
+		CreatedAt:     time.Now().UTC(),
+		ServerVersion: serverVersion,
+	}
+
+	// The size of a file is written before its content in a tar archive, so
+	// the documents are spooled to temporary files first.
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	for _, index := range indices {
+		if err := checkIndex(index); err != nil {
+			return m, err
+		}
+		f, err := ioutil.TempFile("", "fleet-export-*"+kIndexSuffix)
+		if err != nil {
+			return m, err
+		}
+		files = append(files, f)
+
+		n, err := exportIndex(ctx, bulker, index, f)
+		if err != nil {
+			return m, fmt.Errorf("export %s: %w", index, err)
+		}
+		m.Indices = append(m.Indices, IndexManifest{Name: index, Docs: n})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := writeEntry(tw, kManifest, m.CreatedAt, int64(len(data)), strings.NewReader(string(data))); err != nil {
+		return m, err
+	}
+	for i, f := range files {
+		size, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return m, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return m, err
+		}
+		if err := writeEntry(tw, m.Indices[i].Name+kIndexSuffix, m.CreatedAt, size, f); err != nil {
+			return m, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+func writeEntry(tw *tar.Writer, name string, modTime time.Time, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, r, size)
+	return err
+}
+
+func exportIndex(ctx context.Context, bulker bulk.Bulk, index string, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	err := dl.ForEachPage(ctx, bulker, index, kPageSize, func(root *dsl.Node) {
+		root.Query().MatchAll()
+	}, func(hits []es.HitT) error {
+		for _, hit := range hits {
+			src, err := stripSecrets(index, hit.Source)
+			if err != nil {
+				return fmt.Errorf("document %s: %w", hit.Id, err)
+			}
+			if err := enc.Encode(Doc{Id: hit.Id, Source: src}); err != nil {
+				return err
+			}
+		}
+		n += len(hits)
+		return nil
+	})
+	if errors.Is(err, es.ErrIndexNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// stripSecrets removes the secret fields of the index from the source.
+func stripSecrets(index string, source json.RawMessage) (json.RawMessage, error) {
+	fields := secretFields[index]
+	if len(fields) == 0 {
+		return source, nil
+	}
+
+	var src map[string]json.RawMessage
+	if err := json.Unmarshal(source, &src); err != nil {
+		return nil, err
+	}
+	stripped := false
+	for _, field := range fields {
+		if _, ok := src[field]; ok {
+			delete(src, field)
+			stripped = true
+		}
+	}
+	if !stripped {
+		return source, nil
+	}
+	return json.Marshal(src)
+}
+
+// RestoreOptions select what is restored and how.
+//
+// PolicyIds maps the ids of the policies of the archive to those they have in
+// the cluster restored into, such as when Kibana created them again with new
+// ids; the policy_id of every document and the ids of the policy leaders are
+// rewritten. Existing documents are kept unless Overwrite is set.
+type RestoreOptions struct {
+	Indices   []string
+	PolicyIds map[string]string
+	Overwrite bool
+}
+
+// IndexResult is the outcome of the restore of an index: the documents of the
+// archive, those restored and those skipped as they existed already.
+type IndexResult struct {
+	Name     string
+	Docs     int
+	Restored int
+	Existing int
+}
+
+// Restore writes the documents of the archive read from r. Only the indices
+// of opts are restored, all those of the archive when it has none.
+func Restore(ctx context.Context, bulker bulk.Bulk, r io.Reader, opts RestoreOptions) (Manifest, []IndexResult, error) {
+	var m Manifest
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err == io.EOF || (err == nil && hdr.Name != kManifest) {
+		return m, nil, ErrNoManifest
+	}
+	if err != nil {
+		return m, nil, err
+	}
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return m, nil, fmt.Errorf("read manifest: %w", err)
+	}
+	if m.Version != Version {
+		return m, nil, fmt.Errorf("%w: %d", ErrVersion, m.Version)
+	}
+
+	selected := make(map[string]bool, len(opts.Indices))
+	for _, index := range opts.Indices {
+		selected[index] = true
+	}
+
+	var results []IndexResult
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, results, err
+		}
+		index := strings.TrimSuffix(hdr.Name, kIndexSuffix)
+		if index == hdr.Name {
+			continue
+		}
+		if err := checkIndex(index); err != nil {
+			return m, results, err
+		}
+		if len(selected) > 0 && !selected[index] {
+			continue
+		}
+
+		res, err := restoreIndex(ctx, bulker, index, tr, opts)
+		results = append(results, res)
+		if err != nil {
+			return m, results, fmt.Errorf("restore %s: %w", index, err)
+		}
+	}
+	return m, results, nil
+}
+
+func restoreIndex(ctx context.Context, bulker bulk.Bulk, index string, r io.Reader, opts RestoreOptions) (IndexResult, error) {
+	res := IndexResult{Name: index}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), kMaxLine)
+
+	batch := make([]Doc, 0, kRestoreBatch)
+	flush := func() error {
+		restored, existing, err := restoreBatch(ctx, bulker, index, batch, opts.Overwrite)
+		res.Restored += restored
+		res.Existing += existing
+		batch = batch[:0]
+		return err
+	}
+
+	for sc.Scan() {
+		var doc Doc
+		if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+			return res, fmt.Errorf("document %d: %w", res.Docs+1, err)
+		}
+		res.Docs++
+		if err := remapPolicies(index, &doc, opts.PolicyIds); err != nil {
+			return res, fmt.Errorf("document %s: %w", doc.Id, err)
+		}
+		if batch = append(batch, doc); len(batch) == kRestoreBatch {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return res, err
+	}
+	return res, flush()
+}
+
+// restoreBatch writes the documents with kRestoreWorkers concurrent writes,
+// so they share bulk requests.
+func restoreBatch(ctx context.Context, bulker bulk.Bulk, index string, docs []Doc, overwrite bool) (int, int, error) {
+	existing := make([]bool, len(docs))
+
+	next := make(chan int)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(next)
+		for i := range docs {
+			select {
+			case next <- i:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	for w := 0; w < kRestoreWorkers; w++ {
+		g.Go(func() error {
+			for i := range next {
+				var err error
+				if overwrite {
+					_, err = bulker.Index(gctx, index, docs[i].Id, docs[i].Source)
+				} else {
+					_, err = bulker.Create(gctx, index, docs[i].Id, docs[i].Source)
+				}
+				if errors.Is(err, es.ErrElasticVersionConflict) {
+					existing[i] = true
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+
+	n := 0
+	for _, e := range existing {
+		if e {
+			n++
+		}
+	}
+	if err != nil {
+		return 0, n, err
+	}
+	return len(docs) - n, n, nil
+}
+
+// remapPolicies rewrites the policy ids of the document.
+func remapPolicies(index string, doc *Doc, ids map[string]string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if id, ok := ids[doc.Id]; ok && index == dl.FleetPoliciesLeader {
+		doc.Id = id
+	}
+
+	var src map[string]json.RawMessage
+	if err := json.Unmarshal(doc.Source, &src); err != nil {
+		return err
+	}
+	var policyId string
+	if raw, ok := src[dl.FieldPolicyId]; !ok || json.Unmarshal(raw, &policyId) != nil {
+		return nil
+	}
+	id, ok := ids[policyId]
+	if !ok {
+		return nil
+	}
+	raw, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	src[dl.FieldPolicyId] = raw
+	doc.Source, err = json.Marshal(src)
+	return err
+}
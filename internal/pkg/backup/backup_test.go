@@ -0,0 +1,192 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBulk struct {
+	bulk.Bulk
+	mut  sync.Mutex
+	docs map[string]string
+}
+
+func (m *mockBulk) Create(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) (string, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.docs[index+"/"+id]; ok {
+		return "", &es.ErrVersionConflict{Index: index, Id: id}
+	}
+	m.docs[index+"/"+id] = string(body)
+	return id, nil
+}
+
+func (m *mockBulk) Index(ctx context.Context, index, id string, body []byte, opts ...bulk.Opt) (string, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.docs[index+"/"+id] = string(body)
+	return id, nil
+}
+
+func writeArchive(t *testing.T, m Manifest, files map[string][]Doc) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.NoError(t, writeEntry(tw, kManifest, time.Now(), int64(len(data)), bytes.NewReader(data)))
+
+	for _, index := range m.Indices {
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, doc := range files[index.Name] {
+			require.NoError(t, enc.Encode(doc))
+		}
+		require.NoError(t, writeEntry(tw, index.Name+kIndexSuffix, time.Now(), int64(body.Len()), &body))
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func testArchive(t *testing.T) []byte {
+	m := Manifest{
+		Version:       Version,
+		ServerVersion: "8.0.0",
+		Indices: []IndexManifest{
+			{Name: dl.FleetAgents, Docs: 2},
+			{Name: dl.FleetPoliciesLeader, Docs: 1},
+		},
+	}
+	return writeArchive(t, m, map[string][]Doc{
+		dl.FleetAgents: {
+			{Id: "a1", Source: json.RawMessage(`{"active":true,"policy_id":"p1"}`)},
+			{Id: "a2", Source: json.RawMessage(`{"active":true,"policy_id":"p2"}`)},
+		},
+		dl.FleetPoliciesLeader: {
+			{Id: "p1", Source: json.RawMessage(`{"server":{"id":"s1"}}`)},
+		},
+	})
+}
+
+func TestRestore(t *testing.T) {
+	bulker := &mockBulk{docs: map[string]string{
+		dl.FleetAgents + "/a2": `{"active":false}`,
+	}}
+
+	opts := RestoreOptions{PolicyIds: map[string]string{"p1": "new-p1"}}
+	m, results, err := Restore(context.Background(), bulker, bytes.NewReader(testArchive(t)), opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, "8.0.0", m.ServerVersion)
+	assert.Equal(t, []IndexResult{
+		{Name: dl.FleetAgents, Docs: 2, Restored: 1, Existing: 1},
+		{Name: dl.FleetPoliciesLeader, Docs: 1, Restored: 1},
+	}, results)
+
+	assert.JSONEq(t, `{"active":true,"policy_id":"new-p1"}`, bulker.docs[dl.FleetAgents+"/a1"])
+	assert.JSONEq(t, `{"active":false}`, bulker.docs[dl.FleetAgents+"/a2"])
+	assert.JSONEq(t, `{"server":{"id":"s1"}}`, bulker.docs[dl.FleetPoliciesLeader+"/new-p1"])
+}
+
+func TestRestoreOverwriteIndices(t *testing.T) {
+	bulker := &mockBulk{docs: map[string]string{
+		dl.FleetAgents + "/a2": `{"active":false}`,
+	}}
+
+	opts := RestoreOptions{Indices: []string{dl.FleetAgents}, Overwrite: true}
+	_, results, err := Restore(context.Background(), bulker, bytes.NewReader(testArchive(t)), opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []IndexResult{{Name: dl.FleetAgents, Docs: 2, Restored: 2}}, results)
+	assert.JSONEq(t, `{"active":true,"policy_id":"p2"}`, bulker.docs[dl.FleetAgents+"/a2"])
+	assert.Len(t, bulker.docs, 2)
+}
+
+func TestRestoreBatch(t *testing.T) {
+	bulker := &mockBulk{docs: map[string]string{
+		dl.FleetAgents + "/a7": `{"active":false}`,
+	}}
+
+	docs := make([]Doc, 3*kRestoreWorkers)
+	for i := range docs {
+		docs[i] = Doc{Id: fmt.Sprintf("a%d", i), Source: json.RawMessage(`{"active":true}`)}
+	}
+	restored, existing, err := restoreBatch(context.Background(), bulker, dl.FleetAgents, docs, false)
+	require.NoError(t, err)
+	assert.Equal(t, len(docs)-1, restored)
+	assert.Equal(t, 1, existing)
+	assert.Len(t, bulker.docs, len(docs))
+}
+
+func TestStripSecrets(t *testing.T) {
+	src, err := stripSecrets(dl.FleetEnrollmentAPIKeys, json.RawMessage(`{"api_key":"secret","api_key_id":"k1","active":true}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"api_key_id":"k1","active":true}`, string(src))
+
+	src, err = stripSecrets(dl.FleetAgents, json.RawMessage(`{"default_api_key":"k2:secret","default_api_key_id":"k2"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"default_api_key_id":"k2"}`, string(src))
+
+	// Kept as is when there is nothing to strip
+	raw := json.RawMessage(`{"policy_id":"p1"}`)
+	src, err = stripSecrets(dl.FleetPolicies, raw)
+	require.NoError(t, err)
+	assert.Equal(t, raw, src)
+}
+
+func TestRestoreErrors(t *testing.T) {
+	ctx := context.Background()
+	bulker := &mockBulk{docs: make(map[string]string)}
+
+	_, _, err := Restore(ctx, bulker, bytes.NewReader(writeArchive(t, Manifest{Version: 2}, nil)), RestoreOptions{})
+	assert.True(t, errors.Is(err, ErrVersion))
+
+	archive := writeArchive(t, Manifest{
+		Version: Version,
+		Indices: []IndexManifest{{Name: ".security"}},
+	}, nil)
+	_, _, err = Restore(ctx, bulker, bytes.NewReader(archive), RestoreOptions{})
+	assert.True(t, errors.Is(err, ErrIndexNotAllowed))
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	require.NoError(t, tar.NewWriter(gz).Close())
+	require.NoError(t, gz.Close())
+	_, _, err = Restore(ctx, bulker, &buf, RestoreOptions{})
+	assert.True(t, errors.Is(err, ErrNoManifest))
+
+	assert.Empty(t, bulker.docs)
+}
+
+func TestCheckIndex(t *testing.T) {
+	assert.NoError(t, checkIndex(dl.FleetAgents))
+	assert.Error(t, checkIndex("../.fleet-agents"))
+	assert.Error(t, checkIndex(".fleet-agents/x"))
+	assert.Error(t, checkIndex("agents"))
+	// Named as resolved rather than by its name
+	assert.Error(t, checkIndex(".fleet-agents-blue"))
+}
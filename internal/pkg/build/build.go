@@ -0,0 +1,15 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package build describes the build of the binary. Its variables are set at
+// link time, see the LDFLAGS of the Makefile; they are empty otherwise.
+package build
+
+var (
+	// Commit is the git commit the binary is built from.
+	Commit string
+
+	// Time is the time of the build, in RFC3339.
+	Time string
+)
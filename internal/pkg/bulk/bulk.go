@@ -8,7 +8,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"time"
 
@@ -32,11 +34,13 @@ type Bulk interface {
 	Index(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error)
 	Update(ctx context.Context, index, id string, body []byte, opts ...Opt) error
 	Read(ctx context.Context, index, id string, opts ...Opt) ([]byte, error)
+	ReadWithMeta(ctx context.Context, index, id string, opts ...Opt) ([]byte, DocMeta, error)
 	//	Delete (ctx context.Context, index, id string, opts ...Opt) error
 
 	MUpdate(ctx context.Context, ops []BulkOp, opts ...Opt) error
 
 	Search(ctx context.Context, index []string, body []byte, opts ...Opt) (*es.ResultT, error)
+	MSearch(ctx context.Context, ops []SearchOp, opts ...Opt) []SearchResult
 
 	Client() *elasticsearch.Client
 }
@@ -68,11 +72,15 @@ type bulkT struct {
 	ch     chan respT
 	data   []byte
 	opts   optionsT
+
+	retries int // attempts rejected with a 429
 }
 
 type Bulker struct {
-	es *elasticsearch.Client
-	ch chan bulkT
+	es    *elasticsearch.Client
+	ch    chan bulkT
+	retry retryQueue
+	tuner flushTuner
 }
 
 const (
@@ -84,6 +92,9 @@ const (
 	defaultFlushThresholdSz  = 1024 * 1024 * 10
 	defaultMaxPending        = 32
 	defaultQueuePrealloc     = 64
+	defaultRetryMax          = 3
+	defaultRetryBackoff      = 100 * time.Millisecond
+	defaultRetryMaxBackoff   = 5 * time.Second
 )
 
 func InitES(ctx context.Context, cfg *config.Config, opts ...BulkOpt) (*elasticsearch.Client, Bulk, error) {
@@ -98,6 +109,10 @@ func InitES(ctx context.Context, cfg *config.Config, opts ...BulkOpt) (*elastics
 		WithFlushThresholdCount(cfg.Output.Elasticsearch.BulkFlushThresholdCount),
 		WithFlushThresholdSize(cfg.Output.Elasticsearch.BulkFlushThresholdSize),
 		WithMaxPending(cfg.Output.Elasticsearch.BulkFlushMaxPending),
+		WithMaxDocumentSize(cfg.Output.Elasticsearch.BulkMaxDocumentSize),
+		WithRetry(cfg.Output.Elasticsearch.BulkRetryMax, cfg.Output.Elasticsearch.BulkRetryBackoff, cfg.Output.Elasticsearch.BulkRetryMaxBackoff),
+		WithRetryRate(cfg.Output.Elasticsearch.BulkRetryRate),
+		WithFlushTuning(cfg.Output.Elasticsearch.BulkFlushTuning),
 	)
 
 	blk := NewBulker(es)
@@ -109,6 +124,33 @@ func InitES(ctx context.Context, cfg *config.Config, opts ...BulkOpt) (*elastics
 	return es, blk, nil
 }
 
+// InitMirror connects to the cluster of the migration and returns the Mirror
+// of the writes of primary to it; the mirror replays the writes once Run.
+func InitMirror(ctx context.Context, primary Bulk, cfg *config.Migration, indices []string) (*Mirror, error) {
+	esCfg := cfg.Elasticsearch
+	cli, err := es.NewMirrorClient(ctx, esCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	blk := NewBulker(cli)
+	go func() {
+		err := blk.Run(ctx,
+			WithFlushInterval(esCfg.BulkFlushInterval),
+			WithFlushThresholdCount(esCfg.BulkFlushThresholdCount),
+			WithFlushThresholdSize(esCfg.BulkFlushThresholdSize),
+			WithMaxPending(esCfg.BulkFlushMaxPending),
+			WithMaxDocumentSize(esCfg.BulkMaxDocumentSize),
+			WithRetry(esCfg.BulkRetryMax, esCfg.BulkRetryBackoff, esCfg.BulkRetryMaxBackoff),
+			WithRetryRate(esCfg.BulkRetryRate),
+			WithFlushTuning(esCfg.BulkFlushTuning),
+		)
+		log.Info().Err(err).Msg("Mirror bulker exit")
+	}()
+
+	return NewMirror(primary, blk, indices, cfg.QueueSize, cfg.Workers), nil
+}
+
 func NewBulker(es *elasticsearch.Client) *Bulker {
 	return &Bulker{
 		es: es,
@@ -120,6 +162,18 @@ func (b *Bulker) Client() *elasticsearch.Client {
 	return b.es
 }
 
+// RetryStats returns the counters of the items rejected with a 429 and
+// retried.
+func (b *Bulker) RetryStats() RetryStats {
+	return b.retry.stats()
+}
+
+// FlushStats returns the flush settings in use, and the workload they were
+// tuned to.
+func (b *Bulker) FlushStats() FlushStats {
+	return b.tuner.stats()
+}
+
 func (b *Bulker) parseBulkOpts(opts ...BulkOpt) bulkOptT {
 	bopt := bulkOptT{
 		flushInterval:     defaultFlushInterval,
@@ -127,6 +181,9 @@ func (b *Bulker) parseBulkOpts(opts ...BulkOpt) bulkOptT {
 		flushThresholdSz:  defaultFlushThresholdSz,
 		maxPending:        defaultMaxPending,
 		queuePrealloc:     defaultQueuePrealloc,
+		retryMax:          defaultRetryMax,
+		retryBackoff:      defaultRetryBackoff,
+		retryMaxBackoff:   defaultRetryMaxBackoff,
 	}
 
 	for _, f := range opts {
@@ -165,6 +222,8 @@ func (b *Bulker) Run(ctx context.Context, opts ...BulkOpt) error {
 	var err error
 
 	bopts := b.parseBulkOpts(opts...)
+	b.retry.configure(bopts)
+	b.tuner.configure(bopts)
 
 	// Create timer in stopped state
 	timer := time.NewTimer(bopts.flushInterval)
@@ -173,6 +232,45 @@ func (b *Bulker) Run(ctx context.Context, opts ...BulkOpt) error {
 
 	w := semaphore.NewWeighted(int64(bopts.maxPending))
 
+	// Tuned, the semaphore is sized for the most pending flushes and the
+	// weight beyond the max in use is reserved
+	var tuneC <-chan time.Time
+	var reserved, arrivals int
+	lastTune := time.Now()
+
+	doTune := func() {
+		now := time.Now()
+		interval, maxPending := b.tuner.tune(arrivals, now.Sub(lastTune))
+		arrivals = 0
+		lastTune = now
+
+		want := bopts.flushTuning.MaxPending - maxPending
+		switch {
+		case want > reserved:
+			// Shrinks once enough flushes are done
+			if !w.TryAcquire(int64(want - reserved)) {
+				maxPending = bopts.flushTuning.MaxPending - reserved
+				break
+			}
+			reserved = want
+		case want < reserved:
+			w.Release(int64(reserved - want))
+			reserved = want
+		}
+
+		bopts.flushInterval = interval
+		b.tuner.set(interval, maxPending)
+	}
+
+	if b.tuner.enabled() {
+		ticker := time.NewTicker(bopts.flushTuning.Interval)
+		defer ticker.Stop()
+		tuneC = ticker.C
+
+		w = semaphore.NewWeighted(int64(bopts.flushTuning.MaxPending))
+		doTune()
+	}
+
 	queues := make([]*queueT, 0, kNumQueues)
 	for i := 0; i < kNumQueues; i++ {
 		var action Action
@@ -201,7 +299,7 @@ func (b *Bulker) Run(ctx context.Context, opts ...BulkOpt) error {
 
 		for _, q := range queues {
 			if q.pending > 0 {
-				if err := b.flushQueue(ctx, w, q.queue, q.pending, q.action); err != nil {
+				if err := b.flushQueue(ctx, w, q.queue, q.pending, bopts.maxDocumentSize, q.action); err != nil {
 					return err
 				}
 
@@ -218,49 +316,65 @@ func (b *Bulker) Run(ctx context.Context, opts ...BulkOpt) error {
 		return nil
 	}
 
-LOOP:
-	for err == nil {
+	enqueue := func(item bulkT) error {
+		queueIdx := kQueueBulk
 
-		select {
+		switch item.action {
+		case ActionRead:
+			queueIdx = kQueueRead
+		case ActionSearch:
+			queueIdx = kQueueSearch
+		default:
+			if item.opts.Refresh {
+				queueIdx = kQueueRefresh
+			}
+		}
 
-		case item := <-b.ch:
+		q := queues[queueIdx]
+		q.queue = append(q.queue, item)
+		q.pending += len(item.data)
+		arrivals += 1
 
-			queueIdx := kQueueBulk
+		// Update threshold counters
+		itemCnt += 1
+		byteCnt += len(item.data)
 
-			switch item.action {
-			case ActionRead:
-				queueIdx = kQueueRead
-			case ActionSearch:
-				queueIdx = kQueueSearch
-			default:
-				if item.opts.Refresh {
-					queueIdx = kQueueRefresh
-				}
-			}
+		// Start timer on first queued item
+		if itemCnt == 1 {
+			timer.Reset(bopts.flushInterval)
+		}
 
-			q := queues[queueIdx]
-			q.queue = append(q.queue, item)
-			q.pending += len(item.data)
+		// Threshold test, short circuit timer on pending count
+		if itemCnt >= bopts.flushThresholdCnt || byteCnt >= bopts.flushThresholdSz {
+			log.Trace().
+				Str("mod", kModBulk).
+				Int("itemCnt", itemCnt).
+				Int("byteCnt", byteCnt).
+				Msg("Flush on threshold")
 
-			// Update threshold counters
-			itemCnt += 1
-			byteCnt += len(item.data)
+			return doFlush()
+		}
+		return nil
+	}
 
-			// Start timer on first queued item
-			if itemCnt == 1 {
-				timer.Reset(bopts.flushInterval)
-			}
+LOOP:
+	for err == nil {
 
-			// Threshold test, short circuit timer on pending count
-			if itemCnt >= bopts.flushThresholdCnt || byteCnt >= bopts.flushThresholdSz {
-				log.Trace().
-					Str("mod", kModBulk).
-					Int("itemCnt", itemCnt).
-					Int("byteCnt", byteCnt).
-					Msg("Flush on threshold")
+		// Items retried are queued ahead of the new ones
+		select {
+		case item := <-b.retry.ch:
+			err = enqueue(item)
+			continue
+		default:
+		}
 
-				err = doFlush()
-			}
+		select {
+
+		case item := <-b.retry.ch:
+			err = enqueue(item)
+
+		case item := <-b.ch:
+			err = enqueue(item)
 
 		case <-timer.C:
 			log.Trace().
@@ -270,6 +384,9 @@ LOOP:
 				Msg("Flush on timer")
 			err = doFlush()
 
+		case <-tuneC:
+			doTune()
+
 		case <-ctx.Done():
 			err = ctx.Err()
 			break LOOP
@@ -281,7 +398,7 @@ LOOP:
 	return err
 }
 
-func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue []bulkT, szPending int, action Action) error {
+func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue []bulkT, szPending, maxDocSz int, action Action) error {
 	start := time.Now()
 	log.Trace().
 		Str("mod", kModBulk).
@@ -310,9 +427,9 @@ func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue []
 		var err error
 		switch action {
 		case ActionRead:
-			err = b.flushRead(ctx, queue, szPending)
+			err = b.flushRead(ctx, queue, szPending, maxDocSz)
 		case ActionSearch:
-			err = b.flushSearch(ctx, queue, szPending)
+			err = b.flushSearch(ctx, queue, szPending, maxDocSz)
 		default:
 			err = b.flushBulk(ctx, queue, szPending)
 		}
@@ -320,6 +437,7 @@ func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue []
 		if err != nil {
 			failQueue(queue, err)
 		}
+		b.tuner.observe(time.Since(start))
 
 		log.Trace().
 			Err(err).
@@ -335,7 +453,7 @@ func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue []
 	return nil
 }
 
-func (b *Bulker) flushRead(ctx context.Context, queue []bulkT, szPending int) error {
+func (b *Bulker) flushRead(ctx context.Context, queue []bulkT, szPending, maxDocSz int) error {
 	start := time.Now()
 
 	buf := bytes.NewBufferString(rPrefix)
@@ -368,37 +486,43 @@ func (b *Bulker) flushRead(ctx context.Context, queue []bulkT, szPending int) er
 		return fmt.Errorf("flush: %s", res.String()) // TODO: Wrap error
 	}
 
-	var blk MgetResponse
-	decoder := json.NewDecoder(res.Body)
-	if err := decoder.Decode(&blk); err != nil {
-		return fmt.Errorf("flush: error parsing response body: %s", err) // TODO: Wrap error
-	}
+	var n int
+	var item MgetResponseItem
+	err = streamArray(res.Body, "docs", maxDocSz, nil,
+		func(dec *json.Decoder) error {
+			if n >= len(queue) {
+				return fmt.Errorf("Mget queue length mismatch")
+			}
+			item = MgetResponseItem{}
+			return dec.Decode(&item)
+		},
+		func() {
+			citem := item
+			queue[n].ch <- respT{
+				idx:  queue[n].idx,
+				err:  citem.deriveError(),
+				data: &citem,
+			}
+			n++
+		},
+	)
 
 	log.Trace().
 		Err(err).
 		Str("mod", kModBulk).
 		Dur("rtt", time.Since(start)).
-		Int("sz", len(blk.Items)).
+		Int("sz", n).
 		Msg("flushRead")
 
-	if len(blk.Items) != len(queue) {
-		return fmt.Errorf("Mget queue length mismatch")
-	}
-
-	for i, item := range blk.Items {
-		citem := item
-		queue[i].ch <- respT{
-			idx:  queue[i].idx,
-			err:  item.deriveError(),
-			data: &citem,
-		}
-
+	if err == nil && n != len(queue) {
+		err = fmt.Errorf("Mget queue length mismatch")
 	}
 
+	failStream(queue[n:], err)
 	return nil
 }
 
-func (b *Bulker) flushSearch(ctx context.Context, queue []bulkT, szPending int) error {
+func (b *Bulker) flushSearch(ctx context.Context, queue []bulkT, szPending, maxDocSz int) error {
 	start := time.Now()
 
 	buf := bytes.Buffer{}
@@ -426,34 +550,41 @@ func (b *Bulker) flushSearch(ctx context.Context, queue []bulkT, szPending int)
 		return fmt.Errorf("flush: %s", res.String()) // TODO: Wrap error
 	}
 
-	var blk MsearchResponse
-	decoder := json.NewDecoder(res.Body)
-	if err := decoder.Decode(&blk); err != nil {
-		return fmt.Errorf("flush: error parsing response body: %s", err) // TODO: Wrap error
-	}
+	var n int
+	var took int
+	var response MsearchResponseItem
+	err = streamArray(res.Body, "responses", maxDocSz, map[string]interface{}{"took": &took},
+		func(dec *json.Decoder) error {
+			if n >= len(queue) {
+				return fmt.Errorf("Bulk queue length mismatch")
+			}
+			response = MsearchResponseItem{}
+			return dec.Decode(&response)
+		},
+		func() {
+			cResponse := response
+			queue[n].ch <- respT{
+				idx:  queue[n].idx,
+				err:  cResponse.deriveError(),
+				data: &cResponse,
+			}
+			n++
+		},
+	)
 
 	log.Trace().
 		Err(err).
 		Str("mod", kModBulk).
 		Dur("rtt", time.Since(start)).
-		Int("took", blk.Took).
-		Int("sz", len(blk.Responses)).
+		Int("took", took).
+		Int("sz", n).
 		Msg("flushSearch")
 
-	if len(blk.Responses) != len(queue) {
-		return fmt.Errorf("Bulk queue length mismatch")
-	}
-
-	for i, response := range blk.Responses {
-
-		cResponse := response
-		queue[i].ch <- respT{
-			idx:  queue[i].idx,
-			err:  response.deriveError(),
-			data: &cResponse,
-		}
+	if err == nil && n != len(queue) {
+		err = fmt.Errorf("Bulk queue length mismatch")
 	}
 
+	failStream(queue[n:], err)
 	return nil
 }
 
@@ -515,6 +646,11 @@ func (b *Bulker) flushBulk(ctx context.Context, queue []bulkT, szPending int) er
 
 		for _, item := range blkItem {
 
+			// Rejected under load; flushed again rather than failed
+			if item.Status == http.StatusTooManyRequests && b.retry.retry(ctx, queue[i]) {
+				break
+			}
+
 			select {
 			case queue[i].ch <- respT{
 				idx:  queue[i].idx,
@@ -599,6 +735,24 @@ func (b *Bulker) waitBulkAction(ctx context.Context, action Action, index, id st
 }
 
 func (b *Bulker) Read(ctx context.Context, index, id string, opts ...Opt) ([]byte, error) {
+	item, err := b.read(ctx, index, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return item.Source, nil
+}
+
+// ReadWithMeta reads the document along with the metadata needed to make a
+// subsequent write conditional with WithIfSeqNo.
+func (b *Bulker) ReadWithMeta(ctx context.Context, index, id string, opts ...Opt) ([]byte, DocMeta, error) {
+	item, err := b.read(ctx, index, id, opts...)
+	if err != nil {
+		return nil, DocMeta{}, err
+	}
+	return item.Source, DocMeta{SeqNo: item.SeqNo, PrimaryTerm: item.PrimTerm}, nil
+}
+
+func (b *Bulker) read(ctx context.Context, index, id string, opts ...Opt) (*MgetResponseItem, error) {
 	opt := b.parseOpts(opts...)
 
 	// Serialize request
@@ -614,12 +768,17 @@ func (b *Bulker) Read(ctx context.Context, index, id string, opts ...Opt) ([]byt
 	// Process response
 	resp := b.dispatch(ctx, ActionRead, opt, buf.Bytes())
 	if resp.err != nil {
+		var tooLarge *es.ErrDocumentTooLarge
+		if errors.As(resp.err, &tooLarge) {
+			tooLarge.Index = index
+			tooLarge.Id = id
+		}
 		return nil, resp.err
 	}
 
 	// Interpret response, looking for generated id
 	r := resp.data.(*MgetResponseItem)
-	return r.Source, nil
+	return r, nil
 }
 
 func (b *Bulker) Search(ctx context.Context, index []string, body []byte, opts ...Opt) (*es.ResultT, error) {
@@ -640,14 +799,8 @@ func (b *Bulker) Search(ctx context.Context, index []string, body []byte, opts .
 	}
 
 	// Process response
-	resp := b.dispatch(ctx, ActionSearch, opt, buf.Bytes())
-	if resp.err != nil {
-		return nil, resp.err
-	}
-
-	// Interpret response
-	r := resp.data.(*MsearchResponseItem)
-	return &es.ResultT{HitsT: r.Hits, Aggregations: r.Aggregations}, nil
+	res := searchResult(index, b.dispatch(ctx, ActionSearch, opt, buf.Bytes()))
+	return res.Result, res.Err
 }
 
 func (b *Bulker) writeMsearchMeta(buf *bytes.Buffer, indices []string) error {
@@ -655,6 +808,7 @@ func (b *Bulker) writeMsearchMeta(buf *bytes.Buffer, indices []string) error {
 		return err
 	}
 
+	indices = es.ResolveIndices(indices)
 	switch len(indices) {
 	case 0:
 		buf.WriteString("{ }\n")
@@ -716,7 +870,7 @@ func (b *Bulker) writeMget(buf *bytes.Buffer, index, id string) error {
 	}
 
 	buf.WriteString(`{"_index":"`)
-	buf.WriteString(index)
+	buf.WriteString(es.ResolveIndex(index))
 	buf.WriteString(`","_id":"`)
 	buf.WriteString(id)
 	buf.WriteString(`"},`)
@@ -741,8 +895,15 @@ func (b *Bulker) writeBulkMeta(buf *bytes.Buffer, action Action, index, id strin
 		buf.WriteString(strconv.Itoa(opts.RetryOnConflict))
 		buf.WriteString(`,`)
 	}
+	if opts.IfMeta != nil {
+		buf.WriteString(`"if_seq_no":`)
+		buf.WriteString(strconv.FormatInt(opts.IfMeta.SeqNo, 10))
+		buf.WriteString(`,"if_primary_term":`)
+		buf.WriteString(strconv.FormatInt(opts.IfMeta.PrimaryTerm, 10))
+		buf.WriteString(`,`)
+	}
 	buf.WriteString(`"_index":"`)
-	buf.WriteString(index)
+	buf.WriteString(es.ResolveIndex(index))
 	buf.WriteString("\"}}\n")
 	return nil
 }
@@ -760,15 +921,16 @@ func (b *Bulker) writeBulkBody(buf *bytes.Buffer, body []byte) error {
 
 func (b *Bulker) dispatch(ctx context.Context, action Action, opts optionsT, data []byte) respT {
 	start := time.Now()
+	defer observe(ctx, action, start)
 
 	ch := make(chan respT, 1)
 
 	item := bulkT{
-		0,
-		action,
-		ch,
-		data,
-		opts,
+		idx:    0,
+		action: action,
+		ch:     ch,
+		data:   data,
+		opts:   opts,
 	}
 
 	// Dispatch to bulk Run loop
@@ -0,0 +1,141 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+)
+
+// ErrResponseAborted is returned for the items of a read or search that were
+// queued behind a document that exceeded the maximum document size; the rest
+// of the response is not decoded.
+var ErrResponseAborted = errors.New("response aborted on oversized document")
+
+var errReadLimit = errors.New("read limit exceeded")
+
+// elemLimitReader fails once more than limit bytes were read past base. The
+// decoder reads ahead in chunks, so base is moved to the start of each array
+// element to bound the amount of memory a single element can consume.
+type elemLimitReader struct {
+	r     io.Reader
+	n     int64
+	base  int64
+	limit int64
+}
+
+func (l *elemLimitReader) Read(p []byte) (int, error) {
+	if l.limit > 0 && l.n-l.base > l.limit {
+		return 0, errReadLimit
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// streamArray decodes the JSON object read from r and calls decode for each
+// element of the array in field, in order, so the elements are not all held
+// in memory at once; emit is called once the element is known to be within
+// limit. The value of any other field is decoded into the matching entry of
+// other, or discarded. An element larger than limit bytes aborts the stream
+// with *es.ErrDocumentTooLarge; limit <= 0 is unlimited.
+func streamArray(r io.Reader, field string, limit int, other map[string]interface{}, decode func(dec *json.Decoder) error, emit func()) error {
+	lr := &elemLimitReader{r: r, limit: int64(limit)}
+	dec := json.NewDecoder(lr)
+
+	tooLarge := func(start int64) error {
+		return &es.ErrDocumentTooLarge{Size: int(lr.n - start), Limit: limit}
+	}
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+
+		if key != field {
+			start := dec.InputOffset()
+			lr.base = start
+
+			var v interface{} = new(json.RawMessage)
+			if dst, ok := other[key]; ok {
+				v = dst
+			}
+			if err := dec.Decode(v); err != nil {
+				if errors.Is(err, errReadLimit) {
+					return tooLarge(start)
+				}
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+
+		for dec.More() {
+			start := dec.InputOffset()
+			lr.base = start
+
+			if err := decode(dec); err != nil {
+				if errors.Is(err, errReadLimit) {
+					return tooLarge(start)
+				}
+				return err
+			}
+
+			if sz := int(dec.InputOffset() - start); limit > 0 && sz > limit {
+				return &es.ErrDocumentTooLarge{Size: sz, Limit: limit}
+			}
+			emit()
+		}
+
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("unexpected token %v, expected %v", tok, delim)
+	}
+	return nil
+}
+
+// failStream answers the items of a streamed read or search that were not
+// reached before err stopped the stream. Only the item the stream stopped at
+// is failed with an oversized document error; the items behind it are failed
+// with ErrResponseAborted.
+func failStream(queue []bulkT, err error) {
+	if len(queue) == 0 || err == nil {
+		return
+	}
+
+	var tooLarge *es.ErrDocumentTooLarge
+	if errors.As(err, &tooLarge) {
+		failQueue(queue[:1], err)
+		failQueue(queue[1:], ErrResponseAborted)
+		return
+	}
+
+	failQueue(queue, fmt.Errorf("flush: error parsing response body: %s", err)) // TODO: Wrap error
+}
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamDocs(t *testing.T, body string, limit int) ([]MgetResponseItem, int, error) {
+	t.Helper()
+
+	var took int
+	var item MgetResponseItem
+	var items []MgetResponseItem
+	err := streamArray(strings.NewReader(body), "docs", limit, map[string]interface{}{"took": &took},
+		func(dec *json.Decoder) error {
+			item = MgetResponseItem{}
+			return dec.Decode(&item)
+		},
+		func() {
+			items = append(items, item)
+		},
+	)
+	return items, took, err
+}
+
+func TestStreamArray(t *testing.T) {
+	body := `{"took":3,"docs":[{"found":true,"_seq_no":1,"_source":{"a":1}},{"found":false}],"extra":{"x":[1,2]}}`
+
+	items, took, err := streamDocs(t, body, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, took)
+	require.Len(t, items, 2)
+	assert.True(t, items[0].Found)
+	assert.Equal(t, int64(1), items[0].SeqNo)
+	assert.JSONEq(t, `{"a":1}`, string(items[0].Source))
+	assert.False(t, items[1].Found)
+}
+
+func TestStreamArrayDocumentTooLarge(t *testing.T) {
+	large := strings.Repeat("x", 64*1024)
+	body := `{"docs":[{"found":true,"_source":{"a":1}},{"found":true,"_source":{"a":"` + large + `"}},{"found":true,"_source":{"a":2}}]}`
+
+	items, _, err := streamDocs(t, body, 1024)
+
+	var tooLarge *es.ErrDocumentTooLarge
+	require.True(t, errors.As(err, &tooLarge), "expected too large, got %v", err)
+	assert.True(t, errors.Is(err, es.ErrElasticDocumentTooLarge))
+	assert.Equal(t, 1024, tooLarge.Limit)
+	assert.Greater(t, tooLarge.Size, 1024)
+
+	// The document before the oversized one was emitted, the rest was not.
+	require.Len(t, items, 1)
+	assert.JSONEq(t, `{"a":1}`, string(items[0].Source))
+}
+
+func TestStreamArrayMalformed(t *testing.T) {
+	_, _, err := streamDocs(t, `["docs"]`, 0)
+	assert.Error(t, err)
+
+	_, _, err = streamDocs(t, `{"docs":[{"found":true}`, 0)
+	assert.Error(t, err)
+}
+
+func TestFailStream(t *testing.T) {
+	queue := make([]bulkT, 3)
+	for i := range queue {
+		queue[i] = bulkT{idx: i, ch: make(chan respT, 1)}
+	}
+
+	failStream(queue, &es.ErrDocumentTooLarge{Size: 10, Limit: 5})
+
+	assert.True(t, errors.Is((<-queue[0].ch).err, es.ErrElasticDocumentTooLarge))
+	assert.Equal(t, ErrResponseAborted, (<-queue[1].ch).err)
+	assert.Equal(t, ErrResponseAborted, (<-queue[2].ch).err)
+
+	failStream(queue, nil)
+	for _, q := range queue {
+		assert.Len(t, q.ch, 0)
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/rs/zerolog/log"
+)
+
+// kMirrorBatch is the number of queued writes a worker replays at once.
+const kMirrorBatch = 512
+
+// MirrorFunc replays an operation other than a document write, such as an API
+// key invalidation, on the secondary cluster.
+type MirrorFunc func(ctx context.Context, secondary Bulk) error
+
+// MirrorStats are the writes pending and the age of the oldest, with the
+// totals of the writes mirrored, repaired by copying the document, failed and
+// dropped from the full queue.
+type MirrorStats struct {
+	Pending  int64
+	Lag      time.Duration
+	Mirrored uint64
+	Repaired uint64
+	Failed   uint64
+	Dropped  uint64
+}
+
+// MirrorCheck is the outcome of the comparison of documents between the
+// clusters.
+type MirrorCheck struct {
+	Checked    int
+	Skipped    int
+	Missing    int
+	Mismatched int
+}
+
+type mirrorOp struct {
+	action Action
+	index  string
+	id     string
+	body   []byte
+	fn     MirrorFunc
+	queued time.Time
+}
+
+type mirrorWorker struct {
+	ch   chan mirrorOp
+	head int64 // unix nanoseconds the write being replayed was queued at; 0 when idle
+}
+
+// Mirror is a Bulk that also writes the documents of the mirrored indices to
+// a secondary cluster. The writes succeeded on the primary cluster are queued
+// and replayed on the secondary asynchronously, so the secondary never slows
+// down nor fails the primary; the writes to a document are replayed in order.
+// The reads and searches are served by the primary cluster only.
+//
+// An update the secondary cannot apply, such as to a document it does not
+// have yet, is repaired by copying the document from the primary; so are all
+// the documents of a batch of updates that fails. The writes beyond the queue
+// size are dropped, counted and logged, and left to the consistency check.
+type Mirror struct {
+	Bulk
+	secondary Bulk
+	indices   map[string]bool
+	workers   []*mirrorWorker
+
+	mut     sync.Mutex
+	pending map[string]int // writes queued by document
+
+	nPending int64
+	mirrored uint64
+	repaired uint64
+	failed   uint64
+	dropped  uint64
+	full     int32
+}
+
+// NewMirror mirrors the writes to indices from primary to secondary, queueing
+// up to queueSize writes shared among the workers.
+func NewMirror(primary, secondary Bulk, indices []string, queueSize, workers int) *Mirror {
+	m := &Mirror{
+		Bulk:      primary,
+		secondary: secondary,
+		indices:   make(map[string]bool, len(indices)),
+		workers:   make([]*mirrorWorker, workers),
+		pending:   make(map[string]int),
+	}
+	for _, index := range indices {
+		m.indices[index] = true
+	}
+	size := queueSize / workers
+	if size < 1 {
+		size = 1
+	}
+	for i := range m.workers {
+		m.workers[i] = &mirrorWorker{ch: make(chan mirrorOp, size)}
+	}
+	return m
+}
+
+// Secondary returns the Bulk of the secondary cluster.
+func (m *Mirror) Secondary() Bulk {
+	return m.secondary
+}
+
+func (m *Mirror) Create(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	id, err := m.Bulk.Create(ctx, index, id, body, opts...)
+	if err == nil {
+		m.enqueue(mirrorOp{action: ActionCreate, index: index, id: id, body: body})
+	}
+	return id, err
+}
+
+func (m *Mirror) Index(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	id, err := m.Bulk.Index(ctx, index, id, body, opts...)
+	if err == nil {
+		m.enqueue(mirrorOp{action: ActionIndex, index: index, id: id, body: body})
+	}
+	return id, err
+}
+
+func (m *Mirror) Update(ctx context.Context, index, id string, body []byte, opts ...Opt) error {
+	err := m.Bulk.Update(ctx, index, id, body, opts...)
+	if err == nil {
+		m.enqueue(mirrorOp{action: ActionUpdate, index: index, id: id, body: body})
+	}
+	return err
+}
+
+func (m *Mirror) MUpdate(ctx context.Context, ops []BulkOp, opts ...Opt) error {
+	err := m.Bulk.MUpdate(ctx, ops, opts...)
+	if err == nil {
+		for _, op := range ops {
+			m.enqueue(mirrorOp{action: ActionUpdate, index: op.Index, id: op.Id, body: op.Body})
+		}
+	}
+	return err
+}
+
+// Go replays fn on the secondary cluster, in order with the writes to the
+// document of key.
+func (m *Mirror) Go(key string, fn MirrorFunc) {
+	m.enqueue(mirrorOp{id: key, fn: fn})
+}
+
+func (m *Mirror) enqueue(op mirrorOp) {
+	if op.fn == nil && !m.indices[op.index] {
+		return
+	}
+	op.queued = time.Now()
+
+	h := fnv.New32a()
+	h.Write([]byte(op.id))
+	w := m.workers[int(h.Sum32()%uint32(len(m.workers)))]
+
+	m.mut.Lock()
+	m.pending[op.index+"/"+op.id]++
+	m.mut.Unlock()
+
+	select {
+	case w.ch <- op:
+		atomic.AddInt64(&m.nPending, 1)
+		if atomic.CompareAndSwapInt32(&m.full, 1, 0) {
+			log.Info().
+				Uint64("dropped", atomic.LoadUint64(&m.dropped)).
+				Msg("Mirror queue below the limit; mirroring the writes again")
+		}
+	default:
+		m.done(op)
+		atomic.AddUint64(&m.dropped, 1)
+		// Logged once per overflow, the metrics count every write
+		if atomic.CompareAndSwapInt32(&m.full, 0, 1) {
+			log.Warn().
+				Str("index", op.index).
+				Str("id", op.id).
+				Int("queue_size", cap(w.ch)*len(m.workers)).
+				Msg("Mirror queue full; dropping the writes until the consistency check repairs them")
+		}
+		log.Debug().
+			Str("index", op.index).
+			Str("id", op.id).
+			Msg("Drop write to mirror")
+	}
+}
+
+func (m *Mirror) done(op mirrorOp) {
+	key := op.index + "/" + op.id
+	m.mut.Lock()
+	if m.pending[key]--; m.pending[key] <= 0 {
+		delete(m.pending, key)
+	}
+	m.mut.Unlock()
+}
+
+// isPending tells whether writes to the document are waiting to be mirrored.
+func (m *Mirror) isPending(index, id string) bool {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.pending[index+"/"+id] > 0
+}
+
+// Run replays the queued writes on the secondary cluster until ctx is done.
+func (m *Mirror) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, w := range m.workers {
+		wg.Add(1)
+		go func(w *mirrorWorker) {
+			defer wg.Done()
+			m.runWorker(ctx, w)
+		}(w)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (m *Mirror) runWorker(ctx context.Context, w *mirrorWorker) {
+	for {
+		var op mirrorOp
+		select {
+		case <-ctx.Done():
+			return
+		case op = <-w.ch:
+		}
+
+		batch := []mirrorOp{op}
+	drain:
+		for len(batch) < kMirrorBatch {
+			select {
+			case op := <-w.ch:
+				batch = append(batch, op)
+			default:
+				break drain
+			}
+		}
+
+		atomic.StoreInt64(&w.head, batch[0].queued.UnixNano())
+		m.replay(ctx, batch)
+		atomic.StoreInt64(&w.head, 0)
+
+		for _, op := range batch {
+			m.done(op)
+		}
+		atomic.AddInt64(&m.nPending, -int64(len(batch)))
+	}
+}
+
+// replay applies the batch in order; the consecutive updates are sent at once.
+func (m *Mirror) replay(ctx context.Context, batch []mirrorOp) {
+	for i := 0; i < len(batch); {
+		j := i + 1
+		if batch[i].action == ActionUpdate {
+			for j < len(batch) && batch[j].action == ActionUpdate {
+				j++
+			}
+		}
+		m.replayRun(ctx, batch[i:j])
+		i = j
+	}
+}
+
+func (m *Mirror) replayRun(ctx context.Context, run []mirrorOp) {
+	if len(run) > 1 {
+		ops := make([]BulkOp, len(run))
+		for i, op := range run {
+			ops[i] = BulkOp{Index: op.index, Id: op.id, Body: op.body}
+		}
+		err := m.secondary.MUpdate(ctx, ops)
+		if err == nil {
+			atomic.AddUint64(&m.mirrored, uint64(len(run)))
+			return
+		}
+		// Replaying the updates one at a time would apply those that
+		// succeeded twice; copy the documents instead, which have all the
+		// updates of the run on the primary
+		m.repairRun(ctx, run, err)
+		return
+	}
+
+	for _, op := range run {
+		var err error
+		switch {
+		case op.fn != nil:
+			err = op.fn(ctx, m.secondary)
+		case op.action == ActionCreate:
+			_, err = m.secondary.Create(ctx, op.index, op.id, op.body)
+			if errors.Is(err, es.ErrElasticVersionConflict) {
+				// Created already, by a repair or the initial copy
+				err = m.Repair(ctx, op.index, op.id)
+			}
+		case op.action == ActionIndex:
+			_, err = m.secondary.Index(ctx, op.index, op.id, op.body)
+		default:
+			if err = m.secondary.Update(ctx, op.index, op.id, op.body); err != nil {
+				err = m.Repair(ctx, op.index, op.id)
+			}
+		}
+
+		if err != nil {
+			atomic.AddUint64(&m.failed, 1)
+			log.Warn().
+				Err(err).
+				Str("index", op.index).
+				Str("id", op.id).
+				Msg("Fail to mirror write to the secondary cluster")
+			continue
+		}
+		atomic.AddUint64(&m.mirrored, 1)
+	}
+}
+
+// repairRun copies the documents of the run of updates that failed to be
+// applied at once, cause, from the primary cluster.
+func (m *Mirror) repairRun(ctx context.Context, run []mirrorOp, cause error) {
+	repaired := make(map[string]bool, len(run))
+	for _, op := range run {
+		key := op.index + "/" + op.id
+		ok, seen := repaired[key]
+		if !seen {
+			err := m.Repair(ctx, op.index, op.id)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					AnErr("cause", cause).
+					Str("index", op.index).
+					Str("id", op.id).
+					Msg("Fail to mirror write to the secondary cluster")
+			}
+			ok = err == nil
+			repaired[key] = ok
+		}
+
+		if ok {
+			atomic.AddUint64(&m.mirrored, 1)
+		} else {
+			atomic.AddUint64(&m.failed, 1)
+		}
+	}
+}
+
+// Repair copies the document from the primary cluster to the secondary.
+func (m *Mirror) Repair(ctx context.Context, index, id string) error {
+	body, err := m.Bulk.Read(ctx, index, id)
+	if errors.Is(err, es.ErrElasticNotFound) {
+		// Gone from the primary; nothing to copy
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := m.secondary.Index(ctx, index, id, body); err != nil {
+		return err
+	}
+	atomic.AddUint64(&m.repaired, 1)
+	return nil
+}
+
+// Check compares the documents of the hits, read from the primary cluster,
+// with those of the secondary and repairs those missing or different. The
+// documents with writes pending are skipped.
+func (m *Mirror) Check(ctx context.Context, index string, hits []es.HitT) (MirrorCheck, error) {
+	var check MirrorCheck
+	for _, hit := range hits {
+		if m.isPending(index, hit.Id) {
+			check.Skipped++
+			continue
+		}
+		check.Checked++
+
+		body, err := m.secondary.Read(ctx, index, hit.Id)
+		switch {
+		case errors.Is(err, es.ErrElasticNotFound):
+			check.Missing++
+		case err != nil:
+			return check, err
+		case sameSource(hit.Source, body):
+			continue
+		default:
+			check.Mismatched++
+		}
+
+		if err := m.Repair(ctx, index, hit.Id); err != nil {
+			return check, err
+		}
+	}
+	return check, nil
+}
+
+func sameSource(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// Stats returns the state of the mirror.
+func (m *Mirror) Stats() MirrorStats {
+	stats := MirrorStats{
+		Pending:  atomic.LoadInt64(&m.nPending),
+		Mirrored: atomic.LoadUint64(&m.mirrored),
+		Repaired: atomic.LoadUint64(&m.repaired),
+		Failed:   atomic.LoadUint64(&m.failed),
+		Dropped:  atomic.LoadUint64(&m.dropped),
+	}
+	now := time.Now().UnixNano()
+	for _, w := range m.workers {
+		if head := atomic.LoadInt64(&w.head); head != 0 && time.Duration(now-head) > stats.Lag {
+			stats.Lag = time.Duration(now - head)
+		}
+	}
+	return stats
+}
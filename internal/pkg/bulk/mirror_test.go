@@ -0,0 +1,210 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memBulk is an in memory document store applying the partial updates.
+type memBulk struct {
+	Bulk
+	mut  sync.Mutex
+	docs map[string][]byte
+}
+
+func newMemBulk() *memBulk {
+	return &memBulk{docs: make(map[string][]byte)}
+}
+
+func (m *memBulk) get(index, id string) []byte {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.docs[index+"/"+id]
+}
+
+func (m *memBulk) Create(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.docs[index+"/"+id]; ok {
+		return "", &es.ErrVersionConflict{Index: index, Id: id}
+	}
+	m.docs[index+"/"+id] = body
+	return id, nil
+}
+
+func (m *memBulk) Index(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.docs[index+"/"+id] = body
+	return id, nil
+}
+
+func (m *memBulk) Update(ctx context.Context, index, id string, body []byte, opts ...Opt) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	src, ok := m.docs[index+"/"+id]
+	if !ok {
+		return es.ErrElasticNotFound
+	}
+	var doc map[string]interface{}
+	var update struct {
+		Doc map[string]interface{} `json:"doc"`
+	}
+	if err := json.Unmarshal(src, &doc); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return err
+	}
+	for k, v := range update.Doc {
+		doc[k] = v
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	m.docs[index+"/"+id] = data
+	return nil
+}
+
+func (m *memBulk) MUpdate(ctx context.Context, ops []BulkOp, opts ...Opt) error {
+	var firstErr error
+	for _, op := range ops {
+		if err := m.Update(ctx, op.Index, op.Id, op.Body); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *memBulk) Read(ctx context.Context, index, id string, opts ...Opt) ([]byte, error) {
+	if src := m.get(index, id); src != nil {
+		return src, nil
+	}
+	return nil, es.ErrElasticNotFound
+}
+
+func TestMirror(t *testing.T) {
+	primary, secondary := newMemBulk(), newMemBulk()
+	m := NewMirror(primary, secondary, []string{".fleet-agents"}, 100, 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ops := func(ctx context.Context) {
+		_, err := m.Create(ctx, ".fleet-agents", "a1", []byte(`{"status":"enrolled"}`))
+		require.NoError(t, err)
+		require.NoError(t, m.Update(ctx, ".fleet-agents", "a1", []byte(`{"doc":{"status":"online"}}`)))
+		require.NoError(t, m.MUpdate(ctx, []BulkOp{
+			{Index: ".fleet-agents", Id: "a1", Body: []byte(`{"doc":{"policy":"p1"}}`)},
+		}))
+		_, err = m.Index(ctx, ".fleet-servers", "s1", []byte(`{}`))
+		require.NoError(t, err)
+	}
+	ops(ctx)
+
+	// Written before the mirror, so updated from a copy of the primary
+	_, err := primary.Index(ctx, ".fleet-agents", "a2", []byte(`{"status":"enrolled"}`))
+	require.NoError(t, err)
+	require.NoError(t, m.Update(ctx, ".fleet-agents", "a2", []byte(`{"doc":{"status":"online"}}`)))
+
+	var invalidated bool
+	m.Go("key-1", func(ctx context.Context, secondary Bulk) error {
+		invalidated = true
+		return nil
+	})
+
+	go m.Run(ctx)
+	require.Eventually(t, func() bool {
+		return m.Stats().Pending == 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.JSONEq(t, `{"status":"online","policy":"p1"}`, string(secondary.get(".fleet-agents", "a1")))
+	assert.JSONEq(t, `{"status":"online"}`, string(secondary.get(".fleet-agents", "a2")))
+	assert.Nil(t, secondary.get(".fleet-servers", "s1"))
+	assert.True(t, invalidated)
+
+	stats := m.Stats()
+	assert.Equal(t, uint64(5), stats.Mirrored)
+	assert.Equal(t, uint64(1), stats.Repaired)
+	assert.Zero(t, stats.Failed)
+	assert.Zero(t, stats.Lag)
+
+	// The consistency check repairs the documents that differ
+	secondary.Index(ctx, ".fleet-agents", "a1", []byte(`{"status":"offline"}`))
+	hits := []es.HitT{
+		{Id: "a1", Source: primary.get(".fleet-agents", "a1")},
+		{Id: "a2", Source: primary.get(".fleet-agents", "a2")},
+	}
+	check, err := m.Check(ctx, ".fleet-agents", hits)
+	require.NoError(t, err)
+	assert.Equal(t, MirrorCheck{Checked: 2, Mismatched: 1}, check)
+	assert.JSONEq(t, `{"status":"online","policy":"p1"}`, string(secondary.get(".fleet-agents", "a1")))
+}
+
+func TestMirrorRepairRun(t *testing.T) {
+	primary, secondary := newMemBulk(), newMemBulk()
+	m := NewMirror(primary, secondary, []string{".fleet-agents"}, 100, 1)
+
+	ctx := context.Background()
+	_, err := primary.Index(ctx, ".fleet-agents", "a1", []byte(`{"seq":0}`))
+	require.NoError(t, err)
+	_, err = secondary.Index(ctx, ".fleet-agents", "a1", []byte(`{"seq":0}`))
+	require.NoError(t, err)
+	// Missing from the secondary, so the run fails
+	_, err = primary.Index(ctx, ".fleet-agents", "a2", []byte(`{"seq":0}`))
+	require.NoError(t, err)
+
+	require.NoError(t, m.MUpdate(ctx, []BulkOp{
+		{Index: ".fleet-agents", Id: "a1", Body: []byte(`{"doc":{"seq":1}}`)},
+		{Index: ".fleet-agents", Id: "a2", Body: []byte(`{"doc":{"seq":1}}`)},
+		{Index: ".fleet-agents", Id: "a1", Body: []byte(`{"doc":{"seq":2}}`)},
+	}))
+
+	// Replayed at once, then both documents are copied from the primary
+	m.replay(ctx, []mirrorOp{<-m.workers[0].ch, <-m.workers[0].ch, <-m.workers[0].ch})
+
+	assert.JSONEq(t, `{"seq":2}`, string(secondary.get(".fleet-agents", "a1")))
+	assert.JSONEq(t, `{"seq":1}`, string(secondary.get(".fleet-agents", "a2")))
+
+	stats := m.Stats()
+	assert.Equal(t, uint64(3), stats.Mirrored)
+	assert.Equal(t, uint64(2), stats.Repaired)
+	assert.Zero(t, stats.Failed)
+}
+
+func TestMirrorDrop(t *testing.T) {
+	primary, secondary := newMemBulk(), newMemBulk()
+	m := NewMirror(primary, secondary, []string{".fleet-agents"}, 1, 1)
+
+	ctx := context.Background()
+	for _, id := range []string{"a1", "a2"} {
+		_, err := m.Index(ctx, ".fleet-agents", id, []byte(`{}`))
+		require.NoError(t, err)
+	}
+
+	stats := m.Stats()
+	assert.Equal(t, int64(1), stats.Pending)
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.True(t, m.isPending(".fleet-agents", "a1"))
+	assert.False(t, m.isPending(".fleet-agents", "a2"))
+
+	// Pending documents are not compared
+	check, err := m.Check(ctx, ".fleet-agents", []es.HitT{{Id: "a1", Source: []byte(`{}`)}})
+	require.NoError(t, err)
+	assert.Equal(t, MirrorCheck{Skipped: 1}, check)
+}
@@ -7,10 +7,31 @@ package bulk
 import (
 	"bytes"
 	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 
 	"github.com/rs/zerolog/log"
 )
 
+// SearchOp is a single search of an MSearch.
+type SearchOp struct {
+	Index []string
+	Body  []byte
+
+	// Timeout bounds the wait for this search only; zero waits for as long as
+	// the context allows.
+	Timeout time.Duration
+}
+
+// SearchResult is the outcome of a SearchOp.
+type SearchResult struct {
+	Result *es.ResultT
+	Err    error
+}
+
 func (b *Bulker) MUpdate(ctx context.Context, ops []BulkOp, opts ...Opt) error {
 	_, err := b.multiWaitBulkAction(ctx, ActionUpdate, ops)
 	return err
@@ -64,16 +85,17 @@ func (b *Bulker) multiWaitBulkAction(ctx context.Context, action Action, ops []B
 
 func (b *Bulker) multiDispatch(ctx context.Context, action Action, opts optionsT, ops []BulkOp) ([]respT, error) {
 	var err error
+	defer observe(ctx, action, time.Now())
 
 	ch := make(chan respT, len(ops))
 
 	for i, op := range ops {
 		item := bulkT{
-			i,
-			action,
-			ch,
-			op.Body,
-			opts,
+			idx:    i,
+			action: action,
+			ch:     ch,
+			data:   op.Body,
+			opts:   opts,
 		}
 
 		// Dispatch to bulk Run loop
@@ -101,3 +123,119 @@ LOOP:
 
 	return responses, err
 }
+
+// MSearch queues all the searches before waiting on any of them so they are
+// sent to elastic in the same msearch request. Each search succeeds or fails on
+// its own; a search that misses its deadline fails with
+// context.DeadlineExceeded without affecting the others.
+func (b *Bulker) MSearch(ctx context.Context, ops []SearchOp, opts ...Opt) []SearchResult {
+	opt := b.parseOpts(opts...)
+	start := time.Now()
+	defer observe(ctx, ActionSearch, start)
+
+	results := make([]SearchResult, len(ops))
+	deadlines := make([]time.Time, len(ops))
+	pending := make(map[int]struct{}, len(ops))
+
+	ch := make(chan respT, len(ops))
+
+	for i, op := range ops {
+		// Serialize request
+		const kSlop = 64
+		var buf bytes.Buffer
+		buf.Grow(len(op.Body) + kSlop)
+
+		if err := b.writeMsearchMeta(&buf, op.Index); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if err := b.writeMsearchBody(&buf, op.Body); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		item := bulkT{
+			idx:    i,
+			action: ActionSearch,
+			ch:     ch,
+			data:   buf.Bytes(),
+			opts:   opt,
+		}
+
+		// Dispatch to bulk Run loop
+		select {
+		case b.ch <- item:
+			pending[i] = struct{}{}
+			if op.Timeout > 0 {
+				deadlines[i] = start.Add(op.Timeout)
+			}
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+		}
+	}
+
+	// Wait for responses; the channel is buffered so late responses do not
+	// stall the bulker.
+	timer := time.NewTimer(0)
+	stopTimer(timer)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		now := time.Now()
+		var next time.Time
+		for i := range pending {
+			d := deadlines[i]
+			switch {
+			case d.IsZero():
+			case !d.After(now):
+				results[i].Err = context.DeadlineExceeded
+				delete(pending, i)
+			case next.IsZero() || d.Before(next):
+				next = d
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case resp := <-ch:
+			if _, ok := pending[resp.idx]; ok {
+				results[resp.idx] = searchResult(ops[resp.idx].Index, resp)
+				delete(pending, resp.idx)
+			}
+		case <-timer.C:
+		case <-ctx.Done():
+			for i := range pending {
+				results[i].Err = ctx.Err()
+			}
+			return results
+		}
+		stopTimer(timer)
+	}
+
+	log.Trace().
+		Str("mod", kModBulk).
+		Int("cnt", len(ops)).
+		Dur("rtt", time.Since(start)).
+		Msg("MSearch done")
+
+	return results
+}
+
+func searchResult(index []string, resp respT) SearchResult {
+	if resp.err != nil {
+		var tooLarge *es.ErrDocumentTooLarge
+		if errors.As(resp.err, &tooLarge) {
+			tooLarge.Index = strings.Join(index, ",")
+		}
+		return SearchResult{Err: resp.err}
+	}
+
+	r := resp.data.(*MsearchResponseItem)
+	return SearchResult{Result: &es.ResultT{HitsT: r.Hits, Aggregations: r.Aggregations}}
+}
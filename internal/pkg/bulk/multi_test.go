@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMSearch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b := &Bulker{ch: make(chan bulkT)}
+
+	// Answer the first search, fail the second and never answer the third,
+	// once all three have been queued.
+	go func() {
+		var queue []bulkT
+		for len(queue) < 3 {
+			select {
+			case item := <-b.ch:
+				queue = append(queue, item)
+			case <-ctx.Done():
+				return
+			}
+		}
+		queue[0].ch <- respT{idx: queue[0].idx, data: &MsearchResponseItem{Hits: es.HitsT{Hits: []es.HitT{{Id: "a"}}}}}
+		queue[1].ch <- respT{idx: queue[1].idx, err: es.ErrIndexNotFound}
+	}()
+
+	res := b.MSearch(ctx, []SearchOp{
+		{Index: []string{"one"}, Body: []byte(`{}`)},
+		{Index: []string{"two"}, Body: []byte(`{}`)},
+		{Index: []string{"three"}, Body: []byte(`{}`), Timeout: 50 * time.Millisecond},
+		{Index: []string{"four"}},
+	})
+	require.Len(t, res, 4)
+
+	require.NoError(t, res[0].Err)
+	require.Len(t, res[0].Result.Hits, 1)
+	assert.Equal(t, "a", res[0].Result.Hits[0].Id)
+
+	assert.True(t, errors.Is(res[1].Err, es.ErrIndexNotFound))
+	assert.True(t, errors.Is(res[2].Err, context.DeadlineExceeded))
+	assert.True(t, errors.Is(res[3].Err, es.ErrInvalidBody))
+}
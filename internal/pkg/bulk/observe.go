@@ -0,0 +1,27 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"context"
+	"time"
+)
+
+// Observer is told how long the caller waited on each action it queued to
+// the bulker, such as to break the latency of a request down.
+type Observer func(action Action, d time.Duration)
+
+type observerKey struct{}
+
+// WithObserver returns a context telling obs of the actions queued with it.
+func WithObserver(ctx context.Context, obs Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, obs)
+}
+
+func observe(ctx context.Context, action Action, start time.Time) {
+	if obs, ok := ctx.Value(observerKey{}).(Observer); ok {
+		obs(action, time.Since(start))
+	}
+}
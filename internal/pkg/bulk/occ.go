@@ -0,0 +1,54 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DocMeta is the optimistic concurrency control metadata of a document.
+type DocMeta struct {
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// ModifyFunc returns the new source of a document given its current source.
+// Returning a nil source leaves the document unchanged.
+type ModifyFunc func(src []byte) ([]byte, error)
+
+// ReadModifyWrite reads the document, applies fn and writes the result back
+// conditioned on the document not having changed in the meantime. On version
+// conflict the cycle is repeated, up to maxRetries times, after which the
+// conflict error is returned. A missing document returns es.ErrElasticNotFound.
+func ReadModifyWrite(ctx context.Context, bulker Bulk, index, id string, maxRetries int, fn ModifyFunc, opts ...Opt) error {
+	for attempt := 0; ; attempt++ {
+		src, meta, err := bulker.ReadWithMeta(ctx, index, id)
+		if err != nil {
+			return err
+		}
+
+		body, err := fn(src)
+		if err != nil || body == nil {
+			return err
+		}
+
+		_, err = bulker.Index(ctx, index, id, body, append(opts, WithIfSeqNo(meta))...)
+		if err == nil || !errors.Is(err, es.ErrElasticVersionConflict) || attempt >= maxRetries {
+			return err
+		}
+
+		log.Debug().
+			Str("mod", kModBulk).
+			Str("index", index).
+			Str("id", id).
+			Int("attempt", attempt+1).
+			Msg("Version conflict on read-modify-write; retrying")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// occBulk is an in memory single document store honouring WithIfSeqNo.
+type occBulk struct {
+	Bulk
+	src       []byte
+	meta      DocMeta
+	conflicts int // number of concurrent writes to simulate
+}
+
+func (m *occBulk) ReadWithMeta(ctx context.Context, index, id string, opts ...Opt) ([]byte, DocMeta, error) {
+	if m.src == nil {
+		return nil, DocMeta{}, es.ErrElasticNotFound
+	}
+	return m.src, m.meta, nil
+}
+
+func (m *occBulk) Index(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	var opt optionsT
+	for _, o := range opts {
+		o(&opt)
+	}
+	if m.conflicts > 0 {
+		m.conflicts--
+		m.meta.SeqNo++
+	}
+	if opt.IfMeta != nil && *opt.IfMeta != m.meta {
+		return "", &es.ErrVersionConflict{Index: index, Id: id}
+	}
+	m.src = body
+	m.meta.SeqNo++
+	return id, nil
+}
+
+func TestReadModifyWrite(t *testing.T) {
+	appendX := func(src []byte) ([]byte, error) {
+		return append(append([]byte{}, src...), 'x'), nil
+	}
+
+	tests := []struct {
+		name      string
+		src       []byte
+		conflicts int
+		retries   int
+		fn        ModifyFunc
+		want      []byte
+		err       error
+	}{
+		{name: "no conflict", src: []byte("a"), fn: appendX, want: []byte("ax")},
+		{name: "retried conflict", src: []byte("a"), conflicts: 2, retries: 2, fn: appendX, want: []byte("ax")},
+		{name: "too many conflicts", src: []byte("a"), conflicts: 3, retries: 2, fn: appendX, want: []byte("a"), err: es.ErrElasticVersionConflict},
+		{name: "not found", fn: appendX, err: es.ErrElasticNotFound},
+		{name: "unchanged", src: []byte("a"), fn: func([]byte) ([]byte, error) { return nil, nil }, want: []byte("a")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &occBulk{src: tc.src, conflicts: tc.conflicts}
+			err := ReadModifyWrite(context.Background(), m, "index", "id", tc.retries, tc.fn)
+			if tc.err != nil {
+				require.True(t, errors.Is(err, tc.err), "expected %v, got %v", tc.err, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, m.src)
+		})
+	}
+}
+
+func TestWriteBulkMetaIfSeqNo(t *testing.T) {
+	var b Bulker
+	var buf bytes.Buffer
+
+	opts := b.parseOpts(WithIfSeqNo(DocMeta{SeqNo: 7, PrimaryTerm: 2}))
+	require.NoError(t, b.writeBulkMeta(&buf, ActionUpdate, "index", "id", opts))
+	assert.Equal(t, `{"update":{"_id":"id","if_seq_no":7,"if_primary_term":2,"_index":"index"}}`+"\n", buf.String())
+}
@@ -6,6 +6,8 @@ package bulk
 
 import (
 	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 )
 
 //-----
@@ -14,6 +16,7 @@ import (
 type optionsT struct {
 	Refresh         bool
 	RetryOnConflict int
+	IfMeta          *DocMeta
 }
 
 type Opt func(*optionsT)
@@ -30,6 +33,14 @@ func WithRetryOnConflict(n int) Opt {
 	}
 }
 
+// WithIfSeqNo makes an index or update conditional on the document still
+// being at the sequence number and primary term it was read with.
+func WithIfSeqNo(meta DocMeta) Opt {
+	return func(opt *optionsT) {
+		opt.IfMeta = &meta
+	}
+}
+
 //-----
 // Bulk API options
 
@@ -39,6 +50,12 @@ type bulkOptT struct {
 	flushThresholdSz  int
 	maxPending        int
 	queuePrealloc     int
+	maxDocumentSize   int
+	retryMax          int
+	retryBackoff      time.Duration
+	retryMaxBackoff   time.Duration
+	retryRate         float64
+	flushTuning       config.BulkFlushTuning
 }
 
 type BulkOpt func(*bulkOptT)
@@ -70,3 +87,35 @@ func WithMaxPending(max int) BulkOpt {
 		opt.maxPending = max
 	}
 }
+
+// Max size of a single document or search response read from elastic; zero is unlimited
+func WithMaxDocumentSize(sz int) BulkOpt {
+	return func(opt *bulkOptT) {
+		opt.maxDocumentSize = sz
+	}
+}
+
+// Retries of the items rejected with a 429, flushed again after a backoff
+// doubling from backoff up to maxBackoff; zero retries fails them at once
+func WithRetry(max int, backoff, maxBackoff time.Duration) BulkOpt {
+	return func(opt *bulkOptT) {
+		opt.retryMax = max
+		opt.retryBackoff = backoff
+		opt.retryMaxBackoff = maxBackoff
+	}
+}
+
+// Max number of items retried per second; zero is unlimited
+func WithRetryRate(rate float64) BulkOpt {
+	return func(opt *bulkOptT) {
+		opt.retryRate = rate
+	}
+}
+
+// Tunes the flush interval and max pending to the workload when enabled,
+// overriding WithFlushInterval and WithMaxPending
+func WithFlushTuning(cfg config.BulkFlushTuning) BulkOpt {
+	return func(opt *bulkOptT) {
+		opt.flushTuning = cfg
+	}
+}
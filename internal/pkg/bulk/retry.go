@@ -0,0 +1,113 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// retryQueue re-enqueues the bulk items rejected by Elasticsearch with a 429,
+// rather than failing their callers. An item is flushed again after a backoff
+// doubling with its attempts, up to maxRetries times, and ahead of the items
+// queued since. The re-enqueues are rate limited so a cluster pushing back is
+// not flooded with retries.
+type retryQueue struct {
+	depth     int64  // atomic; items waiting to be flushed again
+	retried   uint64 // atomic
+	exhausted uint64 // atomic; items failed once out of retries
+
+	ch         chan bulkT
+	limiter    *rate.Limiter
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// RetryStats are the counters of the bulk items retried.
+type RetryStats struct {
+	Depth     int64  // items waiting to be flushed again
+	Retried   uint64 // retries of the items rejected
+	Exhausted uint64 // items failed once out of retries
+}
+
+// configure sets the retries up before the bulker runs.
+func (q *retryQueue) configure(opts bulkOptT) {
+	q.ch = make(chan bulkT)
+	q.maxRetries = opts.retryMax
+	q.backoff = opts.retryBackoff
+	q.maxBackoff = opts.retryMaxBackoff
+
+	limit := rate.Inf
+	if opts.retryRate > 0 {
+		limit = rate.Limit(opts.retryRate)
+	}
+	q.limiter = rate.NewLimiter(limit, 1)
+}
+
+// retry re-enqueues the item once its backoff elapsed; false when the item
+// has no retries left and must fail.
+func (q *retryQueue) retry(ctx context.Context, item bulkT) bool {
+	if item.retries >= q.maxRetries {
+		if q.maxRetries > 0 {
+			atomic.AddUint64(&q.exhausted, 1)
+		}
+		return false
+	}
+	item.retries++
+
+	atomic.AddInt64(&q.depth, 1)
+	atomic.AddUint64(&q.retried, 1)
+	go func() {
+		defer atomic.AddInt64(&q.depth, -1)
+
+		err := q.wait(ctx, item.retries)
+		if err == nil {
+			select {
+			case q.ch <- item:
+				return
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		log.Debug().Err(err).Str("mod", kModBulk).Int("retries", item.retries).Msg("Bulk item retry aborted")
+		item.ch <- respT{idx: item.idx, err: err}
+	}()
+	return true
+}
+
+func (q *retryQueue) wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(q.delay(attempt))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return q.limiter.Wait(ctx)
+}
+
+// delay returns the backoff of the attempt, half of it jittered.
+func (q *retryQueue) delay(attempt int) time.Duration {
+	d := q.backoff << uint(attempt-1)
+	if d <= 0 || d > q.maxBackoff {
+		d = q.maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (q *retryQueue) stats() RetryStats {
+	return RetryStats{
+		Depth:     atomic.LoadInt64(&q.depth),
+		Retried:   atomic.LoadUint64(&q.retried),
+		Exhausted: atomic.LoadUint64(&q.exhausted),
+	}
+}
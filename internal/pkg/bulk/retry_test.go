@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryQueueDelay(t *testing.T) {
+	var q retryQueue
+	q.configure(bulkOptT{retryMax: 5, retryBackoff: 100 * time.Millisecond, retryMaxBackoff: time.Second})
+
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		d := q.delay(attempt + 1)
+		assert.True(t, d >= max/2 && d <= max, "attempt %d: %s", attempt+1, d)
+	}
+}
+
+func TestRetryQueue(t *testing.T) {
+	var q retryQueue
+	q.configure(bulkOptT{retryMax: 2, retryBackoff: time.Millisecond, retryMaxBackoff: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	item := bulkT{idx: 3, ch: make(chan respT, 1)}
+	for i := 1; i <= 2; i++ {
+		require.True(t, q.retry(ctx, item))
+		select {
+		case item = <-q.ch:
+		case <-time.After(time.Second):
+			t.Fatal("item not retried")
+		}
+		assert.Equal(t, i, item.retries)
+	}
+	assert.False(t, q.retry(ctx, item), "out of retries")
+	stats := q.stats()
+	assert.Equal(t, uint64(2), stats.Retried)
+	assert.Equal(t, uint64(1), stats.Exhausted)
+	assert.Eventually(t, func() bool { return q.stats().Depth == 0 }, time.Second, time.Millisecond)
+
+	// Aborted retries respond to the caller
+	q.configure(bulkOptT{retryMax: 1, retryBackoff: time.Hour, retryMaxBackoff: time.Hour})
+	item = bulkT{idx: 3, ch: make(chan respT, 1)}
+	require.True(t, q.retry(ctx, item))
+	cancel()
+	select {
+	case resp := <-item.ch:
+		assert.Equal(t, 3, resp.idx)
+		assert.True(t, errors.Is(resp.err, context.Canceled))
+	case <-time.After(time.Second):
+		t.Fatal("aborted retry not responded")
+	}
+}
@@ -6,6 +6,8 @@ package bulk
 
 import (
 	"encoding/json"
+	"errors"
+
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 )
 
@@ -17,13 +19,13 @@ type BulkIndexerResponse struct {
 
 // Comment out fields we don't use; no point decoding.
 type BulkIndexerResponseItem struct {
-	//	Index      string `json:"_index"`
+	Index      string `json:"_index"`
 	DocumentID string `json:"_id"`
 	//	Version    int64  `json:"_version"`
 	//	Result     string `json:"result"`
-	Status int `json:"status"`
-	//	SeqNo      int64  `json:"_seq_no"`
-	//	PrimTerm   int64  `json:"_primary_term"`
+	Status   int   `json:"status"`
+	SeqNo    int64 `json:"_seq_no"`
+	PrimTerm int64 `json:"_primary_term"`
 
 	//	Shards struct {
 	//		Total      int `json:"total"`
@@ -44,9 +46,9 @@ type MgetResponseItem struct {
 	//	Type       string          `json:"_type"`
 	//	DocumentID string          `json:"_id"`
 	//	Version    int64           `json:"_version"`
-	//	SeqNo      int64           `json:"_seq_no"`
-	//	PrimTerm   int64           `json:"_primary_term"`
-	Found bool `json:"found"`
+	SeqNo    int64 `json:"_seq_no"`
+	PrimTerm int64 `json:"_primary_term"`
+	Found    bool  `json:"found"`
 	//	Routing    string          `json:"_routing"`
 	Source json.RawMessage `json:"_source"`
 	//	Fields     json.RawMessage `json:"_fields"`
@@ -81,7 +83,14 @@ type MsearchResponse struct {
 }
 
 func (b *BulkIndexerResponseItem) deriveError() error {
-	return es.TranslateError(b.Status, b.Error)
+	err := es.TranslateError(b.Status, b.Error)
+
+	var conflict *es.ErrVersionConflict
+	if errors.As(err, &conflict) {
+		conflict.Index = b.Index
+		conflict.Id = b.DocumentID
+	}
+	return err
 }
 
 func (b *MsearchResponseItem) deriveError() error {
@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"encoding/json"
+)
+
+const scriptLangPainless = "painless"
+
+const (
+	scriptIncrement = "if (ctx._source[params.field] == null) { ctx._source[params.field] = params.value } else { ctx._source[params.field] += params.value }"
+	scriptAppend    = "if (ctx._source[params.field] == null) { ctx._source[params.field] = new ArrayList() } ctx._source[params.field].addAll(params.values)"
+)
+
+// UpdateScript is the body of a scripted update. The script is executed by
+// Elasticsearch on the shard that holds the document, so concurrent updates
+// from several Fleet Servers are applied one after the other instead of
+// overwriting each other.
+type UpdateScript struct {
+	Source string
+	Params map[string]interface{}
+
+	// Upsert is indexed as is when the document does not exist; if nil the
+	// update fails with es.ErrElasticNotFound instead.
+	Upsert interface{}
+}
+
+func (s UpdateScript) Marshal() ([]byte, error) {
+	type script struct {
+		Source string                 `json:"source"`
+		Lang   string                 `json:"lang"`
+		Params map[string]interface{} `json:"params,omitempty"`
+	}
+
+	doc := struct {
+		Script script      `json:"script"`
+		Upsert interface{} `json:"upsert,omitempty"`
+	}{
+		script{s.Source, scriptLangPainless, s.Params},
+		s.Upsert,
+	}
+
+	return json.Marshal(doc)
+}
+
+// IncrementField returns a script that adds delta to the numeric field,
+// initializing the field to delta when it is not set.
+func IncrementField(field string, delta int64) UpdateScript {
+	return UpdateScript{
+		Source: scriptIncrement,
+		Params: map[string]interface{}{
+			"field": field,
+			"value": delta,
+		},
+	}
+}
+
+// AppendField returns a script that appends values to the array field,
+// creating the array when it is not set.
+func AppendField(field string, values ...interface{}) UpdateScript {
+	if values == nil {
+		values = []interface{}{}
+	}
+	return UpdateScript{
+		Source: scriptAppend,
+		Params: map[string]interface{}{
+			"field":  field,
+			"values": values,
+		},
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateScriptMarshal(t *testing.T) {
+	tests := []struct {
+		name   string
+		script UpdateScript
+		want   string
+	}{
+		{
+			name:   "source only",
+			script: UpdateScript{Source: "ctx.op = 'noop'"},
+			want:   `{"script":{"source":"ctx.op = 'noop'","lang":"painless"}}`,
+		},
+		{
+			name:   "increment",
+			script: IncrementField("uses", 2),
+			want:   `{"script":{"source":` + jsonString(scriptIncrement) + `,"lang":"painless","params":{"field":"uses","value":2}}}`,
+		},
+		{
+			name:   "append",
+			script: AppendField("action_seq_no", 3, 4),
+			want:   `{"script":{"source":` + jsonString(scriptAppend) + `,"lang":"painless","params":{"field":"action_seq_no","values":[3,4]}}}`,
+		},
+		{
+			name: "upsert",
+			script: UpdateScript{
+				Source: scriptIncrement,
+				Params: map[string]interface{}{"field": "count", "value": 1},
+				Upsert: map[string]interface{}{"count": 1},
+			},
+			want: `{"script":{"source":` + jsonString(scriptIncrement) + `,"lang":"painless","params":{"field":"count","value":1}},"upsert":{"count":1}}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := tc.script.Marshal()
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(body))
+		})
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// Weight of the last measure in the moving averages of the tuner
+const kTuneAlpha = 0.3
+
+// flushTuner tunes the flush interval and the max pending flushes of the
+// bulker, between the bounds of its configuration, to the arrival rate of
+// the items and the latency of the flushes. The bulker counts the arrivals
+// and tunes from its run loop; the flushes report their latency as they end.
+type flushTuner struct {
+	interval   int64 // atomic; flush interval in use
+	maxPending int64 // atomic; max pending flushes in use
+
+	cfg config.BulkFlushTuning
+
+	mut     sync.Mutex
+	rate    float64 // items per second
+	latency float64 // seconds per flush
+}
+
+// FlushStats are the flush settings of the bulker, and the workload they were
+// tuned to.
+type FlushStats struct {
+	Interval   time.Duration
+	MaxPending int
+	Rate       float64 // items per second
+	Latency    time.Duration
+}
+
+// configure sets the static settings the bulker starts with.
+func (t *flushTuner) configure(opts bulkOptT) {
+	t.cfg = opts.flushTuning
+	t.set(opts.flushInterval, opts.maxPending)
+}
+
+func (t *flushTuner) enabled() bool {
+	return t.cfg.Enabled
+}
+
+// observe records the latency of a flush.
+func (t *flushTuner) observe(rtt time.Duration) {
+	t.mut.Lock()
+	t.latency = ewma(t.latency, rtt.Seconds())
+	t.mut.Unlock()
+}
+
+// tune records the items arrived over elapsed and returns the flush interval
+// and max pending flushes suited to the workload, for the bulker to set.
+func (t *flushTuner) tune(arrivals int, elapsed time.Duration) (time.Duration, int) {
+	t.mut.Lock()
+	if elapsed > 0 {
+		t.rate = ewma(t.rate, float64(arrivals)/elapsed.Seconds())
+	}
+	rateLoad := math.Min(t.rate/t.cfg.HighRate, 1)
+	latencyLoad := math.Min(t.latency/t.cfg.HighLatency.Seconds(), 1)
+	t.mut.Unlock()
+
+	load := math.Max(rateLoad, latencyLoad)
+	interval := t.cfg.MinInterval + time.Duration(load*float64(t.cfg.MaxInterval-t.cfg.MinInterval))
+	maxPending := t.cfg.MinPending + int(math.Round(rateLoad*(1-latencyLoad)*float64(t.cfg.MaxPending-t.cfg.MinPending)))
+	return interval, maxPending
+}
+
+// set records the flush settings in use.
+func (t *flushTuner) set(interval time.Duration, maxPending int) {
+	atomic.StoreInt64(&t.interval, int64(interval))
+	atomic.StoreInt64(&t.maxPending, int64(maxPending))
+}
+
+func (t *flushTuner) stats() FlushStats {
+	t.mut.Lock()
+	rate, latency := t.rate, t.latency
+	t.mut.Unlock()
+
+	return FlushStats{
+		Interval:   time.Duration(atomic.LoadInt64(&t.interval)),
+		MaxPending: int(atomic.LoadInt64(&t.maxPending)),
+		Rate:       rate,
+		Latency:    time.Duration(latency * float64(time.Second)),
+	}
+}
+
+func ewma(avg, v float64) float64 {
+	return avg + kTuneAlpha*(v-avg)
+}
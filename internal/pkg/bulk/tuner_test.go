@@ -0,0 +1,49 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestFlushTuner(t *testing.T) {
+	var cfg config.BulkFlushTuning
+	cfg.InitDefaults()
+	cfg.Enabled = true
+
+	tests := []struct {
+		name       string
+		arrivals   int
+		latency    time.Duration
+		interval   time.Duration
+		maxPending int
+	}{
+		{"idle", 0, 0, cfg.MinInterval, cfg.MinPending},
+		{"loaded", 100000, 5 * time.Millisecond, cfg.MaxInterval, cfg.MaxPending},
+		{"slow", 0, 10 * time.Second, cfg.MaxInterval, cfg.MinPending},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tuner flushTuner
+			tuner.configure(bulkOptT{flushTuning: cfg})
+
+			var interval time.Duration
+			var maxPending int
+			for i := 0; i < 50; i++ {
+				tuner.observe(test.latency)
+				interval, maxPending = tuner.tune(test.arrivals, time.Second)
+			}
+			assert.InDelta(t, float64(test.interval), float64(interval), float64(10*time.Millisecond))
+			assert.Equal(t, test.maxPending, maxPending)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Validator is a Bulk that validates the documents written to the indices of
+// its schemas and refuses with *es.ErrMappingViolation the writes that do not
+// match them, before they reach Elasticsearch. The partial documents and the
+// upserts of the updates are validated. Of the scripts, the fields they assign
+// by name must be in the mapping, and the values of the field scripts of
+// IncrementField and AppendField must match it; the values the other scripts
+// assign from their params are not validated.
+//
+// The operations of a MUpdate are validated before any is written, so an
+// invalid one refuses them all.
+type Validator struct {
+	Bulk
+	schemas map[string]*es.Schema
+
+	refused uint64
+}
+
+// NewValidator validates the writes of b to the indices of schemas.
+func NewValidator(b Bulk, schemas map[string]*es.Schema) *Validator {
+	return &Validator{
+		Bulk:    b,
+		schemas: schemas,
+	}
+}
+
+// Refused returns the number of writes refused.
+func (v *Validator) Refused() uint64 {
+	return atomic.LoadUint64(&v.refused)
+}
+
+func (v *Validator) Create(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	if err := v.validate(index, id, body); err != nil {
+		return "", err
+	}
+	return v.Bulk.Create(ctx, index, id, body, opts...)
+}
+
+func (v *Validator) Index(ctx context.Context, index, id string, body []byte, opts ...Opt) (string, error) {
+	if err := v.validate(index, id, body); err != nil {
+		return "", err
+	}
+	return v.Bulk.Index(ctx, index, id, body, opts...)
+}
+
+func (v *Validator) Update(ctx context.Context, index, id string, body []byte, opts ...Opt) error {
+	if err := v.validateUpdate(index, id, body); err != nil {
+		return err
+	}
+	return v.Bulk.Update(ctx, index, id, body, opts...)
+}
+
+func (v *Validator) MUpdate(ctx context.Context, ops []BulkOp, opts ...Opt) error {
+	for _, op := range ops {
+		if err := v.validateUpdate(op.Index, op.Id, op.Body); err != nil {
+			return err
+		}
+	}
+	return v.Bulk.MUpdate(ctx, ops, opts...)
+}
+
+func (v *Validator) validate(index, id string, doc []byte) error {
+	schema, ok := v.schemas[index]
+	if !ok {
+		return nil
+	}
+	return v.refuse(index, id, schema.Validate(doc))
+}
+
+func (v *Validator) validateUpdate(index, id string, body []byte) error {
+	schema, ok := v.schemas[index]
+	if !ok {
+		return nil
+	}
+
+	var update struct {
+		Doc    json.RawMessage `json:"doc"`
+		Upsert json.RawMessage `json:"upsert"`
+		Script *struct {
+			Source string                 `json:"source"`
+			Params map[string]interface{} `json:"params"`
+		} `json:"script"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return v.refuse(index, id, &es.ErrMappingViolation{Reason: "invalid update: " + err.Error()})
+	}
+	docs := []json.RawMessage{update.Doc, update.Upsert}
+	if update.Script != nil {
+		doc, err := json.Marshal(scriptFields(update.Script.Source, update.Script.Params))
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+	for _, doc := range docs {
+		if len(doc) == 0 || string(doc) == "null" {
+			continue
+		}
+		if err := v.refuse(index, id, schema.Validate(doc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refuse counts and logs the violation, setting its index and id.
+func (v *Validator) refuse(index, id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	atomic.AddUint64(&v.refused, 1)
+
+	var violation *es.ErrMappingViolation
+	if errors.As(err, &violation) {
+		violation.Index = index
+		violation.Id = id
+	}
+	log.Warn().Err(err).Str("index", index).Str("id", id).Msg("Write refused by schema validation")
+	return err
+}
+
+// scriptSourceField matches the fields of the document a script refers to by
+// name, as ctx._source.name or ctx._source['name'].
+var scriptSourceField = regexp.MustCompile(`ctx\._source(?:\.([\w@]+)|\[\s*'([^']+)'\s*\])`)
+
+// scriptFields returns the partial document of the fields the script assigns.
+// The fields referred to by name are set to null, accepted for any field of
+// the mapping; the field of a field script is set to its value.
+func scriptFields(source string, params map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, m := range scriptSourceField.FindAllStringSubmatch(source, -1) {
+		name := m[1]
+		if name == "" {
+			name = m[2]
+		}
+		fields[name] = nil
+	}
+
+	if field, ok := params["field"].(string); ok {
+		switch source {
+		case scriptIncrement:
+			fields[field] = params["value"]
+		case scriptAppend:
+			fields[field] = params["values"]
+		}
+	}
+	return fields
+}
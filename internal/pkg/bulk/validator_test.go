@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package bulk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator(t *testing.T) {
+	schema, err := es.NewSchema(es.MappingAgent)
+	require.NoError(t, err)
+
+	mem := newMemBulk()
+	v := NewValidator(mem, map[string]*es.Schema{".fleet-agents": schema})
+	ctx := context.Background()
+
+	_, err = v.Create(ctx, ".fleet-agents", "a1", []byte(`{"active":true,"policy_id":"p1"}`))
+	require.NoError(t, err)
+	require.NoError(t, v.Update(ctx, ".fleet-agents", "a1", []byte(`{"doc":{"policy_id":"p2","unenrolled_at":null}}`)))
+	require.NoError(t, v.Update(ctx, ".fleet-agents", "a1", []byte(`{"script":{"source":"ctx._source.policy_id = params.id","params":{"id":"p2"}}}`)))
+	_, err = v.Index(ctx, ".fleet-servers", "s1", []byte(`{"not_mapped":1}`))
+	require.NoError(t, err, "index without schema")
+
+	_, err = v.Create(ctx, ".fleet-agents", "a2", []byte(`{"active":"yes"}`))
+	var violation *es.ErrMappingViolation
+	require.True(t, errors.As(err, &violation))
+	assert.Equal(t, ".fleet-agents", violation.Index)
+	assert.Equal(t, "a2", violation.Id)
+	assert.Equal(t, "active", violation.Field)
+	assert.Nil(t, mem.get(".fleet-agents", "a2"))
+
+	err = v.Update(ctx, ".fleet-agents", "a1", []byte(`{"script":{"source":""},"upsert":{"new_field":1}}`))
+	assert.True(t, errors.Is(err, es.ErrElasticMappingViolation))
+
+	// The fields assigned by the scripts
+	err = v.Update(ctx, ".fleet-agents", "a1", []byte(`{"script":{"source":"ctx._source['new_field'] = 1"}}`))
+	require.True(t, errors.As(err, &violation))
+	assert.Equal(t, "new_field", violation.Field)
+	body, err := IncrementField("policy_revision_idx", 1).Marshal()
+	require.NoError(t, err)
+	require.NoError(t, v.Update(ctx, ".fleet-agents", "a1", body))
+	body, err = AppendField("tags", map[string]interface{}{"a": 1}).Marshal()
+	require.NoError(t, err)
+	err = v.Update(ctx, ".fleet-agents", "a1", body)
+	require.True(t, errors.As(err, &violation))
+	assert.Equal(t, "tags", violation.Field)
+
+	// An invalid operation refuses the others
+	err = v.MUpdate(ctx, []BulkOp{
+		{Index: ".fleet-agents", Id: "a1", Body: []byte(`{"doc":{"policy_id":"p3"}}`)},
+		{Index: ".fleet-agents", Id: "a1", Body: []byte(`{"doc":{"policy_id":{"id":"p3"}}}`)},
+	})
+	assert.True(t, errors.Is(err, es.ErrElasticMappingViolation))
+	assert.JSONEq(t, `{"active":true,"policy_id":"p2","unenrolled_at":null}`, string(mem.get(".fleet-agents", "a1")))
+
+	assert.Equal(t, uint64(5), v.Refused())
+}
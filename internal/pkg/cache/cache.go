@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/dgraph-io/ristretto"
 	"github.com/rs/zerolog/log"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
@@ -18,44 +17,255 @@ import (
 type ApiKey = apikey.ApiKey
 type SecurityInfo = apikey.SecurityInfo
 
+// Segment names; each segment is sized and evicted independently so a burst
+// of large artifacts does not push the API keys out of the cache.
+const (
+	SegmentApiKeys        = "api_keys"
+	SegmentEnrollmentKeys = "enrollment_keys"
+	SegmentArtifacts      = "artifacts"
+	SegmentActions        = "actions"
+	SegmentAuthFailures   = "auth_failures"
+	SegmentAgents         = "agents"
+)
+
+var segments = []string{
+	SegmentApiKeys,
+	SegmentEnrollmentKeys,
+	SegmentArtifacts,
+	SegmentActions,
+	SegmentAuthFailures,
+	SegmentAgents,
+}
+
 type Cache struct {
-	cache *ristretto.Cache
+	actionTTL       time.Duration
+	actionTTLByType map[string]time.Duration
+
+	apiKeys        *segmentT
+	enrollmentKeys *segmentT
+	artifacts      *segmentT
+	actions        *segmentT
+	authFailures   *segmentT
+	agents         *segmentT
 }
 
 type Config struct {
 	NumCounters int64 // number of keys to track frequency of
 	MaxCost     int64 // maximum cost of cache in 'cost' units
+
+	// Per segment settings; zero values use NumCounters, and split MaxCost
+	// evenly with the other segments not given a MaxCost of their own.
+	ApiKeys        SegmentConfig
+	EnrollmentKeys SegmentConfig
+	Artifacts      SegmentConfig
+	Actions        SegmentConfig
+	AuthFailures   SegmentConfig
+	Agents         SegmentConfig
+
+	// How long the actions are cached, per type; zero caches them for
+	// a minute.
+	ActionTTL       time.Duration
+	ActionTTLByType map[string]time.Duration
+}
+
+const defaultActionTTL = time.Minute
+
+type SegmentConfig struct {
+	NumCounters int64
+	MaxCost     int64
+}
+
+func (cfg Config) segment(seg SegmentConfig) SegmentConfig {
+	if seg.NumCounters == 0 {
+		seg.NumCounters = cfg.NumCounters
+	}
+	if seg.MaxCost == 0 {
+		seg.MaxCost = cfg.sharedMaxCost()
+	}
+	return seg
+}
+
+// sharedMaxCost is the share of MaxCost of each segment not given a MaxCost
+// of its own, so together they hold at most MaxCost.
+func (cfg Config) sharedMaxCost() int64 {
+	var shared int64
+	for _, seg := range []SegmentConfig{cfg.ApiKeys, cfg.EnrollmentKeys, cfg.Artifacts, cfg.Actions, cfg.AuthFailures, cfg.Agents} {
+		if seg.MaxCost == 0 {
+			shared++
+		}
+	}
+	if shared == 0 {
+		return cfg.MaxCost
+	}
+	// Ristretto refuses a zero max cost
+	if c := cfg.MaxCost / shared; c > 0 {
+		return c
+	}
+	return 1
+}
+
+// Stats are the counters of a cache segment since it was created.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	KeysAdded   uint64
+	KeysEvicted uint64
+	Entries     uint64 // approximate keys currently held
+	Cost        uint64 // approximate cost currently held
+	MaxCost     int64
+}
+
+// AuthFailure is a failed authentication of an API key.
+type AuthFailure struct {
+	Err   error
+	Count int       // consecutive failures
+	Until time.Time // authentication is not retried before then
+}
+
+type authFailureCache struct {
+	key     string
+	failure AuthFailure
+}
+
+type agentCache struct {
+	key   string
+	agent model.Agent
 }
 
 type actionCache struct {
 	actionId   string
 	actionType string
+	inputType  string
 }
 
 // New creates a new cache.
 func New(cfg Config) (Cache, error) {
-	rcfg := &ristretto.Config{
-		NumCounters: cfg.NumCounters,
-		MaxCost:     cfg.MaxCost,
-		BufferItems: 64,
+	c := Cache{
+		actionTTL:       cfg.ActionTTL,
+		actionTTLByType: cfg.ActionTTLByType,
+	}
+	if c.actionTTL == 0 {
+		c.actionTTL = defaultActionTTL
 	}
+	var err error
 
-	cache, err := ristretto.NewCache(rcfg)
-	return Cache{cache}, err
+	if c.apiKeys, err = newSegment(cfg.segment(cfg.ApiKeys)); err != nil {
+		return c, err
+	}
+	if c.enrollmentKeys, err = newSegment(cfg.segment(cfg.EnrollmentKeys)); err != nil {
+		return c, err
+	}
+	if c.artifacts, err = newSegment(cfg.segment(cfg.Artifacts)); err != nil {
+		return c, err
+	}
+	if c.actions, err = newSegment(cfg.segment(cfg.Actions)); err != nil {
+		return c, err
+	}
+	if c.authFailures, err = newSegment(cfg.segment(cfg.AuthFailures)); err != nil {
+		return c, err
+	}
+	if c.agents, err = newSegment(cfg.segment(cfg.Agents)); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// Resize returns the cache sized after cfg. The segments whose sizing does not
+// change are kept as they are. The others are replaced by segments of the new
+// size, which take over the entries of the old ones as they are read: the old
+// segments are read from until their entries expire, then closed, so a resize
+// does not drop the cached API keys and have every agent authenticated again.
+func (c Cache) Resize(cfg Config) (Cache, error) {
+	r := Cache{
+		actionTTL:       cfg.ActionTTL,
+		actionTTLByType: cfg.ActionTTLByType,
+	}
+	if r.actionTTL == 0 {
+		r.actionTTL = defaultActionTTL
+	}
+	var err error
+
+	if r.apiKeys, err = c.apiKeys.resize(cfg.segment(cfg.ApiKeys)); err != nil {
+		return c, err
+	}
+	if r.enrollmentKeys, err = c.enrollmentKeys.resize(cfg.segment(cfg.EnrollmentKeys)); err != nil {
+		return c, err
+	}
+	if r.artifacts, err = c.artifacts.resize(cfg.segment(cfg.Artifacts)); err != nil {
+		return c, err
+	}
+	if r.actions, err = c.actions.resize(cfg.segment(cfg.Actions)); err != nil {
+		return c, err
+	}
+	if r.authFailures, err = c.authFailures.resize(cfg.segment(cfg.AuthFailures)); err != nil {
+		return c, err
+	}
+	if r.agents, err = c.agents.resize(cfg.segment(cfg.Agents)); err != nil {
+		return c, err
+	}
+	return r, nil
+}
+
+func (c Cache) segment(name string) *segmentT {
+	switch name {
+	case SegmentApiKeys:
+		return c.apiKeys
+	case SegmentEnrollmentKeys:
+		return c.enrollmentKeys
+	case SegmentArtifacts:
+		return c.artifacts
+	case SegmentActions:
+		return c.actions
+	case SegmentAuthFailures:
+		return c.authFailures
+	case SegmentAgents:
+		return c.agents
+	}
+	return nil
+}
+
+// Segments returns the names of the cache segments.
+func (c Cache) Segments() []string {
+	return segments
+}
+
+// Stats returns the counters of the named segment.
+func (c Cache) Stats(name string) (Stats, bool) {
+	seg := c.segment(name)
+	if seg == nil {
+		return Stats{}, false
+	}
+
+	m := seg.cache.Metrics
+	stats := Stats{
+		Hits:        m.Hits(),
+		Misses:      m.Misses(),
+		KeysAdded:   m.KeysAdded(),
+		KeysEvicted: m.KeysEvicted(),
+		MaxCost:     seg.maxCost,
+	}
+	if stats.KeysAdded > stats.KeysEvicted {
+		stats.Entries = stats.KeysAdded - stats.KeysEvicted
+	}
+	if added, evicted := m.CostAdded(), m.CostEvicted(); added > evicted {
+		stats.Cost = added - evicted
+	}
+	return stats, true
 }
 
 // SetAction sets an action in the cache.
 //
-// This will only cache the action ID and action Type. So `GetAction` will only
-// return a `model.Action` with `ActionId` and `Type` set.
+// This will only cache the action ID, action Type and InputType. So `GetAction`
+// will only return a `model.Action` with `ActionId`, `Type` and `InputType` set.
 func (c Cache) SetAction(action model.Action, ttl time.Duration) {
 	scopedKey := "action:" + action.ActionId
 	v := actionCache{
 		actionId:   action.ActionId,
 		actionType: action.Type,
+		inputType:  action.InputType,
 	}
-	cost := len(action.ActionId) + len(action.Type)
-	ok := c.cache.SetWithTTL(scopedKey, v, int64(cost), ttl)
+	cost := len(action.ActionId) + len(action.Type) + len(action.InputType)
+	ok := c.actions.SetWithTTL(scopedKey, v, int64(cost), ttl)
 	log.Trace().
 		Bool("ok", ok).
 		Str("id", action.ActionId).
@@ -63,13 +273,21 @@ func (c Cache) SetAction(action model.Action, ttl time.Duration) {
 		Msg("Action cache SET")
 }
 
+// ActionTTL returns how long the actions of the type are cached.
+func (c Cache) ActionTTL(actionType string) time.Duration {
+	if ttl, ok := c.actionTTLByType[actionType]; ok {
+		return ttl
+	}
+	return c.actionTTL
+}
+
 // GetAction returns an action from the cache.
 //
-// This will only return a `model.Action` with the action ID and action Type set.
-// This is because `SetAction` So `GetAction` will only cache the action ID and action Type.
+// This will only return a `model.Action` with the action ID, action Type and
+// InputType set, as `SetAction` only caches those.
 func (c Cache) GetAction(id string) (model.Action, bool) {
 	scopedKey := "action:" + id
-	if v, ok := c.cache.Get(scopedKey); ok {
+	if v, ok := c.actions.Get(scopedKey); ok {
 		log.Trace().Str("id", id).Msg("Action cache HIT")
 		action, ok := v.(actionCache)
 		if !ok {
@@ -77,8 +295,9 @@ func (c Cache) GetAction(id string) (model.Action, bool) {
 			return model.Action{}, false
 		}
 		return model.Action{
-			ActionId: action.actionId,
-			Type:     action.actionType,
+			ActionId:  action.actionId,
+			Type:      action.actionType,
+			InputType: action.inputType,
 		}, ok
 	}
 
@@ -88,9 +307,9 @@ func (c Cache) GetAction(id string) (model.Action, bool) {
 
 // SetApiKey sets the API key in the cache.
 func (c Cache) SetApiKey(key ApiKey, ttl time.Duration) {
-	scopedKey := "api:" + key.Id
-	cost := len(scopedKey) + len(key.Key)
-	ok := c.cache.SetWithTTL(scopedKey, key.Key, int64(cost), ttl)
+	scopedKey := apiKeyHash(scopeApiKey, key)
+	cost := hashKeyCost + len(key.Key)
+	ok := c.apiKeys.SetWithTTL(scopedKey, key.Key, int64(cost), ttl)
 	log.Trace().
 		Bool("ok", ok).
 		Str("key", key.Id).
@@ -101,8 +320,7 @@ func (c Cache) SetApiKey(key ApiKey, ttl time.Duration) {
 
 // ValidApiKey returns true if the ApiKey is valid (aka. also present in cache).
 func (c Cache) ValidApiKey(key ApiKey) bool {
-	scopedKey := "api:" + key.Id
-	v, ok := c.cache.Get(scopedKey)
+	v, ok := c.apiKeys.Get(apiKeyHash(scopeApiKey, key))
 	if ok {
 		if v == key.Key {
 			log.Trace().Str("id", key.Id).Msg("ApiKey cache HIT")
@@ -116,10 +334,164 @@ func (c Cache) ValidApiKey(key ApiKey) bool {
 	return ok
 }
 
+// SetOperator records that the API key was granted the privileges of the
+// operator APIs.
+func (c Cache) SetOperator(key ApiKey, ttl time.Duration) {
+	scopedKey := apiKeyHash(scopeOperator, key)
+	cost := hashKeyCost + len(key.Key)
+	ok := c.apiKeys.SetWithTTL(scopedKey, key.Key, int64(cost), ttl)
+	log.Trace().
+		Bool("ok", ok).
+		Str("key", key.Id).
+		Dur("ttl", ttl).
+		Int("cost", cost).
+		Msg("Operator cache SET")
+}
+
+// ValidOperator returns true if the API key was recorded as granted the
+// privileges of the operator APIs, with the same secret.
+func (c Cache) ValidOperator(key ApiKey) bool {
+	v, ok := c.apiKeys.Get(apiKeyHash(scopeOperator, key))
+	if ok && v != key.Key {
+		log.Trace().Str("id", key.Id).Msg("Operator cache MISMATCH")
+		return false
+	}
+	return ok
+}
+
+// SetAuthFailure records a failed authentication of the API key.
+func (c Cache) SetAuthFailure(key ApiKey, failure AuthFailure, ttl time.Duration) {
+	scopedKey := apiKeyHash(scopeAuthFailure, key)
+	v := authFailureCache{
+		key:     key.Key,
+		failure: failure,
+	}
+	cost := hashKeyCost + len(key.Key) + len(failure.Err.Error())
+	ok := c.authFailures.SetWithTTL(scopedKey, v, int64(cost), ttl)
+	log.Trace().
+		Bool("ok", ok).
+		Str("key", key.Id).
+		Int("count", failure.Count).
+		Time("until", failure.Until).
+		Dur("ttl", ttl).
+		Int("cost", cost).
+		Msg("AuthFailure cache SET")
+}
+
+// GetAuthFailure returns the last failed authentication of the API key. A
+// failure recorded for a different secret with the same id is ignored.
+func (c Cache) GetAuthFailure(key ApiKey) (AuthFailure, bool) {
+	if v, ok := c.authFailures.Get(apiKeyHash(scopeAuthFailure, key)); ok {
+		entry, ok := v.(authFailureCache)
+		if !ok {
+			log.Error().Str("key", key.Id).Msg("AuthFailure cache cast fail")
+			return AuthFailure{}, false
+		}
+		if entry.key != key.Key {
+			log.Trace().Str("key", key.Id).Msg("AuthFailure cache MISMATCH")
+			return AuthFailure{}, false
+		}
+		log.Trace().Str("key", key.Id).Msg("AuthFailure cache HIT")
+		return entry.failure, true
+	}
+
+	log.Trace().Str("key", key.Id).Msg("AuthFailure cache MISS")
+	return AuthFailure{}, false
+}
+
+// DelAuthFailure forgets the failed authentications of the API key.
+func (c Cache) DelAuthFailure(key ApiKey) {
+	c.authFailures.Del(apiKeyHash(scopeAuthFailure, key))
+}
+
+// SetAgent keeps the last known record of the agent authenticated with the
+// API key, for check-ins to be served while Elasticsearch is unreachable.
+func (c Cache) SetAgent(key ApiKey, agent model.Agent, ttl time.Duration) {
+	scopedKey := apiKeyHash(scopeAgent, key)
+	v := agentCache{
+		key:   key.Key,
+		agent: agent,
+	}
+	cost := agentCost(key, agent)
+	ok := c.agents.SetWithTTL(scopedKey, v, cost, ttl)
+	log.Trace().
+		Bool("ok", ok).
+		Str("key", key.Id).
+		Str("agent", agent.Id).
+		Dur("ttl", ttl).
+		Int64("cost", cost).
+		Msg("Agent cache SET")
+}
+
+// GetAgent returns the last known record of the agent authenticated with the
+// API key. A record cached for a different secret with the same id is ignored.
+func (c Cache) GetAgent(key ApiKey) (model.Agent, bool) {
+	if v, ok := c.agents.Get(apiKeyHash(scopeAgent, key)); ok {
+		entry, ok := v.(agentCache)
+		if !ok {
+			log.Error().Str("key", key.Id).Msg("Agent cache cast fail")
+			return model.Agent{}, false
+		}
+		if entry.key != key.Key {
+			log.Trace().Str("key", key.Id).Msg("Agent cache MISMATCH")
+			return model.Agent{}, false
+		}
+		log.Trace().Str("key", key.Id).Msg("Agent cache HIT")
+		return entry.agent, true
+	}
+
+	log.Trace().Str("key", key.Id).Msg("Agent cache MISS")
+	return model.Agent{}, false
+}
+
+// agentCost is the approximate number of bytes held by a cached agent record;
+// the metadata dominates.
+func agentCost(key ApiKey, agent model.Agent) int64 {
+	return int64(hashKeyCost +
+		len(key.Key) +
+		len(agent.Id) +
+		len(agent.PolicyId) +
+		len(agent.AccessApiKeyId) +
+		len(agent.LocalMetadata) +
+		len(agent.UserProvidedMetadata))
+}
+
+// Scopes of the cache keys derived from API keys.
+const (
+	scopeApiKey      = "api:"
+	scopeAuthFailure = "authfail:"
+	scopeAgent       = "agent:"
+	scopeOperator    = "operator:"
+)
+
+// hashKeyCost is the cost of a cache key derived from an API key.
+const hashKeyCost = 8
+
+// apiKeyHash derives the cache key of the API key in the scope: the FNV-1a
+// hash of the scope and of the key id. Unlike concatenating them it does not
+// allocate on every request. A collision reads as a miss since the cached
+// entries are checked against the key secret.
+func apiKeyHash(scope string, key ApiKey) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(scope); i++ {
+		h ^= uint64(scope[i])
+		h *= prime64
+	}
+	for i := 0; i < len(key.Id); i++ {
+		h ^= uint64(key.Id[i])
+		h *= prime64
+	}
+	return h
+}
+
 // GetEnrollmentApiKey returns the enrollment API key by ID.
 func (c Cache) GetEnrollmentApiKey(id string) (model.EnrollmentApiKey, bool) {
 	scopedKey := "record:" + id
-	if v, ok := c.cache.Get(scopedKey); ok {
+	if v, ok := c.enrollmentKeys.Get(scopedKey); ok {
 		log.Trace().Str("id", id).Msg("Enrollment cache HIT")
 		key, ok := v.(model.EnrollmentApiKey)
 
@@ -137,7 +509,7 @@ func (c Cache) GetEnrollmentApiKey(id string) (model.EnrollmentApiKey, bool) {
 // SetEnrollmentApiKey adds the enrollment API key into the cache.
 func (c Cache) SetEnrollmentApiKey(id string, key model.EnrollmentApiKey, cost int64, ttl time.Duration) {
 	scopedKey := "record:" + id
-	ok := c.cache.SetWithTTL(scopedKey, key, cost, ttl)
+	ok := c.enrollmentKeys.SetWithTTL(scopedKey, key, cost, ttl)
 	log.Trace().
 		Bool("ok", ok).
 		Str("id", id).
@@ -152,7 +524,7 @@ func makeArtifactKey(ident, sha2 string) string {
 
 func (c Cache) GetArtifact(ident, sha2 string) (model.Artifact, bool) {
 	scopedKey := makeArtifactKey(ident, sha2)
-	if v, ok := c.cache.Get(scopedKey); ok {
+	if v, ok := c.artifacts.Get(scopedKey); ok {
 		log.Trace().Str("key", scopedKey).Msg("Artifact cache HIT")
 		key, ok := v.(model.Artifact)
 
@@ -169,9 +541,15 @@ func (c Cache) GetArtifact(ident, sha2 string) (model.Artifact, bool) {
 
 // TODO: strip body and spool to on disk cache if larger than a size threshold
 func (c Cache) SetArtifact(artifact model.Artifact, ttl time.Duration) {
-	scopedKey := makeArtifactKey(artifact.Identifier, artifact.DecodedSha256)
-	cost := int64(len(artifact.Body))
-	ok := c.cache.SetWithTTL(scopedKey, artifact, cost, ttl)
+	c.SetArtifactAs(artifact.Identifier, artifact.DecodedSha256, artifact, ttl)
+}
+
+// SetArtifactAs caches the artifact under another key than its identifier and
+// decoded sha256, such as its encoded sha256.
+func (c Cache) SetArtifactAs(ident, sha2 string, artifact model.Artifact, ttl time.Duration) {
+	scopedKey := makeArtifactKey(ident, sha2)
+	cost := artifactCost(scopedKey, artifact)
+	ok := c.artifacts.SetWithTTL(scopedKey, artifact, cost, ttl)
 	log.Trace().
 		Bool("ok", ok).
 		Str("key", scopedKey).
@@ -179,3 +557,17 @@ func (c Cache) SetArtifact(artifact model.Artifact, ttl time.Duration) {
 		Dur("ttl", ttl).
 		Msg("Artifact cache SET")
 }
+
+// artifactCost is the approximate number of bytes held by a cached artifact;
+// the body dominates but the metadata is counted so small artifacts are not free.
+func artifactCost(scopedKey string, artifact model.Artifact) int64 {
+	return int64(len(scopedKey) +
+		len(artifact.Body) +
+		len(artifact.CompressionAlgorithm) +
+		len(artifact.Created) +
+		len(artifact.DecodedSha256) +
+		len(artifact.EncodedSha256) +
+		len(artifact.EncryptionAlgorithm) +
+		len(artifact.Identifier) +
+		len(artifact.PackageName))
+}
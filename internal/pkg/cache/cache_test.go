@@ -0,0 +1,163 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentStats(t *testing.T) {
+	c, err := New(Config{
+		NumCounters: 100,
+		MaxCost:     1000,
+		Artifacts:   SegmentConfig{MaxCost: 5000},
+	})
+	require.NoError(t, err)
+
+	_, ok := c.GetArtifact("ident", "sha2")
+	assert.False(t, ok)
+	_, ok = c.GetArtifact("ident", "sha2")
+	assert.False(t, ok)
+	_, ok = c.GetAction("id")
+	assert.False(t, ok)
+
+	stats, ok := c.Stats(SegmentArtifacts)
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, int64(5000), stats.MaxCost)
+
+	stats, ok = c.Stats(SegmentActions)
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, int64(200), stats.MaxCost, "the five segments not sized split MaxCost")
+
+	stats, ok = c.Stats(SegmentApiKeys)
+	require.True(t, ok)
+	assert.Equal(t, uint64(0), stats.Misses)
+
+	_, ok = c.Stats("unknown")
+	assert.False(t, ok)
+}
+
+func TestAuthFailure(t *testing.T) {
+	c, err := New(Config{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+
+	key := ApiKey{Id: "id", Key: "secret"}
+	failure := AuthFailure{Err: errors.New("rejected"), Count: 2, Until: time.Now().Add(time.Minute)}
+	c.SetAuthFailure(key, failure, time.Minute)
+
+	// Sets are applied asynchronously.
+	require.Eventually(t, func() bool {
+		_, ok := c.GetAuthFailure(key)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	got, ok := c.GetAuthFailure(key)
+	require.True(t, ok)
+	assert.Equal(t, failure, got)
+
+	_, ok = c.GetAuthFailure(ApiKey{Id: "id", Key: "other"})
+	assert.False(t, ok, "failure must not apply to a different secret")
+
+	c.DelAuthFailure(key)
+	require.Eventually(t, func() bool {
+		_, ok := c.GetAuthFailure(key)
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOperator(t *testing.T) {
+	c, err := New(Config{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+
+	key := ApiKey{Id: "id", Key: "secret"}
+	assert.False(t, c.ValidOperator(key))
+
+	c.SetOperator(key, time.Minute)
+	require.Eventually(t, func() bool {
+		return c.ValidOperator(key)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.False(t, c.ValidOperator(ApiKey{Id: "id", Key: "other"}), "must not apply to a different secret")
+	assert.False(t, c.ValidApiKey(key), "scoped apart from the API key")
+}
+
+func TestActionTTL(t *testing.T) {
+	c, err := New(Config{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, c.ActionTTL("UPGRADE"))
+
+	c, err = New(Config{
+		NumCounters:     100,
+		MaxCost:         100000,
+		ActionTTL:       5 * time.Minute,
+		ActionTTLByType: map[string]time.Duration{"UPGRADE": time.Hour},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, c.ActionTTL("UPGRADE"))
+	assert.Equal(t, 5*time.Minute, c.ActionTTL("REQUEST_DIAGNOSTICS"))
+}
+
+func TestResize(t *testing.T) {
+	cfg := Config{NumCounters: 100, MaxCost: 100000, AuthFailures: SegmentConfig{MaxCost: 1000}}
+	c, err := New(cfg)
+	require.NoError(t, err)
+
+	key := ApiKey{Id: "id", Key: "secret"}
+	c.SetApiKey(key, time.Minute)
+	require.Eventually(t, func() bool { return c.ValidApiKey(key) }, time.Second, 10*time.Millisecond)
+
+	// Unchanged segments are kept
+	cfg.Artifacts.MaxCost = 5000
+	r, err := c.Resize(cfg)
+	require.NoError(t, err)
+	assert.NotSame(t, c.artifacts, r.artifacts)
+	assert.NotSame(t, c.apiKeys, r.apiKeys, "the shared max cost changed")
+	assert.Same(t, c.authFailures, r.authFailures)
+	stats, _ := r.Stats(SegmentArtifacts)
+	assert.Equal(t, int64(5000), stats.MaxCost)
+
+	// The resized segment takes the cached API key over
+	assert.True(t, r.ValidApiKey(key))
+	require.Eventually(t, func() bool {
+		_, ok := r.apiKeys.cache.Get(apiKeyHash(scopeApiKey, key))
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	// The replaced segment is closed once its entries expired
+	r.apiKeys.closePrev()
+	assert.True(t, r.ValidApiKey(key))
+	assert.False(t, r.ValidApiKey(ApiKey{Id: "id", Key: "other"}))
+}
+
+func BenchmarkValidApiKey(b *testing.B) {
+	lvl := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	defer zerolog.SetGlobalLevel(lvl)
+
+	c, err := New(Config{NumCounters: 1000, MaxCost: 100000})
+	require.NoError(b, err)
+
+	key := ApiKey{Id: "dGVzdC1hcGkta2V5LWlk", Key: "c2VjcmV0LWtleS12YWx1ZQ"}
+	c.SetApiKey(key, time.Hour)
+	require.Eventually(b, func() bool { return c.ValidApiKey(key) }, time.Second, time.Millisecond)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !c.ValidApiKey(key) {
+			b.Fatal("api key not cached")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+)
+
+// kMaxDrain bounds how long a segment replaced by a resize is read from; the
+// entries cached without a TTL are dropped after it.
+const kMaxDrain = time.Hour
+
+// segmentT is a cache segment. Its entries carry their cost and expiry so a
+// segment replacing it on resize can take them over.
+type segmentT struct {
+	cache       *ristretto.Cache
+	numCounters int64
+	maxCost     int64
+
+	// Longest TTL of the entries set, accessed atomically
+	maxTTL int64
+
+	// prev is the segment replaced by a resize, read on a miss until its
+	// entries expire.
+	mut  sync.RWMutex
+	prev *ristretto.Cache
+}
+
+type entryT struct {
+	value   interface{}
+	cost    int64
+	expires time.Time // zero if the entry does not expire
+}
+
+func newSegment(cfg SegmentConfig) (*segmentT, error) {
+	rcfg := &ristretto.Config{
+		NumCounters: cfg.NumCounters,
+		MaxCost:     cfg.MaxCost,
+		BufferItems: 64,
+		Metrics:     true,
+	}
+
+	cache, err := ristretto.NewCache(rcfg)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentT{
+		cache:       cache,
+		numCounters: cfg.NumCounters,
+		maxCost:     cfg.MaxCost,
+	}, nil
+}
+
+// SetWithTTL caches the value for ttl, forever if 0.
+func (s *segmentT) SetWithTTL(key, value interface{}, cost int64, ttl time.Duration) bool {
+	e := entryT{value: value, cost: cost}
+	drain := int64(kMaxDrain)
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+		drain = int64(ttl)
+	}
+	for {
+		cur := atomic.LoadInt64(&s.maxTTL)
+		if drain <= cur || atomic.CompareAndSwapInt64(&s.maxTTL, cur, drain) {
+			break
+		}
+	}
+	return s.cache.SetWithTTL(key, e, cost, ttl)
+}
+
+// Get returns the cached value. On a miss the entry is taken over from the
+// segment replaced by a resize, if still there.
+func (s *segmentT) Get(key interface{}) (interface{}, bool) {
+	if v, ok := s.cache.Get(key); ok {
+		return v.(entryT).value, true
+	}
+
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	if s.prev == nil {
+		return nil, false
+	}
+	v, ok := s.prev.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(entryT)
+	var ttl time.Duration
+	if !e.expires.IsZero() {
+		if ttl = time.Until(e.expires); ttl <= 0 {
+			return nil, false
+		}
+	}
+	s.cache.SetWithTTL(key, e, e.cost, ttl)
+	return e.value, true
+}
+
+// Del removes the entry, from the segment replaced by a resize as well.
+func (s *segmentT) Del(key interface{}) {
+	s.cache.Del(key)
+
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	if s.prev != nil {
+		s.prev.Del(key)
+	}
+}
+
+// resize returns the segment if cfg does not change its sizing, and otherwise
+// a segment of the new size taking over its entries until they expire, when
+// it is closed.
+func (s *segmentT) resize(cfg SegmentConfig) (*segmentT, error) {
+	if cfg.NumCounters == s.numCounters && cfg.MaxCost == s.maxCost {
+		return s, nil
+	}
+
+	r, err := newSegment(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.prev = s.cache
+	r.maxTTL = atomic.LoadInt64(&s.maxTTL)
+
+	drain := time.Duration(r.maxTTL)
+	if drain > kMaxDrain {
+		drain = kMaxDrain
+	}
+	time.AfterFunc(drain, r.closePrev)
+	return r, nil
+}
+
+// closePrev closes the segment replaced by a resize once its entries expired.
+func (s *segmentT) closePrev() {
+	s.mut.Lock()
+	prev := s.prev
+	s.prev = nil
+	s.mut.Unlock()
+
+	if prev != nil {
+		prev.Close()
+	}
+}
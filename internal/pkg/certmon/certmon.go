@@ -0,0 +1,194 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package certmon tracks the expiry of the certificates configured for Fleet
+// Server, so a lapsing certificate is reported ahead of time instead of being
+// discovered through agents failing to connect.
+package certmon
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoCertificate = errors.New("no PEM certificate found")
+
+// Source is a certificate or certificate bundle, given as a file path or
+// inline PEM as in the TLS settings.
+type Source struct {
+	Name string
+	PEM  string
+}
+
+// Expiry is the validity of a single certificate of a source. Certificates
+// after the first of a bundle are named "<source>.<index>".
+type Expiry struct {
+	Name     string
+	Subject  string
+	NotAfter time.Time
+}
+
+// Remaining returns the time left before the certificate expires; it is
+// negative once expired.
+func (e Expiry) Remaining(now time.Time) time.Duration {
+	return e.NotAfter.Sub(now)
+}
+
+// Load parses all the certificates of the file path or inline PEM.
+func Load(src string) ([]*x509.Certificate, error) {
+	data := []byte(src)
+	if !strings.HasPrefix(strings.TrimSpace(src), "-----BEGIN") {
+		var err error
+		if data, err = ioutil.ReadFile(src); err != nil {
+			return nil, err
+		}
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+
+	if len(certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return certs, nil
+}
+
+// Monitor periodically reloads the sources and logs the certificates that
+// expire within the configured thresholds.
+type Monitor struct {
+	cfg     config.CertExpiry
+	sources []Source
+	now     func() time.Time
+
+	mut   sync.RWMutex
+	certs []Expiry
+}
+
+func NewMonitor(cfg *config.CertExpiry, sources []Source) *Monitor {
+	return &Monitor{
+		cfg:     *cfg,
+		sources: sources,
+		now:     time.Now,
+	}
+}
+
+// Run checks the certificates every check interval until ctx is done; without
+// a check interval they are checked once.
+func (m *Monitor) Run(ctx context.Context) error {
+	m.check()
+	if len(m.sources) == 0 || m.cfg.CheckInterval <= 0 {
+		return nil
+	}
+
+	t := time.NewTicker(m.cfg.CheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			m.check()
+		}
+	}
+}
+
+func (m *Monitor) check() {
+	now := m.now()
+
+	var certs []Expiry
+	for _, src := range m.sources {
+		loaded, err := Load(src.PEM)
+		if err != nil {
+			log.Warn().Err(err).Str("certificate", src.Name).Msg("Fail to load certificate for expiry check")
+			continue
+		}
+		for i, c := range loaded {
+			name := src.Name
+			if i > 0 {
+				name = fmt.Sprintf("%s.%d", src.Name, i)
+			}
+			certs = append(certs, Expiry{
+				Name:     name,
+				Subject:  c.Subject.String(),
+				NotAfter: c.NotAfter,
+			})
+		}
+	}
+
+	for _, e := range certs {
+		remaining := e.Remaining(now)
+		var ev *zerolog.Event
+		switch {
+		case remaining <= m.cfg.Critical:
+			ev = log.Error()
+		case remaining <= m.cfg.Warn:
+			ev = log.Warn()
+		default:
+			continue
+		}
+		ev.Str("certificate", e.Name).
+			Str("subject", e.Subject).
+			Time("not_after", e.NotAfter).
+			Int("days_to_expiry", int(remaining/(24*time.Hour))).
+			Msg("Certificate expires soon; renew it before agents fail to connect")
+	}
+
+	m.mut.Lock()
+	m.certs = certs
+	m.mut.Unlock()
+}
+
+// Certificates returns the certificates as of the last check.
+func (m *Monitor) Certificates() []Expiry {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return m.certs
+}
+
+// Expiring returns the certificates within the warning threshold, soonest to
+// expire first, and whether any of them is within the critical threshold.
+func (m *Monitor) Expiring() (expiring []Expiry, critical bool) {
+	now := m.now()
+	for _, e := range m.Certificates() {
+		remaining := e.Remaining(now)
+		if remaining <= m.cfg.Warn {
+			expiring = append(expiring, e)
+		}
+		if remaining <= m.cfg.Critical {
+			critical = true
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].NotAfter.Before(expiring[j].NotAfter)
+	})
+	return expiring, critical
+}
@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package certmon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makePEM(t *testing.T, cn string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestLoad(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	bundle := append(makePEM(t, "a", now), makePEM(t, "b", now)...)
+
+	certs, err := Load(string(bundle))
+	require.NoError(t, err)
+	assert.Len(t, certs, 2)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(path, bundle, 0600))
+	certs, err = Load(path)
+	require.NoError(t, err)
+	assert.Len(t, certs, 2)
+
+	_, err = Load("-----BEGIN nothing")
+	assert.Equal(t, ErrNoCertificate, err)
+}
+
+func TestMonitorExpiring(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	day := 24 * time.Hour
+
+	cfg := config.CertExpiry{}
+	cfg.InitDefaults()
+
+	ca := append(makePEM(t, "ca1", now.Add(365*day)), makePEM(t, "ca2", now.Add(20*day))...)
+	m := NewMonitor(&cfg, []Source{
+		{Name: "server", PEM: string(makePEM(t, "server", now.Add(5*day)))},
+		{Name: "server_ca", PEM: string(ca)},
+		{Name: "broken", PEM: "/nonexistent/cert.pem"},
+	})
+	m.now = func() time.Time { return now }
+	m.check()
+
+	assert.Len(t, m.Certificates(), 3)
+
+	expiring, critical := m.Expiring()
+	assert.True(t, critical)
+	require.Len(t, expiring, 2)
+	assert.Equal(t, "server", expiring[0].Name)
+	assert.Equal(t, "server_ca.1", expiring[1].Name)
+	assert.Equal(t, "CN=ca2", expiring[1].Subject)
+	assert.Equal(t, 20*day, expiring[1].Remaining(now))
+}
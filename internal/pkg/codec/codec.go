@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package codec selects the JSON implementation of the hot paths of the API:
+// the checkin, enroll and ack requests and responses.
+package codec
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+const (
+	// Std is the JSON implementation of the standard library.
+	Std = "std"
+
+	// Jsoniter is json-iterator, configured to be compatible with the
+	// standard library.
+	Jsoniter = "jsoniter"
+)
+
+// Codec marshals and unmarshals JSON.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder reads and decodes JSON values from a stream.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+var codecs = map[string]Codec{
+	Std:      stdCodec{},
+	Jsoniter: newJsoniterCodec(),
+}
+
+type holder struct {
+	name  string
+	codec Codec
+}
+
+var current atomic.Value // holder
+
+func init() {
+	current.Store(holder{Default, codecs[Default]})
+}
+
+// Valid tells whether the codec exists; the empty name is the default codec.
+func Valid(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, ok := codecs[name]
+	return ok
+}
+
+// Use selects the codec; the empty name selects the default one, chosen at
+// build time.
+func Use(name string) error {
+	if name == "" {
+		name = Default
+	}
+	c, ok := codecs[name]
+	if !ok {
+		return fmt.Errorf("unknown JSON codec %q", name)
+	}
+	current.Store(holder{name, c})
+	return nil
+}
+
+// Name returns the name of the codec in use.
+func Name() string {
+	return current.Load().(holder).name
+}
+
+// Get returns the codec in use.
+func Get() Codec {
+	return current.Load().(holder).codec
+}
+
+// Marshal returns the JSON encoding of v with the codec in use.
+func Marshal(v interface{}) ([]byte, error) {
+	return Get().Marshal(v)
+}
+
+// Unmarshal parses the JSON data into v with the codec in use.
+func Unmarshal(data []byte, v interface{}) error {
+	return Get().Unmarshal(data, v)
+}
+
+// NewDecoder returns a decoder of the codec in use reading from r.
+func NewDecoder(r io.Reader) Decoder {
+	return Get().NewDecoder(r)
+}
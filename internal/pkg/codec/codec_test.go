@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type action struct {
+	AgentId   string      `json:"agent_id"`
+	CreatedAt string      `json:"created_at"`
+	Data      interface{} `json:"data"`
+	Id        string      `json:"id"`
+	InputType string      `json:"input_type"`
+	Type      string      `json:"type"`
+}
+
+type response struct {
+	AckToken string                 `json:"ack_token,omitempty"`
+	Action   string                 `json:"action"`
+	Actions  []action               `json:"actions,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+func testResponse() response {
+	return response{
+		AckToken: "token",
+		Action:   "checkin",
+		Actions: []action{
+			{
+				AgentId:   "agent-1",
+				CreatedAt: "2021-06-01T00:00:00Z",
+				Data:      json.RawMessage(`{"policy": {"id": "policy-1", "outputs": {"default": {"hosts": ["https://<es>:9200"]}}}}`),
+				Id:        "action-1",
+				Type:      "POLICY_CHANGE",
+			},
+		},
+		Meta: map[string]interface{}{"z": 1, "a": "<b>&", "m": []int{1, 2}},
+	}
+}
+
+func TestCodecsCompatible(t *testing.T) {
+	resp := testResponse()
+
+	want, err := json.Marshal(&resp)
+	require.NoError(t, err)
+
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			data, err := c.Marshal(&resp)
+			require.NoError(t, err)
+			// Raw messages may be written as is, without compaction
+			assert.JSONEq(t, string(want), string(data))
+
+			var got, decoded response
+			require.NoError(t, c.Unmarshal(data, &got))
+			require.NoError(t, c.NewDecoder(bytes.NewReader(data)).Decode(&decoded))
+			assert.Equal(t, got, decoded)
+			assert.Equal(t, "action-1", got.Actions[0].Id)
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	defer Use("")
+
+	require.NoError(t, Use(Jsoniter))
+	assert.Equal(t, Jsoniter, Name())
+	assert.IsType(t, jsoniterCodec{}, Get())
+
+	assert.Error(t, Use("sonic"))
+	assert.Equal(t, Jsoniter, Name())
+
+	require.NoError(t, Use(""))
+	assert.Equal(t, Default, Name())
+
+	assert.True(t, Valid(""))
+	assert.True(t, Valid(Std))
+	assert.False(t, Valid("sonic"))
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	resp := testResponse()
+	for name, c := range codecs {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Marshal(&resp); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build jsoniter
+
+package codec
+
+// Default is the codec used unless configured otherwise.
+const Default = Jsoniter
@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package codec
+
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// jsoniterCodec encodes as the standard library does: sorted map keys, HTML
+// escaping and json.Marshaler/json.RawMessage support. Raw messages, like the
+// action data, are written as is rather than compacted.
+type jsoniterCodec struct {
+	api jsoniter.API
+}
+
+func newJsoniterCodec() jsoniterCodec {
+	return jsoniterCodec{api: jsoniter.ConfigCompatibleWithStandardLibrary}
+}
+
+func (c jsoniterCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.api.Marshal(v)
+}
+
+func (c jsoniterCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.api.Unmarshal(data, v)
+}
+
+func (c jsoniterCodec) NewDecoder(r io.Reader) Decoder {
+	return c.api.NewDecoder(r)
+}
@@ -0,0 +1,25 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import "fmt"
+
+// AckTokens enables signed ack tokens. The Fleet Servers sharing agents must
+// be given the same Secret; tokens signed with one of PreviousSecrets are
+// still accepted while a new secret is rolled out. An agent presenting a token
+// that does not verify, or that is older than its last checkin, is refused and
+// must check in again without a token to re-sync from its agent record.
+type AckTokens struct {
+	Secret          string   `config:"secret"`
+	PreviousSecrets []string `config:"previous_secrets"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AckTokens) Validate() error {
+	if len(c.PreviousSecrets) > 0 && c.Secret == "" {
+		return fmt.Errorf("previous_secrets requires secret")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+)
+
+// ActionIngest accepts the actions of trusted writers, such as Kibana, in
+// batches of at most MaxActions, so they are validated the same way whoever
+// writes them. The writers authenticate with a service token whose principal
+// is one of Writers. The actions of SignedTypes must carry a signature
+// verified with PublicKey, a PEM encoded ECDSA public key.
+type ActionIngest struct {
+	Enabled     bool     `config:"enabled"`
+	Writers     []string `config:"writers"`
+	MaxActions  int      `config:"max_actions"`
+	SignedTypes []string `config:"signed_types"`
+	PublicKey   string   `config:"public_key"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *ActionIngest) InitDefaults() {
+	c.Enabled = false
+	c.Writers = []string{"elastic/kibana"}
+	c.MaxActions = 1000
+	c.SignedTypes = nil
+	c.PublicKey = ""
+}
+
+// Validate ensures that the configuration is valid.
+func (c *ActionIngest) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Writers) == 0 {
+		return fmt.Errorf("writers must not be empty")
+	}
+	if c.MaxActions <= 0 {
+		return fmt.Errorf("max_actions must be positive")
+	}
+	if len(c.SignedTypes) > 0 && c.PublicKey == "" {
+		return fmt.Errorf("public_key is required with signed_types")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Actions configures the actions created by Fleet Server: the diagnostics
+// requests, the fan-outs and the notices of deleted policies.
+// ExpirationByType sets how long the actions of a type are dispatched for,
+// such as a day for UPGRADE and minutes for REQUEST_DIAGNOSTICS, when the
+// request creating them does not set it.
+type Actions struct {
+	ExpirationByType map[string]time.Duration `config:"expiration_by_type"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Actions) InitDefaults() {
+	c.ExpirationByType = nil
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Actions) Validate() error {
+	for actionType, expiration := range c.ExpirationByType {
+		if expiration <= 0 {
+			return fmt.Errorf("expiration_by_type of %s must be positive", actionType)
+		}
+	}
+	return nil
+}
+
+// Expiration returns how long the actions of the type are dispatched for,
+// else def.
+func (c *Actions) Expiration(actionType string, def time.Duration) time.Duration {
+	if expiration, ok := c.ExpirationByType[actionType]; ok {
+		return expiration
+	}
+	return def
+}
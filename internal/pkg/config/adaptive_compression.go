@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"compress/flate"
+	"fmt"
+	"time"
+)
+
+// AdaptiveCompression tunes the gzip level and size threshold of the checkin
+// responses, starting from compression_level and compression_threshold, to
+// the CPU headroom of the process. Every Interval, with more than HighCPU of
+// the CPUs busy the level is lowered a step and the threshold raised to the
+// median size of the responses of the interval, or doubled; with less than
+// LowCPU busy the level is raised a step and the threshold halved. Both stay
+// within their bounds. A compression_level of 0 keeps compression disabled.
+type AdaptiveCompression struct {
+	Enabled      bool          `config:"enabled"`
+	Interval     time.Duration `config:"interval"`
+	MinLevel     int           `config:"min_level"`
+	MaxLevel     int           `config:"max_level"`
+	MinThreshold int           `config:"min_threshold"`
+	MaxThreshold int           `config:"max_threshold"`
+	HighCPU      float64       `config:"high_cpu"`
+	LowCPU       float64       `config:"low_cpu"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *AdaptiveCompression) InitDefaults() {
+	c.Enabled = false
+	c.Interval = 10 * time.Second
+	c.MinLevel = flate.BestSpeed
+	c.MaxLevel = 6 // what flate.DefaultCompression stands for
+	c.MinThreshold = 1024
+	c.MaxThreshold = 64 * 1024
+	c.HighCPU = 0.8
+	c.LowCPU = 0.5
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AdaptiveCompression) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.MinLevel < flate.BestSpeed || c.MaxLevel > flate.BestCompression || c.MinLevel > c.MaxLevel {
+		return fmt.Errorf("min_level and max_level must be ordered between %d and %d", flate.BestSpeed, flate.BestCompression)
+	}
+	if c.MinThreshold < 0 || c.MinThreshold > c.MaxThreshold {
+		return fmt.Errorf("min_threshold and max_threshold must be ordered and not negative")
+	}
+	if c.LowCPU <= 0 || c.LowCPU >= c.HighCPU || c.HighCPU > 1 {
+		return fmt.Errorf("low_cpu and high_cpu must be ordered between 0 and 1")
+	}
+	return nil
+}
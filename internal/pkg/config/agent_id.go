@@ -0,0 +1,49 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import "fmt"
+
+const (
+	// AgentIDRandom gives every enrollment a random id.
+	AgentIDRandom = "random"
+
+	// AgentIDFingerprint derives the id from the policy and the Fields of
+	// the local metadata of the agent.
+	AgentIDFingerprint = "fingerprint"
+)
+
+// AgentID is the strategy giving the agents enrolling the id of their
+// document. With the fingerprint strategy a host enrolling again into the same
+// policy, such as an ephemeral workload of a Kubernetes DaemonSet or a CI
+// runner, takes over its document rather than adding another: its previous
+// API keys are invalidated. The host proves it owns the document with the
+// access API key of its previous enrollment; a host that cannot, such as a
+// cloned virtual machine, gets a random id. Fields are paths in the local
+// metadata, such as host.id; the agents lacking one of them get a random id.
+type AgentID struct {
+	Strategy string   `config:"strategy"`
+	Fields   []string `config:"fields"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *AgentID) InitDefaults() {
+	c.Strategy = AgentIDRandom
+	c.Fields = []string{"host.id"}
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AgentID) Validate() error {
+	switch c.Strategy {
+	case AgentIDRandom:
+	case AgentIDFingerprint:
+		if len(c.Fields) == 0 {
+			return fmt.Errorf("fields are required by the fingerprint strategy")
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q", c.Strategy)
+	}
+	return nil
+}
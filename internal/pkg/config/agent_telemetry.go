@@ -0,0 +1,53 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// AgentTelemetry accepts the OTLP/HTTP metrics of the enrolled agents and
+// passes them on, so the agents without a path to a collector can report
+// their own health. The metrics are forwarded as received to the collector at
+// CollectorURL, with Headers, or indexed into DataStream, which only takes
+// the JSON encoding; exactly one of them is set.
+type AgentTelemetry struct {
+	Enabled      bool              `config:"enabled"`
+	CollectorURL string            `config:"collector_url"`
+	Headers      map[string]string `config:"headers"`
+	DataStream   string            `config:"data_stream"`
+	Timeout      time.Duration     `config:"timeout"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *AgentTelemetry) InitDefaults() {
+	c.Enabled = false
+	c.Timeout = 10 * time.Second
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AgentTelemetry) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if (c.CollectorURL == "") == (c.DataStream == "") {
+		return fmt.Errorf("exactly one of collector_url and data_stream must be set")
+	}
+	if c.CollectorURL != "" {
+		u, err := url.Parse(c.CollectorURL)
+		if err != nil {
+			return fmt.Errorf("invalid collector_url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("collector_url must be http or https")
+		}
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ArtifactCaching lets the agents and the proxies in front of Fleet Server
+// cache the artifacts they download. The responses carry a strong ETag, the
+// agents presenting it in If-None-Match get a 304 without the payload, and a
+// private Cache-Control allowing the artifact to be reused for MaxAge.
+type ArtifactCaching struct {
+	Enabled bool          `config:"enabled"`
+	MaxAge  time.Duration `config:"max_age"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *ArtifactCaching) InitDefaults() {
+	c.Enabled = true
+	c.MaxAge = 24 * time.Hour
+}
+
+// Validate ensures that the configuration is valid.
+func (c *ArtifactCaching) Validate() error {
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative")
+	}
+	return nil
+}
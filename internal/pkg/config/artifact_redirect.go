@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	ArtifactSignerHMAC = "hmac"
+	ArtifactSignerS3   = "s3"
+)
+
+// ArtifactRedirect offloads the artifact payloads to a CDN or an object store.
+// Fleet Server still authorizes the downloads, then redirects the agents to
+// the artifact under URL, named by the SHA256 of its encoded payload, with a
+// URL signed for TTL. The hmac signer signs with Secret, which the CDN checks;
+// a CDN pulling the artifacts from Fleet Server is served them on the same
+// signature. The s3 signer presigns the URLs of an S3 compatible bucket.
+type ArtifactRedirect struct {
+	Enabled bool               `config:"enabled"`
+	URL     string             `config:"url"`
+	Signer  string             `config:"signer"`
+	Secret  string             `config:"secret"`
+	TTL     time.Duration      `config:"ttl"`
+	S3      ArtifactRedirectS3 `config:"s3"`
+}
+
+// ArtifactRedirectS3 are the credentials presigning the URLs of the bucket.
+type ArtifactRedirectS3 struct {
+	Region          string `config:"region"`
+	AccessKeyID     string `config:"access_key_id"`
+	SecretAccessKey string `config:"secret_access_key"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *ArtifactRedirect) InitDefaults() {
+	c.Enabled = false
+	c.Signer = ArtifactSignerHMAC
+	c.TTL = 5 * time.Minute
+}
+
+// Validate ensures that the configuration is valid.
+func (c *ArtifactRedirect) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must be http or https")
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+	switch c.Signer {
+	case ArtifactSignerHMAC:
+		if c.Secret == "" {
+			return fmt.Errorf("secret must be set with the hmac signer")
+		}
+	case ArtifactSignerS3:
+		if c.S3.Region == "" || c.S3.AccessKeyID == "" || c.S3.SecretAccessKey == "" {
+			return fmt.Errorf("s3.region, s3.access_key_id and s3.secret_access_key must be set with the s3 signer")
+		}
+		if c.TTL > 7*24*time.Hour {
+			return fmt.Errorf("ttl must be at most 7 days with the s3 signer")
+		}
+	default:
+		return fmt.Errorf("signer must be %s or %s", ArtifactSignerHMAC, ArtifactSignerS3)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// AutoUnenroll force unenrolls the agents whose access API key fails to
+// authenticate MaxFailures consecutive times within Window, invalidating their
+// API keys. Only the failures of the secret of the access API key the agent
+// was last given count, so the agents enrolled before its hash was recorded
+// are never unenrolled. Disabled by default.
+type AutoUnenroll struct {
+	Enabled     bool          `config:"enabled"`
+	MaxFailures int           `config:"max_failures"`
+	Window      time.Duration `config:"window"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *AutoUnenroll) InitDefaults() {
+	c.Enabled = false
+	c.MaxFailures = 50
+	c.Window = 24 * time.Hour
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AutoUnenroll) Validate() error {
+	if c.MaxFailures <= 0 {
+		return fmt.Errorf("max_failures must be positive")
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	return nil
+}
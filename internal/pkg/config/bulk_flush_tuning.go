@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// BulkFlushTuning tunes the flush interval and the max pending flushes of the
+// bulker to its workload, instead of bulk_flush_interval and
+// bulk_flush_max_pending. Every Interval the load is measured as the larger of
+// the arrival rate of the items over HighRate and the latency of the flushes
+// over HighLatency: idle, the bulker flushes every MinInterval for latency;
+// loaded, every MaxInterval in larger batches for throughput. The pending
+// flushes grow with the arrival rate from MinPending to MaxPending, and
+// shrink as the flushes slow down so a struggling cluster is not flooded.
+type BulkFlushTuning struct {
+	Enabled     bool          `config:"enabled"`
+	Interval    time.Duration `config:"interval"`
+	MinInterval time.Duration `config:"min_interval"`
+	MaxInterval time.Duration `config:"max_interval"`
+	MinPending  int           `config:"min_pending"`
+	MaxPending  int           `config:"max_pending"`
+	HighRate    float64       `config:"high_rate"`
+	HighLatency time.Duration `config:"high_latency"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *BulkFlushTuning) InitDefaults() {
+	c.Enabled = false
+	c.Interval = time.Second
+	c.MinInterval = 10 * time.Millisecond
+	c.MaxInterval = time.Second
+	c.MinPending = 4
+	c.MaxPending = 32
+	c.HighRate = 5000
+	c.HighLatency = 500 * time.Millisecond
+}
+
+// Validate ensures that the configuration is valid.
+func (c *BulkFlushTuning) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.MinInterval <= 0 || c.MinInterval > c.MaxInterval {
+		return fmt.Errorf("min_interval and max_interval must be ordered and positive")
+	}
+	if c.MinPending <= 0 || c.MinPending > c.MaxPending {
+		return fmt.Errorf("min_pending and max_pending must be ordered and positive")
+	}
+	if c.HighRate <= 0 || c.HighLatency <= 0 {
+		return fmt.Errorf("high_rate and high_latency must be positive")
+	}
+	return nil
+}
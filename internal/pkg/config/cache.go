@@ -4,17 +4,61 @@
 
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
 const (
 	defaultCacheNumCounters = 500000           // 10x times expected count
 	defaultCacheMaxCost     = 50 * 1024 * 1024 // 50MiB cache size
+
+	defaultCacheAuthFailuresMaxCost = 1024 * 1024 // 1MiB of failed API keys
+
+	defaultCacheActionTTL = time.Minute
 )
 
 type Cache struct {
 	NumCounters int64 `config:"num_counters"`
 	MaxCost     int64 `config:"max_cost"`
+
+	// Per segment sizing; settings left unset use the values above, the
+	// segments without a max_cost splitting MaxCost evenly.
+	ApiKeys        CacheSegment `config:"api_keys"`
+	EnrollmentKeys CacheSegment `config:"enrollment_keys"`
+	Artifacts      CacheSegment `config:"artifacts"`
+	Actions        CacheSegment `config:"actions"`
+	AuthFailures   CacheSegment `config:"auth_failures"`
+	Agents         CacheSegment `config:"agents"`
+
+	// ActionTTL is how long the actions acked are cached; ActionTTLByType
+	// overrides it per action type, such as UPGRADE.
+	ActionTTL       time.Duration            `config:"action_ttl"`
+	ActionTTLByType map[string]time.Duration `config:"action_ttl_by_type"`
+}
+
+// CacheSegment sizes a single segment of the cache.
+type CacheSegment struct {
+	NumCounters int64 `config:"num_counters"`
+	MaxCost     int64 `config:"max_cost"`
 }
 
 func (c *Cache) InitDefaults() {
 	c.NumCounters = defaultCacheNumCounters
 	c.MaxCost = defaultCacheMaxCost
+	c.AuthFailures.MaxCost = defaultCacheAuthFailuresMaxCost
+	c.ActionTTL = defaultCacheActionTTL
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Cache) Validate() error {
+	if c.ActionTTL <= 0 {
+		return fmt.Errorf("action_ttl must be positive")
+	}
+	for actionType, ttl := range c.ActionTTLByType {
+		if ttl <= 0 {
+			return fmt.Errorf("action_ttl_by_type of %s must be positive", actionType)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,46 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+)
+
+// CheckinStreaming writes the checkin responses with at least MinActions
+// actions as they are serialized, an action at a time through a buffer of
+// BufferSize bytes, rather than serializing them whole first. A streamed
+// response is written at most WriteRate bytes per second to its connection;
+// 0 does not limit.
+type CheckinStreaming struct {
+	Enabled    bool  `config:"enabled"`
+	MinActions int   `config:"min_actions"`
+	BufferSize int   `config:"buffer_size"`
+	WriteRate  int64 `config:"write_rate"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *CheckinStreaming) InitDefaults() {
+	c.Enabled = false
+	c.MinActions = 100
+	c.BufferSize = 32 * 1024
+	c.WriteRate = 0
+}
+
+// Validate ensures that the configuration is valid.
+func (c *CheckinStreaming) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MinActions < 0 {
+		return fmt.Errorf("min_actions must not be negative")
+	}
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("buffer_size must be positive")
+	}
+	if c.WriteRate < 0 {
+		return fmt.Errorf("write_rate must not be negative")
+	}
+	return nil
+}
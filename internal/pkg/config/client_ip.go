@@ -0,0 +1,25 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+// ClientIP sets how the address of the client of a request is found. The
+// client of a request from an address within TrustedProxies is the last
+// address of its X-Forwarded-For header not within them; the networks are
+// given in CIDR notation or as single addresses. The address is the one the
+// IP filter, the geofence, the peer caches, the long poll budget and the
+// enrollment history see.
+type ClientIP struct {
+	TrustedProxies []string `config:"trusted_proxies"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *ClientIP) Validate() error {
+	for _, n := range c.TrustedProxies {
+		if _, err := ParseNetwork(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
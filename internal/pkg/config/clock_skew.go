@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClockSkew configures the detection of the skew of the clocks of the agents,
+// from the timestamps of their checkins. The skew is recorded on the agent
+// documents and its distribution reported; the skews over Threshold are
+// counted apart and logged. With ServerTime the checkin responses hint the
+// time of Fleet Server.
+type ClockSkew struct {
+	Threshold  time.Duration `config:"threshold"`
+	ServerTime bool          `config:"server_time"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *ClockSkew) InitDefaults() {
+	c.Threshold = time.Minute
+	c.ServerTime = false
+}
+
+// Validate ensures that the configuration is valid.
+func (c *ClockSkew) Validate() error {
+	if c.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	return nil
+}
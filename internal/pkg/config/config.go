@@ -65,22 +65,31 @@ func (c *Config) Merge(other *Config) (*Config, error) {
 	return cfg, nil
 }
 
-// FromConfig returns Config from the ucfg.Config.
+// FromConfig returns Config from the ucfg.Config; the settings of the limits
+// preset it selects, if any, replace the defaults.
 func FromConfig(c *ucfg.Config) (*Config, error) {
+	c, err := withPreset(c)
+	if err != nil {
+		return nil, err
+	}
 	cfg := &Config{}
-	err := c.Unpack(cfg, DefaultOptions...)
+	err = c.Unpack(cfg, DefaultOptions...)
 	if err != nil {
 		return nil, err
 	}
 	return cfg, nil
 }
 
-// LoadFile take a path and load the file and return a new configuration.
+// LoadFile take a path and load the file and return a new configuration; the
+// FLEET_SERVER_ environment variables override the settings of the file.
 func LoadFile(path string) (*Config, error) {
 	c, err := yaml.NewConfigWithFile(path, DefaultOptions...)
 	if err != nil {
 		return nil, err
 	}
+	if err := MergeEnv(c); err != nil {
+		return nil, err
+	}
 	return FromConfig(c)
 }
 
@@ -15,6 +15,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
 )
 
 func TestConfig(t *testing.T) {
@@ -42,7 +44,25 @@ func TestConfig(t *testing.T) {
 						BulkFlushThresholdCount: 2048,
 						BulkFlushThresholdSize:  1048576,
 						BulkFlushMaxPending:     8,
-						Timeout:                 90 * time.Second,
+						BulkMaxDocumentSize:     104857600,
+						BulkRetryMax:            3,
+						BulkRetryBackoff:        100 * time.Millisecond,
+						BulkRetryMaxBackoff:     5 * time.Second,
+						BulkRetryRate:           1000,
+						BulkFlushTuning: BulkFlushTuning{
+							Interval:    time.Second,
+							MinInterval: 10 * time.Millisecond,
+							MaxInterval: time.Second,
+							MinPending:  4,
+							MaxPending:  32,
+							HighRate:    5000,
+							HighLatency: 500 * time.Millisecond,
+						},
+						Timeout:            90 * time.Second,
+						DNSResolveInterval: time.Minute,
+						TrustStore: TrustStore{
+							ReloadInterval: time.Minute,
+						},
 					},
 				},
 				Inputs: []Input{
@@ -70,6 +90,11 @@ func TestConfig(t *testing.T) {
 								CheckinLimit: Limit{
 									Interval: time.Millisecond,
 									Burst:    1000,
+									MaxBody:  1024 * 1024,
+								},
+								CheckinPollLimit: Limit{
+									Interval: time.Millisecond / 10,
+									Burst:    2000,
 								},
 								ArtifactLimit: Limit{
 									Interval: time.Millisecond * 5,
@@ -85,16 +110,214 @@ func TestConfig(t *testing.T) {
 									Interval: time.Millisecond * 10,
 									Burst:    100,
 									Max:      50,
+									MaxBody:  2 * 1024 * 1024,
+								},
+								AdminLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								ReissueLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								TelemetryLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    100,
+									Max:      50,
+									MaxBody:  1024 * 1024,
+								},
+								UploadLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    20,
+									Max:      10,
+								},
+								ApiKeyLimit: KeyLimit{
+									Interval: time.Millisecond * 100,
+									Burst:    100,
+									Block:    time.Minute * 5,
+								},
+								Global: GlobalLimits{
+									Window:       time.Second * 10,
+									SyncInterval: time.Second,
+								},
+							},
+							CertExpiry: CertExpiry{
+								Warn:          30 * 24 * time.Hour,
+								Critical:      7 * 24 * time.Hour,
+								CheckInterval: time.Hour,
+							},
+							Offline: Offline{
+								QueueSize:    100000,
+								DropPolicy:   DropOldest,
+								GracePeriod:  10 * time.Minute,
+								MaxStaleness: 30 * time.Minute,
+							},
+							DeletedPolicy: DeletedPolicy{
+								Action:        DeletedPolicyNone,
+								CheckInterval: 5 * time.Minute,
+							},
+							PendingActions: PendingActions{
+								MaxPerCheckin: 100,
+								MaxQueued:     1000,
+							},
+							EnrollmentHistory: EnrollmentHistory{
+								Enabled:   true,
+								Retention: 30 * 24 * time.Hour,
+							},
+							UserAgent: UserAgent{
+								Mode: UserAgentModeEnforce,
+							},
+							LocalMetadata: LocalMetadata{
+								MaxSize:   64 * 1024,
+								MaxFields: 1000,
+							},
+							AutoUnenroll: AutoUnenroll{
+								MaxFailures: 50,
+								Window:      24 * time.Hour,
+							},
+							Upload: Upload{
+								ChunkSize:   4 * 1024 * 1024,
+								MaxFileSize: 10 * 1024 * 1024 * 1024,
+								Storage: UploadStorage{
+									Backend: UploadBackendElasticsearch,
+									Timeout: time.Minute,
+								},
+							},
+							UploadScan: UploadScan{
+								Timeout: 30 * time.Second,
+							},
+							ArtifactCaching: ArtifactCaching{
+								Enabled: true,
+								MaxAge:  24 * time.Hour,
+							},
+							ArtifactRedirect: ArtifactRedirect{
+								Signer: "hmac",
+								TTL:    5 * time.Minute,
+							},
+							AgentTelemetry: AgentTelemetry{
+								Timeout: 10 * time.Second,
+							},
+							Maintenance: Maintenance{
+								Timezone: "UTC",
+							},
+							LifecycleEvents: LifecycleEvents{
+								OutboxSize:   10000,
+								BatchSize:    100,
+								RetryInit:    time.Second,
+								RetryMax:     time.Minute,
+								OfflineAfter: 5 * time.Minute,
+								Webhook: LifecycleWebhook{
+									Timeout: 10 * time.Second,
+								},
+								Kafka: LifecycleKafka{
+									ClientID: "fleet-server",
+									Timeout:  10 * time.Second,
 								},
+								NATS: LifecycleNATS{
+									Timeout: 10 * time.Second,
+								},
+							},
+							Watchdog: Watchdog{
+								Interval:  30 * time.Second,
+								Grace:     time.Minute,
+								MaxStacks: 10,
+							},
+							Migration: Migration{
+								QueueSize:     100000,
+								Workers:       32,
+								CheckInterval: 5 * time.Minute,
+								CheckSample:   100,
+							},
+							RollingRestart: RollingRestart{
+								MinServing:    1,
+								DrainTimeout:  30 * time.Second,
+								CheckInterval: 5 * time.Second,
+							},
+							AdaptiveCompression: AdaptiveCompression{
+								Interval:     10 * time.Second,
+								MinLevel:     1,
+								MaxLevel:     6,
+								MinThreshold: 1024,
+								MaxThreshold: 64 * 1024,
+								HighCPU:      0.8,
+								LowCPU:       0.5,
+							},
+							DebugCapture: DebugCapture{
+								Name:        "fleet-server-capture.log",
+								MaxSize:     10 * 1024 * 1024,
+								MaxBackups:  2,
+								DefaultTTL:  15 * time.Minute,
+								MaxTTL:      4 * time.Hour,
+								MaxAgents:   10,
+								MaxBodySize: 64 * 1024,
 							},
+							Shadow: Shadow{
+								SampleRate:  0.01,
+								Timeout:     5 * time.Second,
+								QueueSize:   100,
+								Workers:     2,
+								MaxBodySize: 1024 * 1024,
+							},
+							AgentID: AgentID{
+								Strategy: AgentIDRandom,
+								Fields:   []string{"host.id"},
+							},
+							Indices: Indices{},
+							Actions: Actions{},
+							LeakDetection: LeakDetection{
+								Interval:  time.Minute,
+								Tolerance: 10,
+							},
+							SlowRequests: SlowRequests{
+								Threshold: 5 * time.Second,
+							},
+							ClockSkew: ClockSkew{
+								Threshold: time.Minute,
+							},
+							LogRedaction: LogRedaction{
+								Patterns: redact.DefaultPatterns,
+							},
+							UploadGC: UploadGC{
+								Enabled:   true,
+								Interval:  5 * time.Minute,
+								Timeout:   time.Hour,
+								BatchSize: 100,
+							},
+							CheckinStreaming: CheckinStreaming{
+								MinActions: 100,
+								BufferSize: 32 * 1024,
+							},
+							LongPollBudget: LongPollBudget{
+								MaxPerIP: 1000,
+							},
+							PeerCache: PeerCache{
+								TTL: time.Hour,
+							},
+							ActionIngest: ActionIngest{
+								Writers:    []string{"elastic/kibana"},
+								MaxActions: 1000,
+							},
+							DispatchJournal: DispatchJournal{
+								Retention: 14 * 24 * time.Hour,
+							},
+							SchemaValidation: SchemaValidation{},
 						},
 						Cache: Cache{
 							NumCounters: defaultCacheNumCounters,
 							MaxCost:     defaultCacheMaxCost,
+							AuthFailures: CacheSegment{
+								MaxCost: defaultCacheAuthFailuresMaxCost,
+							},
+							ActionTTL: defaultCacheActionTTL,
 						},
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:       defaultFetchSize,
+							PollTimeout:     defaultPollTimeout,
+							WaitForAdvance:  true,
+							MinPollInterval: defaultMinPollInterval,
+							MaxPollInterval: defaultMaxPollInterval,
 						},
 					},
 				},
@@ -132,7 +355,25 @@ func TestConfig(t *testing.T) {
 						BulkFlushThresholdCount: 2048,
 						BulkFlushThresholdSize:  1048576,
 						BulkFlushMaxPending:     8,
-						Timeout:                 90 * time.Second,
+						BulkMaxDocumentSize:     104857600,
+						BulkRetryMax:            3,
+						BulkRetryBackoff:        100 * time.Millisecond,
+						BulkRetryMaxBackoff:     5 * time.Second,
+						BulkRetryRate:           1000,
+						BulkFlushTuning: BulkFlushTuning{
+							Interval:    time.Second,
+							MinInterval: 10 * time.Millisecond,
+							MaxInterval: time.Second,
+							MinPending:  4,
+							MaxPending:  32,
+							HighRate:    5000,
+							HighLatency: 500 * time.Millisecond,
+						},
+						Timeout:            90 * time.Second,
+						DNSResolveInterval: time.Minute,
+						TrustStore: TrustStore{
+							ReloadInterval: time.Minute,
+						},
 					},
 				},
 				Inputs: []Input{
@@ -160,6 +401,11 @@ func TestConfig(t *testing.T) {
 								CheckinLimit: Limit{
 									Interval: time.Millisecond,
 									Burst:    1000,
+									MaxBody:  1024 * 1024,
+								},
+								CheckinPollLimit: Limit{
+									Interval: time.Millisecond / 10,
+									Burst:    2000,
 								},
 								ArtifactLimit: Limit{
 									Interval: time.Millisecond * 5,
@@ -175,16 +421,214 @@ func TestConfig(t *testing.T) {
 									Interval: time.Millisecond * 10,
 									Burst:    100,
 									Max:      50,
+									MaxBody:  2 * 1024 * 1024,
+								},
+								AdminLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								ReissueLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								TelemetryLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    100,
+									Max:      50,
+									MaxBody:  1024 * 1024,
+								},
+								UploadLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    20,
+									Max:      10,
+								},
+								ApiKeyLimit: KeyLimit{
+									Interval: time.Millisecond * 100,
+									Burst:    100,
+									Block:    time.Minute * 5,
 								},
+								Global: GlobalLimits{
+									Window:       time.Second * 10,
+									SyncInterval: time.Second,
+								},
+							},
+							CertExpiry: CertExpiry{
+								Warn:          30 * 24 * time.Hour,
+								Critical:      7 * 24 * time.Hour,
+								CheckInterval: time.Hour,
+							},
+							Offline: Offline{
+								QueueSize:    100000,
+								DropPolicy:   DropOldest,
+								GracePeriod:  10 * time.Minute,
+								MaxStaleness: 30 * time.Minute,
+							},
+							DeletedPolicy: DeletedPolicy{
+								Action:        DeletedPolicyNone,
+								CheckInterval: 5 * time.Minute,
+							},
+							PendingActions: PendingActions{
+								MaxPerCheckin: 100,
+								MaxQueued:     1000,
+							},
+							EnrollmentHistory: EnrollmentHistory{
+								Enabled:   true,
+								Retention: 30 * 24 * time.Hour,
+							},
+							UserAgent: UserAgent{
+								Mode: UserAgentModeEnforce,
+							},
+							LocalMetadata: LocalMetadata{
+								MaxSize:   64 * 1024,
+								MaxFields: 1000,
+							},
+							AutoUnenroll: AutoUnenroll{
+								MaxFailures: 50,
+								Window:      24 * time.Hour,
+							},
+							Upload: Upload{
+								ChunkSize:   4 * 1024 * 1024,
+								MaxFileSize: 10 * 1024 * 1024 * 1024,
+								Storage: UploadStorage{
+									Backend: UploadBackendElasticsearch,
+									Timeout: time.Minute,
+								},
+							},
+							UploadScan: UploadScan{
+								Timeout: 30 * time.Second,
+							},
+							ArtifactCaching: ArtifactCaching{
+								Enabled: true,
+								MaxAge:  24 * time.Hour,
 							},
+							ArtifactRedirect: ArtifactRedirect{
+								Signer: "hmac",
+								TTL:    5 * time.Minute,
+							},
+							AgentTelemetry: AgentTelemetry{
+								Timeout: 10 * time.Second,
+							},
+							Maintenance: Maintenance{
+								Timezone: "UTC",
+							},
+							LifecycleEvents: LifecycleEvents{
+								OutboxSize:   10000,
+								BatchSize:    100,
+								RetryInit:    time.Second,
+								RetryMax:     time.Minute,
+								OfflineAfter: 5 * time.Minute,
+								Webhook: LifecycleWebhook{
+									Timeout: 10 * time.Second,
+								},
+								Kafka: LifecycleKafka{
+									ClientID: "fleet-server",
+									Timeout:  10 * time.Second,
+								},
+								NATS: LifecycleNATS{
+									Timeout: 10 * time.Second,
+								},
+							},
+							Watchdog: Watchdog{
+								Interval:  30 * time.Second,
+								Grace:     time.Minute,
+								MaxStacks: 10,
+							},
+							Migration: Migration{
+								QueueSize:     100000,
+								Workers:       32,
+								CheckInterval: 5 * time.Minute,
+								CheckSample:   100,
+							},
+							RollingRestart: RollingRestart{
+								MinServing:    1,
+								DrainTimeout:  30 * time.Second,
+								CheckInterval: 5 * time.Second,
+							},
+							AdaptiveCompression: AdaptiveCompression{
+								Interval:     10 * time.Second,
+								MinLevel:     1,
+								MaxLevel:     6,
+								MinThreshold: 1024,
+								MaxThreshold: 64 * 1024,
+								HighCPU:      0.8,
+								LowCPU:       0.5,
+							},
+							DebugCapture: DebugCapture{
+								Name:        "fleet-server-capture.log",
+								MaxSize:     10 * 1024 * 1024,
+								MaxBackups:  2,
+								DefaultTTL:  15 * time.Minute,
+								MaxTTL:      4 * time.Hour,
+								MaxAgents:   10,
+								MaxBodySize: 64 * 1024,
+							},
+							Shadow: Shadow{
+								SampleRate:  0.01,
+								Timeout:     5 * time.Second,
+								QueueSize:   100,
+								Workers:     2,
+								MaxBodySize: 1024 * 1024,
+							},
+							AgentID: AgentID{
+								Strategy: AgentIDRandom,
+								Fields:   []string{"host.id"},
+							},
+							Indices: Indices{},
+							Actions: Actions{},
+							LeakDetection: LeakDetection{
+								Interval:  time.Minute,
+								Tolerance: 10,
+							},
+							SlowRequests: SlowRequests{
+								Threshold: 5 * time.Second,
+							},
+							ClockSkew: ClockSkew{
+								Threshold: time.Minute,
+							},
+							LogRedaction: LogRedaction{
+								Patterns: redact.DefaultPatterns,
+							},
+							UploadGC: UploadGC{
+								Enabled:   true,
+								Interval:  5 * time.Minute,
+								Timeout:   time.Hour,
+								BatchSize: 100,
+							},
+							CheckinStreaming: CheckinStreaming{
+								MinActions: 100,
+								BufferSize: 32 * 1024,
+							},
+							LongPollBudget: LongPollBudget{
+								MaxPerIP: 1000,
+							},
+							PeerCache: PeerCache{
+								TTL: time.Hour,
+							},
+							ActionIngest: ActionIngest{
+								Writers:    []string{"elastic/kibana"},
+								MaxActions: 1000,
+							},
+							DispatchJournal: DispatchJournal{
+								Retention: 14 * 24 * time.Hour,
+							},
+							SchemaValidation: SchemaValidation{},
 						},
 						Cache: Cache{
 							NumCounters: defaultCacheNumCounters,
 							MaxCost:     defaultCacheMaxCost,
+							AuthFailures: CacheSegment{
+								MaxCost: defaultCacheAuthFailuresMaxCost,
+							},
+							ActionTTL: defaultCacheActionTTL,
 						},
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:       defaultFetchSize,
+							PollTimeout:     defaultPollTimeout,
+							WaitForAdvance:  true,
+							MinPollInterval: defaultMinPollInterval,
+							MaxPollInterval: defaultMaxPollInterval,
 						},
 					},
 				},
@@ -220,7 +664,25 @@ func TestConfig(t *testing.T) {
 						BulkFlushThresholdCount: 2048,
 						BulkFlushThresholdSize:  1048576,
 						BulkFlushMaxPending:     8,
-						Timeout:                 90 * time.Second,
+						BulkMaxDocumentSize:     104857600,
+						BulkRetryMax:            3,
+						BulkRetryBackoff:        100 * time.Millisecond,
+						BulkRetryMaxBackoff:     5 * time.Second,
+						BulkRetryRate:           1000,
+						BulkFlushTuning: BulkFlushTuning{
+							Interval:    time.Second,
+							MinInterval: 10 * time.Millisecond,
+							MaxInterval: time.Second,
+							MinPending:  4,
+							MaxPending:  32,
+							HighRate:    5000,
+							HighLatency: 500 * time.Millisecond,
+						},
+						Timeout:            90 * time.Second,
+						DNSResolveInterval: time.Minute,
+						TrustStore: TrustStore{
+							ReloadInterval: time.Minute,
+						},
 					},
 				},
 				Inputs: []Input{
@@ -248,6 +710,11 @@ func TestConfig(t *testing.T) {
 								CheckinLimit: Limit{
 									Interval: time.Millisecond,
 									Burst:    1000,
+									MaxBody:  1024 * 1024,
+								},
+								CheckinPollLimit: Limit{
+									Interval: time.Millisecond / 10,
+									Burst:    2000,
 								},
 								ArtifactLimit: Limit{
 									Interval: time.Millisecond * 5,
@@ -263,16 +730,214 @@ func TestConfig(t *testing.T) {
 									Interval: time.Millisecond * 10,
 									Burst:    100,
 									Max:      50,
+									MaxBody:  2 * 1024 * 1024,
+								},
+								AdminLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								ReissueLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								TelemetryLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    100,
+									Max:      50,
+									MaxBody:  1024 * 1024,
+								},
+								UploadLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    20,
+									Max:      10,
+								},
+								ApiKeyLimit: KeyLimit{
+									Interval: time.Millisecond * 100,
+									Burst:    100,
+									Block:    time.Minute * 5,
 								},
+								Global: GlobalLimits{
+									Window:       time.Second * 10,
+									SyncInterval: time.Second,
+								},
+							},
+							CertExpiry: CertExpiry{
+								Warn:          30 * 24 * time.Hour,
+								Critical:      7 * 24 * time.Hour,
+								CheckInterval: time.Hour,
+							},
+							Offline: Offline{
+								QueueSize:    100000,
+								DropPolicy:   DropOldest,
+								GracePeriod:  10 * time.Minute,
+								MaxStaleness: 30 * time.Minute,
+							},
+							DeletedPolicy: DeletedPolicy{
+								Action:        DeletedPolicyNone,
+								CheckInterval: 5 * time.Minute,
+							},
+							PendingActions: PendingActions{
+								MaxPerCheckin: 100,
+								MaxQueued:     1000,
+							},
+							EnrollmentHistory: EnrollmentHistory{
+								Enabled:   true,
+								Retention: 30 * 24 * time.Hour,
+							},
+							UserAgent: UserAgent{
+								Mode: UserAgentModeEnforce,
+							},
+							LocalMetadata: LocalMetadata{
+								MaxSize:   64 * 1024,
+								MaxFields: 1000,
+							},
+							AutoUnenroll: AutoUnenroll{
+								MaxFailures: 50,
+								Window:      24 * time.Hour,
+							},
+							Upload: Upload{
+								ChunkSize:   4 * 1024 * 1024,
+								MaxFileSize: 10 * 1024 * 1024 * 1024,
+								Storage: UploadStorage{
+									Backend: UploadBackendElasticsearch,
+									Timeout: time.Minute,
+								},
+							},
+							UploadScan: UploadScan{
+								Timeout: 30 * time.Second,
+							},
+							ArtifactCaching: ArtifactCaching{
+								Enabled: true,
+								MaxAge:  24 * time.Hour,
 							},
+							ArtifactRedirect: ArtifactRedirect{
+								Signer: "hmac",
+								TTL:    5 * time.Minute,
+							},
+							AgentTelemetry: AgentTelemetry{
+								Timeout: 10 * time.Second,
+							},
+							Maintenance: Maintenance{
+								Timezone: "UTC",
+							},
+							LifecycleEvents: LifecycleEvents{
+								OutboxSize:   10000,
+								BatchSize:    100,
+								RetryInit:    time.Second,
+								RetryMax:     time.Minute,
+								OfflineAfter: 5 * time.Minute,
+								Webhook: LifecycleWebhook{
+									Timeout: 10 * time.Second,
+								},
+								Kafka: LifecycleKafka{
+									ClientID: "fleet-server",
+									Timeout:  10 * time.Second,
+								},
+								NATS: LifecycleNATS{
+									Timeout: 10 * time.Second,
+								},
+							},
+							Watchdog: Watchdog{
+								Interval:  30 * time.Second,
+								Grace:     time.Minute,
+								MaxStacks: 10,
+							},
+							Migration: Migration{
+								QueueSize:     100000,
+								Workers:       32,
+								CheckInterval: 5 * time.Minute,
+								CheckSample:   100,
+							},
+							RollingRestart: RollingRestart{
+								MinServing:    1,
+								DrainTimeout:  30 * time.Second,
+								CheckInterval: 5 * time.Second,
+							},
+							AdaptiveCompression: AdaptiveCompression{
+								Interval:     10 * time.Second,
+								MinLevel:     1,
+								MaxLevel:     6,
+								MinThreshold: 1024,
+								MaxThreshold: 64 * 1024,
+								HighCPU:      0.8,
+								LowCPU:       0.5,
+							},
+							DebugCapture: DebugCapture{
+								Name:        "fleet-server-capture.log",
+								MaxSize:     10 * 1024 * 1024,
+								MaxBackups:  2,
+								DefaultTTL:  15 * time.Minute,
+								MaxTTL:      4 * time.Hour,
+								MaxAgents:   10,
+								MaxBodySize: 64 * 1024,
+							},
+							Shadow: Shadow{
+								SampleRate:  0.01,
+								Timeout:     5 * time.Second,
+								QueueSize:   100,
+								Workers:     2,
+								MaxBodySize: 1024 * 1024,
+							},
+							AgentID: AgentID{
+								Strategy: AgentIDRandom,
+								Fields:   []string{"host.id"},
+							},
+							Indices: Indices{},
+							Actions: Actions{},
+							LeakDetection: LeakDetection{
+								Interval:  time.Minute,
+								Tolerance: 10,
+							},
+							SlowRequests: SlowRequests{
+								Threshold: 5 * time.Second,
+							},
+							ClockSkew: ClockSkew{
+								Threshold: time.Minute,
+							},
+							LogRedaction: LogRedaction{
+								Patterns: redact.DefaultPatterns,
+							},
+							UploadGC: UploadGC{
+								Enabled:   true,
+								Interval:  5 * time.Minute,
+								Timeout:   time.Hour,
+								BatchSize: 100,
+							},
+							CheckinStreaming: CheckinStreaming{
+								MinActions: 100,
+								BufferSize: 32 * 1024,
+							},
+							LongPollBudget: LongPollBudget{
+								MaxPerIP: 1000,
+							},
+							PeerCache: PeerCache{
+								TTL: time.Hour,
+							},
+							ActionIngest: ActionIngest{
+								Writers:    []string{"elastic/kibana"},
+								MaxActions: 1000,
+							},
+							DispatchJournal: DispatchJournal{
+								Retention: 14 * 24 * time.Hour,
+							},
+							SchemaValidation: SchemaValidation{},
 						},
 						Cache: Cache{
 							NumCounters: defaultCacheNumCounters,
 							MaxCost:     defaultCacheMaxCost,
+							AuthFailures: CacheSegment{
+								MaxCost: defaultCacheAuthFailuresMaxCost,
+							},
+							ActionTTL: defaultCacheActionTTL,
 						},
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:       defaultFetchSize,
+							PollTimeout:     defaultPollTimeout,
+							WaitForAdvance:  true,
+							MinPollInterval: defaultMinPollInterval,
+							MaxPollInterval: defaultMaxPollInterval,
 						},
 					},
 				},
@@ -308,7 +973,25 @@ func TestConfig(t *testing.T) {
 						BulkFlushThresholdCount: 2048,
 						BulkFlushThresholdSize:  1048576,
 						BulkFlushMaxPending:     8,
-						Timeout:                 90 * time.Second,
+						BulkMaxDocumentSize:     104857600,
+						BulkRetryMax:            3,
+						BulkRetryBackoff:        100 * time.Millisecond,
+						BulkRetryMaxBackoff:     5 * time.Second,
+						BulkRetryRate:           1000,
+						BulkFlushTuning: BulkFlushTuning{
+							Interval:    time.Second,
+							MinInterval: 10 * time.Millisecond,
+							MaxInterval: time.Second,
+							MinPending:  4,
+							MaxPending:  32,
+							HighRate:    5000,
+							HighLatency: 500 * time.Millisecond,
+						},
+						Timeout:            90 * time.Second,
+						DNSResolveInterval: time.Minute,
+						TrustStore: TrustStore{
+							ReloadInterval: time.Minute,
+						},
 					},
 				},
 				Inputs: []Input{
@@ -336,6 +1019,11 @@ func TestConfig(t *testing.T) {
 								CheckinLimit: Limit{
 									Interval: time.Millisecond,
 									Burst:    1000,
+									MaxBody:  1024 * 1024,
+								},
+								CheckinPollLimit: Limit{
+									Interval: time.Millisecond / 10,
+									Burst:    2000,
 								},
 								ArtifactLimit: Limit{
 									Interval: time.Millisecond * 5,
@@ -351,16 +1039,214 @@ func TestConfig(t *testing.T) {
 									Interval: time.Millisecond * 10,
 									Burst:    100,
 									Max:      50,
+									MaxBody:  2 * 1024 * 1024,
+								},
+								AdminLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								ReissueLimit: Limit{
+									Interval: time.Millisecond * 100,
+									Burst:    10,
+									Max:      10,
+								},
+								TelemetryLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    100,
+									Max:      50,
+									MaxBody:  1024 * 1024,
+								},
+								UploadLimit: Limit{
+									Interval: time.Millisecond * 10,
+									Burst:    20,
+									Max:      10,
+								},
+								ApiKeyLimit: KeyLimit{
+									Interval: time.Millisecond * 100,
+									Burst:    100,
+									Block:    time.Minute * 5,
 								},
+								Global: GlobalLimits{
+									Window:       time.Second * 10,
+									SyncInterval: time.Second,
+								},
+							},
+							CertExpiry: CertExpiry{
+								Warn:          30 * 24 * time.Hour,
+								Critical:      7 * 24 * time.Hour,
+								CheckInterval: time.Hour,
+							},
+							Offline: Offline{
+								QueueSize:    100000,
+								DropPolicy:   DropOldest,
+								GracePeriod:  10 * time.Minute,
+								MaxStaleness: 30 * time.Minute,
+							},
+							DeletedPolicy: DeletedPolicy{
+								Action:        DeletedPolicyNone,
+								CheckInterval: 5 * time.Minute,
+							},
+							PendingActions: PendingActions{
+								MaxPerCheckin: 100,
+								MaxQueued:     1000,
+							},
+							EnrollmentHistory: EnrollmentHistory{
+								Enabled:   true,
+								Retention: 30 * 24 * time.Hour,
+							},
+							UserAgent: UserAgent{
+								Mode: UserAgentModeEnforce,
+							},
+							LocalMetadata: LocalMetadata{
+								MaxSize:   64 * 1024,
+								MaxFields: 1000,
+							},
+							AutoUnenroll: AutoUnenroll{
+								MaxFailures: 50,
+								Window:      24 * time.Hour,
+							},
+							Upload: Upload{
+								ChunkSize:   4 * 1024 * 1024,
+								MaxFileSize: 10 * 1024 * 1024 * 1024,
+								Storage: UploadStorage{
+									Backend: UploadBackendElasticsearch,
+									Timeout: time.Minute,
+								},
+							},
+							UploadScan: UploadScan{
+								Timeout: 30 * time.Second,
+							},
+							ArtifactCaching: ArtifactCaching{
+								Enabled: true,
+								MaxAge:  24 * time.Hour,
 							},
+							ArtifactRedirect: ArtifactRedirect{
+								Signer: "hmac",
+								TTL:    5 * time.Minute,
+							},
+							AgentTelemetry: AgentTelemetry{
+								Timeout: 10 * time.Second,
+							},
+							Maintenance: Maintenance{
+								Timezone: "UTC",
+							},
+							LifecycleEvents: LifecycleEvents{
+								OutboxSize:   10000,
+								BatchSize:    100,
+								RetryInit:    time.Second,
+								RetryMax:     time.Minute,
+								OfflineAfter: 5 * time.Minute,
+								Webhook: LifecycleWebhook{
+									Timeout: 10 * time.Second,
+								},
+								Kafka: LifecycleKafka{
+									ClientID: "fleet-server",
+									Timeout:  10 * time.Second,
+								},
+								NATS: LifecycleNATS{
+									Timeout: 10 * time.Second,
+								},
+							},
+							Watchdog: Watchdog{
+								Interval:  30 * time.Second,
+								Grace:     time.Minute,
+								MaxStacks: 10,
+							},
+							Migration: Migration{
+								QueueSize:     100000,
+								Workers:       32,
+								CheckInterval: 5 * time.Minute,
+								CheckSample:   100,
+							},
+							RollingRestart: RollingRestart{
+								MinServing:    1,
+								DrainTimeout:  30 * time.Second,
+								CheckInterval: 5 * time.Second,
+							},
+							AdaptiveCompression: AdaptiveCompression{
+								Interval:     10 * time.Second,
+								MinLevel:     1,
+								MaxLevel:     6,
+								MinThreshold: 1024,
+								MaxThreshold: 64 * 1024,
+								HighCPU:      0.8,
+								LowCPU:       0.5,
+							},
+							DebugCapture: DebugCapture{
+								Name:        "fleet-server-capture.log",
+								MaxSize:     10 * 1024 * 1024,
+								MaxBackups:  2,
+								DefaultTTL:  15 * time.Minute,
+								MaxTTL:      4 * time.Hour,
+								MaxAgents:   10,
+								MaxBodySize: 64 * 1024,
+							},
+							Shadow: Shadow{
+								SampleRate:  0.01,
+								Timeout:     5 * time.Second,
+								QueueSize:   100,
+								Workers:     2,
+								MaxBodySize: 1024 * 1024,
+							},
+							AgentID: AgentID{
+								Strategy: AgentIDRandom,
+								Fields:   []string{"host.id"},
+							},
+							Indices: Indices{},
+							Actions: Actions{},
+							LeakDetection: LeakDetection{
+								Interval:  time.Minute,
+								Tolerance: 10,
+							},
+							SlowRequests: SlowRequests{
+								Threshold: 5 * time.Second,
+							},
+							ClockSkew: ClockSkew{
+								Threshold: time.Minute,
+							},
+							LogRedaction: LogRedaction{
+								Patterns: redact.DefaultPatterns,
+							},
+							UploadGC: UploadGC{
+								Enabled:   true,
+								Interval:  5 * time.Minute,
+								Timeout:   time.Hour,
+								BatchSize: 100,
+							},
+							CheckinStreaming: CheckinStreaming{
+								MinActions: 100,
+								BufferSize: 32 * 1024,
+							},
+							LongPollBudget: LongPollBudget{
+								MaxPerIP: 1000,
+							},
+							PeerCache: PeerCache{
+								TTL: time.Hour,
+							},
+							ActionIngest: ActionIngest{
+								Writers:    []string{"elastic/kibana"},
+								MaxActions: 1000,
+							},
+							DispatchJournal: DispatchJournal{
+								Retention: 14 * 24 * time.Hour,
+							},
+							SchemaValidation: SchemaValidation{},
 						},
 						Cache: Cache{
 							NumCounters: defaultCacheNumCounters,
 							MaxCost:     defaultCacheMaxCost,
+							AuthFailures: CacheSegment{
+								MaxCost: defaultCacheAuthFailuresMaxCost,
+							},
+							ActionTTL: defaultCacheActionTTL,
 						},
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:       defaultFetchSize,
+							PollTimeout:     defaultPollTimeout,
+							WaitForAdvance:  true,
+							MinPollInterval: defaultMinPollInterval,
+							MaxPollInterval: defaultMaxPollInterval,
 						},
 					},
 				},
@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DebugCapture configures the capture of the requests of chosen agents,
+// enabled per agent for a TTL through the admin API. The requests and
+// responses of a captured agent are logged with their bodies, redacted, to a
+// file of their own whatever the log level. The file is written to Path, by
+// default the directory of the log files.
+type DebugCapture struct {
+	Path        string        `config:"path"`
+	Name        string        `config:"name"`
+	MaxSize     uint          `config:"rotateeverybytes"`
+	MaxBackups  uint          `config:"keepfiles"`
+	DefaultTTL  time.Duration `config:"default_ttl"`
+	MaxTTL      time.Duration `config:"max_ttl"`
+	MaxAgents   int           `config:"max_agents"`
+	MaxBodySize int           `config:"max_body_size"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *DebugCapture) InitDefaults() {
+	c.Name = "fleet-server-capture.log"
+	c.MaxSize = 10 * 1024 * 1024
+	c.MaxBackups = 2
+	c.DefaultTTL = 15 * time.Minute
+	c.MaxTTL = 4 * time.Hour
+	c.MaxAgents = 10
+	c.MaxBodySize = 64 * 1024
+}
+
+// Validate ensures that the configuration is valid.
+func (c *DebugCapture) Validate() error {
+	if c.DefaultTTL <= 0 || c.MaxTTL <= 0 {
+		return fmt.Errorf("default_ttl and max_ttl must be positive")
+	}
+	if c.DefaultTTL > c.MaxTTL {
+		return fmt.Errorf("default_ttl must not exceed max_ttl")
+	}
+	if c.MaxAgents < 0 || c.MaxBodySize < 0 {
+		return fmt.Errorf("max_agents and max_body_size must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DeletedPolicyNone     = "none"
+	DeletedPolicyReassign = "reassign"
+	DeletedPolicyOrphan   = "orphan"
+)
+
+// DeletedPolicy controls what happens to the agents assigned to a policy that
+// no longer exists. The policies of the agents are checked every CheckInterval
+// by a single Fleet Server; a policy missing on two consecutive checks is
+// deleted.
+//
+// With the reassign action its agents are reassigned to DefaultPolicyID. With
+// the orphan action they are marked orphaned and sent an action recording the
+// deleted policy, for an operator to reassign them. None, the default, leaves
+// them waiting for the policy.
+type DeletedPolicy struct {
+	Action          string        `config:"action"`
+	DefaultPolicyID string        `config:"default_policy_id"`
+	CheckInterval   time.Duration `config:"check_interval"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *DeletedPolicy) InitDefaults() {
+	c.Action = DeletedPolicyNone
+	c.CheckInterval = 5 * time.Minute
+}
+
+// Validate ensures that the configuration is valid.
+func (c *DeletedPolicy) Validate() error {
+	switch c.Action {
+	case DeletedPolicyNone, DeletedPolicyOrphan:
+	case DeletedPolicyReassign:
+		if c.DefaultPolicyID == "" {
+			return fmt.Errorf("default_policy_id is required to reassign the agents of deleted policies")
+		}
+	default:
+		return fmt.Errorf("invalid action %q; must be %s, %s or %s", c.Action, DeletedPolicyNone, DeletedPolicyReassign, DeletedPolicyOrphan)
+	}
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("check_interval must be positive")
+	}
+	return nil
+}
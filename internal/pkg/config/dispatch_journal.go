@@ -0,0 +1,35 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DispatchJournal controls the recording of the checkin responses sending
+// actions to an agent into the dispatch journal. Entries older than Retention
+// are deleted by the ILM policy of the journal data stream.
+type DispatchJournal struct {
+	Enabled   bool          `config:"enabled"`
+	Retention time.Duration `config:"retention"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *DispatchJournal) InitDefaults() {
+	c.Enabled = false
+	c.Retention = 14 * 24 * time.Hour
+}
+
+// Validate ensures that the configuration is valid.
+func (c *DispatchJournal) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Retention <= 0 {
+		return fmt.Errorf("retention must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// EnrollmentHistory controls the recording of every enrollment attempt into
+// the enrollment history. Events older than Retention are deleted by the ILM
+// policy of the history data stream; zero keeps them.
+type EnrollmentHistory struct {
+	Enabled   bool          `config:"enabled"`
+	Retention time.Duration `config:"retention"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *EnrollmentHistory) InitDefaults() {
+	c.Enabled = true
+	c.Retention = 30 * 24 * time.Hour
+}
+
+// Validate ensures that the configuration is valid.
+func (c *EnrollmentHistory) Validate() error {
+	if c.Retention < 0 {
+		return fmt.Errorf("retention must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/flag"
+)
+
+// EnvPrefix prefixes the environment variables overriding configuration keys.
+const EnvPrefix = "FLEET_SERVER_"
+
+// Env overrides are merged into the inputs instead of replacing them, so a
+// single key of the fleet-server input can be set.
+var envMergeOptions = []ucfg.Option{
+	ucfg.PathSep("."),
+	ucfg.ResolveEnv,
+	ucfg.VarExp,
+}
+
+// EnvVar is the environment variable overriding a configuration key, such as
+// FLEET_SERVER_INPUTS_0_SERVER_PORT for inputs.0.server.port.
+type EnvVar struct {
+	Name string
+	Key  string
+	Type string
+}
+
+// EnvVars returns the environment variables of all the configuration keys,
+// sorted by key.
+func EnvVars() []EnvVar {
+	var vars []EnvVar
+	walkKeys(reflect.TypeOf(Config{}), "", 0, func(key string, t reflect.Type) {
+		vars = append(vars, EnvVar{
+			Name: envName(key),
+			Key:  key,
+			Type: t.String(),
+		})
+	})
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Key < vars[j].Key
+	})
+	return vars
+}
+
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// walkKeys calls fn with every leaf key of the configuration type. Arrays of
+// structs are walked at index 0 only, the fleet-server input being the only
+// one; maps are left out as their keys are not known. Inlined structs add
+// their keys to the enclosing ones.
+func walkKeys(t reflect.Type, prefix string, depth int, fn func(key string, t reflect.Type)) {
+	if depth > 8 {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("config"), ",")
+		name := tag[0]
+		key := prefix + name
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch {
+		case name == "":
+			if len(tag) > 1 && tag[1] == "inline" && ft.Kind() == reflect.Struct {
+				walkKeys(ft, prefix, depth+1, fn)
+			}
+		case ft.Kind() == reflect.Map:
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			walkKeys(ft.Elem(), key+".0.", depth+1, fn)
+		case ft.Kind() == reflect.Struct && hasKeys(ft):
+			walkKeys(ft, key+".", depth+1, fn)
+		default:
+			fn(key, f.Type)
+		}
+	}
+}
+
+func hasKeys(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" && t.Field(i).Tag.Get("config") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// FromEnv returns the configuration set by the FLEET_SERVER_ variables of
+// environ, given as "NAME=value" as by os.Environ; values are parsed as with
+// the -E flag. Variables not matching a configuration key are ignored, as the
+// Elastic Agent container sets some of its own with the same prefix.
+func FromEnv(environ []string) (*ucfg.Config, error) {
+	keys := make(map[string]string)
+	for _, v := range EnvVars() {
+		keys[v.Name] = v.Key
+	}
+
+	overrides := flag.NewFlagKeyValue(ucfg.New(), true, envMergeOptions...)
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvPrefix) {
+			continue
+		}
+		key, ok := keys[parts[0]]
+		if !ok {
+			continue
+		}
+		if err := overrides.Set(key + "=" + parts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return overrides.Config(), nil
+}
+
+// MergeEnv merges the overrides of the process environment into c.
+func MergeEnv(c *ucfg.Config) error {
+	env, err := FromEnv(os.Environ())
+	if err != nil {
+		return err
+	}
+	return c.Merge(env, envMergeOptions...)
+}
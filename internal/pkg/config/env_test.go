@@ -0,0 +1,41 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvVars(t *testing.T) {
+	vars := make(map[string]string)
+	for _, v := range EnvVars() {
+		vars[v.Name] = v.Key
+	}
+
+	assert.Equal(t, "inputs.0.server.limits.max_connections", vars["FLEET_SERVER_INPUTS_0_SERVER_LIMITS_MAX_CONNECTIONS"])
+	assert.Equal(t, "output.elasticsearch.service_token", vars["FLEET_SERVER_OUTPUT_ELASTICSEARCH_SERVICE_TOKEN"])
+	assert.Equal(t, "http.named_pipe.user", vars["FLEET_SERVER_HTTP_NAMED_PIPE_USER"])
+	assert.NotContains(t, vars, "FLEET_SERVER_OUTPUT_ELASTICSEARCH_HEADERS")
+}
+
+func TestFromEnv(t *testing.T) {
+	env, err := FromEnv([]string{
+		"FLEET_SERVER_HTTP_PORT=5067",
+		"FLEET_SERVER_OUTPUT_ELASTICSEARCH_SERVICE_TOKEN=token",
+		"FLEET_SERVER_ENABLE=1", // set by the Elastic Agent container
+		"HOME=/root",
+	})
+	require.NoError(t, err)
+
+	cfg, err := FromConfig(env)
+	require.NoError(t, err)
+	assert.Equal(t, 5067, cfg.HTTP.Port)
+	assert.Equal(t, "token", cfg.Output.Elasticsearch.ServiceToken)
+}
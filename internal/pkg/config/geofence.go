@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	GeofenceUnknownDeny  = "deny"
+	GeofenceUnknownAllow = "allow"
+)
+
+// Geofence restricts where the agents of a policy enroll and check in from, by
+// the country and ASN labels the network table gives their address. The table
+// is read from NetworksFile, a CSV file of cidr,country,asn[,zone] lines,
+// followed by Networks; the most specific network of an address labels it. The
+// zones label the sites of the peer cache.
+type Geofence struct {
+	NetworksFile string           `config:"networks_file"`
+	Networks     []NetworkLabels  `config:"networks"`
+	Policies     []GeofencePolicy `config:"policies"`
+}
+
+// NetworkLabels labels the addresses of a network.
+type NetworkLabels struct {
+	CIDR    string `config:"cidr"`
+	Country string `config:"country"`
+	ASN     string `config:"asn"`
+	Zone    string `config:"zone"`
+}
+
+// GeofencePolicy accepts the agents of the policy from the addresses labelled
+// with one of the countries or ASNs. Unknown tells whether the addresses the
+// table does not label are allowed or denied, the default.
+type GeofencePolicy struct {
+	PolicyId  string   `config:"policy_id"`
+	Countries []string `config:"countries"`
+	ASNs      []string `config:"asns"`
+	Unknown   string   `config:"unknown"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Geofence) Validate() error {
+	for _, n := range c.Networks {
+		if _, _, err := net.ParseCIDR(n.CIDR); err != nil {
+			return fmt.Errorf("invalid network: %w", err)
+		}
+	}
+	seen := make(map[string]bool, len(c.Policies))
+	for _, p := range c.Policies {
+		if p.PolicyId == "" {
+			return fmt.Errorf("policy_id is required")
+		}
+		if seen[p.PolicyId] {
+			return fmt.Errorf("policy %q fenced twice", p.PolicyId)
+		}
+		seen[p.PolicyId] = true
+		if len(p.Countries) == 0 && len(p.ASNs) == 0 {
+			return fmt.Errorf("policy %q: countries or asns are required", p.PolicyId)
+		}
+		switch p.Unknown {
+		case "", GeofenceUnknownDeny, GeofenceUnknownAllow:
+		default:
+			return fmt.Errorf("policy %q: invalid unknown %q; must be %s or %s", p.PolicyId, p.Unknown, GeofenceUnknownDeny, GeofenceUnknownAllow)
+		}
+	}
+	return nil
+}
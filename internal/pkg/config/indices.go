@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	indexSuffixRe = regexp.MustCompile(`^[a-z0-9_-]*$`)
+	indexNameRe   = regexp.MustCompile(`^[a-z0-9._-]+$`)
+)
+
+// Indices names the indices, or aliases, the Fleet indices are stored in.
+// Suffix is added to all of them, so Fleet Servers of several tenants, or
+// test runs, share a cluster without sharing their documents. Overrides map
+// the name of an index without its .fleet- prefix, such as agents, to the
+// index it is stored in, without the suffix; switching an alias from one index
+// to the other migrates it blue/green. Kibana writes the policies, enrollment
+// keys and actions under their own names only; the indices they are renamed to
+// have to be aliases of those. Changes apply on restart.
+type Indices struct {
+	Suffix    string            `config:"suffix"`
+	Overrides map[string]string `config:"overrides"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Indices) InitDefaults() {
+	c.Suffix = ""
+	c.Overrides = nil
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Indices) Validate() error {
+	if !indexSuffixRe.MatchString(c.Suffix) {
+		return fmt.Errorf("suffix %q must be lowercase letters, digits, - and _", c.Suffix)
+	}
+	for name, index := range c.Overrides {
+		if !indexNameRe.MatchString(index) {
+			return fmt.Errorf("index %q of %s must be lowercase letters, digits, ., - and _", index, name)
+		}
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ package config
 import (
 	"compress/flate"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -49,6 +50,22 @@ func (c *ServerProfiler) InitDefaults() {
 	c.Bind = "localhost:6060"
 }
 
+// CertExpiry is the configuration for the monitoring of the expiry of the
+// configured certificates; a certificate that expires within Warn is logged
+// and reported by the status endpoint, within Critical it degrades the status.
+type CertExpiry struct {
+	Warn          time.Duration `config:"warn"`
+	Critical      time.Duration `config:"critical"`
+	CheckInterval time.Duration `config:"check_interval"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *CertExpiry) InitDefaults() {
+	c.Warn = 30 * 24 * time.Hour
+	c.Critical = 7 * 24 * time.Hour
+	c.CheckInterval = time.Hour
+}
+
 // ServerTLS is the TLS configuration for running the TLS endpoint.
 type ServerTLS struct {
 	Key  string `config:"key"`
@@ -66,6 +83,51 @@ type Server struct {
 	CompressionThresh int               `config:"compression_threshold"`
 	Limits            ServerLimits      `config:"limits"`
 	Runtime           Runtime           `config:"runtime"`
+	CertExpiry        CertExpiry        `config:"cert_expiry"`
+	Offline           Offline           `config:"offline"`
+	DeletedPolicy     DeletedPolicy     `config:"deleted_policy"`
+	AckTokens         AckTokens         `config:"ack_tokens"`
+	PendingActions    PendingActions    `config:"pending_actions"`
+	Simulation        Simulation        `config:"simulation"`
+	EnrollmentHistory EnrollmentHistory `config:"enrollment_history"`
+	UserAgent         UserAgent         `config:"user_agent"`
+	LocalMetadata     LocalMetadata     `config:"local_metadata"`
+	AutoUnenroll      AutoUnenroll      `config:"auto_unenroll"`
+	Geofence          Geofence          `config:"geofence"`
+	Upload            Upload            `config:"upload"`
+	UploadScan        UploadScan        `config:"upload_scan"`
+	ArtifactCaching   ArtifactCaching   `config:"artifact_caching"`
+	ArtifactRedirect  ArtifactRedirect  `config:"artifact_redirect"`
+	AgentTelemetry    AgentTelemetry    `config:"agent_telemetry"`
+	Maintenance       Maintenance       `config:"maintenance"`
+	LifecycleEvents   LifecycleEvents   `config:"lifecycle_events"`
+	Watchdog          Watchdog          `config:"watchdog"`
+	IPFilter          IPFilter          `config:"ip_filter"`
+	ClientIP          ClientIP          `config:"client_ip"`
+	Migration         Migration         `config:"migration"`
+	RollingRestart    RollingRestart    `config:"rolling_restart"`
+
+	AdaptiveCompression AdaptiveCompression `config:"adaptive_compression"`
+	DebugCapture        DebugCapture        `config:"debug_capture"`
+	Shadow              Shadow              `config:"shadow"`
+	AgentID             AgentID             `config:"agent_id"`
+	Indices             Indices             `config:"indices"`
+	Actions             Actions             `config:"actions"`
+	LeakDetection       LeakDetection       `config:"leak_detection"`
+	SlowRequests        SlowRequests        `config:"slow_requests"`
+	ClockSkew           ClockSkew           `config:"clock_skew"`
+	LogRedaction        LogRedaction        `config:"log_redaction"`
+	UploadGC            UploadGC            `config:"upload_gc"`
+	CheckinStreaming    CheckinStreaming    `config:"checkin_streaming"`
+	LongPollBudget      LongPollBudget      `config:"long_poll_budget"`
+	PeerCache           PeerCache           `config:"peer_cache"`
+	ActionIngest        ActionIngest        `config:"action_ingest"`
+	DispatchJournal     DispatchJournal     `config:"dispatch_journal"`
+	SchemaValidation    SchemaValidation    `config:"schema_validation"`
+
+	// Features enables or disables the subsystems gated by feature flags,
+	// by flag name; the flags absent keep their default.
+	Features map[string]bool `config:"features"`
 }
 
 // InitDefaults initializes the defaults for the configuration.
@@ -78,6 +140,41 @@ func (c *Server) InitDefaults() {
 	c.Profiler.InitDefaults()
 	c.Limits.InitDefaults()
 	c.Runtime.InitDefaults()
+	c.CertExpiry.InitDefaults()
+	c.Offline.InitDefaults()
+	c.DeletedPolicy.InitDefaults()
+	c.PendingActions.InitDefaults()
+	c.EnrollmentHistory.InitDefaults()
+	c.UserAgent.InitDefaults()
+	c.LocalMetadata.InitDefaults()
+	c.AutoUnenroll.InitDefaults()
+	c.Upload.InitDefaults()
+	c.UploadScan.InitDefaults()
+	c.ArtifactCaching.InitDefaults()
+	c.ArtifactRedirect.InitDefaults()
+	c.AgentTelemetry.InitDefaults()
+	c.Maintenance.InitDefaults()
+	c.LifecycleEvents.InitDefaults()
+	c.Watchdog.InitDefaults()
+	c.Migration.InitDefaults()
+	c.RollingRestart.InitDefaults()
+	c.AdaptiveCompression.InitDefaults()
+	c.DebugCapture.InitDefaults()
+	c.Shadow.InitDefaults()
+	c.AgentID.InitDefaults()
+	c.Indices.InitDefaults()
+	c.Actions.InitDefaults()
+	c.LeakDetection.InitDefaults()
+	c.SlowRequests.InitDefaults()
+	c.ClockSkew.InitDefaults()
+	c.LogRedaction.InitDefaults()
+	c.UploadGC.InitDefaults()
+	c.CheckinStreaming.InitDefaults()
+	c.LongPollBudget.InitDefaults()
+	c.PeerCache.InitDefaults()
+	c.ActionIngest.InitDefaults()
+	c.DispatchJournal.InitDefaults()
+	c.SchemaValidation.InitDefaults()
 }
 
 // BindAddress returns the binding address for the HTTP server.
@@ -106,6 +203,34 @@ func (c *Input) InitDefaults() {
 	c.Monitor.InitDefaults()
 }
 
+// Changed returns the settings that differ from other, named after their
+// configuration keys; the server section is broken down to its subsections.
+// It tells which settings a configuration update from the policy changes.
+func (c *Input) Changed(other *Input) []string {
+	var changed []string
+	changed = appendChanged(changed, "server.", reflect.ValueOf(c.Server), reflect.ValueOf(other.Server))
+	if !reflect.DeepEqual(c.Policy, other.Policy) {
+		changed = append(changed, "policy")
+	}
+	if !reflect.DeepEqual(c.Cache, other.Cache) {
+		changed = append(changed, "cache")
+	}
+	if !reflect.DeepEqual(c.Monitor, other.Monitor) {
+		changed = append(changed, "monitor")
+	}
+	return changed
+}
+
+func appendChanged(changed []string, prefix string, a, b reflect.Value) []string {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, prefix+t.Field(i).Tag.Get("config"))
+		}
+	}
+	return changed
+}
+
 // Validate ensures that the configuration is valid.
 func (c *Input) Validate() error {
 	if c.Type != "fleet-server" {
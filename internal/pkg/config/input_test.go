@@ -46,3 +46,16 @@ func TestBindAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestInputChanged(t *testing.T) {
+	var cur Input
+	cur.InitDefaults()
+
+	next := cur
+	assert.Empty(t, cur.Changed(&next))
+
+	next.Server.Limits.CheckinLimit.Burst++
+	next.Server.Timeouts.CheckinLongPoll *= 2
+	next.Cache.MaxCost *= 2
+	assert.Equal(t, []string{"server.timeouts", "server.limits", "cache"}, cur.Changed(&next))
+}
@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPFilter restricts the addresses each group of endpoints is reached from,
+// before the requests are authenticated. Enroll covers the enroll and reissue
+// endpoints, Checkin the checkins, acks and the other endpoints of the enrolled
+// agents, Artifacts the artifact downloads, Monitoring the status and version
+// endpoints and Admin the operator APIs.
+type IPFilter struct {
+	Enroll     IPList `config:"enroll"`
+	Checkin    IPList `config:"checkin"`
+	Artifacts  IPList `config:"artifacts"`
+	Monitoring IPList `config:"monitoring"`
+	Admin      IPList `config:"admin"`
+}
+
+// IPList refuses the addresses within Deny and, when Allow is set, those not
+// within Allow; the networks are given in CIDR notation or as single
+// addresses. Empty lists do not restrict the group.
+type IPList struct {
+	Allow []string `config:"allow"`
+	Deny  []string `config:"deny"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *IPFilter) Validate() error {
+	for name, l := range c.Groups() {
+		for _, n := range append(append([]string(nil), l.Allow...), l.Deny...) {
+			if _, err := ParseNetwork(n); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Groups returns the lists by group name.
+func (c *IPFilter) Groups() map[string]IPList {
+	return map[string]IPList{
+		"enroll":     c.Enroll,
+		"checkin":    c.Checkin,
+		"artifacts":  c.Artifacts,
+		"monitoring": c.Monitoring,
+		"admin":      c.Admin,
+	}
+}
+
+// ParseNetwork parses a network in CIDR notation, or a single address.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,42 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// LeakDetection checks every Interval that the subscriptions of the checkins
+// to the policy monitor and the action dispatcher, and the open long polls,
+// are no more than the open connections: each belongs to a checkin on one. A
+// count over them by more than Tolerance on two checks in a row is logged
+// and counted, as it grows while a slow leak goes unnoticed otherwise.
+type LeakDetection struct {
+	Enabled   bool          `config:"enabled"`
+	Interval  time.Duration `config:"interval"`
+	Tolerance int           `config:"tolerance"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *LeakDetection) InitDefaults() {
+	c.Enabled = false
+	c.Interval = time.Minute
+	c.Tolerance = 10
+}
+
+// Validate ensures that the configuration is valid.
+func (c *LeakDetection) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.Tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative")
+	}
+	return nil
+}
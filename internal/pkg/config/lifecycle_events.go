@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+)
+
+const (
+	LifecyclePublisherWebhook = "webhook"
+	LifecyclePublisherKafka   = "kafka"
+	LifecyclePublisherNATS    = "nats"
+)
+
+// LifecycleEvents publishes the lifecycle events of the agents, such as their
+// enrollment or the completion of their upgrade, to the Publisher: a webhook,
+// a Kafka topic or a NATS subject. The events are held in an outbox of
+// OutboxSize events until published, in batches of BatchSize, retried with
+// backoff; the oldest events are dropped when the outbox is full. An agent is
+// reported offline once it has not checked in for OfflineAfter; zero does not
+// report them.
+type LifecycleEvents struct {
+	Enabled      bool             `config:"enabled"`
+	Publisher    string           `config:"publisher"`
+	OutboxSize   int              `config:"outbox_size"`
+	BatchSize    int              `config:"batch_size"`
+	RetryInit    time.Duration    `config:"retry_init"`
+	RetryMax     time.Duration    `config:"retry_max"`
+	OfflineAfter time.Duration    `config:"offline_after"`
+	Webhook      LifecycleWebhook `config:"webhook"`
+	Kafka        LifecycleKafka   `config:"kafka"`
+	NATS         LifecycleNATS    `config:"nats"`
+}
+
+// LifecycleWebhook posts the batches of events as a JSON array to URL.
+type LifecycleWebhook struct {
+	URL     string            `config:"url"`
+	Headers map[string]string `config:"headers"`
+	Timeout time.Duration     `config:"timeout"`
+}
+
+// LifecycleKafka produces an event per message to Topic, keyed by agent.
+type LifecycleKafka struct {
+	Hosts    []string      `config:"hosts"`
+	Topic    string        `config:"topic"`
+	ClientID string        `config:"client_id"`
+	Timeout  time.Duration `config:"timeout"`
+}
+
+// LifecycleNATS publishes an event per message to Subject. The connection is
+// secured with TLS when configured or the URL is tls://; the credentials of
+// the URL are never sent over a connection that is not.
+type LifecycleNATS struct {
+	URL     string            `config:"url"`
+	Subject string            `config:"subject"`
+	Timeout time.Duration     `config:"timeout"`
+	TLS     *tlscommon.Config `config:"ssl"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *LifecycleEvents) InitDefaults() {
+	c.Enabled = false
+	c.OutboxSize = 10000
+	c.BatchSize = 100
+	c.RetryInit = time.Second
+	c.RetryMax = time.Minute
+	c.OfflineAfter = 5 * time.Minute
+	c.Webhook.Timeout = 10 * time.Second
+	c.Kafka.ClientID = "fleet-server"
+	c.Kafka.Timeout = 10 * time.Second
+	c.NATS.Timeout = 10 * time.Second
+}
+
+// Validate ensures that the configuration is valid.
+func (c *LifecycleEvents) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.OutboxSize <= 0 {
+		return fmt.Errorf("outbox_size must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("batch_size must be positive")
+	}
+	if c.RetryInit <= 0 || c.RetryMax < c.RetryInit {
+		return fmt.Errorf("retry_init must be positive and at most retry_max")
+	}
+	if c.OfflineAfter < 0 {
+		return fmt.Errorf("offline_after cannot be negative")
+	}
+
+	switch c.Publisher {
+	case LifecyclePublisherWebhook:
+		u, err := url.Parse(c.Webhook.URL)
+		if err != nil {
+			return fmt.Errorf("invalid webhook.url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("webhook.url must be http or https")
+		}
+		if c.Webhook.Timeout <= 0 {
+			return fmt.Errorf("webhook.timeout must be positive")
+		}
+	case LifecyclePublisherKafka:
+		if len(c.Kafka.Hosts) == 0 || c.Kafka.Topic == "" {
+			return fmt.Errorf("kafka.hosts and kafka.topic must be set")
+		}
+		if c.Kafka.Timeout <= 0 {
+			return fmt.Errorf("kafka.timeout must be positive")
+		}
+	case LifecyclePublisherNATS:
+		u, err := url.Parse(c.NATS.URL)
+		if err != nil {
+			return fmt.Errorf("invalid nats.url: %w", err)
+		}
+		if (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+			return fmt.Errorf("nats.url must be nats://host:port or tls://host:port")
+		}
+		secure := u.Scheme == "tls"
+		if c.NATS.TLS != nil && c.NATS.TLS.IsEnabled() {
+			if _, err := tlscommon.LoadTLSConfig(c.NATS.TLS); err != nil {
+				return fmt.Errorf("invalid nats.ssl: %w", err)
+			}
+			secure = true
+		}
+		if u.User != nil && !secure {
+			return fmt.Errorf("nats.url credentials require TLS; set nats.ssl or use tls://host:port")
+		}
+		if c.NATS.Subject == "" {
+			return fmt.Errorf("nats.subject must be set")
+		}
+		if c.NATS.Timeout <= 0 {
+			return fmt.Errorf("nats.timeout must be positive")
+		}
+	default:
+		return fmt.Errorf("publisher must be %s, %s or %s", LifecyclePublisherWebhook, LifecyclePublisherKafka, LifecyclePublisherNATS)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@
 package config
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -12,17 +13,94 @@ type Limit struct {
 	Interval time.Duration `config:"interval"`
 	Burst    int           `config:"burst"`
 	Max      int64         `config:"max"`
+
+	// MaxBody caps the size of the request bodies, once decompressed; 0 does
+	// not limit them.
+	MaxBody int64 `config:"max_body_byte_size"`
+
+	// Global additionally enforces the rate across all the Fleet Servers of
+	// the cluster, see GlobalLimits. Max stays per instance.
+	Global bool `config:"global"`
+}
+
+// GlobalLimits configures how the rate of the limits marked global is shared.
+// Each Fleet Server counts the requests it accepts in fixed windows and adds
+// them to a counter kept in Elasticsearch every SyncInterval; a window accepts
+// Window/Interval+Burst requests across the cluster.
+type GlobalLimits struct {
+	Window       time.Duration `config:"window"`
+	SyncInterval time.Duration `config:"sync_interval"`
+}
+
+// KeyLimit limits the request rate of a single API key across all routes; a
+// key that exceeds it is refused for the Block duration. With Quarantine the
+// agent of an access API key blocked is also quarantined, once the key is
+// authenticated.
+type KeyLimit struct {
+	Interval   time.Duration `config:"interval"`
+	Burst      int           `config:"burst"`
+	Block      time.Duration `config:"block"`
+	Quarantine bool          `config:"quarantine"`
+}
+
+// Bandwidth limits the rate of the bytes transferred, in bytes per second,
+// with budgets nested from Global, shared by all the transfers, to PerPolicy,
+// shared by the agents of a policy, to PerAgent; 0 does not limit. Policies
+// budgets given policies, by policy id, apart from PerPolicy.
+type Bandwidth struct {
+	Global    int64                      `config:"global"`
+	PerPolicy int64                      `config:"per_policy"`
+	PerAgent  int64                      `config:"per_agent"`
+	Policies  map[string]PolicyBandwidth `config:"policies"`
+}
+
+// PolicyBandwidth is the budget of the transfers of the agents of a policy:
+// Rate bytes per second, PerPolicy when 0, for at most MaxTransfers at once.
+// The transfers past MaxTransfers queue, up to MaxQueued, and start in order
+// as the others end; 0 does not limit.
+type PolicyBandwidth struct {
+	Rate         int64 `config:"rate"`
+	MaxTransfers int   `config:"max_transfers"`
+	MaxQueued    int   `config:"max_queued"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Bandwidth) Validate() error {
+	if c.Global < 0 || c.PerPolicy < 0 || c.PerAgent < 0 {
+		return fmt.Errorf("bandwidth must not be negative")
+	}
+	for id, p := range c.Policies {
+		if p.Rate < 0 || p.MaxTransfers < 0 || p.MaxQueued < 0 {
+			return fmt.Errorf("bandwidth of policy %s must not be negative", id)
+		}
+	}
+	return nil
 }
 
 type ServerLimits struct {
+	// Preset names the bundle of limits, cache and timeout settings tuned for
+	// a deployment size the other settings default to; see presets.
+	Preset string `config:"preset"`
+
 	PolicyThrottle    time.Duration `config:"policy_throttle"`
 	MaxHeaderByteSize int           `config:"max_header_byte_size"`
 	MaxConnections    int           `config:"max_connections"`
 
-	CheckinLimit  Limit `config:"checkin_limit"`
-	ArtifactLimit Limit `config:"artifact_limit"`
-	EnrollLimit   Limit `config:"enroll_limit"`
-	AckLimit      Limit `config:"ack_limit"`
+	CheckinLimit     Limit `config:"checkin_limit"`
+	CheckinPollLimit Limit `config:"checkin_poll_limit"`
+	ArtifactLimit    Limit `config:"artifact_limit"`
+	EnrollLimit      Limit `config:"enroll_limit"`
+	AckLimit         Limit `config:"ack_limit"`
+	AdminLimit       Limit `config:"admin_limit"`
+	ReissueLimit     Limit `config:"reissue_limit"`
+	TelemetryLimit   Limit `config:"telemetry_limit"`
+	UploadLimit      Limit `config:"upload_limit"`
+
+	ApiKeyLimit KeyLimit `config:"api_key_limit"`
+
+	ArtifactBandwidth Bandwidth `config:"artifact_bandwidth"`
+
+	Global GlobalLimits `config:"global"`
 }
 
 // InitDefaults initializes the defaults for the configuration.
@@ -35,6 +113,11 @@ func (c *ServerLimits) InitDefaults() {
 	c.CheckinLimit = Limit{
 		Interval: time.Millisecond,
 		Burst:    1000,
+		MaxBody:  1024 * 1024, // 1MiB
+	}
+	c.CheckinPollLimit = Limit{
+		Interval: time.Millisecond / 10,
+		Burst:    2000,
 	}
 	c.ArtifactLimit = Limit{
 		Interval: time.Millisecond * 5,
@@ -50,5 +133,36 @@ func (c *ServerLimits) InitDefaults() {
 		Interval: time.Millisecond * 10,
 		Burst:    100,
 		Max:      50,
+		MaxBody:  2 * 1024 * 1024, // 2MiB
+	}
+	c.AdminLimit = Limit{
+		Interval: time.Millisecond * 100,
+		Burst:    10,
+		Max:      10,
+	}
+	c.ReissueLimit = Limit{
+		Interval: time.Millisecond * 100,
+		Burst:    10,
+		Max:      10,
+	}
+	c.TelemetryLimit = Limit{
+		Interval: time.Millisecond * 10,
+		Burst:    100,
+		Max:      50,
+		MaxBody:  1024 * 1024, // 1MiB
+	}
+	c.UploadLimit = Limit{
+		Interval: time.Millisecond * 10,
+		Burst:    20,
+		Max:      10,
+	}
+	c.ApiKeyLimit = KeyLimit{
+		Interval: time.Millisecond * 100,
+		Burst:    100,
+		Block:    time.Minute * 5,
+	}
+	c.Global = GlobalLimits{
+		Window:       time.Second * 10,
+		SyncInterval: time.Second,
 	}
 }
@@ -0,0 +1,33 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import "fmt"
+
+// LocalMetadata bounds the local metadata stored for an agent, each of its
+// fields being mapped in the agents index. Metadata of more than MaxSize bytes
+// or MaxFields values, counting each array element, is truncated and the
+// agent flagged as such. Zero does not limit.
+type LocalMetadata struct {
+	MaxSize   int `config:"max_size"`
+	MaxFields int `config:"max_fields"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *LocalMetadata) InitDefaults() {
+	c.MaxSize = 64 * 1024
+	c.MaxFields = 1000
+}
+
+// Validate ensures that the configuration is valid.
+func (c *LocalMetadata) Validate() error {
+	if c.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative")
+	}
+	if c.MaxFields < 0 {
+		return fmt.Errorf("max_fields must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/redact"
+)
+
+// LogRedaction masks the values of the fields of the agent and policy
+// documents whose names match one of Patterns, at any depth, wherever they
+// reach the logs or the debug captures. The patterns are shell patterns
+// matched against the names in lower case.
+type LogRedaction struct {
+	Patterns []string `config:"patterns"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *LogRedaction) InitDefaults() {
+	c.Patterns = append([]string(nil), redact.DefaultPatterns...)
+}
+
+// Validate ensures that the configuration is valid.
+func (c *LogRedaction) Validate() error {
+	if err := redact.Validate(c.Patterns); err != nil {
+		return fmt.Errorf("patterns: %w", err)
+	}
+	return nil
+}
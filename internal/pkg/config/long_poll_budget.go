@@ -0,0 +1,49 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+)
+
+// LongPollBudget caps the checkins open at once from a source address to
+// MaxPerIP; the checkins over it are refused with a 429 before they are
+// authenticated. The addresses within Exempt, such as the NAT gateways of
+// large sites, are capped at ExemptMaxPerIP instead; 0 does not cap them. The
+// networks are given in CIDR notation or as single addresses. The source of a
+// request is its client, as set by ClientIP.
+type LongPollBudget struct {
+	Enabled        bool     `config:"enabled"`
+	MaxPerIP       int      `config:"max_per_ip"`
+	Exempt         []string `config:"exempt"`
+	ExemptMaxPerIP int      `config:"exempt_max_per_ip"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *LongPollBudget) InitDefaults() {
+	c.Enabled = false
+	c.MaxPerIP = 1000
+	c.Exempt = nil
+	c.ExemptMaxPerIP = 0
+}
+
+// Validate ensures that the configuration is valid.
+func (c *LongPollBudget) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MaxPerIP <= 0 {
+		return fmt.Errorf("max_per_ip must be positive")
+	}
+	if c.ExemptMaxPerIP < 0 {
+		return fmt.Errorf("exempt_max_per_ip must not be negative")
+	}
+	for _, n := range c.Exempt {
+		if _, err := ParseNetwork(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
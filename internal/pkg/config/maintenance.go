@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/maintenance"
+)
+
+// Maintenance confines the disruptive background jobs, such as the purge of
+// the abandoned uploads, to maintenance windows. A window opens at every
+// minute matching its cron schedule in Timezone and stays open for its
+// duration; the jobs are paused outside of the windows. Without windows the
+// jobs run at any time.
+type Maintenance struct {
+	Timezone string              `config:"timezone"`
+	Windows  []MaintenanceWindow `config:"windows"`
+}
+
+// MaintenanceWindow is a maintenance window; Schedule is a cron expression of
+// five fields, as in "0 22 * * 1-5".
+type MaintenanceWindow struct {
+	Schedule string        `config:"schedule"`
+	Duration time.Duration `config:"duration"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Maintenance) InitDefaults() {
+	c.Timezone = "UTC"
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Maintenance) Validate() error {
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	for _, w := range c.Windows {
+		s, err := maintenance.ParseSchedule(w.Schedule)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.Next(time.Now()); !ok {
+			return fmt.Errorf("schedule %q never matches", w.Schedule)
+		}
+		if w.Duration <= 0 {
+			return fmt.Errorf("duration of the window %q must be positive", w.Schedule)
+		}
+	}
+	return nil
+}
+
+// MaintenanceWindows returns the maintenance windows of the configuration;
+// nil if there are none.
+func (c *Maintenance) MaintenanceWindows() (*maintenance.Windows, error) {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	windows := make([]maintenance.Window, 0, len(c.Windows))
+	for _, w := range c.Windows {
+		s, err := maintenance.ParseSchedule(w.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, maintenance.Window{Schedule: s, Duration: w.Duration})
+	}
+	return maintenance.New(loc, windows), nil
+}
@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Migration mirrors the writes of Fleet Server to the documents of Indices,
+// by default those of the agents, their enrollment keys and their actions, and
+// the invalidations of the API keys, to the Elasticsearch cluster a live fleet
+// is moved to. The writes are replayed asynchronously by Workers, in order for
+// each document, from a queue of QueueSize writes; past it they are dropped.
+//
+// Every CheckInterval the documents of the agents last updated, CheckSample at
+// most, are compared between the clusters, and copied again when they differ;
+// 0 disables the checks.
+type Migration struct {
+	Enabled       bool           `config:"enabled"`
+	Elasticsearch *Elasticsearch `config:"elasticsearch"`
+	Indices       []string       `config:"indices"`
+	QueueSize     int            `config:"queue_size"`
+	Workers       int            `config:"workers"`
+	CheckInterval time.Duration  `config:"check_interval"`
+	CheckSample   int            `config:"check_sample"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Migration) InitDefaults() {
+	c.Enabled = false
+	c.QueueSize = 100000
+	c.Workers = 32
+	c.CheckInterval = 5 * time.Minute
+	c.CheckSample = 100
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Migration) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Elasticsearch == nil || len(c.Elasticsearch.Hosts) == 0 {
+		return fmt.Errorf("elasticsearch.hosts is required")
+	}
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("queue_size must be positive")
+	}
+	if c.Workers <= 0 {
+		return fmt.Errorf("workers must be positive")
+	}
+	if c.CheckInterval < 0 {
+		return fmt.Errorf("check_interval must not be negative")
+	}
+	if c.CheckSample < 0 {
+		return fmt.Errorf("check_sample must not be negative")
+	}
+	return nil
+}
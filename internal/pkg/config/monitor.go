@@ -7,16 +7,29 @@ package config
 import "time"
 
 const (
-	defaultFetchSize   = 1000
-	defaultPollTimeout = 4 * time.Minute
+	defaultFetchSize       = 1000
+	defaultPollTimeout     = 4 * time.Minute
+	defaultMinPollInterval = 250 * time.Millisecond
+	defaultMaxPollInterval = 10 * time.Second
 )
 
+// Monitor configures how the index monitors detect new documents. By default,
+// WaitForAdvance, they long poll Elasticsearch for the global checkpoint of
+// the index to advance, for up to PollTimeout. Without it they instead poll
+// the checkpoint, every MinPollInterval while it advances, backing off to
+// MaxPollInterval while it does not.
 type Monitor struct {
-	FetchSize   int           `config:"fetch_size"`
-	PollTimeout time.Duration `config:"poll_timeout"`
+	FetchSize       int           `config:"fetch_size"`
+	PollTimeout     time.Duration `config:"poll_timeout"`
+	WaitForAdvance  bool          `config:"wait_for_advance"`
+	MinPollInterval time.Duration `config:"min_poll_interval"`
+	MaxPollInterval time.Duration `config:"max_poll_interval"`
 }
 
 func (m *Monitor) InitDefaults() {
 	m.FetchSize = defaultFetchSize
 	m.PollTimeout = defaultPollTimeout
+	m.WaitForAdvance = true
+	m.MinPollInterval = defaultMinPollInterval
+	m.MaxPollInterval = defaultMaxPollInterval
 }
@@ -0,0 +1,52 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DropOldest = "oldest"
+	DropNewest = "newest"
+)
+
+// Offline controls how agent check-ins are handled while Elasticsearch is
+// unreachable. Check-in updates that fail to be written are kept, up to
+// QueueSize agents, and written again once Elasticsearch is back; when the
+// queue is full the updates chosen by DropPolicy are discarded.
+//
+// Checkins are then served in degraded mode, from the last known agent
+// records, policies and actions, for up to MaxStaleness after Elasticsearch
+// was last read successfully; zero disables the degraded mode. Only agents
+// authenticated within GracePeriod before the outage are served.
+type Offline struct {
+	QueueSize    int           `config:"queue_size"`
+	DropPolicy   string        `config:"drop_policy"`
+	GracePeriod  time.Duration `config:"grace_period"`
+	MaxStaleness time.Duration `config:"max_staleness"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Offline) InitDefaults() {
+	c.QueueSize = 100000
+	c.DropPolicy = DropOldest
+	c.GracePeriod = 10 * time.Minute
+	c.MaxStaleness = 30 * time.Minute
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Offline) Validate() error {
+	switch c.DropPolicy {
+	case DropOldest, DropNewest:
+	default:
+		return fmt.Errorf("invalid drop_policy %q; must be %s or %s", c.DropPolicy, DropOldest, DropNewest)
+	}
+	if c.QueueSize < 0 {
+		return fmt.Errorf("queue_size must not be negative")
+	}
+	return nil
+}
@@ -5,6 +5,7 @@
 package config
 
 import (
+	cryptotls "crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -18,6 +19,8 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/truststore"
 )
 
 // The timeout would be driven by the server for long poll.
@@ -28,24 +31,38 @@ var hasScheme = regexp.MustCompile(`^([a-z][a-z0-9+\-.]*)://`)
 
 // Elasticsearch is the configuration for elasticsearch.
 type Elasticsearch struct {
-	Protocol                string            `config:"protocol"`
-	Hosts                   []string          `config:"hosts"`
-	Path                    string            `config:"path"`
-	Headers                 map[string]string `config:"headers"`
-	Username                string            `config:"username"`
-	Password                string            `config:"password"`
-	APIKey                  string            `config:"api_key"`
-	ServiceToken            string            `config:"service_token"`
-	ProxyURL                string            `config:"proxy_url"`
-	ProxyDisable            bool              `config:"proxy_disable"`
-	TLS                     *tlscommon.Config `config:"ssl"`
-	MaxRetries              int               `config:"max_retries"`
-	MaxConnPerHost          int               `config:"max_conn_per_host"`
-	BulkFlushInterval       time.Duration     `config:"bulk_flush_interval"`
-	BulkFlushThresholdCount int               `config:"bulk_flush_threshold_cnt"`
-	BulkFlushThresholdSize  int               `config:"bulk_flush_threshold_size"`
-	BulkFlushMaxPending     int               `config:"bulk_flush_max_pending"`
-	Timeout                 time.Duration     `config:"timeout"`
+	Protocol                string                  `config:"protocol"`
+	Hosts                   []string                `config:"hosts"`
+	Path                    string                  `config:"path"`
+	Headers                 map[string]string       `config:"headers"`
+	Username                string                  `config:"username"`
+	Password                string                  `config:"password"`
+	APIKey                  string                  `config:"api_key"`
+	ServiceToken            string                  `config:"service_token"`
+	SecondaryServiceToken   string                  `config:"secondary_service_token"`
+	ServiceTokenCutover     string                  `config:"service_token_cutover"`
+	ProxyURL                string                  `config:"proxy_url"`
+	ProxyDisable            bool                    `config:"proxy_disable"`
+	TLS                     *tlscommon.Config       `config:"ssl"`
+	TrustStore              TrustStore              `config:"trust_store"`
+	MaxRetries              int                     `config:"max_retries"`
+	MaxConnPerHost          int                     `config:"max_conn_per_host"`
+	BulkFlushInterval       time.Duration           `config:"bulk_flush_interval"`
+	BulkFlushThresholdCount int                     `config:"bulk_flush_threshold_cnt"`
+	BulkFlushThresholdSize  int                     `config:"bulk_flush_threshold_size"`
+	BulkFlushMaxPending     int                     `config:"bulk_flush_max_pending"`
+	BulkMaxDocumentSize     int                     `config:"bulk_max_document_size"`
+	BulkRetryMax            int                     `config:"bulk_retry_max"`
+	BulkRetryBackoff        time.Duration           `config:"bulk_retry_backoff"`
+	BulkRetryMaxBackoff     time.Duration           `config:"bulk_retry_max_backoff"`
+	BulkRetryRate           float64                 `config:"bulk_retry_rate"`
+	BulkFlushTuning         BulkFlushTuning         `config:"bulk_flush_tuning"`
+	Timeout                 time.Duration           `config:"timeout"`
+	Transports              ElasticsearchTransports `config:"transports"`
+
+	// DNSResolveInterval is the interval the hosts are resolved at; the
+	// idle connections are closed when their addresses change. 0 disables.
+	DNSResolveInterval time.Duration `config:"dns_resolve_interval"`
 }
 
 // InitDefaults initializes the defaults for the configuration.
@@ -59,6 +76,14 @@ func (c *Elasticsearch) InitDefaults() {
 	c.BulkFlushThresholdCount = 2048
 	c.BulkFlushThresholdSize = 1024 * 1024
 	c.BulkFlushMaxPending = 8
+	c.BulkMaxDocumentSize = 1024 * 1024 * 100
+	c.BulkRetryMax = 3
+	c.BulkRetryBackoff = 100 * time.Millisecond
+	c.BulkRetryMaxBackoff = 5 * time.Second
+	c.BulkRetryRate = 1000
+	c.DNSResolveInterval = time.Minute
+	c.TrustStore.InitDefaults()
+	c.BulkFlushTuning.InitDefaults()
 }
 
 // Validate ensures that the configuration is valid.
@@ -71,6 +96,29 @@ func (c *Elasticsearch) Validate() error {
 			return err
 		}
 	}
+	if c.BulkRetryMax < 0 {
+		return fmt.Errorf("bulk_retry_max must not be negative")
+	}
+	if c.BulkRetryMax > 0 && (c.BulkRetryBackoff <= 0 || c.BulkRetryMaxBackoff < c.BulkRetryBackoff) {
+		return fmt.Errorf("bulk_retry_backoff must be positive and at most bulk_retry_max_backoff")
+	}
+	if c.BulkRetryRate < 0 {
+		return fmt.Errorf("bulk_retry_rate must not be negative")
+	}
+	if c.DNSResolveInterval < 0 {
+		return fmt.Errorf("dns_resolve_interval must not be negative")
+	}
+	if c.SecondaryServiceToken != "" && c.ServiceToken == "" {
+		return fmt.Errorf("secondary_service_token requires service_token")
+	}
+	if c.ServiceTokenCutover != "" {
+		if c.SecondaryServiceToken == "" {
+			return fmt.Errorf("service_token_cutover requires secondary_service_token")
+		}
+		if _, err := c.CutoverTime(); err != nil {
+			return fmt.Errorf("invalid service_token_cutover: %w", err)
+		}
+	}
 	if c.TLS != nil && c.TLS.IsEnabled() {
 		_, err := tlscommon.LoadTLSConfig(c.TLS)
 		if err != nil {
@@ -80,23 +128,85 @@ func (c *Elasticsearch) Validate() error {
 	return nil
 }
 
+// CutoverTime returns the time of the scheduled cutover to the secondary
+// service token, zero if none is scheduled.
+func (c *Elasticsearch) CutoverTime() (time.Time, error) {
+	if c.ServiceTokenCutover == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, c.ServiceTokenCutover)
+}
+
 // ToESConfig converts the configuration object into the config for the elasticsearch client.
 func (c *Elasticsearch) ToESConfig(longPoll bool) (elasticsearch.Config, error) {
+	httpTransport, err := c.HTTPTransport(longPoll)
+	if err != nil {
+		return elasticsearch.Config{}, err
+	}
+	return c.ToESConfigWithTransport(longPoll, httpTransport)
+}
+
+// ToESConfigWithTransport converts the configuration object into the config
+// for the elasticsearch client sending its requests through the transport.
+func (c *Elasticsearch) ToESConfigWithTransport(longPoll bool, transport http.RoundTripper) (elasticsearch.Config, error) {
 	// build the addresses
+	addrs, err := c.Addresses()
+	if err != nil {
+		return elasticsearch.Config{}, err
+	}
+
+	h := http.Header{}
+	for key, val := range c.Headers {
+		h.Set(key, val)
+	}
+
+	// Set special header "X-elastic-product-origin" for .fleet-* indices based on the latest conversation with ES team
+	// This eliminates the warning while accessing the system index
+	h.Set("X-elastic-product-origin", "fleet")
+
+	return elasticsearch.Config{
+		Addresses:    addrs,
+		Username:     c.Username,
+		Password:     c.Password,
+		ServiceToken: c.ServiceToken,
+		Header:       h,
+		Transport:    transport,
+		MaxRetries:   c.MaxRetries,
+		// no retries for long poll monitoring
+		DisableRetry: longPoll,
+	}, nil
+}
+
+// Addresses returns the URLs of the hosts.
+func (c *Elasticsearch) Addresses() ([]string, error) {
 	addrs := make([]string, len(c.Hosts))
 	for i, host := range c.Hosts {
 		addr, err := makeURL(c.Protocol, c.Path, host, 9200)
 		if err != nil {
-			return elasticsearch.Config{}, err
+			return nil, err
 		}
 		addrs[i] = addr
 	}
+	return addrs, nil
+}
+
+// HTTPTransport builds the transport to Elasticsearch, tuned for the long
+// polls of the index monitors or for the other requests.
+func (c *Elasticsearch) HTTPTransport(longPoll bool) (*http.Transport, error) {
+	tuning := c.Transports.Default
+	if longPoll {
+		tuning = c.Transports.LongPoll
+	}
+	keepAlive := 30 * time.Second
+	if tuning.KeepAlive > 0 {
+		keepAlive = tuning.KeepAlive
+	}
 
 	// build the transport from the config
 	httpTransport := &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   10 * time.Second,
-			KeepAlive: 30 * time.Second,
+			KeepAlive: keepAlive,
 		}).DialContext,
 		TLSHandshakeTimeout:   10 * time.Second,
 		DisableKeepAlives:     false,
@@ -109,50 +219,50 @@ func (c *Elasticsearch) ToESConfig(longPoll bool) (elasticsearch.Config, error)
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
-	disableRetry := false
-
 	if longPoll {
 		httpTransport.IdleConnTimeout = httpTransportLongPollTimeout
 		httpTransport.ResponseHeaderTimeout = httpTransportLongPollTimeout
-
-		// no retries for long poll monitoring
-		disableRetry = true
 	}
+	tuning.Tune(httpTransport)
 
 	if c.TLS != nil && c.TLS.IsEnabled() {
 		tls, err := tlscommon.LoadTLSConfig(c.TLS)
 		if err != nil {
-			return elasticsearch.Config{}, err
+			return nil, err
 		}
 		httpTransport.TLSClientConfig = tls.ToConfig()
 	}
+	if c.TrustStore.IsEnabled() && (c.TLS == nil || c.TLS.VerificationMode != tlscommon.VerifyNone) {
+		store, err := truststore.New(c.TrustStore.CADirectory, c.TrustStore.System, c.TrustStore.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		if httpTransport.TLSClientConfig == nil {
+			httpTransport.TLSClientConfig = &cryptotls.Config{}
+		}
+		tlsCfg := httpTransport.TLSClientConfig
+		verifyHost := c.TLS == nil || c.TLS.VerificationMode != tlscommon.VerifyCertificate
+		var pins []string
+		if c.TLS != nil {
+			pins = c.TLS.CASha256
+		}
+		// The chain is verified against the store and the configured roots,
+		// then against the pins, instead; the callback of beats checks the
+		// pins against the chains of the skipped verification and the chain
+		// against the configured roots only.
+		tlsCfg.VerifyConnection = store.VerifyConnection(tlsCfg.RootCAs, verifyHost, pins)
+		tlsCfg.VerifyPeerCertificate = nil
+		tlsCfg.InsecureSkipVerify = true
+	}
 	if c.ProxyURL != "" && !c.ProxyDisable {
 		proxyUrl, err := common.ParseURL(c.ProxyURL)
 		if err != nil {
-			return elasticsearch.Config{}, err
+			return nil, err
 		}
 		httpTransport.Proxy = http.ProxyURL(proxyUrl)
 	}
 
-	h := http.Header{}
-	for key, val := range c.Headers {
-		h.Set(key, val)
-	}
-
-	// Set special header "X-elastic-product-origin" for .fleet-* indices based on the latest conversation with ES team
-	// This eliminates the warning while accessing the system index
-	h.Set("X-elastic-product-origin", "fleet")
-
-	return elasticsearch.Config{
-		Addresses:    addrs,
-		Username:     c.Username,
-		Password:     c.Password,
-		ServiceToken: c.ServiceToken,
-		Header:       h,
-		Transport:    httpTransport,
-		MaxRetries:   c.MaxRetries,
-		DisableRetry: disableRetry,
-	}, nil
+	return httpTransport, nil
 }
 
 // Output is the output configuration to elasticsearch.
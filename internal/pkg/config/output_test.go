@@ -183,3 +183,25 @@ func TestToESConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPTransportTuning(t *testing.T) {
+	cfg := Elasticsearch{
+		MaxConnPerHost: 128,
+		Timeout:        90 * time.Second,
+		Transports: ElasticsearchTransports{
+			LongPoll: HTTPTransport{MaxConnsPerHost: 4, IdleConnTimeout: time.Minute},
+		},
+	}
+
+	tr, err := cfg.HTTPTransport(false)
+	require.NoError(t, err)
+	assert.Equal(t, 128, tr.MaxConnsPerHost)
+	assert.Equal(t, 60*time.Second, tr.IdleConnTimeout)
+
+	tr, err = cfg.HTTPTransport(true)
+	require.NoError(t, err)
+	assert.Equal(t, 4, tr.MaxConnsPerHost)
+	assert.Equal(t, 32, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+	assert.Equal(t, httpTransportLongPollTimeout, tr.ResponseHeaderTimeout)
+}
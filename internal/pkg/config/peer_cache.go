@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// PeerCache hints the agents at a site-local cache host for the artifact and
+// binary downloads, so the branch offices pull them locally rather than across
+// the WAN. The zone of an agent is the label the geofence network table gives
+// its address; the checkin responses of the agents in one of Zones carry the
+// URL of its cache, signed with Secret for TTL. The cache verifies the
+// signature, over the last element of its URL path and the expiry, as the
+// hmac signer of the artifact redirect does.
+type PeerCache struct {
+	Enabled bool            `config:"enabled"`
+	Secret  string          `config:"secret"`
+	TTL     time.Duration   `config:"ttl"`
+	Zones   []PeerCacheZone `config:"zones"`
+}
+
+// PeerCacheZone is the cache of the agents of a zone.
+type PeerCacheZone struct {
+	Zone string `config:"zone"`
+	URL  string `config:"url"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *PeerCache) InitDefaults() {
+	c.Enabled = false
+	c.TTL = time.Hour
+}
+
+// Validate ensures that the configuration is valid.
+func (c *PeerCache) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Secret == "" {
+		return fmt.Errorf("secret is required")
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+	seen := make(map[string]bool, len(c.Zones))
+	for _, z := range c.Zones {
+		if z.Zone == "" {
+			return fmt.Errorf("zone is required")
+		}
+		if seen[z.Zone] {
+			return fmt.Errorf("zone %q cached twice", z.Zone)
+		}
+		seen[z.Zone] = true
+		u, err := url.Parse(z.URL)
+		if err != nil {
+			return fmt.Errorf("zone %q: invalid url: %w", z.Zone, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("zone %q: url must be http or https", z.Zone)
+		}
+	}
+	return nil
+}
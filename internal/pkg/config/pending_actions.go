@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import "fmt"
+
+// PendingActions bounds the actions delivered to an agent. A checkin returns
+// at most MaxPerCheckin actions and tells the agent when more are pending, to
+// be delivered on its next checkins. Of the actions pending for an agent only
+// the newest MaxQueued are delivered; older ones are skipped, but for the
+// actions controlling the agent itself such as UNENROLL, and reported to it.
+type PendingActions struct {
+	MaxPerCheckin int `config:"max_per_checkin"`
+	MaxQueued     int `config:"max_queued"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *PendingActions) InitDefaults() {
+	c.MaxPerCheckin = 100
+	c.MaxQueued = 1000
+}
+
+// Validate ensures that the configuration is valid.
+func (c *PendingActions) Validate() error {
+	if c.MaxPerCheckin <= 0 {
+		return fmt.Errorf("max_per_checkin must be positive")
+	}
+	if c.MaxQueued < c.MaxPerCheckin {
+		return fmt.Errorf("max_queued must be at least max_per_checkin")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/elastic/go-ucfg"
+)
+
+// Presets tune the limits, cache and timeouts of the fleet-server input for a
+// deployment size. A preset selected with server.limits.preset replaces the
+// defaults of the settings it covers; settings set in the configuration still
+// take precedence, field by field.
+//
+//	small       up to 2,500 agents
+//	medium      up to 10,000 agents
+//	large       up to 25,000 agents
+//	xlarge      up to 50,000 agents
+//	serverless  many instances behind a load balancer; checkin and enroll
+//	            rates are enforced across the cluster
+var presets = map[string]map[string]interface{}{
+	"small": presetInput(presetT{
+		maxConnections: 3000,
+		policyThrottle: "10ms",
+		checkin:        limitT{interval: "5ms", burst: 250, max: 3000},
+		enroll:         limitT{interval: "20ms", burst: 50, max: 25},
+		ack:            limitT{interval: "10ms", burst: 100, max: 50},
+		artifact:       limitT{interval: "10ms", burst: 25, max: 25},
+		numCounters:    100000,
+		maxCost:        20 * 1024 * 1024,
+		longPoll:       "5m",
+	}),
+	"medium": presetInput(presetT{
+		maxConnections: 12000,
+		policyThrottle: "5ms",
+		checkin:        limitT{interval: "1ms", burst: 1000, max: 12000},
+		enroll:         limitT{interval: "10ms", burst: 100, max: 50},
+		ack:            limitT{interval: "5ms", burst: 250, max: 100},
+		artifact:       limitT{interval: "5ms", burst: 50, max: 50},
+		numCounters:    500000,
+		maxCost:        50 * 1024 * 1024,
+		longPoll:       "5m",
+	}),
+	"large": presetInput(presetT{
+		maxConnections: 30000,
+		policyThrottle: "2ms",
+		checkin:        limitT{interval: "500us", burst: 2000, max: 30000},
+		enroll:         limitT{interval: "5ms", burst: 200, max: 100},
+		ack:            limitT{interval: "2ms", burst: 500, max: 200},
+		artifact:       limitT{interval: "2ms", burst: 100, max: 100},
+		numCounters:    1000000,
+		maxCost:        100 * 1024 * 1024,
+		longPoll:       "10m",
+	}),
+	"xlarge": presetInput(presetT{
+		maxConnections: 60000,
+		policyThrottle: "1ms",
+		checkin:        limitT{interval: "250us", burst: 4000, max: 60000},
+		enroll:         limitT{interval: "2ms", burst: 400, max: 200},
+		ack:            limitT{interval: "1ms", burst: 1000, max: 400},
+		artifact:       limitT{interval: "1ms", burst: 200, max: 200},
+		numCounters:    2000000,
+		maxCost:        200 * 1024 * 1024,
+		longPoll:       "10m",
+	}),
+	"serverless": presetInput(presetT{
+		policyThrottle: "5ms",
+		checkin:        limitT{interval: "1ms", burst: 1000, global: true},
+		enroll:         limitT{interval: "10ms", burst: 100, max: 50, global: true},
+		ack:            limitT{interval: "5ms", burst: 250, max: 100},
+		artifact:       limitT{interval: "5ms", burst: 50, max: 50},
+		numCounters:    500000,
+		maxCost:        50 * 1024 * 1024,
+		longPoll:       "5m",
+	}),
+}
+
+type limitT struct {
+	interval string
+	burst    int
+	max      int64
+	global   bool
+}
+
+type presetT struct {
+	maxConnections int
+	policyThrottle string
+	checkin        limitT
+	enroll         limitT
+	ack            limitT
+	artifact       limitT
+	numCounters    int64
+	maxCost        int64
+	longPoll       string
+}
+
+func (l limitT) settings() map[string]interface{} {
+	return map[string]interface{}{
+		"interval": l.interval,
+		"burst":    l.burst,
+		"max":      l.max,
+		"global":   l.global,
+	}
+}
+
+func presetInput(p presetT) map[string]interface{} {
+	return map[string]interface{}{
+		"server": map[string]interface{}{
+			"limits": map[string]interface{}{
+				"max_connections": p.maxConnections,
+				"policy_throttle": p.policyThrottle,
+				"checkin_limit":   p.checkin.settings(),
+				"enroll_limit":    p.enroll.settings(),
+				"ack_limit":       p.ack.settings(),
+				"artifact_limit":  p.artifact.settings(),
+			},
+			"timeouts": map[string]interface{}{
+				"checkin_long_poll": p.longPoll,
+			},
+		},
+		"cache": map[string]interface{}{
+			"num_counters": p.numCounters,
+			"max_cost":     p.maxCost,
+		},
+	}
+}
+
+// Presets returns the names of the limit presets.
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type presetSelector struct {
+	Inputs []struct {
+		Server struct {
+			Limits struct {
+				Preset string `config:"preset"`
+			} `config:"limits"`
+		} `config:"server"`
+	} `config:"inputs"`
+}
+
+// withPreset returns c layered over the preset it selects, or c itself when
+// no preset is selected.
+func withPreset(c *ucfg.Config) (*ucfg.Config, error) {
+	var sel presetSelector
+	if err := c.Unpack(&sel, DefaultOptions...); err != nil {
+		return nil, err
+	}
+	if len(sel.Inputs) == 0 || sel.Inputs[0].Server.Limits.Preset == "" {
+		return c, nil
+	}
+
+	name := sel.Inputs[0].Server.Limits.Preset
+	preset, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown limits preset %q; must be one of %v", name, Presets())
+	}
+
+	layered, err := ucfg.NewFrom(map[string]interface{}{
+		"inputs": []interface{}{preset},
+	}, envMergeOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if err := layered.Merge(c, envMergeOptions...); err != nil {
+		return nil, err
+	}
+	return layered, nil
+}
@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/go-ucfg/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresetOverriddenFieldByField(t *testing.T) {
+	c, err := yaml.NewConfig([]byte(`
+output:
+  elasticsearch:
+    hosts: ["localhost:9200"]
+inputs:
+  - type: fleet-server
+    server:
+      limits:
+        preset: large
+        checkin_limit:
+          burst: 10
+`), DefaultOptions...)
+	require.NoError(t, err)
+
+	cfg, err := FromConfig(c)
+	require.NoError(t, err)
+
+	srv := cfg.Inputs[0].Server
+	assert.Equal(t, "large", srv.Limits.Preset)
+	assert.Equal(t, 30000, srv.Limits.MaxConnections)
+	assert.Equal(t, 10, srv.Limits.CheckinLimit.Burst)
+	assert.Equal(t, 500*time.Microsecond, srv.Limits.CheckinLimit.Interval)
+	assert.Equal(t, int64(100*1024*1024), cfg.Inputs[0].Cache.MaxCost)
+	assert.Equal(t, 10*time.Minute, srv.Timeouts.CheckinLongPoll)
+
+	// Settings the preset does not cover keep their defaults.
+	assert.Equal(t, 8192, srv.Limits.MaxHeaderByteSize)
+}
+
+func TestPresetUnknown(t *testing.T) {
+	c, err := yaml.NewConfig([]byte(`
+inputs:
+  - type: fleet-server
+    server:
+      limits:
+        preset: huge
+`), DefaultOptions...)
+	require.NoError(t, err)
+
+	_, err = FromConfig(c)
+	assert.EqualError(t, err, `unknown limits preset "huge"; must be one of [large medium serverless small xlarge]`)
+}
@@ -0,0 +1,50 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RollingRestart lets the Fleet Servers of a cluster restart in turns once an
+// operator asks for it through the admin API. The servers coordinate through
+// their documents of the .fleet-servers index, checked every CheckInterval: a
+// server takes its turn only while no other is restarting and at least
+// MinServing others keep serving. It then drains, refusing new checkins and
+// enrollments and ending the long polls, for DrainTimeout before it restarts.
+//
+// The servers must have a fleet.agent.id to take part.
+type RollingRestart struct {
+	Enabled       bool          `config:"enabled"`
+	MinServing    int           `config:"min_serving"`
+	DrainTimeout  time.Duration `config:"drain_timeout"`
+	CheckInterval time.Duration `config:"check_interval"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *RollingRestart) InitDefaults() {
+	c.Enabled = false
+	c.MinServing = 1
+	c.DrainTimeout = 30 * time.Second
+	c.CheckInterval = 5 * time.Second
+}
+
+// Validate ensures that the configuration is valid.
+func (c *RollingRestart) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MinServing < 0 {
+		return fmt.Errorf("min_serving must not be negative")
+	}
+	if c.DrainTimeout < 0 {
+		return fmt.Errorf("drain_timeout must not be negative")
+	}
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("check_interval must be positive")
+	}
+	return nil
+}
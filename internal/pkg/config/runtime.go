@@ -4,10 +4,42 @@
 
 package config
 
+import (
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/codec"
+)
+
 type Runtime struct {
 	GCPercent int `config:"gc_percent"`
+
+	// MemoryLimit is the soft memory limit of the Go runtime in bytes, as
+	// GOMEMLIMIT; 0 keeps the limit of the environment. It needs a build
+	// with Go 1.19 or later.
+	MemoryLimit int64 `config:"memory_limit"`
+
+	// MaxThreads is the maximum number of OS threads; 0 keeps the Go default.
+	MaxThreads int `config:"max_threads"`
+
+	// JSONCodec is the JSON implementation of the checkin, enroll and ack
+	// requests; std or jsoniter. The default one is chosen at build time.
+	JSONCodec string `config:"json_codec"`
 }
 
 func (r Runtime) InitDefaults() {
 	r.GCPercent = 0
 }
+
+// Validate ensures the JSON codec exists and the limits are not negative.
+func (r *Runtime) Validate() error {
+	if r.MemoryLimit < 0 {
+		return fmt.Errorf("memory_limit must not be negative")
+	}
+	if r.MaxThreads < 0 {
+		return fmt.Errorf("max_threads must not be negative")
+	}
+	if !codec.Valid(r.JSONCodec) {
+		return fmt.Errorf("invalid json_codec %q; must be %s or %s", r.JSONCodec, codec.Std, codec.Jsoniter)
+	}
+	return nil
+}
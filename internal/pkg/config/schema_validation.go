@@ -0,0 +1,20 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+// SchemaValidation validates the documents of the agents, the action results
+// and the policy leaders against the mappings of this version before writing
+// them, refusing the writes that do not match instead of letting a Fleet
+// Server of another version extend or conflict with the mappings of the
+// indices shared by the fleet. It is disabled by default: a fleet running the
+// versions it was tested with has no use for it.
+type SchemaValidation struct {
+	Enabled bool `config:"enabled"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *SchemaValidation) InitDefaults() {
+	c.Enabled = false
+}
@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Shadow mirrors a sample of the checkin requests to a staging Fleet Server
+// at URL, so a new version can be validated against the traffic of the
+// agents before it is promoted. The requests are mirrored once handled, in
+// the background and without their credentials; the fields of their body
+// holding secrets are redacted and the responses ignored. Headers are added
+// to the mirrored requests, to authenticate them to the staging server for
+// instance. The requests beyond QueueSize waiting to be sent are dropped.
+type Shadow struct {
+	Enabled     bool              `config:"enabled"`
+	URL         string            `config:"url"`
+	SampleRate  float64           `config:"sample_rate"`
+	Timeout     time.Duration     `config:"timeout"`
+	QueueSize   int               `config:"queue_size"`
+	Workers     int               `config:"workers"`
+	MaxBodySize int               `config:"max_body_size"`
+	Headers     map[string]string `config:"headers"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Shadow) InitDefaults() {
+	c.Enabled = false
+	c.SampleRate = 0.01
+	c.Timeout = 5 * time.Second
+	c.QueueSize = 100
+	c.Workers = 2
+	c.MaxBodySize = 1024 * 1024
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Shadow) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must be http or https")
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("sample_rate must be between 0 and 1")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if c.QueueSize <= 0 || c.Workers <= 0 || c.MaxBodySize <= 0 {
+		return fmt.Errorf("queue_size, workers and max_body_size must be positive")
+	}
+	return nil
+}
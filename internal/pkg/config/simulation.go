@@ -0,0 +1,27 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import "fmt"
+
+const kMaxSimulatedPeers = 64
+
+// Simulation is a developer mode where this process also runs Peers logical
+// Fleet Servers, each registering in the servers index with an ID derived
+// from the agent ID and running its own policy coordinators, to exercise the
+// leadership of policies without deploying several servers. With the rolling
+// restarts enabled the peers also take their turns, draining and restarting
+// in place. Not for production.
+type Simulation struct {
+	Peers int `config:"peers"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Simulation) Validate() error {
+	if c.Peers < 0 || c.Peers > kMaxSimulatedPeers {
+		return fmt.Errorf("simulation.peers must be between 0 and %d", kMaxSimulatedPeers)
+	}
+	return nil
+}
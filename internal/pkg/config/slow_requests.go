@@ -0,0 +1,44 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// SlowRequests logs the requests taking longer than Threshold, unless
+// Thresholds sets the threshold of their endpoint, by the snake_case
+// operation id. The time spent waiting in a checkin long poll does not count.
+// Each is logged at warn level with the time spent authenticating, reading
+// from and writing to Elasticsearch, in the long poll, marshaling and writing
+// the response, so the tail latencies are investigated without debug logs.
+type SlowRequests struct {
+	Enabled    bool                     `config:"enabled"`
+	Threshold  time.Duration            `config:"threshold"`
+	Thresholds map[string]time.Duration `config:"thresholds"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *SlowRequests) InitDefaults() {
+	c.Enabled = false
+	c.Threshold = 5 * time.Second
+}
+
+// Validate ensures that the configuration is valid.
+func (c *SlowRequests) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	for endpoint, threshold := range c.Thresholds {
+		if threshold <= 0 {
+			return fmt.Errorf("threshold of %s must be positive", endpoint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPTransport tunes an outbound HTTP transport. Zero values keep the
+// defaults of the purpose of the transport.
+type HTTPTransport struct {
+	MaxConnsPerHost     int           `config:"max_conns_per_host"`
+	MaxIdleConns        int           `config:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `config:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `config:"idle_conn_timeout"`
+	KeepAlive           time.Duration `config:"keep_alive"`
+
+	// DNSRefresh closes the idle connections at this interval so the hosts
+	// are resolved again by the next requests; 0 keeps them.
+	DNSRefresh time.Duration `config:"dns_refresh"`
+}
+
+// Validate ensures the settings are not negative.
+func (c *HTTPTransport) Validate() error {
+	if c.MaxConnsPerHost < 0 || c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("connection limits must not be negative")
+	}
+	if c.IdleConnTimeout < 0 || c.KeepAlive < 0 || c.DNSRefresh < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	return nil
+}
+
+// Tune applies the settings set to the transport.
+func (c *HTTPTransport) Tune(t *http.Transport) {
+	if c.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = c.IdleConnTimeout
+	}
+}
+
+// ElasticsearchTransports tunes the transports to Elasticsearch by purpose:
+// the requests of the server and the long polls of the index monitors.
+type ElasticsearchTransports struct {
+	Default  HTTPTransport `config:"default"`
+	LongPoll HTTPTransport `config:"long_poll"`
+}
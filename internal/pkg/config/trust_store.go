@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// TrustStore adds certificate authorities trusted for the connections to
+// elasticsearch to those of ssl.certificate_authorities. CADirectory holds PEM
+// files, either flat or hashed as by c_rehash, and is reloaded when its files
+// change, checked at most once per ReloadInterval. System trusts the
+// authorities of the operating system; once a trust store is set they are no
+// longer trusted otherwise.
+type TrustStore struct {
+	CADirectory    string        `config:"ca_directory"`
+	System         bool          `config:"system"`
+	ReloadInterval time.Duration `config:"reload_interval"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *TrustStore) InitDefaults() {
+	c.ReloadInterval = time.Minute
+}
+
+// Validate ensures that the configuration is valid.
+func (c *TrustStore) Validate() error {
+	if c.CADirectory != "" {
+		fi, err := os.Stat(c.CADirectory)
+		if err != nil {
+			return fmt.Errorf("invalid ca_directory: %w", err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("ca_directory %s is not a directory", c.CADirectory)
+		}
+	}
+	if c.ReloadInterval <= 0 {
+		return fmt.Errorf("reload_interval must be positive")
+	}
+	return nil
+}
+
+// IsEnabled returns true when certificate authorities are trusted beyond the
+// ssl settings.
+func (c *TrustStore) IsEnabled() bool {
+	return c.CADirectory != "" || c.System
+}
@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	UploadBackendElasticsearch = "elasticsearch"
+	UploadBackendS3            = "s3"
+	UploadBackendAzure         = "azure"
+
+	// UploadMaxChunks is the most chunks an upload is split in, so its chunks
+	// are found with a single search.
+	UploadMaxChunks = 10000
+)
+
+// Upload configures the file uploads of the agents: files of up to
+// MaxFileSize bytes, uploaded in chunks of ChunkSize bytes, stored by the
+// Storage backend.
+type Upload struct {
+	ChunkSize   int64         `config:"chunk_size"`
+	MaxFileSize int64         `config:"max_file_size"`
+	Storage     UploadStorage `config:"storage"`
+}
+
+// UploadStorage stores the bytes of the chunks of the uploads; the upload and
+// chunk documents, their metadata, stay in Elasticsearch. The elasticsearch
+// backend keeps the bytes on the chunk documents, in the .fleet-file-data
+// indices. The s3 backend writes each chunk to an object of the bucket at URL,
+// under Prefix, with requests presigned with the S3 credentials; Google Cloud
+// Storage is written through its S3 compatible XML API, with HMAC keys. The
+// azure backend writes each chunk to a block blob of the container at URL,
+// under Prefix, with the SAS token. The credentials can be secret references
+// of the Elastic Agent policy, resolved by the agent.
+type UploadStorage struct {
+	Backend string             `config:"backend"`
+	URL     string             `config:"url"`
+	Prefix  string             `config:"prefix"`
+	Timeout time.Duration      `config:"timeout"`
+	S3      UploadStorageS3    `config:"s3"`
+	Azure   UploadStorageAzure `config:"azure"`
+}
+
+// UploadStorageS3 are the credentials presigning the requests to the bucket.
+type UploadStorageS3 struct {
+	Region          string `config:"region"`
+	AccessKeyID     string `config:"access_key_id"`
+	SecretAccessKey string `config:"secret_access_key"`
+}
+
+// UploadStorageAzure is the SAS token granting the writes, reads and
+// deletions of the blobs of the container.
+type UploadStorageAzure struct {
+	SASToken string `config:"sas_token"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Upload) InitDefaults() {
+	c.ChunkSize = 4 * 1024 * 1024           // 4MiB
+	c.MaxFileSize = 10 * 1024 * 1024 * 1024 // 10GiB
+	c.Storage.Backend = UploadBackendElasticsearch
+	c.Storage.Timeout = time.Minute
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Upload) Validate() error {
+	if c.ChunkSize <= 0 {
+		return fmt.Errorf("chunk_size must be positive")
+	}
+	if c.MaxFileSize <= 0 {
+		return fmt.Errorf("max_file_size must be positive")
+	}
+	if (c.MaxFileSize+c.ChunkSize-1)/c.ChunkSize > UploadMaxChunks {
+		return fmt.Errorf("max_file_size must be at most %d chunks of chunk_size", UploadMaxChunks)
+	}
+	return c.Storage.validate()
+}
+
+func (c *UploadStorage) validate() error {
+	if c.Timeout <= 0 {
+		return fmt.Errorf("storage.timeout must be positive")
+	}
+	switch c.Backend {
+	case UploadBackendElasticsearch:
+		return nil
+	case UploadBackendS3:
+		if c.S3.Region == "" || c.S3.AccessKeyID == "" || c.S3.SecretAccessKey == "" {
+			return fmt.Errorf("storage.s3.region, storage.s3.access_key_id and storage.s3.secret_access_key must be set with the s3 backend")
+		}
+	case UploadBackendAzure:
+		if c.Azure.SASToken == "" {
+			return fmt.Errorf("storage.azure.sas_token must be set with the azure backend")
+		}
+	default:
+		return fmt.Errorf("storage.backend must be %s, %s or %s", UploadBackendElasticsearch, UploadBackendS3, UploadBackendAzure)
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid storage.url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("storage.url must be http or https")
+	}
+	return nil
+}
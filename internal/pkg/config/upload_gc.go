@@ -0,0 +1,46 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// UploadGC collects the uploads abandoned by their agents: every Interval,
+// up to BatchSize of the uploads with no chunk written for Timeout, or
+// started that long ago without any, have their chunks deleted and are
+// failed, with the reason recorded on the upload.
+type UploadGC struct {
+	Enabled   bool          `config:"enabled"`
+	Interval  time.Duration `config:"interval"`
+	Timeout   time.Duration `config:"timeout"`
+	BatchSize int           `config:"batch_size"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *UploadGC) InitDefaults() {
+	c.Enabled = true
+	c.Interval = 5 * time.Minute
+	c.Timeout = time.Hour
+	c.BatchSize = 100
+}
+
+// Validate ensures that the configuration is valid.
+func (c *UploadGC) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("batch_size must be positive")
+	}
+	return nil
+}
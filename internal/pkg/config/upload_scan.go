@@ -0,0 +1,48 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// UploadScan holds the uploaded files until an external scanner returns its
+// verdict on them. The scanner at URL is sent the file metadata, hash
+// included, of the uploads of the Integrations, all when empty, before the
+// ack attaching them to the action result is accepted. FailOpen accepts the
+// uploads the scanner could not give a verdict on within Timeout.
+type UploadScan struct {
+	Enabled      bool          `config:"enabled"`
+	URL          string        `config:"url"`
+	Timeout      time.Duration `config:"timeout"`
+	FailOpen     bool          `config:"fail_open"`
+	Integrations []string      `config:"integrations"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *UploadScan) InitDefaults() {
+	c.Enabled = false
+	c.Timeout = 30 * time.Second
+}
+
+// Validate ensures that the configuration is valid.
+func (c *UploadScan) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must be http or https")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	UserAgentModeEnforce = "enforce"
+	UserAgentModeWarn    = "warn"
+)
+
+// UserAgent is the policy applied to the versions of the connecting Elastic
+// Agents. By default agents from 7.13 up to the minor of the Fleet Server are
+// accepted; Allow replaces these with its version ranges, an agent being
+// accepted when its version matches any of them. In the warn mode the agents of
+// other versions are logged and counted but still served.
+//
+// Endpoints overrides the policy for the checkin, enroll and reissue endpoints;
+// the settings left empty there are the ones of the policy.
+type UserAgent struct {
+	Mode      string             `config:"mode"`
+	Allow     []string           `config:"allow"`
+	Endpoints UserAgentEndpoints `config:"endpoints"`
+}
+
+// UserAgentEndpoints holds the user agent policy overrides by endpoint.
+type UserAgentEndpoints struct {
+	Checkin UserAgentRule `config:"checkin"`
+	Enroll  UserAgentRule `config:"enroll"`
+	Reissue UserAgentRule `config:"reissue"`
+}
+
+// UserAgentRule overrides the user agent policy for an endpoint.
+type UserAgentRule struct {
+	Mode  string   `config:"mode"`
+	Allow []string `config:"allow"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *UserAgent) InitDefaults() {
+	c.Mode = UserAgentModeEnforce
+}
+
+// Validate ensures that the configuration is valid.
+func (c *UserAgent) Validate() error {
+	if err := validateUserAgentRule(c.Mode, c.Allow, false); err != nil {
+		return err
+	}
+	for name, r := range map[string]UserAgentRule{
+		"checkin": c.Endpoints.Checkin,
+		"enroll":  c.Endpoints.Enroll,
+		"reissue": c.Endpoints.Reissue,
+	} {
+		if err := validateUserAgentRule(r.Mode, r.Allow, true); err != nil {
+			return fmt.Errorf("endpoint %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateUserAgentRule(mode string, allow []string, inherit bool) error {
+	switch mode {
+	case UserAgentModeEnforce, UserAgentModeWarn:
+	case "":
+		if !inherit {
+			return fmt.Errorf("mode is required")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q; must be %s or %s", mode, UserAgentModeEnforce, UserAgentModeWarn)
+	}
+	for _, a := range allow {
+		if _, err := version.NewConstraint(a); err != nil {
+			return fmt.Errorf("invalid allow range %q: %w", a, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Watchdog detects the request handlers still running past the timeout budget
+// of their endpoint, stuck on Elasticsearch or on a channel. The checkins get
+// timeouts.checkin_long_poll, the other endpoints timeouts.write, unless
+// Budgets sets the budget of the endpoint, by the snake_case operation id; the
+// handlers are given Grace more before being reported.
+//
+// Every Interval the stacks of up to MaxStacks newly stuck handlers are logged;
+// with Cancel their request contexts are canceled as well.
+type Watchdog struct {
+	Enabled   bool                     `config:"enabled"`
+	Interval  time.Duration            `config:"interval"`
+	Grace     time.Duration            `config:"grace"`
+	Cancel    bool                     `config:"cancel"`
+	MaxStacks int                      `config:"max_stacks"`
+	Budgets   map[string]time.Duration `config:"budgets"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *Watchdog) InitDefaults() {
+	c.Enabled = false
+	c.Interval = 30 * time.Second
+	c.Grace = time.Minute
+	c.Cancel = false
+	c.MaxStacks = 10
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Watchdog) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.Grace < 0 {
+		return fmt.Errorf("grace must not be negative")
+	}
+	if c.MaxStacks < 0 {
+		return fmt.Errorf("max_stacks must not be negative")
+	}
+	for endpoint, budget := range c.Budgets {
+		if budget <= 0 {
+			return fmt.Errorf("budget of %s must be positive", endpoint)
+		}
+	}
+	return nil
+}
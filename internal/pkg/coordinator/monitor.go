@@ -66,11 +66,24 @@ type monitorT struct {
 	leadersIndex  string
 
 	policies map[string]policyT
+
+	status func() string
+}
+
+// MonitorOpt is an option of the coordinator policy monitor.
+type MonitorOpt func(m *monitorT)
+
+// WithServerStatus records the status returned by fn on the document of this
+// server each time it is written, so its peers can tell its health.
+func WithServerStatus(fn func() string) MonitorOpt {
+	return func(m *monitorT) {
+		m.status = fn
+	}
 }
 
 // NewMonitor creates a new coordinator policy monitor.
-func NewMonitor(fleet config.Fleet, version string, bulker bulk.Bulk, monitor monitor.Monitor, factory Factory) Monitor {
-	return &monitorT{
+func NewMonitor(fleet config.Fleet, version string, bulker bulk.Bulk, monitor monitor.Monitor, factory Factory, opts ...MonitorOpt) Monitor {
+	m := &monitorT{
 		log:               log.With().Str("ctx", "policy leader manager").Logger(),
 		version:           version,
 		fleet:             fleet,
@@ -86,6 +99,10 @@ func NewMonitor(fleet config.Fleet, version string, bulker bulk.Bulk, monitor mo
 		leadersIndex:      dl.FleetPoliciesLeader,
 		policies:          make(map[string]policyT),
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Run runs the monitor.
@@ -145,9 +162,9 @@ func (m *monitorT) handlePolicies(ctx context.Context, hits []es.HitT) error {
 	new := false
 	for _, hit := range hits {
 		var policy model.Policy
-		err := hit.Unmarshal(&policy)
-		if err != nil {
-			return err
+		if err := hit.Unmarshal(&policy); err != nil {
+			dl.DeadLetter(m.bulker, m.policiesIndex, hit, err)
+			continue
 		}
 		if policy.CoordinatorIdx != 0 {
 			// policy revision was inserted by coordinator so this monitor ignores it
@@ -158,7 +175,7 @@ func (m *monitorT) handlePolicies(ctx context.Context, hits []es.HitT) error {
 			// not a new policy
 			if p.cord != nil {
 				// current leader send to its coordinator
-				err = p.cord.Update(ctx, policy)
+				err := p.cord.Update(ctx, policy)
 				if err != nil {
 					return err
 				}
@@ -180,7 +197,11 @@ func (m *monitorT) handlePolicies(ctx context.Context, hits []es.HitT) error {
 // ensureLeadership ensures leadership is held or needs to be taken over.
 func (m *monitorT) ensureLeadership(ctx context.Context) error {
 	m.log.Debug().Msg("ensuring leadership of policies")
-	err := dl.EnsureServer(ctx, m.bulker, m.version, m.agentMetadata, m.hostMetadata, dl.WithIndexName(m.serversIndex))
+	var status string
+	if m.status != nil {
+		status = m.status()
+	}
+	err := dl.EnsureServer(ctx, m.bulker, m.version, status, m.agentMetadata, m.hostMetadata, dl.WithIndexName(m.serversIndex))
 	if err != nil {
 		return err
 	}
@@ -108,6 +108,81 @@ func TestMonitorLeadership(t *testing.T) {
 	ensureLeadershipReleased(bulkCtx, t, bulker, cfg, leadersIndex, policy2Id)
 }
 
+func TestMonitorSimulatedPeers(t *testing.T) {
+	parentCtx := context.Background()
+	bulkCtx, bulkCn := context.WithCancel(parentCtx)
+	defer bulkCn()
+	ctx, cn := context.WithCancel(parentCtx)
+	defer cn()
+
+	bulker := ftesting.SetupBulk(bulkCtx, t, bulk.WithFlushThresholdCount(1))
+	serversIndex := ftesting.SetupIndex(bulkCtx, t, bulker, es.MappingServer)
+	policiesIndex := ftesting.SetupIndex(bulkCtx, t, bulker, es.MappingPolicy)
+	leadersIndex := ftesting.SetupIndex(bulkCtx, t, bulker, es.MappingPolicyLeader)
+	pim, err := monitor.New(policiesIndex, bulker.Client(), bulker.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyId := uuid.Must(uuid.NewV4()).String()
+	_, err = dl.CreatePolicy(ctx, bulker, model.Policy{
+		PolicyId:    policyId,
+		Data:        []byte("{}"),
+		RevisionIdx: 1,
+	}, dl.WithIndexName(policiesIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := makeFleetConfig()
+	peers := NewSimulatedPeers(2, cfg, "1.0.0", bulker, pim, NewCoordinatorZero)
+	cancels := make([]context.CancelFunc, len(peers))
+	var wg sync.WaitGroup
+	wg.Add(1 + len(peers))
+	go func() {
+		defer wg.Done()
+		pim.Run(ctx)
+	}()
+	for i, peer := range peers {
+		m := peer.(*monitorT)
+		m.serversIndex = serversIndex
+		m.leadersIndex = leadersIndex
+		m.policiesIndex = policiesIndex
+		m.checkInterval = 500 * time.Millisecond
+		m.leaderInterval = 2 * time.Second
+
+		peerCtx, peerCn := context.WithCancel(ctx)
+		cancels[i] = peerCn
+		go func(peer Monitor) {
+			defer wg.Done()
+			peer.Run(peerCtx)
+		}(peer)
+	}
+
+	// Both peers register under their own identity; one leads the policy
+	<-time.After(2 * time.Second)
+	for i := range peers {
+		ensureServer(ctx, t, bulker, PeerFleet(cfg, i+1), serversIndex)
+	}
+	leader := policyLeader(ctx, t, bulker, leadersIndex, policyId)
+	var leaderIdx int
+	for i := range peers {
+		if PeerFleet(cfg, i+1).Agent.ID == leader {
+			leaderIdx = i
+		}
+	}
+	ensureLeadership(ctx, t, bulker, PeerFleet(cfg, leaderIdx+1), leadersIndex, policyId)
+
+	// Stopping the leader hands the policy over to the other peer
+	cancels[leaderIdx]()
+	<-time.After(4 * time.Second)
+	other := 1 - leaderIdx
+	ensureLeadership(ctx, t, bulker, PeerFleet(cfg, other+1), leadersIndex, policyId)
+
+	cn()
+	wg.Wait()
+}
+
 func makeFleetConfig() config.Fleet {
 	id := uuid.Must(uuid.NewV4()).String()
 	return config.Fleet{
@@ -137,6 +212,20 @@ func ensureServer(ctx context.Context, t *testing.T, bulker bulk.Bulk, cfg confi
 	}
 }
 
+func policyLeader(ctx context.Context, t *testing.T, bulker bulk.Bulk, index string, policyId string) string {
+	t.Helper()
+	var leader model.PolicyLeader
+	data, err := bulker.Read(ctx, index, policyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(data, &leader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leader.Server.Id
+}
+
 func ensureLeadership(ctx context.Context, t *testing.T, bulker bulk.Bulk, cfg config.Fleet, index string, policyId string) {
 	t.Helper()
 	var leader model.PolicyLeader
@@ -0,0 +1,53 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package coordinator
+
+import (
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/monitor"
+)
+
+// PeerFleet returns the identity of the simulated peer i of the server
+// configured by fleet. Without an agent ID the peer waits for enrollment as
+// the server does.
+func PeerFleet(fleet config.Fleet, i int) config.Fleet {
+	suffix := fmt.Sprintf("-peer-%d", i)
+	if fleet.Agent.ID != "" {
+		fleet.Agent.ID += suffix
+	}
+	if fleet.Host.ID != "" {
+		fleet.Host.ID += suffix
+	}
+	if fleet.Host.Name != "" {
+		fleet.Host.Name += suffix
+	}
+	return fleet
+}
+
+// NewSimulatedPeers creates the coordinator policy monitors of n logical Fleet
+// Servers sharing this process. Each registers in the servers index and
+// competes for the leadership of the policies under its own identity, so the
+// behaviour of a cluster of servers can be exercised by a single binary. Only
+// meant for development and tests; stopping the Run of a peer releases its
+// policies as the shutdown of a server would.
+func NewSimulatedPeers(n int, fleet config.Fleet, version string, bulker bulk.Bulk, monitor monitor.Monitor, factory Factory, opts ...MonitorOpt) []Monitor {
+	peers := make([]Monitor, 0, n)
+	for i := 1; i <= n; i++ {
+		peers = append(peers, NewSimulatedPeer(i, fleet, version, bulker, monitor, factory, opts...))
+	}
+	return peers
+}
+
+// NewSimulatedPeer creates the coordinator policy monitor of the simulated
+// peer i. A monitor runs once; a peer restarting runs a new one.
+func NewSimulatedPeer(i int, fleet config.Fleet, version string, bulker bulk.Bulk, monitor monitor.Monitor, factory Factory, opts ...MonitorOpt) Monitor {
+	pf := PeerFleet(fleet, i)
+	m := NewMonitor(pf, version, bulker, monitor, factory, opts...).(*monitorT)
+	m.log = m.log.With().Str("simulated_peer", pf.Agent.ID).Logger()
+	return m
+}
@@ -0,0 +1,37 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package coordinator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestSimulatedPeers(t *testing.T) {
+	fleet := config.Fleet{
+		Agent: config.Agent{ID: "agent", Version: "8.0.0"},
+		Host:  config.Host{ID: "host", Name: "box"},
+	}
+
+	peers := NewSimulatedPeers(2, fleet, "8.0.0", nil, nil, NewCoordinatorZero)
+	assert.Len(t, peers, 2)
+	for i, peer := range peers {
+		m := peer.(*monitorT)
+		assert.Equal(t, PeerFleet(fleet, i+1), m.fleet)
+		m.calcMetadata()
+		assert.NotEqual(t, fleet.Agent.ID, m.agentMetadata.Id)
+	}
+	assert.Equal(t, "agent-peer-1", peers[0].(*monitorT).fleet.Agent.ID)
+	assert.Equal(t, "box-peer-2", peers[1].(*monitorT).fleet.Host.Name)
+	assert.Equal(t, "8.0.0", peers[1].(*monitorT).fleet.Agent.Version)
+
+	// Peers of a server yet to enroll wait for it too
+	assert.Equal(t, "", PeerFleet(config.Fleet{}, 1).Agent.ID)
+}
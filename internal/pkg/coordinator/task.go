@@ -0,0 +1,160 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+)
+
+// taskLeaderPrefix prefixes the ids of the task leaders in the policy leaders
+// index, so they never match the id of a policy.
+const taskLeaderPrefix = "task:"
+
+// TaskLeader runs a task on a single Fleet Server of the cluster. The
+// leadership of the task is held like the leadership of a policy: the leader
+// renews it every check interval, and another server takes it over once the
+// leader has not renewed it for the leader interval.
+type TaskLeader struct {
+	log      zerolog.Logger
+	bulker   bulk.Bulk
+	id       string
+	serverId string
+	version  string
+
+	checkInterval  time.Duration
+	leaderInterval time.Duration
+	leadersIndex   string
+}
+
+// NewTaskLeader returns the leader of the task name, for the server of the
+// agent serverId.
+func NewTaskLeader(bulker bulk.Bulk, name, serverId, version string) *TaskLeader {
+	return &TaskLeader{
+		log:            log.With().Str("ctx", "task leader").Str("task", name).Logger(),
+		bulker:         bulker,
+		id:             taskLeaderPrefix + name,
+		serverId:       serverId,
+		version:        version,
+		checkInterval:  defaultCheckInterval,
+		leaderInterval: defaultLeaderInterval,
+		leadersIndex:   dl.FleetPoliciesLeader,
+	}
+}
+
+// Run runs task while this server leads it; task is cancelled once the
+// leadership is lost, and run again when it is taken back. Run returns when
+// ctx is done, releasing the leadership.
+func (tl *TaskLeader) Run(ctx context.Context, task func(ctx context.Context) error) error {
+	// Same as the policies, the server of an agent not enrolled yet leads nothing
+	if tl.serverId == "" {
+		tl.log.Warn().Msg("missing config fleet.agent.id; acceptable until Elastic Agent has enrolled")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+	stop := func() {
+		if cancel != nil {
+			cancel()
+			<-done
+			cancel = nil
+		}
+	}
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stop()
+			tl.release()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		// The task returned on its own; run it again while leading
+		if cancel != nil {
+			select {
+			case <-done:
+				cancel()
+				cancel = nil
+			default:
+			}
+		}
+
+		leading, err := tl.ensureLeadership(ctx)
+		if err != nil {
+			tl.log.Warn().Err(err).Msg("failed to take task leadership")
+		}
+		switch {
+		case leading && cancel == nil:
+			taskCtx, taskCancel := context.WithCancel(ctx)
+			cancel, done = taskCancel, make(chan struct{})
+			go func() {
+				defer close(done)
+				if err := task(taskCtx); err != nil && !errors.Is(err, context.Canceled) {
+					tl.log.Error().Err(err).Msg("task failed")
+				}
+			}()
+			tl.log.Info().Msg("leading task")
+		case !leading && cancel != nil:
+			stop()
+			tl.log.Info().Msg("lost task leadership")
+		}
+		t.Reset(tl.checkInterval)
+	}
+}
+
+// ensureLeadership takes or renews the leadership of the task, unless another
+// server holds it.
+func (tl *TaskLeader) ensureLeadership(ctx context.Context) (bool, error) {
+	leaders, err := dl.SearchPolicyLeaders(ctx, tl.bulker, []string{tl.id}, dl.WithIndexName(tl.leadersIndex))
+	if err != nil {
+		return false, err
+	}
+	if leader, ok := leaders[tl.id]; ok && leader.Server != nil && leader.Server.Id != tl.serverId {
+		ts, err := leader.Time()
+		if err != nil {
+			return false, err
+		}
+		if time.Since(ts) <= tl.leaderInterval {
+			return false, nil
+		}
+	}
+
+	err = dl.TakePolicyLeadership(ctx, tl.bulker, tl.id, tl.serverId, tl.version, dl.WithIndexName(tl.leadersIndex))
+	if errors.Is(err, es.ErrElasticVersionConflict) {
+		// Another server took it first
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// release lets another server take the leadership at once.
+func (tl *TaskLeader) release() {
+	// The context of Run is cancelled at this point
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := dl.ReleasePolicyLeadership(ctx, tl.bulker, tl.id, tl.serverId, tl.leaderInterval, dl.WithIndexName(tl.leadersIndex))
+	if err != nil {
+		tl.log.Warn().Err(err).Msg("failed to release task leadership")
+	}
+}
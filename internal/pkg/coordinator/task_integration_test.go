@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build integration
+
+package coordinator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestTaskLeaderSingleRunner(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	bulker := ftesting.SetupBulk(ctx, t, bulk.WithFlushThresholdCount(1))
+	leadersIndex := ftesting.SetupIndex(ctx, t, bulker, es.MappingPolicyLeader)
+
+	var running, started int32
+	task := func(ctx context.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Error("task run by two servers at once")
+		}
+		atomic.AddInt32(&started, 1)
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+		return ctx.Err()
+	}
+
+	runCtx, runCn := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, id := range []string{"server-a", "server-b"} {
+		tl := NewTaskLeader(bulker, "test", id, "1.0.0")
+		tl.leadersIndex = leadersIndex
+		tl.checkInterval = 100 * time.Millisecond
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tl.Run(runCtx, task)
+		}()
+	}
+
+	time.Sleep(time.Second)
+	runCn()
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&started))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+}
@@ -7,11 +7,29 @@ package dl
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
-	"time"
 )
 
+const maxActionResultsFetchSize = 10000
+
+var QueryActionResults = RegisterTemplate("action_results", prepareFindActionResults)
+
+func prepareFindActionResults() (*dsl.Tmpl, error) {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldActionId, tmpl.Bind(FieldActionId), nil)
+	root.Size(maxActionResultsFetchSize)
+	root.Source().Excludes("action_data", "data")
+	return tmpl, tmpl.Resolve(root)
+}
+
 func CreateActionResult(ctx context.Context, bulker bulk.Bulk, acr model.ActionResult) (string, error) {
 	return createActionResult(ctx, bulker, FleetActionsResults, acr)
 }
@@ -27,3 +45,29 @@ func createActionResult(ctx context.Context, bulker bulk.Bulk, index string, acr
 
 	return bulker.Create(ctx, index, acr.Id, body, bulk.WithRefresh())
 }
+
+// FindActionResults returns the results reported by the agents for the action id.
+func FindActionResults(ctx context.Context, bulker bulk.Bulk, actionId string, opts ...Option) ([]model.ActionResult, error) {
+	o := newOption(FleetActionsResults, opts...)
+	res, err := SearchWithOneParam(ctx, bulker, QueryActionResults, o.indexName, FieldActionId, actionId)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	return actionResultsFromHits(res.Hits)
+}
+
+func actionResultsFromHits(hits []es.HitT) ([]model.ActionResult, error) {
+	results := make([]model.ActionResult, 0, len(hits))
+	for _, hit := range hits {
+		var acr model.ActionResult
+		if err := hit.Unmarshal(&acr); err != nil {
+			return nil, err
+		}
+		results = append(results, acr)
+	}
+	return results, nil
+}
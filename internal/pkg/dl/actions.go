@@ -6,7 +6,10 @@ package dl
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
@@ -18,43 +21,66 @@ import (
 const (
 	FieldAgents     = "agents"
 	FieldExpiration = "expiration"
+	FieldType       = "type"
 
-	maxAgentActionsFetchSize = 100
+	// The control actions of an agent are all pending at once at most
+	maxControlActionsFetchSize = 10000
+
+	// Action documents read per page; each may target a thousand agents
+	actionsPageSize = 100
 )
 
 var (
-	QueryAction          = prepareFindAction()
-	QueryAllAgentActions = prepareFindAllAgentsActions()
-	QueryAgentActions    = prepareFindAgentActions()
+	QueryAction          = RegisterTemplate("action", prepareFindAction)
+	QueryAllAgentActions = RegisterTemplate("all_agent_actions", prepareFindAllAgentsActions)
+
+	QueryAgentControlActions = RegisterTemplate("agent_control_actions", prepareAgentControlActions)
 )
 
-func prepareFindAllAgentsActions() *dsl.Tmpl {
+func prepareFindAllAgentsActions() (*dsl.Tmpl, error) {
 	tmpl, root, _ := createBaseActionsQuery()
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
 
-func prepareFindAction() *dsl.Tmpl {
+func prepareFindAction() (*dsl.Tmpl, error) {
 	tmpl := dsl.NewTmpl()
 	root := dsl.NewRoot()
+	root.Param(seqNoPrimaryTerm, true)
 	filter := root.Query().Bool().Filter()
 	filter.Term(FieldActionId, tmpl.Bind(FieldActionId), nil)
 	root.Source().Excludes(FieldAgents)
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
 
-func prepareFindAgentActions() *dsl.Tmpl {
+// PrepareAgentPendingActions returns the query of the newest pending actions
+// of an agent, at most size of them; older actions are left out. The query is
+// registered once per size.
+func PrepareAgentPendingActions(size int) *Template {
+	return RegisterTemplate(fmt.Sprintf("agent_pending_actions_%d", size), func() (*dsl.Tmpl, error) {
+		tmpl, root, filter := createBaseActionsQuery()
+
+		filter.Terms(FieldAgents, tmpl.Bind(FieldAgents), nil)
+
+		root.Size(uint64(size))
+		root.Source().Excludes(FieldAgents)
+		root.Sort().SortOrder(FieldSeqNo, dsl.SortDescend)
+
+		return tmpl, tmpl.Resolve(root)
+	})
+}
+
+// prepareAgentControlActions selects the pending actions of an agent of the
+// control types, oldest first.
+func prepareAgentControlActions() (*dsl.Tmpl, error) {
 	tmpl, root, filter := createBaseActionsQuery()
 
 	filter.Terms(FieldAgents, tmpl.Bind(FieldAgents), nil)
+	filter.Terms(FieldType, tmpl.Bind(FieldType), nil)
 
-	// Select more actions per agent since the agents array is not loaded
-	root.Size(maxAgentActionsFetchSize)
+	root.Size(maxControlActionsFetchSize)
 	root.Source().Excludes(FieldAgents)
 
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
 
 func createBaseActionsQuery() (tmpl *dsl.Tmpl, root, filter *dsl.Node) {
@@ -79,11 +105,52 @@ func FindAction(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option
 	})
 }
 
-func FindActions(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, params map[string]interface{}) ([]model.Action, error) {
+// CreateAction stores a new action so it is dispatched to the agents it targets.
+func CreateAction(ctx context.Context, bulker bulk.Bulk, action model.Action, opts ...Option) (string, error) {
+	o := newOption(FleetActions, opts...)
+	if action.Timestamp == "" {
+		action.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	body, err := json.Marshal(action)
+	if err != nil {
+		return "", err
+	}
+
+	return bulker.Create(ctx, o.indexName, action.Id, body, bulk.WithRefresh())
+}
+
+// FindAgentPendingActions returns the actions found by a query prepared with
+// PrepareAgentPendingActions, oldest first, and the number of actions pending
+// including those left out.
+func FindAgentPendingActions(ctx context.Context, bulker bulk.Bulk, tmpl *Template, params map[string]interface{}) ([]model.Action, uint64, error) {
+	res, err := Search(ctx, bulker, tmpl, FleetActions, params)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			log.Debug().Str("index", FleetActions).Msg(es.ErrIndexNotFound.Error())
+			err = nil
+		}
+		return nil, 0, err
+	}
+
+	actions := actionsFromHits(bulker, FleetActions, res.Hits)
+	for i, j := 0, len(actions)-1; i < j; i, j = i+1, j-1 {
+		actions[i], actions[j] = actions[j], actions[i]
+	}
+	return actions, res.Total.Value, nil
+}
+
+// FindAgentControlActions returns the pending actions of the agent of the
+// types given by FieldType, oldest first; the other parameters are those of
+// FindAgentPendingActions.
+func FindAgentControlActions(ctx context.Context, bulker bulk.Bulk, params map[string]interface{}) ([]model.Action, error) {
+	return findActions(ctx, bulker, QueryAgentControlActions, FleetActions, params)
+}
+
+func FindActions(ctx context.Context, bulker bulk.Bulk, tmpl *Template, params map[string]interface{}) ([]model.Action, error) {
 	return findActions(ctx, bulker, tmpl, FleetActions, params)
 }
 
-func findActions(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index string, params map[string]interface{}) ([]model.Action, error) {
+func findActions(ctx context.Context, bulker bulk.Bulk, tmpl *Template, index string, params map[string]interface{}) ([]model.Action, error) {
 	res, err := Search(ctx, bulker, tmpl, index, params)
 	if err != nil {
 		if errors.Is(err, es.ErrIndexNotFound) {
@@ -93,15 +160,56 @@ func findActions(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index st
 		return nil, err
 	}
 
-	actions := make([]model.Action, 0, len(res.Hits))
+	return actionsFromHits(bulker, index, res.Hits), nil
+}
+
+func actionsFromHits(bulker bulk.Bulk, index string, hits []es.HitT) []model.Action {
+	actions := make([]model.Action, 0, len(hits))
 
-	for _, hit := range res.Hits {
+	for _, hit := range hits {
 		var action model.Action
-		err := hit.Unmarshal(&action)
-		if err != nil {
-			return nil, err
+		if err := hit.Unmarshal(&action); err != nil {
+			DeadLetter(bulker, index, hit, err)
+			continue
 		}
 		actions = append(actions, action)
 	}
-	return actions, err
+	return actions
+}
+
+// FindActionWithResults returns the documents of the action, one per batch of
+// targeted agents, along with the results reported for it. Both are paged
+// through at a point in time, so none is left out however many agents the
+// action targets.
+func FindActionWithResults(ctx context.Context, bulker bulk.Bulk, id string) ([]model.Action, []model.ActionResult, error) {
+	byActionId := func(root *dsl.Node) {
+		root.Query().Bool().Filter().Term(FieldActionId, id, nil)
+	}
+
+	var actions []model.Action
+	err := ForEachPage(ctx, bulker, FleetActions, actionsPageSize, byActionId, func(hits []es.HitT) error {
+		actions = append(actions, actionsFromHits(bulker, FleetActions, hits)...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, es.ErrIndexNotFound) {
+		return nil, nil, err
+	}
+
+	var results []model.ActionResult
+	err = ForEachPage(ctx, bulker, FleetActionsResults, maxActionResultsFetchSize, func(root *dsl.Node) {
+		byActionId(root)
+		root.Source().Excludes("action_data", "data")
+	}, func(hits []es.HitT) error {
+		page, err := actionResultsFromHits(hits)
+		if err != nil {
+			return err
+		}
+		results = append(results, page...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, es.ErrIndexNotFound) {
+		return nil, nil, err
+	}
+
+	return actions, results, nil
 }
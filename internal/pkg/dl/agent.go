@@ -6,34 +6,52 @@ package dl
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 )
 
 const (
-	FieldAccessAPIKeyID = "access_api_key_id"
+	FieldAccessAPIKeyID    = "access_api_key_id"
+	FieldAccessAPIKeyHash  = "access_api_key_hash"
+	FieldLastCheckin       = "last_checkin"
+	FieldLastCheckinStatus = "last_checkin_status"
+	FieldTags              = "tags"
+	FieldAgentVersion      = "agent.version"
 )
 
 var (
-	QueryAgentByAssessAPIKeyID = prepareAgentFindByAccessAPIKeyID()
-	QueryAgentByID             = prepareAgentFindByID()
+	QueryAgentByAssessAPIKeyID = RegisterTemplate("agent_by_access_api_key_id", prepareAgentFindByAccessAPIKeyID)
+	QueryAgentByID             = RegisterTemplate("agent_by_id", prepareAgentFindByID)
+
+	tmplQueryAgentPolicyIds = prepareQueryAgentPolicyIds()
 )
 
-func prepareAgentFindByID() *dsl.Tmpl {
+func prepareQueryAgentPolicyIds() []byte {
+	root := dsl.NewRoot()
+	root.Size(0)
+	root.Query().Bool().Filter().Term(FieldActive, true, nil)
+	root.Aggs().Agg(FieldPolicyId).Terms("field", FieldPolicyId, nil).Size(10000)
+	return root.MustMarshalJSON()
+}
+
+func prepareAgentFindByID() (*dsl.Tmpl, error) {
 	return prepareAgentFindByField(FieldId)
 }
 
-func prepareAgentFindByAccessAPIKeyID() *dsl.Tmpl {
+func prepareAgentFindByAccessAPIKeyID() (*dsl.Tmpl, error) {
 	return prepareAgentFindByField(FieldAccessAPIKeyID)
 }
 
-func prepareAgentFindByField(field string) *dsl.Tmpl {
+func prepareAgentFindByField(field string) (*dsl.Tmpl, error) {
 	return prepareFindByField(field, map[string]interface{}{"version": true})
 }
 
-func FindAgent(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, name string, v interface{}) (agent model.Agent, err error) {
+func FindAgent(ctx context.Context, bulker bulk.Bulk, tmpl *Template, name string, v interface{}) (agent model.Agent, err error) {
 	res, err := SearchWithOneParam(ctx, bulker, tmpl, FleetAgents, name, v)
 	if err != nil {
 		return
@@ -46,3 +64,122 @@ func FindAgent(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, name strin
 	err = res.Hits[0].Unmarshal(&agent)
 	return agent, err
 }
+
+// ReadAgent returns the agent document of the id, reading it in real time
+// rather than searching for it.
+func ReadAgent(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (agent model.Agent, err error) {
+	o := newOption(FleetAgents, opts...)
+	data, err := bulker.Read(ctx, o.indexName, id)
+	if err != nil {
+		if err == es.ErrElasticNotFound {
+			err = ErrNotFound
+		}
+		return
+	}
+
+	if err = json.Unmarshal(data, &agent); err != nil {
+		return
+	}
+	agent.Id = id
+
+	return
+}
+
+// ReadAgentWithMeta reads the agent along with the metadata needed to make a
+// subsequent write conditional with bulk.WithIfSeqNo.
+func ReadAgentWithMeta(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (agent model.Agent, meta bulk.DocMeta, err error) {
+	o := newOption(FleetAgents, opts...)
+	data, meta, err := bulker.ReadWithMeta(ctx, o.indexName, id)
+	if err != nil {
+		if err == es.ErrElasticNotFound {
+			err = ErrNotFound
+		}
+		return
+	}
+
+	if err = json.Unmarshal(data, &agent); err != nil {
+		return
+	}
+	agent.Id = id
+
+	return
+}
+
+// ActiveAgentsFilter selects active agents; its fields are ignored when empty
+// and combined otherwise.
+type ActiveAgentsFilter struct {
+	AgentIds []string
+	PolicyId string
+	Status   string
+	Tags     []string
+
+	// Only the agents not orphaned by the deletion of their policy
+	NotOrphaned bool
+
+	// Last checkin after CheckinAfter and at or before CheckinUntil
+	CheckinAfter time.Time
+	CheckinUntil time.Time
+}
+
+// apply sets the query selecting the agents on the root.
+func (f ActiveAgentsFilter) apply(root *dsl.Node) {
+	b := root.Query().Bool()
+	filter := b.Filter()
+	filter.Term(FieldActive, true, nil)
+	if len(f.AgentIds) > 0 {
+		filter.Terms(FieldId, f.AgentIds, nil)
+	}
+	if f.PolicyId != "" {
+		filter.Term(FieldPolicyId, f.PolicyId, nil)
+	}
+	if f.Status != "" {
+		filter.Term(FieldLastCheckinStatus, f.Status, nil)
+	}
+	for _, tag := range f.Tags {
+		filter.Term(FieldTags, tag, nil)
+	}
+	if !f.CheckinAfter.IsZero() {
+		filter.Range(FieldLastCheckin, dsl.WithRangeGT(f.CheckinAfter.UTC().Format(time.RFC3339Nano)))
+	}
+	if !f.CheckinUntil.IsZero() {
+		filter.Range(FieldLastCheckin, dsl.WithRangeLTE(f.CheckinUntil.UTC().Format(time.RFC3339Nano)))
+	}
+	if f.NotOrphaned {
+		b.MustNot().Exists(FieldOrphanedAt)
+	}
+}
+
+// ForEachActiveAgents pages through the active agents matching the filter at
+// a point in time, calling fn with each page of size; only the source fields
+// given are returned.
+func ForEachActiveAgents(ctx context.Context, bulker bulk.Bulk, f ActiveAgentsFilter, fields []string, size int, fn func(hits []es.HitT) error, opts ...Option) error {
+	o := newOption(FleetAgents, opts...)
+	return ForEachPage(ctx, bulker, o.indexName, size, func(root *dsl.Node) {
+		if len(fields) == 0 {
+			root.Param(FieldSource, false)
+		} else {
+			root.Source().Includes(fields...)
+		}
+		f.apply(root)
+	}, fn)
+}
+
+// QueryAgentPolicyIds returns the ids of the policies the active agents are
+// assigned to, up to 10000 of them.
+func QueryAgentPolicyIds(ctx context.Context, bulker bulk.Bulk, opts ...Option) ([]string, error) {
+	o := newOption(FleetAgents, opts...)
+	res, err := bulker.Search(ctx, []string{o.indexName}, tmplQueryAgentPolicyIds)
+	if err != nil {
+		return nil, err
+	}
+
+	agg, ok := res.Aggregations[FieldPolicyId]
+	if !ok {
+		return nil, ErrMissingAggregations
+	}
+	ids := make([]string, len(agg.Buckets))
+	for i, bucket := range agg.Buckets {
+		ids[i] = bucket.Key
+	}
+	return ids, nil
+}
@@ -0,0 +1,35 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// CreateAgentComponents indexes the components of an agent into the component
+// inventory data stream. The documents are created concurrently so they share
+// a bulk request.
+func CreateAgentComponents(ctx context.Context, bulker bulk.Bulk, comps []model.AgentComponent, opts ...Option) error {
+	o := newOption(FleetAgentComponents, opts...)
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, comp := range comps {
+		body, err := json.Marshal(comp)
+		if err != nil {
+			return err
+		}
+		g.Go(func() error {
+			_, err := bulker.Create(ctx, o.indexName, "", body)
+			return err
+		})
+	}
+	return g.Wait()
+}
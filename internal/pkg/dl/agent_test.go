@@ -0,0 +1,43 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package dl
+
+import (
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveAgentsFilterApply(t *testing.T) {
+	root := dsl.NewRoot()
+	ActiveAgentsFilter{}.apply(root)
+	data, err := root.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"query":{"bool":{"filter":[{"term":{"active":true}}]}}}`, string(data))
+
+	root = dsl.NewRoot()
+	ActiveAgentsFilter{
+		AgentIds:    []string{"a1", "a2"},
+		PolicyId:    "policy-1",
+		Tags:        []string{"linux"},
+		NotOrphaned: true,
+	}.apply(root)
+	data, err = root.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"query":{"bool":{
+		"filter":[
+			{"term":{"active":true}},
+			{"terms":{"_id":["a1","a2"]}},
+			{"term":{"policy_id":"policy-1"}},
+			{"term":{"tags":"linux"}}
+		],
+		"must_not":[{"exists":{"field":"orphaned_at"}}]
+	}}}`, string(data))
+}
@@ -12,22 +12,34 @@ import (
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 )
 
 var (
-	QueryArtifactTmpl = prepareQueryArtifact()
+	QueryArtifactTmpl          = RegisterTemplate("artifact", prepareQueryArtifact)
+	QueryArtifactByEncodedTmpl = RegisterTemplate("artifact_by_encoded", prepareQueryArtifactByEncoded)
 )
 
-func prepareQueryArtifact() *dsl.Tmpl {
+func prepareQueryArtifact() (*dsl.Tmpl, error) {
 	root := dsl.NewRoot()
 	tmpl := dsl.NewTmpl()
 
 	must := root.Query().Bool().Must()
 	must.Term(FieldDecodedSha256, tmpl.Bind(FieldDecodedSha256), nil)
 	must.Term(FieldIdentifier, tmpl.Bind(FieldIdentifier), nil)
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
+}
+
+// prepareQueryArtifactByEncoded selects the artifacts by the sha256 of their
+// encoded payload, whatever their identifier.
+func prepareQueryArtifactByEncoded() (*dsl.Tmpl, error) {
+	root := dsl.NewRoot()
+	tmpl := dsl.NewTmpl()
+
+	root.Size(1)
+	root.Query().Bool().Must().Term(FieldEncodedSha256, tmpl.Bind(FieldEncodedSha256), nil)
+	return tmpl, tmpl.Resolve(root)
 }
 
 func FindArtifact(ctx context.Context, bulker bulk.Bulk, ident, sha2 string) (*model.Artifact, error) {
@@ -49,10 +61,6 @@ func FindArtifact(ctx context.Context, bulker bulk.Bulk, ident, sha2 string) (*m
 		return nil, err
 	}
 
-	if len(res.Hits) == 0 {
-		return nil, ErrNotFound
-	}
-
 	if len(res.Hits) > 1 {
 		log.Warn().
 			Str("ident", ident).
@@ -62,9 +70,27 @@ func FindArtifact(ctx context.Context, bulker bulk.Bulk, ident, sha2 string) (*m
 			Msg("Multiple HITS on artifact query.  Using the first returned.")
 	}
 
+	return firstArtifact(res)
+}
+
+// FindArtifactByEncodedSha256 returns an artifact of the encoded payload; the
+// artifacts sharing a payload are served the same.
+func FindArtifactByEncodedSha256(ctx context.Context, bulker bulk.Bulk, sha2 string) (*model.Artifact, error) {
+	res, err := SearchWithOneParam(ctx, bulker, QueryArtifactByEncodedTmpl, FleetArtifacts, FieldEncodedSha256, sha2)
+	if err != nil {
+		return nil, err
+	}
+	return firstArtifact(res)
+}
+
+func firstArtifact(res *es.HitsT) (*model.Artifact, error) {
+	if len(res.Hits) == 0 {
+		return nil, ErrNotFound
+	}
+
 	// deserialize
 	var artifact model.Artifact
-	if err = json.Unmarshal(res.Hits[0].Source, &artifact); err != nil {
+	if err := json.Unmarshal(res.Hits[0].Source, &artifact); err != nil {
 		return nil, err
 	}
 
@@ -8,16 +8,47 @@ import "github.com/elastic/fleet-server/v7/internal/pkg/sqn"
 
 // Indices names
 const (
+	FleetIndexPrefix = ".fleet-"
+
 	FleetActions           = ".fleet-actions"
 	FleetActionsResults    = ".fleet-actions-results"
 	FleetAgents            = ".fleet-agents"
+	FleetAgentComponents   = ".fleet-agent-components"
 	FleetArtifacts         = ".fleet-artifacts"
+	FleetDeadLetter        = ".fleet-deadletter"
+	FleetDispatchJournal   = ".fleet-dispatch-journal"
 	FleetEnrollmentAPIKeys = ".fleet-enrollment-api-keys"
+	FleetEnrollmentEvents  = ".fleet-enrollment-events"
+	FleetFileData          = ".fleet-file-data"
+	FleetFiles             = ".fleet-files"
+	FleetHealth            = ".fleet-health"
 	FleetPolicies          = ".fleet-policies"
 	FleetPoliciesLeader    = ".fleet-policies-leader"
+	FleetRateLimits        = ".fleet-ratelimits"
 	FleetServers           = ".fleet-servers"
 )
 
+// Indices are the names of the Fleet indices, resolved by the bulker to the
+// index they are stored in.
+var Indices = []string{
+	FleetActions,
+	FleetActionsResults,
+	FleetAgents,
+	FleetAgentComponents,
+	FleetArtifacts,
+	FleetDeadLetter,
+	FleetDispatchJournal,
+	FleetEnrollmentAPIKeys,
+	FleetEnrollmentEvents,
+	FleetFileData,
+	FleetFiles,
+	FleetHealth,
+	FleetPolicies,
+	FleetPoliciesLeader,
+	FleetRateLimits,
+	FleetServers,
+}
+
 // Query fields
 const (
 	FieldSeqNo  = "_seq_no"
@@ -36,14 +67,36 @@ const (
 	FieldDefaultApiKey               = "default_api_key"
 	FieldDefaultApiKeyId             = "default_api_key_id"
 	FieldPolicyOutputPermissionsHash = "policy_output_permissions_hash"
+	FieldPolicyDispatched            = "policy_dispatched"
+	FieldComponents                  = "components"
+	FieldComponentsSummary           = "components_summary"
+	FieldComponentsHash              = "components_hash"
+	FieldNamespaces                  = "namespaces"
+	FieldClockSkew                   = "clock_skew"
 
 	FieldActive           = "active"
 	FieldUpdatedAt        = "updated_at"
 	FieldUnenrolledAt     = "unenrolled_at"
+	FieldUnenrolledReason = "unenrolled_reason"
 	FieldUpgradedAt       = "upgraded_at"
 	FieldUpgradeStartedAt = "upgrade_started_at"
+	FieldOrphanedAt       = "orphaned_at"
+	FieldQuarantinedAt    = "quarantined_at"
+	FieldQuarantineReason = "quarantine_reason"
+
+	FieldStatus    = "status"
+	FieldTimestamp = "@timestamp"
+	FieldRestart   = "restart"
+
+	FieldError = "error"
+
+	// The upload id and position of a chunk, and its bytes, in the file data index
+	FieldChunkUploadId = "bid"
+	FieldChunk         = "chunk"
+	FieldChunkData     = "data"
 
 	FieldDecodedSha256 = "decoded_sha256"
+	FieldEncodedSha256 = "encoded_sha256"
 	FieldIdentifier    = "identifier"
 )
 
@@ -0,0 +1,247 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FieldRetriedAt = "retried_at"
+
+	maxDeadLettersFetchSize = 100
+
+	// kDeadLetterMaxPending is the number of dead letters being stored at
+	// once; the bulker batches them together.
+	kDeadLetterMaxPending   = 256
+	kDeadLetterWriteTimeout = 30 * time.Second
+)
+
+var (
+	ErrDeadLetterRetried = errors.New("dead letter already retried")
+	ErrDeadLetterStale   = errors.New("document changed since it was dead-lettered")
+
+	QueryDeadLetters = RegisterTemplate("dead_letters", prepareFindDeadLetters)
+
+	deadLetterPending = make(chan struct{}, kDeadLetterMaxPending)
+	deadLetterDropped uint64
+)
+
+func prepareFindDeadLetters() (*dsl.Tmpl, error) {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Query().Bool().Filter().Term(FieldStatus, tmpl.Bind(FieldStatus), nil)
+	root.Size(maxDeadLettersFetchSize)
+	root.Sort().SortOrder(FieldTimestamp, dsl.SortDescend)
+	return tmpl, tmpl.Resolve(root)
+}
+
+// DeadLetter queues the store of a document that could not be processed in
+// the dead letter index, so it is kept for inspection instead of being
+// dropped. The original index is taken from the hit when present.
+//
+// The store runs in the background so the monitors reading the document do not
+// wait on the bulker; while too many are pending, the documents beyond
+// kDeadLetterMaxPending are only logged. Failing to store the document is only
+// logged too, the caller is expected to carry on with the next document.
+func DeadLetter(bulker bulk.Bulk, index string, hit es.HitT, cause error, opts ...Option) {
+	if hit.Index != "" {
+		index = hit.Index
+	}
+
+	log.Warn().
+		Err(cause).
+		Str("index", index).
+		Str("id", hit.Id).
+		Int64("seqNo", hit.SeqNo).
+		Msg("Dead letter document")
+
+	select {
+	case deadLetterPending <- struct{}{}:
+	default:
+		dropped := atomic.AddUint64(&deadLetterDropped, 1)
+		log.Error().
+			Str("index", index).
+			Str("id", hit.Id).
+			Int("max_pending", kDeadLetterMaxPending).
+			Uint64("dropped", dropped).
+			Msg("Dead letter writes pending at the limit; dropping the document")
+		return
+	}
+
+	go func() {
+		defer func() { <-deadLetterPending }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), kDeadLetterWriteTimeout)
+		defer cancel()
+
+		if err := writeDeadLetter(ctx, bulker, index, hit, cause, opts...); err != nil {
+			log.Error().
+				Err(err).
+				Str("index", index).
+				Str("id", hit.Id).
+				Msg("Fail to store dead letter document")
+		}
+	}()
+}
+
+func writeDeadLetter(ctx context.Context, bulker bulk.Bulk, index string, hit es.HitT, cause error, opts ...Option) error {
+	o := newOption(FleetDeadLetter, opts...)
+
+	doc := model.DeadLetter{
+		DocId:     hit.Id,
+		Error:     cause.Error(),
+		Index:     index,
+		SeqNo:     hit.SeqNo,
+		Source:    hit.Source,
+		Status:    model.DeadLetterStatusPending,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	body, err := json.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	// Same document at the same sequence number always maps to the same
+	// dead letter, so repeated reads of it do not pile up.
+	_, err = bulker.Index(ctx, o.indexName, deadLetterId(index, hit), body)
+	return err
+}
+
+func deadLetterId(index string, hit es.HitT) string {
+	return fmt.Sprintf("%s:%s:%d", index, hit.Id, hit.SeqNo)
+}
+
+// FindDeadLetters returns the most recent dead letters with the status.
+func FindDeadLetters(ctx context.Context, bulker bulk.Bulk, status string, opts ...Option) ([]model.DeadLetter, error) {
+	o := newOption(FleetDeadLetter, opts...)
+	res, err := SearchWithOneParam(ctx, bulker, QueryDeadLetters, o.indexName, FieldStatus, status)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return []model.DeadLetter{}, nil
+		}
+		return nil, err
+	}
+
+	docs := make([]model.DeadLetter, len(res.Hits))
+	for i, hit := range res.Hits {
+		if err := hit.Unmarshal(&docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// FindDeadLetter returns the dead letter with the id.
+func FindDeadLetter(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (model.DeadLetter, error) {
+	doc, _, err := findDeadLetter(ctx, bulker, id, opts...)
+	return doc, err
+}
+
+func findDeadLetter(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (doc model.DeadLetter, meta bulk.DocMeta, err error) {
+	o := newOption(FleetDeadLetter, opts...)
+	data, meta, err := bulker.ReadWithMeta(ctx, o.indexName, id)
+	if err != nil {
+		if err == es.ErrElasticNotFound {
+			err = ErrNotFound
+		}
+		return
+	}
+
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return
+	}
+	doc.Id = id
+
+	return
+}
+
+// RetryDeadLetter writes the document of the dead letter back to the index it
+// was read from, under its original ID, so the monitors pick it up again.
+//
+// The document is written back only while it is still at the sequence number
+// it was dead-lettered at, conditionally on the sequence number and primary
+// term it is read with, so a newer document is never overwritten; otherwise
+// ErrDeadLetterStale is returned. The dead letter is first marked retried
+// conditionally the same way, so of the concurrent retries of a dead letter
+// only one writes the document back; the others get ErrDeadLetterRetried. The
+// mark is reverted when the write back fails.
+func RetryDeadLetter(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (model.DeadLetter, error) {
+	o := newOption(FleetDeadLetter, opts...)
+
+	doc, meta, err := findDeadLetter(ctx, bulker, id, opts...)
+	if err != nil {
+		return doc, err
+	}
+	if doc.Status == model.DeadLetterStatusRetried {
+		return doc, ErrDeadLetterRetried
+	}
+
+	// The source of the dead letter may lack the fields left out of the
+	// search that read it, so the document is written back as it is stored
+	src, srcMeta, err := bulker.ReadWithMeta(ctx, doc.Index, doc.DocId)
+	if err == es.ErrElasticNotFound {
+		return doc, ErrDeadLetterStale
+	} else if err != nil {
+		return doc, err
+	}
+	if srcMeta.SeqNo != doc.SeqNo {
+		return doc, ErrDeadLetterStale
+	}
+
+	retriedAt := time.Now().UTC().Format(time.RFC3339)
+	err = setDeadLetterStatus(ctx, bulker, o.indexName, id, model.DeadLetterStatusRetried, retriedAt, bulk.WithIfSeqNo(meta))
+	if errors.Is(err, es.ErrElasticVersionConflict) {
+		return doc, ErrDeadLetterRetried
+	} else if err != nil {
+		return doc, err
+	}
+
+	if _, err := bulker.Index(ctx, doc.Index, doc.DocId, src, bulk.WithRefresh(), bulk.WithIfSeqNo(srcMeta)); err != nil {
+		if rerr := setDeadLetterStatus(ctx, bulker, o.indexName, id, model.DeadLetterStatusPending, ""); rerr != nil {
+			log.Error().
+				Err(rerr).
+				Str("id", id).
+				Msg("Fail to revert the status of the dead letter not retried")
+		}
+		if errors.Is(err, es.ErrElasticVersionConflict) {
+			err = ErrDeadLetterStale
+		}
+		return doc, err
+	}
+
+	doc.Status = model.DeadLetterStatusRetried
+	doc.RetriedAt = retriedAt
+	return doc, nil
+}
+
+func setDeadLetterStatus(ctx context.Context, bulker bulk.Bulk, index, id, status, retriedAt string, opts ...bulk.Opt) error {
+	fields := bulk.UpdateFields{
+		FieldStatus:    status,
+		FieldRetriedAt: retriedAt,
+	}
+	if retriedAt == "" {
+		fields[FieldRetriedAt] = nil
+	}
+	body, err := fields.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return bulker.Update(ctx, index, id, body, append(opts, bulk.WithRefresh())...)
+}
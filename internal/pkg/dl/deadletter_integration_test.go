@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build integration
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestDeadLetterRetry(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupIndexWithBulk(ctx, t, es.MappingDeadLetter)
+	srcIndex := ftesting.SetupIndex(ctx, t, bulker, es.MappingAction)
+
+	source := []byte(`{"action_id":"a1","agents":"not-an-array"}`)
+	if _, err := bulker.Create(ctx, srcIndex, "action1", source, bulk.WithRefresh()); err != nil {
+		t.Fatal(err)
+	}
+	_, meta, err := bulker.ReadWithMeta(ctx, srcIndex, "action1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hit := es.HitT{
+		Id:     "action1",
+		SeqNo:  meta.SeqNo,
+		Source: source,
+	}
+	err = writeDeadLetter(ctx, bulker, srcIndex, hit, errors.New("bad agents"), WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := deadLetterId(srcIndex, hit)
+	doc, err := FindDeadLetter(ctx, bulker, id, WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Status != model.DeadLetterStatusPending || doc.Index != srcIndex || doc.DocId != hit.Id {
+		t.Fatalf("unexpected dead letter: %+v", doc)
+	}
+
+	doc, err = RetryDeadLetter(ctx, bulker, id, WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Status != model.DeadLetterStatusRetried {
+		t.Fatalf("expected status %s, got %s", model.DeadLetterStatusRetried, doc.Status)
+	}
+
+	data, err := bulker.Read(ctx, srcIndex, hit.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(hit.Source), string(data)); diff != "" {
+		t.Fatal(diff)
+	}
+
+	_, err = RetryDeadLetter(ctx, bulker, id, WithIndexName(index))
+	if err != ErrDeadLetterRetried {
+		t.Fatalf("expected %v, got %v", ErrDeadLetterRetried, err)
+	}
+
+	// Written back, the document is newer than the dead letter
+	err = bulker.Update(ctx, index, id, []byte(`{"doc":{"status":"PENDING"}}`), bulk.WithRefresh())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RetryDeadLetter(ctx, bulker, id, WithIndexName(index))
+	if err != ErrDeadLetterStale {
+		t.Fatalf("expected %v, got %v", ErrDeadLetterStale, err)
+	}
+}
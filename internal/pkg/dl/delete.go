@@ -0,0 +1,33 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+)
+
+// DeleteDocument deletes the document from the index, refreshing it; a missing
+// document is not an error.
+func DeleteDocument(ctx context.Context, bulker bulk.Bulk, index, id string) error {
+	client := bulker.Client()
+	res, err := client.Delete(es.ResolveIndex(index), id,
+		client.Delete.WithContext(ctx),
+		client.Delete.WithRefresh("true"),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("fail delete %s/%s: %s", index, id, res.String())
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+const (
+	DefaultDispatchEntriesSize = 100
+	MaxDispatchEntriesSize     = 1000
+)
+
+// DispatchEntryFilter selects the dispatch entries of an agent after From and
+// up to To, the most recent first; the bounds are ignored when zero.
+type DispatchEntryFilter struct {
+	AgentId string
+	From    time.Time
+	To      time.Time
+	Size    int
+}
+
+func (f DispatchEntryFilter) query() ([]byte, error) {
+	root := dsl.NewRoot()
+	size := f.Size
+	if size <= 0 {
+		size = DefaultDispatchEntriesSize
+	}
+	if size > MaxDispatchEntriesSize {
+		size = MaxDispatchEntriesSize
+	}
+	root.Size(uint64(size))
+	root.Sort().SortOrder(FieldTimestamp, dsl.SortDescend)
+
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldAgentId, f.AgentId, nil)
+
+	var opts []dsl.RangeOpt
+	if !f.From.IsZero() {
+		opts = append(opts, dsl.WithRangeGT(f.From.UTC().Format(time.RFC3339Nano)))
+	}
+	if !f.To.IsZero() {
+		opts = append(opts, dsl.WithRangeLTE(f.To.UTC().Format(time.RFC3339Nano)))
+	}
+	if len(opts) > 0 {
+		filter.Range(FieldTimestamp, opts...)
+	}
+	return root.MarshalJSON()
+}
+
+// CreateDispatchEntry records the checkin response into the dispatch journal
+// data stream.
+func CreateDispatchEntry(ctx context.Context, bulker bulk.Bulk, entry model.DispatchEntry, opts ...Option) error {
+	o := newOption(FleetDispatchJournal, opts...)
+	body, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Create(ctx, o.indexName, "", body)
+	return err
+}
+
+// FindDispatchEntries returns the most recent dispatch entries matching the
+// filter.
+func FindDispatchEntries(ctx context.Context, bulker bulk.Bulk, f DispatchEntryFilter, opts ...Option) ([]model.DispatchEntry, error) {
+	o := newOption(FleetDispatchJournal, opts...)
+	query, err := f.query()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, []string{o.indexName}, query)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return []model.DispatchEntry{}, nil
+		}
+		return nil, err
+	}
+
+	entries := make([]model.DispatchEntry, len(res.Hits))
+	for i, hit := range res.Hits {
+		if err := hit.Unmarshal(&entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -14,39 +14,38 @@ import (
 )
 
 const (
+	FieldApiKey   = "api_key"
 	FieldApiKeyID = "api_key_id"
 )
 
 var (
-	QueryEnrollmentAPIKeyByID       = prepareFindEnrollmentAPIKeyByID()
-	QueryEnrollmentAPIKeyByPolicyID = prepareFindEnrollmentAPIKeyByPolicyID()
+	QueryEnrollmentAPIKeyByID       = RegisterTemplate("enrollment_api_key_by_id", prepareFindEnrollmentAPIKeyByID)
+	QueryEnrollmentAPIKeyByPolicyID = RegisterTemplate("enrollment_api_key_by_policy_id", prepareFindEnrollmentAPIKeyByPolicyID)
 )
 
-func prepareFindEnrollmentAPIKeyByID() *dsl.Tmpl {
+func prepareFindEnrollmentAPIKeyByID() (*dsl.Tmpl, error) {
 	tmpl := dsl.NewTmpl()
 
 	root := dsl.NewRoot()
 	root.Query().Bool().Filter().Term(FieldApiKeyID, tmpl.Bind(FieldApiKeyID), nil)
 
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
 
-func prepareFindEnrollmentAPIKeyByPolicyID() *dsl.Tmpl {
+func prepareFindEnrollmentAPIKeyByPolicyID() (*dsl.Tmpl, error) {
 	tmpl := dsl.NewTmpl()
 
 	root := dsl.NewRoot()
 	root.Query().Bool().Filter().Term(FieldPolicyId, tmpl.Bind(FieldPolicyId), nil)
 
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
 
-func FindEnrollmentAPIKey(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, field string, id string) (rec model.EnrollmentApiKey, err error) {
+func FindEnrollmentAPIKey(ctx context.Context, bulker bulk.Bulk, tmpl *Template, field string, id string) (rec model.EnrollmentApiKey, err error) {
 	return findEnrollmentAPIKey(ctx, bulker, FleetEnrollmentAPIKeys, tmpl, field, id)
 }
 
-func findEnrollmentAPIKey(ctx context.Context, bulker bulk.Bulk, index string, tmpl *dsl.Tmpl, field string, id string) (rec model.EnrollmentApiKey, err error) {
+func findEnrollmentAPIKey(ctx context.Context, bulker bulk.Bulk, index string, tmpl *Template, field string, id string) (rec model.EnrollmentApiKey, err error) {
 	res, err := SearchWithOneParam(ctx, bulker, tmpl, index, field, id)
 	if err != nil {
 		return
@@ -61,11 +60,11 @@ func findEnrollmentAPIKey(ctx context.Context, bulker bulk.Bulk, index string, t
 	return rec, err
 }
 
-func FindEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, field string, id string) ([]model.EnrollmentApiKey, error) {
+func FindEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, tmpl *Template, field string, id string) ([]model.EnrollmentApiKey, error) {
 	return findEnrollmentAPIKeys(ctx, bulker, FleetEnrollmentAPIKeys, tmpl, field, id)
 }
 
-func findEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, index string, tmpl *dsl.Tmpl, field string, id string) ([]model.EnrollmentApiKey, error) {
+func findEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, index string, tmpl *Template, field string, id string) ([]model.EnrollmentApiKey, error) {
 	res, err := SearchWithOneParam(ctx, bulker, tmpl, index, field, id)
 	if err != nil {
 		return nil, err
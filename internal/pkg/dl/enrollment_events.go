@@ -0,0 +1,108 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+const (
+	FieldAgentId            = "agent_id"
+	FieldEnrollmentApiKeyId = "enrollment_api_key_id"
+	FieldSourceIp           = "source_ip"
+	FieldOutcome            = "outcome"
+
+	DefaultEnrollmentEventsSize = 100
+	MaxEnrollmentEventsSize     = 1000
+)
+
+// EnrollmentEventFilter selects enrollment events; its fields are ignored when
+// empty and combined otherwise.
+type EnrollmentEventFilter struct {
+	AgentId            string
+	EnrollmentApiKeyId string
+	PolicyId           string
+	SourceIp           string
+	Outcome            string
+	Since              time.Time
+	Size               int
+}
+
+func (f EnrollmentEventFilter) query() ([]byte, error) {
+	root := dsl.NewRoot()
+	size := f.Size
+	if size <= 0 {
+		size = DefaultEnrollmentEventsSize
+	}
+	if size > MaxEnrollmentEventsSize {
+		size = MaxEnrollmentEventsSize
+	}
+	root.Size(uint64(size))
+	root.Sort().SortOrder(FieldTimestamp, dsl.SortDescend)
+
+	filter := root.Query().Bool().Filter()
+	terms := []struct{ field, value string }{
+		{FieldAgentId, f.AgentId},
+		{FieldEnrollmentApiKeyId, f.EnrollmentApiKeyId},
+		{FieldPolicyId, f.PolicyId},
+		{FieldSourceIp, f.SourceIp},
+		{FieldOutcome, f.Outcome},
+	}
+	for _, t := range terms {
+		if t.value != "" {
+			filter.Term(t.field, t.value, nil)
+		}
+	}
+	if !f.Since.IsZero() {
+		filter.Range(FieldTimestamp, dsl.WithRangeGT(f.Since.UTC().Format(time.RFC3339Nano)))
+	}
+	return root.MarshalJSON()
+}
+
+// CreateEnrollmentEvent records the enrollment attempt into the enrollment
+// history data stream.
+func CreateEnrollmentEvent(ctx context.Context, bulker bulk.Bulk, ev model.EnrollmentEvent, opts ...Option) error {
+	o := newOption(FleetEnrollmentEvents, opts...)
+	body, err := json.Marshal(&ev)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Create(ctx, o.indexName, "", body)
+	return err
+}
+
+// FindEnrollmentEvents returns the most recent enrollment events matching the
+// filter.
+func FindEnrollmentEvents(ctx context.Context, bulker bulk.Bulk, f EnrollmentEventFilter, opts ...Option) ([]model.EnrollmentEvent, error) {
+	o := newOption(FleetEnrollmentEvents, opts...)
+	query, err := f.query()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, []string{o.indexName}, query)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return []model.EnrollmentEvent{}, nil
+		}
+		return nil, err
+	}
+
+	events := make([]model.EnrollmentEvent, len(res.Hits))
+	for i, hit := range res.Hits {
+		if err := hit.Unmarshal(&events[i]); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
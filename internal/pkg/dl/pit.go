@@ -0,0 +1,196 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	esh "github.com/elastic/fleet-server/v7/internal/pkg/es"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Point in time response
+// {"id":"46ToAwMDaWR..."}
+
+type pitResponse struct {
+	Id    string     `json:"id"`
+	Error esh.ErrorT `json:"error,omitempty"`
+}
+
+// OpenPIT opens a point in time of the index, kept alive for keepAlive.
+func OpenPIT(ctx context.Context, es *elasticsearch.Client, index string, keepAlive string) (string, error) {
+	res, err := es.OpenPointInTime(
+		es.OpenPointInTime.WithContext(ctx),
+		es.OpenPointInTime.WithIndex(esh.ResolveIndex(index)),
+		es.OpenPointInTime.WithKeepAlive(keepAlive),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var pres pitResponse
+	if err := json.NewDecoder(res.Body).Decode(&pres); err != nil {
+		return "", err
+	}
+
+	if err := esh.TranslateError(res.StatusCode, pres.Error); err != nil {
+		return "", err
+	}
+
+	return pres.Id, nil
+}
+
+// ClosePIT closes the point in time; it otherwise expires after its keep alive.
+func ClosePIT(ctx context.Context, es *elasticsearch.Client, id string) error {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.ClosePointInTime(
+		es.ClosePointInTime.WithContext(ctx),
+		es.ClosePointInTime.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		var pres pitResponse
+		if err := json.NewDecoder(res.Body).Decode(&pres); err != nil {
+			return err
+		}
+		return esh.TranslateError(res.StatusCode, pres.Error)
+	}
+	return nil
+}
+
+const (
+	kPITKeepAlive = "1m"
+	fieldShardDoc = "_shard_doc"
+)
+
+// PITIterator pages through the documents of an index matching a query at a
+// point in time, so the documents written meanwhile are neither missed nor
+// repeated. It must be closed.
+type PITIterator struct {
+	es    *elasticsearch.Client
+	pitId string
+	size  int
+	query func(root *dsl.Node)
+	after json.RawMessage
+	done  bool
+}
+
+// NewPITIterator opens a point in time of the index; query sets the query and
+// source filtering of the search on the root it is given.
+func NewPITIterator(ctx context.Context, bulker bulk.Bulk, index string, size int, query func(root *dsl.Node)) (*PITIterator, error) {
+	es := bulker.Client()
+	pitId, err := OpenPIT(ctx, es, index, kPITKeepAlive)
+	if err != nil {
+		return nil, err
+	}
+	return &PITIterator{
+		es:    es,
+		pitId: pitId,
+		size:  size,
+		query: query,
+	}, nil
+}
+
+// Next returns the next page of hits; none once all were returned.
+func (it *PITIterator) Next(ctx context.Context) ([]esh.HitT, error) {
+	if it.done {
+		return nil, nil
+	}
+
+	root := dsl.NewRoot()
+	it.query(root)
+	root.Size(uint64(it.size))
+	root.Sort().SortOrder(fieldShardDoc, dsl.SortAscend)
+	root.Param("pit", map[string]interface{}{
+		"id":         it.pitId,
+		"keep_alive": kPITKeepAlive,
+	})
+	if it.after != nil {
+		root.Param("search_after", it.after)
+	}
+
+	body, err := root.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := it.es.Search(
+		it.es.Search.WithContext(ctx),
+		it.es.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var esres esh.Response
+	if err := json.NewDecoder(res.Body).Decode(&esres); err != nil {
+		return nil, err
+	}
+	if res.IsError() {
+		return nil, esh.TranslateError(res.StatusCode, esres.Error)
+	}
+
+	if esres.PitId != "" {
+		it.pitId = esres.PitId
+	}
+	hits := esres.Hits.Hits
+	if len(hits) < it.size {
+		it.done = true
+	}
+	if len(hits) > 0 {
+		it.after = hits[len(hits)-1].Sort
+	}
+	return hits, nil
+}
+
+// Close closes the point in time.
+func (it *PITIterator) Close(ctx context.Context) error {
+	return ClosePIT(ctx, it.es, it.pitId)
+}
+
+// ForEachPage pages through the documents of the index matching the query at
+// a point in time, calling fn with each page of hits until all were returned
+// or it fails; its error is returned as is.
+func ForEachPage(ctx context.Context, bulker bulk.Bulk, index string, size int, query func(root *dsl.Node), fn func(hits []esh.HitT) error) error {
+	it, err := NewPITIterator(ctx, bulker, index, size, query)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Expires after its keep alive if not closed
+		if err := it.Close(context.Background()); err != nil {
+			log.Debug().Err(err).Str("index", index).Msg("failed closing point in time")
+		}
+	}()
+
+	for {
+		hits, err := it.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if len(hits) == 0 {
+			return nil
+		}
+		if err := fn(hits); err != nil {
+			return err
+		}
+	}
+}
@@ -18,6 +18,8 @@ import (
 var (
 	tmplQueryLatestPolicies = prepareQueryLatestPolicies()
 	ErrMissingAggregations  = errors.New("missing expected aggregation result")
+
+	QueryLatestPolicyInSpaces = prepareQueryLatestPolicyInSpaces()
 )
 
 func prepareQueryLatestPolicies() []byte {
@@ -27,12 +29,23 @@ func prepareQueryLatestPolicies() []byte {
 	policyId.Terms("field", FieldPolicyId, nil).Size(10000)
 	revisionIdx := policyId.Aggs().Agg(FieldRevisionIdx).TopHits()
 	revisionIdx.Size(1)
+	revisionIdx.Param(seqNoPrimaryTerm, true)
 	rSort := revisionIdx.Sort()
 	rSort.SortOrder(FieldRevisionIdx, dsl.SortDescend)
 	rSort.SortOrder(FieldCoordinatorIdx, dsl.SortDescend)
 	return root.MustMarshalJSON()
 }
 
+func prepareQueryLatestPolicyInSpaces() SpaceQuery {
+	return prepareSpaceQuery("latest_policy_in_spaces", func(tmpl *dsl.Tmpl, root, filter *dsl.Node) {
+		root.Size(1)
+		rSort := root.Sort()
+		rSort.SortOrder(FieldRevisionIdx, dsl.SortDescend)
+		rSort.SortOrder(FieldCoordinatorIdx, dsl.SortDescend)
+		filter.Term(FieldPolicyId, tmpl.Bind(FieldPolicyId), nil)
+	})
+}
+
 // QueryLatestPolices gets the latest revision for a policy
 func QueryLatestPolicies(ctx context.Context, bulker bulk.Bulk, opt ...Option) ([]model.Policy, error) {
 	o := newOption(FleetPolicies, opt...)
@@ -48,21 +61,47 @@ func QueryLatestPolicies(ctx context.Context, bulker bulk.Bulk, opt ...Option) (
 	if len(policyId.Buckets) == 0 {
 		return []model.Policy{}, nil
 	}
-	policies := make([]model.Policy, len(policyId.Buckets))
-	for i, bucket := range policyId.Buckets {
+	policies := make([]model.Policy, 0, len(policyId.Buckets))
+	for _, bucket := range policyId.Buckets {
 		revisionIdx, ok := bucket.Aggregations[FieldRevisionIdx]
 		if !ok || len(revisionIdx.Hits) != 1 {
 			return nil, ErrMissingAggregations
 		}
 		hit := revisionIdx.Hits[0]
-		err = hit.Unmarshal(&policies[i])
-		if err != nil {
-			return nil, err
+		var policy model.Policy
+		if err := hit.Unmarshal(&policy); err != nil {
+			DeadLetter(bulker, o.indexName, hit, err)
+			continue
 		}
+		policies = append(policies, policy)
 	}
 	return policies, nil
 }
 
+// FindLatestPolicyInSpaces returns the latest revision of the policy if it
+// belongs to one of the spaces, or ErrNotFound.
+func FindLatestPolicyInSpaces(ctx context.Context, bulker bulk.Bulk, policyId string, spaces []string, opt ...Option) (model.Policy, error) {
+	o := newOption(FleetPolicies, opt...)
+	var policy model.Policy
+
+	query, err := QueryLatestPolicyInSpaces.Render(spaces, map[string]interface{}{
+		FieldPolicyId: policyId,
+	})
+	if err != nil {
+		return policy, err
+	}
+	res, err := bulker.Search(ctx, []string{o.indexName}, query)
+	if err != nil {
+		return policy, err
+	}
+	if len(res.Hits) == 0 {
+		return policy, ErrNotFound
+	}
+
+	err = res.Hits[0].Unmarshal(&policy)
+	return policy, err
+}
+
 // CreatePolicy creates a new policy in the index
 func CreatePolicy(ctx context.Context, bulker bulk.Bulk, policy model.Policy, opt ...Option) (string, error) {
 	o := newOption(FleetPolicies, opt...)
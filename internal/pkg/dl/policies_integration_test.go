@@ -91,3 +91,59 @@ func TestCreatePolicy(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFindLatestPolicyInSpaces(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupIndexWithBulk(ctx, t, es.MappingPolicy)
+
+	unscoped := createRandomPolicy(uuid.Must(uuid.NewV4()).String(), 1)
+	scoped := createRandomPolicy(uuid.Must(uuid.NewV4()).String(), 1)
+	scoped.Namespaces = []string{"team-a"}
+	shared := createRandomPolicy(uuid.Must(uuid.NewV4()).String(), 1)
+	shared.Namespaces = []string{model.AllSpaces}
+	for _, p := range []model.Policy{unscoped, scoped, shared} {
+		if _, err := CreatePolicy(ctx, bulker, p, WithIndexName(index)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newer := createRandomPolicy(scoped.PolicyId, 2)
+	newer.Namespaces = scoped.Namespaces
+	if _, err := CreatePolicy(ctx, bulker, newer, WithIndexName(index)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy model.Policy
+		spaces []string
+		found  bool
+	}{
+		{unscoped, nil, true},
+		{unscoped, []string{model.DefaultSpace}, true},
+		{unscoped, []string{"team-a"}, false},
+		{scoped, nil, false},
+		{scoped, []string{"team-a"}, true},
+		{scoped, []string{model.DefaultSpace, "team-a"}, true},
+		{shared, []string{"team-b"}, true},
+		{shared, nil, true},
+	}
+	for _, tt := range tests {
+		policy, err := FindLatestPolicyInSpaces(ctx, bulker, tt.policy.PolicyId, tt.spaces, WithIndexName(index))
+		if !tt.found {
+			if err != ErrNotFound {
+				t.Errorf("policy %v in spaces %v: got %v, want not found", tt.policy.Namespaces, tt.spaces, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy.PolicyId != tt.policy.PolicyId {
+			t.Errorf("got policy %s, want %s", policy.PolicyId, tt.policy.PolicyId)
+		}
+		if policy.PolicyId == scoped.PolicyId && policy.RevisionIdx != 2 {
+			t.Errorf("got revision %d, want the latest", policy.RevisionIdx)
+		}
+	}
+}
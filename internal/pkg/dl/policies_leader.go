@@ -8,7 +8,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"sync"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
@@ -18,32 +17,18 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var (
-	tmplSearchPolicyLeaders     *dsl.Tmpl
-	initSearchPolicyLeadersOnce sync.Once
-)
+var tmplSearchPolicyLeaders = RegisterTemplate("policy_leaders", prepareSearchPolicyLeaders)
 
 func prepareSearchPolicyLeaders() (*dsl.Tmpl, error) {
 	tmpl := dsl.NewTmpl()
 	root := dsl.NewRoot()
 	root.Query().Terms(FieldId, tmpl.Bind(FieldId), nil)
 
-	err := tmpl.Resolve(root)
-	if err != nil {
-		return nil, err
-	}
-	return tmpl, nil
+	return tmpl, tmpl.Resolve(root)
 }
 
 // SearchPolicyLeaders returns all the leaders for the provided policies
 func SearchPolicyLeaders(ctx context.Context, bulker bulk.Bulk, ids []string, opt ...Option) (leaders map[string]model.PolicyLeader, err error) {
-	initSearchPolicyLeadersOnce.Do(func() {
-		tmplSearchPolicyLeaders, err = prepareSearchPolicyLeaders()
-		if err != nil {
-			return
-		}
-	})
-
 	o := newOption(FleetPoliciesLeader, opt...)
 	data, err := tmplSearchPolicyLeaders.RenderOne(FieldId, ids)
 	if err != nil {
@@ -71,9 +56,13 @@ func SearchPolicyLeaders(ctx context.Context, bulker bulk.Bulk, ids []string, op
 }
 
 // TakePolicyLeadership tries to take leadership of a policy
+//
+// The update is conditional on the leader document not changing since it was
+// read; when another server takes leadership concurrently a version conflict
+// is returned.
 func TakePolicyLeadership(ctx context.Context, bulker bulk.Bulk, policyId, serverId, version string, opt ...Option) error {
 	o := newOption(FleetPoliciesLeader, opt...)
-	data, err := bulker.Read(ctx, o.indexName, policyId, bulk.WithRefresh())
+	data, meta, err := bulker.ReadWithMeta(ctx, o.indexName, policyId, bulk.WithRefresh())
 	if err != nil && err != es.ErrElasticNotFound {
 		return err
 	}
@@ -101,7 +90,7 @@ func TakePolicyLeadership(ctx context.Context, bulker bulk.Bulk, policyId, serve
 		if err != nil {
 			return err
 		}
-		err = bulker.Update(ctx, o.indexName, policyId, data)
+		err = bulker.Update(ctx, o.indexName, policyId, data, bulk.WithIfSeqNo(meta))
 	} else {
 		data, err = json.Marshal(&l)
 		if err != nil {
@@ -118,7 +107,7 @@ func TakePolicyLeadership(ctx context.Context, bulker bulk.Bulk, policyId, serve
 // ReleasePolicyLeadership releases leadership of a policy
 func ReleasePolicyLeadership(ctx context.Context, bulker bulk.Bulk, policyId, serverId string, releaseInterval time.Duration, opt ...Option) error {
 	o := newOption(FleetPoliciesLeader, opt...)
-	data, err := bulker.Read(ctx, o.indexName, policyId, bulk.WithRefresh())
+	data, meta, err := bulker.ReadWithMeta(ctx, o.indexName, policyId, bulk.WithRefresh())
 	if err == es.ErrElasticNotFound {
 		// nothing to do
 		return nil
@@ -145,8 +134,8 @@ func ReleasePolicyLeadership(ctx context.Context, bulker bulk.Bulk, policyId, se
 	if err != nil {
 		return err
 	}
-	err = bulker.Update(ctx, o.indexName, policyId, data)
-	if err == es.ErrElasticVersionConflict {
+	err = bulker.Update(ctx, o.indexName, policyId, data, bulk.WithIfSeqNo(meta))
+	if errors.Is(err, es.ErrElasticVersionConflict) {
 		// another leader took over; nothing to worry about
 		return nil
 	}
@@ -6,7 +6,7 @@ package dl
 
 import "github.com/elastic/fleet-server/v7/internal/pkg/dsl"
 
-func prepareFindByField(field string, params map[string]interface{}) *dsl.Tmpl {
+func prepareFindByField(field string, params map[string]interface{}) (*dsl.Tmpl, error) {
 	tmpl := dsl.NewTmpl()
 	root := dsl.NewRoot()
 
@@ -16,6 +16,5 @@ func prepareFindByField(field string, params map[string]interface{}) *dsl.Tmpl {
 
 	root.Query().Bool().Filter().Term(field, tmpl.Bind(field), nil)
 
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
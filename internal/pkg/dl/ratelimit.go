@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+// The counter of a limit is a single document that is reset when the first
+// Fleet Server moves to the next window; updates for a window that is already
+// over are dropped.
+const scriptRateCount = `
+if (ctx._source.window == params.window) {
+	ctx._source.count += params.delta;
+} else if (ctx._source.window < params.window) {
+	ctx._source.window = params.window;
+	ctx._source.count = params.delta;
+} else {
+	ctx.op = 'noop';
+	return;
+}
+ctx._source['@timestamp'] = params.now;`
+
+// AddRateCount adds delta to the count of the named global limit in window and
+// returns the count of the window across all Fleet Servers. If the counter has
+// already moved to a later window only delta is returned.
+func AddRateCount(ctx context.Context, bulker bulk.Bulk, name string, window, delta int64, opts ...Option) (int64, error) {
+	o := newOption(FleetRateLimits, opts...)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	script := bulk.UpdateScript{
+		Source: scriptRateCount,
+		Params: map[string]interface{}{
+			"window": window,
+			"delta":  delta,
+			"now":    now,
+		},
+		Upsert: model.RateLimit{
+			Name:      name,
+			Window:    window,
+			Count:     delta,
+			Timestamp: now,
+		},
+	}
+	body, err := script.Marshal()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := bulker.Update(ctx, o.indexName, name, body); err != nil {
+		return 0, err
+	}
+
+	data, err := bulker.Read(ctx, o.indexName, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var doc model.RateLimit
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return 0, err
+	}
+	if doc.Window != window {
+		return delta, nil
+	}
+	return doc.Count, nil
+}
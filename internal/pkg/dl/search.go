@@ -8,11 +8,10 @@ import (
 	"context"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
-	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 )
 
-func Search(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index string, params map[string]interface{}) (*es.HitsT, error) {
+func Search(ctx context.Context, bulker bulk.Bulk, tmpl *Template, index string, params map[string]interface{}) (*es.HitsT, error) {
 	query, err := tmpl.Render(params)
 	if err != nil {
 		return nil, err
@@ -26,7 +25,7 @@ func Search(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index string,
 	return &res.HitsT, nil
 }
 
-func SearchWithOneParam(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index string, name string, v interface{}) (*es.HitsT, error) {
+func SearchWithOneParam(ctx context.Context, bulker bulk.Bulk, tmpl *Template, index string, name string, v interface{}) (*es.HitsT, error) {
 	query, err := tmpl.RenderOne(name, v)
 	if err != nil {
 		return nil, err
@@ -16,10 +16,10 @@ const (
 )
 
 var (
-	QuerySeqNoByDocID = prepareFindSeqNoByDocID()
+	QuerySeqNoByDocID = RegisterTemplate("seq_no_by_doc_id", prepareFindSeqNoByDocID)
 )
 
-func prepareFindSeqNoByDocID() *dsl.Tmpl {
+func prepareFindSeqNoByDocID() (*dsl.Tmpl, error) {
 	root := dsl.NewRoot()
 	root.Param(seqNoPrimaryTerm, true)
 	root.Param(FieldSource, []string{FieldSeqNo})
@@ -27,11 +27,10 @@ func prepareFindSeqNoByDocID() *dsl.Tmpl {
 	tmpl := dsl.NewTmpl()
 
 	root.Query().Bool().Filter().Term(FieldId, tmpl.Bind(FieldId), nil)
-	tmpl.MustResolve(root)
-	return tmpl
+	return tmpl, tmpl.Resolve(root)
 }
 
-func FindSeqNoByDocID(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index, docId string) (seqno int64, err error) {
+func FindSeqNoByDocID(ctx context.Context, bulker bulk.Bulk, tmpl *Template, index, docId string) (seqno int64, err error) {
 	seqno = defaultSeqNo
 
 	res, err := SearchWithOneParam(ctx, bulker, tmpl, index, FieldId, docId)
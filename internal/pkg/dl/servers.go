@@ -10,12 +10,14 @@ import (
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 )
 
-// EnsureServer ensures that this server is written in the index.
-func EnsureServer(ctx context.Context, bulker bulk.Bulk, version string, agent model.AgentMetadata, host model.HostMetadata, opts ...Option) error {
+// EnsureServer ensures that this server is written in the index with its
+// current health status.
+func EnsureServer(ctx context.Context, bulker bulk.Bulk, version, status string, agent model.AgentMetadata, host model.HostMetadata, opts ...Option) error {
 	var server model.Server
 	o := newOption(FleetServers, opts...)
 	data, err := bulker.Read(ctx, o.indexName, agent.Id)
@@ -29,6 +31,7 @@ func EnsureServer(ctx context.Context, bulker bulk.Bulk, version string, agent m
 			Id:      agent.Id,
 			Version: version,
 		}
+		server.Status = status
 		server.SetTime(time.Now().UTC())
 		data, err = json.Marshal(&server)
 		if err != nil {
@@ -47,7 +50,10 @@ func EnsureServer(ctx context.Context, bulker bulk.Bulk, version string, agent m
 		Id:      agent.Id,
 		Version: version,
 	}
+	server.Status = status
 	server.SetTime(time.Now().UTC())
+	// Written by the rolling restart only; left as is
+	server.Restart = nil
 	data, err = json.Marshal(&struct {
 		Doc model.Server `json:"doc"`
 	}{server})
@@ -56,3 +62,49 @@ func EnsureServer(ctx context.Context, bulker bulk.Bulk, version string, agent m
 	}
 	return bulker.Update(ctx, o.indexName, agent.Id, data)
 }
+
+// kMaxServers bounds the number of servers returned by QueryServers.
+const kMaxServers = 1000
+
+var tmplQueryServers = prepareQueryServers()
+
+func prepareQueryServers() []byte {
+	root := dsl.NewRoot()
+	root.Size(kMaxServers)
+	root.Sort().SortOrder(FieldTimestamp, dsl.SortDescend)
+	return root.MustMarshalJSON()
+}
+
+// QueryServers returns the servers written in the index, the most recently
+// updated first.
+func QueryServers(ctx context.Context, bulker bulk.Bulk, opts ...Option) ([]model.Server, error) {
+	o := newOption(FleetServers, opts...)
+	res, err := bulker.Search(ctx, []string{o.indexName}, tmplQueryServers)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]model.Server, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		var server model.Server
+		if err := hit.Unmarshal(&server); err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// UpdateServerRestart sets the part of the server in a rolling restart.
+func UpdateServerRestart(ctx context.Context, bulker bulk.Bulk, serverId string, restart model.ServerRestart, opts ...Option) error {
+	o := newOption(FleetServers, opts...)
+	data, err := json.Marshal(map[string]interface{}{
+		"doc": map[string]interface{}{
+			FieldRestart: restart,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return bulker.Update(ctx, o.indexName, serverId, data, bulk.WithRefresh())
+}
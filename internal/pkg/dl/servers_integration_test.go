@@ -35,7 +35,7 @@ func TestEnsureServer(t *testing.T) {
 		Ip:           []string{"::1"},
 		Name:         "testing-host",
 	}
-	err := EnsureServer(ctx, bulker, "1.0.0", agent, host, WithIndexName(index))
+	err := EnsureServer(ctx, bulker, "1.0.0", "HEALTHY", agent, host, WithIndexName(index))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,4 +52,7 @@ func TestEnsureServer(t *testing.T) {
 	if srv.Agent.Id != agentId {
 		t.Fatal("agent.id should match agentId")
 	}
+	if srv.Status != "HEALTHY" {
+		t.Fatal("status should be recorded")
+	}
 }
@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+// SpaceQuery is a query template scoped to Kibana spaces. The documents
+// without namespaces belong to the default space, so the queries including it
+// have a template of their own matching them.
+type SpaceQuery struct {
+	withDefault *Template
+	other       *Template
+}
+
+// prepareSpaceQuery registers the templates of the query under the name;
+// prepare adds the clauses of the query to the root and to the filter of its
+// bool query.
+func prepareSpaceQuery(name string, prepare func(tmpl *dsl.Tmpl, root, filter *dsl.Node)) SpaceQuery {
+	var q SpaceQuery
+
+	q.withDefault = RegisterTemplate(name+"_with_default", func() (*dsl.Tmpl, error) {
+		tmpl := dsl.NewTmpl()
+		root := dsl.NewRoot()
+		filter := root.Query().Bool().Filter()
+		prepare(tmpl, root, filter)
+		should := filter.Bool().Should()
+		should.Terms(FieldNamespaces, tmpl.Bind(FieldNamespaces), nil)
+		should.Bool().MustNot().Exists(FieldNamespaces)
+		return tmpl, tmpl.Resolve(root)
+	})
+
+	q.other = RegisterTemplate(name, func() (*dsl.Tmpl, error) {
+		tmpl := dsl.NewTmpl()
+		root := dsl.NewRoot()
+		filter := root.Query().Bool().Filter()
+		prepare(tmpl, root, filter)
+		filter.Terms(FieldNamespaces, tmpl.Bind(FieldNamespaces), nil)
+		return tmpl, tmpl.Resolve(root)
+	})
+
+	return q
+}
+
+// Render renders the query for the documents of the spaces, and of all
+// spaces.
+func (q SpaceQuery) Render(spaces []string, params map[string]interface{}) ([]byte, error) {
+	spaces = model.Spaces(spaces)
+	tmpl := q.other
+	for _, space := range spaces {
+		if space == model.DefaultSpace {
+			tmpl = q.withDefault
+		}
+	}
+
+	m := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		m[k] = v
+	}
+	m[FieldNamespaces] = append(append([]string{}, spaces...), model.AllSpaces)
+	return tmpl.Render(m)
+}
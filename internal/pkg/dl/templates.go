@@ -0,0 +1,136 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+)
+
+// PrepareFunc builds a query template.
+type PrepareFunc func() (*dsl.Tmpl, error)
+
+// Template is a query template registered by name. It is prepared on its
+// first render, and its renders are counted and timed.
+type Template struct {
+	name    string
+	prepare PrepareFunc
+
+	once sync.Once
+	tmpl *dsl.Tmpl
+	err  error
+
+	renders  uint64 // atomic
+	failures uint64 // atomic
+	nanos    uint64 // atomic; total render time
+}
+
+// TemplateStats are the renders of a template.
+type TemplateStats struct {
+	Renders  uint64
+	Failures uint64
+	Latency  time.Duration // mean render time
+}
+
+type templateRegistry struct {
+	mut       sync.RWMutex
+	templates map[string]*Template
+}
+
+var templates = newTemplateRegistry()
+
+func newTemplateRegistry() *templateRegistry {
+	return &templateRegistry{
+		templates: make(map[string]*Template),
+	}
+}
+
+// RegisterTemplate registers the template of the name. Registering a name
+// again returns the template registered first, so the templates prepared per
+// setting can be registered once per setting.
+func RegisterTemplate(name string, prepare PrepareFunc) *Template {
+	return templates.register(name, prepare)
+}
+
+// TemplatesStats returns the stats of the templates by name.
+func TemplatesStats() map[string]TemplateStats {
+	return templates.stats()
+}
+
+func (r *templateRegistry) register(name string, prepare PrepareFunc) *Template {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if t, ok := r.templates[name]; ok {
+		return t
+	}
+	t := &Template{name: name, prepare: prepare}
+	r.templates[name] = t
+	return t
+}
+
+func (r *templateRegistry) stats() map[string]TemplateStats {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+
+	m := make(map[string]TemplateStats, len(r.templates))
+	for name, t := range r.templates {
+		stats := TemplateStats{
+			Renders:  atomic.LoadUint64(&t.renders),
+			Failures: atomic.LoadUint64(&t.failures),
+		}
+		if stats.Renders > 0 {
+			nanos := atomic.LoadUint64(&t.nanos)
+			stats.Latency = time.Duration(nanos / stats.Renders)
+		}
+		m[name] = stats
+	}
+	return m
+}
+
+// Name returns the name the template is registered with.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Render renders the template.
+func (t *Template) Render(params map[string]interface{}) ([]byte, error) {
+	return t.render(func(tmpl *dsl.Tmpl) ([]byte, error) {
+		return tmpl.Render(params)
+	})
+}
+
+// RenderOne renders the template of a single parameter.
+func (t *Template) RenderOne(name string, v interface{}) ([]byte, error) {
+	return t.render(func(tmpl *dsl.Tmpl) ([]byte, error) {
+		return tmpl.RenderOne(name, v)
+	})
+}
+
+func (t *Template) render(f func(*dsl.Tmpl) ([]byte, error)) ([]byte, error) {
+	t.once.Do(func() {
+		t.tmpl, t.err = t.prepare()
+		if t.err != nil {
+			t.err = fmt.Errorf("prepare template %s: %w", t.name, t.err)
+		}
+	})
+	if t.err != nil {
+		atomic.AddUint64(&t.failures, 1)
+		return nil, t.err
+	}
+
+	start := time.Now()
+	data, err := f(t.tmpl)
+	atomic.AddUint64(&t.nanos, uint64(time.Since(start)))
+	atomic.AddUint64(&t.renders, 1)
+	if err != nil {
+		atomic.AddUint64(&t.failures, 1)
+	}
+	return data, err
+}
@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package dl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateRegistry(t *testing.T) {
+	prepared := 0
+	prepare := func(field string) PrepareFunc {
+		return func() (*dsl.Tmpl, error) {
+			prepared++
+			return prepareFindByField(field, nil)
+		}
+	}
+
+	tmpl := RegisterTemplate("test_by_id", prepare(FieldId))
+	assert.Same(t, tmpl, RegisterTemplate("test_by_id", prepare(FieldAgentId)))
+	assert.Zero(t, prepared, "prepared before its first render")
+
+	data, err := tmpl.RenderOne(FieldId, "a1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"query":{"bool":{"filter":[{"term":{"_id":"a1"}}]}}}`, string(data))
+	_, err = tmpl.Render(map[string]interface{}{FieldId: "a2"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, prepared)
+
+	stats := TemplatesStats()["test_by_id"]
+	assert.Equal(t, uint64(2), stats.Renders)
+	assert.Zero(t, stats.Failures)
+}
+
+func TestTemplatePrepareFails(t *testing.T) {
+	errPrepare := errors.New("bad template")
+	tmpl := RegisterTemplate("test_fails", func() (*dsl.Tmpl, error) {
+		return nil, errPrepare
+	})
+
+	_, err := tmpl.RenderOne(FieldId, "a1")
+	assert.True(t, errors.Is(err, errPrepare))
+	_, err = tmpl.RenderOne(FieldId, "a1")
+	assert.True(t, errors.Is(err, errPrepare))
+
+	stats := TemplatesStats()["test_fails"]
+	assert.Zero(t, stats.Renders)
+	assert.Equal(t, uint64(2), stats.Failures)
+}
@@ -0,0 +1,268 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+// FindUpload returns the upload document for the upload id.
+func FindUpload(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (upload model.Upload, err error) {
+	o := newOption(FleetFiles, opts...)
+	data, err := bulker.Read(ctx, o.indexName, id)
+	if err != nil {
+		if err == es.ErrElasticNotFound {
+			err = ErrNotFound
+		}
+		return
+	}
+
+	if err = json.Unmarshal(data, &upload); err != nil {
+		return
+	}
+	upload.Id = id
+
+	return
+}
+
+// CreateUpload writes the document of the upload started, under its id.
+func CreateUpload(ctx context.Context, bulker bulk.Bulk, upload model.Upload, opts ...Option) error {
+	o := newOption(FleetFiles, opts...)
+	body, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Create(ctx, o.indexName, upload.Id, body, bulk.WithRefresh())
+	return err
+}
+
+// SetUploadUpdatedAt records the time a chunk of the upload was last written.
+func SetUploadUpdatedAt(ctx context.Context, bulker bulk.Bulk, id string, ts time.Time, opts ...Option) error {
+	o := newOption(FleetFiles, opts...)
+	body, err := bulk.UpdateFields{
+		FieldUpdatedAt: ts.UTC().Format(time.RFC3339Nano),
+	}.Marshal()
+	if err != nil {
+		return err
+	}
+	// The chunks of an upload may be written at once
+	return bulker.Update(ctx, o.indexName, id, body, bulk.WithRetryOnConflict(3))
+}
+
+// SetUploadStatus sets the status of the upload.
+func SetUploadStatus(ctx context.Context, bulker bulk.Bulk, id, status string, opts ...Option) error {
+	o := newOption(FleetFiles, opts...)
+	body, err := bulk.UpdateFields{
+		FieldStatus: status,
+	}.Marshal()
+	if err != nil {
+		return err
+	}
+	return bulker.Update(ctx, o.indexName, id, body, bulk.WithRefresh())
+}
+
+// FailUpload sets the status of the upload to failed, for the reason.
+func FailUpload(ctx context.Context, bulker bulk.Bulk, id, reason string, opts ...Option) error {
+	o := newOption(FleetFiles, opts...)
+	body, err := bulk.UpdateFields{
+		FieldStatus: model.UploadStatusFail,
+		FieldError:  reason,
+	}.Marshal()
+	if err != nil {
+		return err
+	}
+	return bulker.Update(ctx, o.indexName, id, body, bulk.WithRefresh())
+}
+
+// FindAbandonedUploads returns up to size of the uploads still uploading
+// whose last chunk was written before, or that were started before when no
+// chunk was.
+func FindAbandonedUploads(ctx context.Context, bulker bulk.Bulk, before time.Time, size int, opts ...Option) ([]model.Upload, error) {
+	o := newOption(FleetFiles, opts...)
+	ts := before.UTC().Format(time.RFC3339Nano)
+
+	root := dsl.NewRoot()
+	root.Size(uint64(size))
+	root.Sort().SortOrder(FieldTimestamp, dsl.SortAscend)
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldStatus, model.UploadStatusUploading, nil)
+	inactive := filter.Bool().Should()
+	inactive.Range(FieldUpdatedAt, dsl.WithRangeLTE(ts))
+	neverWritten := inactive.Bool()
+	neverWritten.MustNot().Exists(FieldUpdatedAt)
+	neverWritten.Filter().Range(FieldTimestamp, dsl.WithRangeLTE(ts))
+	query, err := root.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, []string{o.indexName}, query)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	uploads := make([]model.Upload, len(res.Hits))
+	for i, hit := range res.Hits {
+		if err := hit.Unmarshal(&uploads[i]); err != nil {
+			return nil, err
+		}
+	}
+	return uploads, nil
+}
+
+// FindFailedUploads returns the uploads of the action that failed.
+func FindFailedUploads(ctx context.Context, bulker bulk.Bulk, actionId string, opts ...Option) ([]model.Upload, error) {
+	o := newOption(FleetFiles, opts...)
+
+	root := dsl.NewRoot()
+	root.Size(1000)
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldActionId, actionId, nil)
+	filter.Term(FieldStatus, model.UploadStatusFail, nil)
+	query, err := root.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, []string{o.indexName}, query)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	uploads := make([]model.Upload, len(res.Hits))
+	for i, hit := range res.Hits {
+		if err := hit.Unmarshal(&uploads[i]); err != nil {
+			return nil, err
+		}
+	}
+	return uploads, nil
+}
+
+// DeleteUploadChunks deletes the chunks written for the upload, and returns
+// how many were deleted.
+func DeleteUploadChunks(ctx context.Context, bulker bulk.Bulk, id string, opts ...Option) (int64, error) {
+	o := newOption(FleetFileData, opts...)
+
+	root := dsl.NewRoot()
+	root.Query().Bool().Filter().Term(FieldChunkUploadId, id, nil)
+	body, err := root.MarshalJSON()
+	if err != nil {
+		return 0, err
+	}
+
+	client := bulker.Client()
+	res, err := client.DeleteByQuery(
+		[]string{es.ResolveIndex(o.indexName)},
+		bytes.NewReader(body),
+		client.DeleteByQuery.WithContext(ctx),
+		client.DeleteByQuery.WithConflicts("proceed"),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// No chunk was ever written
+	if res.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if res.IsError() {
+		return 0, fmt.Errorf("fail delete upload chunks: %s", res.String())
+	}
+
+	var resp struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
+
+// UploadChunkId is the id of the document of the chunk of the upload.
+func UploadChunkId(id string, chunk int64) string {
+	return id + "." + strconv.FormatInt(chunk, 10)
+}
+
+// WriteUploadChunk writes the document of the chunk, replacing the chunk
+// written before at its position.
+func WriteUploadChunk(ctx context.Context, bulker bulk.Bulk, chunk model.UploadChunk, opts ...Option) error {
+	o := newOption(FleetFileData, opts...)
+	body, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Index(ctx, o.indexName, UploadChunkId(chunk.Bid, chunk.Chunk), body, bulk.WithRefresh())
+	return err
+}
+
+// ReadUploadChunk returns the document of the chunk of the upload, with its
+// bytes when they are stored on it.
+func ReadUploadChunk(ctx context.Context, bulker bulk.Bulk, id string, chunk int64, opts ...Option) (model.UploadChunk, error) {
+	o := newOption(FleetFileData, opts...)
+	var c model.UploadChunk
+	data, err := bulker.Read(ctx, o.indexName, UploadChunkId(id, chunk))
+	if err != nil {
+		if err == es.ErrElasticNotFound {
+			err = ErrNotFound
+		}
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	c.Id = UploadChunkId(id, chunk)
+	return c, nil
+}
+
+// FindUploadChunks returns up to size of the chunks written for the upload,
+// in their order, without their bytes.
+func FindUploadChunks(ctx context.Context, bulker bulk.Bulk, id string, size int, opts ...Option) ([]model.UploadChunk, error) {
+	o := newOption(FleetFileData, opts...)
+
+	root := dsl.NewRoot()
+	root.Size(uint64(size))
+	root.Sort().SortOrder(FieldChunk, dsl.SortAscend)
+	root.Source().Excludes(FieldChunkData)
+	root.Query().Bool().Filter().Term(FieldChunkUploadId, id, nil)
+	query, err := root.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, []string{o.indexName}, query)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	chunks := make([]model.UploadChunk, len(res.Hits))
+	for i, hit := range res.Hits {
+		if err := hit.Unmarshal(&chunks[i]); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
@@ -22,6 +22,7 @@ const (
 	kKeywordMustNot     = "must_not"
 	kKeywordNULL        = "null"
 	kKeywordQuery       = "query"
+	kKeywordShould      = "should"
 	kKeywordSize        = "size"
 	kKeywordSort        = "sort"
 	kKeywordSource      = "_source"
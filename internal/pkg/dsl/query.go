@@ -9,6 +9,10 @@ func (n *Node) Query() *Node {
 }
 
 func (n *Node) Bool() *Node {
+	// A clause of a list of clauses
+	if n.nodeList != nil {
+		return n.appendOrSetChildNode(kKeywordBool)
+	}
 	return n.findOrCreateChildByName(kKeywordBool)
 }
 
@@ -27,3 +31,11 @@ func (n *Node) MustNot() *Node {
 	}
 	return childNode
 }
+
+func (n *Node) Should() *Node {
+	childNode := n.findOrCreateChildByName(kKeywordShould)
+	if childNode.nodeList == nil {
+		childNode.nodeList = nodeListT{}
+	}
+	return childNode
+}
@@ -7,6 +7,7 @@ package dsl
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -133,3 +134,40 @@ func BenchmarkRender2(b *testing.B) {
 		tmpl.Render(m)
 	}
 }
+
+func TestRenderNestedBool(t *testing.T) {
+	tmpl := NewTmpl()
+	root := NewRoot()
+	filter := root.Query().Bool().Filter()
+	filter.Term("policy_id", tmpl.Bind("policy_id"), nil)
+	should := filter.Bool().Should()
+	should.Terms("namespaces", tmpl.Bind("namespaces"), nil)
+	should.Bool().MustNot().Exists("namespaces")
+	tmpl.MustResolve(root)
+
+	data, err := tmpl.Render(map[string]interface{}{
+		"policy_id":  "p1",
+		"namespaces": []string{"default", "*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"query":{"bool":{"filter":[
+		{"term":{"policy_id":"p1"}},
+		{"bool":{"should":[
+			{"terms":{"namespaces":["default","*"]}},
+			{"bool":{"must_not":[{"exists":{"field":"namespaces"}}]}}
+		]}}
+	]}}}`
+	var got, exp interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &exp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %s", data)
+	}
+}
@@ -8,21 +8,54 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/transport"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/rs/zerolog/log"
 )
 
+// NewClient returns a client to Elasticsearch. The clients of the process
+// share the transport of their purpose, the long polls or the other requests.
 func NewClient(ctx context.Context, cfg *config.Config, longPoll bool) (*elasticsearch.Client, error) {
-	escfg, err := cfg.Output.Elasticsearch.ToESConfig(longPoll)
+	purpose := transport.PurposeElasticsearch
+	if longPoll {
+		purpose = transport.PurposeElasticsearchLongPoll
+	}
+	return newClient(ctx, &cfg.Output.Elasticsearch, purpose, longPoll)
+}
+
+// NewMirrorClient returns a client to the cluster the writes are mirrored to
+// during a migration; it has a transport of its own.
+func NewMirrorClient(ctx context.Context, esCfg *config.Elasticsearch) (*elasticsearch.Client, error) {
+	return newClient(ctx, esCfg, transport.PurposeElasticsearchMirror, false)
+}
+
+func newClient(ctx context.Context, esCfg *config.Elasticsearch, purpose string, longPoll bool) (*elasticsearch.Client, error) {
+	tuning := esCfg.Transports.Default
+	if longPoll {
+		tuning = esCfg.Transports.LongPoll
+	}
+	httpTransport, err := transport.Default.Get(purpose, *esCfg, tuning.DNSRefresh, func() (*http.Transport, error) {
+		return esCfg.HTTPTransport(longPoll)
+	})
 	if err != nil {
 		return nil, err
 	}
-	addr := cfg.Output.Elasticsearch.Hosts
-	user := cfg.Output.Elasticsearch.Username
-	mcph := cfg.Output.Elasticsearch.MaxConnPerHost
+
+	escfg, err := esCfg.ToESConfigWithTransport(longPoll, httpTransport)
+	if err != nil {
+		return nil, err
+	}
+	if tokens := ServiceTokensFor(esCfg); tokens != nil {
+		escfg.ServiceToken = ""
+		escfg.Transport = &tokenTransport{next: escfg.Transport, tokens: tokens}
+	}
+	addr := esCfg.Hosts
+	user := esCfg.Username
+	mcph := esCfg.MaxConnPerHost
 
 	log.Debug().
 		Strs("addr", addr).
@@ -0,0 +1,130 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	dataStreamPriority  = 200
+	dataStreamRollover  = 24 * time.Hour
+	dataStreamMaxSize   = "50gb"
+	dataStreamPolicyTag = "-policy"
+)
+
+// EnsureDataStream installs the index template of the data stream, mapped by
+// mapping, and its ILM policy, deleting the backing indices once they are
+// older than retention; 0 keeps them. The data stream itself is created by Elasticsearch on
+// the first write.
+//
+// Kibana does not install the data streams only Fleet Server writes, so their
+// fields would be mapped dynamically without the template. Both are put on
+// every start; the requests are idempotent.
+func EnsureDataStream(ctx context.Context, esCli *elasticsearch.Client, name, mapping string, retention time.Duration) error {
+	policy := name + dataStreamPolicyTag
+
+	body, err := dataStreamPolicy(retention)
+	if err != nil {
+		return err
+	}
+	res, err := esCli.ILM.PutLifecycle(policy,
+		esCli.ILM.PutLifecycle.WithBody(bytes.NewReader(body)),
+		esCli.ILM.PutLifecycle.WithContext(ctx),
+	)
+	if err := checkAcknowledged(res, err); err != nil {
+		return fmt.Errorf("put ILM policy %s: %w", policy, err)
+	}
+
+	body, err = dataStreamTemplate(name, mapping, policy)
+	if err != nil {
+		return err
+	}
+	res, err = esCli.Indices.PutIndexTemplate(name,
+		bytes.NewReader(body),
+		esCli.Indices.PutIndexTemplate.WithContext(ctx),
+	)
+	if err := checkAcknowledged(res, err); err != nil {
+		return fmt.Errorf("put index template %s: %w", name, err)
+	}
+	return nil
+}
+
+// dataStreamPolicy rolls the backing index over daily, or once it reaches
+// dataStreamMaxSize, and deletes it once older than retention unless 0.
+func dataStreamPolicy(retention time.Duration) ([]byte, error) {
+	rollover := dataStreamRollover
+	if retention > 0 && retention < rollover {
+		rollover = retention
+	}
+	phases := map[string]interface{}{
+		"hot": map[string]interface{}{
+			"actions": map[string]interface{}{
+				"rollover": map[string]interface{}{
+					"max_age":  ilmAge(rollover),
+					"max_size": dataStreamMaxSize,
+				},
+			},
+		},
+	}
+	if retention > 0 {
+		phases["delete"] = map[string]interface{}{
+			"min_age": ilmAge(retention),
+			"actions": map[string]interface{}{
+				"delete": map[string]interface{}{},
+			},
+		}
+	}
+	policy := map[string]interface{}{
+		"policy": map[string]interface{}{
+			"phases": phases,
+		},
+	}
+	return json.Marshal(policy)
+}
+
+func dataStreamTemplate(name, mapping, policy string) ([]byte, error) {
+	template := map[string]interface{}{
+		"index_patterns": []string{name},
+		"data_stream":    map[string]interface{}{"hidden": true},
+		"priority":       dataStreamPriority,
+		"template": map[string]interface{}{
+			"settings": map[string]interface{}{
+				"index.lifecycle.name": policy,
+				"index.hidden":         true,
+			},
+			"mappings": json.RawMessage(mapping),
+		},
+	}
+	return json.Marshal(template)
+}
+
+// ilmAge renders the duration in whole seconds.
+func ilmAge(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
+
+func checkAcknowledged(res *esapi.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var ares AckResponse
+	if err := json.NewDecoder(res.Body).Decode(&ares); err != nil {
+		return err
+	}
+	if !ares.Acknowledged {
+		return TranslateError(res.StatusCode, ares.Error)
+	}
+	return nil
+}
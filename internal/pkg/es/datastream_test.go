@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package es
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStreamPolicy(t *testing.T) {
+	body, err := dataStreamPolicy(14 * 24 * time.Hour)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"policy": {"phases": {
+		"hot": {"actions": {"rollover": {"max_age": "86400s", "max_size": "50gb"}}},
+		"delete": {"min_age": "1209600s", "actions": {"delete": {}}}
+	}}}`, string(body))
+
+	// The backing indices roll over before they are due for deletion
+	body, err = dataStreamPolicy(time.Hour)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"max_age":"3600s"`)
+
+	// Kept forever
+	body, err = dataStreamPolicy(0)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"policy": {"phases": {
+		"hot": {"actions": {"rollover": {"max_age": "86400s", "max_size": "50gb"}}}
+	}}}`, string(body))
+}
+
+func TestDataStreamTemplate(t *testing.T) {
+	body, err := dataStreamTemplate(".fleet-dispatch-journal", MappingDispatchEntry, ".fleet-dispatch-journal-policy")
+	require.NoError(t, err)
+
+	var template struct {
+		IndexPatterns []string `json:"index_patterns"`
+		DataStream    struct {
+			Hidden bool `json:"hidden"`
+		} `json:"data_stream"`
+		Template struct {
+			Settings map[string]interface{} `json:"settings"`
+			Mappings struct {
+				Properties map[string]struct {
+					Type string `json:"type"`
+				} `json:"properties"`
+			} `json:"mappings"`
+		} `json:"template"`
+	}
+	require.NoError(t, json.Unmarshal(body, &template))
+
+	assert.Equal(t, []string{".fleet-dispatch-journal"}, template.IndexPatterns)
+	assert.True(t, template.DataStream.Hidden)
+	assert.Equal(t, ".fleet-dispatch-journal-policy", template.Template.Settings["index.lifecycle.name"])
+	// Searched by term, so not analyzed
+	assert.Equal(t, "keyword", template.Template.Mappings.Properties["agent_id"].Type)
+	assert.Equal(t, "date", template.Template.Mappings.Properties["@timestamp"].Type)
+}
@@ -5,8 +5,12 @@
 package es
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 )
 
 type ErrElastic struct {
@@ -33,13 +37,68 @@ func (e ErrElastic) Error() string {
 	return fmt.Sprintf("elastic fail %d:%s:%s", e.Status, e.Type, e.Reason)
 }
 
+// ErrVersionConflict is returned when a write fails because the document was
+// modified since it was read; errors.Is(err, ErrElasticVersionConflict) holds.
+type ErrVersionConflict struct {
+	Index  string
+	Id     string
+	Reason string
+}
+
+func (e *ErrVersionConflict) Unwrap() error {
+	return ErrElasticVersionConflict
+}
+
+func (e ErrVersionConflict) Error() string {
+	return fmt.Sprintf("%s: %s/%s: %s", ErrElasticVersionConflict, e.Index, e.Id, e.Reason)
+}
+
+// ErrDocumentTooLarge is returned when a document or search response read
+// from Elasticsearch exceeds the configured maximum size. Size is the number of
+// bytes seen before giving up, so it may be less than the full size of the
+// document; errors.Is(err, ErrElasticDocumentTooLarge) holds.
+type ErrDocumentTooLarge struct {
+	Index string
+	Id    string
+	Size  int
+	Limit int
+}
+
+func (e *ErrDocumentTooLarge) Unwrap() error {
+	return ErrElasticDocumentTooLarge
+}
+
+func (e ErrDocumentTooLarge) Error() string {
+	return fmt.Sprintf("%s: %s/%s: %d bytes exceeds limit of %d", ErrElasticDocumentTooLarge, e.Index, e.Id, e.Size, e.Limit)
+}
+
+// ErrMappingViolation is returned when a write is refused before reaching
+// Elasticsearch because the document does not match the mapping of the index;
+// errors.Is(err, ErrElasticMappingViolation) holds.
+type ErrMappingViolation struct {
+	Index  string
+	Id     string
+	Field  string
+	Reason string
+}
+
+func (e *ErrMappingViolation) Unwrap() error {
+	return ErrElasticMappingViolation
+}
+
+func (e ErrMappingViolation) Error() string {
+	return fmt.Sprintf("%s: %s/%s: %s: %s", ErrElasticMappingViolation, e.Index, e.Id, e.Field, e.Reason)
+}
+
 var (
-	ErrElasticVersionConflict = errors.New("elastic version conflict")
-	ErrElasticNotFound        = errors.New("elastic not found")
-	ErrInvalidBody            = errors.New("invalid body")
-	ErrIndexNotFound          = errors.New("index not found")
-	ErrTimeout                = errors.New("timeout")
-	ErrNotFound               = errors.New("not found")
+	ErrElasticVersionConflict  = errors.New("elastic version conflict")
+	ErrElasticNotFound         = errors.New("elastic not found")
+	ErrElasticDocumentTooLarge = errors.New("elastic document too large")
+	ErrElasticMappingViolation = errors.New("elastic mapping violation")
+	ErrInvalidBody             = errors.New("invalid body")
+	ErrIndexNotFound           = errors.New("index not found")
+	ErrTimeout                 = errors.New("timeout")
+	ErrNotFound                = errors.New("not found")
 )
 
 func TranslateError(status int, e ErrorT) error {
@@ -50,7 +109,7 @@ func TranslateError(status int, e ErrorT) error {
 	var err error
 	switch e.Type {
 	case "version_conflict_engine_exception":
-		err = ErrElasticVersionConflict
+		err = &ErrVersionConflict{Reason: e.Reason}
 	default:
 		err = &ErrElastic{
 			Status: status,
@@ -68,3 +127,26 @@ func TranslateError(status int, e ErrorT) error {
 
 	return err
 }
+
+// IsUnavailable returns true if err is Elasticsearch being unreachable or
+// unable to serve the request, as opposed to the request being rejected.
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var esErr *ErrElastic
+	if errors.As(err, &esErr) {
+		return esErr.Status >= http.StatusInternalServerError
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package es
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// IndexResolver maps the names of the Fleet indices to the index, or alias,
+// they are stored in. The names it does not know, such as the indices
+// generated by the tests, are used as they are.
+type IndexResolver struct {
+	indices map[string]string
+}
+
+var indexResolver atomic.Value // *IndexResolver
+
+// NewIndexResolver returns the resolver of the names, adding the suffix to
+// them; an override stores the index of its name in the index it maps to,
+// without the suffix.
+func NewIndexResolver(names []string, suffix string, overrides map[string]string) (*IndexResolver, error) {
+	r := &IndexResolver{indices: make(map[string]string, len(names))}
+	for _, name := range names {
+		r.indices[name] = name + suffix
+	}
+	for name, index := range overrides {
+		if _, ok := r.indices[name]; !ok {
+			return nil, fmt.Errorf("cannot override unknown index %s", name)
+		}
+		r.indices[name] = index
+	}
+	return r, nil
+}
+
+// Resolve returns the index the named index is stored in.
+func (r *IndexResolver) Resolve(name string) string {
+	if r == nil {
+		return name
+	}
+	if index, ok := r.indices[name]; ok {
+		return index
+	}
+	return name
+}
+
+// SetIndexResolver sets the resolver of the index names used by the bulker
+// and the data layer; it is set once, before any index is accessed.
+func SetIndexResolver(r *IndexResolver) {
+	indexResolver.Store(r)
+}
+
+// ResolveIndex returns the index the named index is stored in.
+func ResolveIndex(name string) string {
+	r, _ := indexResolver.Load().(*IndexResolver)
+	return r.Resolve(name)
+}
+
+// ResolveIndices returns the indices the named indices are stored in.
+func ResolveIndices(names []string) []string {
+	r, _ := indexResolver.Load().(*IndexResolver)
+	if r == nil {
+		return names
+	}
+	indices := make([]string, len(names))
+	for i, name := range names {
+		indices[i] = r.Resolve(name)
+	}
+	return indices
+}
@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package es
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexResolver(t *testing.T) {
+	names := []string{".fleet-agents", ".fleet-policies"}
+
+	r, err := NewIndexResolver(names, "-tenant1", map[string]string{".fleet-agents": ".fleet-agents-blue"})
+	require.NoError(t, err)
+	assert.Equal(t, ".fleet-agents-blue", r.Resolve(".fleet-agents"))
+	assert.Equal(t, ".fleet-policies-tenant1", r.Resolve(".fleet-policies"))
+	assert.Equal(t, ".fleet-policies-tenant1", r.Resolve(r.Resolve(".fleet-policies")), "resolved twice")
+	assert.Equal(t, ".fleet-agents-abc123", r.Resolve(".fleet-agents-abc123"), "unknown name")
+
+	_, err = NewIndexResolver(names, "", map[string]string{".fleet-unknown": ".fleet-other"})
+	assert.Error(t, err)
+
+	assert.Equal(t, ".fleet-policies", ResolveIndex(".fleet-policies"))
+	SetIndexResolver(r)
+	defer SetIndexResolver(nil)
+	assert.Equal(t, ".fleet-policies-tenant1", ResolveIndex(".fleet-policies"))
+	assert.Equal(t, []string{".fleet-agents-blue", ".fleet-policies-tenant1"}, ResolveIndices(names))
+}
@@ -27,6 +27,13 @@ const (
 		"input_type": {
 			"type": "keyword"
 		},
+		"priority": {
+			"type": "integer"
+		},
+		"signed": {
+			"enabled" : false,
+			"type": "object"
+		},
 		"@timestamp": {
 			"type": "date"
 		},
@@ -69,11 +76,30 @@ const (
 		"error": {
 			"type": "keyword"
 		},
+		"file": {
+			"properties": {
+				"mime_type": {
+					"type": "keyword"
+				},
+				"name": {
+					"type": "keyword"
+				},
+				"sha256": {
+					"type": "keyword"
+				},
+				"size": {
+					"type": "integer"
+				}				
+			}
+		},
 		"started_at": {
 			"type": "date"
 		},
 		"@timestamp": {
 			"type": "date"
+		},
+		"upload_id": {
+			"type": "keyword"
 		}		
 	}
 }`
@@ -81,6 +107,9 @@ const (
 	// Agent An Elastic Agent that has enrolled into Fleet
 	MappingAgent = `{
 	"properties": {
+		"access_api_key_hash": {
+			"type": "keyword"
+		},
 		"access_api_key_id": {
 			"type": "keyword"
 		},
@@ -100,6 +129,32 @@ const (
 				}				
 			}
 		},
+		"clock_skew": {
+			"type": "integer"
+		},
+		"components": {
+			"enabled" : false,
+			"type": "object"
+		},
+		"components_hash": {
+			"type": "keyword"
+		},
+		"components_summary": {
+			"properties": {
+				"total": {
+					"type": "integer"
+				},
+				"types": {
+					"type": "keyword"
+				},
+				"unhealthy": {
+					"type": "integer"
+				},
+				"unhealthy_components": {
+					"type": "keyword"
+				}				
+			}
+		},
 		"default_api_key": {
 			"type": "keyword"
 		},
@@ -109,6 +164,9 @@ const (
 		"enrolled_at": {
 			"type": "date"
 		},
+		"enrollment_api_key_id": {
+			"type": "keyword"
+		},
 		"last_checkin": {
 			"type": "date"
 		},
@@ -122,12 +180,34 @@ const (
 			"enabled" : false,
 			"type": "object"
 		},
+		"local_metadata_truncated": {
+			"type": "boolean"
+		},
+		"namespaces": {
+			"type": "keyword"
+		},
+		"orphaned_at": {
+			"type": "date"
+		},
 		"packages": {
 			"type": "keyword"
 		},
 		"policy_coordinator_idx": {
 			"type": "integer"
 		},
+		"policy_dispatched": {
+			"properties": {
+				"action_id": {
+					"type": "keyword"
+				},
+				"attempts": {
+					"type": "integer"
+				},
+				"hash": {
+					"type": "keyword"
+				}				
+			}
+		},
 		"policy_id": {
 			"type": "keyword"
 		},
@@ -137,15 +217,27 @@ const (
 		"policy_revision_idx": {
 			"type": "integer"
 		},
+		"quarantine_reason": {
+			"type": "keyword"
+		},
+		"quarantined_at": {
+			"type": "date"
+		},
 		"shared_id": {
 			"type": "keyword"
 		},
+		"tags": {
+			"type": "keyword"
+		},
 		"type": {
 			"type": "keyword"
 		},
 		"unenrolled_at": {
 			"type": "date"
 		},
+		"unenrolled_reason": {
+			"type": "keyword"
+		},
 		"unenrollment_started_at": {
 			"type": "date"
 		},
@@ -165,6 +257,45 @@ const (
 	}
 }`
 
+	// AgentComponent A component run by an Elastic Agent, as last reported on checkin; indexed into the component inventory when the components of the agent change
+	MappingAgentComponent = `{
+	"properties": {
+		"agent_id": {
+			"type": "keyword"
+		},
+		"agent_version": {
+			"type": "keyword"
+		},
+		"component_id": {
+			"type": "keyword"
+		},
+		"component_type": {
+			"type": "keyword"
+		},
+		"message": {
+			"type": "keyword"
+		},
+		"policy_id": {
+			"type": "keyword"
+		},
+		"status": {
+			"type": "keyword"
+		},
+		"@timestamp": {
+			"type": "date"
+		},
+		"unhealthy_units": {
+			"type": "keyword"
+		},
+		"unit_types": {
+			"type": "keyword"
+		},
+		"version": {
+			"type": "keyword"
+		}		
+	}
+}`
+
 	// AgentMetadata An Elastic Agent metadata
 	MappingAgentMetadata = `{
 	"properties": {
@@ -221,6 +352,31 @@ const (
 	}
 }`
 
+	// Components The components last reported by the Elastic Agent with the status of their units, stored as reported but not indexed so their free-form fields do not grow the mapping
+	MappingComponents = `{
+	"properties": {
+		
+	}
+}`
+
+	// ComponentsSummary Searchable summary of the components last reported by the Elastic Agent
+	MappingComponentsSummary = `{
+	"properties": {
+		"total": {
+			"type": "integer"
+		},
+		"types": {
+			"type": "keyword"
+		},
+		"unhealthy": {
+			"type": "integer"
+		},
+		"unhealthy_components": {
+			"type": "keyword"
+		}		
+	}
+}`
+
 	// Data The opaque payload.
 	MappingData = `{
 	"properties": {
@@ -228,6 +384,61 @@ const (
 	}
 }`
 
+	// DeadLetter A document Fleet Server could not process, kept for inspection and retry
+	MappingDeadLetter = `{
+	"properties": {
+		"doc_id": {
+			"type": "keyword"
+		},
+		"error": {
+			"type": "keyword"
+		},
+		"index": {
+			"type": "keyword"
+		},
+		"retried_at": {
+			"type": "date"
+		},
+		"seq_no": {
+			"type": "integer"
+		},
+		"source": {
+			"enabled" : false,
+			"type": "object"
+		},
+		"status": {
+			"type": "keyword"
+		},
+		"@timestamp": {
+			"type": "date"
+		}		
+	}
+}`
+
+	// DispatchEntry A checkin response that sent actions to an Elastic Agent, recorded into the dispatch journal
+	MappingDispatchEntry = `{
+	"properties": {
+		"action_ids": {
+			"type": "keyword"
+		},
+		"agent_id": {
+			"type": "keyword"
+		},
+		"policy_hash": {
+			"type": "keyword"
+		},
+		"policy_revision": {
+			"type": "keyword"
+		},
+		"response_bytes": {
+			"type": "integer"
+		},
+		"@timestamp": {
+			"type": "date"
+		}		
+	}
+}`
+
 	// EnrollmentApiKey An Elastic Agent enrollment API key
 	MappingEnrollmentApiKey = `{
 	"properties": {
@@ -249,6 +460,9 @@ const (
 		"name": {
 			"type": "keyword"
 		},
+		"namespaces": {
+			"type": "keyword"
+		},
 		"policy_id": {
 			"type": "keyword"
 		},
@@ -258,6 +472,57 @@ const (
 	}
 }`
 
+	// EnrollmentEvent An enrollment attempt of an Elastic Agent, recorded into the enrollment history
+	MappingEnrollmentEvent = `{
+	"properties": {
+		"agent_id": {
+			"type": "keyword"
+		},
+		"enrollment_api_key_id": {
+			"type": "keyword"
+		},
+		"error": {
+			"type": "keyword"
+		},
+		"latency_ms": {
+			"type": "integer"
+		},
+		"outcome": {
+			"type": "keyword"
+		},
+		"policy_id": {
+			"type": "keyword"
+		},
+		"source_ip": {
+			"type": "keyword"
+		},
+		"@timestamp": {
+			"type": "date"
+		},
+		"user_agent": {
+			"type": "keyword"
+		}		
+	}
+}`
+
+	// FileMetadata The metadata of a file uploaded by an Elastic Agent
+	MappingFileMetadata = `{
+	"properties": {
+		"mime_type": {
+			"type": "keyword"
+		},
+		"name": {
+			"type": "keyword"
+		},
+		"sha256": {
+			"type": "keyword"
+		},
+		"size": {
+			"type": "integer"
+		}		
+	}
+}`
+
 	// HostMetadata The host metadata for the Elastic Agent
 	MappingHostMetadata = `{
 	"properties": {
@@ -296,6 +561,9 @@ const (
 		"default_fleet_server": {
 			"type": "boolean"
 		},
+		"namespaces": {
+			"type": "keyword"
+		},
 		"policy_id": {
 			"type": "keyword"
 		},
@@ -308,6 +576,21 @@ const (
 	}
 }`
 
+	// PolicyDispatched The last policy change dispatched to the Elastic Agent, verified against the hash it acks
+	MappingPolicyDispatched = `{
+	"properties": {
+		"action_id": {
+			"type": "keyword"
+		},
+		"attempts": {
+			"type": "integer"
+		},
+		"hash": {
+			"type": "keyword"
+		}		
+	}
+}`
+
 	// PolicyLeader The current leader Fleet Server for a policy
 	MappingPolicyLeader = `{
 	"properties": {
@@ -327,6 +610,24 @@ const (
 	}
 }`
 
+	// RateLimit The count of the requests accepted by all Fleet Servers in a window of a global limit
+	MappingRateLimit = `{
+	"properties": {
+		"count": {
+			"type": "integer"
+		},
+		"name": {
+			"type": "keyword"
+		},
+		"@timestamp": {
+			"type": "date"
+		},
+		"window": {
+			"type": "integer"
+		}		
+	}
+}`
+
 	// Server A Fleet Server
 	MappingServer = `{
 	"properties": {
@@ -356,6 +657,22 @@ const (
 				}				
 			}
 		},
+		"restart": {
+			"properties": {
+				"requested_at": {
+					"type": "date"
+				},
+				"requested_id": {
+					"type": "keyword"
+				},
+				"state": {
+					"type": "keyword"
+				},
+				"updated_at": {
+					"type": "date"
+				}				
+			}
+		},
 		"server": {
 			"properties": {
 				"id": {
@@ -366,6 +683,9 @@ const (
 				}				
 			}
 		},
+		"status": {
+			"type": "keyword"
+		},
 		"@timestamp": {
 			"type": "date"
 		}		
@@ -384,6 +704,109 @@ const (
 	}
 }`
 
+	// ServerRestart The part of a Fleet Server in a rolling restart
+	MappingServerRestart = `{
+	"properties": {
+		"requested_at": {
+			"type": "date"
+		},
+		"requested_id": {
+			"type": "keyword"
+		},
+		"state": {
+			"type": "keyword"
+		},
+		"updated_at": {
+			"type": "date"
+		}		
+	}
+}`
+
+	// Signed The signature of the action by its writer: the base64 encoded data signed and the base64 encoded signature. The agents verify it before running the action.
+	MappingSigned = `{
+	"properties": {
+		
+	}
+}`
+
+	// Source The source of the original document
+	MappingSource = `{
+	"properties": {
+		
+	}
+}`
+
+	// Upload A file upload from an Elastic Agent
+	MappingUpload = `{
+	"properties": {
+		"action_id": {
+			"type": "keyword"
+		},
+		"agent_id": {
+			"type": "keyword"
+		},
+		"chunk_size": {
+			"type": "integer"
+		},
+		"error": {
+			"type": "keyword"
+		},
+		"file": {
+			"properties": {
+				"mime_type": {
+					"type": "keyword"
+				},
+				"name": {
+					"type": "keyword"
+				},
+				"sha256": {
+					"type": "keyword"
+				},
+				"size": {
+					"type": "integer"
+				}				
+			}
+		},
+		"status": {
+			"type": "keyword"
+		},
+		"storage": {
+			"type": "keyword"
+		},
+		"@timestamp": {
+			"type": "date"
+		},
+		"updated_at": {
+			"type": "date"
+		}		
+	}
+}`
+
+	// UploadChunk A chunk of a file upload, in the order of the file; its bytes are stored on the chunk or by the storage backend of the upload
+	MappingUploadChunk = `{
+	"properties": {
+		"bid": {
+			"type": "keyword"
+		},
+		"chunk": {
+			"type": "integer"
+		},
+		"data": {
+			"enabled" : false,
+			"type": "object"
+		},
+		"sha2": {
+			"type": "keyword"
+		},
+		"size": {
+			"type": "integer"
+		},
+		"@timestamp": {
+			"type": "date"
+		}		
+	}
+}`
+
 	// UserProvidedMetadata User provided metadata information for the Elastic Agent
 	MappingUserProvidedMetadata = `{
 	"properties": {
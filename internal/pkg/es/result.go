@@ -32,6 +32,9 @@ type HitT struct {
 	Index   string          `json:"_index"`
 	Source  json.RawMessage `json:"_source"`
 	Score   *float64        `json:"_score"`
+
+	// Sort values of the hit, to search after it
+	Sort json.RawMessage `json:"sort,omitempty"`
 }
 
 func (hit *HitT) Unmarshal(v interface{}) error {
@@ -125,6 +128,9 @@ type Response struct {
 	Hits         HitsT                  `json:"hits"`
 	Aggregations map[string]Aggregation `json:"aggregations,omitempty"`
 
+	// PitId is the point in time to continue a point in time search with
+	PitId string `json:"pit_id,omitempty"`
+
 	Error ErrorT `json:"error,omitempty"`
 }
 
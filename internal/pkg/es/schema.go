@@ -0,0 +1,164 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package es
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Schema validates documents against the mapping of an index, as generated
+// from model/schema.json, before they are written. The fields the mapping does
+// not have and the values Elasticsearch would not accept for the type of their
+// field are refused, so a Fleet Server of another version cannot extend the
+// mapping of a shared index dynamically nor conflict with it.
+//
+// The documents are validated as partial documents: no field is required, and
+// null, which removes the field on update, is accepted for every field. The
+// content of the objects not enabled in the mapping is not validated.
+type Schema struct {
+	root *schemaField
+}
+
+type schemaField struct {
+	Type       string                  `json:"type"`
+	Enabled    *bool                   `json:"enabled"`
+	Properties map[string]*schemaField `json:"properties"`
+}
+
+// NewSchema returns the schema of the mapping.
+func NewSchema(mapping string) (*Schema, error) {
+	var root schemaField
+	if err := json.Unmarshal([]byte(mapping), &root); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %w", err)
+	}
+	return &Schema{root: &root}, nil
+}
+
+// Validate returns *ErrMappingViolation, without the index and id, when the
+// document does not match the mapping.
+func (s *Schema) Validate(doc []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return &ErrMappingViolation{Reason: fmt.Sprintf("invalid document: %v", err)}
+	}
+	return s.root.validateObject("", obj)
+}
+
+func (f *schemaField) validateObject(path string, obj map[string]interface{}) error {
+	for name, v := range obj {
+		field := f
+		fpath := path
+		// Elasticsearch expands the dots of the names into objects
+		for _, part := range strings.Split(name, ".") {
+			if fpath != "" {
+				fpath += "."
+			}
+			fpath += part
+			if !field.enabled() {
+				break
+			}
+			child, ok := field.Properties[part]
+			if !ok {
+				return &ErrMappingViolation{Field: fpath, Reason: "field not in mapping"}
+			}
+			field = child
+		}
+		if err := field.validate(fpath, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *schemaField) enabled() bool {
+	return f.Enabled == nil || *f.Enabled
+}
+
+func (f *schemaField) validate(path string, v interface{}) error {
+	if v == nil || !f.enabled() {
+		return nil
+	}
+	// Any field holds an array of its values
+	if arr, ok := v.([]interface{}); ok {
+		for _, e := range arr {
+			if err := f.validate(path, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	typ := f.Type
+	if typ == "" && f.Properties != nil {
+		typ = "object"
+	}
+
+	var ok bool
+	switch typ {
+	case "object":
+		if obj, isObj := v.(map[string]interface{}); isObj {
+			return f.validateObject(path, obj)
+		}
+	case "keyword":
+		// Elasticsearch indexes the numbers and booleans as their string
+		switch v.(type) {
+		case string, json.Number, bool:
+			ok = true
+		}
+	case "date":
+		switch d := v.(type) {
+		case string:
+			ok = validDate(d)
+		case json.Number: // epoch milliseconds
+			_, err := d.Int64()
+			ok = err == nil
+		}
+	case "integer":
+		if n, isNum := v.(json.Number); isNum {
+			i, err := n.Int64()
+			ok = err == nil && i >= math.MinInt32 && i <= math.MaxInt32
+		}
+	case "boolean":
+		_, ok = v.(bool)
+	default:
+		// Not used by the fleet mappings; left to Elasticsearch
+		ok = true
+	}
+	if !ok {
+		return &ErrMappingViolation{Field: path, Reason: fmt.Sprintf("%s is not a valid %s", describe(v), typ)}
+	}
+	return nil
+}
+
+func validDate(s string) bool {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case json.Number:
+		return "number " + v.String()
+	case bool:
+		return fmt.Sprintf("boolean %t", v)
+	}
+	return fmt.Sprintf("%T", v)
+}
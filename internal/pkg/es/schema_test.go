@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package es
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := NewSchema(MappingAgent)
+	require.NoError(t, err)
+
+	for _, doc := range []string{
+		`{}`,
+		`{"active": true, "action_seq_no": [3], "policy_id": "p1", "tags": ["a", "b"]}`,
+		`{"last_checkin": "2026-10-16T12:00:00.123Z", "enrolled_at": "2026-10-16"}`,
+		`{"agent": {"id": "a1", "version": "8.0.0"}, "agent.version": "8.1.0"}`,
+		`{"components": {"anything": [1, {"goes": true}]}, "components_summary.types": "input"}`,
+		`{"policy_id": null, "agent": null, "updated_at": 1792152000000}`,
+		`{"policy_revision_idx": 7}`,
+	} {
+		assert.NoError(t, schema.Validate([]byte(doc)), doc)
+	}
+
+	for _, tc := range []struct {
+		doc   string
+		field string
+	}{
+		{`{"not_mapped": "x"}`, "not_mapped"},
+		{`{"agent": {"id": "a1", "name": "x"}}`, "agent.name"},
+		{`{"agent.name": "x"}`, "agent.name"},
+		{`{"active": "true"}`, "active"},
+		{`{"action_seq_no": 1.5}`, "action_seq_no"},
+		{`{"action_seq_no": 4294967296}`, "action_seq_no"},
+		{`{"policy_id": {"id": "p1"}}`, "policy_id"},
+		{`{"tags": ["a", {"b": 1}]}`, "tags"},
+		{`{"last_checkin": "yesterday"}`, "last_checkin"},
+		{`{"agent": "a1"}`, "agent"},
+	} {
+		err := schema.Validate([]byte(tc.doc))
+		var violation *ErrMappingViolation
+		require.True(t, errors.As(err, &violation), tc.doc)
+		assert.Equal(t, tc.field, violation.Field, tc.doc)
+		assert.True(t, errors.Is(err, ErrElasticMappingViolation))
+	}
+
+	assert.Error(t, schema.Validate([]byte(`[]`)))
+	_, err = NewSchema(`{"properties": `)
+	assert.Error(t, err)
+}
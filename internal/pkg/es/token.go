@@ -0,0 +1,193 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package es
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	TokenPrimary   = "primary"
+	TokenSecondary = "secondary"
+
+	kCutoverRetryInterval = time.Minute
+)
+
+var (
+	ErrNoSecondaryToken       = errors.New("no secondary service token configured")
+	ErrSecondaryTokenRejected = errors.New("secondary service token rejected by elasticsearch")
+	ErrServiceTokenRejected   = errors.New("service token rejected by elasticsearch")
+)
+
+// ServiceTokens holds the service token the Elasticsearch clients authenticate
+// with. Cutting over to the secondary token switches every client built from
+// the same configuration at once, without recreating them; requests already
+// in flight complete with the token they were sent with.
+type ServiceTokens struct {
+	mut       sync.RWMutex
+	primary   string
+	secondary string
+	active    string
+	since     time.Time
+}
+
+// The tokens of the configurations, by the hash of their service tokens so the
+// registry does not keep copies of them.
+var (
+	tokensMut sync.Mutex
+	tokens    = make(map[[sha256.Size]byte]*ServiceTokens)
+)
+
+// ServiceTokensFor returns the tokens shared by all the clients of the
+// configuration, or nil if no secondary service token is configured.
+func ServiceTokensFor(cfg *config.Elasticsearch) *ServiceTokens {
+	if cfg.SecondaryServiceToken == "" {
+		return nil
+	}
+
+	// The tokens hold no NUL, so the pair hashes unambiguously
+	key := sha256.Sum256([]byte(cfg.ServiceToken + "\x00" + cfg.SecondaryServiceToken))
+
+	tokensMut.Lock()
+	defer tokensMut.Unlock()
+
+	t, ok := tokens[key]
+	if !ok {
+		t = &ServiceTokens{
+			primary:   cfg.ServiceToken,
+			secondary: cfg.SecondaryServiceToken,
+			active:    TokenPrimary,
+			since:     time.Now(),
+		}
+		tokens[key] = t
+	}
+	return t
+}
+
+// Active returns which token is in use and since when.
+func (t *ServiceTokens) Active() (string, time.Time) {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	return t.active, t.since
+}
+
+func (t *ServiceTokens) token() string {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	if t.active == TokenSecondary {
+		return t.secondary
+	}
+	return t.primary
+}
+
+// Cutover validates the secondary token against Elasticsearch and makes it
+// the active token. It does nothing if the secondary token is already active.
+func (t *ServiceTokens) Cutover(ctx context.Context, esCli *elasticsearch.Client) error {
+	if t.secondary == "" {
+		return ErrNoSecondaryToken
+	}
+	if active, _ := t.Active(); active == TokenSecondary {
+		return nil
+	}
+
+	principal, err := AuthenticateServiceToken(ctx, esCli, t.secondary)
+	if errors.Is(err, ErrServiceTokenRejected) {
+		log.Warn().Err(err).Msg("Secondary service token rejected")
+		return ErrSecondaryTokenRejected
+	}
+	if err != nil {
+		return err
+	}
+
+	t.mut.Lock()
+	t.active = TokenSecondary
+	t.since = time.Now()
+	t.mut.Unlock()
+
+	log.Info().Str("principal", principal).Msg("Cut over to secondary service token")
+	return nil
+}
+
+// AuthenticateServiceToken returns the principal, such as elastic/kibana, of
+// the service token, or ErrServiceTokenRejected when Elasticsearch does not
+// authenticate it.
+func AuthenticateServiceToken(ctx context.Context, esCli *elasticsearch.Client, token string) (string, error) {
+	res, err := esCli.Security.Authenticate(
+		esCli.Security.Authenticate.WithContext(ctx),
+		esCli.Security.Authenticate.WithHeader(map[string]string{
+			"Authorization": "Bearer " + token,
+		}),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var resp struct {
+		Username string `json:"username"`
+		Error    ErrorT `json:"error,omitempty"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return "", err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w: %s: %s", ErrServiceTokenRejected, resp.Error.Type, resp.Error.Reason)
+	}
+	if err := TranslateError(res.StatusCode, resp.Error); err != nil {
+		return "", err
+	}
+	return resp.Username, nil
+}
+
+// CutoverAt cuts over to the secondary token at the given time, retrying until
+// it succeeds or ctx is done.
+func (t *ServiceTokens) CutoverAt(ctx context.Context, esCli *elasticsearch.Client, at time.Time) error {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		err := t.Cutover(ctx, esCli)
+		if err == nil || errors.Is(err, ErrNoSecondaryToken) {
+			return err
+		}
+		log.Error().Err(err).Dur("retry", kCutoverRetryInterval).Msg("Fail scheduled service token cutover")
+		timer.Reset(kCutoverRetryInterval)
+	}
+}
+
+// tokenTransport authenticates the requests that do not carry credentials of
+// their own with the active service token.
+type tokenTransport struct {
+	next   http.RoundTripper
+	tokens *ServiceTokens
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+t.tokens.token())
+	return t.next.RoundTrip(r)
+}
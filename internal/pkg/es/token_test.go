@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package es
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestServiceTokensFor(t *testing.T) {
+	assert.Nil(t, ServiceTokensFor(&config.Elasticsearch{ServiceToken: "a"}))
+
+	cfg := &config.Elasticsearch{ServiceToken: "a", SecondaryServiceToken: "b"}
+	tokens := ServiceTokensFor(cfg)
+	require.NotNil(t, tokens)
+	assert.Same(t, tokens, ServiceTokensFor(cfg), "clients of the same configuration share the tokens")
+	assert.NotSame(t, tokens, ServiceTokensFor(&config.Elasticsearch{ServiceToken: "a", SecondaryServiceToken: "c"}))
+
+	active, _ := tokens.Active()
+	assert.Equal(t, TokenPrimary, active)
+}
+
+func TestTokenTransport(t *testing.T) {
+	tokens := &ServiceTokens{primary: "a", secondary: "b", active: TokenPrimary}
+
+	var got string
+	tr := &tokenTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			got = req.Header.Get("Authorization")
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		tokens: tokens,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:9200/", nil)
+	require.NoError(t, err)
+
+	_, err = tr.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer a", got)
+	assert.Empty(t, req.Header.Get("Authorization"), "request of the caller is not modified")
+
+	tokens.active = TokenSecondary
+	_, err = tr.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer b", got)
+
+	// requests with their own credentials, such as agent API keys, are left alone
+	req.Header.Set("Authorization", "ApiKey xyz")
+	_, err = tr.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "ApiKey xyz", got)
+}
+
+func TestCutoverWithoutSecondary(t *testing.T) {
+	tokens := &ServiceTokens{primary: "a", active: TokenPrimary}
+	assert.Equal(t, ErrNoSecondaryToken, tokens.Cutover(context.Background(), nil))
+}
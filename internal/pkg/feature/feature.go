@@ -0,0 +1,188 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package feature gates the risky subsystems of the server behind flags that
+// operators toggle per instance, from the configuration or at runtime through
+// the admin API, without a rebuild.
+package feature
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Sources of the state of a flag, from the lowest precedence.
+const (
+	SourceDefault  = "default"
+	SourceConfig   = "config"
+	SourceOverride = "override"
+)
+
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// Default is the registry of the flags of the process.
+var Default = NewRegistry()
+
+// Flag gates a subsystem. It is enabled by, from the highest precedence, an
+// override of the admin API, the configuration or its default.
+type Flag struct {
+	name string
+	desc string
+	def  bool
+
+	enabled    int32 // 1 when enabled, read atomically
+	configured *bool
+	override   *bool
+}
+
+// Name returns the name of the flag.
+func (f *Flag) Name() string {
+	return f.name
+}
+
+// Enabled reports whether the subsystem gated by the flag is enabled; it is
+// cheap enough to be checked on every request.
+func (f *Flag) Enabled() bool {
+	return atomic.LoadInt32(&f.enabled) == 1
+}
+
+// State is the state of a flag.
+type State struct {
+	Name        string
+	Description string
+	Default     bool
+	Enabled     bool
+	Source      string
+}
+
+// Registry holds the flags by name.
+type Registry struct {
+	mut   sync.Mutex
+	flags map[string]*Flag
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		flags: make(map[string]*Flag),
+	}
+}
+
+// Register adds a flag to the registry; flags are registered once, when the
+// package of the subsystem they gate is initialized. Registering a name twice
+// panics.
+func (r *Registry) Register(name, desc string, def bool) *Flag {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, ok := r.flags[name]; ok {
+		panic(fmt.Sprintf("feature flag %q registered twice", name))
+	}
+
+	f := &Flag{
+		name: name,
+		desc: desc,
+		def:  def,
+	}
+	f.update()
+	r.flags[name] = f
+	return f
+}
+
+// Configure sets the flags from the configuration; the flags absent from it
+// are back to their default. The names that are not registered are returned.
+func (r *Registry) Configure(flags map[string]bool) (unknown []string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for name := range flags {
+		if _, ok := r.flags[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	for name, f := range r.flags {
+		f.configured = nil
+		if enabled, ok := flags[name]; ok {
+			f.configured = &enabled
+		}
+		f.update()
+	}
+	return unknown
+}
+
+// Override sets the flag regardless of the configuration, until the process
+// exits; nil clears the override.
+func (r *Registry) Override(name string, enabled *bool) (State, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	f, ok := r.flags[name]
+	if !ok {
+		return State{}, ErrUnknownFlag
+	}
+	f.override = nil
+	if enabled != nil {
+		v := *enabled
+		f.override = &v
+	}
+	f.update()
+	return f.state(), nil
+}
+
+// List returns the state of the flags, by name.
+func (r *Registry) List() []State {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	states := make([]State, 0, len(r.flags))
+	for _, f := range r.flags {
+		states = append(states, f.state())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+// update stores the state of the flag once its settings change; called with
+// the lock of the registry held.
+func (f *Flag) update() {
+	var v int32
+	if enabled, _ := f.resolve(); enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&f.enabled, v)
+}
+
+func (f *Flag) resolve() (bool, string) {
+	switch {
+	case f.override != nil:
+		return *f.override, SourceOverride
+	case f.configured != nil:
+		return *f.configured, SourceConfig
+	default:
+		return f.def, SourceDefault
+	}
+}
+
+func (f *Flag) state() State {
+	enabled, source := f.resolve()
+	return State{
+		Name:        f.name,
+		Description: f.desc,
+		Default:     f.def,
+		Enabled:     enabled,
+		Source:      source,
+	}
+}
+
+// Register adds a flag to the default registry.
+func Register(name, desc string, def bool) *Flag {
+	return Default.Register(name, desc, def)
+}
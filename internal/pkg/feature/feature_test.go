@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package feature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryPrecedence(t *testing.T) {
+	r := NewRegistry()
+	on := r.Register("on", "enabled by default", true)
+	off := r.Register("off", "disabled by default", false)
+
+	assert.True(t, on.Enabled())
+	assert.False(t, off.Enabled())
+
+	unknown := r.Configure(map[string]bool{"on": false, "off": true, "missing": true})
+	assert.Equal(t, []string{"missing"}, unknown)
+	assert.False(t, on.Enabled())
+	assert.True(t, off.Enabled())
+
+	disabled := false
+	state, err := r.Override("off", &disabled)
+	require.NoError(t, err)
+	assert.Equal(t, State{Name: "off", Description: "disabled by default", Enabled: false, Source: SourceOverride}, state)
+	assert.False(t, off.Enabled())
+
+	// The override outlives the configuration reloads
+	r.Configure(nil)
+	assert.True(t, on.Enabled())
+	assert.False(t, off.Enabled())
+
+	state, err = r.Override("off", nil)
+	require.NoError(t, err)
+	assert.Equal(t, SourceDefault, state.Source)
+
+	assert.Equal(t, []State{
+		{Name: "off", Description: "disabled by default", Enabled: false, Source: SourceDefault},
+		{Name: "on", Description: "enabled by default", Default: true, Enabled: true, Source: SourceDefault},
+	}, r.List())
+}
+
+func TestRegistryErrors(t *testing.T) {
+	r := NewRegistry()
+	r.Register("flag", "", false)
+
+	_, err := r.Override("missing", nil)
+	assert.Equal(t, ErrUnknownFlag, err)
+
+	assert.Panics(t, func() { r.Register("flag", "", true) })
+}
@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package lifecycle publishes the lifecycle events of the agents to a message
+// bus, so downstream automation such as a CMDB sync does not have to poll
+// Elasticsearch. The events are delivered at least once; their IDs let the
+// consumers drop the duplicates.
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	TypeEnrolled      = "agent.enrolled"
+	TypeUnenrolled    = "agent.unenrolled"
+	TypeOffline       = "agent.offline"
+	TypePolicyApplied = "agent.policy_applied"
+	TypeUpgraded      = "agent.upgraded"
+)
+
+// Event is a lifecycle event of an agent.
+type Event struct {
+	Id             string    `json:"id"`
+	Type           string    `json:"type"`
+	Timestamp      time.Time `json:"@timestamp"`
+	AgentId        string    `json:"agent_id"`
+	PolicyId       string    `json:"policy_id,omitempty"`
+	PolicyRevision int64     `json:"policy_revision,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+}
+
+// NewEvent returns the event of the agent, its ID derived from its content.
+// The same event reported by several Fleet Servers, such as an agent going
+// offline at the time of its last checkin, has the same ID.
+func NewEvent(typ, agentId, policyId string, revision int64, ts time.Time) Event {
+	ts = ts.UTC()
+
+	h := sha256.New()
+	for _, s := range []string{typ, agentId, policyId, strconv.FormatInt(revision, 10), ts.Format(time.RFC3339Nano)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	return Event{
+		Id:             hex.EncodeToString(h.Sum(nil)[:16]),
+		Type:           typ,
+		Timestamp:      ts,
+		AgentId:        agentId,
+		PolicyId:       policyId,
+		PolicyRevision: revision,
+	}
+}
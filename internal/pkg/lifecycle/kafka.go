@@ -0,0 +1,85 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// kafkaPublisher produces an event per message, keyed by agent so the events
+// of an agent stay in order on a partition. The batch is acknowledged by all
+// the in-sync replicas.
+type kafkaPublisher struct {
+	hosts []string
+	topic string
+	cfg   *sarama.Config
+
+	mut      sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func newKafka(cfg *config.LifecycleKafka) *kafkaPublisher {
+	scfg := sarama.NewConfig()
+	scfg.ClientID = cfg.ClientID
+	scfg.Net.DialTimeout = cfg.Timeout
+	scfg.Net.ReadTimeout = cfg.Timeout
+	scfg.Net.WriteTimeout = cfg.Timeout
+	scfg.Producer.Timeout = cfg.Timeout
+	scfg.Producer.RequiredAcks = sarama.WaitForAll
+	scfg.Producer.Return.Successes = true
+	// The outbox retries the batch
+	scfg.Producer.Retry.Max = 0
+
+	return &kafkaPublisher{
+		hosts: cfg.Hosts,
+		topic: cfg.Topic,
+		cfg:   scfg,
+	}
+}
+
+func (k *kafkaPublisher) Publish(ctx context.Context, events []Event) error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+
+	if k.producer == nil {
+		producer, err := sarama.NewSyncProducer(k.hosts, k.cfg)
+		if err != nil {
+			return err
+		}
+		k.producer = producer
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(events))
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: k.topic,
+			Key:   sarama.StringEncoder(ev.AgentId),
+			Value: sarama.ByteEncoder(data),
+		})
+	}
+	return k.producer.SendMessages(msgs)
+}
+
+func (k *kafkaPublisher) Close() error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+
+	if k.producer == nil {
+		return nil
+	}
+	err := k.producer.Close()
+	k.producer = nil
+	return err
+}
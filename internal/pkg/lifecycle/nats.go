@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package lifecycle
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/nats-io/nats.go"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// natsPublisher publishes an event per message, then flushes the connection;
+// the pong of the flush tells all the messages before it were processed. The
+// connection is secured with TLS when configured, the URL is tls://, or the
+// server requires it, before the credentials of the URL are sent.
+type natsPublisher struct {
+	url     string
+	subject string
+	timeout time.Duration
+	tls     *tls.Config
+
+	mut  sync.Mutex
+	conn *nats.Conn
+}
+
+func newNATS(cfg *config.LifecycleNATS) (*natsPublisher, error) {
+	n := &natsPublisher{
+		url:     cfg.URL,
+		subject: cfg.Subject,
+		timeout: cfg.Timeout,
+	}
+	if cfg.TLS != nil && cfg.TLS.IsEnabled() {
+		tlsCfg, err := tlscommon.LoadTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		n.tls = tlsCfg.ToConfig()
+	}
+	return n, nil
+}
+
+func (n *natsPublisher) Publish(ctx context.Context, events []Event) error {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+
+	if err := n.publish(ctx, events); err != nil {
+		n.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (n *natsPublisher) Close() error {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+
+	n.disconnect()
+	return nil
+}
+
+func (n *natsPublisher) connect() error {
+	opts := []nats.Option{
+		nats.Name("fleet-server"),
+		nats.Timeout(n.timeout),
+		// The outbox retries the batch on a new connection
+		nats.NoReconnect(),
+	}
+	if n.tls != nil {
+		opts = append(opts, nats.Secure(n.tls))
+	}
+
+	conn, err := nats.Connect(n.url, opts...)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	return nil
+}
+
+func (n *natsPublisher) publish(ctx context.Context, events []Event) error {
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if err := n.conn.Publish(n.subject, data); err != nil {
+			return err
+		}
+	}
+
+	timeout := n.timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	return n.conn.FlushTimeout(timeout)
+}
+
+func (n *natsPublisher) disconnect() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/sleep"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Publisher delivers a batch of events; the batch is retried as a whole on
+// error, so an event may be delivered more than once.
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// OutboxStats are the counts of the outbox.
+type OutboxStats struct {
+	Pending   int
+	Published uint64
+	Dropped   uint64
+	Failures  uint64
+}
+
+// Outbox holds the events until they are published. It is bounded; the
+// oldest events are dropped when it is full, as the publisher is down for too
+// long. The nil Outbox drops every event, so the callers emit without
+// checking whether the events are enabled.
+type Outbox struct {
+	pub       Publisher
+	size      int
+	batch     int
+	retryInit time.Duration
+	retryMax  time.Duration
+
+	mut    sync.Mutex
+	events []Event
+	stats  OutboxStats
+	wake   chan struct{}
+
+	// Events dropped since the batch being published was peeked; they were
+	// the first ones of the batch.
+	shifted int
+}
+
+// NewOutbox returns the outbox of the publisher; nil when the events are
+// disabled.
+func NewOutbox(cfg *config.LifecycleEvents, pub Publisher) *Outbox {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	log.Info().
+		Str("publisher", cfg.Publisher).
+		Int("outboxSize", cfg.OutboxSize).
+		Int("batchSize", cfg.BatchSize).
+		Msg("Lifecycle events install")
+
+	return &Outbox{
+		pub:       pub,
+		size:      cfg.OutboxSize,
+		batch:     cfg.BatchSize,
+		retryInit: cfg.RetryInit,
+		retryMax:  cfg.RetryMax,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Emit queues the event for publishing; it never blocks.
+func (o *Outbox) Emit(ev Event) {
+	if o == nil {
+		return
+	}
+
+	o.mut.Lock()
+	if len(o.events) >= o.size {
+		dropped := o.events[0]
+		o.events = o.events[1:]
+		o.stats.Dropped++
+		o.shifted++
+		log.Warn().
+			Str("type", dropped.Type).
+			Str("agentId", dropped.AgentId).
+			Msg("Lifecycle events outbox full; dropped the oldest event")
+	}
+	o.events = append(o.events, ev)
+	o.mut.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the counts of the outbox.
+func (o *Outbox) Stats() OutboxStats {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	stats := o.stats
+	stats.Pending = len(o.events)
+	return stats
+}
+
+// Run publishes the events in order until the context is done; a batch is
+// only removed from the outbox once published.
+func (o *Outbox) Run(ctx context.Context) error {
+	defer o.pub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.wake:
+		}
+
+		for {
+			batch := o.peek()
+			if len(batch) == 0 {
+				break
+			}
+			if err := o.publish(ctx, batch); err != nil {
+				return err
+			}
+			o.remove(len(batch))
+		}
+	}
+}
+
+// publish retries the batch with backoff until published, or the context is
+// done.
+func (o *Outbox) publish(ctx context.Context, batch []Event) error {
+	backoff := o.retryInit
+	for {
+		err := o.pub.Publish(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		o.mut.Lock()
+		o.stats.Failures++
+		o.mut.Unlock()
+
+		log.Warn().
+			Err(err).
+			Int("events", len(batch)).
+			Dur("retry_in", backoff).
+			Msg("Fail to publish lifecycle events")
+
+		if err := sleep.WithContext(ctx, backoff); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > o.retryMax {
+			backoff = o.retryMax
+		}
+	}
+}
+
+// peek returns a copy of the first batch of events.
+func (o *Outbox) peek() []Event {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	n := len(o.events)
+	if n > o.batch {
+		n = o.batch
+	}
+	o.shifted = 0
+	return append([]Event(nil), o.events[:n]...)
+}
+
+// remove removes the published events still in the outbox; those dropped
+// from the full outbox meanwhile are gone already.
+func (o *Outbox) remove(published int) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	o.stats.Published += uint64(published)
+	if n := published - o.shifted; n > 0 {
+		o.events = o.events[n:]
+	}
+	o.shifted = 0
+}
@@ -0,0 +1,125 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// mockPublisher fails the first failures batches, then records the others.
+type mockPublisher struct {
+	mut       sync.Mutex
+	failures  int
+	batches   [][]Event
+	published chan struct{}
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, events []Event) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("unavailable")
+	}
+	m.batches = append(m.batches, events)
+	m.published <- struct{}{}
+	return nil
+}
+
+func (m *mockPublisher) Close() error { return nil }
+
+func testOutboxConfig() config.LifecycleEvents {
+	var cfg config.LifecycleEvents
+	cfg.InitDefaults()
+	cfg.Enabled = true
+	cfg.Publisher = config.LifecyclePublisherWebhook
+	cfg.RetryInit = time.Millisecond
+	cfg.RetryMax = time.Millisecond
+	return cfg
+}
+
+func TestNewEvent(t *testing.T) {
+	ts := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	ev := NewEvent(TypeOffline, "agent", "policy", 3, ts.In(time.FixedZone("CET", 3600)))
+	assert.Equal(t, ts, ev.Timestamp)
+	assert.Len(t, ev.Id, 32)
+	assert.Equal(t, ev.Id, NewEvent(TypeOffline, "agent", "policy", 3, ts).Id)
+	assert.NotEqual(t, ev.Id, NewEvent(TypeOffline, "agent", "policy", 3, ts.Add(time.Second)).Id)
+	assert.NotEqual(t, ev.Id, NewEvent(TypeEnrolled, "agent", "policy", 3, ts).Id)
+}
+
+func TestOutboxDisabled(t *testing.T) {
+	o := NewOutbox(&config.LifecycleEvents{}, &mockPublisher{})
+	assert.Nil(t, o)
+	o.Emit(Event{Type: TypeEnrolled})
+}
+
+func TestOutboxRetries(t *testing.T) {
+	cfg := testOutboxConfig()
+	cfg.BatchSize = 2
+	pub := &mockPublisher{failures: 2, published: make(chan struct{}, 10)}
+	o := NewOutbox(&cfg, pub)
+
+	for _, id := range []string{"a", "b", "c"} {
+		o.Emit(Event{Type: TypeEnrolled, AgentId: id})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-pub.published:
+		case <-time.After(5 * time.Second):
+			t.Fatal("events not published")
+		}
+	}
+
+	pub.mut.Lock()
+	defer pub.mut.Unlock()
+	require.Len(t, pub.batches, 2)
+	assert.Equal(t, "a", pub.batches[0][0].AgentId)
+	assert.Equal(t, "b", pub.batches[0][1].AgentId)
+	assert.Equal(t, "c", pub.batches[1][0].AgentId)
+
+	stats := o.Stats()
+	assert.Equal(t, 0, stats.Pending)
+	assert.Equal(t, uint64(3), stats.Published)
+	assert.Equal(t, uint64(2), stats.Failures)
+}
+
+func TestOutboxDropsOldest(t *testing.T) {
+	cfg := testOutboxConfig()
+	cfg.OutboxSize = 3
+	cfg.BatchSize = 2
+	o := NewOutbox(&cfg, &mockPublisher{})
+
+	for _, id := range []string{"a", "b", "c"} {
+		o.Emit(Event{AgentId: id})
+	}
+	batch := o.peek()
+	require.Len(t, batch, 2)
+
+	// a is dropped while its batch is published
+	o.Emit(Event{AgentId: "d"})
+	o.remove(len(batch))
+
+	assert.Equal(t, []Event{{AgentId: "c"}, {AgentId: "d"}}, o.events)
+	assert.Equal(t, uint64(1), o.Stats().Dropped)
+}
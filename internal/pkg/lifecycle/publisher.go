@@ -0,0 +1,25 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package lifecycle
+
+import (
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// NewPublisher returns the configured publisher. The publishers connect on
+// their first batch, so an unreachable bus does not hold the startup.
+func NewPublisher(cfg *config.LifecycleEvents) (Publisher, error) {
+	switch cfg.Publisher {
+	case config.LifecyclePublisherWebhook:
+		return newWebhook(&cfg.Webhook), nil
+	case config.LifecyclePublisherKafka:
+		return newKafka(&cfg.Kafka), nil
+	case config.LifecyclePublisherNATS:
+		return newNATS(&cfg.NATS)
+	}
+	return nil, fmt.Errorf("unknown lifecycle events publisher %q", cfg.Publisher)
+}
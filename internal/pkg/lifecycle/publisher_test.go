@@ -0,0 +1,221 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package lifecycle
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestWebhookPublish(t *testing.T) {
+	var got []Event
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &got))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w := newWebhook(&config.LifecycleWebhook{
+		URL:     srv.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+		Timeout: time.Second,
+	})
+	defer w.Close()
+
+	events := []Event{{Id: "1", Type: TypeEnrolled, AgentId: "agent"}}
+	require.NoError(t, w.Publish(context.Background(), events))
+	assert.Equal(t, events[0].AgentId, got[0].AgentId)
+
+	status = http.StatusServiceUnavailable
+	assert.Error(t, w.Publish(context.Background(), events))
+}
+
+// serveNATS accepts a connection and answers as a NATS server, sending the
+// payloads published to the channel. With tlsCfg, the server requires TLS
+// before the client sends its CONNECT.
+func serveNATS(t *testing.T, ln net.Listener, tlsCfg *tls.Config, payloads chan<- string, connects chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if tlsCfg != nil {
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576,\"tls_required\":true}\r\n")
+		tconn := tls.Server(conn, tlsCfg)
+		if err := tconn.Handshake(); err != nil {
+			return
+		}
+		conn = tconn
+	} else {
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			if connects != nil {
+				connects <- strings.TrimPrefix(line, "CONNECT ")
+			}
+		case line == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case strings.HasPrefix(line, "PUB "):
+			var subject string
+			var size int
+			if _, err := fmt.Sscanf(line, "PUB %s %d", &subject, &size); !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "fleet.events", subject)
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			payloads <- string(payload[:size])
+		default:
+			fmt.Fprintf(conn, "-ERR 'Unknown Protocol Operation'\r\n")
+		}
+	}
+}
+
+func TestNATSPublish(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	payloads := make(chan string, 10)
+	go serveNATS(t, ln, nil, payloads, nil)
+
+	n, err := newNATS(&config.LifecycleNATS{
+		URL:     "nats://" + ln.Addr().String(),
+		Subject: "fleet.events",
+		Timeout: time.Second,
+	})
+	require.NoError(t, err)
+	defer n.Close()
+
+	events := []Event{
+		{Id: "1", Type: TypeEnrolled, AgentId: "a"},
+		{Id: "2", Type: TypeUpgraded, AgentId: "b"},
+	}
+	require.NoError(t, n.Publish(context.Background(), events))
+
+	for _, want := range events {
+		var got Event
+		require.NoError(t, json.Unmarshal([]byte(<-payloads), &got))
+		assert.Equal(t, want.Id, got.Id)
+		assert.Equal(t, want.AgentId, got.AgentId)
+	}
+}
+
+// makeCert returns a self-signed certificate of 127.0.0.1, and the pool
+// trusting it.
+func makeCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nats"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestNATSPublishTLS(t *testing.T) {
+	cert, pool := makeCert(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	payloads := make(chan string, 10)
+	connects := make(chan string, 1)
+	go serveNATS(t, ln, &tls.Config{Certificates: []tls.Certificate{cert}}, payloads, connects)
+
+	n, err := newNATS(&config.LifecycleNATS{
+		URL:     "tls://fleet:secret@" + ln.Addr().String(),
+		Subject: "fleet.events",
+		Timeout: time.Second,
+	})
+	require.NoError(t, err)
+	n.tls = &tls.Config{RootCAs: pool}
+	defer n.Close()
+
+	require.NoError(t, n.Publish(context.Background(), []Event{{Id: "1", Type: TypeEnrolled, AgentId: "a"}}))
+
+	// The credentials were only sent once the connection was secured
+	var connect struct {
+		User string `json:"user"`
+		Pass string `json:"pass"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(<-connects), &connect))
+	assert.Equal(t, "fleet", connect.User)
+	assert.Equal(t, "secret", connect.Pass)
+
+	var got Event
+	require.NoError(t, json.Unmarshal([]byte(<-payloads), &got))
+	assert.Equal(t, "1", got.Id)
+}
+
+func TestNATSPublishUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	n, err := newNATS(&config.LifecycleNATS{URL: "nats://" + addr, Subject: "fleet.events", Timeout: time.Second})
+	require.NoError(t, err)
+	assert.Error(t, n.Publish(context.Background(), []Event{{Id: "1"}}))
+	assert.Nil(t, n.conn)
+}
@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CountFunc adds delta to the count of the named limit in window and returns
+// the count of the window across all the Fleet Servers of the cluster.
+type CountFunc func(ctx context.Context, name string, window, delta int64) (int64, error)
+
+// globalRate caps the number of requests accepted per window across the
+// cluster. Requests are accepted against the last known cluster count plus the
+// local requests not synced yet, so the check never waits on Elasticsearch;
+// the counter is synced in the background at most once per sync interval.
+//
+// While the counter cannot be reached the local requests keep accumulating,
+// which caps this instance at the allowance of the window on its own.
+type globalRate struct {
+	name   string
+	count  CountFunc
+	allow  int64
+	window time.Duration
+	sync   time.Duration
+	now    func() time.Time
+
+	mut      sync.Mutex
+	cur      int64 // current window number
+	seen     int64 // cluster count of the window as of the last sync
+	pending  int64 // requests accepted locally and not synced yet
+	syncing  bool
+	lastSync time.Time
+}
+
+func newGlobalRate(name string, cfg *config.Limit, global *config.GlobalLimits, count CountFunc) *globalRate {
+	return &globalRate{
+		name:   name,
+		count:  count,
+		allow:  int64(global.Window/cfg.Interval) + int64(cfg.Burst),
+		window: global.Window,
+		sync:   global.SyncInterval,
+		now:    time.Now,
+	}
+}
+
+func (g *globalRate) Allow() bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	now := g.now()
+	if w := now.UnixNano() / int64(g.window); w != g.cur {
+		g.cur = w
+		g.seen = 0
+		g.pending = 0
+	}
+
+	ok := g.seen+g.pending < g.allow
+	if ok {
+		g.pending++
+	}
+
+	if !g.syncing && now.Sub(g.lastSync) >= g.sync {
+		g.syncing = true
+		g.lastSync = now
+		go g.flush(g.cur, g.pending)
+	}
+
+	return ok
+}
+
+// flush adds the pending requests to the cluster counter and refreshes the
+// cluster count of the window.
+func (g *globalRate) flush(window, delta int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.window)
+	defer cancel()
+
+	total, err := g.count(ctx, g.name, window, delta)
+
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.syncing = false
+
+	if err != nil {
+		log.Warn().Err(err).Str("limit", g.name).Msg("Fail to sync global limit counter")
+		return
+	}
+
+	// Requests of a window that is over do not count anymore.
+	if window != g.cur {
+		return
+	}
+	g.pending -= delta
+	g.seen = total
+}
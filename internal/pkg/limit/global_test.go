@@ -0,0 +1,115 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sharedCounter is an in memory stand in for the counter kept in Elasticsearch.
+type sharedCounter struct {
+	mut    sync.Mutex
+	window int64
+	count  int64
+	err    error
+}
+
+func (c *sharedCounter) Add(ctx context.Context, name string, window, delta int64) (int64, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	if window != c.window {
+		c.window = window
+		c.count = 0
+	}
+	c.count += delta
+	return c.count, nil
+}
+
+func newTestGlobalRate(counter *sharedCounter, now *time.Time) *globalRate {
+	g := newGlobalRate("test",
+		&config.Limit{Interval: time.Second, Burst: 0, Global: true},
+		&config.GlobalLimits{Window: 10 * time.Second, SyncInterval: time.Hour},
+		counter.Add,
+	)
+	g.now = func() time.Time { return *now }
+	// syncs are driven by the test
+	g.lastSync = *now
+	return g
+}
+
+func allowN(g *globalRate, n int) int {
+	var ok int
+	for i := 0; i < n; i++ {
+		if g.Allow() {
+			ok++
+		}
+	}
+	return ok
+}
+
+func TestGlobalRateSharedAcrossInstances(t *testing.T) {
+	now := time.Unix(1000, 0)
+	counter := &sharedCounter{}
+	a := newTestGlobalRate(counter, &now)
+	b := newTestGlobalRate(counter, &now)
+
+	assert.Equal(t, 6, allowN(a, 6))
+	a.flush(a.cur, a.pending)
+	assert.Equal(t, int64(6), a.seen)
+	assert.Equal(t, int64(0), a.pending)
+
+	b.Allow()
+	b.flush(b.cur, b.pending)
+	assert.Equal(t, int64(7), b.seen)
+
+	// 10 per window across both instances
+	assert.Equal(t, 3, allowN(b, 5))
+
+	// next window
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, 10, allowN(b, 12))
+}
+
+func TestGlobalRateSyncFailure(t *testing.T) {
+	now := time.Unix(1000, 0)
+	counter := &sharedCounter{err: errors.New("unavailable")}
+	g := newTestGlobalRate(counter, &now)
+
+	assert.Equal(t, 4, allowN(g, 4))
+	g.flush(g.cur, g.pending)
+	assert.Equal(t, int64(4), g.pending)
+
+	// the instance is capped at the allowance of the window on its own
+	assert.Equal(t, 6, allowN(g, 10))
+}
+
+func TestNewGlobalLimiter(t *testing.T) {
+	counter := &sharedCounter{}
+	global := &config.GlobalLimits{Window: 10 * time.Second, SyncInterval: time.Second}
+
+	l := NewGlobalLimiter("test", &config.Limit{Interval: time.Second, Burst: 1}, global, counter.Add)
+	assert.Nil(t, l.global, "limit not marked global")
+
+	l = NewGlobalLimiter("test", &config.Limit{Interval: time.Second, Burst: 1, Global: true}, global, nil)
+	assert.Nil(t, l.global, "no counter")
+
+	l = NewGlobalLimiter("test", &config.Limit{Interval: time.Second, Burst: 1, Global: true}, global, counter.Add)
+	require.NotNil(t, l.global)
+	assert.Equal(t, int64(11), l.global.allow)
+}
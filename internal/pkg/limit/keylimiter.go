@@ -0,0 +1,192 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"golang.org/x/time/rate"
+)
+
+var ErrKeyBlocked = errors.New("api key blocked")
+
+const (
+	kKeySweepInterval = time.Minute
+
+	// kKeyLimiterMaxKeys bounds the keys tracked; past it the least recently
+	// seen is dropped, as if it had been idle.
+	kKeyLimiterMaxKeys = 100000
+)
+
+// KeyLimiter tracks the request rate of each API key across all routes. A key
+// that exhausts its token bucket is blocked until the block duration elapses
+// or it is unblocked.
+//
+// Keys are tracked by id and a hash of the secret, so requests forging the id
+// of another key do not get that key blocked, and no secret is kept in memory.
+// At most kKeyLimiterMaxKeys keys are tracked, in an LRU.
+type KeyLimiter struct {
+	mut       sync.Mutex
+	every     rate.Limit
+	burst     int
+	block     time.Duration
+	idle      time.Duration
+	keys      *simplelru.LRU
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type keyT struct {
+	id         string
+	secretHash string
+}
+
+type keyStateT struct {
+	limiter      *rate.Limiter
+	lastSeen     time.Time
+	blockedUntil time.Time
+}
+
+// BlockedKey is an API key that is currently blocked.
+type BlockedKey struct {
+	Id    string
+	Until time.Time
+}
+
+// NewKeyLimiter returns nil if cfg does not set an interval; a nil KeyLimiter
+// allows every request.
+func NewKeyLimiter(cfg *config.KeyLimit) *KeyLimiter {
+	if cfg == nil || cfg.Interval == time.Duration(0) {
+		return nil
+	}
+
+	// A bucket left alone for this long is full again, tracking it is pointless.
+	idle := cfg.Interval * time.Duration(cfg.Burst+1)
+	if idle < cfg.Block {
+		idle = cfg.Block
+	}
+
+	// Only fails on a size that is not positive
+	keys, _ := simplelru.NewLRU(kKeyLimiterMaxKeys, nil)
+
+	return &KeyLimiter{
+		every: rate.Every(cfg.Interval),
+		burst: cfg.Burst,
+		block: cfg.Block,
+		idle:  idle,
+		keys:  keys,
+		now:   time.Now,
+	}
+}
+
+// Allow accounts a request made with the API key. It returns ErrKeyBlocked if
+// the key is blocked; blocked is true only for the request that caused the
+// key to be blocked.
+func (l *KeyLimiter) Allow(id, secretHash string) (blocked bool, err error) {
+	if l == nil {
+		return false, nil
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	k := keyT{id, secretHash}
+	var st *keyStateT
+	if v, ok := l.keys.Get(k); ok {
+		st = v.(*keyStateT)
+	} else {
+		st = &keyStateT{limiter: rate.NewLimiter(l.every, l.burst)}
+		l.keys.Add(k, st)
+	}
+	st.lastSeen = now
+
+	if now.Before(st.blockedUntil) {
+		return false, ErrKeyBlocked
+	}
+
+	if !st.limiter.AllowN(now, 1) {
+		st.blockedUntil = now.Add(l.block)
+		return true, ErrKeyBlocked
+	}
+
+	return false, nil
+}
+
+// Unblock lifts the block of all the keys with the id and resets their rate.
+// It returns false if none was blocked.
+func (l *KeyLimiter) Unblock(id string) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	now := l.now()
+	found := false
+	for _, k := range l.keys.Keys() {
+		if k.(keyT).id != id {
+			continue
+		}
+		v, _ := l.keys.Peek(k)
+		if now.Before(v.(*keyStateT).blockedUntil) {
+			found = true
+		}
+		l.keys.Remove(k)
+	}
+	return found
+}
+
+// Blocked returns the keys currently blocked, ordered by id.
+func (l *KeyLimiter) Blocked() []BlockedKey {
+	if l == nil {
+		return nil
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	now := l.now()
+	byId := make(map[string]time.Time)
+	for _, k := range l.keys.Keys() {
+		v, _ := l.keys.Peek(k)
+		id := k.(keyT).id
+		if st := v.(*keyStateT); now.Before(st.blockedUntil) && st.blockedUntil.After(byId[id]) {
+			byId[id] = st.blockedUntil
+		}
+	}
+
+	blocked := make([]BlockedKey, 0, len(byId))
+	for id, until := range byId {
+		blocked = append(blocked, BlockedKey{Id: id, Until: until})
+	}
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].Id < blocked[j].Id })
+	return blocked
+}
+
+// sweep drops the keys that are neither blocked nor seen recently; called with
+// the lock held.
+func (l *KeyLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < kKeySweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for _, k := range l.keys.Keys() {
+		v, _ := l.keys.Peek(k)
+		if st := v.(*keyStateT); now.Sub(st.lastSeen) > l.idle && !now.Before(st.blockedUntil) {
+			l.keys.Remove(k)
+		}
+	}
+}
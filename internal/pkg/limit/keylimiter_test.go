@@ -0,0 +1,141 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package limit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyLimiter(now *time.Time) *KeyLimiter {
+	l := NewKeyLimiter(&config.KeyLimit{
+		Interval: time.Second,
+		Burst:    2,
+		Block:    time.Minute,
+	})
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestKeyLimiterBlocks(t *testing.T) {
+	now := time.Now()
+	l := newTestKeyLimiter(&now)
+
+	for i := 0; i < 2; i++ {
+		blocked, err := l.Allow("id", "secret")
+		require.NoError(t, err)
+		assert.False(t, blocked)
+	}
+
+	blocked, err := l.Allow("id", "secret")
+	assert.Equal(t, ErrKeyBlocked, err)
+	assert.True(t, blocked, "the request exceeding the rate blocks the key")
+
+	// Blocked even once the bucket refilled.
+	now = now.Add(30 * time.Second)
+	blocked, err = l.Allow("id", "secret")
+	assert.Equal(t, ErrKeyBlocked, err)
+	assert.False(t, blocked)
+
+	// Other keys are not affected.
+	_, err = l.Allow("other", "secret")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []BlockedKey{{Id: "id", Until: now.Add(-30 * time.Second).Add(time.Minute)}}, l.Blocked())
+
+	now = now.Add(31 * time.Second)
+	_, err = l.Allow("id", "secret")
+	assert.NoError(t, err)
+	assert.Empty(t, l.Blocked())
+}
+
+func TestKeyLimiterForgedSecret(t *testing.T) {
+	now := time.Now()
+	l := newTestKeyLimiter(&now)
+
+	for i := 0; i < 10; i++ {
+		l.Allow("id", "forged")
+	}
+	_, err := l.Allow("id", "forged")
+	require.Equal(t, ErrKeyBlocked, err)
+
+	// The flood of a forged secret does not block the key with the real one.
+	blocked, err := l.Allow("id", "secret")
+	assert.NoError(t, err)
+	assert.False(t, blocked)
+
+	// The id is reported once, and unblocking it lifts all its blocks.
+	for i := 0; i < 2; i++ {
+		l.Allow("id", "secret")
+	}
+	assert.Len(t, l.Blocked(), 1)
+	assert.True(t, l.Unblock("id"))
+	assert.Empty(t, l.Blocked())
+}
+
+func TestKeyLimiterUnblock(t *testing.T) {
+	now := time.Now()
+	l := newTestKeyLimiter(&now)
+
+	assert.False(t, l.Unblock("id"))
+
+	for i := 0; i < 3; i++ {
+		l.Allow("id", "secret")
+	}
+	require.Len(t, l.Blocked(), 1)
+
+	assert.True(t, l.Unblock("id"))
+	assert.Empty(t, l.Blocked())
+
+	_, err := l.Allow("id", "secret")
+	assert.NoError(t, err)
+}
+
+func TestKeyLimiterSweep(t *testing.T) {
+	now := time.Now()
+	l := newTestKeyLimiter(&now)
+
+	l.Allow("id", "secret")
+	require.Equal(t, 1, l.keys.Len())
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("other", "secret")
+	assert.Equal(t, 1, l.keys.Len(), "idle key is dropped")
+}
+
+func TestKeyLimiterDisabled(t *testing.T) {
+	l := NewKeyLimiter(&config.KeyLimit{})
+	assert.Nil(t, l)
+
+	blocked, err := l.Allow("id", "secret")
+	assert.NoError(t, err)
+	assert.False(t, blocked)
+	assert.False(t, l.Unblock("id"))
+	assert.Empty(t, l.Blocked())
+}
+
+func TestKeyLimiterBounded(t *testing.T) {
+	now := time.Now()
+	l := newTestKeyLimiter(&now)
+
+	for i := 0; i < 3; i++ {
+		l.Allow("id", "secret")
+	}
+	require.Len(t, l.Blocked(), 1)
+
+	for i := 0; i < kKeyLimiterMaxKeys; i++ {
+		l.Allow(strconv.Itoa(i), "secret")
+	}
+	assert.Equal(t, kKeyLimiterMaxKeys, l.keys.Len())
+	assert.Empty(t, l.Blocked(), "least recently seen key is dropped")
+}
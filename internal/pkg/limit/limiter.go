@@ -17,6 +17,7 @@ import (
 type Limiter struct {
 	rateLimit *rate.Limiter
 	maxLimit  *semaphore.Weighted
+	global    *globalRate
 }
 
 type ReleaseFunc func()
@@ -45,6 +46,18 @@ func NewLimiter(cfg *config.Limit) *Limiter {
 	return l
 }
 
+// NewGlobalLimiter returns a limiter that, when cfg is marked global, also
+// enforces the rate across the cluster through the named counter.
+func NewGlobalLimiter(name string, cfg *config.Limit, global *config.GlobalLimits, count CountFunc) *Limiter {
+	l := NewLimiter(cfg)
+
+	if cfg != nil && cfg.Global && cfg.Interval != time.Duration(0) && global != nil && global.Window != time.Duration(0) && count != nil {
+		l.global = newGlobalRate(name, cfg, global, count)
+	}
+
+	return l
+}
+
 func (l *Limiter) Acquire() (ReleaseFunc, error) {
 	releaseFunc := noop
 
@@ -52,6 +65,10 @@ func (l *Limiter) Acquire() (ReleaseFunc, error) {
 		return nil, ErrRateLimit
 	}
 
+	if l.global != nil && !l.global.Allow() {
+		return nil, ErrRateLimit
+	}
+
 	if l.maxLimit != nil {
 		if !l.maxLimit.TryAcquire(1) {
 			return nil, ErrMaxLimit
@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return tm
+	}
+
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2021-03-01T10:00:30Z", "2021-03-01T10:01:00Z"},
+		{"*/15 * * * *", "2021-03-01T10:01:00Z", "2021-03-01T10:15:00Z"},
+		{"0 22 * * 1-5", "2021-03-05T23:00:00Z", "2021-03-08T22:00:00Z"}, // Friday night to Monday
+		{"30 2 1 * *", "2021-03-01T03:00:00Z", "2021-04-01T02:30:00Z"},
+		{"0 0 * * 7", "2021-03-01T00:00:00Z", "2021-03-07T00:00:00Z"},  // 7 is Sunday
+		{"0 0 13 * 5", "2021-03-01T00:00:00Z", "2021-03-05T00:00:00Z"}, // the 13th or any Friday
+		{"0 0 29 2 *", "2021-03-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"0 1,13 * * *", "2021-03-01T02:00:00Z", "2021-03-01T13:00:00Z"},
+		{"10/20 * * * *", "2021-03-01T10:31:00Z", "2021-03-01T10:50:00Z"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			s, err := ParseSchedule(tc.expr)
+			require.NoError(t, err)
+			next, ok := s.Next(at(tc.from))
+			require.True(t, ok)
+			assert.Equal(t, at(tc.want), next)
+			assert.True(t, s.Matches(next))
+		})
+	}
+
+	s, err := ParseSchedule("0 0 30 2 *")
+	require.NoError(t, err)
+	_, ok := s.Next(at("2021-03-01T00:00:00Z"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package maintenance confines the disruptive background jobs of Fleet Server,
+// such as large purges, to maintenance windows so they do not compete with the
+// agents for Elasticsearch during business hours.
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Window opens at every minute matching its schedule and stays open for its
+// duration.
+type Window struct {
+	Schedule Schedule
+	Duration time.Duration
+}
+
+// Windows are the maintenance windows of the jobs. The nil Windows is always
+// open, so the jobs run at any time when no window is configured.
+type Windows struct {
+	loc     *time.Location
+	windows []Window
+	now     func() time.Time
+}
+
+// New returns the windows in the location; nil if there are none.
+func New(loc *time.Location, windows []Window) *Windows {
+	if len(windows) == 0 {
+		return nil
+	}
+	return &Windows{
+		loc:     loc,
+		windows: windows,
+		now:     time.Now,
+	}
+}
+
+// Open tells whether a window is open at t and, if so, until when.
+func (w *Windows) Open(t time.Time) (bool, time.Time) {
+	if w == nil {
+		return true, time.Time{}
+	}
+
+	t = t.In(w.loc)
+	var open bool
+	var until time.Time
+	for _, win := range w.windows {
+		// The starts within the duration before t; the latest one closes last.
+		start, ok := win.Schedule.Next(t.Add(-win.Duration))
+		for ok && !start.After(t) {
+			if end := start.Add(win.Duration); end.After(t) && end.After(until) {
+				open, until = true, end
+			}
+			start, ok = win.Schedule.Next(start)
+		}
+	}
+	return open, until
+}
+
+// NextOpen returns when the first window opens after t, and false if none
+// ever does.
+func (w *Windows) NextOpen(t time.Time) (time.Time, bool) {
+	if w == nil {
+		return t, true
+	}
+
+	t = t.In(w.loc)
+	var next time.Time
+	for _, win := range w.windows {
+		if start, ok := win.Schedule.Next(t); ok && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Wait returns once a window is open, or with the error of the context. The
+// job is logged as paused until then.
+func (w *Windows) Wait(ctx context.Context, job string) error {
+	if w == nil {
+		return ctx.Err()
+	}
+
+	for {
+		now := w.now()
+		if open, _ := w.Open(now); open {
+			return ctx.Err()
+		}
+
+		next, ok := w.NextOpen(now)
+		ev := log.Info().Str("job", job)
+		if ok {
+			ev.Time("until", next).Msg("Outside of the maintenance windows; job paused")
+		} else {
+			ev.Msg("No maintenance window ahead; job paused")
+		}
+
+		if !ok {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowsOpen(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Weeknights from 22:00 to 02:00, New York time.
+	s, err := ParseSchedule("0 22 * * 1-5")
+	require.NoError(t, err)
+	w := New(loc, []Window{{Schedule: s, Duration: 4 * time.Hour}})
+
+	local := func(day, hour, min int) time.Time {
+		return time.Date(2021, time.March, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		open  bool
+		until time.Time
+	}{
+		{"monday afternoon", local(1, 15, 0), false, time.Time{}},
+		{"monday night", local(1, 22, 0), true, local(2, 2, 0)},
+		{"after midnight", local(2, 1, 59), true, local(2, 2, 0)},
+		{"closed at the end", local(2, 2, 0), false, time.Time{}},
+		{"saturday night", local(6, 23, 0), false, time.Time{}},
+		{"in UTC", local(3, 23, 0).UTC(), true, local(4, 2, 0)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			open, until := w.Open(tc.at)
+			assert.Equal(t, tc.open, open)
+			assert.True(t, tc.until.Equal(until), "until %v, want %v", until, tc.until)
+		})
+	}
+
+	next, ok := w.NextOpen(local(5, 23, 0))
+	require.True(t, ok)
+	assert.True(t, local(8, 22, 0).Equal(next))
+}
+
+func TestWindowsNil(t *testing.T) {
+	var w *Windows
+	assert.Nil(t, New(time.UTC, nil))
+
+	open, _ := w.Open(time.Now())
+	assert.True(t, open)
+	require.NoError(t, w.Wait(context.Background(), "job"))
+}
+
+func TestWindowsWait(t *testing.T) {
+	s, err := ParseSchedule("* * * * *")
+	require.NoError(t, err)
+	w := New(time.UTC, []Window{{Schedule: s, Duration: time.Minute}})
+
+	// Closed until the next minute starts.
+	now := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC).Add(-50 * time.Millisecond)
+	calls := 0
+	w.now = func() time.Time {
+		calls++
+		if calls == 1 {
+			return now.Add(-time.Minute)
+		}
+		return now.Add(50 * time.Millisecond)
+	}
+	w.windows[0].Duration = 30 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, w.Wait(ctx, "job"))
+	assert.Equal(t, 2, calls)
+
+	// A window that never opens waits for the context.
+	never, err := ParseSchedule("0 0 30 2 *")
+	require.NoError(t, err)
+	w = New(time.UTC, []Window{{Schedule: never, Duration: time.Hour}})
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, w.Wait(ctx, "job"))
+}
@@ -6,6 +6,25 @@ package model
 
 import "time"
 
+// Upload status values.
+const (
+	UploadStatusUploading = "UPLOADING"
+	UploadStatusReady     = "READY"
+	UploadStatusFail      = "FAIL"
+)
+
+// Dead letter status values.
+const (
+	DeadLetterStatusPending = "PENDING"
+	DeadLetterStatusRetried = "RETRIED"
+)
+
+// Enrollment event outcomes.
+const (
+	EnrollmentOutcomeSuccess = "success"
+	EnrollmentOutcomeFailure = "failure"
+)
+
 // Time returns the time for the current leader.
 func (m *PolicyLeader) Time() (time.Time, error) {
 	return time.Parse(time.RFC3339Nano, m.Timestamp)
@@ -25,3 +44,32 @@ func (m *Server) Time() (time.Time, error) {
 func (m *Server) SetTime(t time.Time) {
 	m.Timestamp = t.Format(time.RFC3339Nano)
 }
+
+// Kibana spaces.
+const (
+	// DefaultSpace is the space of the documents without namespaces.
+	DefaultSpace = "default"
+
+	// AllSpaces is the namespace of the documents shared by all spaces.
+	AllSpaces = "*"
+)
+
+// Spaces returns the spaces of the namespaces of a document.
+func Spaces(namespaces []string) []string {
+	if len(namespaces) == 0 {
+		return []string{DefaultSpace}
+	}
+	return namespaces
+}
+
+// SameSpace tells whether the documents with the namespaces share a space.
+func SameSpace(a, b []string) bool {
+	for _, x := range Spaces(a) {
+		for _, y := range Spaces(b) {
+			if x == y || x == AllSpaces || y == AllSpaces {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameSpace(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, nil, true},
+		{nil, []string{DefaultSpace}, true},
+		{nil, []string{"team-a"}, false},
+		{[]string{"team-a"}, []string{"team-b", "team-a"}, true},
+		{[]string{"team-a"}, []string{"team-b"}, false},
+		{[]string{AllSpaces}, []string{"team-b"}, true},
+		{nil, []string{AllSpaces}, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, SameSpace(tt.a, tt.b), "%v, %v", tt.a, tt.b)
+		assert.Equal(t, tt.want, SameSpace(tt.b, tt.a), "%v, %v", tt.b, tt.a)
+	}
+}
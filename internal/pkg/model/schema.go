@@ -34,7 +34,8 @@ type Action struct {
 	ESDocument
 
 	// The unique identifier for the Elastic Agent action. There could be multiple documents with the same action_id if the action is split into two separate documents.
-	ActionId string `json:"action_id,omitempty"`
+	ActionId             string                 `json:"action_id,omitempty"`
+	AdditionalProperties map[string]interface{} `json:"-"`
 
 	// The Agent IDs the action is intended for. No support for json.RawMessage with the current generator. Could be useful to lazy parse the agent ids
 	Agents []string `json:"agents,omitempty"`
@@ -48,6 +49,12 @@ type Action struct {
 	// The input type the actions should be routed to.
 	InputType string `json:"input_type,omitempty"`
 
+	// The delivery priority of the action; actions of higher priority are delivered first. Defaults to the priority of the action type.
+	Priority int64 `json:"priority,omitempty"`
+
+	// The signature of the action by its writer: the base64 encoded data signed and the base64 encoded signature. The agents verify it before running the action.
+	Signed json.RawMessage `json:"signed,omitempty"`
+
 	// Date/time the action was created
 	Timestamp string `json:"@timestamp,omitempty"`
 
@@ -82,19 +89,26 @@ type ActionResult struct {
 	Data json.RawMessage `json:"data,omitempty"`
 
 	// The action error message.
-	Error string `json:"error,omitempty"`
+	Error string        `json:"error,omitempty"`
+	File  *FileMetadata `json:"file,omitempty"`
 
 	// Date/time the action was started
 	StartedAt string `json:"started_at,omitempty"`
 
 	// Date/time the action was created
 	Timestamp string `json:"@timestamp,omitempty"`
+
+	// The ID of the file uploaded as part of the action result.
+	UploadId string `json:"upload_id,omitempty"`
 }
 
 // Agent An Elastic Agent that has enrolled into Fleet
 type Agent struct {
 	ESDocument
 
+	// SHA-256 of the secret of the access API key, proving the Elastic Agent holds the key when it is reissued
+	AccessApiKeyHash string `json:"access_api_key_hash,omitempty"`
+
 	// ID of the API key the Elastic Agent must used to contact Fleet Server
 	AccessApiKeyId string `json:"access_api_key_id,omitempty"`
 
@@ -102,8 +116,21 @@ type Agent struct {
 	ActionSeqNo []int64 `json:"action_seq_no,omitempty"`
 
 	// Active flag
-	Active bool           `json:"active"`
-	Agent  *AgentMetadata `json:"agent,omitempty"`
+	Active               bool                   `json:"active"`
+	AdditionalProperties map[string]interface{} `json:"-"`
+	Agent                *AgentMetadata         `json:"agent,omitempty"`
+
+	// Seconds the clock of the Elastic Agent was ahead of the one of Fleet Server at its last checkin, negative when behind
+	ClockSkew int64 `json:"clock_skew,omitempty"`
+
+	// The components last reported by the Elastic Agent with the status of their units, stored as reported but not indexed so their free-form fields do not grow the mapping
+	Components json.RawMessage `json:"components,omitempty"`
+
+	// Hash of the components last indexed into the component inventory for the Elastic Agent
+	ComponentsHash string `json:"components_hash,omitempty"`
+
+	// Searchable summary of the components last reported by the Elastic Agent
+	ComponentsSummary *ComponentsSummary `json:"components_summary,omitempty"`
 
 	// API key the Elastic Agent uses to authenticate with elasticsearch
 	DefaultApiKey string `json:"default_api_key,omitempty"`
@@ -114,6 +141,9 @@ type Agent struct {
 	// Date/time the Elastic Agent enrolled
 	EnrolledAt string `json:"enrolled_at"`
 
+	// ID of the enrollment API key the Elastic Agent enrolled with
+	EnrollmentApiKeyId string `json:"enrollment_api_key_id,omitempty"`
+
 	// Date/time the Elastic Agent checked in last time
 	LastCheckin string `json:"last_checkin,omitempty"`
 
@@ -126,12 +156,24 @@ type Agent struct {
 	// Local metadata information for the Elastic Agent
 	LocalMetadata json.RawMessage `json:"local_metadata,omitempty"`
 
+	// Whether the local metadata reported by the Elastic Agent exceeded the limits and was truncated
+	LocalMetadataTruncated bool `json:"local_metadata_truncated,omitempty"`
+
+	// The Kibana spaces the Elastic Agent belongs to; the default space when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Date/time the Elastic Agent was found assigned to a policy that no longer exists
+	OrphanedAt string `json:"orphaned_at,omitempty"`
+
 	// Packages array
 	Packages []string `json:"packages,omitempty"`
 
 	// The current policy coordinator for the Elastic Agent
 	PolicyCoordinatorIdx int64 `json:"policy_coordinator_idx,omitempty"`
 
+	// The last policy change dispatched to the Elastic Agent, verified against the hash it acks
+	PolicyDispatched *PolicyDispatched `json:"policy_dispatched,omitempty"`
+
 	// The policy ID for the Elastic Agent
 	PolicyId string `json:"policy_id,omitempty"`
 
@@ -141,15 +183,27 @@ type Agent struct {
 	// The current policy revision_idx for the Elastic Agent
 	PolicyRevisionIdx int64 `json:"policy_revision_idx,omitempty"`
 
+	// Why the Elastic Agent was quarantined, e.g. key_blocked or the reason given by the operator
+	QuarantineReason string `json:"quarantine_reason,omitempty"`
+
+	// Date/time the Elastic Agent was quarantined; while set it only receives unenroll and diagnostics actions, and no policy
+	QuarantinedAt string `json:"quarantined_at,omitempty"`
+
 	// Shared ID
 	SharedId string `json:"shared_id,omitempty"`
 
+	// Tags of the Elastic Agent
+	Tags []string `json:"tags,omitempty"`
+
 	// Type
 	Type string `json:"type"`
 
 	// Date/time the Elastic Agent unenrolled
 	UnenrolledAt string `json:"unenrolled_at,omitempty"`
 
+	// Why the Elastic Agent was unenrolled by Fleet Server, e.g. auth_failures
+	UnenrolledReason string `json:"unenrolled_reason,omitempty"`
+
 	// Date/time the Elastic Agent unenrolled started
 	UnenrollmentStartedAt string `json:"unenrollment_started_at,omitempty"`
 
@@ -166,6 +220,44 @@ type Agent struct {
 	UserProvidedMetadata json.RawMessage `json:"user_provided_metadata,omitempty"`
 }
 
+// AgentComponent A component run by an Elastic Agent, as last reported on checkin; indexed into the component inventory when the components of the agent change
+type AgentComponent struct {
+	ESDocument
+
+	// The ID of the Elastic Agent running the component
+	AgentId string `json:"agent_id"`
+
+	// The version of the Elastic Agent running the component
+	AgentVersion string `json:"agent_version,omitempty"`
+
+	// The ID of the component
+	ComponentId string `json:"component_id"`
+
+	// The type of the component, the input or output it runs
+	ComponentType string `json:"component_type,omitempty"`
+
+	// The status message of the component
+	Message string `json:"message,omitempty"`
+
+	// The policy of the Elastic Agent
+	PolicyId string `json:"policy_id,omitempty"`
+
+	// The health of the component
+	Status string `json:"status,omitempty"`
+
+	// Date/time the components of the agent were reported
+	Timestamp string `json:"@timestamp,omitempty"`
+
+	// The IDs of the units of the component that are not healthy
+	UnhealthyUnits []string `json:"unhealthy_units,omitempty"`
+
+	// The types of the units of the component
+	UnitTypes []string `json:"unit_types,omitempty"`
+
+	// The version of the component
+	Version string `json:"version,omitempty"`
+}
+
 // AgentMetadata An Elastic Agent metadata
 type AgentMetadata struct {
 
@@ -215,10 +307,82 @@ type Artifact struct {
 type Body struct {
 }
 
+// Components The components last reported by the Elastic Agent with the status of their units, stored as reported but not indexed so their free-form fields do not grow the mapping
+type Components struct {
+}
+
+// ComponentsSummary Searchable summary of the components last reported by the Elastic Agent
+type ComponentsSummary struct {
+
+	// The number of components
+	Total int64 `json:"total,omitempty"`
+
+	// The types of the components
+	Types []string `json:"types,omitempty"`
+
+	// The number of components not healthy or with units not healthy
+	Unhealthy int64 `json:"unhealthy,omitempty"`
+
+	// The IDs of the components not healthy or with units not healthy
+	UnhealthyComponents []string `json:"unhealthy_components,omitempty"`
+}
+
 // Data The opaque payload.
 type Data struct {
 }
 
+// DeadLetter A document Fleet Server could not process, kept for inspection and retry
+type DeadLetter struct {
+	ESDocument
+
+	// The ID of the original document
+	DocId string `json:"doc_id"`
+
+	// The error encountered processing the document
+	Error string `json:"error"`
+
+	// The index the document was read from
+	Index string `json:"index"`
+
+	// Date/time the document was written back to its index
+	RetriedAt string `json:"retried_at,omitempty"`
+
+	// The sequence number of the original document
+	SeqNo int64 `json:"seq_no,omitempty"`
+
+	// The source of the original document
+	Source json.RawMessage `json:"source,omitempty"`
+
+	// The status of the dead letter
+	Status string `json:"status"`
+
+	// Date/time the document was dead-lettered
+	Timestamp string `json:"@timestamp,omitempty"`
+}
+
+// DispatchEntry A checkin response that sent actions to an Elastic Agent, recorded into the dispatch journal
+type DispatchEntry struct {
+	ESDocument
+
+	// The IDs of the actions sent, in the order of the response
+	ActionIds []string `json:"action_ids,omitempty"`
+
+	// The ID of the Elastic Agent the response was sent to
+	AgentId string `json:"agent_id"`
+
+	// The hash of the policy sent
+	PolicyHash string `json:"policy_hash,omitempty"`
+
+	// The ID of the policy change sent, naming the policy revision; empty when none was
+	PolicyRevision string `json:"policy_revision,omitempty"`
+
+	// Size of the response sent, in bytes
+	ResponseBytes int64 `json:"response_bytes,omitempty"`
+
+	// Date/time the response was sent
+	Timestamp string `json:"@timestamp"`
+}
+
 // EnrollmentApiKey An Elastic Agent enrollment API key
 type EnrollmentApiKey struct {
 	ESDocument
@@ -235,9 +399,60 @@ type EnrollmentApiKey struct {
 	ExpireAt  string `json:"expire_at,omitempty"`
 
 	// Enrollment key name
-	Name      string `json:"name,omitempty"`
-	PolicyId  string `json:"policy_id,omitempty"`
-	UpdatedAt string `json:"updated_at,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// The Kibana spaces the enrollment key belongs to; the default space when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	PolicyId   string   `json:"policy_id,omitempty"`
+	UpdatedAt  string   `json:"updated_at,omitempty"`
+}
+
+// EnrollmentEvent An enrollment attempt of an Elastic Agent, recorded into the enrollment history
+type EnrollmentEvent struct {
+	ESDocument
+
+	// The ID given to the Elastic Agent; empty when the enrollment failed before
+	AgentId string `json:"agent_id,omitempty"`
+
+	// The ID of the enrollment API key used
+	EnrollmentApiKeyId string `json:"enrollment_api_key_id,omitempty"`
+
+	// Why the enrollment failed
+	Error string `json:"error,omitempty"`
+
+	// Time taken to serve the enrollment request, in milliseconds
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+
+	// success or failure
+	Outcome string `json:"outcome"`
+
+	// The policy of the enrollment API key
+	PolicyId string `json:"policy_id,omitempty"`
+
+	// The address the enrollment request came from
+	SourceIp string `json:"source_ip,omitempty"`
+
+	// Date/time of the enrollment attempt
+	Timestamp string `json:"@timestamp"`
+
+	// The user agent of the enrollment request
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// FileMetadata The metadata of a file uploaded by an Elastic Agent
+type FileMetadata struct {
+
+	// The MIME type of the file
+	MimeType string `json:"mime_type,omitempty"`
+
+	// The name of the file
+	Name string `json:"name"`
+
+	// SHA256 of the file contents
+	Sha256 string `json:"sha256,omitempty"`
+
+	// The size of the file in bytes
+	Size int64 `json:"size"`
 }
 
 // HostMetadata The host metadata for the Elastic Agent
@@ -263,6 +478,7 @@ type LocalMetadata struct {
 // Policy A policy that an Elastic Agent is attached to
 type Policy struct {
 	ESDocument
+	AdditionalProperties map[string]interface{} `json:"-"`
 
 	// The coordinator index of the policy
 	CoordinatorIdx int64 `json:"coordinator_idx"`
@@ -273,6 +489,9 @@ type Policy struct {
 	// True when this policy is the default policy to start Fleet Server
 	DefaultFleetServer bool `json:"default_fleet_server"`
 
+	// The Kibana spaces the policy belongs to; the default space when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+
 	// The ID of the policy
 	PolicyId string `json:"policy_id"`
 
@@ -283,6 +502,19 @@ type Policy struct {
 	Timestamp string `json:"@timestamp,omitempty"`
 }
 
+// PolicyDispatched The last policy change dispatched to the Elastic Agent, verified against the hash it acks
+type PolicyDispatched struct {
+
+	// The id of the POLICY_CHANGE action
+	ActionId string `json:"action_id,omitempty"`
+
+	// The number of times the policy change was dispatched, capping the dispatches of a policy acked with another hash
+	Attempts int64 `json:"attempts,omitempty"`
+
+	// Hex SHA-256 of the policy data dispatched
+	Hash string `json:"hash,omitempty"`
+}
+
 // PolicyLeader The current leader Fleet Server for a policy
 type PolicyLeader struct {
 	ESDocument
@@ -292,12 +524,33 @@ type PolicyLeader struct {
 	Timestamp string `json:"@timestamp,omitempty"`
 }
 
+// RateLimit The count of the requests accepted by all Fleet Servers in a window of a global limit
+type RateLimit struct {
+	ESDocument
+
+	// The number of requests accepted in the window
+	Count int64 `json:"count"`
+
+	// The name of the limit
+	Name string `json:"name"`
+
+	// Date/time the counter was last updated
+	Timestamp string `json:"@timestamp,omitempty"`
+
+	// The number of the window since the epoch the count applies to
+	Window int64 `json:"window"`
+}
+
 // Server A Fleet Server
 type Server struct {
 	ESDocument
-	Agent  *AgentMetadata  `json:"agent"`
-	Host   *HostMetadata   `json:"host"`
-	Server *ServerMetadata `json:"server"`
+	Agent   *AgentMetadata  `json:"agent"`
+	Host    *HostMetadata   `json:"host"`
+	Restart *ServerRestart  `json:"restart,omitempty"`
+	Server  *ServerMetadata `json:"server"`
+
+	// The health status of the server when it was updated
+	Status string `json:"status,omitempty"`
 
 	// Date/time the server was updated
 	Timestamp string `json:"@timestamp,omitempty"`
@@ -313,6 +566,83 @@ type ServerMetadata struct {
 	Version string `json:"version"`
 }
 
+// ServerRestart The part of a Fleet Server in a rolling restart
+type ServerRestart struct {
+
+	// Date/time the rolling restart was requested
+	RequestedAt string `json:"requested_at,omitempty"`
+
+	// The ID of the rolling restart
+	RequestedId string `json:"requested_id"`
+
+	// The state of the server in the rolling restart: pending, draining, restarting or done
+	State string `json:"state"`
+
+	// Date/time the state was updated
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// Signed The signature of the action by its writer: the base64 encoded data signed and the base64 encoded signature. The agents verify it before running the action.
+type Signed struct {
+}
+
+// Source The source of the original document
+type Source struct {
+}
+
+// Upload A file upload from an Elastic Agent
+type Upload struct {
+	ESDocument
+
+	// The ID of the action the upload belongs to
+	ActionId string `json:"action_id"`
+
+	// The ID of the Elastic Agent that uploads the file
+	AgentId string `json:"agent_id"`
+
+	// The size of the chunks of the upload in bytes, the last one excepted
+	ChunkSize int64 `json:"chunk_size,omitempty"`
+
+	// The reason the upload failed
+	Error string        `json:"error,omitempty"`
+	File  *FileMetadata `json:"file"`
+
+	// The status of the upload
+	Status string `json:"status"`
+
+	// The storage backend the chunks of the upload are written to
+	Storage string `json:"storage,omitempty"`
+
+	// Date/time the upload was started
+	Timestamp string `json:"@timestamp,omitempty"`
+
+	// Date/time a chunk of the upload was last written
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// UploadChunk A chunk of a file upload, in the order of the file; its bytes are stored on the chunk or by the storage backend of the upload
+type UploadChunk struct {
+	ESDocument
+
+	// The ID of the upload the chunk belongs to
+	Bid string `json:"bid"`
+
+	// The position of the chunk in the file, from 0
+	Chunk int64 `json:"chunk"`
+
+	// The bytes of the chunk, base64 encoded, when stored in Elasticsearch
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// SHA256 of the bytes of the chunk, hex encoded
+	Sha2 string `json:"sha2"`
+
+	// The size of the chunk in bytes
+	Size int64 `json:"size"`
+
+	// Date/time the chunk was written
+	Timestamp string `json:"@timestamp,omitempty"`
+}
+
 // UserProvidedMetadata User provided metadata information for the Elastic Agent
 type UserProvidedMetadata struct {
 }
@@ -0,0 +1,156 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Documents are written by Kibana as well as Fleet Server. A Fleet Server that
+// is behind Kibana does not know about newly added fields; the fields are kept
+// in AdditionalProperties on decode and written back on encode, so a
+// read-modify-write of the document does not strip them. AdditionalProperties
+// is generated from the additionalProperties of model/schema.json; the fields
+// are kept as json.RawMessage so they are written back byte for byte.
+
+func (m *Action) UnmarshalJSON(data []byte) error {
+	type action Action
+	return unmarshalPreserve(data, (*action)(m), &m.AdditionalProperties)
+}
+
+func (m Action) MarshalJSON() ([]byte, error) {
+	type action Action
+	return marshalPreserve((*action)(&m), m.AdditionalProperties)
+}
+
+func (m *Agent) UnmarshalJSON(data []byte) error {
+	type agent Agent
+	return unmarshalPreserve(data, (*agent)(m), &m.AdditionalProperties)
+}
+
+func (m Agent) MarshalJSON() ([]byte, error) {
+	type agent Agent
+	return marshalPreserve((*agent)(&m), m.AdditionalProperties)
+}
+
+func (m *Policy) UnmarshalJSON(data []byte) error {
+	type policy Policy
+	return unmarshalPreserve(data, (*policy)(m), &m.AdditionalProperties)
+}
+
+func (m Policy) MarshalJSON() ([]byte, error) {
+	type policy Policy
+	return marshalPreserve((*policy)(&m), m.AdditionalProperties)
+}
+
+// knownFields caches the JSON names of the fields of a struct type.
+var knownFields sync.Map // reflect.Type -> map[string]struct{}
+
+func fieldNames(t reflect.Type) map[string]struct{} {
+	if v, ok := knownFields.Load(t); ok {
+		return v.(map[string]struct{})
+	}
+
+	names := make(map[string]struct{})
+	collectFieldNames(t, names)
+	knownFields.Store(t, names)
+	return names
+}
+
+func collectFieldNames(t reflect.Type, names map[string]struct{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			collectFieldNames(f.Type, names)
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = struct{}{}
+	}
+}
+
+// unmarshalPreserve decodes data into v and stores the top level fields that
+// do not map to a field of v into extra, as json.RawMessage.
+func unmarshalPreserve(data []byte, v interface{}, extra *map[string]interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	known := fieldNames(reflect.TypeOf(v).Elem())
+	*extra = nil
+	for name, value := range fields {
+		if _, ok := known[name]; ok {
+			continue
+		}
+		if *extra == nil {
+			*extra = make(map[string]interface{})
+		}
+		(*extra)[name] = value
+	}
+	return nil
+}
+
+// marshalPreserve encodes v and appends the extra fields that are not defined
+// by v. The extra fields are written in sorted order to keep the output stable.
+func marshalPreserve(v interface{}, extra map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	known := fieldNames(reflect.TypeOf(v).Elem())
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		if _, ok := known[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return data, nil
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 64*len(names))
+	buf.Write(data[:len(data)-1])
+	comma := len(data) > 2
+	for _, name := range names {
+		if comma {
+			buf.WriteByte(',')
+		}
+		comma = true
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(extra[name])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
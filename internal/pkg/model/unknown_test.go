@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyPreservesUnknownFields(t *testing.T) {
+	src := `{"policy_id":"p1","revision_idx":2,"coordinator_idx":0,"data":{"id":"p1"},"default_fleet_server":false,"space_id":"default","tags":["a","b"]}`
+
+	var p Policy
+	require.NoError(t, json.Unmarshal([]byte(src), &p))
+	assert.Equal(t, "p1", p.PolicyId)
+	assert.Equal(t, int64(2), p.RevisionIdx)
+	assert.Equal(t, map[string]interface{}{
+		"space_id": json.RawMessage(`"default"`),
+		"tags":     json.RawMessage(`["a","b"]`),
+	}, p.AdditionalProperties)
+
+	// read-modify-write as done by the coordinator
+	p.CoordinatorIdx = 1
+	data, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "default", got["space_id"])
+	assert.Equal(t, []interface{}{"a", "b"}, got["tags"])
+	assert.Equal(t, float64(1), got["coordinator_idx"])
+}
+
+func TestActionWithoutUnknownFields(t *testing.T) {
+	src := `{"action_id":"a1","type":"UPGRADE","agents":["x"]}`
+
+	var a Action
+	require.NoError(t, json.Unmarshal([]byte(src), &a))
+	assert.Nil(t, a.AdditionalProperties)
+
+	data, err := json.Marshal(&a)
+	require.NoError(t, err)
+	assert.JSONEq(t, src, string(data))
+}
+
+func TestAgentExtraDoesNotOverrideKnownFields(t *testing.T) {
+	a := Agent{
+		Active: true,
+		AdditionalProperties: map[string]interface{}{
+			"active":    json.RawMessage(`false`),
+			"namespace": "ns",
+		},
+	}
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"active":true,"enrolled_at":"","type":"","namespace":"ns"}`, string(data))
+}
@@ -24,9 +24,12 @@ import (
 )
 
 const (
-	defaultPollTimeout    = 4 * time.Minute // default long poll timeout
-	defaultSeqNo          = int64(-1)       // the _seq_no in elasticsearch start with 0
-	defaultWithExpiration = false
+	defaultPollTimeout     = 4 * time.Minute // default long poll timeout
+	defaultSeqNo           = int64(-1)       // the _seq_no in elasticsearch start with 0
+	defaultWithExpiration  = false
+	defaultWaitForAdvance  = true
+	defaultMinPollInterval = 250 * time.Millisecond
+	defaultMaxPollInterval = 10 * time.Second
 
 	// Making the default fetch size larger, in order to increase the throughput of the monitor.
 	// This is configurable as well, so can be adjusted based on the memory size of the container if needed.
@@ -42,14 +45,20 @@ const (
 	// 2. Any other error waiting on global checkpoint, except timeouts.
 	// For the long poll timeout, start a new request as soon as possible.
 	retryDelay = 3 * time.Second
+
+	// How long the point in time of a fetch is kept between its pages.
+	pitKeepAlive = "1m"
 )
 
 const (
 	seqNoPrimaryTerm = "seq_no_primary_term"
 
-	fieldSeqNo      = "_seq_no"
-	fieldMaxSeqNo   = "max_seq_no"
-	fieldExpiration = "expiration"
+	fieldSeqNo       = "_seq_no"
+	fieldMaxSeqNo    = "max_seq_no"
+	fieldExpiration  = "expiration"
+	fieldPIT         = "pit"
+	fieldPITId       = "pit_id"
+	fieldSearchAfter = "search_after"
 )
 
 type HitT struct {
@@ -88,17 +97,26 @@ type SimpleMonitor interface {
 	Output() <-chan []es.HitT
 }
 
-// simpleMonitorT monitors for new documents in an index
+// simpleMonitorT monitors for new documents in an index. It long polls
+// Elasticsearch for the global checkpoint of the index to advance or, when
+// not waiting for advance, polls it, quickly while it advances and backing off
+// while it does not. The documents up to the checkpoint are then fetched from
+// a point in time of the index, paging with search_after on their _seq_no.
 type simpleMonitorT struct {
-	esCli     *elasticsearch.Client
-	monCli    *elasticsearch.Client
-	tmplCheck *dsl.Tmpl
-	tmplQuery *dsl.Tmpl
-
-	index          string
-	pollTimeout    time.Duration
-	withExpiration bool
-	fetchSize      int
+	esCli          *elasticsearch.Client
+	monCli         *elasticsearch.Client
+	tmplCheck      *dsl.Tmpl
+	tmplQuery      *dsl.Tmpl
+	tmplQueryAfter *dsl.Tmpl
+
+	index           string
+	pollTimeout     time.Duration
+	withExpiration  bool
+	fetchSize       int
+	waitForAdvance  bool
+	minPollInterval time.Duration
+	maxPollInterval time.Duration
+	pollInterval    time.Duration // current, between minPollInterval and maxPollInterval
 
 	checkpoint sqn.SeqNo    // index global checkpoint
 	mx         sync.RWMutex // checkpoint mutex
@@ -117,19 +135,23 @@ type Option func(SimpleMonitor)
 func NewSimple(index string, esCli, monCli *elasticsearch.Client, opts ...Option) (SimpleMonitor, error) {
 
 	m := &simpleMonitorT{
-		index:          index,
-		esCli:          esCli,
-		monCli:         monCli,
-		pollTimeout:    defaultPollTimeout,
-		withExpiration: defaultWithExpiration,
-		fetchSize:      defaultFetchSize,
-		checkpoint:     sqn.DefaultSeqNo,
-		outCh:          make(chan []es.HitT, 1),
+		index:           es.ResolveIndex(index), // not accessed through the bulker
+		esCli:           esCli,
+		monCli:          monCli,
+		pollTimeout:     defaultPollTimeout,
+		withExpiration:  defaultWithExpiration,
+		fetchSize:       defaultFetchSize,
+		waitForAdvance:  defaultWaitForAdvance,
+		minPollInterval: defaultMinPollInterval,
+		maxPollInterval: defaultMaxPollInterval,
+		checkpoint:      sqn.DefaultSeqNo,
+		outCh:           make(chan []es.HitT, 1),
 	}
 
 	for _, opt := range opts {
 		opt(m)
 	}
+	m.pollInterval = m.minPollInterval
 
 	m.log = log.With().Str("index", m.index).Str("ctx", "index monitor").Logger()
 
@@ -139,12 +161,18 @@ func NewSimple(index string, esCli, monCli *elasticsearch.Client, opts ...Option
 	}
 	m.tmplCheck = tmplCheck
 
-	tmplQuery, err := m.prepareQuery()
+	tmplQuery, err := m.prepareQuery(false)
 	if err != nil {
 		return nil, err
 	}
 	m.tmplQuery = tmplQuery
 
+	tmplQueryAfter, err := m.prepareQuery(true)
+	if err != nil {
+		return nil, err
+	}
+	m.tmplQueryAfter = tmplQueryAfter
+
 	return m, nil
 }
 
@@ -164,6 +192,24 @@ func WithPollTimeout(to time.Duration) Option {
 	}
 }
 
+// WithWaitForAdvance long polls Elasticsearch for the global checkpoint to
+// advance, the default, or polls it when false
+func WithWaitForAdvance(waitForAdvance bool) Option {
+	return func(m SimpleMonitor) {
+		m.(*simpleMonitorT).waitForAdvance = waitForAdvance
+	}
+}
+
+// WithPollInterval sets the bounds of the global checkpoint polling interval
+func WithPollInterval(min, max time.Duration) Option {
+	return func(m SimpleMonitor) {
+		if min > 0 && max >= min {
+			m.(*simpleMonitorT).minPollInterval = min
+			m.(*simpleMonitorT).maxPollInterval = max
+		}
+	}
+}
+
 // WithExpiration sets adds the expiration field to the monitor query
 func WithExpiration(withExpiration bool) Option {
 	return func(m SimpleMonitor) {
@@ -233,7 +279,7 @@ func (m *simpleMonitorT) Run(ctx context.Context) (err error) {
 		checkpoint := m.loadCheckpoint()
 
 		// Wait checkpoint advance
-		newCheckpoint, err := waitCheckpointAdvance(ctx, m.monCli, m.index, checkpoint, m.pollTimeout)
+		newCheckpoint, err := m.waitCheckpoint(ctx, checkpoint)
 		if err != nil {
 			if errors.Is(err, es.ErrIndexNotFound) {
 				// Wait until created
@@ -255,18 +301,81 @@ func (m *simpleMonitorT) Run(ctx context.Context) (err error) {
 		}
 
 		// Fetch up to known checkpoint
-		count := m.fetchSize
-		for count == m.fetchSize {
-			hits, err := m.fetch(ctx, newCheckpoint)
-			if err != nil {
-				m.log.Error().Err(err).Msg("failed checking new documents")
-				break
-			}
-			count = m.notify(ctx, hits)
+		if err := m.fetchAll(ctx, newCheckpoint); err != nil {
+			m.log.Error().Err(err).Msg("failed checking new documents")
 		}
 	}
 }
 
+func (m *simpleMonitorT) waitCheckpoint(ctx context.Context, checkpoint sqn.SeqNo) (sqn.SeqNo, error) {
+	if m.waitForAdvance {
+		return waitCheckpointAdvance(ctx, m.monCli, m.index, checkpoint, m.pollTimeout)
+	}
+	return m.pollCheckpointAdvance(ctx, checkpoint)
+}
+
+// pollCheckpointAdvance polls the global checkpoint until it advances past
+// checkpoint. The polling interval doubles on each poll the checkpoint does
+// not advance, up to the max, and is reset to the min once it does.
+func (m *simpleMonitorT) pollCheckpointAdvance(ctx context.Context, checkpoint sqn.SeqNo) (sqn.SeqNo, error) {
+	for {
+		newCheckpoint, err := queryGlobalCheckpoint(ctx, m.monCli, m.index)
+		if err != nil {
+			return nil, err
+		}
+		if newCheckpoint.Value() > checkpoint.Value() {
+			m.pollInterval = m.minPollInterval
+			return newCheckpoint, nil
+		}
+
+		if err := sleep.WithContext(ctx, m.pollInterval); err != nil {
+			return nil, err
+		}
+		m.pollInterval = nextPollInterval(m.pollInterval, m.maxPollInterval)
+	}
+}
+
+func nextPollInterval(cur, max time.Duration) time.Duration {
+	if next := 2 * cur; next < max {
+		return next
+	}
+	return max
+}
+
+// fetchAll notifies the documents up to maxCheckpoint, paging through a point
+// in time of the index.
+func (m *simpleMonitorT) fetchAll(ctx context.Context, maxCheckpoint sqn.SeqNo) error {
+	pitId, err := dl.OpenPIT(ctx, m.esCli, m.index, pitKeepAlive)
+	if errors.Is(err, es.ErrIndexNotFound) {
+		m.log.Debug().Str("index", m.index).Msg(es.ErrIndexNotFound.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Expires after the keep alive if not closed
+		if err := dl.ClosePIT(ctx, m.esCli, pitId); err != nil {
+			m.log.Debug().Err(err).Msg("failed closing point in time")
+		}
+	}()
+
+	var after json.RawMessage
+	count := m.fetchSize
+	for count == m.fetchSize {
+		var hits []es.HitT
+		hits, pitId, err = m.fetch(ctx, pitId, after, maxCheckpoint)
+		if err != nil {
+			return err
+		}
+		count = m.notify(ctx, hits)
+		if count > 0 {
+			after = hits[count-1].Sort
+		}
+	}
+	return nil
+}
+
 func (m *simpleMonitorT) notify(ctx context.Context, hits []es.HitT) int {
 	sz := len(hits)
 	if sz > 0 {
@@ -281,67 +390,63 @@ func (m *simpleMonitorT) notify(ctx context.Context, hits []es.HitT) int {
 	return 0
 }
 
-func (m *simpleMonitorT) fetch(ctx context.Context, maxCheckpoint sqn.SeqNo) ([]es.HitT, error) {
+// fetch returns the page of documents after the sort values of the last
+// document of the previous page, or after the checkpoint for the first page,
+// and the point in time to fetch the next page from.
+func (m *simpleMonitorT) fetch(ctx context.Context, pitId string, after json.RawMessage, maxCheckpoint sqn.SeqNo) ([]es.HitT, string, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	checkpoint := m.loadCheckpoint()
-
-	// Run check query that detects that there are new documents available
 	params := map[string]interface{}{
-		dl.FieldSeqNo:    checkpoint.Value(),
 		dl.FieldMaxSeqNo: maxCheckpoint.Value(),
+		fieldPITId:       pitId,
+	}
+	tmpl := m.tmplQuery
+	if after != nil {
+		params[fieldSearchAfter] = after
+		tmpl = m.tmplQueryAfter
+	} else {
+		params[dl.FieldSeqNo] = m.loadCheckpoint().Value()
 	}
 	if m.withExpiration {
 		params[dl.FieldExpiration] = now
 	}
 
-	hits, err := m.search(ctx, m.tmplQuery, params)
-	if err != nil {
-		return nil, err
-	}
-
-	return hits, nil
+	return m.search(ctx, tmpl, params)
 }
 
-func (m *simpleMonitorT) search(ctx context.Context, tmpl *dsl.Tmpl, params map[string]interface{}) ([]es.HitT, error) {
+// search runs the query against the point in time it sets, without naming the
+// index.
+func (m *simpleMonitorT) search(ctx context.Context, tmpl *dsl.Tmpl, params map[string]interface{}) ([]es.HitT, string, error) {
 	query, err := tmpl.Render(params)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	res, err := m.esCli.Search(
 		m.esCli.Search.WithContext(ctx),
-		m.esCli.Search.WithIndex(m.index),
 		m.esCli.Search.WithBody(bytes.NewBuffer(query)),
 	)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer res.Body.Close()
 	var esres es.Response
 	err = json.NewDecoder(res.Body).Decode(&esres)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if res.IsError() {
-		err = es.TranslateError(res.StatusCode, esres.Error)
-	}
-
-	if err != nil {
-		if errors.Is(err, es.ErrIndexNotFound) {
-			m.log.Debug().Str("index", m.index).Msg(es.ErrIndexNotFound.Error())
-			return nil, nil
-		}
-		return nil, err
+		return nil, "", es.TranslateError(res.StatusCode, esres.Error)
 	}
 
-	return esres.Hits.Hits, nil
+	return esres.Hits.Hits, esres.PitId, nil
 }
 
 // Prepares minimal query to do the quick check without reading all matches full documents
 func (m *simpleMonitorT) prepareCheckQuery() (tmpl *dsl.Tmpl, err error) {
-	tmpl, root := m.prepareCommon(false)
+	tmpl, root, filter := m.prepareCommon()
+	filter.Range(fieldSeqNo, dsl.WithRangeGT(tmpl.Bind(fieldSeqNo)))
 
 	root.Source().Includes(dl.FieldSeqNo)
 	root.Size(1)
@@ -352,9 +457,23 @@ func (m *simpleMonitorT) prepareCheckQuery() (tmpl *dsl.Tmpl, err error) {
 	return
 }
 
-// Prepares full documents query
-func (m *simpleMonitorT) prepareQuery() (tmpl *dsl.Tmpl, err error) {
-	tmpl, root := m.prepareCommon(true)
+// Prepares full documents query on a point in time; the first page starts
+// after the checkpoint, the next ones after the sort values of the last
+// document of the previous page. The sort values include the tiebreaker
+// Elasticsearch adds to point in time searches.
+func (m *simpleMonitorT) prepareQuery(searchAfter bool) (tmpl *dsl.Tmpl, err error) {
+	tmpl, root, filter := m.prepareCommon()
+	filter.Range(fieldSeqNo, dsl.WithRangeLTE(tmpl.Bind(fieldMaxSeqNo)))
+	if searchAfter {
+		root.Param(fieldSearchAfter, tmpl.Bind(fieldSearchAfter))
+	} else {
+		filter.Range(fieldSeqNo, dsl.WithRangeGT(tmpl.Bind(fieldSeqNo)))
+	}
+
+	root.Param(fieldPIT, map[string]interface{}{
+		"id":         tmpl.Bind(fieldPITId),
+		"keep_alive": pitKeepAlive,
+	})
 	root.Size(uint64(m.fetchSize))
 	root.Sort().SortOrder(fieldSeqNo, dsl.SortAscend)
 
@@ -364,20 +483,16 @@ func (m *simpleMonitorT) prepareQuery() (tmpl *dsl.Tmpl, err error) {
 	return
 }
 
-func (m *simpleMonitorT) prepareCommon(limitMax bool) (*dsl.Tmpl, *dsl.Node) {
+func (m *simpleMonitorT) prepareCommon() (*dsl.Tmpl, *dsl.Node, *dsl.Node) {
 	tmpl := dsl.NewTmpl()
 
 	root := dsl.NewRoot()
 	root.Param(seqNoPrimaryTerm, true)
 
 	filter := root.Query().Bool().Filter()
-	filter.Range(fieldSeqNo, dsl.WithRangeGT(tmpl.Bind(fieldSeqNo)))
-	if limitMax {
-		filter.Range(fieldSeqNo, dsl.WithRangeLTE(tmpl.Bind(fieldMaxSeqNo)))
-	}
 	if m.withExpiration {
 		filter.Range(fieldExpiration, dsl.WithRangeGT(tmpl.Bind(fieldExpiration)))
 	}
 
-	return tmpl, root
+	return tmpl, root, filter
 }
@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package monitor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareQuery(t *testing.T) {
+	sm, err := NewSimple(dl.FleetActions, nil, nil, WithExpiration(true), WithFetchSize(10))
+	require.NoError(t, err)
+	m := sm.(*simpleMonitorT)
+
+	query, err := m.tmplQuery.Render(map[string]interface{}{
+		dl.FieldSeqNo:      int64(3),
+		dl.FieldMaxSeqNo:   int64(7),
+		dl.FieldExpiration: "2021-06-01T00:00:00Z",
+		fieldPITId:         "pit-1",
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"seq_no_primary_term": true,
+		"pit": {"id": "pit-1", "keep_alive": "1m"},
+		"size": 10,
+		"sort": ["_seq_no"],
+		"query": {"bool": {"filter": [
+			{"range": {"expiration": {"gt": "2021-06-01T00:00:00Z"}}},
+			{"range": {"_seq_no": {"lte": 7}}},
+			{"range": {"_seq_no": {"gt": 3}}}
+		]}}
+	}`, string(query))
+
+	query, err = m.tmplQueryAfter.Render(map[string]interface{}{
+		dl.FieldMaxSeqNo:   int64(7),
+		dl.FieldExpiration: "2021-06-01T00:00:00Z",
+		fieldPITId:         "pit-2",
+		fieldSearchAfter:   json.RawMessage(`[5,4294967298]`),
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"seq_no_primary_term": true,
+		"pit": {"id": "pit-2", "keep_alive": "1m"},
+		"search_after": [5, 4294967298],
+		"size": 10,
+		"sort": ["_seq_no"],
+		"query": {"bool": {"filter": [
+			{"range": {"expiration": {"gt": "2021-06-01T00:00:00Z"}}},
+			{"range": {"_seq_no": {"lte": 7}}}
+		]}}
+	}`, string(query))
+}
+
+func TestPollInterval(t *testing.T) {
+	sm, err := NewSimple(dl.FleetActions, nil, nil, WithPollInterval(time.Second, 5*time.Second))
+	require.NoError(t, err)
+	m := sm.(*simpleMonitorT)
+	assert.Equal(t, time.Second, m.pollInterval)
+	assert.True(t, m.waitForAdvance, "polling is opt-in")
+
+	interval := m.pollInterval
+	var intervals []time.Duration
+	for i := 0; i < 4; i++ {
+		interval = nextPollInterval(interval, m.maxPollInterval)
+		intervals = append(intervals, interval)
+	}
+	assert.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, intervals)
+
+	// Invalid bounds are ignored
+	sm, err = NewSimple(dl.FleetActions, nil, nil, WithPollInterval(time.Second, time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, defaultMinPollInterval, sm.(*simpleMonitorT).minPollInterval)
+	assert.Equal(t, defaultMaxPollInterval, sm.(*simpleMonitorT).maxPollInterval)
+}
@@ -0,0 +1,120 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package netlabel labels the IP addresses with the country, autonomous
+// system and site-defined zone of the network they belong to.
+package netlabel
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Labels of a network.
+type Labels struct {
+	Country string
+	ASN     string
+	Zone    string
+}
+
+// Table maps the networks to their labels. An address is labelled by the most
+// specific network holding it, found with a lookup per prefix length in the
+// table so large tables stay cheap to query.
+type Table struct {
+	lengths []int // prefix lengths of the networks, longest first
+	nets    map[int]map[string]Labels
+}
+
+// NewTable returns an empty table.
+func NewTable() *Table {
+	return &Table{
+		nets: make(map[int]map[string]Labels),
+	}
+}
+
+// Add labels the network given in CIDR notation; IPv4 networks also label
+// their IPv4-mapped IPv6 addresses.
+func (t *Table) Add(cidr string, l Labels) error {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if bits == 8*net.IPv4len {
+		ones += 8 * (net.IPv6len - net.IPv4len)
+	}
+
+	nets, ok := t.nets[ones]
+	if !ok {
+		nets = make(map[string]Labels)
+		t.nets[ones] = nets
+		t.lengths = append(t.lengths, ones)
+		sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	}
+	nets[string(ipNet.IP.To16())] = l
+	return nil
+}
+
+// Load adds the networks of the CSV lines cidr,country,asn[,zone] read from r.
+// Empty lines and the lines starting with # are skipped.
+func (t *Table) Load(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var l Labels
+		if len(rec) > 1 {
+			l.Country = strings.TrimSpace(rec[1])
+		}
+		if len(rec) > 2 {
+			l.ASN = strings.TrimSpace(rec[2])
+		}
+		if len(rec) > 3 {
+			l.Zone = strings.TrimSpace(rec[3])
+		}
+		if err := t.Add(strings.TrimSpace(rec[0]), l); err != nil {
+			return fmt.Errorf("network %d: %w", n, err)
+		}
+	}
+}
+
+// Lookup returns the labels of the most specific network holding the address.
+func (t *Table) Lookup(ip net.IP) (Labels, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return Labels{}, false
+	}
+
+	for _, ones := range t.lengths {
+		masked := ip.Mask(net.CIDRMask(ones, 8*net.IPv6len))
+		if l, ok := t.nets[ones][string(masked)]; ok {
+			return l, true
+		}
+	}
+	return Labels{}, false
+}
+
+// Len returns the number of networks of the table.
+func (t *Table) Len() int {
+	n := 0
+	for _, nets := range t.nets {
+		n += len(nets)
+	}
+	return n
+}
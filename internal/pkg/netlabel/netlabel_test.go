@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package netlabel
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableLookup(t *testing.T) {
+	table := NewTable()
+	require.NoError(t, table.Load(strings.NewReader(`# cidr,country,asn
+10.0.0.0/8,DE,64512
+10.1.0.0/16,FR,64513
+10.1.2.0/24,FR,64513,paris-office
+
+2001:db8::/32,NL,64514
+`)))
+	require.NoError(t, table.Add("192.0.2.1/32", Labels{Country: "US"}))
+	assert.Equal(t, 5, table.Len())
+
+	tests := []struct {
+		ip   string
+		want Labels
+		ok   bool
+	}{
+		{"10.2.3.4", Labels{"DE", "64512", ""}, true},
+		{"10.1.3.4", Labels{"FR", "64513", ""}, true},
+		{"10.1.2.4", Labels{"FR", "64513", "paris-office"}, true},
+		{"::ffff:10.1.3.4", Labels{"FR", "64513", ""}, true},
+		{"2001:db8::1", Labels{"NL", "64514", ""}, true},
+		{"192.0.2.1", Labels{Country: "US"}, true},
+		{"192.0.2.2", Labels{}, false},
+		{"2001:db9::1", Labels{}, false},
+	}
+	for _, tc := range tests {
+		l, ok := table.Lookup(net.ParseIP(tc.ip))
+		assert.Equal(t, tc.ok, ok, tc.ip)
+		assert.Equal(t, tc.want, l, tc.ip)
+	}
+
+	_, ok := table.Lookup(nil)
+	assert.False(t, ok)
+}
+
+func TestTableLoadInvalid(t *testing.T) {
+	err := NewTable().Load(strings.NewReader("10.0.0.0/8,DE\nnot-a-network,FR\n"))
+	assert.EqualError(t, err, "network 2: invalid CIDR address: not-a-network")
+}
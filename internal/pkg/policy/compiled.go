@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ApiKeyPlaceholder is rendered in place of the API key of the default output
+// when a policy is compiled; Compiled.Render splices the key of each agent in.
+const ApiKeyPlaceholder = "\x00fleet-server:output_api_key\x00"
+
+// ErrNotCompilable is returned when the rendered policy does not hold the
+// placeholder exactly once, so the key of an agent cannot be spliced in.
+var ErrNotCompilable = errors.New("policy cannot be compiled")
+
+// CompileKey identifies a compiled policy. The output hash is the hash of the
+// output permissions the API key of the agents was created for.
+type CompileKey struct {
+	Revision   Revision
+	Platform   Platform
+	OutputHash string
+}
+
+// Compiled is a policy revision fully rendered for the agents of a platform,
+// but for the API key of their default output.
+type Compiled struct {
+	prefix []byte
+	suffix []byte
+}
+
+// NewCompiled splits the rendered policy around the quoted placeholder.
+func NewCompiled(rendered []byte) (*Compiled, error) {
+	placeholder, err := json.Marshal(ApiKeyPlaceholder)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Count(rendered, placeholder) != 1 {
+		return nil, ErrNotCompilable
+	}
+	i := bytes.Index(rendered, placeholder)
+	return &Compiled{
+		prefix: rendered[:i],
+		suffix: rendered[i+len(placeholder):],
+	}, nil
+}
+
+// Render returns the policy with the API key of the agent.
+func (c *Compiled) Render(apiKey string) (json.RawMessage, error) {
+	key, err := json.Marshal(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(c.prefix)+len(key)+len(c.suffix))
+	out = append(out, c.prefix...)
+	out = append(out, key...)
+	out = append(out, c.suffix...)
+	return out, nil
+}
+
+// kCompiledMaxEntries bounds the compiled policies held per revision; past
+// it the least recently used is compiled again when needed.
+const kCompiledMaxEntries = 128
+
+// CompiledFor returns the policy compiled for the key, calling compile once
+// per key; the rendering then only depends on the revision, the platform and
+// the output permissions, not on the agent. An error of compile is not cached.
+//
+// The compiled policies are held by the revision; they are dropped by the
+// monitor when a newer revision of the policy replaces it.
+func (pp *ParsedPolicy) CompiledFor(key CompileKey, compile func() ([]byte, error)) (*Compiled, error) {
+	if pp.compiled == nil || key.Revision != RevisionFromPolicy(pp.Policy) {
+		return compileNow(compile)
+	}
+
+	c, err := pp.compiled.get(key, func() (interface{}, error) {
+		return compileNow(compile)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.(*Compiled), nil
+}
+
+func compileNow(compile func() ([]byte, error)) (*Compiled, error) {
+	rendered, err := compile()
+	if err != nil {
+		return nil, err
+	}
+	return NewCompiled(rendered)
+}
+
+// invalidateCompiled drops the compiled policies of the revision.
+func (pp *ParsedPolicy) invalidateCompiled() {
+	if pp.compiled == nil {
+		return
+	}
+	pp.compiled.purge()
+}
@@ -0,0 +1,144 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledRender(t *testing.T) {
+	rendered, err := json.Marshal(map[string]interface{}{
+		"outputs": map[string]interface{}{
+			"default": map[string]interface{}{"api_key": ApiKeyPlaceholder},
+		},
+	})
+	require.NoError(t, err)
+
+	c, err := NewCompiled(rendered)
+	require.NoError(t, err)
+
+	out, err := c.Render(`id:"key"`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"outputs": {"default": {"api_key": "id:\"key\""}}}`, string(out))
+
+	_, err = NewCompiled([]byte(`{"outputs": {}}`))
+	assert.True(t, errors.Is(err, ErrNotCompilable))
+}
+
+func TestCompiledFor(t *testing.T) {
+	pp, err := NewParsedPolicy(model.Policy{
+		PolicyId:       "policy",
+		RevisionIdx:    2,
+		CoordinatorIdx: 1,
+		Data:           json.RawMessage(testPlatformPolicy),
+	})
+	require.NoError(t, err)
+
+	calls := 0
+	compile := func() ([]byte, error) {
+		calls++
+		return json.Marshal(ApiKeyPlaceholder)
+	}
+
+	key := CompileKey{
+		Revision:   RevisionFromPolicy(pp.Policy),
+		Platform:   Platform{OS: "linux", Arch: "amd64"},
+		OutputHash: "hash",
+	}
+
+	c1, err := pp.CompiledFor(key, compile)
+	require.NoError(t, err)
+	c2, err := pp.CompiledFor(key, compile)
+	require.NoError(t, err)
+	assert.Same(t, c1, c2)
+	assert.Equal(t, 1, calls)
+
+	// Another platform or output permissions compile again.
+	other := key
+	other.OutputHash = "other"
+	_, err = pp.CompiledFor(other, compile)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// Another revision is never cached against this one.
+	stale := key
+	stale.Revision.RevisionIdx = 1
+	_, err = pp.CompiledFor(stale, compile)
+	require.NoError(t, err)
+	_, err = pp.CompiledFor(stale, compile)
+	require.NoError(t, err)
+	assert.Equal(t, 4, calls)
+
+	pp.invalidateCompiled()
+	_, err = pp.CompiledFor(key, compile)
+	require.NoError(t, err)
+	assert.Equal(t, 5, calls)
+
+	// Errors are not cached.
+	failing := CompileKey{Revision: key.Revision, OutputHash: "failing"}
+	_, err = pp.CompiledFor(failing, func() ([]byte, error) { return []byte(`{}`), nil })
+	assert.True(t, errors.Is(err, ErrNotCompilable))
+	_, err = pp.CompiledFor(failing, compile)
+	require.NoError(t, err)
+}
+
+func TestCompiledForConcurrent(t *testing.T) {
+	pp, err := NewParsedPolicy(model.Policy{PolicyId: "policy", Data: json.RawMessage(testPlatformPolicy)})
+	require.NoError(t, err)
+	key := CompileKey{Revision: RevisionFromPolicy(pp.Policy)}
+
+	// The callers for the key wait for the compilation in progress
+	var calls int32
+	release := make(chan struct{})
+	compile := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return json.Marshal(ApiKeyPlaceholder)
+	}
+
+	var wg sync.WaitGroup
+	compiled := make([]*Compiled, 8)
+	for i := range compiled {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			compiled[i], _ = pp.CompiledFor(key, compile)
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, c := range compiled {
+		assert.Same(t, compiled[0], c)
+	}
+}
+
+func TestCompiledForBounded(t *testing.T) {
+	pp, err := NewParsedPolicy(model.Policy{PolicyId: "policy", Data: json.RawMessage(testPlatformPolicy)})
+	require.NoError(t, err)
+
+	compile := func() ([]byte, error) { return json.Marshal(ApiKeyPlaceholder) }
+	for i := 0; i < 2*kCompiledMaxEntries; i++ {
+		key := CompileKey{Revision: RevisionFromPolicy(pp.Policy), OutputHash: strconv.Itoa(i)}
+		_, err := pp.CompiledFor(key, compile)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, kCompiledMaxEntries, pp.compiled.len())
+}
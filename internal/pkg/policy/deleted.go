@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+)
+
+// Checks a policy must be missing on before it is taken as deleted; a policy
+// just created may not be searchable yet.
+const kDeletedChecks = 2
+
+// The latest policies query returns up to this many policies; beyond it a
+// policy missing from the results may still exist.
+const kMaxCheckedPolicies = 10000
+
+// MonitorOpt configures the policy monitor.
+type MonitorOpt func(m *monitorT)
+
+// WithReleaseDeleted has the monitor check every interval that the subscribed
+// policies still exist, and release the subscribers of the ones deleted, so
+// their agents check in again under the policy they were reassigned to. The
+// agents themselves are reassigned by a single Fleet Server.
+func WithReleaseDeleted(interval time.Duration) MonitorOpt {
+	return func(m *monitorT) {
+		m.deletedInterval = interval
+	}
+}
+
+func (m *monitorT) releaseDeleted(ctx context.Context) error {
+	policies, err := m.policyF(ctx, m.bulker, dl.WithIndexName(m.policiesIndex))
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return nil
+		}
+		return err
+	}
+	// An empty index is taken as not set up yet rather than every policy
+	// deleted; a truncated result cannot tell.
+	if len(policies) == 0 || len(policies) >= kMaxCheckedPolicies {
+		return nil
+	}
+
+	exists := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		exists[p.PolicyId] = true
+	}
+
+	for _, policyId := range m.updateMissing(exists) {
+		m.log.Info().Str("policyId", policyId).Msg("subscribed policy deleted; releasing its subscribers")
+		m.release(policyId)
+	}
+	return nil
+}
+
+// updateMissing counts the checks each subscribed policy is missing on and
+// returns the ones deleted.
+func (m *monitorT) updateMissing(exists map[string]bool) []string {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var deleted []string
+	for policyId, p := range m.policies {
+		if exists[policyId] || len(p.groups) == 0 {
+			delete(m.missing, policyId)
+			continue
+		}
+		m.missing[policyId]++
+		if m.missing[policyId] >= kDeletedChecks {
+			deleted = append(deleted, policyId)
+		}
+	}
+	return deleted
+}
+
+// release ends the subscriptions to a deleted policy with a nil policy.
+func (m *monitorT) release(policyId string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p, ok := m.policies[policyId]
+	if !ok {
+		return
+	}
+	for rev, g := range p.groups {
+		delete(p.groups, rev)
+		g.detached = true
+		for _, sub := range g.subs {
+			select {
+			case sub.c <- nil:
+			default:
+			}
+		}
+	}
+	delete(m.missing, policyId)
+}
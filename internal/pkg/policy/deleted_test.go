@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/monitor/mock"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestMonitor_DeletedPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewMonitor(ftesting.MockBulk{}, mock.NewMockIndexMonitor(), 0, WithReleaseDeleted(time.Minute)).(*monitorT)
+	existing := []model.Policy{{PolicyId: "kept"}}
+	m.policyF = func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]model.Policy, error) {
+		return existing, nil
+	}
+
+	kept, err := m.Subscribe("agent-1", "kept", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone, err := m.Subscribe("agent-2", "gone", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing once is not enough
+	if err := m.releaseDeleted(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case pp := <-gone.Output():
+		t.Fatalf("subscription released after a single check: %v", pp)
+	default:
+	}
+
+	if err := m.releaseDeleted(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pp := <-gone.Output():
+		if pp != nil {
+			t.Errorf("expected a nil policy on release, got %v", pp)
+		}
+	default:
+		t.Error("subscription to the deleted policy not released")
+	}
+	select {
+	case pp := <-kept.Output():
+		t.Errorf("subscription to an existing policy released: %v", pp)
+	default:
+	}
+
+	// An empty result is not taken as every policy deleted
+	existing = nil
+	for i := 0; i < kDeletedChecks; i++ {
+		if err := m.releaseDeleted(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case pp := <-kept.Output():
+		t.Errorf("subscription released on an empty result: %v", pp)
+	default:
+	}
+}
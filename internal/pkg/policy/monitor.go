@@ -26,6 +26,7 @@ var gCounter uint64
 
 type Subscription interface {
 	// Output returns a new policy that needs to be sent based on the current subscription.
+	// A nil policy is sent when the policy was deleted and the agent reassigned.
 	Output() <-chan *ParsedPolicy
 }
 
@@ -38,23 +39,51 @@ type Monitor interface {
 
 	// Unsubscribe removes the current subscription.
 	Unsubscribe(sub Subscription) error
+
+	// LatestRevision returns the latest revision of the policy rolled out to
+	// subscribers, if the policy is known to the monitor.
+	LatestRevision(policyId string) (Revision, bool)
+
+	// Refused returns the reasons of the policies whose latest revision is
+	// not dispatched for its invalid PEM material, by policy id.
+	Refused() map[string][]string
+
+	// Subscriptions returns the count of the subscriptions waiting on a
+	// revision, by policy id.
+	Subscriptions() map[string]int
 }
 
 type policyFetcher func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]model.Policy, error)
 
+// subT is the one shot subscription of an agent; the revision it waits on is
+// the one of its group.
 type subT struct {
-	idx uint64
+	idx   uint64
+	group *subGroup
 
-	policyId string
+	c chan *ParsedPolicy
+}
+
+type revKey struct {
 	revIdx   int64
 	coordIdx int64
+}
 
-	c chan *ParsedPolicy
+// subGroup multiplexes the subscribers waiting on the same revision of a
+// policy, so the state kept per agent is only its channel. When a newer
+// revision rolls out the group is detached whole from its policy: its
+// subscribers map is never written again and is dispatched to without the
+// lock, while new subscribers join a new group.
+type subGroup struct {
+	policyId string
+	rev      revKey
+	subs     map[uint64]*subT // map sub counter to subscription
+	detached bool
 }
 
 type policyT struct {
-	pp   ParsedPolicy
-	subs map[uint64]subT // map sub counter to channel
+	pp     ParsedPolicy
+	groups map[revKey]*subGroup
 }
 
 type monitorT struct {
@@ -70,6 +99,11 @@ type monitorT struct {
 	policyF       policyFetcher
 	policiesIndex string
 	throttle      time.Duration
+
+	deletedInterval time.Duration
+	missing         map[string]int
+
+	refused map[string]refusal
 }
 
 // Output returns a new policy that needs to be sent based on the current subscription.
@@ -78,8 +112,8 @@ func (s *subT) Output() <-chan *ParsedPolicy {
 }
 
 // NewMonitor creates the policy monitor for subscribing agents.
-func NewMonitor(bulker bulk.Bulk, monitor monitor.Monitor, throttle time.Duration) Monitor {
-	return &monitorT{
+func NewMonitor(bulker bulk.Bulk, monitor monitor.Monitor, throttle time.Duration, opts ...MonitorOpt) Monitor {
+	m := &monitorT{
 		log:           log.With().Str("ctx", "policy agent monitor").Logger(),
 		bulker:        bulker,
 		monitor:       monitor,
@@ -88,7 +122,13 @@ func NewMonitor(bulker bulk.Bulk, monitor monitor.Monitor, throttle time.Duratio
 		throttle:      throttle,
 		policyF:       dl.QueryLatestPolicies,
 		policiesIndex: dl.FleetPolicies,
+		missing:       make(map[string]int),
+		refused:       make(map[string]refusal),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // Run runs the monitor.
@@ -98,22 +138,38 @@ func (m *monitorT) Run(ctx context.Context) error {
 	s := m.monitor.Subscribe()
 	defer m.monitor.Unsubscribe(s)
 
+	var deletedC <-chan time.Time
+	if m.deletedInterval > 0 {
+		ticker := time.NewTicker(m.deletedInterval)
+		defer ticker.Stop()
+		deletedC = ticker.C
+	}
+
 LOOP:
 	for {
 		select {
 		case <-ctx.Done():
 			break LOOP
+		case <-deletedC:
+			if err := m.releaseDeleted(ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				m.log.Warn().Err(err).Msg("fail release deleted policies")
+			}
 		case <-m.kickCh:
 			if err := m.process(ctx); err != nil {
 				return err
 			}
 		case hits := <-s.Output():
-			policies := make([]model.Policy, len(hits))
-			for i, hit := range hits {
-				err := hit.Unmarshal(&policies[i])
-				if err != nil {
-					return err
+			policies := make([]model.Policy, 0, len(hits))
+			for _, hit := range hits {
+				var policy model.Policy
+				if err := hit.Unmarshal(&policy); err != nil {
+					dl.DeadLetter(m.bulker, m.policiesIndex, hit, err)
+					continue
 				}
+				policies = append(policies, policy)
 			}
 			if err := m.processPolicies(ctx, policies); err != nil {
 				return err
@@ -183,11 +239,23 @@ func (m *monitorT) rollout(ctx context.Context, policy model.Policy) error {
 		return err
 	}
 
-	subs := m.updatePolicy(pp)
-	if subs == nil {
+	// Expired or broken TLS material would cut thousands of agents off their
+	// outputs at once
+	if reasons := checkPEM(policy.Data, time.Now()); len(reasons) != 0 {
+		m.refuse(policy, reasons)
 		return nil
 	}
-	if len(subs) == 0 {
+	m.accept(policy.PolicyId)
+
+	groups := m.updatePolicy(pp)
+	if groups == nil {
+		return nil
+	}
+	nSubs := 0
+	for _, g := range groups {
+		nSubs += len(g.subs)
+	}
+	if nSubs == 0 {
 		zlog.Info().Msg("no pending subscriptions to revised policy")
 		return nil
 	}
@@ -208,32 +276,34 @@ func (m *monitorT) rollout(ctx context.Context, policy model.Policy) error {
 	start := time.Now()
 
 	zlog.Info().
-		Int("nSubs", len(subs)).
+		Int("nSubs", nSubs).
+		Int("nGroups", len(groups)).
 		Dur("throttle", m.throttle).
 		Msg("policy rollout begin")
 
 LOOP:
-	for _, s := range subs {
+	for _, g := range groups {
+		for _, s := range g.subs {
+
+			if throttle != nil {
+				select {
+				case <-throttle.C:
+				case <-ctx.Done():
+					err = ctx.Err()
+					break LOOP
+				}
+			}
 
-		if throttle != nil {
 			select {
-			case <-throttle.C:
-			case <-ctx.Done():
-				err = ctx.Err()
-				break LOOP
+			case s.c <- pp:
+			default:
+				// Should never block on a channel; we created a channel of size one.
+				// A block here indicates a logic error somewheres.
+				zlog.Error().
+					Str("policyId", policy.PolicyId).
+					Msg("should never block on policy channel")
 			}
 		}
-
-		select {
-		case s.c <- pp:
-		default:
-			// Should never block on a channel; we created a channel of size one.
-			// A block here indicates a logic error somewheres.
-			zlog.Error().
-				Str("policyId", policy.PolicyId).
-				Msg("should never block on policy channel")
-		}
-
 	}
 
 	zlog.Info().
@@ -244,7 +314,9 @@ LOOP:
 	return err
 }
 
-func (m *monitorT) updatePolicy(pp *ParsedPolicy) []subT {
+// updatePolicy records the new policy and detaches the groups of the
+// subscribers it is a newer revision for.
+func (m *monitorT) updatePolicy(pp *ParsedPolicy) []*subGroup {
 	m.mut.Lock()
 	defer m.mut.Unlock()
 
@@ -253,8 +325,8 @@ func (m *monitorT) updatePolicy(pp *ParsedPolicy) []subT {
 	p, ok := m.policies[newPolicy.PolicyId]
 	if !ok {
 		p = policyT{
-			pp:   *pp,
-			subs: make(map[uint64]subT),
+			pp:     *pp,
+			groups: make(map[revKey]*subGroup),
 		}
 		m.policies[newPolicy.PolicyId] = p
 		m.log.Info().
@@ -267,6 +339,11 @@ func (m *monitorT) updatePolicy(pp *ParsedPolicy) []subT {
 
 	oldPolicy := p.pp.Policy
 
+	// The agents still on the old revision get the new one; its compiled
+	// renderings are no longer served.
+	if RevisionFromPolicy(oldPolicy) != RevisionFromPolicy(newPolicy) {
+		p.pp.invalidateCompiled()
+	}
 	p.pp = *pp
 	m.policies[newPolicy.PolicyId] = p
 
@@ -285,17 +362,18 @@ func (m *monitorT) updatePolicy(pp *ParsedPolicy) []subT {
 		return nil
 	}
 
-	subs := make([]subT, 0, len(p.subs))
-	for idx, sub := range p.subs {
-		if newPolicy.RevisionIdx > sub.revIdx ||
-			(newPolicy.RevisionIdx == sub.revIdx && newPolicy.CoordinatorIdx > sub.coordIdx) {
-			// These subscriptions are one shot; delete from map.
-			delete(p.subs, idx)
-			subs = append(subs, sub)
+	groups := make([]*subGroup, 0, len(p.groups))
+	for rev, g := range p.groups {
+		if newPolicy.RevisionIdx > rev.revIdx ||
+			(newPolicy.RevisionIdx == rev.revIdx && newPolicy.CoordinatorIdx > rev.coordIdx) {
+			// These subscriptions are one shot; detach the group.
+			delete(p.groups, rev)
+			g.detached = true
+			groups = append(groups, g)
 		}
 	}
 
-	return subs
+	return groups
 }
 
 // Subscribe creates a new subscription for a policy update.
@@ -316,12 +394,9 @@ func (m *monitorT) Subscribe(agentId string, policyId string, revisionIdx int64,
 
 	idx := atomic.AddUint64(&gCounter, 1)
 
-	s := subT{
-		idx:      idx,
-		policyId: policyId,
-		revIdx:   revisionIdx,
-		coordIdx: coordinatorIdx,
-		c:        make(chan *ParsedPolicy, 1),
+	s := &subT{
+		idx: idx,
+		c:   make(chan *ParsedPolicy, 1),
 	}
 
 	m.mut.Lock()
@@ -337,7 +412,7 @@ func (m *monitorT) Subscribe(agentId string, policyId string, revisionIdx int64,
 		s.c <- &p.pp
 	} else {
 		if !ok {
-			p = policyT{subs: make(map[uint64]subT)}
+			p = policyT{groups: make(map[revKey]*subGroup)}
 			m.policies[policyId] = p
 			select {
 			case m.kickCh <- struct{}{}:
@@ -345,11 +420,53 @@ func (m *monitorT) Subscribe(agentId string, policyId string, revisionIdx int64,
 				m.log.Debug().Msg("kick channel full")
 			}
 		}
-		p.subs[idx] = s
+		rev := revKey{revIdx: revisionIdx, coordIdx: coordinatorIdx}
+		g, ok := p.groups[rev]
+		if !ok {
+			g = &subGroup{
+				policyId: policyId,
+				rev:      rev,
+				subs:     make(map[uint64]*subT),
+			}
+			p.groups[rev] = g
+		}
+		s.group = g
+		g.subs[idx] = s
 	}
 	m.mut.Unlock()
 
-	return &s, nil
+	return s, nil
+}
+
+// LatestRevision returns the latest revision of the policy rolled out to
+// subscribers, if the policy is known to the monitor.
+func (m *monitorT) LatestRevision(policyId string) (Revision, bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p, ok := m.policies[policyId]
+	if !ok || p.pp.Policy.CoordinatorIdx <= 0 {
+		return Revision{}, false
+	}
+	return RevisionFromPolicy(p.pp.Policy), true
+}
+
+// Subscriptions returns the count of the subscriptions waiting on a revision,
+// by policy id; those of the groups detached for a rollout are no longer
+// counted.
+func (m *monitorT) Subscriptions() map[string]int {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	subs := make(map[string]int, len(m.policies))
+	for policyId, p := range m.policies {
+		n := 0
+		for _, g := range p.groups {
+			n += len(g.subs)
+		}
+		subs[policyId] = n
+	}
+	return subs
 }
 
 // Unsubscribe removes the current subscription.
@@ -363,8 +480,13 @@ func (m *monitorT) Unsubscribe(sub Subscription) error {
 	}
 
 	m.mut.Lock()
-	if policy, ok := m.policies[s.policyId]; ok {
-		delete(policy.subs, s.idx)
+	if g := s.group; !g.detached {
+		delete(g.subs, s.idx)
+		if len(g.subs) == 0 {
+			if policy, ok := m.policies[g.policyId]; ok {
+				delete(policy.groups, g.rev)
+			}
+		}
 	}
 	m.mut.Unlock()
 
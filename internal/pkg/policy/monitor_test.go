@@ -336,3 +336,116 @@ func runTestMonitor_NewPolicyExists(t *testing.T, delay time.Duration) {
 		t.Fatal("never got policy update; timed out after 500ms")
 	}
 }
+
+func TestMonitor_MultiplexedSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	monitor := NewMonitor(ftesting.MockBulk{}, mock.NewMockIndexMonitor(), 0)
+	pm := monitor.(*monitorT)
+
+	policyId := uuid.Must(uuid.NewV4()).String()
+	policy := model.Policy{
+		ESDocument:     model.ESDocument{Id: xid.New().String()},
+		PolicyId:       policyId,
+		CoordinatorIdx: 1,
+		Data:           []byte("{}"),
+		RevisionIdx:    1,
+	}
+	if err := pm.processPolicies(ctx, []model.Policy{policy}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscribers waiting on the same revision share a group
+	var subs []Subscription
+	for i := 0; i < 10; i++ {
+		s, err := monitor.Subscribe(uuid.Must(uuid.NewV4()).String(), policyId, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, s)
+	}
+	old, err := monitor.Subscribe(uuid.Must(uuid.NewV4()).String(), policyId, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-old.Output():
+	default:
+		t.Fatal("subscription to an older revision not notified at once")
+	}
+	monitor.Unsubscribe(old)
+
+	if n := len(pm.policies[policyId].groups); n != 1 {
+		t.Fatalf("expected one group, got %d", n)
+	}
+	if n := len(pm.policies[policyId].groups[revKey{1, 1}].subs); n != 10 {
+		t.Fatalf("expected 10 subscribers in the group, got %d", n)
+	}
+
+	// An unsubscribed subscriber is not notified; the last one removes the group
+	if err := monitor.Unsubscribe(subs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	policy.RevisionIdx = 2
+	if err := pm.processPolicies(ctx, []model.Policy{policy}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pm.policies[policyId].groups); n != 0 {
+		t.Fatalf("expected the group detached, got %d groups", n)
+	}
+
+	for i, s := range subs {
+		select {
+		case pp := <-s.Output():
+			if i == 0 {
+				t.Fatal("unsubscribed subscriber notified")
+			}
+			if pp.Policy.RevisionIdx != 2 {
+				t.Fatalf("expected revision 2, got %d", pp.Policy.RevisionIdx)
+			}
+		default:
+			if i != 0 {
+				t.Fatalf("subscriber %d not notified", i)
+			}
+		}
+		// Unsubscribing from a detached group is a noop
+		if err := monitor.Unsubscribe(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := monitor.Subscribe(uuid.Must(uuid.NewV4()).String(), policyId, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor.Unsubscribe(s)
+	if n := len(pm.policies[policyId].groups); n != 0 {
+		t.Fatalf("expected the emptied group removed, got %d groups", n)
+	}
+}
+
+func TestMonitor_Subscriptions(t *testing.T) {
+	monitor := NewMonitor(ftesting.MockBulk{}, mock.NewMockIndexMonitor(), 0)
+
+	s1, err := monitor.Subscribe("agent1", "p1", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := monitor.Subscribe("agent2", "p1", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := monitor.Subscribe("agent3", "p2", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(map[string]int{"p1": 2, "p2": 1}, monitor.Subscriptions()); diff != "" {
+		t.Fatal(diff)
+	}
+
+	monitor.Unsubscribe(s1)
+	monitor.Unsubscribe(s2)
+	if diff := cmp.Diff(map[string]int{"p1": 0, "p2": 1}, monitor.Subscriptions()); diff != "" {
+		t.Fatal(diff)
+	}
+}
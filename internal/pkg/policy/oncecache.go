@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// onceCache holds the values rendered from a policy revision for the agents,
+// in an LRU so the keys the agents report cannot grow it unbounded. Each
+// value is rendered once, outside of the lock, while the concurrent callers
+// for the same key wait for it.
+type onceCache struct {
+	mut     sync.Mutex
+	entries *simplelru.LRU
+}
+
+type onceEntry struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func newOnceCache(size int) *onceCache {
+	// Only fails on a size that is not positive
+	entries, _ := simplelru.NewLRU(size, nil)
+	return &onceCache{entries: entries}
+}
+
+// get returns the value of the key, rendered by fn on the first call for the
+// key. An error of fn is returned to the callers waiting on it, but is not
+// cached.
+func (c *onceCache) get(key interface{}, fn func() (interface{}, error)) (interface{}, error) {
+	c.mut.Lock()
+	if v, ok := c.entries.Get(key); ok {
+		c.mut.Unlock()
+		e := v.(*onceEntry)
+		<-e.done
+		return e.val, e.err
+	}
+	e := &onceEntry{done: make(chan struct{})}
+	c.entries.Add(key, e)
+	c.mut.Unlock()
+
+	e.val, e.err = fn()
+	close(e.done)
+
+	if e.err != nil {
+		c.mut.Lock()
+		if v, ok := c.entries.Peek(key); ok && v == e {
+			c.entries.Remove(key)
+		}
+		c.mut.Unlock()
+	}
+	return e.val, e.err
+}
+
+// purge drops every value.
+func (c *onceCache) purge() {
+	c.mut.Lock()
+	c.entries.Purge()
+	c.mut.Unlock()
+}
+
+func (c *onceCache) len() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.entries.Len()
+}
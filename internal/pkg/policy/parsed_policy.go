@@ -22,6 +22,9 @@ type ParsedPolicy struct {
 	Policy model.Policy
 	Fields map[string]json.RawMessage
 	Roles  RoleMapT
+
+	platforms *onceCache
+	compiled  *onceCache
 }
 
 func NewParsedPolicy(p model.Policy) (*ParsedPolicy, error) {
@@ -42,9 +45,13 @@ func NewParsedPolicy(p model.Policy) (*ParsedPolicy, error) {
 
 	// We are cool and the gang
 	pp := &ParsedPolicy{
-		Policy: p,
-		Fields: fields,
-		Roles:  roles,
+		Policy:   p,
+		Fields:   fields,
+		Roles:    roles,
+		compiled: newOnceCache(kCompiledMaxEntries),
+	}
+	if _, ok := fields[FieldPlatformVars]; ok {
+		pp.platforms = newOnceCache(kPlatformMaxEntries)
 	}
 
 	return pp, nil
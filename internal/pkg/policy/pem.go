@@ -0,0 +1,278 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+const kPEMBegin = "-----BEGIN "
+
+// kPEMClockSkew is the skew allowed between the clock of Fleet Server and the
+// one a certificate was issued with before it is taken as not yet valid.
+const kPEMClockSkew = 5 * time.Minute
+
+// kPEMBundleField is the field of the CA bundles: the agents trust any of its
+// certificates, so a bundle is only broken when none of them is valid.
+const kPEMBundleField = "certificate_authorities"
+
+// kPEMOutputFields are the fields of the outputs holding TLS material outside
+// of their ssl settings.
+var kPEMOutputFields = map[string]bool{
+	"certificate":             true,
+	"certificate_authorities": true,
+	"key":                     true,
+}
+
+// checkPEM returns the reasons the PEM material of the TLS settings of the
+// policy, the ssl settings and the certificates and keys of its outputs, would
+// break the TLS of the agents, in a stable order: blocks that cannot be
+// decoded or parsed, and certificates expired or not yet valid at now. Only
+// the first certificate of a chain, the leaf, is checked for validity, and a
+// CA bundle only when none of its certificates is valid. Paths to files are
+// not checked, nor are encrypted keys; the reasons never hold the material
+// itself.
+func checkPEM(data json.RawMessage, now time.Time) []string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return []string{fmt.Sprintf("cannot parse policy: %v", err)}
+	}
+
+	var reasons []string
+	var bundle *pemBundle
+	flush := func() {
+		if bundle != nil {
+			reasons = append(reasons, bundle.reasons()...)
+			bundle = nil
+		}
+	}
+	walkStrings(v, "", func(path, s string) {
+		if !strings.Contains(s, kPEMBegin) {
+			return
+		}
+		field, ok := pemField(path)
+		if !ok {
+			return
+		}
+		if field != kPEMBundleField {
+			flush()
+			reasons = append(reasons, checkPEMValue(path, s, now, nil)...)
+			return
+		}
+		// The elements of a bundle are walked in a row
+		fieldPath := strings.TrimRight(strings.TrimRight(path, "0123456789]"), "[")
+		if bundle == nil || bundle.path != fieldPath {
+			flush()
+			bundle = &pemBundle{path: fieldPath}
+		}
+		reasons = append(reasons, checkPEMValue(path, s, now, bundle)...)
+	})
+	flush()
+	return reasons
+}
+
+// pemField returns the field of the TLS material at path, and whether path is
+// in the ssl settings or is a certificate or key field of an output.
+func pemField(path string) (string, bool) {
+	parts := strings.Split(path, ".")
+	field := parts[len(parts)-1]
+	if i := strings.IndexByte(field, '['); i >= 0 {
+		field = field[:i]
+	}
+	for _, p := range parts[:len(parts)-1] {
+		if p == "ssl" || strings.HasPrefix(p, "ssl[") {
+			return field, true
+		}
+	}
+	return field, parts[0] == "outputs" && kPEMOutputFields[field]
+}
+
+// pemBundle collects the validity of the certificates of a CA bundle.
+type pemBundle struct {
+	path    string
+	valid   int
+	invalid []string
+}
+
+func (b *pemBundle) reasons() []string {
+	if b.valid > 0 {
+		return nil
+	}
+	return b.invalid
+}
+
+// walkStrings calls fn with the dotted path of every string of v, in the
+// order of the keys.
+func walkStrings(v interface{}, path string, fn func(path, s string)) {
+	switch v := v.(type) {
+	case string:
+		fn(path, v)
+	case []interface{}:
+		for i, e := range v {
+			walkStrings(e, path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			walkStrings(v[k], p, fn)
+		}
+	}
+}
+
+// checkPEMValue returns the reasons the PEM blocks of s are broken. The
+// validity of the certificates of a bundle is recorded in it, to be reported
+// when none is valid; otherwise only the first certificate is checked.
+func checkPEMValue(path, s string, now time.Time, bundle *pemBundle) []string {
+	var reasons []string
+	rest := []byte(s)
+	n := 0
+	certs := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		n++
+
+		switch {
+		case block.Type == "CERTIFICATE":
+			certs++
+			if bundle == nil && certs > 1 {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				reasons = append(reasons, fmt.Sprintf("%s: certificate %d cannot be parsed: %v", path, n, err))
+				continue
+			}
+			var invalid string
+			if now.After(cert.NotAfter) {
+				invalid = fmt.Sprintf("%s: certificate %q expired on %s",
+					path, cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+			} else if now.Add(kPEMClockSkew).Before(cert.NotBefore) {
+				invalid = fmt.Sprintf("%s: certificate %q is not valid before %s",
+					path, cert.Subject.CommonName, cert.NotBefore.UTC().Format(time.RFC3339))
+			}
+			switch {
+			case bundle == nil && invalid != "":
+				reasons = append(reasons, invalid)
+			case bundle == nil:
+			case invalid != "":
+				bundle.invalid = append(bundle.invalid, invalid)
+			default:
+				bundle.valid++
+			}
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if err := parsePrivateKey(block); err != nil {
+				reasons = append(reasons, fmt.Sprintf("%s: %s %d cannot be parsed: %v", path, strings.ToLower(block.Type), n, err))
+			}
+		}
+	}
+
+	if n == 0 || strings.Contains(string(rest), kPEMBegin) {
+		reasons = append(reasons, fmt.Sprintf("%s: PEM block %d cannot be decoded", path, n+1))
+	}
+	return reasons
+}
+
+// parsePrivateKey parses the unencrypted keys of the types the agents read.
+func parsePrivateKey(block *pem.Block) error {
+	if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil
+	}
+
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	}
+	return err
+}
+
+// refusal is a revision of a policy not rolled out for its PEM material.
+type refusal struct {
+	rev     Revision
+	reasons []string
+}
+
+// refuse records the revision is not rolled out; the agents keep the one they
+// run until a revision fixes the material.
+func (m *monitorT) refuse(policy model.Policy, reasons []string) {
+	rev := RevisionFromPolicy(policy)
+
+	m.mut.Lock()
+	prev, ok := m.refused[policy.PolicyId]
+	m.refused[policy.PolicyId] = refusal{rev: rev, reasons: reasons}
+	m.mut.Unlock()
+
+	if ok && prev.rev == rev {
+		return
+	}
+	m.log.Error().
+		Str("policyId", policy.PolicyId).
+		Int64("rev", policy.RevisionIdx).
+		Int64("coord", policy.CoordinatorIdx).
+		Strs("reasons", reasons).
+		Msg("Policy not dispatched: invalid PEM material")
+}
+
+func (m *monitorT) accept(policyId string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if _, ok := m.refused[policyId]; ok {
+		delete(m.refused, policyId)
+		m.log.Info().Str("policyId", policyId).Msg("Policy PEM material fixed; dispatching")
+	}
+}
+
+// Refused returns the reasons of the policies not dispatched, by policy id.
+func (m *monitorT) Refused() map[string][]string {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	refused := make(map[string][]string, len(m.refused))
+	for id, r := range m.refused {
+		refused[id] = r.reasons
+	}
+	return refused
+}
+
+// refusedReasons describes the policies not dispatched, in a stable order.
+func refusedReasons(refused map[string][]string) []string {
+	ids := make([]string, 0, len(refused))
+	for id := range refused {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	reasons := make([]string, 0, len(ids))
+	for _, id := range ids {
+		reasons = append(reasons, fmt.Sprintf("policy %s not dispatched: %s", id, strings.Join(refused[id], ", ")))
+	}
+	return reasons
+}
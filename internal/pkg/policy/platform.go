@@ -0,0 +1,179 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FieldPlatformVars is the policy section holding the variables substituted
+// per agent platform. It maps "<os>/<arch>", "<os>" or "default" to the
+// variables of the agents of that platform, the most specific match winning
+// for each variable:
+//
+//	"platform_vars": {
+//	  "default": {"log_path": "/var/log/app.log"},
+//	  "windows": {"log_path": "C:\\ProgramData\\app\\app.log"}
+//	}
+//
+// References of the form ${platform.<name>} in the policy are replaced with
+// the variable before the policy is sent; the section itself is not sent.
+const FieldPlatformVars = "platform_vars"
+
+const platformDefault = "default"
+
+var (
+	platformRef    = []byte("${platform.")
+	platformRefExp = regexp.MustCompile(`\$\{platform\.([A-Za-z0-9_.-]+)\}`)
+)
+
+// Platform is the operating system and architecture of an agent, in the
+// GOOS/GOARCH notation.
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// PlatformFromMetadata returns the platform reported in the local metadata of
+// an agent; the fields are empty when unknown. Only the known architectures
+// are accepted, so the agents cannot make up platforms.
+func PlatformFromMetadata(localMeta json.RawMessage) Platform {
+	var meta struct {
+		Host struct {
+			Architecture string `json:"architecture"`
+		} `json:"host"`
+		OS struct {
+			Family   string `json:"family"`
+			Platform string `json:"platform"`
+		} `json:"os"`
+	}
+	if len(localMeta) == 0 || json.Unmarshal(localMeta, &meta) != nil {
+		return Platform{}
+	}
+
+	var p Platform
+	switch family := strings.ToLower(meta.OS.Family); {
+	case family == "windows" || strings.ToLower(meta.OS.Platform) == "windows":
+		p.OS = "windows"
+	case family == "darwin" || strings.ToLower(meta.OS.Platform) == "darwin":
+		p.OS = "darwin"
+	case family != "":
+		p.OS = "linux"
+	}
+
+	switch arch := strings.ToLower(meta.Host.Architecture); arch {
+	case "x86_64", "amd64", "x64":
+		p.Arch = "amd64"
+	case "aarch64", "arm64":
+		p.Arch = "arm64"
+	case "i386", "i686", "x86", "386":
+		p.Arch = "386"
+	case "armv7l", "armv6l", "arm":
+		p.Arch = "arm"
+	case "ppc64le":
+		p.Arch = "ppc64le"
+	case "s390x":
+		p.Arch = "s390x"
+	}
+	return p
+}
+
+// kPlatformMaxEntries bounds the platforms the fields of a revision are held
+// for, more than the known operating systems and architectures combined.
+const kPlatformMaxEntries = 32
+
+// FieldsFor returns the fields of the policy with the platform variables
+// substituted for the platform, computed once per revision and platform. The
+// returned map must not be modified.
+func (pp *ParsedPolicy) FieldsFor(p Platform) (map[string]json.RawMessage, error) {
+	raw, ok := pp.Fields[FieldPlatformVars]
+	if !ok || pp.platforms == nil {
+		return pp.Fields, nil
+	}
+
+	fields, err := pp.platforms.get(p, func() (interface{}, error) {
+		return pp.substituteFields(raw, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fields.(map[string]json.RawMessage), nil
+}
+
+func (pp *ParsedPolicy) substituteFields(raw json.RawMessage, p Platform) (map[string]json.RawMessage, error) {
+	var all map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FieldPlatformVars, err)
+	}
+	vars := make(map[string]interface{})
+	for _, key := range []string{platformDefault, p.OS, p.OS + "/" + p.Arch} {
+		for k, v := range all[key] {
+			vars[k] = v
+		}
+	}
+
+	fields := make(map[string]json.RawMessage, len(pp.Fields))
+	for k, v := range pp.Fields {
+		if k == FieldPlatformVars {
+			continue
+		}
+		if !bytes.Contains(v, platformRef) {
+			fields[k] = v
+			continue
+		}
+		sub, err := substitutePlatform(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = sub
+	}
+	return fields, nil
+}
+
+func substitutePlatform(raw json.RawMessage, vars map[string]interface{}) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(substituteValue(v, vars))
+}
+
+// substituteValue replaces the references to platform variables in the
+// strings of v. A string that is a single reference takes the value of the
+// variable as is, so variables need not be strings. References to unknown
+// variables are left for the agent.
+func substituteValue(v interface{}, vars map[string]interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = substituteValue(e, vars)
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = substituteValue(e, vars)
+		}
+		return t
+	case string:
+		if m := platformRefExp.FindStringSubmatch(t); m != nil && m[0] == t {
+			if val, ok := vars[m[1]]; ok {
+				return val
+			}
+			return t
+		}
+		return platformRefExp.ReplaceAllStringFunc(t, func(ref string) string {
+			name := platformRefExp.FindStringSubmatch(ref)[1]
+			if val, ok := vars[name]; ok {
+				return fmt.Sprint(val)
+			}
+			return ref
+		})
+	}
+	return v
+}
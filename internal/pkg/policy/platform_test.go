@@ -0,0 +1,92 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPlatformPolicy = `{
+	"id": "policy",
+	"revision": 2,
+	"outputs": {"default": {"type": "elasticsearch"}},
+	"inputs": [{
+		"type": "logfile",
+		"paths": ["${platform.log_path}"],
+		"ignore_older": "${platform.ignore_older}",
+		"processors": "${host.name} on ${platform.os_label}"
+	}],
+	"platform_vars": {
+		"default": {"log_path": "/var/log/app.log", "ignore_older": 24, "os_label": "unix"},
+		"windows": {"log_path": "C:\\ProgramData\\app.log", "os_label": "windows"},
+		"linux/arm64": {"ignore_older": 48}
+	}
+}`
+
+func TestPlatformFromMetadata(t *testing.T) {
+	p := PlatformFromMetadata(json.RawMessage(`{"host": {"architecture": "x86_64"}, "os": {"family": "windows", "platform": "windows"}}`))
+	assert.Equal(t, Platform{OS: "windows", Arch: "amd64"}, p)
+
+	p = PlatformFromMetadata(json.RawMessage(`{"host": {"architecture": "aarch64"}, "os": {"family": "debian", "platform": "ubuntu"}}`))
+	assert.Equal(t, Platform{OS: "linux", Arch: "arm64"}, p)
+
+	// Unknown architectures are not accepted
+	p = PlatformFromMetadata(json.RawMessage(`{"host": {"architecture": "made-up-1"}, "os": {"family": "debian"}}`))
+	assert.Equal(t, Platform{OS: "linux"}, p)
+
+	assert.Equal(t, Platform{}, PlatformFromMetadata(nil))
+}
+
+func TestFieldsFor(t *testing.T) {
+	pp, err := NewParsedPolicy(model.Policy{PolicyId: "policy", RevisionIdx: 2, Data: json.RawMessage(testPlatformPolicy)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		platform Platform
+		inputs   string
+	}{
+		{
+			name:     "default",
+			platform: Platform{OS: "linux", Arch: "amd64"},
+			inputs:   `[{"ignore_older":24,"paths":["/var/log/app.log"],"processors":"${host.name} on unix","type":"logfile"}]`,
+		},
+		{
+			name:     "os",
+			platform: Platform{OS: "windows", Arch: "amd64"},
+			inputs:   `[{"ignore_older":24,"paths":["C:\\ProgramData\\app.log"],"processors":"${host.name} on windows","type":"logfile"}]`,
+		},
+		{
+			name:     "os and arch",
+			platform: Platform{OS: "linux", Arch: "arm64"},
+			inputs:   `[{"ignore_older":48,"paths":["/var/log/app.log"],"processors":"${host.name} on unix","type":"logfile"}]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, err := pp.FieldsFor(tc.platform)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.inputs, string(fields["inputs"]))
+			assert.NotContains(t, fields, FieldPlatformVars)
+		})
+	}
+
+	// Substituted once per platform
+	a, err := pp.FieldsFor(Platform{OS: "windows", Arch: "amd64"})
+	require.NoError(t, err)
+	b, err := pp.FieldsFor(Platform{OS: "windows", Arch: "amd64"})
+	require.NoError(t, err)
+	assert.Equal(t, json.RawMessage(a["inputs"]), json.RawMessage(b["inputs"]))
+	assert.Equal(t, 3, pp.platforms.len())
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -54,15 +55,22 @@ type selfMonitorT struct {
 	policyF          policyFetcher
 	policiesIndex    string
 	enrollmentTokenF enrollmentTokenFetcher
+	indexCheckF      indexCheckFunc
+	refusedF         func() map[string][]string
 	checkTime        time.Duration
+
+	reasons []string
 }
 
 // NewSelfMonitor creates the self policy monitor.
 //
 // Ensures that the policy that this Fleet Server attached to exists and that it
-// has a Fleet Server input defined.
-func NewSelfMonitor(fleet config.Fleet, bulker bulk.Bulk, monitor monitor.Monitor, policyId string, reporter status.Reporter) SelfMonitor {
-	return &selfMonitorT{
+// has a Fleet Server input defined. The outputs of the policy and access to the
+// fleet indices are checked as well, and with WithRefusedPolicies the policies
+// not dispatched; a problem degrades the reported state with the reason, and
+// the checks are repeated until it is resolved.
+func NewSelfMonitor(fleet config.Fleet, bulker bulk.Bulk, monitor monitor.Monitor, policyId string, reporter status.Reporter, opts ...SelfMonitorOpt) SelfMonitor {
+	m := &selfMonitorT{
 		log:              log.With().Str("ctx", "policy self monitor").Logger(),
 		fleet:            fleet,
 		bulker:           bulker,
@@ -73,8 +81,24 @@ func NewSelfMonitor(fleet config.Fleet, bulker bulk.Bulk, monitor monitor.Monito
 		policyF:          dl.QueryLatestPolicies,
 		policiesIndex:    dl.FleetPolicies,
 		enrollmentTokenF: findEnrollmentAPIKeys,
+		indexCheckF:      checkIndices,
 		checkTime:        DefaultCheckTime,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// SelfMonitorOpt configures the self policy monitor.
+type SelfMonitorOpt func(m *selfMonitorT)
+
+// WithRefusedPolicies degrades the reported state while the policy monitor
+// does not dispatch policies for their invalid PEM material.
+func WithRefusedPolicies(pm Monitor) SelfMonitorOpt {
+	return func(m *selfMonitorT) {
+		m.refusedF = pm.Refused
+	}
 }
 
 // Run runs the monitor.
@@ -106,12 +130,14 @@ LOOP:
 				break LOOP
 			}
 		case hits := <-s.Output():
-			policies := make([]model.Policy, len(hits))
-			for i, hit := range hits {
-				err := hit.Unmarshal(&policies[i])
-				if err != nil {
-					return err
+			policies := make([]model.Policy, 0, len(hits))
+			for _, hit := range hits {
+				var policy model.Policy
+				if err := hit.Unmarshal(&policy); err != nil {
+					dl.DeadLetter(m.bulker, m.policiesIndex, hit, err)
+					continue
 				}
+				policies = append(policies, policy)
 			}
 			status, err := m.processPolicies(ctx, policies)
 			if err != nil {
@@ -234,6 +260,24 @@ func (m *selfMonitorT) updateStatus(ctx context.Context) (proto.StateObserved_St
 			"enrollment_token": tokens[0].ApiKey,
 		}
 	}
+
+	reasons := append(checkPolicyOutputs(m.policy.Data), m.indexCheckF(ctx, m.bulker)...)
+	if m.refusedF != nil {
+		reasons = append(reasons, refusedReasons(m.refusedF())...)
+	}
+	if len(reasons) != 0 {
+		status = proto.StateObserved_DEGRADED
+		extendMsg += "; " + strings.Join(reasons, "; ")
+	}
+	if strings.Join(reasons, "\n") != strings.Join(m.reasons, "\n") {
+		if len(reasons) != 0 {
+			m.log.Warn().Strs("reasons", reasons).Msg("Fleet Server policy cannot be fully served")
+		} else if len(m.reasons) != 0 {
+			m.log.Info().Msg("Fleet Server policy problems resolved")
+		}
+		m.reasons = reasons
+	}
+
 	m.status = status
 	if m.policyId == "" {
 		m.reporter.Status(status, fmt.Sprintf("Running on default policy with Fleet Server integration%s", extendMsg), payload)
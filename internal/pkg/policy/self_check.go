@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+)
+
+const (
+	outputTypeElasticsearch       = "elasticsearch"
+	outputTypeRemoteElasticsearch = "remote_elasticsearch"
+)
+
+// requiredIndices are the indices Fleet Server reads to serve its agents; a
+// missing index is fine, it is created on first write.
+var requiredIndices = []string{
+	dl.FleetActions,
+	dl.FleetActionsResults,
+	dl.FleetAgents,
+	dl.FleetArtifacts,
+	dl.FleetEnrollmentAPIKeys,
+	dl.FleetPolicies,
+	dl.FleetServers,
+}
+
+var searchNothing = []byte(`{"size":0,"track_total_hits":false}`)
+
+// indexCheckFunc returns a reason for each required index that cannot be read.
+type indexCheckFunc func(ctx context.Context, bulker bulk.Bulk) []string
+
+type policyOutput struct {
+	Type         string   `json:"type"`
+	Hosts        []string `json:"hosts"`
+	ServiceToken string   `json:"service_token"`
+}
+
+type policyOutputs struct {
+	Outputs     map[string]policyOutput    `json:"outputs"`
+	Permissions map[string]json.RawMessage `json:"output_permissions"`
+}
+
+// checkPolicyOutputs returns the reasons the outputs of the policy cannot be
+// served to the agents, in a stable order.
+func checkPolicyOutputs(data json.RawMessage) []string {
+	var p policyOutputs
+	if err := json.Unmarshal(data, &p); err != nil {
+		return []string{fmt.Sprintf("cannot parse policy outputs: %v", err)}
+	}
+
+	names := make([]string, 0, len(p.Outputs))
+	for name := range p.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var reasons []string
+	for _, name := range names {
+		out := p.Outputs[name]
+		switch out.Type {
+		case outputTypeElasticsearch, outputTypeRemoteElasticsearch:
+			if len(out.Hosts) == 0 {
+				reasons = append(reasons, fmt.Sprintf("output %q has no hosts", name))
+			}
+		}
+		if out.Type == outputTypeRemoteElasticsearch && out.ServiceToken == "" {
+			reasons = append(reasons, fmt.Sprintf("remote output %q is missing its service_token", name))
+		}
+		// Without output permissions the agents fall back to default
+		// permissions; an output missing from them gets no API key at all.
+		if p.Permissions != nil && len(p.Permissions[name]) == 0 {
+			reasons = append(reasons, fmt.Sprintf("output %q has no output_permissions", name))
+		}
+	}
+	return reasons
+}
+
+// checkIndices searches each required index for nothing, which fails only if
+// Fleet Server is not allowed to read it.
+func checkIndices(ctx context.Context, bulker bulk.Bulk) []string {
+	ops := make([]bulk.SearchOp, len(requiredIndices))
+	for i, index := range requiredIndices {
+		ops[i] = bulk.SearchOp{Index: []string{index}, Body: searchNothing}
+	}
+
+	var reasons []string
+	for i, res := range bulker.MSearch(ctx, ops) {
+		if res.Err != nil && !errors.Is(res.Err, es.ErrIndexNotFound) {
+			reasons = append(reasons, fmt.Sprintf("cannot read index %s: %v", requiredIndices[i], res.Err))
+		}
+	}
+	return reasons
+}
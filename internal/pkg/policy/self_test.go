@@ -564,3 +564,83 @@ func (r *FakeReporter) Current() (proto.StateObserved_Status, string, map[string
 	defer r.lock.Unlock()
 	return r.status, r.msg, r.payload
 }
+
+func TestCheckPolicyOutputs(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "no outputs", data: `{"inputs":[{"type":"fleet-server"}]}`},
+		{
+			name: "valid",
+			data: `{"outputs":{"default":{"type":"elasticsearch","hosts":["https://es:9200"]},"remote":{"type":"remote_elasticsearch","hosts":["https://remote:9200"],"service_token":"token"}},"output_permissions":{"default":{},"remote":{}}}`,
+		},
+		{
+			name: "no permissions section",
+			data: `{"outputs":{"default":{"type":"elasticsearch","hosts":["https://es:9200"]}}}`,
+		},
+		{
+			name: "problems",
+			data: `{"outputs":{"default":{"type":"elasticsearch"},"remote":{"type":"remote_elasticsearch","hosts":["https://remote:9200"]}},"output_permissions":{"default":{}}}`,
+			want: []string{
+				`output "default" has no hosts`,
+				`remote output "remote" is missing its service_token`,
+				`output "remote" has no output_permissions`,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := checkPolicyOutputs(json.RawMessage(tc.data))
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSelfMonitor_IndexAccessDegraded(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := config.Fleet{
+		Agent: config.Agent{
+			ID: "agent-id",
+		},
+	}
+	reporter := &FakeReporter{}
+	monitor := NewSelfMonitor(cfg, ftesting.MockBulk{}, mock.NewMockIndexMonitor(), "", reporter)
+	sm := monitor.(*selfMonitorT)
+
+	reasons := []string{"cannot read index .fleet-agents: security_exception"}
+	sm.indexCheckF = func(ctx context.Context, bulker bulk.Bulk) []string {
+		return reasons
+	}
+	sm.policy = &model.Policy{
+		PolicyId: "policy-id",
+		Data:     json.RawMessage(`{"inputs":[{"type":"fleet-server"}]}`),
+	}
+
+	status, err := sm.updateStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != proto.StateObserved_DEGRADED {
+		t.Fatalf("should be reported as degraded; instead its %s", status)
+	}
+	_, msg, _ := reporter.Current()
+	if msg != "Running on default policy with Fleet Server integration; cannot read index .fleet-agents: security_exception" {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+
+	// resolved on the next check
+	reasons = nil
+	status, err = sm.updateStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != proto.StateObserved_HEALTHY {
+		t.Fatalf("should be reported as healthy; instead its %s", status)
+	}
+}
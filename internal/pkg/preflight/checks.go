@@ -0,0 +1,278 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/certmon"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/ver"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+const (
+	kMaxClockSkew = 30 * time.Second
+	kMinFreeDisk  = 100 * 1024 * 1024
+)
+
+const fleetIndexPattern = ".fleet-*"
+
+// fleetIndices must exist before agents can enroll; they are created by
+// Kibana when Fleet is set up, under their names: Kibana knows nothing of the
+// indices they are resolved to.
+var fleetIndices = []string{dl.FleetPolicies, dl.FleetEnrollmentAPIKeys}
+
+// The privileges of the fleet-server service account Fleet Server relies on.
+var (
+	requiredClusterPrivileges = []string{"monitor", "manage_own_api_key"}
+	requiredIndexPrivileges   = []string{"read", "write", "monitor", "create_index", "auto_configure"}
+)
+
+// VersionCheck verifies Elasticsearch is compatible with this Fleet Server.
+func VersionCheck(esCli *elasticsearch.Client, fleetVersion string) Check {
+	return Check{
+		Name: "elasticsearch version",
+		Run: func(ctx context.Context) (Status, string) {
+			err := ver.CheckCompatibility(ctx, esCli, fleetVersion)
+			switch {
+			case err == nil:
+				return StatusPass, fmt.Sprintf("compatible with Fleet Server %s", fleetVersion)
+			case errors.Is(err, ver.ErrUnsupportedVersion):
+				return StatusFail, fmt.Sprintf("Elasticsearch is older than Fleet Server %s; upgrade Elasticsearch first", fleetVersion)
+			}
+			return StatusFail, fmt.Sprintf("cannot fetch Elasticsearch version: %v; check output.elasticsearch.hosts and credentials", err)
+		},
+	}
+}
+
+type indexPrivileges struct {
+	Names      []string `json:"names"`
+	Privileges []string `json:"privileges"`
+}
+
+type hasPrivilegesRequest struct {
+	Cluster []string          `json:"cluster"`
+	Index   []indexPrivileges `json:"index"`
+}
+
+type hasPrivilegesResponse struct {
+	HasAllRequested bool                       `json:"has_all_requested"`
+	Cluster         map[string]bool            `json:"cluster"`
+	Index           map[string]map[string]bool `json:"index"`
+	Error           es.ErrorT                  `json:"error,omitempty"`
+}
+
+// PrivilegesCheck verifies the credentials Fleet Server uses hold the
+// privileges of the fleet-server service account. The roles of the users
+// authenticating with basic auth may grant them per fleet index rather than
+// over the whole pattern, or through privileges the check does not know
+// about, so those lacking any are only warned about.
+func PrivilegesCheck(esCli *elasticsearch.Client, basicAuth bool) Check {
+	return Check{
+		Name: "elasticsearch privileges",
+		Run: func(ctx context.Context) (Status, string) {
+			body, err := json.Marshal(hasPrivilegesRequest{
+				Cluster: requiredClusterPrivileges,
+				Index: []indexPrivileges{{
+					Names:      []string{fleetIndexPattern},
+					Privileges: requiredIndexPrivileges,
+				}},
+			})
+			if err != nil {
+				return StatusFail, err.Error()
+			}
+
+			res, err := esCli.Security.HasPrivileges(
+				bytes.NewReader(body),
+				esCli.Security.HasPrivileges.WithContext(ctx),
+			)
+			if err != nil {
+				return StatusWarn, fmt.Sprintf("cannot check privileges: %v", err)
+			}
+			defer res.Body.Close()
+
+			var resp hasPrivilegesResponse
+			if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+				return StatusWarn, fmt.Sprintf("cannot check privileges: %v", err)
+			}
+			if err := es.TranslateError(res.StatusCode, resp.Error); err != nil {
+				return StatusWarn, fmt.Sprintf("cannot check privileges: %v", err)
+			}
+			return privilegesStatus(resp, basicAuth)
+		},
+	}
+}
+
+func privilegesStatus(resp hasPrivilegesResponse, basicAuth bool) (Status, string) {
+	if resp.HasAllRequested {
+		return StatusPass, "has the fleet-server service account privileges"
+	}
+
+	var missing []string
+	for name, ok := range resp.Cluster {
+		if !ok {
+			missing = append(missing, "cluster:"+name)
+		}
+	}
+	for index, privs := range resp.Index {
+		for name, ok := range privs {
+			if !ok {
+				missing = append(missing, index+":"+name)
+			}
+		}
+	}
+	sort.Strings(missing)
+
+	if basicAuth {
+		return StatusWarn, fmt.Sprintf("user may lack privileges %s; grant them to its roles, or use a service token of the elastic/fleet-server service account in output.elasticsearch.service_token", strings.Join(missing, ", "))
+	}
+	return StatusFail, fmt.Sprintf("missing privileges %s; use a service token of the elastic/fleet-server service account in output.elasticsearch.service_token", strings.Join(missing, ", "))
+}
+
+// IndicesCheck verifies Fleet has been set up, the fleet indices are system
+// indices managed by Elasticsearch and have no index templates of their own.
+// The indices are checked where they are resolved to.
+func IndicesCheck(esCli *elasticsearch.Client) Check {
+	return Check{
+		Name: "fleet indices",
+		Run: func(ctx context.Context) (Status, string) {
+			var missing, renamed []string
+			for _, name := range fleetIndices {
+				index := es.ResolveIndex(name)
+				res, err := esCli.Indices.Exists(
+					[]string{index},
+					esCli.Indices.Exists.WithContext(ctx),
+				)
+				if err != nil {
+					return StatusWarn, fmt.Sprintf("cannot check index %s: %v", index, err)
+				}
+				res.Body.Close()
+
+				switch res.StatusCode {
+				case http.StatusOK:
+				case http.StatusNotFound:
+					if index == name {
+						missing = append(missing, index)
+					} else {
+						renamed = append(renamed, index)
+					}
+				default:
+					return StatusWarn, fmt.Sprintf("cannot check index %s: status %d", index, res.StatusCode)
+				}
+			}
+			return indicesStatus(missing, renamed)
+		},
+	}
+}
+
+func indicesStatus(missing, renamed []string) (Status, string) {
+	var msgs []string
+	if len(missing) != 0 {
+		msgs = append(msgs, fmt.Sprintf("missing %s; set up Fleet in Kibana before enrolling agents", strings.Join(missing, ", ")))
+	}
+	if len(renamed) != 0 {
+		msgs = append(msgs, fmt.Sprintf("missing %s; Kibana only writes the .fleet- indices under their own names, create them as aliases of those or change server.indices", strings.Join(renamed, ", ")))
+	}
+	if len(msgs) != 0 {
+		return StatusWarn, strings.Join(msgs, "; ")
+	}
+	return StatusPass, "present"
+}
+
+// CertificateCheck verifies the certificate, a PEM file or inline PEM, is
+// valid now and does not expire within warn.
+func CertificateCheck(name, cert string, warn time.Duration, now func() time.Time) Check {
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) (Status, string) {
+			certs, err := certmon.Load(cert)
+			if err != nil {
+				return StatusFail, fmt.Sprintf("cannot load certificate: %v", err)
+			}
+			return certStatus(certs[0], now(), warn)
+		},
+	}
+}
+
+func certStatus(c *x509.Certificate, now time.Time, warn time.Duration) (Status, string) {
+	switch {
+	case now.Before(c.NotBefore):
+		return StatusFail, fmt.Sprintf("not valid before %s; check the clock or reissue the certificate", c.NotBefore.UTC().Format(time.RFC3339))
+	case now.After(c.NotAfter):
+		return StatusFail, fmt.Sprintf("expired on %s; renew the certificate", c.NotAfter.UTC().Format(time.RFC3339))
+	case c.NotAfter.Sub(now) < warn:
+		return StatusWarn, fmt.Sprintf("expires on %s; renew the certificate", c.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return StatusPass, fmt.Sprintf("valid until %s", c.NotAfter.UTC().Format(time.RFC3339))
+}
+
+// ClockSkewCheck compares the local clock with the Date header returned by
+// Elasticsearch; the header has a resolution of one second.
+func ClockSkewCheck(esCli *elasticsearch.Client, now func() time.Time) Check {
+	return Check{
+		Name: "clock skew",
+		Run: func(ctx context.Context) (Status, string) {
+			start := now()
+			res, err := esCli.Info(esCli.Info.WithContext(ctx))
+			if err != nil {
+				return StatusWarn, fmt.Sprintf("cannot reach Elasticsearch: %v", err)
+			}
+			res.Body.Close()
+			end := now()
+
+			date, err := http.ParseTime(res.Header.Get("Date"))
+			if err != nil {
+				return StatusWarn, "Elasticsearch returned no Date header"
+			}
+			local := start.Add(end.Sub(start) / 2)
+			return skewStatus(local.Sub(date).Truncate(time.Second))
+		},
+	}
+}
+
+func skewStatus(skew time.Duration) (Status, string) {
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs > kMaxClockSkew {
+		return StatusWarn, fmt.Sprintf("local clock is %s off Elasticsearch; sync the clocks with NTP, action expiration depends on them", skew)
+	}
+	return StatusPass, fmt.Sprintf("%s", skew)
+}
+
+// DiskSpaceCheck verifies there is room left in the directory Fleet Server
+// writes to.
+func DiskSpaceCheck(name, dir string) Check {
+	return Check{
+		Name: name,
+		Run: func(ctx context.Context) (Status, string) {
+			free, err := freeDiskSpace(dir)
+			if err != nil {
+				return StatusWarn, fmt.Sprintf("cannot check free space of %s: %v", dir, err)
+			}
+			return diskStatus(dir, free)
+		},
+	}
+}
+
+func diskStatus(dir string, free uint64) (Status, string) {
+	if free < kMinFreeDisk {
+		return StatusWarn, fmt.Sprintf("only %d MiB free in %s; free up space or move the directory", free>>20, dir)
+	}
+	return StatusPass, fmt.Sprintf("%d MiB free in %s", free>>20, dir)
+}
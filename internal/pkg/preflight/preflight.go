@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package preflight runs the checks done before Fleet Server binds its
+// listeners, so a misconfiguration is reported with what to fix instead of
+// surfacing later as failing agents.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusWarn
+	StatusFail
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusWarn:
+		return "WARN"
+	case StatusFail:
+		return "FAIL"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// CheckFunc returns the status of a check and a message saying what was found
+// and, unless the check passed, what to do about it.
+type CheckFunc func(ctx context.Context) (Status, string)
+
+type Check struct {
+	Name string
+	Run  CheckFunc
+}
+
+type Result struct {
+	Name    string
+	Status  Status
+	Message string
+}
+
+// Run runs the checks in order; a failing check does not stop the others, so
+// every problem is reported at once.
+func Run(ctx context.Context, checks []Check) []Result {
+	results := make([]Result, len(checks))
+	for i, check := range checks {
+		status, msg := check.Run(ctx)
+		results[i] = Result{
+			Name:    check.Name,
+			Status:  status,
+			Message: msg,
+		}
+	}
+	return results
+}
+
+// Failed returns the names of the failed checks.
+func Failed(results []Result) []string {
+	var names []string
+	for _, r := range results {
+		if r.Status == StatusFail {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// Print writes the results as a table.
+func Print(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Status, r.Message)
+	}
+	return tw.Flush()
+}
+
+// Log logs each result at the level matching its status.
+func Log(results []Result) {
+	for _, r := range results {
+		ev := log.Info()
+		switch r.Status {
+		case StatusWarn:
+			ev = log.Warn()
+		case StatusFail:
+			ev = log.Error()
+		}
+		ev.Str("check", r.Name).Str("status", r.Status.String()).Msg(r.Message)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReportsEveryCheck(t *testing.T) {
+	checks := []Check{
+		{Name: "a", Run: func(context.Context) (Status, string) { return StatusPass, "fine" }},
+		{Name: "b", Run: func(context.Context) (Status, string) { return StatusFail, "broken; fix it" }},
+		{Name: "c", Run: func(context.Context) (Status, string) { return StatusWarn, "odd" }},
+	}
+
+	results := Run(context.Background(), checks)
+	require.Len(t, results, 3)
+	assert.Equal(t, []string{"b"}, Failed(results))
+
+	var buf bytes.Buffer
+	require.NoError(t, Print(&buf, results))
+	assert.Equal(t, "CHECK  STATUS  DETAILS\n"+
+		"a      PASS    fine\n"+
+		"b      FAIL    broken; fix it\n"+
+		"c      WARN    odd\n", buf.String())
+}
+
+func TestPrivilegesStatus(t *testing.T) {
+	status, _ := privilegesStatus(hasPrivilegesResponse{HasAllRequested: true}, false)
+	assert.Equal(t, StatusPass, status)
+
+	missing := hasPrivilegesResponse{
+		Cluster: map[string]bool{"monitor": true, "manage_own_api_key": false},
+		Index: map[string]map[string]bool{
+			".fleet-*": {"read": true, "write": false},
+		},
+	}
+	status, msg := privilegesStatus(missing, false)
+	assert.Equal(t, StatusFail, status)
+	assert.Contains(t, msg, "missing privileges .fleet-*:write, cluster:manage_own_api_key;")
+
+	// The roles of a user may grant the privileges per index
+	status, msg = privilegesStatus(missing, true)
+	assert.Equal(t, StatusWarn, status)
+	assert.Contains(t, msg, "may lack privileges .fleet-*:write, cluster:manage_own_api_key;")
+
+	status, _ = privilegesStatus(hasPrivilegesResponse{HasAllRequested: true}, true)
+	assert.Equal(t, StatusPass, status)
+}
+
+func TestIndicesStatus(t *testing.T) {
+	status, _ := indicesStatus(nil, nil)
+	assert.Equal(t, StatusPass, status)
+
+	status, msg := indicesStatus([]string{".fleet-policies"}, nil)
+	assert.Equal(t, StatusWarn, status)
+	assert.Contains(t, msg, "missing .fleet-policies; set up Fleet in Kibana")
+
+	// Kibana does not write the indices renamed by a suffix or override
+	status, msg = indicesStatus(nil, []string{".fleet-policies-tenant1"})
+	assert.Equal(t, StatusWarn, status)
+	assert.Contains(t, msg, "missing .fleet-policies-tenant1; Kibana only writes")
+}
+
+func TestCertificateCheck(t *testing.T) {
+	now := time.Now()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	makePEM := func(notBefore, notAfter time.Time) string {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "fleet-server"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	tests := []struct {
+		name   string
+		cert   string
+		status Status
+	}{
+		{name: "valid", cert: makePEM(now.Add(-time.Hour), now.Add(365*24*time.Hour)), status: StatusPass},
+		{name: "expiring", cert: makePEM(now.Add(-time.Hour), now.Add(24*time.Hour)), status: StatusWarn},
+		{name: "expired", cert: makePEM(now.Add(-2*time.Hour), now.Add(-time.Hour)), status: StatusFail},
+		{name: "not yet valid", cert: makePEM(now.Add(time.Hour), now.Add(2*time.Hour)), status: StatusFail},
+		{name: "missing file", cert: "/nonexistent/cert.pem", status: StatusFail},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			check := CertificateCheck("cert", tc.cert, 30*24*time.Hour, func() time.Time { return now })
+			status, msg := check.Run(context.Background())
+			assert.Equal(t, tc.status, status, msg)
+		})
+	}
+}
+
+func TestSkewStatus(t *testing.T) {
+	status, _ := skewStatus(-2 * time.Second)
+	assert.Equal(t, StatusPass, status)
+	status, _ = skewStatus(-time.Minute)
+	assert.Equal(t, StatusWarn, status)
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	status, _ := diskStatus("/data", 10*1024*1024)
+	assert.Equal(t, StatusWarn, status)
+
+	status, msg := DiskSpaceCheck("disk", t.TempDir()).Run(context.Background())
+	assert.NotEqual(t, StatusFail, status, msg)
+}
@@ -0,0 +1,151 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package redact masks the values of the fields holding secrets in the agent
+// and policy documents before they reach the logs.
+package redact
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// Redacted replaces the values of the redacted fields.
+const Redacted = "[REDACTED]"
+
+// DefaultPatterns match the names of the fields holding the credentials of
+// the outputs, the API keys and the enrollment tokens.
+var DefaultPatterns = []string{
+	"*api_key*",
+	"*token*",
+	"*password*",
+	"*passphrase*",
+	"*secret*",
+	"*private_key*",
+	"key",
+}
+
+// Default is the redactor of the logs of the process.
+var Default = MustNew(DefaultPatterns)
+
+// Redactor masks the values of the fields whose names match one of its
+// patterns, at any depth. The patterns are shell patterns as of path.Match,
+// matched against the names in lower case.
+type Redactor struct {
+	patterns atomic.Value // []string
+}
+
+// New returns the redactor of the patterns; ErrBadPattern when one is
+// malformed.
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	if err := r.Configure(patterns); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MustNew returns the redactor of the patterns, panicking when one is
+// malformed.
+func MustNew(patterns []string) *Redactor {
+	r, err := New(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Validate returns path.ErrBadPattern when one of the patterns is malformed.
+func Validate(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Configure replaces the patterns in place; they are left as they were when
+// one is malformed.
+func (r *Redactor) Configure(patterns []string) error {
+	if err := Validate(patterns); err != nil {
+		return err
+	}
+	lower := make([]string, len(patterns))
+	for i, p := range patterns {
+		lower[i] = strings.ToLower(p)
+	}
+	r.patterns.Store(lower)
+	return nil
+}
+
+// Match tells whether the value of the field is redacted.
+func (r *Redactor) Match(name string) bool {
+	patterns, _ := r.patterns.Load().([]string)
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Value redacts the value decoded from JSON in place, and returns it.
+func (r *Redactor) Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if r.Match(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = r.Value(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = r.Value(e)
+		}
+	}
+	return v
+}
+
+// JSON returns the document redacted. A document that is not JSON is
+// replaced as a whole, as it may hold anything.
+func (r *Redactor) JSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return json.RawMessage(`null`)
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return json.RawMessage(`"` + Redacted + `"`)
+	}
+	redacted, err := json.Marshal(r.Value(v))
+	if err != nil {
+		return json.RawMessage(`"` + Redacted + `"`)
+	}
+	return redacted
+}
+
+// Object returns the document of the value as it is encoded to JSON,
+// redacted.
+func (r *Redactor) Object(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(`"` + Redacted + `"`)
+	}
+	return r.JSON(data)
+}
+
+// JSON returns the document redacted by the default redactor.
+func JSON(data []byte) json.RawMessage {
+	return Default.JSON(data)
+}
+
+// Object returns the document of the value redacted by the default redactor.
+func Object(v interface{}) json.RawMessage {
+	return Default.Object(v)
+}
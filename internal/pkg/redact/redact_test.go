@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package redact
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor_JSON(t *testing.T) {
+	r := MustNew(DefaultPatterns)
+
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"empty", ``, `null`},
+		{"not json", `{"password":`, `"[REDACTED]"`},
+		{"flat", `{"id":"a","access_api_key":"secret"}`, `{"access_api_key":"[REDACTED]","id":"a"}`},
+		{"case", `{"Password":"p","ENROLLMENT_TOKEN":"t"}`, `{"ENROLLMENT_TOKEN":"[REDACTED]","Password":"[REDACTED]"}`},
+		{"nested", `{"outputs":{"default":{"hosts":["h"],"ssl":{"key":"k","certificate":"c"}}}}`, `{"outputs":{"default":{"hosts":["h"],"ssl":{"certificate":"c","key":"[REDACTED]"}}}}`},
+		{"array", `[{"secret_id":1},{"name":"n"}]`, `[{"secret_id":"[REDACTED]"},{"name":"n"}]`},
+		{"exact key", `{"keys":1,"monkey":2}`, `{"keys":1,"monkey":2}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.JSONEq(t, test.out, string(r.JSON([]byte(test.in))))
+		})
+	}
+}
+
+func TestRedactor_Configure(t *testing.T) {
+	r := MustNew(DefaultPatterns)
+
+	err := r.Configure([]string{"[a-"})
+	assert.True(t, errors.Is(err, path.ErrBadPattern))
+	assert.True(t, r.Match("password"), "patterns kept when malformed")
+
+	require.NoError(t, r.Configure([]string{"*_cert"}))
+	assert.False(t, r.Match("password"))
+	assert.True(t, r.Match("client_cert"))
+
+	type doc struct {
+		Id   string `json:"id"`
+		Cert string `json:"client_cert"`
+	}
+	assert.JSONEq(t, `{"id":"a","client_cert":"[REDACTED]"}`, string(r.Object(&doc{Id: "a", Cert: "c"})))
+}
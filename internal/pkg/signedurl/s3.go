@@ -0,0 +1,133 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kS3Algorithm     = "AWS4-HMAC-SHA256"
+	kS3DateFormat    = "20060102T150405Z"
+	kS3Service       = "s3"
+	kS3UnsignedBody  = "UNSIGNED-PAYLOAD"
+	kS3MaxExpiration = 7 * 24 * time.Hour
+)
+
+// S3 presigns the URLs of the objects of an S3 compatible store with
+// Signature Version 4, in the query.
+type S3 struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// Sign presigns the URL for the method; S3 accepts a week at most.
+func (s S3) Sign(method string, u *url.URL, now time.Time, ttl time.Duration) (*url.URL, error) {
+	if ttl <= 0 || ttl > kS3MaxExpiration {
+		return nil, fmt.Errorf("s3 presigned urls expire within %s", kS3MaxExpiration)
+	}
+
+	now = now.UTC()
+	amzDate := now.Format(kS3DateFormat)
+	scope := strings.Join([]string{amzDate[:8], s.Region, kS3Service, "aws4_request"}, "/")
+
+	signed := *u
+	q := signed.Query()
+	q.Set("X-Amz-Algorithm", kS3Algorithm)
+	q.Set("X-Amz-Credential", s.AccessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", "host")
+	query := canonicalQuery(q)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath(u.EscapedPath()),
+		query,
+		"host:" + u.Host + "\n",
+		"host",
+		kS3UnsignedBody,
+	}, "\n")
+
+	reqHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		kS3Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(reqHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, kS3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	signed.RawQuery = query + "&X-Amz-Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return &signed, nil
+}
+
+// canonicalQuery encodes the query sorted by key, with the URI encoding of
+// SigV4.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// canonicalPath encodes the path as SigV4 expects, the slashes kept.
+func canonicalPath(escaped string) string {
+	if escaped == "" {
+		return "/"
+	}
+	segments := strings.Split(escaped, "/")
+	for i, seg := range segments {
+		if raw, err := url.PathUnescape(seg); err == nil {
+			segments[i] = uriEncode(raw)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// uriEncode percent encodes all but the unreserved characters of RFC 3986.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package signedurl signs URLs granting a time limited access to an object on
+// a CDN or an object store, so Fleet Server can redirect the agents to it.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+const (
+	ParamExpires   = "expires"
+	ParamSignature = "signature"
+)
+
+var (
+	ErrExpired          = errors.New("signed url expired")
+	ErrInvalidSignature = errors.New("invalid url signature")
+)
+
+// Signer signs the URL of an object for the method until now plus ttl.
+type Signer interface {
+	Sign(method string, u *url.URL, now time.Time, ttl time.Duration) (*url.URL, error)
+}
+
+// HMAC signs the name of the object, the last element of the path, and the
+// expiry with a shared secret; the CDN, or Fleet Server when the CDN pulls
+// from it, verifies the signature. The path leading to the object is not
+// signed, so the same signature holds on the CDN and at its origin.
+type HMAC struct {
+	Secret []byte
+}
+
+// Sign adds the expiry, in Unix time, and the signature to the query. The
+// signature does not depend on the method.
+func (h HMAC) Sign(_ string, u *url.URL, now time.Time, ttl time.Duration) (*url.URL, error) {
+	expires := strconv.FormatInt(now.Add(ttl).Unix(), 10)
+
+	signed := *u
+	q := signed.Query()
+	q.Set(ParamExpires, expires)
+	q.Set(ParamSignature, h.signature(path.Base(u.Path), expires))
+	signed.RawQuery = q.Encode()
+	return &signed, nil
+}
+
+// Verify checks the signature of the object and that it has not expired.
+func (h HMAC) Verify(object, expires, signature string, now time.Time) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	want := h.signature(object, expires)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > exp {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (h HMAC) signature(object, expires string) string {
+	mac := hmac.New(sha256.New, h.Secret)
+	mac.Write([]byte(object))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
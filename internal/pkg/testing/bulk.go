@@ -42,6 +42,10 @@ func (m MockBulk) Read(ctx context.Context, index, id string, opts ...bulk.Opt)
 	return nil, nil
 }
 
+func (m MockBulk) ReadWithMeta(ctx context.Context, index, id string, opts ...bulk.Opt) ([]byte, bulk.DocMeta, error) {
+	return nil, bulk.DocMeta{}, nil
+}
+
 func (m MockBulk) MUpdate(ctx context.Context, ops []bulk.BulkOp, opts ...bulk.Opt) error {
 	return nil
 }
@@ -50,6 +54,14 @@ func (m MockBulk) Search(ctx context.Context, index []string, body []byte, opts
 	return &es.ResultT{}, nil
 }
 
+func (m MockBulk) MSearch(ctx context.Context, ops []bulk.SearchOp, opts ...bulk.Opt) []bulk.SearchResult {
+	results := make([]bulk.SearchResult, len(ops))
+	for i := range ops {
+		results[i].Result = &es.ResultT{}
+	}
+	return results
+}
+
 func (m MockBulk) Client() *elasticsearch.Client {
 	return nil
 }
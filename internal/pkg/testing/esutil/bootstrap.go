@@ -22,7 +22,10 @@ type indexConfig struct {
 var indexConfigs = map[string]indexConfig{
 	// Commenting out the boostrapping for now here, just in case if it needs to be "enabled" again.
 	// Will remove all the boostrapping code completely later once all is fully integrated
-	".fleet-actions-results": {mapping: es.MappingActionResult, datastream: true},
+	".fleet-actions-results":   {mapping: es.MappingActionResult, datastream: true},
+	".fleet-agent-components":  {mapping: es.MappingAgentComponent, datastream: true},
+	".fleet-dispatch-journal":  {mapping: es.MappingDispatchEntry, datastream: true},
+	".fleet-enrollment-events": {mapping: es.MappingEnrollmentEvent, datastream: true},
 }
 
 // Bootstrap creates .fleet-actions data stream
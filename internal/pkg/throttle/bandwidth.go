@@ -0,0 +1,417 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package throttle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+
+	"golang.org/x/time/rate"
+)
+
+// Bandwidth throttles the bytes transferred with nested budgets: the global
+// budget is shared by all the transfers, a policy budget by the transfers of
+// the agents of the policy and an agent budget by the transfers of the agent.
+// A transfer waits until its bytes fit in each of its budgets. The policy and
+// agent budgets only exist while they have transfers.
+//
+// The policies of the configuration have their own budget, and may bound
+// their transfers in progress: the transfers past the bound wait in a queue
+// of the policy and start in order as the others end, so the upgrade of the
+// agents of a remote site does not congest its link.
+type Bandwidth struct {
+	global    *budget
+	perPolicy int64
+	perAgent  int64
+	policyCfg map[string]config.PolicyBandwidth
+
+	mut      sync.Mutex
+	policies map[string]*budget
+	agents   map[string]*budget
+	queues   map[string]*queue
+
+	transfers int64  // atomic
+	rejected  uint64 // atomic
+}
+
+// ErrQueueFull is returned when a policy has max_queued transfers waiting.
+var ErrQueueFull = errors.New("transfer queue full")
+
+// BandwidthStats reports the use of the global budget of a Bandwidth.
+type BandwidthStats struct {
+	Limit     int64  // bytes per second; 0 when not limited
+	Rate      uint64 // bytes transferred in the last second
+	Bytes     uint64 // bytes transferred in total
+	Transfers int64  // transfers in progress
+	Policies  int    // policy budgets in use
+	Agents    int    // agent budgets in use
+	Queued    int    // transfers waiting in the queues of the policies
+	Rejected  uint64 // transfers refused as their queue was full
+}
+
+// PolicyBandwidthStats reports the use of the budget of a policy of the
+// configuration.
+type PolicyBandwidthStats struct {
+	Limit     int64  // bytes per second; 0 when not limited
+	Rate      uint64 // bytes transferred in the last second
+	Transfers int    // transfers in progress
+	Queued    int    // transfers waiting in the queue
+}
+
+// NewBandwidth returns the bandwidth throttle of the configuration.
+func NewBandwidth(cfg *config.Bandwidth) *Bandwidth {
+	b := &Bandwidth{
+		global:    newBudget(cfg.Global),
+		perPolicy: cfg.PerPolicy,
+		perAgent:  cfg.PerAgent,
+		policyCfg: cfg.Policies,
+		policies:  make(map[string]*budget),
+		agents:    make(map[string]*budget),
+		queues:    make(map[string]*queue),
+	}
+	for id, p := range cfg.Policies {
+		if p.MaxTransfers > 0 {
+			b.queues[id] = &queue{max: p.MaxTransfers, maxQueued: p.MaxQueued}
+		}
+	}
+	return b
+}
+
+// Transfer starts a transfer for the agent of the policy once the policy has
+// room for it; it must be closed once done to release its budgets. It returns
+// ErrQueueFull when the queue of the policy is full, or the error of ctx when
+// done while queued.
+func (b *Bandwidth) Transfer(ctx context.Context, policyID, agentID string) (*Transfer, error) {
+	if err := b.enqueue(ctx, policyID); err != nil {
+		return nil, err
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	atomic.AddInt64(&b.transfers, 1)
+	return &Transfer{
+		b:        b,
+		policyID: policyID,
+		agentID:  agentID,
+		budgets: []*budget{
+			acquireBudget(b.agents, agentID, b.perAgent),
+			acquireBudget(b.policies, policyID, b.policyLimit(policyID)),
+			b.global,
+		},
+	}, nil
+}
+
+// enqueue waits for a transfer of the policy to be allowed.
+func (b *Bandwidth) enqueue(ctx context.Context, policyID string) error {
+	b.mut.Lock()
+	q, ok := b.queues[policyID]
+	if !ok {
+		b.mut.Unlock()
+		return nil
+	}
+	if q.active < q.max {
+		q.active++
+		b.mut.Unlock()
+		return nil
+	}
+	if q.maxQueued > 0 && len(q.waiting) >= q.maxQueued {
+		b.mut.Unlock()
+		atomic.AddUint64(&b.rejected, 1)
+		return ErrQueueFull
+	}
+	ready := make(chan struct{})
+	q.waiting = append(q.waiting, ready)
+	b.mut.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if !q.remove(ready) {
+		// Started meanwhile; the transfer is handed to the next one
+		q.release()
+	}
+	return ctx.Err()
+}
+
+// WARNING: Assumes the Bandwidth mutex is held
+func (b *Bandwidth) policyLimit(policyID string) int64 {
+	if p, ok := b.policyCfg[policyID]; ok && p.Rate > 0 {
+		return p.Rate
+	}
+	return b.perPolicy
+}
+
+// Stats returns the use of the global budget.
+func (b *Bandwidth) Stats() BandwidthStats {
+	b.mut.Lock()
+	policies, agents := len(b.policies), len(b.agents)
+	queued := 0
+	for _, q := range b.queues {
+		queued += len(q.waiting)
+	}
+	b.mut.Unlock()
+
+	return BandwidthStats{
+		Limit:     b.global.limit,
+		Rate:      b.global.meter.rate(time.Now()),
+		Bytes:     atomic.LoadUint64(&b.global.bytes),
+		Transfers: atomic.LoadInt64(&b.transfers),
+		Policies:  policies,
+		Agents:    agents,
+		Queued:    queued,
+		Rejected:  atomic.LoadUint64(&b.rejected),
+	}
+}
+
+// PolicyStats returns the use of the budgets of the policies of the
+// configuration, by policy id.
+func (b *Bandwidth) PolicyStats() map[string]PolicyBandwidthStats {
+	now := time.Now()
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	stats := make(map[string]PolicyBandwidthStats, len(b.policyCfg))
+	for id := range b.policyCfg {
+		s := PolicyBandwidthStats{Limit: b.policyLimit(id)}
+		if bud, ok := b.policies[id]; ok {
+			s.Rate = bud.meter.rate(now)
+			s.Transfers = bud.refs
+		}
+		if q, ok := b.queues[id]; ok {
+			s.Queued = len(q.waiting)
+		}
+		stats[id] = s
+	}
+	return stats
+}
+
+func (b *Bandwidth) release(t *Transfer) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	atomic.AddInt64(&b.transfers, -1)
+	releaseBudget(b.agents, t.agentID)
+	releaseBudget(b.policies, t.policyID)
+	if q, ok := b.queues[t.policyID]; ok {
+		q.release()
+	}
+}
+
+// queue bounds the transfers of a policy to max, the others waiting in order.
+//
+// WARNING: Accessed with the Bandwidth mutex held
+type queue struct {
+	max       int
+	maxQueued int
+	active    int
+	waiting   []chan struct{}
+}
+
+// release hands the slot of an ended transfer to the first waiting one.
+func (q *queue) release() {
+	if len(q.waiting) == 0 {
+		q.active--
+		return
+	}
+	close(q.waiting[0])
+	q.waiting[0] = nil
+	q.waiting = q.waiting[1:]
+}
+
+func (q *queue) remove(ready chan struct{}) bool {
+	for i, c := range q.waiting {
+		if c == ready {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Transfer draws the bytes it transfers from its budgets.
+type Transfer struct {
+	b        *Bandwidth
+	policyID string
+	agentID  string
+	budgets  []*budget
+	once     sync.Once
+}
+
+// Wait blocks until the n bytes fit in every budget of the transfer, or the
+// context is done.
+func (t *Transfer) Wait(ctx context.Context, n int) error {
+	for n > 0 {
+		chunk := n
+		for _, b := range t.budgets {
+			if b.lim != nil && chunk > b.lim.Burst() {
+				chunk = b.lim.Burst()
+			}
+		}
+		if err := t.wait(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// wait reserves n bytes, at most the burst of the budgets, in every budget and
+// sleeps until the latest reservation is due.
+func (t *Transfer) wait(ctx context.Context, n int) error {
+	now := time.Now()
+
+	var delay time.Duration
+	reservations := make([]*rate.Reservation, 0, len(t.budgets))
+	for _, b := range t.budgets {
+		if b.lim == nil {
+			continue
+		}
+		r := b.lim.ReserveN(now, n)
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			for _, r := range reservations {
+				r.Cancel()
+			}
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	for _, b := range t.budgets {
+		b.add(time.Now(), n)
+	}
+	return nil
+}
+
+// Reader returns r throttled by the transfer.
+func (t *Transfer) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, t: t, r: r}
+}
+
+// Close releases the budgets of the transfer.
+func (t *Transfer) Close() error {
+	t.once.Do(func() { t.b.release(t) })
+	return nil
+}
+
+type reader struct {
+	ctx context.Context
+	t   *Transfer
+	r   io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.t.Wait(r.ctx, n); werr != nil {
+			return 0, werr
+		}
+	}
+	return n, err
+}
+
+// budget is a byte rate shared by its references; lim is nil when it does not
+// limit.
+type budget struct {
+	limit int64
+	lim   *rate.Limiter
+	refs  int
+
+	bytes uint64 // atomic
+	meter meter
+}
+
+func newBudget(limit int64) *budget {
+	b := &budget{limit: limit}
+	if limit > 0 {
+		b.lim = rate.NewLimiter(rate.Limit(limit), int(limit))
+	}
+	return b
+}
+
+func (b *budget) add(now time.Time, n int) {
+	atomic.AddUint64(&b.bytes, uint64(n))
+	b.meter.add(now, uint64(n))
+}
+
+// WARNING: Assumes the Bandwidth mutex is held
+func acquireBudget(budgets map[string]*budget, key string, limit int64) *budget {
+	b, ok := budgets[key]
+	if !ok {
+		b = newBudget(limit)
+		budgets[key] = b
+	}
+	b.refs++
+	return b
+}
+
+// WARNING: Assumes the Bandwidth mutex is held
+func releaseBudget(budgets map[string]*budget, key string) {
+	b, ok := budgets[key]
+	if !ok {
+		return
+	}
+	if b.refs--; b.refs <= 0 {
+		delete(budgets, key)
+	}
+}
+
+// meter counts the bytes of the current and of the last second.
+type meter struct {
+	mut  sync.Mutex
+	sec  int64
+	cur  uint64
+	last uint64
+}
+
+func (m *meter) add(now time.Time, n uint64) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	m.roll(now.Unix())
+	m.cur += n
+}
+
+// rate returns the bytes of the last complete second.
+func (m *meter) rate(now time.Time) uint64 {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	m.roll(now.Unix())
+	return m.last
+}
+
+func (m *meter) roll(sec int64) {
+	switch {
+	case sec == m.sec:
+	case sec == m.sec+1:
+		m.last, m.cur = m.cur, 0
+	default:
+		m.last, m.cur = 0, 0
+	}
+	m.sec = sec
+}
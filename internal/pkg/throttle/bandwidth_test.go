@@ -0,0 +1,207 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestBandwidthUnlimited(t *testing.T) {
+	b := NewBandwidth(&config.Bandwidth{})
+
+	tr, err := b.Transfer(context.Background(), "policy-1", "agent-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(tr.Reader(context.Background(), bytes.NewReader(make([]byte, 1<<20))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1<<20 {
+		t.Fatalf("read %d bytes", len(data))
+	}
+
+	stats := b.Stats()
+	if stats.Bytes != 1<<20 || stats.Transfers != 1 || stats.Policies != 1 || stats.Agents != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	tr.Close()
+	tr.Close()
+	stats = b.Stats()
+	if stats.Transfers != 0 || stats.Policies != 0 || stats.Agents != 0 {
+		t.Errorf("budgets not released %+v", stats)
+	}
+}
+
+func TestBandwidthNested(t *testing.T) {
+	b := NewBandwidth(&config.Bandwidth{PerPolicy: 1000, PerAgent: 100000})
+
+	// Two agents of the policy share its budget; each starts with a full
+	// burst, so the second transfer waits about a second.
+	ctx := context.Background()
+	tr1 := mustTransfer(t, b, "policy-1", "agent-1")
+	defer tr1.Close()
+	tr2 := mustTransfer(t, b, "policy-1", "agent-2")
+	defer tr2.Close()
+
+	start := time.Now()
+	if err := tr1.Wait(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr2.Wait(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Errorf("policy budget not shared; waited %s", d)
+	}
+
+	// Another policy has its own budget
+	tr3 := mustTransfer(t, b, "policy-2", "agent-3")
+	defer tr3.Close()
+	start = time.Now()
+	if err := tr3.Wait(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("policy budget shared across policies; waited %s", d)
+	}
+
+	if stats := b.Stats(); stats.Policies != 2 || stats.Agents != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBandwidthCancel(t *testing.T) {
+	b := NewBandwidth(&config.Bandwidth{Global: 100})
+
+	tr := mustTransfer(t, b, "policy-1", "agent-1")
+	defer tr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Larger than the burst; waits in chunks until cancelled
+	if err := tr.Wait(ctx, 1000); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if stats := b.Stats(); stats.Bytes != 100 {
+		t.Errorf("expected the first chunk only, got %d bytes", stats.Bytes)
+	}
+}
+
+func TestBandwidthPolicyQueue(t *testing.T) {
+	b := NewBandwidth(&config.Bandwidth{
+		PerPolicy: 1000,
+		Policies: map[string]config.PolicyBandwidth{
+			"branch": {Rate: 500, MaxTransfers: 1, MaxQueued: 1},
+		},
+	})
+
+	tr1 := mustTransfer(t, b, "branch", "agent-1")
+
+	// The second transfer waits for the first, the third does not fit
+	started := make(chan *Transfer)
+	go func() {
+		tr, err := b.Transfer(context.Background(), "branch", "agent-2")
+		if err != nil {
+			t.Error(err)
+		}
+		started <- tr
+	}()
+	waitQueued(t, b, 1)
+	if _, err := b.Transfer(context.Background(), "branch", "agent-3"); err != ErrQueueFull {
+		t.Errorf("expected queue full, got %v", err)
+	}
+
+	// Other policies are not queued
+	other := mustTransfer(t, b, "datacenter", "agent-4")
+	other.Close()
+
+	stats := b.PolicyStats()
+	if s := stats["branch"]; s.Limit != 500 || s.Transfers != 1 || s.Queued != 1 {
+		t.Errorf("unexpected policy stats %+v", s)
+	}
+	if len(stats) != 1 {
+		t.Errorf("expected the stats of the configured policies only, got %v", stats)
+	}
+
+	tr1.Close()
+	select {
+	case tr2 := <-started:
+		tr2.Close()
+	case <-time.After(time.Second):
+		t.Fatal("queued transfer not released")
+	}
+
+	if s := b.Stats(); s.Queued != 0 || s.Rejected != 1 || s.Transfers != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestBandwidthPolicyQueueCancel(t *testing.T) {
+	b := NewBandwidth(&config.Bandwidth{
+		Policies: map[string]config.PolicyBandwidth{
+			"branch": {MaxTransfers: 1},
+		},
+	})
+
+	tr1 := mustTransfer(t, b, "branch", "agent-1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.Transfer(ctx, "branch", "agent-2"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	waitQueued(t, b, 0)
+
+	// The canceled transfer does not hold the slot
+	tr1.Close()
+	tr2 := mustTransfer(t, b, "branch", "agent-3")
+	tr2.Close()
+}
+
+func mustTransfer(t *testing.T, b *Bandwidth, policyID, agentID string) *Transfer {
+	t.Helper()
+	tr, err := b.Transfer(context.Background(), policyID, agentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func waitQueued(t *testing.T, b *Bandwidth, n int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if b.Stats().Queued == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d queued transfers, got %d", n, b.Stats().Queued)
+}
+
+func TestMeter(t *testing.T) {
+	var m meter
+	now := time.Unix(1000, 0)
+
+	m.add(now, 10)
+	m.add(now.Add(500*time.Millisecond), 5)
+	if r := m.rate(now); r != 0 {
+		t.Errorf("expected no complete second, got %d", r)
+	}
+	if r := m.rate(now.Add(time.Second)); r != 15 {
+		t.Errorf("expected 15, got %d", r)
+	}
+	if r := m.rate(now.Add(3 * time.Second)); r != 0 {
+		t.Errorf("expected idle seconds to reset, got %d", r)
+	}
+}
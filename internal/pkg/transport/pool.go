@@ -0,0 +1,127 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package transport shares the outbound HTTP transports of the server by
+// purpose, so the clients of a purpose share their connections instead of
+// each holding its own.
+package transport
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Purposes of the outbound transports.
+const (
+	PurposeElasticsearch         = "elasticsearch"
+	PurposeElasticsearchLongPoll = "elasticsearch_long_poll"
+	PurposeElasticsearchMirror   = "elasticsearch_mirror"
+)
+
+// Default is the pool of the transports of the process.
+var Default = NewPool()
+
+// BuildFunc builds the transport of a purpose.
+type BuildFunc func() (*http.Transport, error)
+
+// Pool holds a transport per purpose.
+type Pool struct {
+	mut     sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	settings  interface{}
+	transport *http.Transport
+	done      chan struct{}
+}
+
+// NewPool returns an empty pool.
+func NewPool() *Pool {
+	return &Pool{
+		entries: make(map[string]*entry),
+	}
+}
+
+// Get returns the transport of the purpose. It is built the first time, and
+// again once the settings it is built from change, like on a configuration
+// reload; the transport replaced keeps the connections in use and closes the
+// idle ones. With a DNS refresh interval the idle connections of the
+// transport are closed at this interval so its hosts are resolved again.
+func (p *Pool) Get(purpose string, settings interface{}, dnsRefresh time.Duration, build BuildFunc) (*http.Transport, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if e, ok := p.entries[purpose]; ok {
+		if reflect.DeepEqual(e.settings, settings) {
+			return e.transport, nil
+		}
+		e.close()
+		delete(p.entries, purpose)
+		log.Debug().Str("purpose", purpose).Msg("Replace HTTP transport")
+	}
+
+	t, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{
+		settings:  settings,
+		transport: t,
+		done:      make(chan struct{}),
+	}
+	if dnsRefresh > 0 {
+		go e.refresh(dnsRefresh)
+	}
+	p.entries[purpose] = e
+	return t, nil
+}
+
+// Recycle closes the idle connections of the transports of the purposes, so
+// the next requests dial new ones.
+func (p *Pool) Recycle(purposes ...string) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	for _, purpose := range purposes {
+		if e, ok := p.entries[purpose]; ok {
+			e.transport.CloseIdleConnections()
+		}
+	}
+}
+
+// Close closes the idle connections of the transports and forgets them.
+func (p *Pool) Close() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	for purpose, e := range p.entries {
+		e.close()
+		delete(p.entries, purpose)
+	}
+}
+
+func (e *entry) close() {
+	close(e.done)
+	e.transport.CloseIdleConnections()
+}
+
+func (e *entry) refresh(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-tick.C:
+			e.transport.CloseIdleConnections()
+		}
+	}
+}
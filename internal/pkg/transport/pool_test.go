@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolGet(t *testing.T) {
+	p := NewPool()
+	defer p.Close()
+
+	var built int
+	build := func() (*http.Transport, error) {
+		built++
+		return &http.Transport{}, nil
+	}
+
+	type settings struct {
+		Hosts []string
+	}
+
+	t1, err := p.Get(PurposeElasticsearch, settings{[]string{"a"}}, 0, build)
+	require.NoError(t, err)
+
+	// Same purpose and settings share the transport
+	t2, err := p.Get(PurposeElasticsearch, settings{[]string{"a"}}, 0, build)
+	require.NoError(t, err)
+	assert.Same(t, t1, t2)
+
+	// Another purpose has its own
+	t3, err := p.Get(PurposeElasticsearchLongPoll, settings{[]string{"a"}}, 0, build)
+	require.NoError(t, err)
+	assert.NotSame(t, t1, t3)
+
+	// Changed settings replace the transport
+	t4, err := p.Get(PurposeElasticsearch, settings{[]string{"b"}}, 0, build)
+	require.NoError(t, err)
+	assert.NotSame(t, t1, t4)
+	assert.Equal(t, 3, built)
+}
+
+func TestPoolGetError(t *testing.T) {
+	p := NewPool()
+	defer p.Close()
+
+	errBuild := errors.New("build")
+	_, err := p.Get(PurposeElasticsearch, nil, 0, func() (*http.Transport, error) {
+		return nil, errBuild
+	})
+	assert.Equal(t, errBuild, err)
+
+	// Not kept; built again
+	tr, err := p.Get(PurposeElasticsearch, nil, 0, func() (*http.Transport, error) {
+		return &http.Transport{}, nil
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, tr)
+}
@@ -0,0 +1,148 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Endpoint is a host and the addresses it last resolved to.
+type Endpoint struct {
+	Host       string
+	Addrs      []string
+	Err        error // of the last resolution; the addresses are the last known
+	ResolvedAt time.Time
+}
+
+// LookupFunc resolves a host to its addresses.
+type LookupFunc func(ctx context.Context, host string) ([]string, error)
+
+// Resolver resolves hosts at an interval and recycles the connections of the
+// transports of their purposes when their addresses change, so the clients
+// follow hosts moving to other addresses without a restart. Hosts given as IP
+// addresses are not resolved.
+type Resolver struct {
+	pool     *Pool
+	purposes []string
+	interval time.Duration
+	lookup   LookupFunc
+
+	mut       sync.RWMutex
+	endpoints []Endpoint
+}
+
+// NewResolver returns the resolver of the hosts of the URLs, recycling the
+// transports of the purposes in the pool.
+func NewResolver(pool *Pool, urls []string, interval time.Duration, purposes ...string) *Resolver {
+	r := &Resolver{
+		pool:     pool,
+		purposes: purposes,
+		interval: interval,
+		lookup:   net.DefaultResolver.LookupHost,
+	}
+
+	seen := make(map[string]bool)
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if host == "" || seen[host] || net.ParseIP(host) != nil {
+			continue
+		}
+		seen[host] = true
+		r.endpoints = append(r.endpoints, Endpoint{Host: host})
+	}
+	return r
+}
+
+// Run resolves the hosts every interval until the context is done.
+func (r *Resolver) Run(ctx context.Context) error {
+	if len(r.endpoints) == 0 {
+		return nil
+	}
+
+	r.resolve(ctx)
+
+	tick := time.NewTicker(r.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+			r.resolve(ctx)
+		}
+	}
+}
+
+// Endpoints returns the hosts and the addresses they last resolved to.
+func (r *Resolver) Endpoints() []Endpoint {
+	if r == nil {
+		return nil
+	}
+
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+
+	endpoints := make([]Endpoint, len(r.endpoints))
+	copy(endpoints, r.endpoints)
+	return endpoints
+}
+
+// resolve resolves every host and recycles the transports once if any
+// resolved to other addresses than before. A failed resolution keeps the
+// last known addresses.
+func (r *Resolver) resolve(ctx context.Context) {
+	r.mut.RLock()
+	endpoints := make([]Endpoint, len(r.endpoints))
+	copy(endpoints, r.endpoints)
+	r.mut.RUnlock()
+
+	var changed bool
+	now := time.Now()
+	for i := range endpoints {
+		e := &endpoints[i]
+
+		addrs, err := r.lookup(ctx, e.Host)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Str("host", e.Host).Msg("Fail to resolve host; keep the last known addresses")
+			e.Err = err
+			continue
+		}
+		sort.Strings(addrs)
+
+		if e.Addrs != nil && !reflect.DeepEqual(e.Addrs, addrs) {
+			log.Info().
+				Str("host", e.Host).
+				Strs("old", e.Addrs).
+				Strs("new", addrs).
+				Msg("Host resolves to other addresses; recycle connections")
+			changed = true
+		}
+		e.Addrs, e.Err, e.ResolvedAt = addrs, nil, now
+	}
+
+	r.mut.Lock()
+	r.endpoints = endpoints
+	r.mut.Unlock()
+
+	if changed {
+		r.pool.Recycle(r.purposes...)
+	}
+}
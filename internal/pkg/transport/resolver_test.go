@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverHosts(t *testing.T) {
+	r := NewResolver(NewPool(), []string{
+		"https://es-1.example.com:9200",
+		"https://es-1.example.com:9201",
+		"http://10.0.0.1:9200",
+		"http://[::1]:9200",
+		"https://es-2.example.com:9200/path",
+	}, time.Minute)
+
+	var hosts []string
+	for _, e := range r.Endpoints() {
+		hosts = append(hosts, e.Host)
+	}
+	assert.Equal(t, []string{"es-1.example.com", "es-2.example.com"}, hosts)
+}
+
+func TestResolverRecycle(t *testing.T) {
+	pool := NewPool()
+	defer pool.Close()
+	_, err := pool.Get(PurposeElasticsearch, nil, 0, func() (*http.Transport, error) {
+		return &http.Transport{}, nil
+	})
+	require.NoError(t, err)
+
+	addrs := map[string][]string{"es.example.com": {"10.0.0.2", "10.0.0.1"}}
+	var lookupErr error
+	r := NewResolver(pool, []string{"https://es.example.com:9200"}, time.Minute, PurposeElasticsearch)
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return append([]string(nil), addrs[host]...), lookupErr
+	}
+
+	ctx := context.Background()
+	r.resolve(ctx)
+	e := r.Endpoints()[0]
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, e.Addrs)
+	assert.NoError(t, e.Err)
+	assert.False(t, e.ResolvedAt.IsZero())
+
+	// Failures keep the last known addresses
+	lookupErr = errors.New("no such host")
+	r.resolve(ctx)
+	e = r.Endpoints()[0]
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, e.Addrs)
+	assert.Equal(t, lookupErr, e.Err)
+
+	lookupErr = nil
+	addrs["es.example.com"] = []string{"10.0.0.3"}
+	r.resolve(ctx)
+	e = r.Endpoints()[0]
+	assert.Equal(t, []string{"10.0.0.3"}, e.Addrs)
+	assert.NoError(t, e.Err)
+}
+
+func TestResolverNil(t *testing.T) {
+	var r *Resolver
+	assert.Nil(t, r.Endpoints())
+}
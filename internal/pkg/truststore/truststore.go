@@ -0,0 +1,259 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package truststore provides the certificate authorities trusted for the
+// outbound connections of Fleet Server beyond the configured PEM files: those
+// of the operating system and those of a directory, picked up as it changes.
+package truststore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoPeerCertificate = errors.New("server presented no certificate")
+
+// Store is the pool of certificate authorities of the operating system and of
+// a directory. The directory is either flat, holding PEM files with any
+// number of certificates each, or hashed as by OpenSSL's c_rehash; its files
+// are checked for changes at most once per interval, when the pool is used.
+type Store struct {
+	dir      string
+	system   bool
+	interval time.Duration
+
+	mut     sync.Mutex
+	pool    *x509.CertPool
+	sig     string
+	checked time.Time
+	now     func() time.Time
+}
+
+// New loads the store; dir is empty when only the system authorities are
+// trusted.
+func New(dir string, system bool, interval time.Duration) (*Store, error) {
+	s := &Store{
+		dir:      dir,
+		system:   system,
+		interval: interval,
+		now:      time.Now,
+	}
+
+	sig, err := s.signature()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.load(sig); err != nil {
+		return nil, err
+	}
+	s.checked = s.now()
+	return s, nil
+}
+
+// Pool returns the trusted certificate authorities, reloading the directory
+// if its files changed. The previous pool is kept when reloading fails.
+func (s *Store) Pool() *x509.CertPool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	now := s.now()
+	if s.dir == "" || now.Sub(s.checked) < s.interval {
+		return s.pool
+	}
+	s.checked = now
+
+	sig, err := s.signature()
+	if err == nil && sig != s.sig {
+		err = s.load(sig)
+		if err == nil {
+			log.Info().Str("dir", s.dir).Msg("Reloaded certificate authorities")
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("dir", s.dir).Msg("Fail reload certificate authorities; keep the loaded ones")
+	}
+	return s.pool
+}
+
+// VerifyConnection returns the verification of the server certificate chain
+// against the store and the configured roots, which may be nil. The host name
+// is checked unless verifyHost is false. When pins are given, as the ca_sha256
+// of the TLS config, a certificate of the verified chain must also have the
+// SHA-256 of its public key among them. It replaces the verification of the
+// TLS config, which must skip its own and have no VerifyPeerCertificate.
+func (s *Store) VerifyConnection(roots *x509.CertPool, verifyHost bool, pins []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrNoPeerCertificate
+		}
+		opts := x509.VerifyOptions{
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		if verifyHost {
+			opts.DNSName = cs.ServerName
+		}
+		err := error(x509.UnknownAuthorityError{Cert: cs.PeerCertificates[0]})
+		var pinErr error
+		for _, pool := range []*x509.CertPool{s.Pool(), roots} {
+			if pool == nil {
+				continue
+			}
+			opts.Roots = pool
+			chains, verr := cs.PeerCertificates[0].Verify(opts)
+			if verr != nil {
+				err = verr
+				continue
+			}
+			if pinErr = verifyPin(pins, chains); pinErr == nil {
+				return nil
+			}
+		}
+		// A chain verified but not pinned is the reason of the failure
+		if pinErr != nil {
+			return pinErr
+		}
+		return err
+	}
+}
+
+// verifyPin checks that a certificate of the chains has its public key pinned,
+// if any is.
+func verifyPin(pins []string, chains [][]*x509.Certificate) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			fp := tlscommon.Fingerprint(cert)
+			for _, pin := range pins {
+				if pin == fp {
+					return nil
+				}
+			}
+		}
+	}
+	return tlscommon.ErrCAPinMissmatch
+}
+
+// load builds the pool from the system authorities and the directory.
+func (s *Store) load(sig string) error {
+	pool := x509.NewCertPool()
+	if s.system {
+		sys, err := x509.SystemCertPool()
+		if err != nil {
+			return fmt.Errorf("load system certificate authorities: %w", err)
+		}
+		pool = sys
+	}
+
+	if s.dir != "" {
+		files, err := ioutil.ReadDir(s.dir)
+		if err != nil {
+			return err
+		}
+		var n int
+		for _, f := range files {
+			path := filepath.Join(s.dir, f.Name())
+			data, err := readRegular(path)
+			if err != nil {
+				return err
+			}
+			added := appendCerts(pool, data)
+			if data != nil && added == 0 {
+				log.Debug().Str("file", path).Msg("No certificate authority in file")
+			}
+			n += added
+		}
+		log.Debug().Str("dir", s.dir).Int("certificates", n).Msg("Loaded certificate authorities")
+	}
+
+	s.pool = pool
+	s.sig = sig
+	return nil
+}
+
+// signature identifies the state of the directory by the name, size and
+// modification time of its files.
+func (s *Store) signature() (string, error) {
+	if s.dir == "" {
+		return "", nil
+	}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return "", err
+	}
+
+	entries := make([]string, 0, len(files))
+	for _, f := range files {
+		// Stat through the links of hashed directories
+		fi, err := os.Stat(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s:%d:%d", f.Name(), fi.Size(), fi.ModTime().UnixNano()))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, "\n"), nil
+}
+
+// readRegular reads the file if it is a regular one or a link to one, and
+// returns nil otherwise.
+func readRegular(path string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		// dangling link
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+// appendCerts adds the PEM certificates of data to the pool and returns how
+// many were added.
+func appendCerts(pool *x509.CertPool, data []byte) int {
+	var n int
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return n
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		pool.AddCert(cert)
+		n++
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !integration
+
+package truststore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func makeCA(t *testing.T, cn string) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (ca testCA) issue(t *testing.T, host string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestStoreVerifyConnection(t *testing.T) {
+	dir := t.TempDir()
+	dirCA := makeCA(t, "dir")
+	cfgCA := makeCA(t, "configured")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca.pem"), dirCA.pem, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600))
+
+	s, err := New(dir, false, time.Minute)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cfgCA.cert)
+
+	verify := s.VerifyConnection(roots, true, nil)
+	state := func(cert *x509.Certificate, host string) tls.ConnectionState {
+		return tls.ConnectionState{ServerName: host, PeerCertificates: []*x509.Certificate{cert}}
+	}
+
+	assert.NoError(t, verify(state(dirCA.issue(t, "es.local"), "es.local")))
+	assert.NoError(t, verify(state(cfgCA.issue(t, "es.local"), "es.local")))
+	assert.Error(t, verify(state(makeCA(t, "other").issue(t, "es.local"), "es.local")))
+	assert.Error(t, verify(state(dirCA.issue(t, "es.local"), "other.local")))
+	assert.Equal(t, ErrNoPeerCertificate, verify(tls.ConnectionState{}))
+
+	// Without host verification only the chain is checked
+	assert.NoError(t, s.VerifyConnection(nil, false, nil)(state(dirCA.issue(t, "es.local"), "other.local")))
+
+	// The pins are checked against the verified chain, whichever root it ends in
+	pinned := s.VerifyConnection(roots, true, []string{tlscommon.Fingerprint(cfgCA.cert)})
+	assert.NoError(t, pinned(state(cfgCA.issue(t, "es.local"), "es.local")))
+	assert.Equal(t, tlscommon.ErrCAPinMissmatch, pinned(state(dirCA.issue(t, "es.local"), "es.local")))
+	assert.Error(t, pinned(state(cfgCA.issue(t, "es.local"), "other.local")))
+	pinned = s.VerifyConnection(nil, false, []string{tlscommon.Fingerprint(dirCA.cert)})
+	assert.NoError(t, pinned(state(dirCA.issue(t, "es.local"), "other.local")))
+}
+
+func TestStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := makeCA(t, "old")
+	newCA := makeCA(t, "new")
+	path := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(path, oldCA.pem, 0600))
+
+	s, err := New(dir, false, time.Minute)
+	require.NoError(t, err)
+	now := s.checked
+	s.now = func() time.Time { return now }
+
+	verify := s.VerifyConnection(nil, false, nil)
+	leaf := newCA.issue(t, "es.local")
+	conn := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	assert.Error(t, verify(conn))
+
+	// Hashed directories link the certificates under their subject hash
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new.pem"), newCA.pem, 0600))
+	require.NoError(t, os.Symlink("new.pem", filepath.Join(dir, "1a2b3c4d.0")))
+
+	// Not checked again before the interval
+	assert.Error(t, verify(conn))
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, verify(conn))
+
+	// A failing reload keeps the loaded authorities
+	require.NoError(t, os.RemoveAll(dir))
+	now = now.Add(time.Minute)
+	assert.NoError(t, verify(conn))
+}
@@ -6,6 +6,8 @@
 //go:generate go fmt internal/pkg/model/schema.go
 //go:generate schema-generate -m es -o internal/pkg/es/mapping.go -p es model/schema.json
 //go:generate go fmt internal/pkg/es/mapping.go
+//go:generate go run ./dev-tools/openapi-gen -o cmd/fleet/api.go -p fleet model/openapi.json
+//go:generate go run ./dev-tools/envdoc -o docs/environment-variables.md
 
 package main
 